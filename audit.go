@@ -11,8 +11,13 @@ import (
 	"time"
 
 	"zrp/internal/audit"
+	"zrp/internal/models"
 )
 
+// auditArchiveDir holds the sealed files retention cleanup moves old
+// audit entries into.
+var auditArchiveDir = "audit-archives"
+
 // Audit action constant aliases for backward compatibility.
 const (
 	AuditActionCreate        = audit.ActionCreate
@@ -68,8 +73,8 @@ func LogSimpleAudit(dbConn *sql.DB, r *http.Request, action, module, recordID, s
 	audit.LogSimpleAudit(dbConn, wsHub, r, action, module, recordID, summary)
 }
 
-func CleanupOldAuditLogs(dbConn *sql.DB, retentionDays int) (int64, error) {
-	return audit.CleanupOldAuditLogs(dbConn, retentionDays)
+func CleanupOldAuditLogs(dbConn *sql.DB, retentionDays int) (models.AuditArchive, error) {
+	return audit.CleanupOldAuditLogs(dbConn, auditArchiveDir, retentionDays)
 }
 
 func LogSensitiveDataAccess(dbConn *sql.DB, r *http.Request, dataType, recordID, details string) {
@@ -259,6 +264,9 @@ func handleAuditRetention(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "PUT" {
+		if !requireAuditAdmin(w, r) {
+			return
+		}
 		var req struct {
 			RetentionDays int `json:"retention_days"`
 		}
@@ -287,21 +295,25 @@ func handleAuditRetention(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Method == "POST" && r.URL.Path == "/api/audit/cleanup" {
+	if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/audit/cleanup") {
+		if !requireAuditAdmin(w, r) {
+			return
+		}
 		days := GetAuditRetentionDays(db)
-		deleted, err := CleanupOldAuditLogs(db, days)
+		archive, err := CleanupOldAuditLogs(db, days)
 		if err != nil {
 			jsonErr(w, err.Error(), 500)
 			return
 		}
 
 		LogSimpleAudit(db, r, "cleanup", "audit_log", "retention",
-			fmt.Sprintf("Cleaned up %d old audit logs (retention: %d days)", deleted, days))
+			fmt.Sprintf("Archived %d old audit logs to %s (retention: %d days)", archive.Entries, archive.File, days))
 
 		jsonResp(w, map[string]interface{}{
 			"success": true,
-			"deleted": deleted,
-			"message": fmt.Sprintf("Deleted %d audit log entries older than %d days", deleted, days),
+			"deleted": archive.Entries,
+			"archive": archive,
+			"message": fmt.Sprintf("Archived %d audit log entries older than %d days", archive.Entries, days),
 		})
 		return
 	}
@@ -309,6 +321,92 @@ func handleAuditRetention(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Method not allowed", 405)
 }
 
+// requireAuditAdmin rejects changes to the audit trail by anyone but an
+// admin. The audit routes are outside the RBAC permission map.
+func requireAuditAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if role, _ := r.Context().Value(ctxRole).(string); role != "admin" {
+		jsonErr(w, "Forbidden: admin only", 403)
+		return false
+	}
+	return true
+}
+
+// handleAuditVerify handles GET /api/audit/verify: walks the audit hash
+// chain, its checkpoints and the sealed retention archives.
+func handleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	report, err := audit.VerifyChain(db, auditArchiveDir)
+	if err != nil {
+		jsonErr(w, err.Error(), 500)
+		return
+	}
+	jsonResp(w, report)
+}
+
+// handleAuditCheckpoints handles GET/POST /api/audit/checkpoints. POST
+// signs the current head of the chain.
+func handleAuditCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if !requireAuditAdmin(w, r) {
+			return
+		}
+		c, err := audit.CreateCheckpoint(db, "manual")
+		if err == audit.ErrNothingToCheckpoint {
+			jsonErr(w, err.Error(), 400)
+			return
+		}
+		if err == audit.ErrNoSigningKey {
+			jsonErr(w, err.Error(), 503)
+			return
+		}
+		if err != nil {
+			jsonErr(w, err.Error(), 500)
+			return
+		}
+		jsonResp(w, c)
+		return
+	}
+	checkpoints, err := audit.ListCheckpoints(db)
+	if err != nil {
+		jsonErr(w, err.Error(), 500)
+		return
+	}
+	jsonResp(w, checkpoints)
+}
+
+// handleAuditArchives handles GET /api/audit/archives.
+func handleAuditArchives(w http.ResponseWriter, r *http.Request) {
+	archives, err := audit.ListArchives(db)
+	if err != nil {
+		jsonErr(w, err.Error(), 500)
+		return
+	}
+	jsonResp(w, archives)
+}
+
+// handleESignSettings handles GET/PUT /api/settings/esign: whether ECO,
+// document and CAPA approvals must be electronically signed.
+func handleESignSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		var req struct {
+			Required bool `json:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonErr(w, err.Error(), 400)
+			return
+		}
+		if err := audit.SetSignaturesRequired(db, req.Required); err != nil {
+			jsonErr(w, err.Error(), 500)
+			return
+		}
+		LogSimpleAudit(db, r, AuditActionUpdate, "settings", "esign_required",
+			fmt.Sprintf("Set electronic signatures required to %t", req.Required))
+	}
+	jsonResp(w, map[string]interface{}{
+		"required": audit.SignaturesRequired(db),
+		"meanings": audit.SignatureMeanings,
+	})
+}
+
 func handleDashboardCharts(w http.ResponseWriter, r *http.Request) {
 	ecoStatuses := map[string]int{"draft": 0, "review": 0, "approved": 0, "implemented": 0}
 	rows, _ := db.Query("SELECT status, COUNT(*) FROM ecos GROUP BY status")
@@ -48,7 +48,8 @@ export function usePresence(
       `/api/v1/presence?resource_type=${resourceType}&resource_id=${resourceId}`
     )
       .then((res) => res.json())
-      .then((data) => {
+      .then((json) => {
+        const data = json && typeof json === "object" && "data" in json ? json.data : json;
         if (Array.isArray(data)) {
           setPresence(data);
         }
@@ -57,6 +58,20 @@ export function usePresence(
         // Graceful degradation
         setPresence([]);
       });
+
+    return () => {
+      const conn = (window as any).__wsConnection;
+      if (conn && conn.readyState === WebSocket.OPEN) {
+        conn.send(
+          JSON.stringify({
+            type: "presence",
+            resource_type: resourceType,
+            resource_id: resourceId,
+            action: "left",
+          })
+        );
+      }
+    };
   }, [status, resourceType, resourceId, action]);
 
   // Subscribe to presence updates
@@ -71,7 +86,7 @@ export function usePresence(
         ) {
           setPresence((prev) => {
             const filtered = prev.filter((p) => p.user_id !== info.user_id);
-            return [...filtered, info];
+            return info.action === "left" ? filtered : [...filtered, info];
           });
         }
       }
@@ -1,5 +1,5 @@
 import { describe, it, expect, vi, beforeEach, afterEach } from 'vitest';
-import { api } from './api';
+import { api, ConflictError, PreconditionRequiredError } from './api';
 
 describe('API Client', () => {
   let originalFetch: typeof global.fetch;
@@ -829,4 +829,64 @@ describe('API Client', () => {
       }));
     });
   });
+
+  describe('Optimistic concurrency', () => {
+    it('sends the ETag from when the record was loaded as If-Match', async () => {
+      mockFetch.mockResolvedValueOnce({
+        ok: true,
+        headers: new Headers({ ETag: '"v1"' }),
+        json: async () => ({ data: { id: 'WO-ETAG-1' } }),
+      });
+      mockFetch.mockResolvedValueOnce({
+        ok: true,
+        headers: new Headers({ ETag: '"v2"' }),
+        json: async () => ({ data: { id: 'WO-ETAG-1' } }),
+      });
+
+      await api.getWorkOrder('WO-ETAG-1');
+      await api.updateWorkOrder('WO-ETAG-1', { notes: 'x' });
+      expect(mockFetch).toHaveBeenCalledTimes(2);
+      expect(mockFetch.mock.calls[1][1].headers['If-Match']).toBe('"v1"');
+    });
+
+    it('does not fetch a fresh ETag for a record that was never loaded', async () => {
+      mockFetch.mockResolvedValueOnce({
+        ok: false,
+        status: 428,
+        headers: new Headers({ ETag: '"current"' }),
+        json: async () => ({ error: 'If-Match header required', code: 'PRECONDITION_REQUIRED' }),
+      });
+      mockFetch.mockResolvedValueOnce({
+        ok: false,
+        status: 428,
+        headers: new Headers({ ETag: '"current"' }),
+        json: async () => ({ error: 'If-Match header required', code: 'PRECONDITION_REQUIRED' }),
+      });
+
+      await expect(api.updateWorkOrder('WO-ETAG-2', { notes: 'x' })).rejects.toBeInstanceOf(PreconditionRequiredError);
+      expect(mockFetch).toHaveBeenCalledTimes(1);
+      expect(mockFetch.mock.calls[0][1].headers['If-Match']).toBeUndefined();
+
+      // The ETag on the rejection is not reused for a blind retry.
+      await expect(api.updateWorkOrder('WO-ETAG-2', { notes: 'x' })).rejects.toBeInstanceOf(PreconditionRequiredError);
+      expect(mockFetch.mock.calls[1][1].headers['If-Match']).toBeUndefined();
+    });
+
+    it('throws ConflictError when the record changed since it was loaded', async () => {
+      mockFetch.mockResolvedValueOnce({
+        ok: true,
+        headers: new Headers({ ETag: '"old"' }),
+        json: async () => ({ data: { id: 'ECO-ETAG-1' } }),
+      });
+      mockFetch.mockResolvedValueOnce({
+        ok: false,
+        status: 409,
+        headers: new Headers({ ETag: '"new"' }),
+        json: async () => ({ error: 'Record was modified', code: 'CONFLICT', etag: '"new"' }),
+      });
+
+      await api.getECO('ECO-ETAG-1');
+      await expect(api.updateECO('ECO-ETAG-1', { title: 'x' })).rejects.toBeInstanceOf(ConflictError);
+    });
+  });
 });
@@ -641,21 +641,66 @@ export interface EmailLogEntry {
 }
 
 // API client class
+/** Thrown when a PUT is rejected because the record changed since it was loaded. */
+export class ConflictError extends Error {
+  status = 409;
+  constructor(message: string) {
+    super(message);
+    this.name = 'ConflictError';
+  }
+}
+
+/** Thrown when a PUT is rejected because the record was not loaded first. */
+export class PreconditionRequiredError extends Error {
+  status = 428;
+  constructor(message: string) {
+    super(message);
+    this.name = 'PreconditionRequiredError';
+  }
+}
+
 class ApiClient {
+  /** Last ETag seen per record endpoint, sent back as If-Match on PUT. */
+  private etags = new Map<string, string>();
+
+  private etagKey(endpoint: string): string {
+    return endpoint.split('?')[0];
+  }
+
   private async request<T>(
     endpoint: string,
     options: RequestInit = {}
   ): Promise<T> {
     const url = `${API_BASE}${endpoint}`;
-    
+    const method = (options.method || 'GET').toUpperCase();
+    const key = this.etagKey(endpoint);
+    const headers: Record<string, string> = {
+      'Content-Type': 'application/json',
+      ...(options.headers as Record<string, string> | undefined),
+    };
+
+    // Only send the version the record was loaded at. Without one the
+    // server answers 428 rather than letting the update overwrite a
+    // concurrent edit.
+    if (method === 'PUT' && !headers['If-Match']) {
+      const etag = this.etags.get(key);
+      if (etag) headers['If-Match'] = etag;
+    }
+
     const response = await fetch(url, {
-      headers: {
-        'Content-Type': 'application/json',
-        ...options.headers,
-      },
       ...options,
+      headers,
     });
 
+    // 409 and 428 responses carry the current ETag too; caching it would
+    // make a blind retry succeed.
+    const etag = response.headers?.get('ETag');
+    if (response.ok && etag && (method === 'GET' || method === 'PUT')) {
+      this.etags.set(key, etag);
+    } else if (response.ok && method === 'DELETE') {
+      this.etags.delete(key);
+    }
+
     if (!response.ok) {
       if (response.status === 401 && !endpoint.includes('/auth/')) {
         // Session expired — redirect to login
@@ -663,6 +708,12 @@ class ApiClient {
         throw new Error('Session expired');
       }
       const body = await response.json().catch(() => ({ error: response.statusText }));
+      if (response.status === 409 && body.code === 'CONFLICT') {
+        throw new ConflictError(body.error);
+      }
+      if (response.status === 428 && body.code === 'PRECONDITION_REQUIRED') {
+        throw new PreconditionRequiredError(body.error);
+      }
       throw new Error(body.error || `API error: ${response.statusText}`);
     }
 
@@ -0,0 +1,51 @@
+package main
+
+import "net/http"
+
+func handleListEightDs(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().ListEightDs(w, r)
+}
+
+func handleGetEightD(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().GetEightD(w, r, id)
+}
+
+func handleCreateEightD(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().CreateEightD(w, r)
+}
+
+func handleUpdateEightDDiscipline(w http.ResponseWriter, r *http.Request, id, step string) {
+	getQualityHandler().UpdateEightDDiscipline(w, r, id, step)
+}
+
+func handleCompleteEightDDiscipline(w http.ResponseWriter, r *http.Request, id, step string) {
+	getQualityHandler().CompleteEightDDiscipline(w, r, id, step)
+}
+
+func handleAddEightDMember(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().AddEightDMember(w, r, id)
+}
+
+func handleRemoveEightDMember(w http.ResponseWriter, r *http.Request, id, username string) {
+	getQualityHandler().RemoveEightDMember(w, r, id, username)
+}
+
+func handleAddEightDCause(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().AddEightDCause(w, r, id)
+}
+
+func handleDeleteEightDCause(w http.ResponseWriter, r *http.Request, id, causeID string) {
+	getQualityHandler().DeleteEightDCause(w, r, id, causeID)
+}
+
+func handleAddEightDAction(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().AddEightDAction(w, r, id)
+}
+
+func handleUpdateEightDAction(w http.ResponseWriter, r *http.Request, id, actionID string) {
+	getQualityHandler().UpdateEightDAction(w, r, id, actionID)
+}
+
+func handleEightDPDF(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().EightDPDF(w, r, id)
+}
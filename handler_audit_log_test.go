@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"testing"
 	"time"
 
+	"zrp/internal/audit"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -245,6 +248,16 @@ func setupAuditTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create test session: %v", err)
 	}
 
+	// These tables carry no users to sign with; signing is covered by
+	// the engineering handler tests.
+	_, err = testDB.Exec(`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`)
+	if err != nil {
+		t.Fatalf("Failed to create app_settings table: %v", err)
+	}
+	if err := audit.SetSignaturesRequired(testDB, false); err != nil {
+		t.Fatalf("Failed to make signatures optional: %v", err)
+	}
+
 	return testDB
 }
 
@@ -1013,3 +1026,45 @@ func TestAuditLog_Completeness_AllOperations(t *testing.T) {
 
 	t.Logf("✓ Audit log completeness verified for all CRUD operations")
 }
+
+func TestAuditMaintenanceRequiresAdmin(t *testing.T) {
+	t.Setenv(audit.KeyEnv, "test-audit-key")
+	oldDB := db
+	db = setupTestDB(t)
+	defer func() { db.Close(); db = oldDB }()
+	audit.LogAudit(db, nil, "admin", "create", "parts", "R-1", "Created R-1")
+
+	call := func(role, method, path, body string, handler http.HandlerFunc) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), ctxRole, role))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+	for _, role := range []string{"user", ""} {
+		if code := call(role, "POST", "/api/v1/audit/checkpoints", "", handleAuditCheckpoints); code != 403 {
+			t.Errorf("checkpoint as %q: expected 403, got %d", role, code)
+		}
+		if code := call(role, "POST", "/api/v1/audit/cleanup", "", handleAuditRetention); code != 403 {
+			t.Errorf("cleanup as %q: expected 403, got %d", role, code)
+		}
+		if code := call(role, "PUT", "/api/v1/audit/retention", `{"retention_days":30}`, handleAuditRetention); code != 403 {
+			t.Errorf("retention as %q: expected 403, got %d", role, code)
+		}
+	}
+	if days := GetAuditRetentionDays(db); days == 30 {
+		t.Errorf("non-admin changed retention to %d days", days)
+	}
+	if code := call("user", "GET", "/api/v1/audit/checkpoints", "", handleAuditCheckpoints); code != 200 {
+		t.Errorf("listing checkpoints: expected 200, got %d", code)
+	}
+
+	if code := call("admin", "POST", "/api/v1/audit/checkpoints", "", handleAuditCheckpoints); code != 200 {
+		t.Errorf("checkpoint as admin: expected 200, got %d", code)
+	}
+	t.Setenv(audit.KeyEnv, "")
+	audit.LogAudit(db, nil, "admin", "update", "parts", "R-1", "Updated R-1")
+	if code := call("admin", "POST", "/api/v1/audit/checkpoints", "", handleAuditCheckpoints); code != 503 {
+		t.Errorf("checkpoint without signing key: expected 503, got %d", code)
+	}
+}
@@ -1,21 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
 	"time"
+
+	"zrp/internal/backup"
 )
 
 var (
-	backupDir       = "backups"
-	backupMu        sync.Mutex
-	backupRetention = 7
+	backupDir  = "backups"
+	uploadsDir = "uploads"
+	backupMu   sync.Mutex
 )
 
 func startAutoBackup(backupTime string) {
@@ -39,42 +41,84 @@ func startAutoBackup(backupTime string) {
 			} else {
 				log.Println("Auto-backup completed")
 				cleanOldBackups()
+				uploadLatestBackup()
+			}
+		}
+	}()
+
+	// Retry failed off-site uploads between nightly runs.
+	go func() {
+		for {
+			time.Sleep(15 * time.Minute)
+			if _, err := backupUploader().ProcessPending(context.Background()); err != nil {
+				log.Printf("Backup upload retry failed: %v", err)
 			}
 		}
 	}()
 }
 
-func performBackup() error {
-	backupMu.Lock()
-	defer backupMu.Unlock()
+func backupUploader() *backup.Uploader {
+	return &backup.Uploader{DB: db, Dir: backupDir}
+}
 
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("create backup dir: %w", err)
+// uploadLatestBackup sends the newest local backup to every enabled
+// off-site target, then applies the retention policy at each target.
+func uploadLatestBackup() {
+	backups, err := listBackups()
+	if err != nil || len(backups) == 0 {
+		return
 	}
-
-	ts := time.Now().Format("2006-01-02T15-04-05")
-	filename := fmt.Sprintf("zrp-backup-%s.db", ts)
-	destPath := filepath.Join(backupDir, filename)
-
-	// If file exists, add a counter suffix
-	counter := 1
-	for {
-		if _, err := os.Stat(destPath); os.IsNotExist(err) {
-			break
-		}
-		filename = fmt.Sprintf("zrp-backup-%s-%d.db", ts, counter)
-		destPath = filepath.Join(backupDir, filename)
-		counter++
+	u := backupUploader()
+	n, err := u.Enqueue(backups[0].Filename)
+	if err != nil {
+		log.Printf("Failed to queue backup upload: %v", err)
+		return
 	}
-
-	_, err := db.Exec(fmt.Sprintf(`VACUUM INTO '%s'`, destPath))
+	if n == 0 {
+		return
+	}
+	ctx := context.Background()
+	if _, err := u.ProcessPending(ctx); err != nil {
+		log.Printf("Backup upload failed: %v", err)
+	}
+	targets, err := backup.ListTargets(db, true)
 	if err != nil {
-		return fmt.Errorf("vacuum into: %w", err)
+		return
 	}
+	policy := backup.LoadPolicy(db)
+	for _, t := range targets {
+		removed, err := u.Prune(ctx, t, policy)
+		if err != nil {
+			log.Printf("Failed to prune backups at %s: %v", t.Name, err)
+		}
+		for _, name := range removed {
+			log.Printf("Removed old backup %s from %s", name, t.Name)
+		}
+	}
+}
 
-	return nil
+// performBackup writes an archive of the database, uploads and gitplm
+// settings to backupDir.
+func performBackup() error {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	var gitplmBaseURL string
+	db.QueryRow("SELECT value FROM app_settings WHERE key = 'gitplm_base_url'").Scan(&gitplmBaseURL)
+
+	_, err := backup.Create(db, backup.Options{
+		Dir:        backupDir,
+		UploadsDir: uploadsDir,
+		GitPLM: map[string]string{
+			"parts_dir": partsDir,
+			"ui_url":    gitplmUIURL,
+			"base_url":  gitplmBaseURL,
+		},
+	})
+	return err
 }
 
+// cleanOldBackups removes backups not kept by the retention policy.
 func cleanOldBackups() {
 	backups, err := listBackups()
 	if err != nil {
@@ -82,21 +126,21 @@ func cleanOldBackups() {
 		return
 	}
 
-	if len(backups) <= backupRetention {
-		return
+	items := make([]backup.Item, 0, len(backups))
+	for _, b := range backups {
+		ts, ok := backup.ParseTime(b.Filename)
+		if !ok {
+			ts, _ = time.Parse(time.RFC3339, b.CreatedAt)
+		}
+		items = append(items, backup.Item{Name: b.Filename, Time: ts})
 	}
 
-	// Sort oldest first
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Filename < backups[j].Filename
-	})
-
-	for i := 0; i < len(backups)-backupRetention; i++ {
-		path := filepath.Join(backupDir, backups[i].Filename)
+	for _, name := range backup.Expired(items, backup.LoadPolicy(db)) {
+		path := filepath.Join(backupDir, name)
 		if err := os.Remove(path); err != nil {
-			log.Printf("Failed to remove old backup %s: %v", backups[i].Filename, err)
+			log.Printf("Failed to remove old backup %s: %v", name, err)
 		} else {
-			log.Printf("Removed old backup: %s", backups[i].Filename)
+			log.Printf("Removed old backup: %s", name)
 		}
 	}
 }
@@ -112,17 +156,22 @@ func listBackups() ([]BackupInfo, error) {
 
 	var backups []BackupInfo
 	for _, e := range entries {
-		if e.IsDir() || !strings.HasPrefix(e.Name(), "zrp-backup-") || !strings.HasSuffix(e.Name(), ".db") {
+		if e.IsDir() || !backup.IsBackupName(e.Name()) {
 			continue
 		}
 		info, err := e.Info()
 		if err != nil {
 			continue
 		}
+		kind := "database"
+		if backup.IsArchive(e.Name()) {
+			kind = "archive"
+		}
 		backups = append(backups, BackupInfo{
 			Filename:  e.Name(),
 			Size:      info.Size(),
 			CreatedAt: info.ModTime().UTC().Format(time.RFC3339),
+			Kind:      kind,
 		})
 	}
 
@@ -153,3 +202,47 @@ func handleDownloadBackup(w http.ResponseWriter, r *http.Request, filename strin
 func handleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 	getAdminHandler().HandleRestoreBackup(w, r)
 }
+
+func handleVerifyBackup(w http.ResponseWriter, r *http.Request, filename string) {
+	getAdminHandler().HandleVerifyBackup(w, r, filename)
+}
+
+func handleGetBackupRetention(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleGetBackupRetention(w, r)
+}
+
+func handleUpdateBackupRetention(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleUpdateBackupRetention(w, r)
+}
+
+func handleListBackupTargets(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleListBackupTargets(w, r)
+}
+
+func handleCreateBackupTarget(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleCreateBackupTarget(w, r)
+}
+
+func handleUpdateBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleUpdateBackupTarget(w, r, id)
+}
+
+func handleDeleteBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleDeleteBackupTarget(w, r, id)
+}
+
+func handleTestBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleTestBackupTarget(w, r, id)
+}
+
+func handleListRemoteBackups(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleListRemoteBackups(w, r, id)
+}
+
+func handleFetchRemoteBackup(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleFetchRemoteBackup(w, r, id)
+}
+
+func handleUploadBackup(w http.ResponseWriter, r *http.Request, filename string) {
+	getAdminHandler().HandleUploadBackup(w, r, filename)
+}
@@ -10,6 +10,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"zrp/internal/backup"
 )
 
 func setupBackupTest(t *testing.T) (*http.Cookie, func()) {
@@ -231,6 +233,11 @@ func TestRestoreBackup(t *testing.T) {
 	oldDBFilePath := dbFilePath
 	dbFilePath = fmt.Sprintf("test_%s.db", t.Name())
 	defer func() { dbFilePath = oldDBFilePath }()
+	defer func() {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(dbFilePath + suffix)
+		}
+	}()
 
 	// Create a backup first
 	handleCreateBackup(httptest.NewRecorder(), authedRequest("POST", "/api/v1/admin/backup", nil, cookie.Value))
@@ -305,9 +312,7 @@ func TestCleanOldBackups(t *testing.T) {
 	defer cleanup()
 	
 
-	oldRetention := backupRetention
-	backupRetention = 3
-	defer func() { backupRetention = oldRetention }()
+	backup.SavePolicy(db, backup.Policy{Daily: 3})
 
 	// Create 5 fake backups
 	for i := 0; i < 5; i++ {
@@ -46,6 +46,7 @@ func setupBulkTestDB(t *testing.T) *sql.DB {
 		CREATE TABLE work_orders (
 			id TEXT PRIMARY KEY,
 			title TEXT NOT NULL,
+			assembly_ipn TEXT DEFAULT '',
 			description TEXT,
 			status TEXT DEFAULT 'pending' CHECK(status IN ('pending','in_progress','completed','cancelled')),
 			assigned_to TEXT,
@@ -177,6 +178,35 @@ func setupBulkTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create audit_log table: %v", err)
 	}
 
+	// Create training tables (checked before tests and completions)
+	_, err = testDB.Exec(`
+		CREATE TABLE training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			valid_months INTEGER DEFAULT 0
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_requirements table: %v", err)
+	}
+
+	_, err = testDB.Exec(`
+		CREATE TABLE training_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			completed_at DATE NOT NULL,
+			expires_at DATE
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_records table: %v", err)
+	}
+
 	// Create undo_log table (for createUndoEntry)
 	_, err = testDB.Exec(`
 		CREATE TABLE undo_log (
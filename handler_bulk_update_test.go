@@ -47,7 +47,8 @@ func setupBulkUpdateTestDB(t *testing.T) func() {
 			status TEXT DEFAULT 'draft' CHECK(status IN ('draft','open','in_progress','completed','cancelled','on_hold')),
 			priority TEXT DEFAULT 'normal' CHECK(priority IN ('low','normal','high','critical')),
 			due_date TEXT,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+			completed_at TEXT
 		)
 	`)
 	if err != nil {
@@ -117,6 +118,35 @@ func setupBulkUpdateTestDB(t *testing.T) func() {
 		t.Fatalf("Failed to create audit_log table: %v", err)
 	}
 
+	// Create training tables (checked before tests and completions)
+	_, err = testDB.Exec(`
+		CREATE TABLE training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			valid_months INTEGER DEFAULT 0
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_requirements table: %v", err)
+	}
+
+	_, err = testDB.Exec(`
+		CREATE TABLE training_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			completed_at DATE NOT NULL,
+			expires_at DATE
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_records table: %v", err)
+	}
+
 	// Save and swap db
 	origDB := db
 	db = testDB
@@ -302,6 +332,45 @@ func TestBulkUpdateWorkOrdersStatus(t *testing.T) {
 	}
 }
 
+func TestBulkUpdateWorkOrdersCompletedRequiresTraining(t *testing.T) {
+	cleanup := setupBulkUpdateTestDB(t)
+	defer cleanup()
+
+	db.Exec("INSERT INTO work_orders (id, assembly_ipn, status) VALUES ('WO-T-001', 'ASY-100', 'open'), ('WO-T-002', 'ASY-200', 'open')")
+	db.Exec("INSERT INTO training_requirements (document_id, ipn, activity, revision) VALUES ('DOC-001', 'ASY-100', 'build', 'B')")
+
+	body := `{"ids":["WO-T-001","WO-T-002"],"updates":{"status":"completed"}}`
+	req := httptest.NewRequest("POST", "/api/v1/workorders/bulk-update", strings.NewReader(body))
+	req = withUsername(req, "admin")
+	w := httptest.NewRecorder()
+
+	handleBulkUpdateWorkOrders(w, req)
+
+	var resp BulkResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Success != 1 || resp.Failed != 1 || len(resp.Errors) != 1 || !strings.HasPrefix(resp.Errors[0], "WO-T-001: ") || !strings.Contains(resp.Errors[0], "not qualified to build ASY-100") {
+		t.Fatalf("response = %+v", resp)
+	}
+	var status1, status2 string
+	db.QueryRow("SELECT status FROM work_orders WHERE id='WO-T-001'").Scan(&status1)
+	db.QueryRow("SELECT status FROM work_orders WHERE id='WO-T-002'").Scan(&status2)
+	if status1 != "open" || status2 != "completed" {
+		t.Errorf("statuses = %s, %s", status1, status2)
+	}
+
+	// The bulk complete action applies the same gate.
+	db.Exec("UPDATE work_orders SET status='open'")
+	req = httptest.NewRequest("POST", "/api/v1/bulk/workorders", strings.NewReader(`{"ids":["WO-T-001","WO-T-002"],"action":"complete"}`))
+	req = withUsername(req, "admin")
+	w = httptest.NewRecorder()
+	handleBulkWorkOrders(w, req)
+	resp = BulkResponse{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Success != 1 || resp.Failed != 1 || !strings.HasPrefix(resp.Errors[0], "WO-T-001: ") {
+		t.Fatalf("bulk complete response = %+v", resp)
+	}
+}
+
 func TestBulkUpdateWorkOrdersPriority(t *testing.T) {
 	cleanup := setupBulkUpdateTestDB(t)
 	defer cleanup()
@@ -44,6 +44,14 @@ func handleUpdateCAPA(w http.ResponseWriter, r *http.Request, id string) {
 	getQualityHandler().UpdateCAPA(w, r, id)
 }
 
+func handleCAPASignatures(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().CAPASignatures(w, r, id)
+}
+
+func handleCAPAPDF(w http.ResponseWriter, r *http.Request, id string) {
+	getQualityHandler().CAPAPDF(w, r, id)
+}
+
 func getCAPASnapshot(id string) (map[string]interface{}, error) {
 	var c CAPA
 	var qeAt, mgrAt sql.NullString
@@ -120,7 +120,7 @@ func TestCAPACloseRequiresEffectivenessAndApproval(t *testing.T) {
 
 	// Close with all requirements
 	w = httptest.NewRecorder()
-	req = authedRequest("PUT", "/api/v1/capas/"+c.ID, []byte(`{"title":"Test close","type":"corrective","owner":"eng","status":"closed","effectiveness_check":"Verified OK","approved_by_qe":"QE Approved","approved_by_mgr":"Manager Approved"}`), cookie)
+	req = authedRequest("PUT", "/api/v1/capas/"+c.ID, []byte(`{"title":"Test close","type":"corrective","owner":"eng","status":"closed","effectiveness_check":"Verified OK","approved_by_qe":"QE Approved","approved_by_mgr":"Manager Approved","password":"changeme"}`), cookie)
 	handleUpdateCAPA(w, req, c.ID)
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
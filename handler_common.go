@@ -15,19 +15,7 @@ func getCommonHandler() *common.Handler {
 	if commonHandler == nil || commonHandler.DB != db {
 		commonHandler = &common.Handler{
 			DB: db,
-			LoadPartsFromDir: func() (map[string][]common.Part, map[string][]string, map[string]string, error) {
-				cats, catOrder, catDesc, err := loadPartsFromDir()
-				// Convert []Part to []common.Part
-				result := make(map[string][]common.Part)
-				for k, parts := range cats {
-					cparts := make([]common.Part, len(parts))
-					for i, p := range parts {
-						cparts[i] = common.Part{IPN: p.IPN, Fields: p.Fields}
-					}
-					result[k] = cparts
-				}
-				return result, catOrder, catDesc, err
-			},
+			PartsCatalog: getPartsCatalog,
 			GetCurrentUser: func(r *http.Request) *common.UserInfo {
 				u := getCurrentUser(r)
 				if u == nil {
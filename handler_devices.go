@@ -19,6 +19,16 @@ func getFieldHandler() *field.Handler {
 			RecordChangeJSON:  recordChangeJSON,
 			GetDeviceSnapshot: getDeviceSnapshot,
 			GetRMASnapshot:    getRMASnapshot,
+			CreateShipment:    insertShipment,
+			SendEmail: func(to, subject, body string) error {
+				return sendEmailWithEvent(to, subject, body, "field_report_ack")
+			},
+			StoreAttachment: func(module, recordID, name, mimeType string, data []byte, uploadedBy string) error {
+				_, err := getCommonHandler().StoreAttachment(module, recordID, name, mimeType, data, uploadedBy)
+				return err
+			},
+			ExportCSV:   exportCSV,
+			ExportExcel: exportExcel,
 		}
 	}
 	return fieldHandler
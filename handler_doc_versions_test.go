@@ -93,7 +93,7 @@ func TestDocRelease(t *testing.T) {
 
 	// Release
 	w = httptest.NewRecorder()
-	req = authedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", nil, cookie)
+	req = authedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", []byte(`{"password":"changeme"}`), cookie)
 	handleReleaseDoc(w, req, doc.ID)
 	if w.Code != 200 {
 		t.Fatalf("release: %d %s", w.Code, w.Body.String())
@@ -21,3 +21,11 @@ func handleUpdateDoc(w http.ResponseWriter, r *http.Request, id string) {
 func handleApproveDoc(w http.ResponseWriter, r *http.Request, id string) {
 	getEngineeringHandler().ApproveDoc(w, r, id)
 }
+
+func handleDocSignatures(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().DocSignatures(w, r, id)
+}
+
+func handleDocPDF(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().DocPDF(w, r, id)
+}
@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"zrp/internal/audit"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -102,6 +104,16 @@ func setupDocsTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create id_sequences table: %v", err)
 	}
 
+	// These tables carry no users to sign with; signing is covered by
+	// the engineering handler tests.
+	_, err = testDB.Exec(`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`)
+	if err != nil {
+		t.Fatalf("Failed to create app_settings table: %v", err)
+	}
+	if err := audit.SetSignaturesRequired(testDB, false); err != nil {
+		t.Fatalf("Failed to make signatures optional: %v", err)
+	}
+
 	return testDB
 }
 
@@ -49,6 +49,14 @@ func handleApproveECO(w http.ResponseWriter, r *http.Request, id string) {
 	getEngineeringHandler().ApproveECO(w, r, id)
 }
 
+func handleECOSignatures(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().ECOSignatures(w, r, id)
+}
+
+func handleECOPDF(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().ECOPDF(w, r, id)
+}
+
 func handleImplementECO(w http.ResponseWriter, r *http.Request, id string) {
 	getEngineeringHandler().ImplementECO(w, r, id)
 }
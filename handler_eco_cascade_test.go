@@ -12,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	"zrp/internal/audit"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -86,6 +88,7 @@ func setupECOCascadeTestEnv(t *testing.T) (*sql.DB, string, func()) {
 			prefix TEXT PRIMARY KEY,
 			next_num INTEGER
 		)`,
+		`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`,
 	}
 
 	for _, sql := range tables {
@@ -94,6 +97,12 @@ func setupECOCascadeTestEnv(t *testing.T) (*sql.DB, string, func()) {
 		}
 	}
 
+	// There are no users to sign with; signing is covered by the
+	// engineering handler tests.
+	if err := audit.SetSignaturesRequired(testDB, false); err != nil {
+		t.Fatalf("Failed to make signatures optional: %v", err)
+	}
+
 	// Create temporary parts directory
 	tmpDir := t.TempDir()
 	partsSubDir := filepath.Join(tmpDir, "parts")
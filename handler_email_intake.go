@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+)
+
+// startEmailIntake listens for SMTP on addr and files mail sent to the
+// configured support address as field reports. An empty addr disables it.
+func startEmailIntake(addr string) {
+	if addr == "" {
+		return
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("email intake: listen on %s failed: %v", addr, err)
+		return
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	log.Printf("email intake: accepting SMTP on %s", addr)
+	go func() {
+		if err := getFieldHandler().ServeSMTP(l, hostname); err != nil {
+			log.Printf("email intake: %v", err)
+		}
+	}()
+}
+
+func handleReceiveFieldReportEmail(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().ReceiveFieldReportEmail(w, r)
+}
+
+func handleListFieldReportEmails(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().ListFieldReportEmails(w, r, id)
+}
+
+func handleGetEmailIntakeSettings(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().GetEmailIntakeSettings(w, r)
+}
+
+func handleUpdateEmailIntakeSettings(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().UpdateEmailIntakeSettings(w, r)
+}
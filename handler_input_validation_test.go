@@ -169,6 +169,25 @@ func setupInputValidationDB(t *testing.T) *sql.DB {
 			received_at TIMESTAMP,
 			resolved_at TIMESTAMP
 		)`,
+		`CREATE TABLE rma_lines (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rma_id TEXT NOT NULL,
+			serial_number TEXT NOT NULL,
+			ipn TEXT DEFAULT '',
+			defect_description TEXT DEFAULT '',
+			status TEXT DEFAULT 'open',
+			disposition TEXT DEFAULT '',
+			warranty TEXT DEFAULT 'unknown',
+			warranty_expires TEXT DEFAULT '',
+			repair_wo_id TEXT DEFAULT '',
+			replacement_serial TEXT DEFAULT '',
+			advance_shipment_id TEXT DEFAULT '',
+			contract_id TEXT DEFAULT '',
+			credit_amount REAL DEFAULT 0,
+			notes TEXT DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(rma_id, serial_number)
+		)`,
 		`CREATE TABLE users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			username TEXT UNIQUE NOT NULL,
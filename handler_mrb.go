@@ -0,0 +1,23 @@
+package main
+
+import "net/http"
+
+func handleListMRB(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().ListMRB(w, r)
+}
+
+func handleGetNCRMRB(w http.ResponseWriter, r *http.Request, ncrID string) {
+	getQualityHandler().GetNCRMRB(w, r, ncrID)
+}
+
+func handleQuarantineNCRStock(w http.ResponseWriter, r *http.Request, ncrID string) {
+	getQualityHandler().QuarantineNCRStock(w, r, ncrID)
+}
+
+func handleDispositionNCR(w http.ResponseWriter, r *http.Request, ncrID string) {
+	getQualityHandler().DispositionNCR(w, r, ncrID)
+}
+
+func handleReportScrapCost(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().ReportScrapCost(w, r)
+}
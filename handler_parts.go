@@ -1,21 +1,52 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
+	"zrp/internal/catalog"
 	"zrp/internal/handlers/parts"
+	"zrp/internal/models"
 )
 
 // partsHandler is the shared parts handler instance.
 var partsHandler *parts.Handler
 
+var (
+	partsCatalog   *catalog.Catalog
+	partsCatalogMu sync.Mutex
+)
+
+// getPartsCatalog returns the indexed catalog of partsDir, replacing it if
+// partsDir has changed (as it does between tests).
+func getPartsCatalog() *catalog.Catalog {
+	partsCatalogMu.Lock()
+	defer partsCatalogMu.Unlock()
+	if partsCatalog == nil || partsCatalog.Dir() != partsDir {
+		partsCatalog = catalog.New(partsDir)
+	}
+	return partsCatalog
+}
+
+// startPartsCatalogWatch loads the parts catalog and polls partsDir for
+// changes made outside ZRP, such as a git pull.
+func startPartsCatalogWatch(interval time.Duration) {
+	if partsDir == "" {
+		return
+	}
+	go getPartsCatalog().Watch(context.Background(), interval)
+}
+
 // getPartsHandler returns the parts handler, lazily initializing if needed (for tests).
 func getPartsHandler() *parts.Handler {
-	if partsHandler == nil || partsHandler.DB != db {
+	if partsHandler == nil || partsHandler.DB != db || partsHandler.PartsDir != partsDir {
 		partsHandler = &parts.Handler{
 			DB:                      db,
 			Hub:                     wsHub,
 			PartsDir:                partsDir,
+			Catalog:                 getPartsCatalog(),
 			NextID:                  nextID,
 			EnsureInitialRevision:   ensureInitialRevision,
 			SnapshotDocumentVersion: snapshotDocumentVersion,
@@ -81,6 +112,30 @@ func handleDeleteColumn(w http.ResponseWriter, r *http.Request, catID, colName s
 	getPartsHandler().DeleteColumn(w, r, catID, colName)
 }
 
+func handleListIPNSchemes(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().ListIPNSchemes(w, r)
+}
+
+func handleIPNSchemeReport(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().IPNSchemeReport(w, r)
+}
+
+func handleGetIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	getPartsHandler().GetIPNScheme(w, r, catID)
+}
+
+func handleUpdateIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	getPartsHandler().UpdateIPNScheme(w, r, catID)
+}
+
+func handleDeleteIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	getPartsHandler().DeleteIPNScheme(w, r, catID)
+}
+
+func handleReserveIPN(w http.ResponseWriter, r *http.Request, catID string) {
+	getPartsHandler().ReserveIPN(w, r, catID)
+}
+
 func handlePartBOM(w http.ResponseWriter, r *http.Request, ipn string) {
 	getPartsHandler().PartBOM(w, r, ipn)
 }
@@ -89,6 +144,104 @@ func handlePartCost(w http.ResponseWriter, r *http.Request, ipn string) {
 	getPartsHandler().PartCost(w, r, ipn)
 }
 
+func handleBOMDiff(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().BOMDiff(w, r, ipn)
+}
+
+func handleECOBOMImpact(w http.ResponseWriter, r *http.Request, ecoID string) {
+	getPartsHandler().ECOBOMImpact(w, r, ecoID)
+}
+
+func handlePreviewBOMImport(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().PreviewBOMImport(w, r, ipn)
+}
+
+func handleConfirmBOMImport(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().ConfirmBOMImport(w, r, ipn)
+}
+
+func handlePartCostRollup(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().PartCostRollup(w, r, ipn)
+}
+
+func handleListCostRolls(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().ListCostRolls(w, r)
+}
+
+func handleCreateCostRoll(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().CreateCostRoll(w, r)
+}
+
+func handleGetCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	getPartsHandler().GetCostRoll(w, r, id)
+}
+
+func handleFreezeCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	getPartsHandler().FreezeCostRoll(w, r, id)
+}
+
+func handleDeleteCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	getPartsHandler().DeleteCostRoll(w, r, id)
+}
+
+func handleCostRollVariance(w http.ResponseWriter, r *http.Request, id string) {
+	getPartsHandler().CostRollVariance(w, r, id)
+}
+
+func handleGetBOMSettings(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().GetBOMSettings(w, r)
+}
+
+func handleUpdateBOMSettings(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().UpdateBOMSettings(w, r)
+}
+
+func handleGetPartLifecycle(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().GetPartLifecycle(w, r, ipn)
+}
+
+func handleSetPartLifecycle(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().SetPartLifecycle(w, r, ipn)
+}
+
+func handlePartLifecycleImpact(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().PartLifecycleImpact(w, r, ipn)
+}
+
+func handleListPartRevisions(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().ListPartRevisions(w, r, ipn)
+}
+
+func handleCreatePartRevision(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().CreatePartRevision(w, r, ipn)
+}
+
+func handleListPartAlternates(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().ListPartAlternates(w, r, ipn)
+}
+
+func handleCreatePartAlternate(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().CreatePartAlternate(w, r, ipn)
+}
+
+func handleDeletePartAlternate(w http.ResponseWriter, r *http.Request, ipn, id string) {
+	getPartsHandler().DeletePartAlternate(w, r, ipn, id)
+}
+
+// resolveWorkOrderBOM resolves a work order's BOM for its build date and
+// serial numbers; see parts.Handler.ResolveWorkOrderBOM.
+func resolveWorkOrderBOM(woID, date string) (*models.BuildBOM, error) {
+	return getPartsHandler().ResolveWorkOrderBOM(woID, date)
+}
+
+func handleUpdateObsolescence(w http.ResponseWriter, r *http.Request, ipn string) {
+	getPartsHandler().UpdateObsolescence(w, r, ipn)
+}
+
+func handleScanObsolescence(w http.ResponseWriter, r *http.Request) {
+	getPartsHandler().ScanObsolescence(w, r)
+}
+
 func handleDashboard(w http.ResponseWriter, r *http.Request) {
 	getPartsHandler().Dashboard(w, r)
 }
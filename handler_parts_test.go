@@ -821,8 +821,10 @@ func SkipTestHandlePartCost(t *testing.T) {
 }
 
 func TestHandleUpdatePart(t *testing.T) {
-	oldPartsDir := partsDir
-	defer func() { partsDir = oldPartsDir }()
+	oldPartsDir, oldDB := partsDir, db
+	defer func() { partsDir, db = oldPartsDir, oldDB }()
+	db = setupTestDB(t)
+	defer db.Close()
 
 	tmpDir := t.TempDir()
 	partsDir = tmpDir
@@ -830,33 +832,62 @@ func TestHandleUpdatePart(t *testing.T) {
 	// Create test category and part
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
+	csvPath := filepath.Join(catDir, "test.csv")
 	csvContent := "IPN,description,status\nR-001,Original description,active\n"
-	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
+	os.WriteFile(csvPath, []byte(csvContent), 0644)
 
-	updateBody := map[string]interface{}{
-		"fields": map[string]string{
-			"description": "Updated description",
-			"status":      "obsolete",
-			"new_field":   "new value",
-		},
+	update := func(ipn string, fields map[string]string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(map[string]interface{}{"fields": fields})
+		req := httptest.NewRequest("PUT", "/api/v1/parts/"+ipn, bytes.NewReader(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handleUpdatePart(rr, req, ipn)
+		return rr
 	}
 
-	bodyBytes, _ := json.Marshal(updateBody)
-	req := httptest.NewRequest("PUT", "/api/v1/parts/R-001", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
-	rr := httptest.NewRecorder()
-	handleUpdatePart(rr, req, "R-001")
+	// Columns must exist in the category before they can be set.
+	if rr := update("R-001", map[string]string{"description": "Updated description", "new_field": "new value"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown column: expected 400, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := update("R-001", map[string]string{"IPN": "R-999"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("IPN change: expected 400, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := update("R-404", map[string]string{"description": "x"}); rr.Code != http.StatusNotFound {
+		t.Errorf("missing part: expected 404, got %d", rr.Code)
+	}
+	if data, _ := os.ReadFile(csvPath); string(data) != csvContent {
+		t.Fatalf("rejected updates changed the CSV:\n%s", data)
+	}
 
-	// Handler intentionally returns 501 Not Implemented (parts are read-only from CSV)
-	if rr.Code != http.StatusNotImplemented {
-		t.Errorf("Expected status 501, got %d. Body: %s", rr.Code, rr.Body.String())
-		return
+	rr := update("R-001", map[string]string{"description": "Updated description", "status": "obsolete"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data Part `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Fields["description"] != "Updated description" || resp.Data.Fields["status"] != "obsolete" || resp.Data.Fields["_category"] != "resistors" {
+		t.Errorf("unexpected response fields: %v", resp.Data.Fields)
+	}
+	data, _ := os.ReadFile(csvPath)
+	if !strings.Contains(string(data), "R-001,Updated description,obsolete") {
+		t.Errorf("CSV not updated:\n%s", data)
+	}
+	var audits int
+	db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE module='part' AND record_id='R-001'").Scan(&audits)
+	if audits != 1 {
+		t.Errorf("expected 1 audit entry, got %d", audits)
 	}
 }
 
 func TestHandleDeletePart(t *testing.T) {
-	oldPartsDir := partsDir
-	defer func() { partsDir = oldPartsDir }()
+	oldPartsDir, oldDB := partsDir, db
+	defer func() { partsDir, db = oldPartsDir, oldDB }()
+	db = setupTestDB(t)
+	defer db.Close()
 
 	tmpDir := t.TempDir()
 	partsDir = tmpDir
@@ -864,18 +895,33 @@ func TestHandleDeletePart(t *testing.T) {
 	// Create test category and parts
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
+	csvPath := filepath.Join(catDir, "test.csv")
 	csvContent := "IPN,description\nR-001,Part to delete\nR-002,Part to keep\n"
-	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
+	os.WriteFile(csvPath, []byte(csvContent), 0644)
+
+	del := func(ipn string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/api/v1/parts/"+ipn, nil)
+		rr := httptest.NewRecorder()
+		handleDeletePart(rr, req, ipn)
+		return rr
+	}
 
 	// Delete R-001
-	req := httptest.NewRequest("DELETE", "/api/v1/parts/R-001", nil)
-	rr := httptest.NewRecorder()
-	handleDeletePart(rr, req, "R-001")
+	if rr := del("R-001"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	data, _ := os.ReadFile(csvPath)
+	if strings.Contains(string(data), "R-001") || !strings.Contains(string(data), "R-002,Part to keep") {
+		t.Errorf("unexpected CSV after delete:\n%s", data)
+	}
+	var audits int
+	db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE module='part' AND record_id='R-001' AND action='deleted'").Scan(&audits)
+	if audits != 1 {
+		t.Errorf("expected 1 audit entry, got %d", audits)
+	}
 
-	// Handler intentionally returns 501 Not Implemented (parts are read-only from CSV)
-	if rr.Code != http.StatusNotImplemented {
-		t.Errorf("Expected status 501, got %d", rr.Code)
-		return
+	if rr := del("R-001"); rr.Code != http.StatusNotFound {
+		t.Errorf("second delete: expected 404, got %d", rr.Code)
 	}
 }
 
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"net/http"
+)
+
+func handleGetReliability(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().GetReliability(w, r)
+}
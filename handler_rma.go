@@ -19,3 +19,31 @@ func handleCreateRMA(w http.ResponseWriter, r *http.Request) {
 func handleUpdateRMA(w http.ResponseWriter, r *http.Request, id string) {
 	getFieldHandler().UpdateRMA(w, r, id)
 }
+
+func handleAddRMALine(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().AddRMALine(w, r, id)
+}
+
+func handleUpdateRMALine(w http.ResponseWriter, r *http.Request, id, lineID string) {
+	getFieldHandler().UpdateRMALine(w, r, id, lineID)
+}
+
+func handleAdvanceReplacement(w http.ResponseWriter, r *http.Request, id, lineID string) {
+	getFieldHandler().AdvanceReplacement(w, r, id, lineID)
+}
+
+func handleCreateRMARepairWO(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().CreateRMARepairWO(w, r, id)
+}
+
+func handleConsumeRMAPart(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().ConsumeRMAPart(w, r, id)
+}
+
+func handleGetRMASettings(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().GetRMASettings(w, r)
+}
+
+func handleUpdateRMASettings(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().UpdateRMASettings(w, r)
+}
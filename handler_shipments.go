@@ -12,6 +12,12 @@ func handleGetShipment(w http.ResponseWriter, r *http.Request, id string) {
 	getSalesHandler().GetShipment(w, r, id)
 }
 
+// insertShipment saves a shipment created by another module; see
+// sales.Handler.InsertShipment.
+func insertShipment(s *Shipment) error {
+	return getSalesHandler().InsertShipment(s)
+}
+
 func getShipmentLines(shipmentID string) []ShipmentLine {
 	// Keep backward-compatible wrapper for other root-level code that calls this.
 	rows, err := db.Query("SELECT id,shipment_id,COALESCE(ipn,''),COALESCE(serial_number,''),qty,COALESCE(work_order_id,''),COALESCE(rma_id,'') FROM shipment_lines WHERE shipment_id=?", shipmentID)
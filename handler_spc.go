@@ -0,0 +1,23 @@
+package main
+
+import "net/http"
+
+func handleGetSPCChart(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().GetSPCChart(w, r)
+}
+
+func handleListSPCViolations(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().ListSPCViolations(w, r)
+}
+
+func handleDashboardSPC(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().DashboardSPC(w, r)
+}
+
+func handleGetSPCSettings(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().GetSPCSettings(w, r)
+}
+
+func handleUpdateSPCSettings(w http.ResponseWriter, r *http.Request) {
+	getQualityHandler().UpdateSPCSettings(w, r)
+}
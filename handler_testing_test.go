@@ -59,6 +59,35 @@ func setupTestingHandlerTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create audit_log table: %v", err)
 	}
 
+	// Create training tables (checked before tests and completions)
+	_, err = testDB.Exec(`
+		CREATE TABLE training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			valid_months INTEGER DEFAULT 0
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_requirements table: %v", err)
+	}
+
+	_, err = testDB.Exec(`
+		CREATE TABLE training_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			completed_at DATE NOT NULL,
+			expires_at DATE
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_records table: %v", err)
+	}
+
 	// Create users and sessions for authentication
 	_, err = testDB.Exec(`
 		CREATE TABLE users (
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+)
+
+func handleListTrainingRequirements(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().ListTrainingRequirements(w, r)
+}
+
+func handleCreateTrainingRequirement(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().CreateTrainingRequirement(w, r)
+}
+
+func handleDeleteTrainingRequirement(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().DeleteTrainingRequirement(w, r, id)
+}
+
+func handleListTrainingRecords(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().ListTrainingRecords(w, r)
+}
+
+func handleCreateTrainingRecord(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().CreateTrainingRecord(w, r)
+}
+
+func handleListTrainingTasks(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().ListTrainingTasks(w, r)
+}
+
+func handleCreateTrainingTask(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().CreateTrainingTask(w, r)
+}
+
+func handleUpdateTrainingTask(w http.ResponseWriter, r *http.Request, id string) {
+	getEngineeringHandler().UpdateTrainingTask(w, r, id)
+}
+
+func handleGetQualification(w http.ResponseWriter, r *http.Request) {
+	getEngineeringHandler().GetQualification(w, r)
+}
@@ -43,6 +43,8 @@ func buildAdminHandler() *admin.Handler {
 		DBFilePath:      func() string { return dbFilePath },
 		SetDBFilePath:   func(s string) { dbFilePath = s },
 		InitDB:          initDB,
+		BackupDir:       func() string { return backupDir },
+		UploadsDir:      func() string { return uploadsDir },
 
 		// Email function fields.
 		SendEmail:          sendEmail,
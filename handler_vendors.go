@@ -39,6 +39,7 @@ func getProcurementHandler() *procurement.Handler {
 				}
 			},
 			GetPartByIPN:      getPartByIPN,
+			AssemblyMatcher:   func() func(string) bool { return getPartsHandler().AssemblyMatcher() },
 			LoadPartsFromDir: func() (map[string][]models.Part, map[string][]string, map[string]string, error) {
 				cats, schemas, titles, err := loadPartsFromDir()
 				result := make(map[string][]models.Part)
@@ -57,6 +58,7 @@ func getProcurementHandler() *procurement.Handler {
 				logAudit(db, username, action, module, recordID, summary)
 			},
 			GetUsername: getUsername,
+			ResolveBOM:  resolveWorkOrderBOM,
 		}
 	}
 	return procurementHandler
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+)
+
+func handleListWarrantyPolicies(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().ListWarrantyPolicies(w, r)
+}
+
+func handleCreateWarrantyPolicy(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().CreateWarrantyPolicy(w, r)
+}
+
+func handleUpdateWarrantyPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().UpdateWarrantyPolicy(w, r, id)
+}
+
+func handleDeleteWarrantyPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().DeleteWarrantyPolicy(w, r, id)
+}
+
+func handleListServiceContracts(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().ListServiceContracts(w, r)
+}
+
+func handleGetServiceContract(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().GetServiceContract(w, r, id)
+}
+
+func handleCreateServiceContract(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().CreateServiceContract(w, r)
+}
+
+func handleUpdateServiceContract(w http.ResponseWriter, r *http.Request, id string) {
+	getFieldHandler().UpdateServiceContract(w, r, id)
+}
+
+func handleExpiringServiceContracts(w http.ResponseWriter, r *http.Request) {
+	getFieldHandler().ExpiringServiceContracts(w, r)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"zrp/internal/webhooks"
+	"zrp/internal/websocket"
+)
+
+var (
+	webhookDispatcher   *webhooks.Dispatcher
+	webhookDispatcherMu sync.Mutex
+)
+
+// getWebhookDispatcher returns the dispatcher for db, replacing it if db
+// has changed (as it does between tests). It is called from hub listener
+// goroutines and the delivery loop, so access is serialised.
+func getWebhookDispatcher() *webhooks.Dispatcher {
+	webhookDispatcherMu.Lock()
+	defer webhookDispatcherMu.Unlock()
+	if webhookDispatcher == nil || webhookDispatcher.DB != db {
+		webhookDispatcher = webhooks.NewDispatcher(db)
+	}
+	return webhookDispatcher
+}
+
+// startWebhookDispatcher queues hub events for matching webhooks and
+// delivers due deliveries in the background.
+func startWebhookDispatcher() {
+	wsHub.AddListener(func(evt websocket.Event) {
+		if _, err := getWebhookDispatcher().Enqueue(evt); err != nil {
+			log.Printf("webhooks: enqueue %s failed: %v", evt.Type, err)
+		}
+	})
+	go func() {
+		for {
+			time.Sleep(15 * time.Second)
+			if _, err := getWebhookDispatcher().ProcessDue(); err != nil {
+				log.Printf("webhooks: delivery run failed: %v", err)
+			}
+		}
+	}()
+}
+
+func handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleListWebhooks(w, r)
+}
+
+func handleListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleListWebhookEvents(w, r)
+}
+
+func handleGetWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleGetWebhook(w, r, id)
+}
+
+func handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	getAdminHandler().HandleCreateWebhook(w, r)
+}
+
+func handleUpdateWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleUpdateWebhook(w, r, id)
+}
+
+func handleDeleteWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleDeleteWebhook(w, r, id)
+}
+
+func handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string) {
+	getAdminHandler().HandleListWebhookDeliveries(w, r, id)
+}
+
+func handleRedeliverWebhook(w http.ResponseWriter, r *http.Request, deliveryID string) {
+	getAdminHandler().HandleRedeliverWebhook(w, r, deliveryID)
+}
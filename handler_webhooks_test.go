@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"zrp/internal/webhooks"
+)
+
+func TestGetWebhookDispatcherConcurrent(t *testing.T) {
+	oldDB := db
+	db = setupTestDB(t)
+	defer func() {
+		db.Close()
+		db = oldDB
+	}()
+
+	// Hub listeners and the delivery loop share one dispatcher.
+	got := make([]*webhooks.Dispatcher, 16)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i] = getWebhookDispatcher()
+		}(i)
+	}
+	wg.Wait()
+	for i, d := range got {
+		if d != got[0] || d.DB != db {
+			t.Fatalf("call %d got a different dispatcher", i)
+		}
+	}
+}
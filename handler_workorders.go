@@ -24,6 +24,7 @@ func getMfgHandler() *manufacturing.Handler {
 			CreateUndoEntry:         createUndoEntry,
 			GetWorkOrderSnapshot:    getWorkOrderSnapshot,
 			EmailOnOverdueWorkOrder: emailOnOverdueWorkOrder,
+			ResolveBOM:              resolveWorkOrderBOM,
 		}
 	}
 	return mfgHandler
@@ -65,6 +66,18 @@ func handleWorkOrderAddSerial(w http.ResponseWriter, r *http.Request, id string)
 	getMfgHandler().WorkOrderAddSerial(w, r, id)
 }
 
+func handleWorkOrderSubstitutions(w http.ResponseWriter, r *http.Request, id string) {
+	getMfgHandler().WorkOrderSubstitutions(w, r, id)
+}
+
+func handleWorkOrderAddSubstitution(w http.ResponseWriter, r *http.Request, id string) {
+	getMfgHandler().WorkOrderAddSubstitution(w, r, id)
+}
+
+func handleWorkOrderAsBuilt(w http.ResponseWriter, r *http.Request, id, serial string) {
+	getMfgHandler().WorkOrderAsBuilt(w, r, id, serial)
+}
+
 func isValidStatusTransition(from, to string) bool {
 	return manufacturing.IsValidStatusTransition(from, to)
 }
@@ -69,6 +69,22 @@ func setupWorkOrderTestDB(t *testing.T) *sql.DB {
 			summary TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			valid_months INTEGER DEFAULT 0
+		)`,
+		`CREATE TABLE training_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			completed_at DATE NOT NULL,
+			expires_at DATE
+		)`,
 	}
 
 	for _, table := range tables {
@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
-	"time"
 
 	"zrp/internal/models"
 	"zrp/internal/websocket"
@@ -28,16 +28,18 @@ const (
 
 // LogAudit is the legacy simple audit function.
 func LogAudit(db *sql.DB, hub *websocket.Hub, username, action, module, recordID, summary string) {
-	_, err := db.Exec("INSERT INTO audit_log (username, action, module, record_id, summary) VALUES (?, ?, ?, ?, ?)",
+	err := insertChained(db, "INSERT INTO audit_log (username, action, module, record_id, summary) VALUES (?, ?, ?, ?, ?)",
 		username, action, module, recordID, summary)
 	if err != nil {
 		fmt.Printf("audit log error: %v\n", err)
 	}
 	if hub != nil {
 		hub.Broadcast(websocket.Event{
-			Type:   module + "_" + action + "d",
-			ID:     recordID,
-			Action: action,
+			Type:     module + "_" + action + "d",
+			ID:       recordID,
+			Action:   action,
+			Resource: module,
+			User:     username,
 		})
 	}
 }
@@ -124,7 +126,7 @@ func LogAuditEnhanced(db *sql.DB, hub *websocket.Hub, opts LogAuditOptions) erro
 		(user_id, username, action, module, record_id, summary, before_value, after_value, ip_address, user_agent)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = db.Exec(query,
+	err = insertChained(db, query,
 		opts.UserID, opts.Username, opts.Action, opts.Module, opts.RecordID,
 		opts.Summary, beforeJSON, afterJSON, opts.IPAddress, opts.UserAgent,
 	)
@@ -135,14 +137,46 @@ func LogAuditEnhanced(db *sql.DB, hub *websocket.Hub, opts LogAuditOptions) erro
 
 	if hub != nil {
 		hub.Broadcast(websocket.Event{
-			Type:   opts.Module + "_" + strings.ToLower(opts.Action),
-			ID:     opts.RecordID,
-			Action: opts.Action,
+			Type:     opts.Module + "_" + strings.ToLower(opts.Action),
+			ID:       opts.RecordID,
+			Action:   opts.Action,
+			Resource: opts.Module,
+			User:     opts.Username,
+			Changes:  DiffFields(beforeJSON, afterJSON),
 		})
 	}
 	return nil
 }
 
+// DiffFields compares two JSON-encoded objects and returns the top-level
+// fields whose values differ. It returns nil when either side is missing or
+// is not a JSON object.
+func DiffFields(beforeJSON, afterJSON []byte) map[string]websocket.FieldChange {
+	if len(beforeJSON) == 0 || len(afterJSON) == 0 {
+		return nil
+	}
+	var before, after map[string]interface{}
+	if json.Unmarshal(beforeJSON, &before) != nil || json.Unmarshal(afterJSON, &after) != nil {
+		return nil
+	}
+	changes := make(map[string]websocket.FieldChange)
+	for k, nv := range after {
+		ov, ok := before[k]
+		if !ok || !reflect.DeepEqual(ov, nv) {
+			changes[k] = websocket.FieldChange{Old: ov, New: nv}
+		}
+	}
+	for k, ov := range before {
+		if _, ok := after[k]; !ok {
+			changes[k] = websocket.FieldChange{Old: ov, New: nil}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
 // LogDataExport logs a data export action.
 func LogDataExport(db *sql.DB, hub *websocket.Hub, r *http.Request, module, format string, recordCount int) {
 	username := GetUsername(db, r)
@@ -176,14 +210,10 @@ func LogSimpleAudit(db *sql.DB, hub *websocket.Hub, r *http.Request, action, mod
 	LogAudit(db, hub, username, action, module, recordID, summary)
 }
 
-// CleanupOldAuditLogs deletes audit log entries older than retentionDays.
-func CleanupOldAuditLogs(db *sql.DB, retentionDays int) (int64, error) {
-	cutoffDate := time.Now().AddDate(0, 0, -retentionDays)
-	result, err := db.Exec("DELETE FROM audit_log WHERE created_at < ?", cutoffDate)
-	if err != nil {
-		return 0, err
-	}
-	return result.RowsAffected()
+// CleanupOldAuditLogs moves audit log entries older than retentionDays
+// into a sealed archive file in archiveDir rather than deleting them.
+func CleanupOldAuditLogs(db *sql.DB, archiveDir string, retentionDays int) (models.AuditArchive, error) {
+	return ArchiveOldEntries(db, archiveDir, retentionDays)
 }
 
 // LogSensitiveDataAccess logs access to sensitive data.
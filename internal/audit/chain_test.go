@@ -0,0 +1,124 @@
+package audit_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func verify(t *testing.T, db *sql.DB, dir string) models.AuditChainReport {
+	t.Helper()
+	rep, err := audit.VerifyChain(db, dir)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return rep
+}
+
+func issueKinds(rep models.AuditChainReport) map[string]int {
+	kinds := map[string]int{}
+	for _, i := range rep.Issues {
+		kinds[i.Kind] = i.ID
+	}
+	return kinds
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	t.Setenv(audit.KeyEnv, "test-audit-key")
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	for _, id := range []string{"R-1", "R-2", "R-3", "R-4", "R-5"} {
+		audit.LogAudit(db, nil, "admin", "create", "parts", id, "Created "+id)
+	}
+	if rep := verify(t, db, ""); !rep.Intact || rep.Entries != 5 || rep.HeadHash == "" {
+		t.Fatalf("fresh log = %+v", rep)
+	}
+	t.Setenv(audit.KeyEnv, "")
+	if _, err := audit.CreateCheckpoint(db, "manual"); err != audit.ErrNoSigningKey {
+		t.Fatalf("checkpoint without %s: %v", audit.KeyEnv, err)
+	}
+	t.Setenv(audit.KeyEnv, "test-audit-key")
+	if _, err := audit.CreateCheckpoint(db, "manual"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM audit_checkpoints"); err == nil {
+		t.Error("expected checkpoint delete to be rejected")
+	}
+
+	// An edited row no longer hashes to its stored hash.
+	db.Exec("UPDATE audit_log SET summary='Nothing to see' WHERE id=2")
+	if k := issueKinds(verify(t, db, "")); k["modified"] != 2 || len(k) != 1 {
+		t.Errorf("after edit = %v", k)
+	}
+	db.Exec("UPDATE audit_log SET summary='Created R-2' WHERE id=2")
+	if rep := verify(t, db, ""); !rep.Intact {
+		t.Errorf("after revert = %+v", rep.Issues)
+	}
+
+	// A row written straight into the table is outside the chain.
+	db.Exec("INSERT INTO audit_log (username, action, module, record_id, summary) VALUES ('mallory','delete','parts','R-9','x')")
+	if k := issueKinds(verify(t, db, "")); k["unchained"] != 6 {
+		t.Errorf("after insert = %v", k)
+	}
+	db.Exec("DELETE FROM audit_log WHERE id=6")
+
+	// Deleting a row leaves a gap; deleting the checkpointed tail is caught
+	// by the checkpoint.
+	db.Exec("DELETE FROM audit_log WHERE id IN (3, 5)")
+	if k := issueKinds(verify(t, db, "")); k["gap"] != 4 || k["checkpoint"] != 5 {
+		t.Errorf("after delete = %v", k)
+	}
+}
+
+func TestAuditRetentionArchives(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	dir := t.TempDir()
+	audit.LogAudit(db, nil, "admin", "create", "parts", "R-1", "Created R-1")
+	audit.LogAudit(db, nil, "admin", "update", "parts", "R-1", "Updated R-1")
+
+	if a, err := audit.CleanupOldAuditLogs(db, dir, 30); err != nil || a.Entries != 0 {
+		t.Fatalf("nothing is old enough: %+v %v", a, err)
+	}
+	// A negative retention puts the cutoff in the future.
+	a, err := audit.CleanupOldAuditLogs(db, dir, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Entries != 2 || a.FirstID != 1 || a.LastID != 2 || a.LastHash == "" {
+		t.Fatalf("archive = %+v", a)
+	}
+	if err := audit.VerifyArchiveFile(db, filepath.Join(dir, a.File)); err != nil {
+		t.Fatalf("archive file: %v", err)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&n)
+	if n != 0 {
+		t.Fatalf("%d rows left after archiving", n)
+	}
+
+	// The chain carries on from the archive.
+	audit.LogAudit(db, nil, "admin", "delete", "parts", "R-1", "Deleted R-1")
+	var prev string
+	db.QueryRow("SELECT prev_hash FROM audit_log").Scan(&prev)
+	if prev != a.LastHash {
+		t.Errorf("prev_hash = %q, want archive hash %q", prev, a.LastHash)
+	}
+	if rep := verify(t, db, dir); !rep.Intact || rep.Archived != 2 || rep.Entries != 1 || rep.Archives != 1 {
+		t.Errorf("after archive = %+v", rep)
+	}
+
+	// Editing the sealed file is detected.
+	path := filepath.Join(dir, a.File)
+	os.Chmod(path, 0644)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, append(data, ' '), 0644)
+	if k := issueKinds(verify(t, db, dir)); k["archive"] != 2 {
+		t.Errorf("after file edit = %v", k)
+	}
+}
@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"zrp/internal/auth"
+	"zrp/internal/models"
+)
+
+// SignatureMeanings are what an electronic signature can attest to.
+var SignatureMeanings = []string{"reviewed", "approved", "released"}
+
+// Signature errors. ErrSignatureRequired and ErrSignatureAuth mean the
+// signer did not re-authenticate (401); ErrSignatureMeaning is a bad
+// request (400).
+var (
+	ErrSignatureRequired = errors.New("electronic signature required: re-enter your password to sign")
+	ErrSignatureAuth     = errors.New("signature rejected: password incorrect")
+	ErrSignatureMeaning  = errors.New("invalid signature meaning")
+)
+
+// SignatureStatus is the HTTP status for a signature error.
+func SignatureStatus(err error) int {
+	if errors.Is(err, ErrSignatureMeaning) {
+		return 400
+	}
+	return 401
+}
+
+// SignatureRequest is the part of an approval body that signs it.
+type SignatureRequest struct {
+	Password string `json:"password"`
+	Meaning  string `json:"meaning"`
+	Reason   string `json:"reason"`
+}
+
+// Signer is a user who re-entered their password to sign a record.
+type Signer struct {
+	UserID    int
+	Username  string
+	FullName  string
+	Meaning   string
+	Reason    string
+	IPAddress string
+}
+
+// SignaturesRequired reports whether approvals must be electronically
+// signed. They must unless the app setting esign_required is "false".
+func SignaturesRequired(db *sql.DB) bool {
+	var v string
+	db.QueryRow("SELECT value FROM app_settings WHERE key='esign_required'").Scan(&v)
+	return v != "false"
+}
+
+// SetSignaturesRequired turns mandatory electronic signatures on or off.
+func SetSignaturesRequired(db *sql.DB, required bool) error {
+	_, err := db.Exec(`INSERT INTO app_settings (key, value) VALUES ('esign_required', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, fmt.Sprintf("%t", required))
+	return err
+}
+
+// Authenticate re-authenticates the session user of r with the password
+// in req for a signature meaning one of allowed (the first is the
+// default). Without a password it returns ErrSignatureRequired, or nil
+// when signatures have been made optional. Wrong passwords count as
+// failed logins.
+func Authenticate(db *sql.DB, r *http.Request, req SignatureRequest, allowed ...string) (*Signer, error) {
+	if req.Password == "" {
+		if SignaturesRequired(db) {
+			return nil, ErrSignatureRequired
+		}
+		return nil, nil
+	}
+	meaning := strings.TrimSpace(req.Meaning)
+	if meaning == "" && len(allowed) > 0 {
+		meaning = allowed[0]
+	}
+	ok := false
+	for _, m := range allowed {
+		ok = ok || m == meaning
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must be one of %s", ErrSignatureMeaning, meaning, strings.Join(allowed, ", "))
+	}
+
+	userID, username := GetUserContext(r, db)
+	if userID == 0 {
+		return nil, ErrSignatureAuth
+	}
+	if locked, err := auth.IsAccountLocked(db, username); err == nil && locked {
+		return nil, ErrSignatureAuth
+	}
+	var hash string
+	var fullName sql.NullString
+	if err := db.QueryRow("SELECT password_hash, display_name FROM users WHERE id=?", userID).Scan(&hash, &fullName); err != nil {
+		return nil, ErrSignatureAuth
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		auth.IncrementFailedLoginAttempts(db, username)
+		LogAudit(db, nil, username, "signature_failed", "esign", "", "Signature password check failed")
+		return nil, ErrSignatureAuth
+	}
+	s := &Signer{UserID: userID, Username: username, FullName: fullName.String, Meaning: meaning,
+		Reason: strings.TrimSpace(req.Reason), IPAddress: GetClientIP(r)}
+	if s.FullName == "" {
+		s.FullName = username
+	}
+	return s, nil
+}
+
+// ContentHash is the SHA-256 of the JSON encoding of content, the record
+// fields a signature binds.
+func ContentHash(content interface{}) string {
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func signatureHash(e models.ESignature) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{e.Module, e.RecordID, e.Meaning, e.Reason,
+		fmt.Sprint(e.UserID), e.Username, e.ContentHash, e.SignedAt}, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign records the signer's signature on a record whose signed content
+// is content, in tx so that it commits or rolls back with the change it
+// signs. Signatures cannot be changed or deleted afterwards. Log the
+// signature with LogSignature once tx has committed.
+func (s *Signer) Sign(tx *sql.Tx, module, recordID string, content interface{}) (models.ESignature, error) {
+	e := models.ESignature{
+		Module: module, RecordID: recordID, Meaning: s.Meaning, Reason: s.Reason,
+		UserID: s.UserID, Username: s.Username, FullName: s.FullName,
+		ContentHash: ContentHash(content), IPAddress: s.IPAddress,
+		SignedAt: time.Now().UTC().Format("2006-01-02 15:04:05"), Intact: true,
+	}
+	e.SignatureHash = signatureHash(e)
+	res, err := tx.Exec(`INSERT INTO e_signatures (module, record_id, meaning, reason, user_id, username, full_name,
+		content_hash, signature_hash, ip_address, signed_at) VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+		e.Module, e.RecordID, e.Meaning, e.Reason, e.UserID, e.Username, e.FullName,
+		e.ContentHash, e.SignatureHash, e.IPAddress, e.SignedAt)
+	if err != nil {
+		return e, err
+	}
+	id, _ := res.LastInsertId()
+	e.ID = int(id)
+	return e, nil
+}
+
+// LogSignature writes the audit entry for a committed signature.
+func LogSignature(db *sql.DB, e models.ESignature) {
+	LogAudit(db, nil, e.Username, "signed", e.Module, e.RecordID,
+		fmt.Sprintf("%s signed %s %s as %s", e.FullName, e.Module, e.RecordID, e.Meaning))
+}
+
+// Signatures is the signature manifest of a record, oldest first. Each
+// signature is intact when its stored hashes still match and the
+// record's current content hashes to what was signed.
+func Signatures(db *sql.DB, module, recordID string, content interface{}) []models.ESignature {
+	sigs := []models.ESignature{}
+	rows, err := db.Query(`SELECT id, module, record_id, meaning, COALESCE(reason,''), user_id, username,
+		COALESCE(full_name,''), content_hash, signature_hash, COALESCE(ip_address,''), signed_at
+		FROM e_signatures WHERE module=? AND record_id=? ORDER BY id`, module, recordID)
+	if err != nil {
+		return sigs
+	}
+	defer rows.Close()
+	current := ContentHash(content)
+	for rows.Next() {
+		var e models.ESignature
+		if rows.Scan(&e.ID, &e.Module, &e.RecordID, &e.Meaning, &e.Reason, &e.UserID, &e.Username,
+			&e.FullName, &e.ContentHash, &e.SignatureHash, &e.IPAddress, &e.SignedAt) != nil {
+			continue
+		}
+		e.Intact = e.ContentHash == current && e.SignatureHash == signatureHash(e)
+		sigs = append(sigs, e)
+	}
+	return sigs
+}
+
+// SignatureManifestHTML renders a signature manifest for printed records.
+func SignatureManifestHTML(sigs []models.ESignature) string {
+	var b strings.Builder
+	b.WriteString(`<h2>Electronic Signatures</h2>
+<table>
+  <thead><tr><th>Signed by</th><th>Meaning</th><th>Date (UTC)</th><th>Reason</th><th>Content hash</th></tr></thead>
+  <tbody>`)
+	for _, s := range sigs {
+		status := ""
+		if !s.Intact {
+			status = ` <strong>(record changed since signing)</strong>`
+		}
+		fmt.Fprintf(&b, `<tr><td>%s (%s)</td><td>%s</td><td>%s</td><td>%s</td><td style="font-family:monospace;font-size:8pt">%s%s</td></tr>`,
+			html.EscapeString(s.FullName), html.EscapeString(s.Username), html.EscapeString(s.Meaning),
+			html.EscapeString(s.SignedAt), html.EscapeString(s.Reason), html.EscapeString(s.ContentHash), status)
+	}
+	if len(sigs) == 0 {
+		b.WriteString(`<tr><td colspan="5" style="text-align:center;color:#999">Not signed</td></tr>`)
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return b.String()
+}
@@ -232,6 +232,51 @@ func SetRolePermissions(db *sql.DB, pc *PermCache, role string, perms []Permissi
 	return pc.Refresh(db)
 }
 
+// ResourceModule maps a resource name used in audit entries and WebSocket
+// events (e.g. "eco", "work_order", "field_report") to its permission module.
+// Returns an empty string for resources that are not permission-controlled.
+func ResourceModule(resource string) string {
+	switch resource {
+	case "part", "parts", "category", "part_change":
+		return ModuleParts
+	case "eco", "ecos":
+		return ModuleECOs
+	case "doc", "docs", "document", "documents", "training":
+		return ModuleDocuments
+	case "inventory", "receiving":
+		return ModuleInventory
+	case "vendor", "vendors":
+		return ModuleVendors
+	case "po", "pos", "purchase_order", "purchase_orders":
+		return ModulePOs
+	case "workorder", "workorders", "work_order", "work_orders":
+		return ModuleWorkOrders
+	case "ncr", "ncrs":
+		return ModuleNCRs
+	case "rma", "rmas":
+		return ModuleRMAs
+	case "quote", "quotes":
+		return ModuleQuotes
+	case "pricing", "price", "prices":
+		return ModulePricing
+	case "device", "devices":
+		return ModuleDevices
+	case "firmware", "campaign", "campaigns":
+		return ModuleFirmware
+	case "shipment", "shipments":
+		return ModuleShipments
+	case "field_report", "field_reports":
+		return ModuleFieldReports
+	case "rfq", "rfqs":
+		return ModuleRFQs
+	case "test", "tests", "testing":
+		return ModuleTesting
+	case "user", "users", "apikey", "api_key", "settings", "webhook":
+		return ModuleAdmin
+	}
+	return ""
+}
+
 // MapAPIPathToPermission maps an API path + method to (module, action).
 // Returns empty strings if no permission mapping exists (passthrough).
 func MapAPIPathToPermission(apiPath, method string) (module, action string) {
@@ -259,6 +304,8 @@ func MapAPIPathToPermission(apiPath, method string) (module, action string) {
 			action = PermActionApprove
 		case "implement":
 			action = PermActionApprove
+		case "freeze":
+			action = PermActionApprove
 		}
 	}
 
@@ -267,7 +314,7 @@ func MapAPIPathToPermission(apiPath, method string) (module, action string) {
 		module = ModuleParts
 	case "ecos":
 		module = ModuleECOs
-	case "docs":
+	case "docs", "training":
 		module = ModuleDocuments
 	case "inventory":
 		module = ModuleInventory
@@ -277,7 +324,7 @@ func MapAPIPathToPermission(apiPath, method string) (module, action string) {
 		module = ModulePOs
 	case "workorders":
 		module = ModuleWorkOrders
-	case "ncrs":
+	case "ncrs", "8d", "mrb":
 		module = ModuleNCRs
 	case "rmas":
 		module = ModuleRMAs
@@ -285,21 +332,21 @@ func MapAPIPathToPermission(apiPath, method string) (module, action string) {
 		module = ModuleQuotes
 	case "pricing":
 		module = ModulePricing
-	case "devices":
+	case "devices", "warranty-policies", "service-contracts":
 		module = ModuleDevices
 	case "campaigns":
 		module = ModuleFirmware
 	case "shipments":
 		module = ModuleShipments
-	case "field-reports":
+	case "field-reports", "reliability":
 		module = ModuleFieldReports
 	case "rfqs", "rfq-dashboard":
 		module = ModuleRFQs
 	case "reports":
 		module = ModuleReports
-	case "tests":
+	case "tests", "spc":
 		module = ModuleTesting
-	case "users", "apikeys", "api-keys", "admin":
+	case "users", "apikeys", "api-keys", "admin", "webhooks":
 		module = ModuleAdmin
 	case "email":
 		module = ModuleAdmin
@@ -307,7 +354,7 @@ func MapAPIPathToPermission(apiPath, method string) (module, action string) {
 		module = ModuleAdmin
 	case "receiving":
 		module = ModuleInventory
-	case "prices":
+	case "prices", "cost-rolls":
 		module = ModulePricing
 	case "dashboard", "search", "scan", "audit", "calendar",
 		"changes", "undo", "notifications", "email-log",
@@ -0,0 +1,389 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+)
+
+const (
+	// FilePrefix starts the name of every backup file.
+	FilePrefix = "zrp-backup-"
+	// ArchiveExt is the extension of backup archives.
+	ArchiveExt = ".tar.gz"
+	// LegacyExt is the extension of database-only backups made before
+	// archives were introduced. They can still be listed and restored.
+	LegacyExt = ".db"
+
+	// ManifestName is the manifest entry, always written last.
+	ManifestName = "manifest.json"
+	// DatabaseName is the database entry inside an archive.
+	DatabaseName = "zrp.db"
+	// GitPLMName holds the gitplm integration settings.
+	GitPLMName = "gitplm.json"
+	// UploadsPrefix is the directory attachments are stored under.
+	UploadsPrefix = "uploads/"
+
+	// FormatVersion is bumped when the archive layout changes.
+	FormatVersion = 1
+
+	timestampLayout = "2006-01-02T15-04-05"
+)
+
+// FileEntry records one file in an archive.
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the contents of a backup archive.
+type Manifest struct {
+	Format    int               `json:"format"`
+	CreatedAt time.Time         `json:"created_at"`
+	GitPLM    map[string]string `json:"gitplm,omitempty"`
+	Files     []FileEntry       `json:"files"`
+	// AuditChain is the audit log verification of the copied database.
+	AuditChain *models.AuditChainReport `json:"audit_chain,omitempty"`
+}
+
+// Options controls what goes into a new backup.
+type Options struct {
+	// Dir is the directory the archive is written to.
+	Dir string
+	// UploadsDir is the attachments directory. Skipped if empty or missing.
+	UploadsDir string
+	// GitPLM holds gitplm settings (parts directory, UI URL, ...).
+	GitPLM map[string]string
+}
+
+// IsBackupName reports whether name looks like a backup file.
+func IsBackupName(name string) bool {
+	return strings.HasPrefix(name, FilePrefix) &&
+		(strings.HasSuffix(name, ArchiveExt) || strings.HasSuffix(name, LegacyExt))
+}
+
+// IsArchive reports whether name is an archive rather than a legacy .db backup.
+func IsArchive(name string) bool {
+	return strings.HasSuffix(name, ArchiveExt)
+}
+
+// ParseTime extracts the creation time encoded in a backup filename.
+func ParseTime(name string) (time.Time, bool) {
+	if !IsBackupName(name) {
+		return time.Time{}, false
+	}
+	rest := strings.TrimPrefix(name, FilePrefix)
+	if len(rest) < len(timestampLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(timestampLayout, rest[:len(timestampLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Create writes a new archive to opts.Dir and returns its filename. The
+// database is copied with VACUUM INTO, which is consistent and does not
+// block writers. The audit chain head is checkpointed first and the
+// copy's chain verification is recorded in the manifest.
+func Create(db *sql.DB, opts Options) (string, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return "", fmt.Errorf("create backup dir: %w", err)
+	}
+
+	now := time.Now()
+	ts := now.Format(timestampLayout)
+	filename := FilePrefix + ts + ArchiveExt
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(opts.Dir, filename)); os.IsNotExist(err) {
+			break
+		}
+		filename = fmt.Sprintf("%s%s-%d%s", FilePrefix, ts, i, ArchiveExt)
+	}
+
+	staging, err := os.MkdirTemp(opts.Dir, ".staging-")
+	if err != nil {
+		return "", fmt.Errorf("create staging dir: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	audit.CreateCheckpoint(db, "backup")
+	dbCopy := filepath.Join(staging, DatabaseName)
+	if _, err := db.Exec(fmt.Sprintf("VACUUM INTO '%s'", strings.ReplaceAll(dbCopy, "'", "''"))); err != nil {
+		return "", fmt.Errorf("vacuum into: %w", err)
+	}
+	if err := CheckIntegrity(dbCopy); err != nil {
+		return "", err
+	}
+
+	var chain *models.AuditChainReport
+	if report, err := VerifyAuditChain(dbCopy); err == nil {
+		chain = &report
+	}
+
+	tmpPath := filepath.Join(staging, filename)
+	if err := writeArchive(tmpPath, dbCopy, opts, now, chain); err != nil {
+		return "", err
+	}
+	if _, err := Verify(tmpPath); err != nil {
+		return "", fmt.Errorf("verify new archive: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(opts.Dir, filename)); err != nil {
+		return "", fmt.Errorf("move archive into place: %w", err)
+	}
+	return filename, nil
+}
+
+func writeArchive(dest, dbCopy string, opts Options, now time.Time, chain *models.AuditChainReport) (err error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest := Manifest{Format: FormatVersion, CreatedAt: now.UTC(), GitPLM: opts.GitPLM, AuditChain: chain}
+	add := func(name, src string, mod time.Time) error {
+		entry, err := addFile(tw, name, src, mod)
+		if err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	}
+
+	if err := add(DatabaseName, dbCopy, now); err != nil {
+		return err
+	}
+
+	settings, _ := json.MarshalIndent(opts.GitPLM, "", "  ")
+	if opts.GitPLM == nil {
+		settings = []byte("{}")
+	}
+	gitplmPath := filepath.Join(filepath.Dir(dbCopy), GitPLMName)
+	if err := os.WriteFile(gitplmPath, settings, 0644); err != nil {
+		return err
+	}
+	if err := add(GitPLMName, gitplmPath, now); err != nil {
+		return err
+	}
+
+	if opts.UploadsDir != "" {
+		err := filepath.WalkDir(opts.UploadsDir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == opts.UploadsDir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(opts.UploadsDir, p)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return add(UploadsPrefix+filepath.ToSlash(rel), p, info.ModTime())
+		})
+		if err != nil {
+			return fmt.Errorf("archive uploads: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: now}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, name, src string, mod time.Time) (FileEntry, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: mod}); err != nil {
+		return FileEntry{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, h), in)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	return FileEntry{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Verify reads an archive end to end and checks every file against the
+// manifest checksums.
+func Verify(archivePath string) (*Manifest, error) {
+	return readArchive(archivePath, "")
+}
+
+// Extract verifies an archive and unpacks it into dest.
+func Extract(archivePath, dest string) (*Manifest, error) {
+	return readArchive(archivePath, dest)
+}
+
+func readArchive(archivePath, dest string) (*Manifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	seen := map[string]FileEntry{}
+	var manifest *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		if name != hdr.Name || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("unsafe path in archive: %q", hdr.Name)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		h := sha256.New()
+		var w io.Writer = h
+		var out *os.File
+		if dest != "" {
+			target := filepath.Join(dest, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, err
+			}
+			if out, err = os.Create(target); err != nil {
+				return nil, err
+			}
+			w = io.MultiWriter(h, out)
+		}
+		n, err := io.Copy(w, tr)
+		if out != nil {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		seen[name] = FileEntry{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", ManifestName)
+	}
+	if manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("archive format %d is newer than supported format %d", manifest.Format, FormatVersion)
+	}
+	hasDB := false
+	for _, want := range manifest.Files {
+		got, ok := seen[want.Path]
+		if !ok {
+			return nil, fmt.Errorf("checksum mismatch: %s missing from archive", want.Path)
+		}
+		if got.SHA256 != want.SHA256 || got.Size != want.Size {
+			return nil, fmt.Errorf("checksum mismatch: %s", want.Path)
+		}
+		delete(seen, want.Path)
+		hasDB = hasDB || want.Path == DatabaseName
+	}
+	if !hasDB {
+		return nil, fmt.Errorf("archive has no %s", DatabaseName)
+	}
+	if len(seen) > 0 {
+		extra := make([]string, 0, len(seen))
+		for name := range seen {
+			extra = append(extra, name)
+		}
+		sort.Strings(extra)
+		return nil, fmt.Errorf("archive contains files not in manifest: %s", strings.Join(extra, ", "))
+	}
+	return manifest, nil
+}
+
+// CheckIntegrity runs PRAGMA integrity_check against a database file.
+func CheckIntegrity(dbPath string) error {
+	conn, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", filepath.Base(dbPath), err)
+	}
+	defer conn.Close()
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+// VerifyAuditChain verifies the audit log hash chain of the database at
+// dbPath. It fails on databases without the chain tables.
+func VerifyAuditChain(dbPath string) (models.AuditChainReport, error) {
+	conn, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return models.AuditChainReport{}, fmt.Errorf("open %s: %w", filepath.Base(dbPath), err)
+	}
+	defer conn.Close()
+	return audit.VerifyChain(conn, "")
+}
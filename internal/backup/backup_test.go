@@ -0,0 +1,312 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zrp/internal/audit"
+)
+
+func openFileDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	return db
+}
+
+func newLiveDB(t *testing.T, dir, value string) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(dir, "zrp.db")
+	db := openFileDB(t, path)
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS kv (k TEXT PRIMARY KEY, v TEXT)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	db.Exec("INSERT INTO kv VALUES ('name', ?) ON CONFLICT(k) DO UPDATE SET v = excluded.v", value)
+	return db, path
+}
+
+func readValue(t *testing.T, path string) string {
+	t.Helper()
+	db := openFileDB(t, path)
+	defer db.Close()
+	var v string
+	if err := db.QueryRow("SELECT v FROM kv WHERE k = 'name'").Scan(&v); err != nil {
+		t.Fatalf("read value: %v", err)
+	}
+	return v
+}
+
+func TestCreateAndVerifyArchive(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := newLiveDB(t, dir, "original")
+	defer db.Close()
+	uploads := filepath.Join(dir, "uploads")
+	os.MkdirAll(filepath.Join(uploads, "ncr"), 0755)
+	os.WriteFile(filepath.Join(uploads, "ncr", "photo.jpg"), []byte("jpeg"), 0644)
+
+	backups := filepath.Join(dir, "backups")
+	name, err := Create(db, Options{Dir: backups, UploadsDir: uploads, GitPLM: map[string]string{"parts_dir": "/srv/parts"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !IsArchive(name) || !strings.HasPrefix(name, FilePrefix) {
+		t.Fatalf("unexpected name %q", name)
+	}
+	if _, ok := ParseTime(name); !ok {
+		t.Errorf("could not parse time from %q", name)
+	}
+
+	m, err := Verify(filepath.Join(backups, name))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, f := range m.Files {
+		paths[f.Path] = true
+	}
+	for _, want := range []string{DatabaseName, GitPLMName, "uploads/ncr/photo.jpg"} {
+		if !paths[want] {
+			t.Errorf("manifest missing %s: %+v", want, m.Files)
+		}
+	}
+	if m.GitPLM["parts_dir"] != "/srv/parts" {
+		t.Errorf("gitplm settings not recorded: %+v", m.GitPLM)
+	}
+
+	entries, _ := os.ReadDir(backups)
+	if len(entries) != 1 {
+		t.Errorf("expected only the archive in the backup dir, got %d entries", len(entries))
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := newLiveDB(t, dir, "original")
+	defer db.Close()
+	name, err := Create(db, Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	src := filepath.Join(dir, name)
+
+	// Rewrite the archive with a modified gitplm.json but the old manifest.
+	tampered := filepath.Join(dir, "tampered"+ArchiveExt)
+	in, _ := os.Open(src)
+	gzr, _ := gzip.NewReader(in)
+	tr := tar.NewReader(gzr)
+	out, _ := os.Create(tampered)
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name == GitPLMName {
+			data = []byte(`{"parts_dir":"/evil"}`)
+			hdr.Size = int64(len(data))
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	gzw.Close()
+	out.Close()
+	in.Close()
+
+	if _, err := Verify(tampered); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestRestoreSwapsDatabaseAndUploads(t *testing.T) {
+	dir := t.TempDir()
+	db, dbPath := newLiveDB(t, dir, "from-backup")
+	uploads := filepath.Join(dir, "uploads")
+	os.MkdirAll(uploads, 0755)
+	os.WriteFile(filepath.Join(uploads, "a.txt"), []byte("old attachment"), 0644)
+	name, err := Create(db, Options{Dir: filepath.Join(dir, "backups"), UploadsDir: uploads})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	db.Exec("UPDATE kv SET v = 'changed-later'")
+	os.WriteFile(filepath.Join(uploads, "b.txt"), []byte("new attachment"), 0644)
+
+	reopened := 0
+	_, err = Restore(RestoreOptions{
+		Backup:     filepath.Join(dir, "backups", name),
+		DBPath:     dbPath,
+		UploadsDir: uploads,
+		Close:      db.Close,
+		Reopen:     func(string) error { reopened++; return nil },
+	})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if reopened != 1 {
+		t.Errorf("expected one reopen, got %d", reopened)
+	}
+	if v := readValue(t, dbPath); v != "from-backup" {
+		t.Errorf("restored value = %q", v)
+	}
+	if _, err := os.Stat(filepath.Join(uploads, "b.txt")); !os.IsNotExist(err) {
+		t.Error("uploads directory was not replaced")
+	}
+	if data, _ := os.ReadFile(filepath.Join(uploads, "a.txt")); string(data) != "old attachment" {
+		t.Errorf("attachment not restored: %q", data)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*pre-restore*"))
+	if len(leftovers) != 0 {
+		t.Errorf("pre-restore files not cleaned up: %v", leftovers)
+	}
+}
+
+func TestRestoreRejectsCorruptBackupWithoutTouchingLiveDB(t *testing.T) {
+	dir := t.TempDir()
+	db, dbPath := newLiveDB(t, dir, "live")
+	defer db.Close()
+	bad := filepath.Join(dir, FilePrefix+"2025-01-01T00-00-00"+LegacyExt)
+	os.WriteFile(bad, []byte("this is not a database"), 0644)
+
+	closed := false
+	_, err := Restore(RestoreOptions{
+		Backup: bad,
+		DBPath: dbPath,
+		Close:  func() error { closed = true; return nil },
+	})
+	if err == nil {
+		t.Fatal("expected corrupt backup to be rejected")
+	}
+	if closed {
+		t.Error("live pool should not be closed when the backup fails verification")
+	}
+	if v := readValue(t, dbPath); v != "live" {
+		t.Errorf("live db changed: %q", v)
+	}
+}
+
+func TestRestoreRollsBackWhenReopenFails(t *testing.T) {
+	dir := t.TempDir()
+	db, dbPath := newLiveDB(t, dir, "backup")
+	name, err := Create(db, Options{Dir: filepath.Join(dir, "backups")})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	db.Exec("UPDATE kv SET v = 'live'")
+
+	calls := 0
+	_, err = Restore(RestoreOptions{
+		Backup: filepath.Join(dir, "backups", name),
+		DBPath: dbPath,
+		Close:  db.Close,
+		Reopen: func(string) error {
+			calls++
+			if calls == 1 {
+				return errors.New("migrations failed")
+			}
+			return nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "previous data kept") {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected reopen after rollback, got %d calls", calls)
+	}
+	if v := readValue(t, dbPath); v != "live" {
+		t.Errorf("expected previous database after rollback, got %q", v)
+	}
+}
+
+func TestExpiredGFS(t *testing.T) {
+	var items []Item
+	start := time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC)
+	for d := 0; d < 120; d++ {
+		ts := start.AddDate(0, 0, d)
+		items = append(items, Item{Name: ts.Format("2006-01-02"), Time: ts})
+	}
+	expired := Expired(items, Policy{Daily: 7, Weekly: 4, Monthly: 3})
+	kept := len(items) - len(expired)
+
+	gone := map[string]bool{}
+	for _, n := range expired {
+		gone[n] = true
+	}
+	// Last 7 days are kept.
+	for d := 113; d < 120; d++ {
+		if name := start.AddDate(0, 0, d).Format("2006-01-02"); gone[name] {
+			t.Errorf("daily backup %s expired", name)
+		}
+	}
+	// Newest of March (last day of the month) is kept as a monthly.
+	if gone["2025-03-31"] {
+		t.Error("monthly backup 2025-03-31 expired")
+	}
+	if !gone["2025-01-15"] {
+		t.Error("mid-January backup should have expired")
+	}
+	// 7 daily + up to 4 weekly + up to 3 monthly, with overlaps.
+	if kept < 7 || kept > 14 {
+		t.Errorf("kept %d backups", kept)
+	}
+}
+
+func TestExpiredAlwaysKeepsNewest(t *testing.T) {
+	items := []Item{{Name: "a", Time: time.Now()}, {Name: "b", Time: time.Now().Add(-time.Hour)}}
+	expired := Expired(items, Policy{})
+	if len(expired) != 1 || expired[0] != "b" {
+		t.Errorf("expected only b to expire, got %v", expired)
+	}
+}
+
+func TestCreateRecordsAuditChain(t *testing.T) {
+	t.Setenv(audit.KeyEnv, "test-audit-key")
+	dir := t.TempDir()
+	db, _ := newLiveDB(t, dir, "original")
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`,
+		`CREATE TABLE audit_log (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, username TEXT,
+			action TEXT NOT NULL, module TEXT NOT NULL, record_id TEXT NOT NULL, summary TEXT,
+			before_value TEXT, after_value TEXT, ip_address TEXT, user_agent TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP, prev_hash TEXT, entry_hash TEXT)`,
+		`CREATE TABLE audit_checkpoints (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL,
+			last_id INTEGER NOT NULL, last_hash TEXT NOT NULL, entries INTEGER NOT NULL,
+			created_at TEXT NOT NULL, signature TEXT NOT NULL)`,
+		`CREATE TABLE audit_archives (id INTEGER PRIMARY KEY AUTOINCREMENT, file TEXT NOT NULL,
+			first_id INTEGER NOT NULL, last_id INTEGER NOT NULL, entries INTEGER NOT NULL,
+			prev_hash TEXT NOT NULL, last_hash TEXT NOT NULL, file_sha256 TEXT NOT NULL,
+			created_at TEXT NOT NULL, signature TEXT NOT NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audit.LogAudit(db, nil, "admin", "create", "parts", "R-1", "Created R-1")
+	audit.LogAudit(db, nil, "admin", "update", "parts", "R-1", "Updated R-1")
+
+	backups := filepath.Join(dir, "backups")
+	name, err := Create(db, Options{Dir: backups})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	m, err := Verify(filepath.Join(backups, name))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if c := m.AuditChain; c == nil || !c.Intact || c.Entries != 2 || c.Checkpoints != 1 {
+		t.Errorf("audit chain = %+v", c)
+	}
+}
@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedExt is appended to the names of encrypted backups.
+const EncryptedExt = ".enc"
+
+// Encrypted files start with encMagic, a random salt and a random nonce
+// prefix, followed by AES-256-GCM sealed chunks. Each chunk's nonce is the
+// prefix plus a chunk counter, and the final chunk is authenticated with a
+// different additional-data byte so truncation is detected.
+var encMagic = []byte("ZRPENC1\n")
+
+const (
+	encSaltSize   = 16
+	encPrefixSize = 4
+	encChunkSize  = 64 * 1024
+)
+
+// ErrBadPassphrase is returned when an encrypted backup cannot be
+// authenticated with the given passphrase.
+var ErrBadPassphrase = errors.New("wrong passphrase or corrupted backup")
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func chunkNonce(prefix []byte, n uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+// Encrypt copies src to dst encrypted with a key derived from passphrase.
+func Encrypt(dst io.Writer, src io.Reader, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("encryption passphrase is empty")
+	}
+	header := make([]byte, len(encMagic)+encSaltSize+encPrefixSize)
+	copy(header, encMagic)
+	if _, err := rand.Read(header[len(encMagic):]); err != nil {
+		return err
+	}
+	salt := header[len(encMagic) : len(encMagic)+encSaltSize]
+	prefix := header[len(encMagic)+encSaltSize:]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, encChunkSize)
+	next := make([]byte, encChunkSize)
+	n, err := io.ReadFull(src, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	for counter := uint64(0); ; counter++ {
+		// Read ahead so the last chunk can be marked as final.
+		m, rerr := io.ReadFull(src, next)
+		if rerr != nil && rerr != io.ErrUnexpectedEOF && rerr != io.EOF {
+			return rerr
+		}
+		final := m == 0
+		ad := []byte{0}
+		if final {
+			ad[0] = 1
+		}
+		sealed := aead.Seal(nil, chunkNonce(prefix, counter), buf[:n], ad)
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+		if _, err := dst.Write(size[:]); err != nil {
+			return err
+		}
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+		buf, next = next, buf
+		n = m
+	}
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(dst io.Writer, src io.Reader, passphrase string) error {
+	header := make([]byte, len(encMagic)+encSaltSize+encPrefixSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(header[:len(encMagic)], encMagic) {
+		return fmt.Errorf("not an encrypted backup")
+	}
+	salt := header[len(encMagic) : len(encMagic)+encSaltSize]
+	prefix := header[len(encMagic)+encSaltSize:]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	for counter := uint64(0); ; counter++ {
+		var size [4]byte
+		if _, err := io.ReadFull(src, size[:]); err != nil {
+			return fmt.Errorf("%w: truncated", ErrBadPassphrase)
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > encChunkSize+uint32(aead.Overhead()) {
+			return ErrBadPassphrase
+		}
+		sealed := make([]byte, n)
+		if _, err := io.ReadFull(src, sealed); err != nil {
+			return fmt.Errorf("%w: truncated", ErrBadPassphrase)
+		}
+		nonce := chunkNonce(prefix, counter)
+		plain, err := aead.Open(nil, nonce, sealed, []byte{0})
+		final := false
+		if err != nil {
+			if plain, err = aead.Open(nil, nonce, sealed, []byte{1}); err != nil {
+				return ErrBadPassphrase
+			}
+			final = true
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Destination kinds.
+const (
+	KindLocal = "local"
+	KindSFTP  = "sftp"
+	KindS3    = "s3"
+)
+
+// RemoteObject is a backup stored at a destination.
+type RemoteObject struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Destination is an off-site location backups are copied to.
+type Destination interface {
+	// Put stores r under name, replacing any existing object.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get opens a stored object.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the backups stored at the destination.
+	List(ctx context.Context) ([]RemoteObject, error)
+	// Delete removes a stored object.
+	Delete(ctx context.Context, name string) error
+}
+
+// NewDestination builds a destination from its kind and JSON config.
+func NewDestination(kind string, config json.RawMessage) (Destination, error) {
+	switch kind {
+	case KindLocal:
+		var c LocalConfig
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, fmt.Errorf("invalid local config: %w", err)
+		}
+		return NewLocal(c)
+	case KindSFTP:
+		var c SFTPConfig
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, fmt.Errorf("invalid sftp config: %w", err)
+		}
+		return NewSFTP(c)
+	case KindS3:
+		var c S3Config
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, fmt.Errorf("invalid s3 config: %w", err)
+		}
+		return NewS3(c)
+	}
+	return nil, fmt.Errorf("unknown destination kind %q", kind)
+}
+
+// LocalConfig configures a destination on a mounted filesystem, such as an
+// NFS share or a second disk.
+type LocalConfig struct {
+	Path string `json:"path"`
+}
+
+// Local stores backups in a directory.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a local/NFS destination.
+func NewLocal(c LocalConfig) (*Local, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	return &Local{dir: c.Path}, nil
+}
+
+func (l *Local) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return filepath.Join(l.dir, name), nil
+}
+
+// Put writes to a temporary file and renames it so readers never see a
+// partial backup.
+func (l *Local) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	dest, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(l.dir, ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (l *Local) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (l *Local) List(ctx context.Context) ([]RemoteObject, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []RemoteObject
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), FilePrefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, RemoteObject{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sortObjects(out)
+	return out, nil
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func sortObjects(objs []RemoteObject) {
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name > objs[j].Name })
+}
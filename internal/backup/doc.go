@@ -0,0 +1,4 @@
+// Package backup creates self-verifying backup archives of the database,
+// uploaded attachments and gitplm settings, restores them with a safe file
+// swap, and applies grandfather-father-son retention.
+package backup
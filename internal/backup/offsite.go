@@ -0,0 +1,382 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Upload statuses.
+const (
+	UploadPending  = "pending"
+	UploadUploaded = "uploaded"
+	UploadFailed   = "failed"
+)
+
+// PassphraseEnv names the environment variable holding the passphrase used
+// for client-side encryption. It is deliberately not stored in the
+// database, which is itself part of every backup.
+const PassphraseEnv = "ZRP_BACKUP_PASSPHRASE"
+
+// MaxUploadAttempts is how many times a failed upload is retried.
+const MaxUploadAttempts = 5
+
+// SecretFields are config keys that are masked when targets are returned
+// by the API.
+var SecretFields = []string{"password", "private_key", "key_passphrase", "secret_key"}
+
+// Target is a configured off-site destination.
+type Target struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Kind      string          `json:"kind"`
+	Config    json.RawMessage `json:"config"`
+	Encrypt   bool            `json:"encrypt"`
+	Enabled   bool            `json:"enabled"`
+	CreatedBy string          `json:"created_by"`
+	CreatedAt string          `json:"created_at"`
+	UpdatedAt string          `json:"updated_at"`
+}
+
+// UploadStatus is the state of one backup at one target.
+type UploadStatus struct {
+	TargetID   int     `json:"target_id"`
+	Target     string  `json:"target"`
+	RemoteName string  `json:"remote_name"`
+	Status     string  `json:"status"`
+	Attempts   int     `json:"attempts"`
+	Error      string  `json:"error,omitempty"`
+	UploadedAt *string `json:"uploaded_at,omitempty"`
+}
+
+const targetColumns = `id, name, kind, config, encrypt, enabled, COALESCE(created_by,''), created_at, updated_at`
+
+func scanTarget(row interface{ Scan(...any) error }) (Target, error) {
+	var t Target
+	var config string
+	err := row.Scan(&t.ID, &t.Name, &t.Kind, &config, &t.Encrypt, &t.Enabled, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt)
+	t.Config = json.RawMessage(config)
+	return t, err
+}
+
+// GetTarget loads a target by id.
+func GetTarget(db *sql.DB, id int) (Target, error) {
+	return scanTarget(db.QueryRow("SELECT "+targetColumns+" FROM backup_targets WHERE id = ?", id))
+}
+
+// ListTargets returns all targets, or only enabled ones.
+func ListTargets(db *sql.DB, enabledOnly bool) ([]Target, error) {
+	q := "SELECT " + targetColumns + " FROM backup_targets"
+	if enabledOnly {
+		q += " WHERE enabled = 1"
+	}
+	rows, err := db.Query(q + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	targets := []Target{}
+	for rows.Next() {
+		t, err := scanTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// UploadStatuses returns upload status per local backup filename.
+func UploadStatuses(db *sql.DB) (map[string][]UploadStatus, error) {
+	rows, err := db.Query(`SELECT u.filename, u.target_id, t.name, u.remote_name, u.status, u.attempts,
+		COALESCE(u.error,''), u.uploaded_at
+		FROM backup_uploads u JOIN backup_targets t ON t.id = u.target_id ORDER BY u.target_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string][]UploadStatus{}
+	for rows.Next() {
+		var filename string
+		var s UploadStatus
+		var uploadedAt sql.NullString
+		if err := rows.Scan(&filename, &s.TargetID, &s.Target, &s.RemoteName, &s.Status, &s.Attempts, &s.Error, &uploadedAt); err != nil {
+			return nil, err
+		}
+		if uploadedAt.Valid {
+			s.UploadedAt = &uploadedAt.String
+		}
+		out[filename] = append(out[filename], s)
+	}
+	return out, rows.Err()
+}
+
+// Uploader copies local backups to the enabled targets.
+type Uploader struct {
+	DB  *sql.DB
+	Dir string
+	// Passphrase encrypts uploads to targets with Encrypt set. Defaults to
+	// the PassphraseEnv environment variable.
+	Passphrase string
+	// Open builds a destination; defaults to NewDestination.
+	Open func(kind string, config json.RawMessage) (Destination, error)
+	Now  func() time.Time
+}
+
+func (u *Uploader) passphrase() string {
+	if u.Passphrase != "" {
+		return u.Passphrase
+	}
+	return os.Getenv(PassphraseEnv)
+}
+
+// Destination builds the destination for a target.
+func (u *Uploader) Destination(t Target) (Destination, error) {
+	if u.Open != nil {
+		return u.Open(t.Kind, t.Config)
+	}
+	return NewDestination(t.Kind, t.Config)
+}
+
+// Stat reports on a local backup file.
+func (u *Uploader) Stat(filename string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(u.Dir, filename))
+}
+
+func (u *Uploader) now() time.Time {
+	if u.Now != nil {
+		return u.Now()
+	}
+	return time.Now()
+}
+
+// Enqueue queues filename for upload to every enabled target. Returns the
+// number of uploads queued.
+func (u *Uploader) Enqueue(filename string) (int, error) {
+	targets, err := ListTargets(u.DB, true)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range targets {
+		remote := filename
+		if t.Encrypt {
+			remote += EncryptedExt
+		}
+		res, err := u.DB.Exec(`INSERT INTO backup_uploads (target_id, filename, remote_name, status)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(target_id, filename) DO UPDATE SET status = ?, attempts = 0, error = NULL
+			WHERE backup_uploads.status != ?`,
+			t.ID, filename, remote, UploadPending, UploadPending, UploadUploaded)
+		if err != nil {
+			return n, err
+		}
+		if c, _ := res.RowsAffected(); c > 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ProcessPending attempts every pending upload and retries failed ones
+// that have attempts left. Returns the number of uploads attempted.
+func (u *Uploader) ProcessPending(ctx context.Context) (int, error) {
+	rows, err := u.DB.Query(`SELECT u.id, u.target_id, u.filename, u.remote_name FROM backup_uploads u
+		JOIN backup_targets t ON t.id = u.target_id AND t.enabled = 1
+		WHERE u.status = ? OR (u.status = ? AND u.attempts < ?) ORDER BY u.id`,
+		UploadPending, UploadFailed, MaxUploadAttempts)
+	if err != nil {
+		return 0, err
+	}
+	type job struct {
+		id, targetID     int
+		filename, remote string
+	}
+	var jobs []job
+	for rows.Next() {
+		var j job
+		if err := rows.Scan(&j.id, &j.targetID, &j.filename, &j.remote); err == nil {
+			jobs = append(jobs, j)
+		}
+	}
+	rows.Close()
+
+	for _, j := range jobs {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		t, err := GetTarget(u.DB, j.targetID)
+		if err == nil {
+			err = u.upload(ctx, t, j.filename, j.remote)
+		}
+		ts := u.now().UTC().Format("2006-01-02 15:04:05")
+		if err != nil {
+			u.DB.Exec(`UPDATE backup_uploads SET status = ?, attempts = attempts + 1, error = ?, started_at = ? WHERE id = ?`,
+				UploadFailed, err.Error(), ts, j.id)
+			continue
+		}
+		u.DB.Exec(`UPDATE backup_uploads SET status = ?, attempts = attempts + 1, error = NULL, started_at = ?, uploaded_at = ? WHERE id = ?`,
+			UploadUploaded, ts, ts, j.id)
+	}
+	return len(jobs), nil
+}
+
+func (u *Uploader) upload(ctx context.Context, t Target, filename, remote string) error {
+	dest, err := u.Destination(t)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(u.Dir, filename)
+	if t.Encrypt {
+		pass := u.passphrase()
+		if pass == "" {
+			return fmt.Errorf("target requires encryption but %s is not set", PassphraseEnv)
+		}
+		tmp, err := os.CreateTemp(u.Dir, ".encrypt-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		in, err := os.Open(src)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		err = Encrypt(tmp, in, pass)
+		in.Close()
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+		src = tmp.Name()
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return dest.Put(ctx, remote, f, info.Size())
+}
+
+// Prune applies the retention policy to the backups stored at a target.
+// Returns the names removed.
+func (u *Uploader) Prune(ctx context.Context, t Target, policy Policy) ([]string, error) {
+	dest, err := u.Destination(t)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := dest.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, o := range objs {
+		ts, ok := ParseTime(strings.TrimSuffix(o.Name, EncryptedExt))
+		if !ok {
+			continue
+		}
+		items = append(items, Item{Name: o.Name, Time: ts})
+	}
+	var removed []string
+	for _, name := range Expired(items, policy) {
+		if err := dest.Delete(ctx, name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// Fetch downloads a backup from a target into the local backup directory,
+// decrypting it if needed, so it can be verified and restored like any
+// local backup. Returns the local filename.
+func (u *Uploader) Fetch(ctx context.Context, t Target, remote string) (string, error) {
+	local := strings.TrimSuffix(remote, EncryptedExt)
+	if !IsBackupName(local) || strings.ContainsAny(local, `/\`) {
+		return "", fmt.Errorf("invalid backup name %q", remote)
+	}
+	dest, err := u.Destination(t)
+	if err != nil {
+		return "", err
+	}
+	rc, err := dest.Get(ctx, remote)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(u.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(u.Dir, ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if strings.HasSuffix(remote, EncryptedExt) {
+		err = Decrypt(tmp, rc, u.passphrase())
+	} else {
+		_, err = io.Copy(tmp, rc)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if IsArchive(local) {
+		if _, err := Verify(tmp.Name()); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(u.Dir, local)); err != nil {
+		return "", err
+	}
+	return local, nil
+}
+
+// MaskSecrets replaces secret values in a target config with "********".
+func MaskSecrets(config json.RawMessage) json.RawMessage {
+	var m map[string]any
+	if json.Unmarshal(config, &m) != nil {
+		return config
+	}
+	for _, k := range SecretFields {
+		if v, ok := m[k].(string); ok && v != "" {
+			m[k] = "********"
+		}
+	}
+	out, _ := json.Marshal(m)
+	return out
+}
+
+// MergeSecrets keeps the previous value of any secret left masked or
+// empty in an updated config.
+func MergeSecrets(updated, previous json.RawMessage) json.RawMessage {
+	var next, prev map[string]any
+	if json.Unmarshal(updated, &next) != nil || json.Unmarshal(previous, &prev) != nil {
+		return updated
+	}
+	for _, k := range SecretFields {
+		if v, _ := next[k].(string); v == "" || v == "********" {
+			if old, ok := prev[k]; ok {
+				next[k] = old
+			}
+		}
+	}
+	out, _ := json.Marshal(next)
+	return out
+}
@@ -0,0 +1,591 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"zrp/internal/database"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	plain := bytes.Repeat([]byte("zrp backup data "), 10000) // spans several chunks
+	var enc bytes.Buffer
+	if err := Encrypt(&enc, bytes.NewReader(plain), "correct horse"); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if bytes.Contains(enc.Bytes(), []byte("zrp backup data")) {
+		t.Fatal("ciphertext contains plaintext")
+	}
+
+	var dec bytes.Buffer
+	if err := Decrypt(&dec, bytes.NewReader(enc.Bytes()), "correct horse"); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(dec.Bytes(), plain) {
+		t.Fatal("round trip mismatch")
+	}
+
+	if err := Decrypt(io.Discard, bytes.NewReader(enc.Bytes()), "wrong"); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("wrong passphrase: got %v, want ErrBadPassphrase", err)
+	}
+
+	truncated := enc.Bytes()[:enc.Len()-100]
+	if err := Decrypt(io.Discard, bytes.NewReader(truncated), "correct horse"); err == nil {
+		t.Fatal("expected error for truncated ciphertext")
+	}
+}
+
+func TestEncryptEmptyInput(t *testing.T) {
+	var enc, dec bytes.Buffer
+	if err := Encrypt(&enc, bytes.NewReader(nil), "pw"); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if err := Decrypt(&dec, &enc, "pw"); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if dec.Len() != 0 {
+		t.Fatalf("got %d bytes, want 0", dec.Len())
+	}
+}
+
+// exerciseDestination runs the Destination contract against d.
+func exerciseDestination(t *testing.T, d Destination) {
+	t.Helper()
+	ctx := context.Background()
+	names := []string{
+		"zrp-backup-2026-01-01T02-00-00.tar.gz",
+		"zrp-backup-2026-01-02T02-00-00.tar.gz.enc",
+	}
+	for i, name := range names {
+		body := []byte(fmt.Sprintf("payload %d", i))
+		if err := d.Put(ctx, name, bytes.NewReader(body), int64(len(body))); err != nil {
+			t.Fatalf("Put %s: %v", name, err)
+		}
+	}
+	// Overwrite keeps a single object.
+	if err := d.Put(ctx, names[0], strings.NewReader("payload 0b"), 10); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+
+	objs, err := d.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objs) != 2 || objs[0].Name != names[1] || objs[1].Name != names[0] {
+		t.Fatalf("List = %+v, want newest first", objs)
+	}
+	if objs[1].Size != 10 {
+		t.Errorf("size = %d, want 10", objs[1].Size)
+	}
+
+	rc, err := d.Get(ctx, names[0])
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "payload 0b" {
+		t.Fatalf("Get = %q", got)
+	}
+
+	if err := d.Delete(ctx, names[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	objs, _ = d.List(ctx)
+	if len(objs) != 1 {
+		t.Fatalf("after delete List = %+v", objs)
+	}
+	if _, err := d.Get(ctx, names[0]); err == nil {
+		t.Fatal("expected error getting deleted object")
+	}
+}
+
+func TestLocalDestination(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nfs", "zrp")
+	d, err := NewLocal(LocalConfig{Path: dir})
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	exerciseDestination(t, d)
+
+	if err := d.Put(context.Background(), "../escape", strings.NewReader("x"), 1); err == nil {
+		t.Fatal("expected error for path traversal")
+	}
+}
+
+// fakeS3 is a MinIO-style stand-in: path-style buckets, SigV4 checked on
+// every request and objects kept in memory.
+type fakeS3 struct {
+	t              *testing.T
+	bucket         string
+	access, secret string
+	region         string
+	mu             sync.Mutex
+	objects        map[string][]byte
+	modTimes       map[string]time.Time
+	maxKeys        int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{t: t, bucket: "zrp", access: "minio", secret: "minio123", region: "us-east-1",
+		objects: map[string][]byte{}, modTimes: map[string]time.Time{}, maxKeys: 1}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) verify(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	var cred, signed, sig string
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "Credential":
+			cred = v
+		case "SignedHeaders":
+			signed = v
+		case "Signature":
+			sig = v
+		}
+	}
+	credParts := strings.Split(cred, "/")
+	if len(credParts) != 5 || credParts[0] != f.access {
+		return false
+	}
+	date, scope := credParts[1], strings.Join(credParts[1:], "/")
+	var headers strings.Builder
+	for _, h := range strings.Split(signed, ";") {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery,
+		headers.String(), signed, r.Header.Get("X-Amz-Content-Sha256")}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	mac := func(key []byte, s string) []byte {
+		m := hmac.New(sha256.New, key)
+		m.Write([]byte(s))
+		return m.Sum(nil)
+	}
+	key := mac(mac(mac(mac([]byte("AWS4"+f.secret), date), f.region), "s3"), "aws4_request")
+	return hmac.Equal([]byte(hex.EncodeToString(mac(key, toSign))), []byte(sig))
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.verify(r) {
+		f.fail(w, 403, "SignatureDoesNotMatch")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.fail(w, 404, "NoSuchBucket")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == "PUT":
+		if r.ContentLength < 0 {
+			f.fail(w, 411, "MissingContentLength")
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		f.modTimes[key] = time.Now().UTC()
+	case r.Method == "GET":
+		body, ok := f.objects[key]
+		if !ok {
+			f.fail(w, 404, "NoSuchKey")
+			return
+		}
+		w.Write(body)
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(204)
+	default:
+		f.fail(w, 405, "MethodNotAllowed")
+	}
+}
+
+// list pages through keys maxKeys at a time so continuation is exercised.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start := 0
+	if tok := r.URL.Query().Get("continuation-token"); tok != "" {
+		start = sort.SearchStrings(keys, tok)
+	}
+	type content struct {
+		Key          string
+		Size         int
+		LastModified string
+	}
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}
+	end := start + f.maxKeys
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[end]
+	} else {
+		end = len(keys)
+	}
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, content{k, len(f.objects[k]), f.modTimes[k].Format(time.RFC3339)})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3Destination(t *testing.T) {
+	f, srv := newFakeS3(t)
+	d, err := NewS3(S3Config{Endpoint: srv.URL, Bucket: f.bucket, Prefix: "site-a", AccessKey: f.access, SecretKey: f.secret})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	exerciseDestination(t, d)
+
+	for k := range f.objects {
+		if !strings.HasPrefix(k, "site-a/") {
+			t.Errorf("object %q stored outside prefix", k)
+		}
+	}
+}
+
+func TestS3BadCredentials(t *testing.T) {
+	f, srv := newFakeS3(t)
+	d, _ := NewS3(S3Config{Endpoint: srv.URL, Bucket: f.bucket, AccessKey: f.access, SecretKey: "wrong"})
+	_, err := d.List(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("got %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+// startFakeSFTP runs an SSH server whose "sftp" subsystem serves root.
+// Returns the listen address and the host key fingerprint.
+func startFakeSFTP(t *testing.T, root, password string) (string, int, string) {
+	t.Helper()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "backup" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, cfg, root)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+func serveSSH(conn net.Conn, cfg *ssh.ServerConfig, root string) {
+	sc, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range chReqs {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						serveSFTP(ch, root)
+						ch.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP serves root over the SFTP subsystem channel ch.
+func serveSFTP(ch io.ReadWriteCloser, root string) {
+	srv, err := sftp.NewServer(ch, sftp.WithServerWorkingDirectory(root))
+	if err != nil {
+		return
+	}
+	srv.Serve()
+}
+
+func TestSFTPDestination(t *testing.T) {
+	root := t.TempDir()
+	host, port, fingerprint := startFakeSFTP(t, root, "s3cret")
+	d, err := NewSFTP(SFTPConfig{Host: host, Port: port, User: "backup", Password: "s3cret", HostKey: fingerprint, Path: "zrp/nightly"})
+	if err != nil {
+		t.Fatalf("NewSFTP: %v", err)
+	}
+	exerciseDestination(t, d)
+
+	if _, err := os.Stat(filepath.Join(root, "zrp", "nightly", "zrp-backup-2026-01-02T02-00-00.tar.gz.enc")); err != nil {
+		t.Fatalf("expected uploaded file on server: %v", err)
+	}
+
+	// Large archives are streamed rather than held in memory.
+	ctx := context.Background()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 4<<16)
+	if err := d.Put(ctx, "zrp-backup-2026-01-03T02-00-00.tar.gz", bytes.NewReader(big), int64(len(big))); err != nil {
+		t.Fatalf("Put large: %v", err)
+	}
+	rc, err := d.Get(ctx, "zrp-backup-2026-01-03T02-00-00.tar.gz")
+	if err != nil {
+		t.Fatalf("Get large: %v", err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, rc)
+	rc.Close()
+	want := sha256.Sum256(big)
+	if err != nil || n != int64(len(big)) || !bytes.Equal(h.Sum(nil), want[:]) {
+		t.Fatalf("Get large: %d bytes, %v", n, err)
+	}
+	if _, err := d.Get(ctx, "zrp-backup-1999-01-01T00-00-00.tar.gz"); err == nil {
+		t.Fatal("Get of a missing object succeeded")
+	}
+}
+
+func TestSFTPRejectsUnknownHostKey(t *testing.T) {
+	host, port, _ := startFakeSFTP(t, t.TempDir(), "s3cret")
+	d, _ := NewSFTP(SFTPConfig{Host: host, Port: port, User: "backup", Password: "s3cret", HostKey: "SHA256:not-the-key"})
+	_, err := d.List(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+		t.Fatalf("got %v, want host key mismatch", err)
+	}
+}
+
+func newUploaderDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db, nil); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db
+}
+
+func addTarget(t *testing.T, db *sql.DB, name, kind string, config any, encrypt bool) Target {
+	t.Helper()
+	cfg, _ := json.Marshal(config)
+	res, err := db.Exec("INSERT INTO backup_targets (name, kind, config, encrypt) VALUES (?, ?, ?, ?)", name, kind, string(cfg), encrypt)
+	if err != nil {
+		t.Fatalf("insert target: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	tg, err := GetTarget(db, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tg
+}
+
+func TestUploaderEncryptsUploadsAndFetchesBack(t *testing.T) {
+	db := newUploaderDB(t)
+	dir := t.TempDir()
+	live, _ := newLiveDB(t, t.TempDir(), "v1")
+	name, err := Create(live, Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	original, _ := os.ReadFile(filepath.Join(dir, name))
+
+	f, srv := newFakeS3(t)
+	s3Target := addTarget(t, db, "minio", KindS3, S3Config{Endpoint: srv.URL, Bucket: f.bucket, AccessKey: f.access, SecretKey: f.secret}, true)
+	nfs := t.TempDir()
+	addTarget(t, db, "nfs", KindLocal, LocalConfig{Path: nfs}, false)
+
+	u := &Uploader{DB: db, Dir: dir, Passphrase: "pw"}
+	if n, err := u.Enqueue(name); err != nil || n != 2 {
+		t.Fatalf("Enqueue = %d, %v", n, err)
+	}
+	if _, err := u.ProcessPending(context.Background()); err != nil {
+		t.Fatalf("ProcessPending: %v", err)
+	}
+
+	statuses, err := UploadStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := statuses[name]
+	if len(got) != 2 {
+		t.Fatalf("statuses = %+v", got)
+	}
+	for _, s := range got {
+		if s.Status != UploadUploaded || s.UploadedAt == nil {
+			t.Errorf("%s: status %q error %q", s.Target, s.Status, s.Error)
+		}
+	}
+	if got[0].RemoteName != name+EncryptedExt || got[1].RemoteName != name {
+		t.Errorf("remote names = %q, %q", got[0].RemoteName, got[1].RemoteName)
+	}
+	if bytes.Contains(f.objects[name+EncryptedExt], []byte(ManifestName)) {
+		t.Error("encrypted object exposes archive contents")
+	}
+	if plain, _ := os.ReadFile(filepath.Join(nfs, name)); !bytes.Equal(plain, original) {
+		t.Error("local target copy differs from backup")
+	}
+
+	// Re-queueing an uploaded backup is a no-op.
+	if n, _ := u.Enqueue(name); n != 0 {
+		t.Errorf("re-enqueue queued %d uploads", n)
+	}
+
+	// Fetch the encrypted copy back after losing the local file.
+	os.Remove(filepath.Join(dir, name))
+	local, err := u.Fetch(context.Background(), s3Target, name+EncryptedExt)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	fetched, _ := os.ReadFile(filepath.Join(dir, local))
+	if local != name || !bytes.Equal(fetched, original) {
+		t.Fatal("fetched backup differs from original")
+	}
+
+	bad := &Uploader{DB: db, Dir: dir, Passphrase: "nope"}
+	if _, err := bad.Fetch(context.Background(), s3Target, name+EncryptedExt); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("Fetch with wrong passphrase: %v", err)
+	}
+}
+
+func TestUploaderRecordsFailureAndRetries(t *testing.T) {
+	db := newUploaderDB(t)
+	dir := t.TempDir()
+	name := "zrp-backup-2026-03-01T02-00-00.tar.gz"
+	os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644)
+	addTarget(t, db, "vault", KindLocal, LocalConfig{Path: t.TempDir()}, true)
+
+	t.Setenv(PassphraseEnv, "")
+	u := &Uploader{DB: db, Dir: dir}
+	u.Enqueue(name)
+	u.ProcessPending(context.Background())
+	s := mustStatus(t, db, name)
+	if s.Status != UploadFailed || !strings.Contains(s.Error, PassphraseEnv) || s.Attempts != 1 {
+		t.Fatalf("status = %+v, want failed for missing passphrase", s)
+	}
+
+	t.Setenv(PassphraseEnv, "from-env")
+	u.ProcessPending(context.Background())
+	if s := mustStatus(t, db, name); s.Status != UploadUploaded || s.Attempts != 2 || s.Error != "" {
+		t.Fatalf("after retry status = %+v", s)
+	}
+}
+
+func mustStatus(t *testing.T, db *sql.DB, name string) UploadStatus {
+	t.Helper()
+	statuses, err := UploadStatuses(db)
+	if err != nil || len(statuses[name]) != 1 {
+		t.Fatalf("statuses = %+v, %v", statuses, err)
+	}
+	return statuses[name][0]
+}
+
+func TestUploaderPruneAppliesPolicy(t *testing.T) {
+	db := newUploaderDB(t)
+	remote := t.TempDir()
+	tg := addTarget(t, db, "nfs", KindLocal, LocalConfig{Path: remote}, false)
+	day := time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		name := FilePrefix + day.AddDate(0, 0, -i).Format(timestampLayout) + ArchiveExt + EncryptedExt
+		os.WriteFile(filepath.Join(remote, name), []byte("x"), 0644)
+	}
+	u := &Uploader{DB: db}
+	removed, err := u.Prune(context.Background(), tg, Policy{Daily: 2})
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Fatalf("removed %v, want 3", removed)
+	}
+	entries, _ := os.ReadDir(remote)
+	if len(entries) != 2 {
+		t.Fatalf("%d backups left, want 2", len(entries))
+	}
+}
+
+func TestMaskAndMergeSecrets(t *testing.T) {
+	stored := json.RawMessage(`{"host":"h","password":"pw","secret_key":"sk"}`)
+	masked := MaskSecrets(stored)
+	if strings.Contains(string(masked), "pw") || strings.Contains(string(masked), `"sk"`) {
+		t.Fatalf("secrets leaked: %s", masked)
+	}
+	merged := MergeSecrets(json.RawMessage(`{"host":"h2","password":"********","secret_key":"new"}`), stored)
+	var m map[string]string
+	json.Unmarshal(merged, &m)
+	if m["host"] != "h2" || m["password"] != "pw" || m["secret_key"] != "new" {
+		t.Fatalf("merged = %v", m)
+	}
+}
@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalidBackup is wrapped by Restore when the backup fails verification.
+// Nothing live has been touched in that case.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// RestoreOptions describes the live files a restore replaces.
+type RestoreOptions struct {
+	// Backup is the archive (or legacy .db backup) to restore.
+	Backup string
+	// DBPath is the live database file.
+	DBPath string
+	// UploadsDir is the live attachments directory. Left alone if empty or
+	// if the backup contains no uploads.
+	UploadsDir string
+	// Close closes every connection to DBPath before files are swapped.
+	Close func() error
+	// Reopen opens DBPath again after the swap (and after a rollback).
+	Reopen func(path string) error
+}
+
+// Restore replaces the live database and uploads with the contents of a
+// backup. The backup is unpacked and verified (checksums and PRAGMA
+// integrity_check) before anything live is touched; the connection pool is
+// then closed, files are swapped with renames, and the database reopened.
+// If the swap or reopen fails, the previous files are put back.
+//
+// The returned manifest is nil for legacy .db backups.
+func Restore(opts RestoreOptions) (*Manifest, error) {
+	staging, err := os.MkdirTemp(filepath.Dir(opts.DBPath), ".zrp-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging dir: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	var manifest *Manifest
+	stagedDB := filepath.Join(staging, DatabaseName)
+	if IsArchive(opts.Backup) {
+		if manifest, err = Extract(opts.Backup, staging); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+	} else if err := copyFile(opts.Backup, stagedDB); err != nil {
+		return nil, fmt.Errorf("stage backup: %w", err)
+	}
+	if err := CheckIntegrity(stagedDB); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	stagedUploads := filepath.Join(staging, filepath.FromSlash(UploadsPrefix))
+	swapUploads := opts.UploadsDir != "" && manifest != nil && exists(stagedUploads)
+
+	if opts.Close != nil {
+		if err := opts.Close(); err != nil {
+			return nil, fmt.Errorf("close database: %w", err)
+		}
+	}
+
+	suffix := ".pre-restore-" + time.Now().Format(timestampLayout)
+	var moves [][2]string
+	var aside []string
+	move := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		moves = append(moves, [2]string{from, to})
+		return nil
+	}
+	rollback := func(cause error) error {
+		for i := len(moves) - 1; i >= 0; i-- {
+			os.Rename(moves[i][1], moves[i][0])
+		}
+		if opts.Reopen != nil {
+			if err := opts.Reopen(opts.DBPath); err != nil {
+				return fmt.Errorf("restore failed (%v) and reopening the previous database failed: %w", cause, err)
+			}
+		}
+		return fmt.Errorf("restore failed, previous data kept: %w", cause)
+	}
+
+	// Move the live database aside together with its WAL and shared-memory
+	// files so they are not replayed into the restored database.
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		live := opts.DBPath + ext
+		if !exists(live) {
+			continue
+		}
+		if err := move(live, live+suffix); err != nil {
+			return nil, rollback(err)
+		}
+		aside = append(aside, live+suffix)
+	}
+	if err := move(stagedDB, opts.DBPath); err != nil {
+		return nil, rollback(err)
+	}
+	if swapUploads {
+		if exists(opts.UploadsDir) {
+			if err := move(opts.UploadsDir, opts.UploadsDir+suffix); err != nil {
+				return nil, rollback(err)
+			}
+			aside = append(aside, opts.UploadsDir+suffix)
+		}
+		if err := move(stagedUploads, opts.UploadsDir); err != nil {
+			return nil, rollback(err)
+		}
+	}
+
+	if opts.Reopen != nil {
+		if err := opts.Reopen(opts.DBPath); err != nil {
+			if opts.Close != nil {
+				opts.Close()
+			}
+			return nil, rollback(err)
+		}
+	}
+
+	for _, p := range aside {
+		os.RemoveAll(p)
+	}
+	return manifest, nil
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Policy is a grandfather-father-son retention policy: keep the newest
+// backup of each of the last Daily days, Weekly ISO weeks, Monthly months
+// and Yearly years. A zero count disables that tier.
+type Policy struct {
+	Daily   int `json:"daily"`
+	Weekly  int `json:"weekly"`
+	Monthly int `json:"monthly"`
+	Yearly  int `json:"yearly"`
+}
+
+// DefaultPolicy is used when no retention settings are stored.
+var DefaultPolicy = Policy{Daily: 7, Weekly: 4, Monthly: 12, Yearly: 3}
+
+// Item is a backup considered for retention.
+type Item struct {
+	Name string
+	Time time.Time
+}
+
+var policySettings = []struct {
+	key string
+	get func(*Policy) *int
+}{
+	{"backup_retention_daily", func(p *Policy) *int { return &p.Daily }},
+	{"backup_retention_weekly", func(p *Policy) *int { return &p.Weekly }},
+	{"backup_retention_monthly", func(p *Policy) *int { return &p.Monthly }},
+	{"backup_retention_yearly", func(p *Policy) *int { return &p.Yearly }},
+}
+
+// LoadPolicy reads the retention policy from app_settings, falling back to
+// DefaultPolicy for any tier that is not set.
+func LoadPolicy(db *sql.DB) Policy {
+	p := DefaultPolicy
+	for _, s := range policySettings {
+		var val string
+		if err := db.QueryRow("SELECT value FROM app_settings WHERE key = ?", s.key).Scan(&val); err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			*s.get(&p) = n
+		}
+	}
+	return p
+}
+
+// SavePolicy stores the retention policy in app_settings.
+func SavePolicy(db *sql.DB, p Policy) error {
+	for _, s := range policySettings {
+		n := *s.get(&p)
+		if n < 0 {
+			return fmt.Errorf("%s must not be negative", s.key)
+		}
+		if _, err := db.Exec(`INSERT INTO app_settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, s.key, strconv.Itoa(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expired returns the names of the backups the policy does not keep. The
+// newest backup is always kept.
+func Expired(items []Item, p Policy) []string {
+	sorted := append([]Item(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+
+	tiers := []struct {
+		keep int
+		key  func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	keep := make(map[string]bool)
+	if len(sorted) > 0 {
+		keep[sorted[0].Name] = true
+	}
+	for _, tier := range tiers {
+		periods := make(map[string]bool)
+		for _, it := range sorted {
+			if len(periods) >= tier.keep {
+				break
+			}
+			k := tier.key(it.Time)
+			if periods[k] {
+				continue
+			}
+			periods[k] = true
+			keep[it.Name] = true
+		}
+	}
+
+	var expired []string
+	for _, it := range sorted {
+		if !keep[it.Name] {
+			expired = append(expired, it.Name)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPConfig configures an SFTP destination. Either Password or PrivateKey
+// (PEM, optionally protected by KeyPassphrase) is required. HostKey is the
+// server's SHA256 fingerprint as printed by ssh-keygen -lf, e.g.
+// "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+type SFTPConfig struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	User          string `json:"user"`
+	Password      string `json:"password,omitempty"`
+	PrivateKey    string `json:"private_key,omitempty"`
+	KeyPassphrase string `json:"key_passphrase,omitempty"`
+	HostKey       string `json:"host_key"`
+	Path          string `json:"path"`
+}
+
+// SFTP stores backups on an SFTP server. Each operation opens its own SSH
+// connection; backups are infrequent and this avoids stale sessions.
+type SFTP struct {
+	cfg SFTPConfig
+	ssh *ssh.ClientConfig
+}
+
+// NewSFTP returns an SFTP destination.
+func NewSFTP(c SFTPConfig) (*SFTP, error) {
+	if c.Host == "" || c.User == "" {
+		return nil, fmt.Errorf("host and user are required")
+	}
+	if c.HostKey == "" {
+		return nil, fmt.Errorf("host_key fingerprint is required")
+	}
+	if c.Port == 0 {
+		c.Port = 22
+	}
+	if c.Path == "" {
+		c.Path = "."
+	}
+	var auth []ssh.AuthMethod
+	if c.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if c.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(c.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("password or private_key is required")
+	}
+	want := c.HostKey
+	return &SFTP{cfg: c, ssh: &ssh.ClientConfig{
+		User: c.User,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != want {
+				return fmt.Errorf("host key mismatch: server presented %s", got)
+			}
+			return nil
+		},
+		Timeout: 30 * time.Second,
+	}}, nil
+}
+
+func (s *SFTP) remotePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return path.Join(s.cfg.Path, name), nil
+}
+
+// sftpConn is an SFTP client and the SSH connection it runs over.
+type sftpConn struct {
+	*sftp.Client
+	ssh  *ssh.Client
+	stop func() bool
+}
+
+func (c *sftpConn) Close() error {
+	c.stop()
+	err := c.Client.Close()
+	c.ssh.Close()
+	return err
+}
+
+// dial opens an SFTP session. Cancelling ctx closes it.
+func (s *SFTP) dial(ctx context.Context) (*sftpConn, error) {
+	addr := net.JoinHostPort(s.cfg.Host, fmt.Sprint(s.cfg.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, s.ssh)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(sc, chans, reqs)
+	fs, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	return &sftpConn{Client: fs, ssh: client, stop: context.AfterFunc(ctx, func() { client.Close() })}, nil
+}
+
+// session runs fn with an open SFTP session.
+func (s *SFTP) session(ctx context.Context, fn func(*sftpConn) error) error {
+	c, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return fn(c)
+}
+
+func (s *SFTP) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	dest, err := s.remotePath(name)
+	if err != nil {
+		return err
+	}
+	return s.session(ctx, func(c *sftpConn) error {
+		if err := c.MkdirAll(s.cfg.Path); err != nil {
+			return err
+		}
+		tmp := dest + ".part"
+		f, err := c.Create(tmp)
+		if err != nil {
+			return err
+		}
+		if _, err := f.ReadFrom(r); err != nil {
+			f.Close()
+			c.Remove(tmp)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			c.Remove(tmp)
+			return err
+		}
+		if err := c.PosixRename(tmp, dest); err == nil {
+			return nil
+		}
+		// Servers without posix-rename refuse to replace the target.
+		if err := c.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return c.Rename(tmp, dest)
+	})
+}
+
+// Get streams the object; the session stays open until the reader is
+// closed.
+func (s *SFTP) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	src, err := s.remotePath(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.Open(src)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &sftpReader{File: f, conn: c}, nil
+}
+
+// sftpReader is a remote file that closes its session when closed.
+type sftpReader struct {
+	*sftp.File
+	conn *sftpConn
+}
+
+func (r *sftpReader) Close() error {
+	err := r.File.Close()
+	if cerr := r.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *SFTP) List(ctx context.Context) ([]RemoteObject, error) {
+	var out []RemoteObject
+	err := s.session(ctx, func(c *sftpConn) error {
+		entries, err := c.ReadDir(s.cfg.Path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, e := range entries {
+			if e.Mode().IsRegular() && strings.HasPrefix(e.Name(), FilePrefix) && !strings.HasSuffix(e.Name(), ".part") {
+				out = append(out, RemoteObject{Name: e.Name(), Size: e.Size(), ModTime: e.ModTime()})
+			}
+		}
+		return nil
+	})
+	sortObjects(out)
+	return out, err
+}
+
+func (s *SFTP) Delete(ctx context.Context, name string) error {
+	p, err := s.remotePath(name)
+	if err != nil {
+		return err
+	}
+	return s.session(ctx, func(c *sftpConn) error { return c.Remove(p) })
+}
@@ -0,0 +1,498 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zrp/internal/models"
+)
+
+// MPNFields are the column names, matched case-insensitively, that hold a
+// manufacturer part number.
+var MPNFields = []string{"mpn", "manufacturer_part_number"}
+
+// Catalog is an indexed, in-memory view of a gitplm parts directory: CSV
+// files at the top level and one level down in category directories.
+//
+// Without a running Watch every read checks the directory for changed
+// files first, so results always match the disk. With Watch running, reads
+// are served from memory and changes are picked up on each poll or after
+// Invalidate. Only files whose size, modification time or inode changed are
+// re-read.
+type Catalog struct {
+	dir string
+
+	refreshMu sync.Mutex // serialises Refresh
+	dirty     atomic.Bool
+	reindex   atomic.Bool // rebuild on the next Refresh even if no file changed
+	loaded    atomic.Bool
+	watching  atomic.Int32
+
+	mu       sync.RWMutex
+	files    []*file // scan order
+	byPath   map[string]*file
+	byName   map[string]*file // "<name>.csv" base name, top level first
+	byIPN    map[string]*entry
+	entries  []*entry // first occurrence of each IPN, scan order
+	category map[string][]*entry
+	values   map[string]map[string][]*entry // lower field -> lower value
+	gen      uint64
+	err      error
+	loadedAt time.Time
+
+	prefixMu sync.Mutex
+	prefixes []string // assembly IPN prefixes, upper-cased
+}
+
+type file struct {
+	path     string
+	category string
+	topLevel bool
+	info     os.FileInfo
+	parts    []models.Part
+	headers  []string
+	title    string
+	records  [][]string
+	err      error
+}
+
+type entry struct {
+	part models.Part
+	ipn  string // lower-cased IPN
+	text string // lower-cased IPN and field values, NUL separated
+}
+
+// New returns a catalog for dir. Nothing is read until first use.
+func New(dir string) *Catalog {
+	return &Catalog{dir: dir}
+}
+
+// Dir returns the parts directory.
+func (c *Catalog) Dir() string { return c.dir }
+
+// Generation returns a counter that increases every time the catalog's
+// contents change. Callers can cache derived data against it.
+func (c *Catalog) Generation() uint64 {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.gen
+}
+
+// LoadedAt returns when the contents last changed.
+func (c *Catalog) LoadedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loadedAt
+}
+
+// Invalidate makes the next read rescan the directory. Writers call it
+// after changing a CSV so a watching catalog does not serve stale data.
+func (c *Catalog) Invalidate() { c.dirty.Store(true) }
+
+// SetAssemblyPrefixes sets the IPN prefixes, matched case-insensitively,
+// that mark a file as an assembly's BOM even when no part of that name is
+// defined. The indexes are rebuilt on the next read if the prefixes changed.
+func (c *Catalog) SetAssemblyPrefixes(prefixes []string) {
+	upper := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		upper[i] = strings.ToUpper(p)
+	}
+	c.prefixMu.Lock()
+	defer c.prefixMu.Unlock()
+	if slices.Equal(c.prefixes, upper) {
+		return
+	}
+	c.prefixes = upper
+	c.reindex.Store(true)
+	c.dirty.Store(true)
+}
+
+func (c *Catalog) assemblyPrefixes() []string {
+	c.prefixMu.Lock()
+	defer c.prefixMu.Unlock()
+	return c.prefixes
+}
+
+func (c *Catalog) ensure() {
+	if c.loaded.Load() && c.watching.Load() > 0 && !c.dirty.Load() {
+		return
+	}
+	c.Refresh()
+}
+
+// Watch polls the directory every interval until ctx is done. While it runs
+// reads no longer stat the directory themselves.
+func (c *Catalog) Watch(ctx context.Context, interval time.Duration) {
+	c.Refresh()
+	c.watching.Add(1)
+	defer c.watching.Add(-1)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.Refresh()
+		}
+	}
+}
+
+// Refresh rescans the directory, re-reads changed files and rebuilds the
+// indexes if anything changed. The error is that of reading the directory;
+// files that fail to parse are skipped.
+func (c *Catalog) Refresh() error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.dirty.Store(false)
+
+	paths, topLevel, err := c.scan()
+	changed := c.reindex.Swap(false) || !c.loaded.Load() || (err != nil) != (c.err != nil) || len(paths) != len(c.byPath)
+	files := make([]*file, 0, len(paths))
+	for i, p := range paths {
+		info, serr := os.Stat(p)
+		if serr != nil {
+			changed = true
+			continue
+		}
+		if old := c.byPath[p]; old != nil && sameFile(old.info, info) {
+			files = append(files, old)
+			continue
+		}
+		changed = true
+		files = append(files, c.load(p, info, topLevel[i]))
+	}
+	if changed {
+		c.rebuild(files, err)
+	}
+	c.loaded.Store(true)
+	return err
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime()) && os.SameFile(a, b)
+}
+
+// scan lists the CSV files in the same order LoadPartsFromDir always has:
+// directory entries by name, and the files inside a category directory by
+// name.
+func (c *Catalog) scan() ([]string, []bool, error) {
+	if c.dir == "" {
+		return nil, nil, nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var paths []string
+	var top []bool
+	for _, e := range entries {
+		if e.IsDir() {
+			csvFiles, _ := filepath.Glob(filepath.Join(c.dir, e.Name(), "*.csv"))
+			for _, p := range csvFiles {
+				paths = append(paths, p)
+				top = append(top, false)
+			}
+		} else if strings.HasSuffix(e.Name(), ".csv") {
+			paths = append(paths, filepath.Join(c.dir, e.Name()))
+			top = append(top, true)
+		}
+	}
+	return paths, top, nil
+}
+
+func (c *Catalog) load(path string, info os.FileInfo, topLevel bool) *file {
+	f := &file{path: path, info: info, topLevel: topLevel}
+	if topLevel {
+		f.category = strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".csv"))
+	} else {
+		f.category = strings.ToLower(filepath.Base(filepath.Dir(path)))
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		f.err = err
+		return f
+	}
+	f.parts, f.headers, f.title, f.records, f.err = ParseCSV(content, f.category)
+	return f
+}
+
+func (c *Catalog) rebuild(files []*file, err error) {
+	byPath := make(map[string]*file, len(files))
+	byName := make(map[string]*file)
+	byIPN := make(map[string]*entry)
+	var entries []*entry
+	category := make(map[string][]*entry)
+	values := make(map[string]map[string][]*entry)
+
+	for _, f := range files {
+		byPath[f.path] = f
+	}
+	for _, top := range []bool{true, false} {
+		for _, f := range files {
+			name := filepath.Base(f.path)
+			if f.topLevel == top && f.err == nil && byName[name] == nil {
+				byName[name] = f
+			}
+		}
+	}
+	// A file named after a part, or with a configured assembly prefix, is
+	// that assembly's BOM. Its rows repeat parts defined elsewhere, so BOMs
+	// are indexed last and never shadow the defining row.
+	ipns := make(map[string]bool)
+	for _, f := range files {
+		for _, p := range f.parts {
+			ipns[p.IPN] = true
+		}
+	}
+	prefixes := c.assemblyPrefixes()
+	isBOM := func(f *file) bool {
+		name := strings.TrimSuffix(filepath.Base(f.path), ".csv")
+		if ipns[name] {
+			return true
+		}
+		upper := strings.ToUpper(name)
+		for _, p := range prefixes {
+			if strings.HasPrefix(upper, p) {
+				return true
+			}
+		}
+		return false
+	}
+	var ordered []*file
+	for _, bom := range []bool{false, true} {
+		for _, f := range files {
+			if f.err == nil && isBOM(f) == bom {
+				ordered = append(ordered, f)
+			}
+		}
+	}
+	for _, f := range ordered {
+		for _, p := range f.parts {
+			if byIPN[p.IPN] != nil {
+				continue
+			}
+			e := &entry{part: p, ipn: strings.ToLower(p.IPN), text: searchText(p)}
+			byIPN[p.IPN] = e
+			entries = append(entries, e)
+			category[f.category] = append(category[f.category], e)
+			for k, v := range p.Fields {
+				if v == "" || strings.HasPrefix(k, "_") {
+					continue
+				}
+				k, v = strings.ToLower(k), strings.ToLower(strings.TrimSpace(v))
+				if values[k] == nil {
+					values[k] = make(map[string][]*entry)
+				}
+				values[k][v] = append(values[k][v], e)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.files, c.byPath, c.byName = files, byPath, byName
+	c.byIPN, c.entries, c.category, c.values = byIPN, entries, category, values
+	c.err = err
+	c.gen++
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+}
+
+func searchText(p models.Part) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(p.IPN))
+	for _, v := range p.Fields {
+		b.WriteByte(0)
+		b.WriteString(strings.ToLower(v))
+	}
+	return b.String()
+}
+
+// copyPart returns p with its own fields map, so callers may modify it.
+func copyPart(p models.Part) models.Part {
+	fields := make(map[string]string, len(p.Fields))
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	return models.Part{IPN: p.IPN, Fields: fields}
+}
+
+func copyEntries(es []*entry) []models.Part {
+	out := make([]models.Part, len(es))
+	for i, e := range es {
+		out[i] = copyPart(e.part)
+	}
+	return out
+}
+
+// Get returns the part with the given IPN. If several files list the IPN
+// the first in scan order wins.
+func (c *Catalog) Get(ipn string) (models.Part, bool) {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e := c.byIPN[ipn]
+	if e == nil {
+		return models.Part{}, false
+	}
+	return copyPart(e.part), true
+}
+
+// Lookup returns the parts whose field equals value. Both are matched
+// case-insensitively.
+func (c *Catalog) Lookup(field, value string) []models.Part {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyEntries(c.values[strings.ToLower(field)][strings.ToLower(strings.TrimSpace(value))])
+}
+
+// ByMPN returns the parts carrying a manufacturer part number.
+func (c *Catalog) ByMPN(mpn string) []models.Part {
+	var out []models.Part
+	seen := map[string]bool{}
+	for _, f := range MPNFields {
+		for _, p := range c.Lookup(f, mpn) {
+			if !seen[p.IPN] {
+				seen[p.IPN] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// Category returns the parts in a category.
+func (c *Catalog) Category(id string) []models.Part {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyEntries(c.category[strings.ToLower(id)])
+}
+
+// Search returns up to limit parts whose IPN or any field value contains q,
+// case-insensitively. A limit below 1 returns every match.
+func (c *Catalog) Search(q string, limit int) []models.Part {
+	q = strings.ToLower(q)
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []models.Part
+	for _, e := range c.entries {
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if strings.Contains(e.text, q) {
+			out = append(out, copyPart(e.part))
+		}
+	}
+	return out
+}
+
+// SearchIPN returns up to limit parts whose IPN contains q,
+// case-insensitively, with an exact match first. A limit below 1 returns
+// every match.
+func (c *Catalog) SearchIPN(q string, limit int) []models.Part {
+	q = strings.ToLower(q)
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []models.Part
+	for _, exact := range []bool{true, false} {
+		for _, e := range c.entries {
+			if limit > 0 && len(out) >= limit {
+				return out
+			}
+			if exact && e.ipn == q || !exact && e.ipn != q && strings.Contains(e.ipn, q) {
+				out = append(out, copyPart(e.part))
+			}
+		}
+	}
+	return out
+}
+
+// Len returns the number of distinct IPNs.
+func (c *Catalog) Len() int {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Parts returns the parts per category, the columns per category and the
+// category titles, in the shape of the parts handler's LoadPartsFromDir.
+// Every row is returned, including IPNs repeated across files.
+func (c *Catalog) Parts() (map[string][]models.Part, map[string][]string, map[string]string, error) {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	categories := make(map[string][]models.Part)
+	schemas := make(map[string][]string)
+	titles := make(map[string]string)
+	for _, f := range c.files {
+		if f.err != nil {
+			continue
+		}
+		ps := categories[f.category]
+		for _, p := range f.parts {
+			ps = append(ps, copyPart(p))
+		}
+		categories[f.category] = ps
+		if f.topLevel || len(f.headers) > len(schemas[f.category]) {
+			schemas[f.category] = f.headers
+		}
+		if f.title != "" {
+			titles[f.category] = f.title
+		}
+	}
+	return categories, schemas, titles, c.err
+}
+
+// Records returns the rows of the CSV named "<name>.csv", header first,
+// such as an assembly's BOM. A top-level file wins over one in a category
+// directory. The returned slices must not be modified.
+func (c *Catalog) Records(name string) ([][]string, bool) {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f := c.byName[name+".csv"]
+	if f == nil {
+		return nil, false
+	}
+	return f.records, true
+}
+
+// Path returns the path of the CSV named "<name>.csv", picked the same way
+// as Records.
+func (c *Catalog) Path(name string) (string, bool) {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f := c.byName[name+".csv"]
+	if f == nil {
+		return "", false
+	}
+	return f.path, true
+}
+
+// Names returns the base names, without ".csv", of every CSV in the
+// catalog, such as the parts files and assembly BOMs, sorted.
+func (c *Catalog) Names() []string {
+	c.ensure()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]string, 0, len(c.byName))
+	for name := range c.byName {
+		out = append(out, strings.TrimSuffix(name, ".csv"))
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "resistors.csv"), "# TITLE: Resistors\nIPN,description,mpn\nRES-001,10k 0603,RC0603FR-0710KL\nRES-002,1k 0603,RC0603FR-071KL\n")
+	writeFile(t, filepath.Join(dir, "caps", "ceramic.csv"), "IPN,description,MPN,voltage\nCAP-001,100nF 0402,GRM155R71C104KA88D,16V\n")
+	writeFile(t, filepath.Join(dir, "assemblies", "PCA-100.csv"), "IPN,qty,ref\nRES-001,2,R1 R2\nCAP-001,1,C1\n")
+	return dir
+}
+
+// newTestCatalog returns a catalog of dir that treats PCA- files as BOMs.
+func newTestCatalog(dir string) *Catalog {
+	c := New(dir)
+	c.SetAssemblyPrefixes([]string{"PCA-"})
+	return c
+}
+
+func TestCatalogIndexes(t *testing.T) {
+	c := newTestCatalog(setupDir(t))
+
+	p, ok := c.Get("RES-002")
+	if !ok || p.Fields["description"] != "1k 0603" || p.Fields["_category"] != "resistors" {
+		t.Fatalf("Get = %+v, %v", p, ok)
+	}
+	// The BOM lists RES-001 too, but the defining row wins.
+	if p, _ := c.Get("RES-001"); p.Fields["_category"] != "resistors" {
+		t.Errorf("RES-001 resolved from %q", p.Fields["_category"])
+	}
+	if ps := c.ByMPN("grm155r71c104ka88d"); len(ps) != 1 || ps[0].IPN != "CAP-001" {
+		t.Errorf("ByMPN = %+v", ps)
+	}
+	if ps := c.Lookup("Voltage", "16v"); len(ps) != 1 || ps[0].IPN != "CAP-001" {
+		t.Errorf("Lookup = %+v", ps)
+	}
+	if ps := c.Category("RESISTORS"); len(ps) != 2 {
+		t.Errorf("Category = %+v", ps)
+	}
+	if ps := c.Search("0603", 0); len(ps) != 2 {
+		t.Errorf("Search = %+v", ps)
+	}
+	if ps := c.Search("0603", 1); len(ps) != 1 {
+		t.Errorf("Search with limit = %+v", ps)
+	}
+	if ps := c.SearchIPN("res-00", 0); len(ps) != 2 {
+		t.Errorf("SearchIPN = %+v", ps)
+	}
+
+	cats, schemas, titles, err := c.Parts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats["resistors"]) != 2 || len(cats["caps"]) != 1 || titles["resistors"] != "Resistors" || len(schemas["caps"]) != 4 {
+		t.Errorf("Parts = %v %v %v", cats, schemas, titles)
+	}
+
+	recs, ok := c.Records("PCA-100")
+	if !ok || len(recs) != 3 || recs[2][0] != "CAP-001" {
+		t.Errorf("Records = %v, %v", recs, ok)
+	}
+}
+
+func TestCatalogAssemblyPrefixes(t *testing.T) {
+	c := New(setupDir(t))
+
+	// No part is named PCA-100 and no prefix is configured, so its rows
+	// are indexed in scan order like any parts file.
+	if p, _ := c.Get("RES-001"); p.Fields["_category"] != "assemblies" {
+		t.Errorf("without prefixes RES-001 resolved from %q", p.Fields["_category"])
+	}
+
+	c.SetAssemblyPrefixes([]string{"pca-"})
+	if p, _ := c.Get("RES-001"); p.Fields["_category"] != "resistors" {
+		t.Errorf("with PCA- prefix RES-001 resolved from %q", p.Fields["_category"])
+	}
+}
+
+func TestCatalogReturnsCopies(t *testing.T) {
+	c := newTestCatalog(setupDir(t))
+	p, _ := c.Get("RES-001")
+	p.Fields["description"] = "changed"
+	if p, _ := c.Get("RES-001"); p.Fields["description"] != "10k 0603" {
+		t.Errorf("catalog data was modified through a returned part")
+	}
+}
+
+func TestCatalogRefreshesChangedFilesOnly(t *testing.T) {
+	dir := setupDir(t)
+	c := newTestCatalog(dir)
+	gen := c.Generation()
+	if gen == 0 {
+		t.Fatal("generation should be set after the first load")
+	}
+	if c.Generation() != gen {
+		t.Fatal("generation changed without any file changing")
+	}
+
+	before := c.byPath[filepath.Join(dir, "caps", "ceramic.csv")]
+	writeFile(t, filepath.Join(dir, "resistors.csv"), "IPN,description,mpn\nRES-001,10k 1% 0603,RC0603FR-0710KL\n")
+	if p, _ := c.Get("RES-001"); p.Fields["description"] != "10k 1% 0603" {
+		t.Errorf("edit not picked up: %+v", p)
+	}
+	if _, ok := c.Get("RES-002"); ok {
+		t.Error("removed row still present")
+	}
+	if c.Generation() <= gen {
+		t.Error("generation did not advance")
+	}
+	if c.byPath[filepath.Join(dir, "caps", "ceramic.csv")] != before {
+		t.Error("unchanged file was re-read")
+	}
+
+	os.Remove(filepath.Join(dir, "caps", "ceramic.csv"))
+	if ps := c.Category("caps"); len(ps) != 0 {
+		t.Errorf("parts from deleted file still present: %+v", ps)
+	}
+	if ps := c.ByMPN("GRM155R71C104KA88D"); len(ps) != 0 {
+		t.Errorf("MPN index still lists deleted part: %+v", ps)
+	}
+}
+
+func TestCatalogWatch(t *testing.T) {
+	dir := setupDir(t)
+	c := newTestCatalog(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Watch(ctx, 20*time.Millisecond)
+	for c.watching.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	gen := c.Generation()
+
+	writeFile(t, filepath.Join(dir, "diodes.csv"), "IPN,description\nDIO-001,1N4148\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Generation() == gen {
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not pick up the new file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := c.Get("DIO-001"); !ok {
+		t.Error("new part not indexed")
+	}
+}
+
+func TestCatalogInvalidate(t *testing.T) {
+	dir := setupDir(t)
+	c := newTestCatalog(dir)
+	c.Refresh()
+	// Pretend a watcher is running with a long interval.
+	c.watching.Add(1)
+	defer c.watching.Add(-1)
+
+	writeFile(t, filepath.Join(dir, "diodes.csv"), "IPN,description\nDIO-001,1N4148\n")
+	if _, ok := c.Get("DIO-001"); ok {
+		t.Fatal("watching catalog rescanned without a poll or invalidation")
+	}
+	c.Invalidate()
+	if _, ok := c.Get("DIO-001"); !ok {
+		t.Error("invalidated catalog did not rescan")
+	}
+}
+
+func TestCatalogEmptyDir(t *testing.T) {
+	c := New("")
+	cats, _, _, err := c.Parts()
+	if err != nil || len(cats) != 0 {
+		t.Errorf("Parts = %v, %v", cats, err)
+	}
+	if _, _, _, err := New(filepath.Join(t.TempDir(), "missing")).Parts(); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"zrp/internal/models"
+)
+
+// IsIPNHeader reports whether a CSV column holds the part number.
+func IsIPNHeader(h string) bool {
+	hl := strings.ToLower(h)
+	return hl == "ipn" || hl == "part_number" || hl == "pn"
+}
+
+// ParseCSV parses the content of a gitplm CSV. An optional first line of
+// the form "# TITLE: <title>" names the category. Returns the parts, the
+// header row, the title and all records including the header.
+func ParseCSV(content []byte, category string) ([]models.Part, []string, string, [][]string, error) {
+	title := ""
+	lines := strings.Split(string(content), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# TITLE:") {
+		title = strings.TrimSpace(strings.TrimPrefix(lines[0], "# TITLE:"))
+		content = []byte(strings.Join(lines[1:], "\n"))
+	}
+
+	r := csv.NewReader(strings.NewReader(string(content)))
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	if len(records) < 1 {
+		return nil, nil, "", nil, fmt.Errorf("empty csv")
+	}
+
+	headers := records[0]
+	var parts []models.Part
+	for _, row := range records[1:] {
+		fields := make(map[string]string)
+		ipn := ""
+		for i, hdr := range headers {
+			if i < len(row) {
+				fields[hdr] = row[i]
+				if IsIPNHeader(hdr) {
+					ipn = row[i]
+				}
+			}
+		}
+		fields["_category"] = category
+		if ipn == "" {
+			ipn = fields[headers[0]]
+		}
+		if ipn != "" {
+			parts = append(parts, models.Part{IPN: ipn, Fields: fields})
+		}
+	}
+	return parts, headers, title, records, nil
+}
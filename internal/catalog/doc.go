@@ -0,0 +1,3 @@
+// Package catalog keeps an in-memory, indexed copy of the gitplm parts
+// directory and refreshes it incrementally as CSV files change on disk.
+package catalog
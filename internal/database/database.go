@@ -442,6 +442,7 @@ func RunMigrations(db *sql.DB, searchTableInit func(*sql.DB) error) error {
 			stock_qty INTEGER DEFAULT 0, lead_time_days INTEGER DEFAULT 0,
 			currency TEXT DEFAULT 'USD', price_breaks TEXT DEFAULT '[]',
 			product_url TEXT DEFAULT '', datasheet_url TEXT DEFAULT '',
+			lifecycle_status TEXT DEFAULT '',
 			fetched_at TEXT NOT NULL,
 			UNIQUE(part_ipn, distributor)
 		)`,
@@ -516,6 +517,314 @@ func RunMigrations(db *sql.DB, searchTableInit func(*sql.DB) error) error {
 		FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
 	)`)
 
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT '', url TEXT NOT NULL,
+		secret TEXT NOT NULL DEFAULT '', events TEXT NOT NULL DEFAULT '["*"]',
+		enabled INTEGER DEFAULT 1, created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL, event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','delivered','dead')),
+		attempts INTEGER DEFAULT 0, next_attempt_at DATETIME,
+		response_code INTEGER DEFAULT 0, response_body TEXT DEFAULT '',
+		last_error TEXT DEFAULT '', redelivery_of INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP, delivered_at DATETIME,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS backup_targets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		kind TEXT NOT NULL CHECK(kind IN ('local','sftp','s3')),
+		config TEXT NOT NULL DEFAULT '{}',
+		encrypt INTEGER DEFAULT 0, enabled INTEGER DEFAULT 1,
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS backup_uploads (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target_id INTEGER NOT NULL, filename TEXT NOT NULL,
+		remote_name TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','uploaded','failed')),
+		attempts INTEGER DEFAULT 0, error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		started_at DATETIME, uploaded_at DATETIME,
+		UNIQUE(target_id, filename),
+		FOREIGN KEY (target_id) REFERENCES backup_targets(id) ON DELETE CASCADE
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS cost_rolls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		assembly_ipn TEXT NOT NULL, period TEXT NOT NULL,
+		method TEXT NOT NULL, build_qty REAL NOT NULL DEFAULT 1 CHECK(build_qty > 0),
+		total_cost REAL DEFAULT 0, unit_cost REAL DEFAULT 0,
+		missing_count INTEGER DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'draft' CHECK(status IN ('draft','frozen')),
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		frozen_by TEXT DEFAULT '', frozen_at DATETIME
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS cost_roll_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		roll_id INTEGER NOT NULL, ipn TEXT NOT NULL,
+		description TEXT DEFAULT '', qty REAL NOT NULL DEFAULT 0,
+		buy_qty REAL NOT NULL DEFAULT 0, unit_cost REAL,
+		ext_cost REAL DEFAULT 0, source TEXT DEFAULT '',
+		FOREIGN KEY (roll_id) REFERENCES cost_rolls(id) ON DELETE CASCADE
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS part_lifecycle_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ipn TEXT NOT NULL, from_state TEXT DEFAULT '', to_state TEXT NOT NULL,
+		reason TEXT DEFAULT '', changed_by TEXT DEFAULT '',
+		changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS part_obsolescence (
+		ipn TEXT PRIMARY KEY,
+		status TEXT DEFAULT '' CHECK(status IN ('','prototype','active','nrnd','last_time_buy','obsolete')),
+		ltb_date TEXT DEFAULT '', eol_date TEXT DEFAULT '',
+		replacement_ipn TEXT DEFAULT '', source TEXT DEFAULT 'manual',
+		source_detail TEXT DEFAULT '', notes TEXT DEFAULT '',
+		updated_by TEXT DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS ipn_schemes (
+		category TEXT PRIMARY KEY, prefix TEXT NOT NULL DEFAULT '',
+		digits INTEGER NOT NULL DEFAULT 4 CHECK(digits BETWEEN 1 AND 12),
+		checksum TEXT DEFAULT '' CHECK(checksum IN ('','luhn')),
+		suffix TEXT DEFAULT '' CHECK(suffix IN ('','variant','revision')),
+		suffix_sep TEXT DEFAULT '-', next_seq INTEGER NOT NULL DEFAULT 1,
+		enforce INTEGER DEFAULT 0, updated_by TEXT DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS ipn_reservations (
+		ipn TEXT PRIMARY KEY, category TEXT NOT NULL, seq INTEGER NOT NULL,
+		status TEXT DEFAULT 'reserved' CHECK(status IN ('reserved','used')),
+		reserved_by TEXT DEFAULT '',
+		reserved_at DATETIME DEFAULT CURRENT_TIMESTAMP, used_at DATETIME
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS part_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ipn TEXT NOT NULL, revision TEXT NOT NULL,
+		status TEXT DEFAULT 'draft' CHECK(status IN ('draft','released','superseded','cancelled')),
+		eco_id TEXT DEFAULT '', effective_date TEXT DEFAULT '', notes TEXT DEFAULT '',
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		released_at DATETIME,
+		UNIQUE(ipn, revision)
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS part_alternates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ipn TEXT NOT NULL, alternate_ipn TEXT NOT NULL, assembly_ipn TEXT DEFAULT '',
+		priority INTEGER DEFAULT 0, notes TEXT DEFAULT '',
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(ipn, alternate_ipn, assembly_ipn)
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS wo_substitutions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		wo_id TEXT NOT NULL, serial_number TEXT DEFAULT '',
+		ipn TEXT NOT NULL, revision TEXT DEFAULT '', alternate_ipn TEXT NOT NULL,
+		qty REAL NOT NULL CHECK(qty > 0), reason TEXT DEFAULT '',
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS rma_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rma_id TEXT NOT NULL, serial_number TEXT NOT NULL, ipn TEXT DEFAULT '',
+		defect_description TEXT DEFAULT '',
+		status TEXT DEFAULT 'open' CHECK(status IN ('open','repairing','repaired','replaced','credited','scrapped')),
+		disposition TEXT DEFAULT '' CHECK(disposition IN ('','repair','replace','credit')),
+		warranty TEXT DEFAULT 'unknown' CHECK(warranty IN ('in','out','unknown')), warranty_expires TEXT DEFAULT '',
+		repair_wo_id TEXT DEFAULT '', replacement_serial TEXT DEFAULT '', advance_shipment_id TEXT DEFAULT '',
+		credit_amount REAL DEFAULT 0, notes TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(rma_id, serial_number),
+		FOREIGN KEY (rma_id) REFERENCES rmas(id) ON DELETE CASCADE
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS rma_parts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rma_id TEXT NOT NULL, line_id INTEGER DEFAULT 0, wo_id TEXT NOT NULL,
+		ipn TEXT NOT NULL, qty REAL NOT NULL CHECK(qty > 0), notes TEXT DEFAULT '',
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (rma_id) REFERENCES rmas(id) ON DELETE CASCADE
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS warranty_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ipn TEXT NOT NULL UNIQUE, term_months INTEGER NOT NULL CHECK(term_months >= 0),
+		coverage TEXT DEFAULT 'parts_labor', terms TEXT DEFAULT '',
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS service_contracts (
+		id TEXT PRIMARY KEY, customer TEXT NOT NULL, name TEXT DEFAULT '',
+		start_date TEXT NOT NULL, end_date TEXT NOT NULL,
+		coverage TEXT DEFAULT 'parts_labor', terms TEXT DEFAULT '',
+		status TEXT DEFAULT 'active' CHECK(status IN ('active','cancelled')),
+		created_by TEXT DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS service_contract_devices (
+		contract_id TEXT NOT NULL, serial_number TEXT NOT NULL,
+		PRIMARY KEY(contract_id, serial_number),
+		FOREIGN KEY (contract_id) REFERENCES service_contracts(id) ON DELETE CASCADE
+	)`)
+	// Electronic signatures are append-only: the triggers reject any
+	// change or removal.
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS e_signatures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		module TEXT NOT NULL, record_id TEXT NOT NULL,
+		meaning TEXT NOT NULL CHECK(meaning IN ('reviewed','approved','released')),
+		reason TEXT DEFAULT '',
+		user_id INTEGER NOT NULL, username TEXT NOT NULL, full_name TEXT DEFAULT '',
+		content_hash TEXT NOT NULL, signature_hash TEXT NOT NULL,
+		ip_address TEXT DEFAULT '', signed_at TEXT NOT NULL
+	)`)
+	tables = append(tables, `CREATE TRIGGER IF NOT EXISTS e_signatures_no_update BEFORE UPDATE ON e_signatures
+		BEGIN SELECT RAISE(ABORT, 'electronic signatures cannot be changed'); END`)
+	tables = append(tables, `CREATE TRIGGER IF NOT EXISTS e_signatures_no_delete BEFORE DELETE ON e_signatures
+		BEGIN SELECT RAISE(ABORT, 'electronic signatures cannot be deleted'); END`)
+
+	// Audit log checkpoints and retention archives are append-only too;
+	// the hash chain verification relies on them.
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS audit_checkpoints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL DEFAULT 'periodic',
+		last_id INTEGER NOT NULL, last_hash TEXT NOT NULL,
+		entries INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL, signature TEXT NOT NULL
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS audit_archives (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file TEXT NOT NULL,
+		first_id INTEGER NOT NULL, last_id INTEGER NOT NULL,
+		entries INTEGER NOT NULL DEFAULT 0,
+		prev_hash TEXT NOT NULL DEFAULT '', last_hash TEXT NOT NULL DEFAULT '',
+		file_sha256 TEXT NOT NULL,
+		created_at TEXT NOT NULL, signature TEXT NOT NULL
+	)`)
+	for _, t := range []string{"audit_checkpoints", "audit_archives"} {
+		tables = append(tables, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_no_update BEFORE UPDATE ON %[1]s
+		BEGIN SELECT RAISE(ABORT, '%[1]s are append-only'); END`, t))
+		tables = append(tables, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_no_delete BEFORE DELETE ON %[1]s
+		BEGIN SELECT RAISE(ABORT, '%[1]s are append-only'); END`, t))
+	}
+
+	// 8D problem-solving reports on NCRs and CAPAs.
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS eight_d (
+		id TEXT PRIMARY KEY, title TEXT NOT NULL,
+		ncr_id TEXT DEFAULT '', capa_id TEXT DEFAULT '',
+		status TEXT DEFAULT 'open' CHECK(status IN ('open','closed')),
+		current_step INTEGER DEFAULT 1,
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		closed_at DATETIME
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS eight_d_disciplines (
+		eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+		discipline INTEGER NOT NULL CHECK(discipline BETWEEN 1 AND 8),
+		content TEXT DEFAULT '',
+		completed_by TEXT DEFAULT '', completed_at DATETIME,
+		PRIMARY KEY (eight_d_id, discipline)
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS eight_d_team (
+		eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+		username TEXT NOT NULL,
+		role TEXT DEFAULT 'member' CHECK(role IN ('champion','leader','member')),
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (eight_d_id, username)
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS eight_d_causes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL CHECK(kind IN ('why','fishbone')),
+		category TEXT DEFAULT '', text TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS eight_d_actions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+		discipline INTEGER NOT NULL CHECK(discipline IN (3,5,7)),
+		description TEXT NOT NULL, owner TEXT NOT NULL, due_date TEXT NOT NULL,
+		status TEXT DEFAULT 'open' CHECK(status IN ('open','done')),
+		completed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS mrb_quarantine (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ncr_id TEXT NOT NULL REFERENCES ncrs(id) ON DELETE CASCADE,
+		ipn TEXT NOT NULL, qty REAL NOT NULL CHECK(qty > 0),
+		source TEXT NOT NULL CHECK(source IN ('receiving','hold','stock')),
+		receiving_inspection_id INTEGER,
+		po_id TEXT DEFAULT '', vendor_id TEXT DEFAULT '',
+		unit_cost REAL DEFAULT 0 CHECK(unit_cost >= 0),
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS mrb_dispositions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ncr_id TEXT NOT NULL REFERENCES ncrs(id) ON DELETE CASCADE,
+		ipn TEXT NOT NULL, qty REAL NOT NULL CHECK(qty > 0),
+		disposition TEXT NOT NULL CHECK(disposition IN ('use_as_is','rework','return_to_vendor','scrap')),
+		unit_cost REAL DEFAULT 0 CHECK(unit_cost >= 0), total_cost REAL DEFAULT 0,
+		work_order_id TEXT DEFAULT '', shipment_id TEXT DEFAULT '', vendor_id TEXT DEFAULT '',
+		notes TEXT DEFAULT '', decided_by TEXT DEFAULT '',
+		decided_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS spc_violations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chart TEXT NOT NULL CHECK(chart IN ('xbar','range','p')),
+		source TEXT NOT NULL CHECK(source IN ('tests','receiving')),
+		ipn TEXT NOT NULL, measurement TEXT DEFAULT '', test_type TEXT DEFAULT '',
+		rule INTEGER NOT NULL CHECK(rule BETWEEN 1 AND 4), description TEXT DEFAULT '',
+		value REAL, center REAL, ucl REAL, lcl REAL,
+		test_record_id INTEGER, ncr_id TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS field_report_emails (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		report_id TEXT NOT NULL,
+		direction TEXT DEFAULT 'inbound' CHECK(direction IN ('inbound','outbound')),
+		message_id TEXT DEFAULT '', in_reply_to TEXT DEFAULT '',
+		from_address TEXT NOT NULL, from_name TEXT DEFAULT '', to_address TEXT DEFAULT '',
+		subject TEXT DEFAULT '', body TEXT DEFAULT '',
+		attachment_count INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS training_requirements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		document_id TEXT NOT NULL, ipn TEXT NOT NULL,
+		activity TEXT NOT NULL CHECK(activity IN ('test','build')),
+		revision TEXT NOT NULL, valid_months INTEGER DEFAULT 0,
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(document_id, ipn, activity)
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS training_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL, document_id TEXT NOT NULL, revision TEXT NOT NULL,
+		completed_at DATE NOT NULL, expires_at DATE,
+		trainer TEXT DEFAULT '', notes TEXT DEFAULT '',
+		created_by TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	tables = append(tables, `CREATE TABLE IF NOT EXISTS training_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL, document_id TEXT NOT NULL, revision TEXT NOT NULL,
+		reason TEXT DEFAULT 'assigned' CHECK(reason IN ('assigned','revision')),
+		status TEXT DEFAULT 'open' CHECK(status IN ('open','completed','cancelled')),
+		due_date DATE, record_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME
+	)`)
+
 	for _, t := range tables {
 		if _, err := db.Exec(t); err != nil {
 			return fmt.Errorf("migration error: %w\nSQL: %s", err, t)
@@ -548,6 +857,10 @@ func RunMigrations(db *sql.DB, searchTableInit func(*sql.DB) error) error {
 		"ALTER TABLE invoices ADD COLUMN tax REAL DEFAULT 0",
 		"ALTER TABLE invoices ADD COLUMN notes TEXT DEFAULT ''",
 		"ALTER TABLE invoices RENAME COLUMN total_amount TO total",
+		"ALTER TABLE market_pricing ADD COLUMN lifecycle_status TEXT DEFAULT ''",
+		"ALTER TABLE rma_lines ADD COLUMN contract_id TEXT DEFAULT ''",
+		"ALTER TABLE field_reports ADD COLUMN warranty TEXT DEFAULT ''",
+		"ALTER TABLE field_reports ADD COLUMN contract_id TEXT DEFAULT ''",
 	}
 	for _, s := range alterStmts {
 		db.Exec(s)
@@ -558,6 +871,8 @@ func RunMigrations(db *sql.DB, searchTableInit func(*sql.DB) error) error {
 		`ALTER TABLE audit_log ADD COLUMN after_value TEXT`,
 		`ALTER TABLE audit_log ADD COLUMN ip_address TEXT`,
 		`ALTER TABLE audit_log ADD COLUMN user_agent TEXT`,
+		`ALTER TABLE audit_log ADD COLUMN prev_hash TEXT`,
+		`ALTER TABLE audit_log ADD COLUMN entry_hash TEXT`,
 	}
 	for _, migration := range auditMigrations {
 		if _, err := db.Exec(migration); err != nil {
@@ -646,6 +961,42 @@ func RunMigrations(db *sql.DB, searchTableInit func(*sql.DB) error) error {
 		"CREATE INDEX IF NOT EXISTS idx_audit_log_user_created ON audit_log(user_id, created_at)",
 		"CREATE INDEX IF NOT EXISTS idx_change_history_user_created ON change_history(user_id, created_at)",
 		"CREATE INDEX IF NOT EXISTS idx_email_log_address_sent ON email_log(to_address, sent_at)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next ON webhook_deliveries(status, next_attempt_at)",
+		"CREATE INDEX IF NOT EXISTS idx_backup_uploads_filename ON backup_uploads(filename)",
+		"CREATE INDEX IF NOT EXISTS idx_backup_uploads_status ON backup_uploads(status)",
+		"CREATE INDEX IF NOT EXISTS idx_cost_rolls_assembly_period ON cost_rolls(assembly_ipn, period)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_cost_rolls_frozen ON cost_rolls(assembly_ipn, period) WHERE status='frozen'",
+		"CREATE INDEX IF NOT EXISTS idx_cost_roll_lines_roll_id ON cost_roll_lines(roll_id)",
+		"CREATE INDEX IF NOT EXISTS idx_cost_roll_lines_ipn ON cost_roll_lines(ipn)",
+		"CREATE INDEX IF NOT EXISTS idx_part_lifecycle_history_ipn ON part_lifecycle_history(ipn)",
+		"CREATE INDEX IF NOT EXISTS idx_ipn_reservations_category ON ipn_reservations(category)",
+		"CREATE INDEX IF NOT EXISTS idx_part_revisions_eco ON part_revisions(eco_id)",
+		"CREATE INDEX IF NOT EXISTS idx_part_alternates_ipn ON part_alternates(ipn)",
+		"CREATE INDEX IF NOT EXISTS idx_wo_substitutions_wo_id ON wo_substitutions(wo_id)",
+		"CREATE INDEX IF NOT EXISTS idx_rma_lines_rma_id ON rma_lines(rma_id)",
+		"CREATE INDEX IF NOT EXISTS idx_rma_lines_serial ON rma_lines(serial_number)",
+		"CREATE INDEX IF NOT EXISTS idx_rma_parts_rma_id ON rma_parts(rma_id)",
+		"CREATE INDEX IF NOT EXISTS idx_service_contracts_customer ON service_contracts(customer)",
+		"CREATE INDEX IF NOT EXISTS idx_service_contracts_end_date ON service_contracts(end_date)",
+		"CREATE INDEX IF NOT EXISTS idx_service_contract_devices_serial ON service_contract_devices(serial_number)",
+		"CREATE INDEX IF NOT EXISTS idx_e_signatures_record ON e_signatures(module, record_id)",
+		"CREATE INDEX IF NOT EXISTS idx_eight_d_ncr_id ON eight_d(ncr_id)",
+		"CREATE INDEX IF NOT EXISTS idx_eight_d_capa_id ON eight_d(capa_id)",
+		"CREATE INDEX IF NOT EXISTS idx_eight_d_causes_report ON eight_d_causes(eight_d_id)",
+		"CREATE INDEX IF NOT EXISTS idx_eight_d_actions_report ON eight_d_actions(eight_d_id)",
+		"CREATE INDEX IF NOT EXISTS idx_eight_d_actions_owner ON eight_d_actions(owner, status)",
+		"CREATE INDEX IF NOT EXISTS idx_mrb_quarantine_ncr ON mrb_quarantine(ncr_id)",
+		"CREATE INDEX IF NOT EXISTS idx_mrb_quarantine_inspection ON mrb_quarantine(receiving_inspection_id)",
+		"CREATE INDEX IF NOT EXISTS idx_mrb_dispositions_ncr ON mrb_dispositions(ncr_id)",
+		"CREATE INDEX IF NOT EXISTS idx_mrb_dispositions_decided_at ON mrb_dispositions(disposition, decided_at)",
+		"CREATE INDEX IF NOT EXISTS idx_spc_violations_ipn ON spc_violations(ipn, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_test_records_ipn_tested_at ON test_records(ipn, tested_at)",
+		"CREATE INDEX IF NOT EXISTS idx_field_report_emails_report ON field_report_emails(report_id)",
+		"CREATE INDEX IF NOT EXISTS idx_field_report_emails_message ON field_report_emails(message_id)",
+		"CREATE INDEX IF NOT EXISTS idx_training_requirements_ipn ON training_requirements(ipn, activity)",
+		"CREATE INDEX IF NOT EXISTS idx_training_records_user ON training_records(username, document_id)",
+		"CREATE INDEX IF NOT EXISTS idx_training_tasks_user ON training_tasks(username, status)",
 	}
 	for _, idx := range indexes {
 		if _, err := db.Exec(idx); err != nil {
@@ -726,11 +1077,16 @@ func SeedDB(db *sql.DB) {
 		widgets := []string{
 			"kpi_open_ecos", "kpi_low_stock", "kpi_open_pos", "kpi_active_wos",
 			"kpi_open_ncrs", "kpi_open_rmas", "kpi_total_parts", "kpi_total_devices",
-			"chart_eco_status", "chart_wo_status", "chart_inventory",
+			"chart_eco_status", "chart_wo_status", "chart_inventory", "chart_spc",
 		}
 		for i, w := range widgets {
 			db.Exec("INSERT INTO dashboard_widgets (user_id, widget_type, position, enabled) VALUES (0, ?, ?, 1)", w, i)
 		}
+	} else {
+		// Widgets added after a dashboard was set up start disabled at the end.
+		db.Exec(`INSERT INTO dashboard_widgets (user_id, widget_type, position, enabled)
+			SELECT 0, 'chart_spc', (SELECT COALESCE(MAX(position), -1) + 1 FROM dashboard_widgets WHERE user_id=0), 0
+			WHERE NOT EXISTS (SELECT 1 FROM dashboard_widgets WHERE user_id=0 AND widget_type='chart_spc')`)
 	}
 
 	var count int
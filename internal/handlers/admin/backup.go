@@ -1,14 +1,36 @@
 package admin
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"zrp/internal/audit"
+	"zrp/internal/backup"
 	"zrp/internal/response"
 )
 
+func (h *Handler) backupDir() string {
+	if h.BackupDir != nil {
+		return h.BackupDir()
+	}
+	return "backups"
+}
+
+func (h *Handler) uploadsDir() string {
+	if h.UploadsDir != nil {
+		return h.UploadsDir()
+	}
+	return "uploads"
+}
+
+func validBackupFilename(name string) bool {
+	return name != "" && !strings.Contains(name, "/") && !strings.Contains(name, "\\") && !strings.Contains(name, "..")
+}
+
 // HandleCreateBackup creates a new backup.
 func (h *Handler) HandleCreateBackup(w http.ResponseWriter, r *http.Request) {
 	if err := h.PerformBackup(); err != nil {
@@ -25,17 +47,22 @@ func (h *Handler) HandleListBackups(w http.ResponseWriter, r *http.Request) {
 		response.Err(w, fmt.Sprintf("Failed to list backups: %v", err), 500)
 		return
 	}
+	if statuses, err := backup.UploadStatuses(h.DB); err == nil {
+		for i := range backups {
+			backups[i].Uploads = statuses[backups[i].Filename]
+		}
+	}
 	response.JSON(w, backups)
 }
 
 // HandleDeleteBackup deletes a backup by filename.
 func (h *Handler) HandleDeleteBackup(w http.ResponseWriter, r *http.Request, filename string) {
-	if strings.Contains(filename, "/") || strings.Contains(filename, "..") {
+	if !validBackupFilename(filename) {
 		response.Err(w, "Invalid filename", 400)
 		return
 	}
 
-	path := fmt.Sprintf("backups/%s", filename)
+	path := filepath.Join(h.backupDir(), filename)
 	if err := os.Remove(path); err != nil {
 		if os.IsNotExist(err) {
 			response.Err(w, "Backup not found", 404)
@@ -49,12 +76,12 @@ func (h *Handler) HandleDeleteBackup(w http.ResponseWriter, r *http.Request, fil
 
 // HandleDownloadBackup downloads a backup file.
 func (h *Handler) HandleDownloadBackup(w http.ResponseWriter, r *http.Request, filename string) {
-	if strings.Contains(filename, "/") || strings.Contains(filename, "..") {
+	if !validBackupFilename(filename) {
 		http.Error(w, "Invalid filename", 400)
 		return
 	}
 
-	path := fmt.Sprintf("backups/%s", filename)
+	path := filepath.Join(h.backupDir(), filename)
 	f, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -74,7 +101,52 @@ func (h *Handler) HandleDownloadBackup(w http.ResponseWriter, r *http.Request, f
 	http.ServeContent(w, r, filename, info.ModTime(), f)
 }
 
-// HandleRestoreBackup restores the database from a backup.
+// HandleVerifyBackup checks a backup's manifest checksums and database
+// integrity without restoring it.
+func (h *Handler) HandleVerifyBackup(w http.ResponseWriter, r *http.Request, filename string) {
+	if !validBackupFilename(filename) {
+		response.Err(w, "Invalid filename", 400)
+		return
+	}
+	path := filepath.Join(h.backupDir(), filename)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		response.Err(w, "Backup not found", 404)
+		return
+	}
+
+	result := map[string]interface{}{"filename": filename, "valid": true}
+	if backup.IsArchive(filename) {
+		staging, err := os.MkdirTemp(h.backupDir(), ".verify-")
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		defer os.RemoveAll(staging)
+		manifest, err := backup.Extract(path, staging)
+		if err == nil {
+			err = backup.CheckIntegrity(filepath.Join(staging, backup.DatabaseName))
+		}
+		if err != nil {
+			result["valid"] = false
+			result["error"] = err.Error()
+		} else {
+			result["manifest"] = manifest
+			if chain, err := backup.VerifyAuditChain(filepath.Join(staging, backup.DatabaseName)); err == nil {
+				result["audit_chain"] = chain
+			}
+		}
+	} else if err := backup.CheckIntegrity(path); err != nil {
+		result["valid"] = false
+		result["error"] = err.Error()
+	} else if chain, err := backup.VerifyAuditChain(path); err == nil {
+		result["audit_chain"] = chain
+	}
+	response.JSON(w, result)
+}
+
+// HandleRestoreBackup restores the database (and, for archives, uploaded
+// attachments) from a backup. The backup is verified before the live files
+// are swapped, and the previous files are put back if the swap fails.
 func (h *Handler) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Filename string `json:"filename"`
@@ -84,12 +156,12 @@ func (h *Handler) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.Contains(req.Filename, "/") || strings.Contains(req.Filename, "..") {
+	if !validBackupFilename(req.Filename) {
 		response.Err(w, "Invalid filename", 400)
 		return
 	}
 
-	backupPath := fmt.Sprintf("backups/%s", req.Filename)
+	backupPath := filepath.Join(h.backupDir(), req.Filename)
 	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
 		response.Err(w, "Backup not found", 404)
 		return
@@ -97,29 +169,61 @@ func (h *Handler) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 
 	// Create a pre-restore backup first
 	if h.PerformBackup != nil {
-		h.PerformBackup()
+		if err := h.PerformBackup(); err != nil {
+			response.Err(w, fmt.Sprintf("Pre-restore backup failed: %v", err), 500)
+			return
+		}
 	}
 
-	// Read backup file
-	data, err := os.ReadFile(backupPath)
+	manifest, err := backup.Restore(backup.RestoreOptions{
+		Backup:     backupPath,
+		DBPath:     h.DBFilePath(),
+		UploadsDir: h.uploadsDir(),
+		Close:      h.DB.Close,
+		Reopen:     h.InitDB,
+	})
 	if err != nil {
-		response.Err(w, fmt.Sprintf("Failed to read backup: %v", err), 500)
+		status := 500
+		if errors.Is(err, backup.ErrInvalidBackup) {
+			status = 422
+		}
+		response.Err(w, fmt.Sprintf("Restore failed: %v", err), status)
 		return
 	}
 
-	// Write over current database file
-	dbFilePath := h.DBFilePath()
-	if err := os.WriteFile(dbFilePath, data, 0644); err != nil {
-		response.Err(w, fmt.Sprintf("Failed to restore: %v", err), 500)
-		return
+	resp := map[string]interface{}{"status": "ok", "message": "Database restored from " + req.Filename}
+	if manifest != nil {
+		resp["manifest"] = manifest
 	}
+	response.JSON(w, resp)
+}
+
+// HandleGetBackupRetention returns the grandfather-father-son retention policy.
+func (h *Handler) HandleGetBackupRetention(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, backup.LoadPolicy(h.DB))
+}
 
-	// Reopen database connection
-	h.DB.Close()
-	if err := h.InitDB(dbFilePath); err != nil {
-		response.Err(w, fmt.Sprintf("Failed to reopen DB after restore: %v", err), 500)
+// HandleUpdateBackupRetention updates the retention policy and applies it to
+// existing backups.
+func (h *Handler) HandleUpdateBackupRetention(w http.ResponseWriter, r *http.Request) {
+	policy := backup.LoadPolicy(h.DB)
+	if err := response.DecodeBody(r, &policy); err != nil {
+		response.Err(w, "invalid body", 400)
 		return
 	}
-
-	response.JSON(w, map[string]string{"status": "ok", "message": "Database restored from " + req.Filename})
+	if policy.Daily < 0 || policy.Weekly < 0 || policy.Monthly < 0 || policy.Yearly < 0 {
+		response.Err(w, "retention counts must not be negative", 400)
+		return
+	}
+	if err := backup.SavePolicy(h.DB, policy); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "settings", "backup_retention",
+		fmt.Sprintf("Backup retention: %d daily, %d weekly, %d monthly, %d yearly",
+			policy.Daily, policy.Weekly, policy.Monthly, policy.Yearly))
+	if h.CleanOldBackups != nil {
+		h.CleanOldBackups()
+	}
+	response.JSON(w, policy)
 }
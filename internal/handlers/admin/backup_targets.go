@@ -0,0 +1,268 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/backup"
+	"zrp/internal/response"
+)
+
+// BackupTargetRequest is the body for creating or updating a backup target.
+type BackupTargetRequest struct {
+	Name    string          `json:"name"`
+	Kind    string          `json:"kind"`
+	Config  json.RawMessage `json:"config"`
+	Encrypt *bool           `json:"encrypt"`
+	Enabled *bool           `json:"enabled"`
+}
+
+// backupTimeout bounds a single interactive call to a remote target.
+const backupTimeout = 10 * time.Minute
+
+func (h *Handler) backupUploader() *backup.Uploader {
+	return &backup.Uploader{DB: h.DB, Dir: h.backupDir()}
+}
+
+func (h *Handler) loadBackupTarget(w http.ResponseWriter, id string) (backup.Target, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		response.Err(w, "invalid id", 400)
+		return backup.Target{}, false
+	}
+	t, err := backup.GetTarget(h.DB, n)
+	if err == sql.ErrNoRows {
+		response.Err(w, "backup target not found", 404)
+		return t, false
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return t, false
+	}
+	return t, true
+}
+
+func maskTarget(t backup.Target) backup.Target {
+	t.Config = backup.MaskSecrets(t.Config)
+	return t
+}
+
+// HandleListBackupTargets returns all off-site backup targets with secrets
+// masked.
+func (h *Handler) HandleListBackupTargets(w http.ResponseWriter, r *http.Request) {
+	targets, err := backup.ListTargets(h.DB, false)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	for i := range targets {
+		targets[i] = maskTarget(targets[i])
+	}
+	response.JSON(w, targets)
+}
+
+// HandleCreateBackupTarget adds an off-site backup target. The config is
+// validated by building the destination but no connection is made.
+func (h *Handler) HandleCreateBackupTarget(w http.ResponseWriter, r *http.Request) {
+	var req BackupTargetRequest
+	if err := response.DecodeBody(r, &req); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if req.Name == "" {
+		response.Err(w, "name is required", 400)
+		return
+	}
+	if len(req.Config) == 0 {
+		req.Config = json.RawMessage("{}")
+	}
+	if _, err := backup.NewDestination(req.Kind, req.Config); err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	encrypt := req.Encrypt != nil && *req.Encrypt
+	enabled := req.Enabled == nil || *req.Enabled
+	username := audit.GetUsername(h.DB, r)
+
+	res, err := h.DB.Exec(`INSERT INTO backup_targets (name, kind, config, encrypt, enabled, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, req.Kind, string(req.Config), encrypt, enabled, username)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	audit.LogAudit(h.DB, h.Hub, username, "created", "backup_target", strconv.FormatInt(id, 10), "Created backup target "+req.Name+" ("+req.Kind+")")
+
+	t, err := backup.GetTarget(h.DB, int(id))
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(201)
+	response.JSON(w, maskTarget(t))
+}
+
+// HandleUpdateBackupTarget updates a target. Omitted fields are left
+// unchanged, and masked or empty secrets keep their stored value.
+func (h *Handler) HandleUpdateBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := h.loadBackupTarget(w, id)
+	if !ok {
+		return
+	}
+	var req BackupTargetRequest
+	if err := response.DecodeBody(r, &req); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if req.Name != "" {
+		t.Name = req.Name
+	}
+	if req.Kind != "" {
+		t.Kind = req.Kind
+	}
+	if len(req.Config) > 0 {
+		t.Config = backup.MergeSecrets(req.Config, t.Config)
+	}
+	if req.Encrypt != nil {
+		t.Encrypt = *req.Encrypt
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+	if _, err := backup.NewDestination(t.Kind, t.Config); err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+
+	_, err := h.DB.Exec(`UPDATE backup_targets SET name=?, kind=?, config=?, encrypt=?, enabled=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		t.Name, t.Kind, string(t.Config), t.Encrypt, t.Enabled, t.ID)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	username := audit.GetUsername(h.DB, r)
+	audit.LogAudit(h.DB, h.Hub, username, "updated", "backup_target", id, "Updated backup target "+t.Name)
+
+	t, _ = backup.GetTarget(h.DB, t.ID)
+	response.JSON(w, maskTarget(t))
+}
+
+// HandleDeleteBackupTarget removes a target and its upload history. Remote
+// copies are left in place.
+func (h *Handler) HandleDeleteBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := h.loadBackupTarget(w, id)
+	if !ok {
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM backup_uploads WHERE target_id = ?", t.ID); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM backup_targets WHERE id = ?", t.ID); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	username := audit.GetUsername(h.DB, r)
+	audit.LogAudit(h.DB, h.Hub, username, "deleted", "backup_target", id, "Deleted backup target "+t.Name)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// HandleTestBackupTarget connects to a target and lists its backups.
+func (h *Handler) HandleTestBackupTarget(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := h.loadBackupTarget(w, id)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	dest, err := h.backupUploader().Destination(t)
+	if err == nil {
+		_, err = dest.List(ctx)
+	}
+	if err != nil {
+		response.JSON(w, map[string]interface{}{"ok": false, "error": err.Error()})
+		return
+	}
+	response.JSON(w, map[string]interface{}{"ok": true})
+}
+
+// HandleListRemoteBackups lists the backups stored at a target.
+func (h *Handler) HandleListRemoteBackups(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := h.loadBackupTarget(w, id)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	dest, err := h.backupUploader().Destination(t)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	objs, err := dest.List(ctx)
+	if err != nil {
+		response.Err(w, err.Error(), 502)
+		return
+	}
+	response.JSON(w, objs)
+}
+
+// HandleFetchRemoteBackup downloads (and decrypts) a backup from a target
+// into the local backup directory so it can be verified and restored.
+func (h *Handler) HandleFetchRemoteBackup(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := h.loadBackupTarget(w, id)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := response.DecodeBody(r, &req); err != nil || req.Name == "" {
+		response.Err(w, "name is required", 400)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+	defer cancel()
+	local, err := h.backupUploader().Fetch(ctx, t, req.Name)
+	if err != nil {
+		response.Err(w, "Fetch failed: "+err.Error(), 502)
+		return
+	}
+	username := audit.GetUsername(h.DB, r)
+	audit.LogAudit(h.DB, h.Hub, username, "fetched", "backup", local, "Fetched backup "+req.Name+" from "+t.Name)
+	response.JSON(w, map[string]string{"status": "ok", "filename": local})
+}
+
+// HandleUploadBackup queues a local backup for every enabled target and
+// uploads it immediately.
+func (h *Handler) HandleUploadBackup(w http.ResponseWriter, r *http.Request, filename string) {
+	if !validBackupFilename(filename) || !backup.IsBackupName(filename) {
+		response.Err(w, "Invalid filename", 400)
+		return
+	}
+	u := h.backupUploader()
+	if _, err := u.Stat(filename); err != nil {
+		response.Err(w, "Backup not found", 404)
+		return
+	}
+	if _, err := u.Enqueue(filename); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+	defer cancel()
+	if _, err := u.ProcessPending(ctx); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	statuses, _ := backup.UploadStatuses(h.DB)
+	uploads := statuses[filename]
+	if uploads == nil {
+		uploads = []backup.UploadStatus{}
+	}
+	response.JSON(w, map[string]interface{}{"filename": filename, "uploads": uploads})
+}
@@ -0,0 +1,125 @@
+package admin_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"zrp/internal/backup"
+	"zrp/internal/handlers/admin"
+)
+
+func TestBackupTargetCRUDMasksSecrets(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	h := newTestHandler(db)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"name": "offsite",
+		"kind": "s3",
+		"config": map[string]string{
+			"endpoint": "https://minio.example.com", "bucket": "zrp",
+			"access_key": "AKIA", "secret_key": "topsecret",
+		},
+		"encrypt": true,
+	})
+	w := httptest.NewRecorder()
+	h.HandleCreateBackupTarget(w, httptest.NewRequest("POST", "/api/v1/admin/backup-targets", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "topsecret") {
+		t.Fatalf("create response leaked secret: %s", w.Body.String())
+	}
+	var created struct {
+		Data backup.Target `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	id := created.Data.ID
+
+	// Update with the masked secret left in place keeps the stored one.
+	w = httptest.NewRecorder()
+	h.HandleUpdateBackupTarget(w, httptest.NewRequest("PUT", "/", strings.NewReader(
+		`{"config":{"endpoint":"https://minio2.example.com","bucket":"zrp","access_key":"AKIA","secret_key":"********"}}`)), strconv.Itoa(id))
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	stored, _ := backup.GetTarget(db, id)
+	if !strings.Contains(string(stored.Config), "topsecret") || !strings.Contains(string(stored.Config), "minio2") {
+		t.Fatalf("stored config = %s", stored.Config)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleListBackupTargets(w, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(w.Body.String(), "topsecret") {
+		t.Fatalf("list leaked secret: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleDeleteBackupTarget(w, httptest.NewRequest("DELETE", "/", nil), strconv.Itoa(id))
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+}
+
+func TestCreateBackupTargetRejectsInvalidConfig(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	h := newTestHandler(db)
+
+	for _, body := range []string{
+		`{"name":"x","kind":"ftp","config":{}}`,
+		`{"name":"x","kind":"sftp","config":{"host":"h","user":"u","password":"p"}}`,
+		`{"kind":"local","config":{"path":"/tmp"}}`,
+	} {
+		w := httptest.NewRecorder()
+		h.HandleCreateBackupTarget(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestUploadBackupReportsStatusInList(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	dir := t.TempDir()
+	remote := t.TempDir()
+	name := "zrp-backup-2026-05-01T02-00-00.db"
+	os.WriteFile(filepath.Join(dir, name), []byte("db"), 0644)
+
+	h := newTestHandler(db)
+	h.BackupDir = func() string { return dir }
+	h.ListBackups = func() ([]admin.BackupInfo, error) {
+		return []admin.BackupInfo{{Filename: name, Size: 2}}, nil
+	}
+	cfg, _ := json.Marshal(backup.LocalConfig{Path: remote})
+	db.Exec("INSERT INTO backup_targets (name, kind, config) VALUES ('nfs', 'local', ?)", string(cfg))
+
+	w := httptest.NewRecorder()
+	h.HandleUploadBackup(w, httptest.NewRequest("POST", "/", nil), name)
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(remote, name)); err != nil {
+		t.Fatalf("backup not copied to target: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleListBackups(w, httptest.NewRequest("GET", "/", nil))
+	var listed struct {
+		Data []admin.BackupInfo `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Data) != 1 || len(listed.Data[0].Uploads) != 1 || listed.Data[0].Uploads[0].Status != backup.UploadUploaded {
+		t.Fatalf("list = %+v", listed.Data)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleUploadBackup(w, httptest.NewRequest("POST", "/", nil), "zrp-backup-missing.db")
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for missing backup, got %d", w.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package admin_test
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http/httptest"
@@ -308,28 +309,31 @@ func TestHandleRestoreBackupNotFound(t *testing.T) {
 func TestHandleRestoreBackupSuccess(t *testing.T) {
 	backupsDir := filepath.Join(t.TempDir(), "backups")
 	os.MkdirAll(backupsDir, 0755)
-	origDir, _ := os.Getwd()
-	os.Chdir(filepath.Dir(backupsDir))
-	t.Cleanup(func() { os.Chdir(origDir) })
 
-	// Create a backup file to restore from.
+	// Create a real database backup to restore from.
 	filename := "zrp-backup-2025-01-01T00-00-00.db"
-	os.WriteFile(filepath.Join(backupsDir, filename), []byte("restored-data"), 0644)
+	src, _ := sql.Open("sqlite", filepath.Join(backupsDir, filename))
+	src.Exec("CREATE TABLE marker (v TEXT)")
+	src.Exec("INSERT INTO marker VALUES ('restored')")
+	src.Close()
 
-	// Create a temp DB file that the handler will overwrite.
+	// Create a live DB file that the handler will replace.
 	dbFile := filepath.Join(t.TempDir(), "test.db")
-	os.WriteFile(dbFile, []byte("old-data"), 0644)
+	live, _ := sql.Open("sqlite", dbFile)
+	live.Exec("CREATE TABLE marker (v TEXT)")
+	live.Exec("INSERT INTO marker VALUES ('live')")
 
-	db := setupAuthTestDB(t)
-	h := newTestHandler(db)
+	h := newTestHandler(live)
+	h.BackupDir = func() string { return backupsDir }
 	h.DBFilePath = func() string { return dbFile }
 	h.PerformBackup = func() error {
 		// Write a pre-restore backup.
 		pre := filepath.Join(backupsDir, "zrp-backup-pre-restore.db")
 		return os.WriteFile(pre, []byte("pre-restore"), 0644)
 	}
+	reopened := ""
 	h.InitDB = func(path string) error {
-		// Simulate reopening the DB (no-op for test).
+		reopened = path
 		return nil
 	}
 
@@ -341,22 +345,76 @@ func TestHandleRestoreBackupSuccess(t *testing.T) {
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
 	}
+	if reopened != dbFile {
+		t.Errorf("expected DB to be reopened at %s, got %q", dbFile, reopened)
+	}
 
-	// Verify the DB file was overwritten with backup data.
-	data, _ := os.ReadFile(dbFile)
-	if string(data) != "restored-data" {
-		t.Errorf("expected db file to contain restored data, got %q", string(data))
+	// Verify the live DB now holds the backup's data.
+	check, _ := sql.Open("sqlite", dbFile)
+	defer check.Close()
+	var v string
+	check.QueryRow("SELECT v FROM marker").Scan(&v)
+	if v != "restored" {
+		t.Errorf("expected restored data, got %q", v)
 	}
 
 	// Verify pre-restore backup was created.
-	entries, _ := os.ReadDir(backupsDir)
-	found := false
-	for _, e := range entries {
-		if e.Name() == "zrp-backup-pre-restore.db" {
-			found = true
-		}
-	}
-	if !found {
+	if _, err := os.Stat(filepath.Join(backupsDir, "zrp-backup-pre-restore.db")); err != nil {
 		t.Error("expected pre-restore backup to be created")
 	}
 }
+
+func TestHandleRestoreBackupCorrupt(t *testing.T) {
+	backupsDir := t.TempDir()
+	filename := "zrp-backup-2025-01-01T00-00-00.db"
+	os.WriteFile(filepath.Join(backupsDir, filename), []byte("not a database"), 0644)
+
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	live, _ := sql.Open("sqlite", dbFile)
+	defer live.Close()
+	live.Exec("CREATE TABLE marker (v TEXT)")
+
+	h := newTestHandler(live)
+	h.BackupDir = func() string { return backupsDir }
+	h.DBFilePath = func() string { return dbFile }
+
+	body := fmt.Sprintf(`{"filename":"%s"}`, filename)
+	w := httptest.NewRecorder()
+	h.HandleRestoreBackup(w, httptest.NewRequest("POST", "/api/v1/admin/restore", strings.NewReader(body)))
+
+	if w.Code != 422 {
+		t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+	// The live connection must still be usable.
+	if _, err := live.Exec("INSERT INTO marker VALUES ('still-open')"); err != nil {
+		t.Errorf("live DB was disturbed: %v", err)
+	}
+}
+
+func TestBackupRetentionSettings(t *testing.T) {
+	h := newBackupTestHandler(t, t.TempDir())
+
+	w := httptest.NewRecorder()
+	h.HandleUpdateBackupRetention(w, httptest.NewRequest("PUT", "/api/v1/admin/backups/retention",
+		strings.NewReader(`{"daily":14,"weekly":8,"monthly":6,"yearly":0}`)))
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleGetBackupRetention(w, httptest.NewRequest("GET", "/api/v1/admin/backups/retention", nil))
+	var resp struct {
+		Data map[string]int `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Data["daily"] != 14 || resp.Data["yearly"] != 0 {
+		t.Errorf("unexpected policy %v", resp.Data)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleUpdateBackupRetention(w, httptest.NewRequest("PUT", "/api/v1/admin/backups/retention",
+		strings.NewReader(`{"daily":-1}`)))
+	if w.Code != 400 {
+		t.Errorf("expected 400 for negative count, got %d", w.Code)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"zrp/internal/audit"
 	"zrp/internal/auth"
+	"zrp/internal/backup"
 	"zrp/internal/response"
 	"zrp/internal/server"
 	"zrp/internal/validation"
@@ -34,6 +35,9 @@ type Handler struct {
 	DBFilePath     func() string
 	SetDBFilePath  func(string)
 	InitDB         func(string) error
+	// BackupDir and UploadsDir default to "backups" and "uploads" when nil.
+	BackupDir  func() string
+	UploadsDir func() string
 
 	// Email function fields.
 	SendEmail            func(to, subject, body string) error
@@ -150,6 +154,11 @@ type BackupInfo struct {
 	Filename  string `json:"filename"`
 	Size      int64  `json:"size"`
 	CreatedAt string `json:"created_at"`
+	// Kind is "archive" for database+uploads archives and "database" for
+	// legacy database-only backups.
+	Kind string `json:"kind,omitempty"`
+	// Uploads is the off-site upload status of this backup per target.
+	Uploads []backup.UploadStatus `json:"uploads,omitempty"`
 }
 
 // EmailConfig represents the email configuration.
@@ -0,0 +1,290 @@
+package admin
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"zrp/internal/audit"
+	"zrp/internal/response"
+	"zrp/internal/webhooks"
+)
+
+// WebhookRequest is the body for creating or updating a webhook.
+type WebhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Secret  *string  `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *int     `json:"enabled"`
+}
+
+func validateWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (h *Handler) getWebhook(id string) (*webhooks.Webhook, error) {
+	var wh webhooks.Webhook
+	var events string
+	err := h.DB.QueryRow(`SELECT id, name, url, secret, events, enabled, COALESCE(created_by,''), created_at, updated_at
+		FROM webhooks WHERE id = ?`, id).
+		Scan(&wh.ID, &wh.Name, &wh.URL, &wh.Secret, &events, &wh.Enabled, &wh.CreatedBy, &wh.CreatedAt, &wh.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	wh.Events = webhooks.ParseEvents(events)
+	return &wh, nil
+}
+
+// HandleListWebhooks returns all webhook subscriptions. Secrets are omitted.
+func (h *Handler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`SELECT id, name, url, events, enabled, COALESCE(created_by,''), created_at, updated_at
+		FROM webhooks ORDER BY id`)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []webhooks.Webhook{}
+	for rows.Next() {
+		var wh webhooks.Webhook
+		var events string
+		if err := rows.Scan(&wh.ID, &wh.Name, &wh.URL, &events, &wh.Enabled, &wh.CreatedBy, &wh.CreatedAt, &wh.UpdatedAt); err != nil {
+			continue
+		}
+		wh.Events = webhooks.ParseEvents(events)
+		items = append(items, wh)
+	}
+	response.JSON(w, items)
+}
+
+// HandleListWebhookEvents returns the event names that can be subscribed to.
+func (h *Handler) HandleListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, webhooks.EventTypes)
+}
+
+// HandleGetWebhook returns a single webhook. The secret is omitted.
+func (h *Handler) HandleGetWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	wh, err := h.getWebhook(id)
+	if err == sql.ErrNoRows {
+		response.Err(w, "webhook not found", 404)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	wh.Secret = ""
+	response.JSON(w, wh)
+}
+
+// HandleCreateWebhook creates a webhook subscription. If no secret is given
+// one is generated; the secret is only returned in this response.
+func (h *Handler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := response.DecodeBody(r, &req); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if !validateWebhookURL(req.URL) {
+		response.Err(w, "url must be an absolute http or https URL", 400)
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = []string{"*"}
+	}
+	secret := ""
+	if req.Secret != nil {
+		secret = *req.Secret
+	}
+	if secret == "" {
+		s, err := generateWebhookSecret()
+		if err != nil {
+			response.Err(w, "failed to generate secret", 500)
+			return
+		}
+		secret = s
+	}
+	enabled := 1
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	events, _ := json.Marshal(req.Events)
+	username := audit.GetUsername(h.DB, r)
+
+	res, err := h.DB.Exec(`INSERT INTO webhooks (name, url, secret, events, enabled, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, req.URL, secret, string(events), enabled, username)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	idStr := strconv.FormatInt(id, 10)
+	audit.LogAudit(h.DB, h.Hub, username, "created", "webhook", idStr, "Created webhook "+req.URL)
+
+	wh, err := h.getWebhook(idStr)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(201)
+	response.JSON(w, wh)
+}
+
+// HandleUpdateWebhook updates a webhook. Omitted fields are left unchanged;
+// an empty secret string rotates the secret and returns the new value.
+func (h *Handler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	wh, err := h.getWebhook(id)
+	if err == sql.ErrNoRows {
+		response.Err(w, "webhook not found", 404)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	var req WebhookRequest
+	if err := response.DecodeBody(r, &req); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if req.URL != "" {
+		if !validateWebhookURL(req.URL) {
+			response.Err(w, "url must be an absolute http or https URL", 400)
+			return
+		}
+		wh.URL = req.URL
+	}
+	if req.Name != "" {
+		wh.Name = req.Name
+	}
+	if req.Events != nil {
+		wh.Events = req.Events
+	}
+	if req.Enabled != nil {
+		wh.Enabled = *req.Enabled
+	}
+	rotated := false
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			s, err := generateWebhookSecret()
+			if err != nil {
+				response.Err(w, "failed to generate secret", 500)
+				return
+			}
+			wh.Secret = s
+		} else {
+			wh.Secret = *req.Secret
+		}
+		rotated = true
+	}
+	events, _ := json.Marshal(wh.Events)
+
+	_, err = h.DB.Exec(`UPDATE webhooks SET name=?, url=?, secret=?, events=?, enabled=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		wh.Name, wh.URL, wh.Secret, string(events), wh.Enabled, id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "webhook", id, "Updated webhook "+wh.URL)
+
+	wh, _ = h.getWebhook(id)
+	if !rotated {
+		wh.Secret = ""
+	}
+	response.JSON(w, wh)
+}
+
+// HandleDeleteWebhook deletes a webhook and its delivery history.
+func (h *Handler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	h.DB.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+	res, err := h.DB.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, "webhook not found", 404)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "deleted", "webhook", id, "Deleted webhook "+id)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// HandleListWebhookDeliveries returns the delivery log for a webhook,
+// newest first. Supports ?status= and ?limit= filters.
+func (h *Handler) HandleListWebhookDeliveries(w http.ResponseWriter, r *http.Request, id string) {
+	limit := 100
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
+	query := `SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, COALESCE(response_code,0),
+		COALESCE(response_body,''), COALESCE(last_error,''), redelivery_of, created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id = ?`
+	args := []interface{}{id}
+	if status := strings.TrimSpace(r.URL.Query().Get("status")); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []webhooks.Delivery{}
+	for rows.Next() {
+		var d webhooks.Delivery
+		var redeliveryOf sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseCode, &d.ResponseBody, &d.LastError, &redeliveryOf, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			continue
+		}
+		if redeliveryOf.Valid {
+			v := int(redeliveryOf.Int64)
+			d.RedeliveryOf = &v
+		}
+		items = append(items, d)
+	}
+	response.JSON(w, items)
+}
+
+// HandleRedeliverWebhook queues a new attempt of an existing delivery,
+// including dead-lettered ones.
+func (h *Handler) HandleRedeliverWebhook(w http.ResponseWriter, r *http.Request, deliveryID string) {
+	did, err := strconv.Atoi(deliveryID)
+	if err != nil {
+		response.Err(w, "invalid delivery id", 400)
+		return
+	}
+	newID, err := webhooks.Redeliver(h.DB, did)
+	if err == sql.ErrNoRows {
+		response.Err(w, "delivery not found", 404)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "redelivered", "webhook", deliveryID,
+		"Requeued webhook delivery "+deliveryID)
+	response.JSON(w, map[string]interface{}{"id": newID, "redelivery_of": did, "status": webhooks.StatusPending})
+}
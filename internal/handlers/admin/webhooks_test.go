@@ -0,0 +1,112 @@
+package admin_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"zrp/internal/database"
+	"zrp/internal/webhooks"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupWebhookTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := database.RunMigrations(db, nil); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestCreateWebhook_GeneratesSecretAndHidesItOnList(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	h := newTestHandler(db)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":   "CI",
+		"url":    "https://ci.example.com/hooks/zrp",
+		"events": []string{"eco.approved", "workorder.*"},
+	})
+	w := httptest.NewRecorder()
+	h.HandleCreateWebhook(w, httptest.NewRequest("POST", "/api/v1/webhooks", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data webhooks.Webhook `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Data.Secret == "" {
+		t.Error("Expected generated secret in create response")
+	}
+	if len(created.Data.Events) != 2 {
+		t.Errorf("Expected 2 event filters, got %v", created.Data.Events)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleListWebhooks(w, httptest.NewRequest("GET", "/api/v1/webhooks", nil))
+	var listed struct {
+		Data []webhooks.Webhook `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Data) != 1 || listed.Data[0].Secret != "" {
+		t.Errorf("Expected one webhook without secret, got %+v", listed.Data)
+	}
+}
+
+func TestCreateWebhook_RejectsInvalidURL(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	h := newTestHandler(db)
+
+	for _, url := range []string{"", "ftp://example.com", "not a url"} {
+		body, _ := json.Marshal(map[string]string{"url": url})
+		w := httptest.NewRecorder()
+		h.HandleCreateWebhook(w, httptest.NewRequest("POST", "/api/v1/webhooks", bytes.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("url %q: expected 400, got %d", url, w.Code)
+		}
+	}
+}
+
+func TestWebhookDeliveriesAndRedeliver(t *testing.T) {
+	db := setupWebhookTestDB(t)
+	h := newTestHandler(db)
+
+	db.Exec(`INSERT INTO webhooks (id, url, events) VALUES (1, 'https://example.com/hook', '["*"]')`)
+	db.Exec(`INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, attempts)
+		VALUES (7, 1, 'ncr.created', '{}', 'dead', 8)`)
+
+	w := httptest.NewRecorder()
+	h.HandleRedeliverWebhook(w, httptest.NewRequest("POST", "/api/v1/webhooks/deliveries/7/redeliver", nil), "7")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleListWebhookDeliveries(w, httptest.NewRequest("GET", "/api/v1/webhooks/1/deliveries?status=pending", nil), "1")
+	var resp struct {
+		Data []webhooks.Delivery `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Data) != 1 {
+		t.Fatalf("Expected 1 pending delivery, got %d", len(resp.Data))
+	}
+	if resp.Data[0].RedeliveryOf == nil || *resp.Data[0].RedeliveryOf != 7 {
+		t.Errorf("Expected redelivery_of 7, got %v", resp.Data[0].RedeliveryOf)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleRedeliverWebhook(w, httptest.NewRequest("POST", "/api/v1/webhooks/deliveries/99/redeliver", nil), "99")
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for unknown delivery, got %d", w.Code)
+	}
+}
@@ -206,3 +206,31 @@ func (h *Handler) DownloadAttachment(w http.ResponseWriter, r *http.Request, idS
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", originalName))
 	http.ServeFile(w, r, filePath)
 }
+
+// StoreAttachment saves file content received outside an upload request,
+// such as an email attachment, under the same naming and validation rules
+// as UploadAttachment.
+func (h *Handler) StoreAttachment(module, recordID, originalName, mimeType string, data []byte, uploadedBy string) (Attachment, error) {
+	ve := &ValidationErrors{}
+	h.ValidateFileUpload(ve, originalName, int64(len(data)), mimeType)
+	if ve.HasErrors() {
+		return Attachment{}, fmt.Errorf("%s: %s", originalName, ve.Error())
+	}
+
+	filename := fmt.Sprintf("%s-%s-%d-%s", module, recordID, time.Now().UnixMilli(), h.SanitizeFilename(originalName))
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		return Attachment{}, err
+	}
+	if err := os.WriteFile(filepath.Join("uploads", filename), data, 0644); err != nil {
+		return Attachment{}, err
+	}
+	res, err := h.DB.Exec(`INSERT INTO attachments (module, record_id, filename, original_name, size_bytes, mime_type, uploaded_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		module, recordID, filename, originalName, len(data), mimeType, uploadedBy)
+	if err != nil {
+		os.Remove(filepath.Join("uploads", filename))
+		return Attachment{}, err
+	}
+	id, _ := res.LastInsertId()
+	return Attachment{ID: int(id), Module: module, RecordID: recordID, Filename: filename, OriginalName: originalName,
+		SizeBytes: int64(len(data)), MimeType: mimeType, UploadedBy: uploadedBy}, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"zrp/internal/training"
 )
 
 // BulkRequest is the request body for bulk action endpoints.
@@ -60,6 +62,19 @@ func (h *Handler) BulkECOs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// requireBuildTraining returns an error unless user is qualified to
+// complete work order id. Work orders already completed are not checked.
+func (h *Handler) requireBuildTraining(user, id string) error {
+	var ipn, status string
+	if err := h.DB.QueryRow("SELECT COALESCE(assembly_ipn,''), COALESCE(status,'') FROM work_orders WHERE id=?", id).Scan(&ipn, &status); err != nil {
+		return err
+	}
+	if status == "completed" {
+		return nil
+	}
+	return training.Require(h.DB, user, ipn, training.ActivityBuild)
+}
+
 // BulkWorkOrders handles bulk work order actions.
 func (h *Handler) BulkWorkOrders(w http.ResponseWriter, r *http.Request) {
 	var req BulkRequest
@@ -77,6 +92,9 @@ func (h *Handler) BulkWorkOrders(w http.ResponseWriter, r *http.Request) {
 		var exists int
 		h.DB.QueryRow("SELECT COUNT(*) FROM work_orders WHERE id=?", id).Scan(&exists)
 		if exists == 0 { resp.Failed++; resp.Errors = append(resp.Errors, id+": not found"); continue }
+		if req.Action == "complete" {
+			if err := h.requireBuildTraining(user, id); err != nil { resp.Failed++; resp.Errors = append(resp.Errors, id+": "+err.Error()); continue }
+		}
 		var err error
 		switch req.Action {
 		case "complete":
@@ -103,6 +103,9 @@ func (h *Handler) BulkUpdateWorkOrders(w http.ResponseWriter, r *http.Request) {
 		var exists int
 		h.DB.QueryRow("SELECT COUNT(*) FROM work_orders WHERE id=?", id).Scan(&exists)
 		if exists == 0 { resp.Failed++; resp.Errors = append(resp.Errors, id+": not found"); continue }
+		if req.Updates["status"] == "completed" {
+			if err := h.requireBuildTraining(user, id); err != nil { resp.Failed++; resp.Errors = append(resp.Errors, id+": "+err.Error()); continue }
+		}
 		setClauses := ""
 		args := []interface{}{}
 		for field, value := range req.Updates {
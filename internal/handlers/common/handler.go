@@ -3,14 +3,16 @@ package common
 import (
 	"database/sql"
 	"net/http"
+
+	"zrp/internal/catalog"
 )
 
 // Handler holds dependencies for common/shared handlers.
 type Handler struct {
 	DB  *sql.DB
 
-	// LoadPartsFromDir loads parts from the parts directory.
-	LoadPartsFromDir func() (map[string][]Part, map[string][]string, map[string]string, error)
+	// PartsCatalog returns the indexed parts catalog. Set by the root package.
+	PartsCatalog func() *catalog.Catalog
 
 	// GetCurrentUser returns the current authenticated user info.
 	GetCurrentUser func(r *http.Request) *UserInfo
@@ -25,18 +25,21 @@ func (h *Handler) ScanLookup(w http.ResponseWriter, r *http.Request, code string
 	var results []ScanResult
 	codeLower := strings.ToLower(code)
 
-	cats, _, _, _ := h.LoadPartsFromDir()
-	for _, parts := range cats {
-		for _, p := range parts {
-			if strings.EqualFold(p.IPN, code) || strings.Contains(strings.ToLower(p.IPN), codeLower) {
-				results = append(results, ScanResult{
-					Type:  "part",
-					ID:    p.IPN,
-					Label: fmt.Sprintf("%s - %s", p.IPN, p.Fields["description"]),
-					Link:  fmt.Sprintf("/parts/%s", p.IPN),
-				})
-			}
+	// Parts by IPN, then by manufacturer part number for reel and bag
+	// labels that only carry the MPN.
+	parts := h.PartsCatalog()
+	seenParts := map[string]bool{}
+	for _, p := range append(parts.SearchIPN(code, 0), parts.ByMPN(code)...) {
+		if seenParts[p.IPN] {
+			continue
 		}
+		seenParts[p.IPN] = true
+		results = append(results, ScanResult{
+			Type:  "part",
+			ID:    p.IPN,
+			Label: fmt.Sprintf("%s - %s", p.IPN, p.Fields["description"]),
+			Link:  fmt.Sprintf("/parts/%s", p.IPN),
+		})
 	}
 
 	rows, err := h.DB.Query(`SELECT ipn, location, qty FROM inventory WHERE LOWER(ipn) = LOWER(?) OR LOWER(ipn) LIKE ?`, code, "%"+codeLower+"%")
@@ -28,27 +28,9 @@ func (h *Handler) GlobalSearch(w http.ResponseWriter, r *http.Request) {
 	total := 0
 
 	// Parts
-	cats, _, _, _ := h.LoadPartsFromDir()
-	var matchedParts []map[string]string
-	for _, parts := range cats {
-		for _, p := range parts {
-			if len(matchedParts) >= limit {
-				break
-			}
-			if strings.Contains(strings.ToLower(p.IPN), q) {
-				matchedParts = append(matchedParts, p.Fields)
-				continue
-			}
-			for _, v := range p.Fields {
-				if strings.Contains(strings.ToLower(v), q) {
-					matchedParts = append(matchedParts, p.Fields)
-					break
-				}
-			}
-		}
-	}
-	if matchedParts == nil {
-		matchedParts = []map[string]string{}
+	matchedParts := []map[string]string{}
+	for _, p := range h.PartsCatalog().Search(q, limit) {
+		matchedParts = append(matchedParts, p.Fields)
 	}
 	total += len(matchedParts)
 
@@ -2,6 +2,7 @@ package engineering
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"zrp/internal/audit"
 	"zrp/internal/models"
 	"zrp/internal/response"
+	"zrp/internal/training"
 )
 
 // NextRevision increments a revision letter: A->B, B->C, ..., Z->AA.
@@ -166,11 +168,24 @@ func ComputeDiff(from, to []string) []DiffLine {
 	return result
 }
 
-// ReleaseDoc handles POST /api/documents/:id/release.
+// ReleaseDoc handles POST /api/documents/:id/release. A body with the
+// releaser's password electronically signs the release (meaning
+// "released" or "approved").
 func (h *Handler) ReleaseDoc(w http.ResponseWriter, r *http.Request, docID string) {
+	sig, err := decodeSignature(r)
+	if err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	signer, err := audit.Authenticate(h.DB, r, sig, "released", "approved")
+	if err != nil {
+		response.Err(w, err.Error(), audit.SignatureStatus(err))
+		return
+	}
+
 	// Snapshot current state, then bump revision and set status to released
 	var d models.Document
-	err := h.DB.QueryRow("SELECT id,title,COALESCE(category,''),COALESCE(ipn,''),revision,status,COALESCE(content,''),COALESCE(file_path,''),created_by,created_at,updated_at FROM documents WHERE id=?", docID).
+	err = h.DB.QueryRow("SELECT id,title,COALESCE(category,''),COALESCE(ipn,''),revision,status,COALESCE(content,''),COALESCE(file_path,''),created_by,created_at,updated_at FROM documents WHERE id=?", docID).
 		Scan(&d.ID, &d.Title, &d.Category, &d.IPN, &d.Revision, &d.Status, &d.Content, &d.FilePath, &d.CreatedBy, &d.CreatedAt, &d.UpdatedAt)
 	if err != nil {
 		response.Err(w, "not found", 404)
@@ -186,13 +201,39 @@ func (h *Handler) ReleaseDoc(w http.ResponseWriter, r *http.Request, docID strin
 
 	// Update document status to released
 	now := time.Now().Format("2006-01-02 15:04:05")
-	_, err = h.DB.Exec("UPDATE documents SET status='released', updated_at=? WHERE id=?", now, docID)
+	tx, err := h.DB.Begin()
 	if err != nil {
 		response.Err(w, err.Error(), 500)
 		return
 	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE documents SET status='released', updated_at=? WHERE id=?", now, docID)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var signature models.ESignature
+	if signer != nil {
+		if signature, err = signer.Sign(tx, "document", docID, docSignedContent(d)); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if signer != nil {
+		audit.LogSignature(h.DB, signature)
+	}
 
 	audit.LogAudit(h.DB, h.Hub, username, "released", "document", docID, fmt.Sprintf("Released %s at revision %s", docID, d.Revision))
+	if tasked, err := training.DocumentReleased(h.DB, docID, d.Revision); err != nil {
+		log.Printf("training: release of %s: %v", docID, err)
+	} else if len(tasked) > 0 {
+		audit.LogAudit(h.DB, h.Hub, username, "retraining", "document", docID,
+			fmt.Sprintf("Assigned retraining on %s rev %s to %s", docID, d.Revision, strings.Join(tasked, ", ")))
+	}
 	h.GetDoc(w, r, docID)
 }
 
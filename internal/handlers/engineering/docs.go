@@ -67,8 +67,10 @@ func (h *Handler) GetDoc(w http.ResponseWriter, r *http.Request, id string) {
 	type DocWithAttachments struct {
 		models.Document
 		Attachments []models.Attachment `json:"attachments"`
+		Signatures  []models.ESignature `json:"signatures"`
 	}
-	response.JSON(w, DocWithAttachments{Document: d, Attachments: atts})
+	response.JSON(w, DocWithAttachments{Document: d, Attachments: atts,
+		Signatures: audit.Signatures(h.DB, "document", id, docSignedContent(d))})
 }
 
 // CreateDoc handles POST /api/documents.
@@ -146,14 +148,51 @@ func (h *Handler) UpdateDoc(w http.ResponseWriter, r *http.Request, id string) {
 	h.GetDoc(w, r, id)
 }
 
-// ApproveDoc handles POST /api/documents/:id/approve.
+// ApproveDoc handles POST /api/documents/:id/approve. A body with the
+// approver's password electronically signs the approval (meaning
+// "approved" or "reviewed").
 func (h *Handler) ApproveDoc(w http.ResponseWriter, r *http.Request, id string) {
+	sig, err := decodeSignature(r)
+	if err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	signer, err := audit.Authenticate(h.DB, r, sig, "approved", "reviewed")
+	if err != nil {
+		response.Err(w, err.Error(), audit.SignatureStatus(err))
+		return
+	}
+	d, lookupErr := h.loadDoc(id)
+	if signer != nil && lookupErr != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
 	now := time.Now().Format("2006-01-02 15:04:05")
-	_, err := h.DB.Exec("UPDATE documents SET status='approved',updated_at=? WHERE id=?", now, id)
+	tx, err := h.DB.Begin()
 	if err != nil {
 		response.Err(w, err.Error(), 500)
 		return
 	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE documents SET status='approved',updated_at=? WHERE id=?", now, id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var signature models.ESignature
+	if signer != nil {
+		if signature, err = signer.Sign(tx, "document", id, docSignedContent(d)); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if signer != nil {
+		audit.LogSignature(h.DB, signature)
+	}
 	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "approved", "document", id, "Approved document "+id)
 	h.GetDoc(w, r, id)
 }
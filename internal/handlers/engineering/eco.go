@@ -100,7 +100,8 @@ func (h *Handler) GetECO(w http.ResponseWriter, r *http.Request, id string) {
 		"affected_parts": affectedParts, "created_by": e.CreatedBy,
 		"created_at": e.CreatedAt, "updated_at": e.UpdatedAt,
 		"approved_at": e.ApprovedAt, "approved_by": e.ApprovedBy,
-		"ncr_id": e.NcrID,
+		"ncr_id":     e.NcrID,
+		"signatures": audit.Signatures(h.DB, "eco", id, ecoSignedContent(e)),
 	}
 	response.JSON(w, resp)
 }
@@ -197,15 +198,53 @@ func (h *Handler) UpdateECO(w http.ResponseWriter, r *http.Request, id string) {
 	h.GetECO(w, r, id)
 }
 
-// ApproveECO handles POST /api/ecos/:id/approve.
+// ApproveECO handles POST /api/ecos/:id/approve. A body with the
+// approver's password electronically signs the approval (meaning
+// "approved" or "reviewed").
 func (h *Handler) ApproveECO(w http.ResponseWriter, r *http.Request, id string) {
+	sig, err := decodeSignature(r)
+	if err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	signer, err := audit.Authenticate(h.DB, r, sig, "approved", "reviewed")
+	if err != nil {
+		response.Err(w, err.Error(), audit.SignatureStatus(err))
+		return
+	}
+	e, lookupErr := h.loadECO(id)
+	if signer != nil && lookupErr != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
 	now := time.Now().Format("2006-01-02 15:04:05")
 	user := audit.GetUsername(h.DB, r)
-	_, err := h.DB.Exec("UPDATE ecos SET status='approved',approved_at=?,approved_by=?,updated_at=? WHERE id=?", now, user, now, id)
+	// The approval and its signature commit together.
+	tx, err := h.DB.Begin()
 	if err != nil {
 		response.Err(w, err.Error(), 500)
 		return
 	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE ecos SET status='approved',approved_at=?,approved_by=?,updated_at=? WHERE id=?", now, user, now, id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var signature models.ESignature
+	if signer != nil {
+		if signature, err = signer.Sign(tx, "eco", id, ecoSignedContent(e)); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if signer != nil {
+		audit.LogSignature(h.DB, signature)
+	}
 	// Record approval in latest revision
 	h.updateRevisionApproval(id, user, now)
 	audit.LogAudit(h.DB, h.Hub, user, "approved", "eco", id, "Approved "+id)
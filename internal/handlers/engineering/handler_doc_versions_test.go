@@ -101,7 +101,7 @@ func TestDocRelease(t *testing.T) {
 
 	// Release
 	w = httptest.NewRecorder()
-	req = testutil.AuthedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", nil, cookie)
+	req = testutil.AuthedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", []byte(`{"password":"changeme"}`), cookie)
 	h.ReleaseDoc(w, req, doc.ID)
 	if w.Code != 200 {
 		t.Fatalf("release: %d %s", w.Code, w.Body.String())
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"zrp/internal/audit"
 	"zrp/internal/models"
 
 	_ "modernc.org/sqlite"
@@ -110,6 +111,16 @@ func setupDocsTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create id_sequences table: %v", err)
 	}
 
+	// These tables carry no users to sign with; signing is covered by
+	// handler_signatures_test.go.
+	_, err = testDB.Exec(`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`)
+	if err != nil {
+		t.Fatalf("Failed to create app_settings table: %v", err)
+	}
+	if err := audit.SetSignaturesRequired(testDB, false); err != nil {
+		t.Fatalf("Failed to make signatures optional: %v", err)
+	}
+
 	return testDB
 }
 
@@ -0,0 +1,134 @@
+package engineering_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func TestApproveECO_ElectronicSignature(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db)
+	uid := testutil.CreateTestUser(t, db, "qa", "s3cret-pass", "user", true)
+	token := testutil.CreateTestSessionSimple(t, db, uid)
+	db.Exec(`INSERT INTO ecos (id, title, description, status, affected_ipns) VALUES ('ECO-001','Swap R4','Use 1%','review','RES-001')`)
+
+	approve := func(body string, want int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ApproveECO(w, testutil.AuthedRequest("POST", "/api/v1/ecos/ECO-001/approve", []byte(body), token), "ECO-001")
+		if w.Code != want {
+			t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+		}
+	}
+	approve(`{"password":"wrong"}`, 401)
+	approve(`{"password":"s3cret-pass","meaning":"released"}`, 400)
+	approve(`{"password":"s3cret-pass","reason":"Reviewed test data"}`, 200)
+
+	var sigs []models.ESignature
+	w := httptest.NewRecorder()
+	h.ECOSignatures(w, httptest.NewRequest("GET", "/", nil), "ECO-001")
+	testutil.DecodeEnvelope(t, w, &sigs)
+	if len(sigs) != 1 {
+		t.Fatalf("signatures = %+v", sigs)
+	}
+	s := sigs[0]
+	if s.Meaning != "approved" || s.Username != "qa" || s.FullName != "qa Display" || s.Reason != "Reviewed test data" || !s.Intact || len(s.ContentHash) != 64 {
+		t.Errorf("signature = %+v", s)
+	}
+
+	// Signatures are immutable, and editing the signed content shows up
+	// in the manifest.
+	if _, err := db.Exec("UPDATE e_signatures SET username='mallory'"); err == nil {
+		t.Error("expected signature update to be rejected")
+	}
+	if _, err := db.Exec("DELETE FROM e_signatures"); err == nil {
+		t.Error("expected signature delete to be rejected")
+	}
+	db.Exec("UPDATE ecos SET description='Use 5%' WHERE id='ECO-001'")
+	if sigs := audit.Signatures(db, "eco", "ECO-001", map[string]string{}); len(sigs) != 1 || sigs[0].Intact {
+		t.Errorf("after edit = %+v", sigs)
+	}
+
+	w = httptest.NewRecorder()
+	h.ECOPDF(w, httptest.NewRequest("GET", "/", nil), "ECO-001")
+	if body := w.Body.String(); !strings.Contains(body, "Electronic Signatures") || !strings.Contains(body, "qa Display (qa)") || !strings.Contains(body, "record changed since signing") {
+		t.Errorf("pdf missing manifest: %s", body)
+	}
+}
+
+func TestApproveECO_SignatureFailureKeepsStatus(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db)
+	uid := testutil.CreateTestUser(t, db, "qa", "s3cret-pass", "user", true)
+	token := testutil.CreateTestSessionSimple(t, db, uid)
+	db.Exec(`INSERT INTO ecos (id, title, description, status, affected_ipns) VALUES ('ECO-001','Swap R4','Use 1%','review','RES-001')`)
+	if _, err := db.Exec(`CREATE TRIGGER fail_signature BEFORE INSERT ON e_signatures
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ApproveECO(w, testutil.AuthedRequest("POST", "/api/v1/ecos/ECO-001/approve", []byte(`{"password":"s3cret-pass"}`), token), "ECO-001")
+	if w.Code != 500 {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	var status, approvedBy string
+	db.QueryRow("SELECT status, COALESCE(approved_by,'') FROM ecos WHERE id='ECO-001'").Scan(&status, &approvedBy)
+	if status != "review" || approvedBy != "" {
+		t.Errorf("failed signature left status=%q approved_by=%q", status, approvedBy)
+	}
+}
+
+func TestReleaseDoc_SignatureRequired(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db)
+	uid := testutil.CreateTestUser(t, db, "writer", "s3cret-pass", "user", true)
+	token := testutil.CreateTestSessionSimple(t, db, uid)
+	db.Exec(`INSERT INTO documents (id, title, revision, status, content, created_by) VALUES ('DOC-001','SOP','A','approved','Step 1','writer')`)
+	db.Exec(`INSERT INTO documents (id, title, revision, status, content, created_by) VALUES ('DOC-002','WI','A','approved','Step 1','writer')`)
+
+	release := func(body []byte, want int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ReleaseDoc(w, testutil.AuthedRequest("POST", "/api/v1/docs/DOC-001/release", body, token), "DOC-001")
+		if w.Code != want {
+			t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+		}
+	}
+	release(nil, 401)
+	var status string
+	db.QueryRow("SELECT status FROM documents WHERE id='DOC-001'").Scan(&status)
+	if status != "approved" {
+		t.Fatalf("unsigned release changed status to %s", status)
+	}
+	release([]byte(`{"password":"s3cret-pass"}`), 200)
+
+	var doc struct {
+		Status     string              `json:"status"`
+		Signatures []models.ESignature `json:"signatures"`
+	}
+	w := httptest.NewRecorder()
+	h.GetDoc(w, httptest.NewRequest("GET", "/", nil), "DOC-001")
+	testutil.DecodeEnvelope(t, w, &doc)
+	if doc.Status != "released" || len(doc.Signatures) != 1 || doc.Signatures[0].Meaning != "released" || !doc.Signatures[0].Intact {
+		t.Errorf("doc = %+v", doc)
+	}
+
+	// Signatures are required by default; an administrator can opt out.
+	if err := audit.SetSignaturesRequired(db, false); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	h.ReleaseDoc(w, testutil.AuthedRequest("POST", "/api/v1/docs/DOC-002/release", nil, token), "DOC-002")
+	if w.Code != 200 {
+		t.Fatalf("unsigned release with signatures optional: %d %s", w.Code, w.Body.String())
+	}
+}
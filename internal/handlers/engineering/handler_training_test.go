@@ -0,0 +1,147 @@
+package engineering_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+	"zrp/internal/training"
+)
+
+func TestTrainingQualification(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db)
+	cookie := testutil.LoginAdmin(t, db)
+	testutil.CreateTestUser(t, db, "tech", "password123", "user", true)
+	testutil.CreateTestUser(t, db, "lapsed", "password123", "user", true)
+
+	post := func(handle func(w *httptest.ResponseRecorder, body []byte), body string, code int, v interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handle(w, []byte(body))
+		if w.Code != code {
+			t.Fatalf("expected %d, got %d: %s", code, w.Code, w.Body.String())
+		}
+		if v != nil {
+			testutil.DecodeEnvelope(t, w, v)
+		}
+	}
+	createDoc := func(w *httptest.ResponseRecorder, b []byte) {
+		h.CreateDoc(w, testutil.AuthedRequest("POST", "/api/v1/docs", b, cookie))
+	}
+	createReq := func(w *httptest.ResponseRecorder, b []byte) {
+		h.CreateTrainingRequirement(w, testutil.AuthedRequest("POST", "/api/v1/training/requirements", b, cookie))
+	}
+	createRecord := func(w *httptest.ResponseRecorder, b []byte) {
+		h.CreateTrainingRecord(w, testutil.AuthedRequest("POST", "/api/v1/training/records", b, cookie))
+	}
+	qualification := func(username string) models.Qualification {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.GetQualification(w, testutil.AuthedRequest("GET", "/api/v1/training/qualification?username="+username+"&ipn=ASY-100&activity=test", nil, cookie))
+		if w.Code != 200 {
+			t.Fatalf("qualification: %d %s", w.Code, w.Body.String())
+		}
+		var q models.Qualification
+		testutil.DecodeEnvelope(t, w, &q)
+		return q
+	}
+
+	var doc models.Document
+	post(createDoc, `{"title":"ASY-100 functional test procedure","revision":"A"}`, 200, &doc)
+
+	post(createReq, `{"document_id":"`+doc.ID+`","ipn":"ASY-100","activity":"inspect"}`, 400, nil)
+	post(createReq, `{"document_id":"DOC-999","ipn":"ASY-100","activity":"test"}`, 404, nil)
+	var req models.TrainingRequirement
+	post(createReq, `{"document_id":"`+doc.ID+`","ipn":"ASY-100","activity":"test","valid_months":12}`, 200, &req)
+	if req.Revision != "A" {
+		t.Errorf("requirement revision = %q", req.Revision)
+	}
+	post(createReq, `{"document_id":"`+doc.ID+`","ipn":"ASY-100","activity":"test"}`, 409, nil)
+
+	// Untrained users are blocked; IPNs without requirements are not gated.
+	if q := qualification("tech"); q.Qualified || len(q.Gaps) != 1 || q.Gaps[0].Reason != "untrained" {
+		t.Errorf("untrained qualification = %+v", q)
+	}
+	var nq *training.NotQualifiedError
+	if err := training.Require(db, "tech", "ASY-100", training.ActivityTest); !errors.As(err, &nq) {
+		t.Errorf("Require = %v", err)
+	}
+	if err := training.Require(db, "tech", "ASY-100", training.ActivityBuild); err != nil {
+		t.Errorf("build is not gated: %v", err)
+	}
+
+	post(createRecord, `{"username":"nobody","document_id":"`+doc.ID+`"}`, 404, nil)
+	var rec models.TrainingRecord
+	post(createRecord, `{"username":"tech","document_id":"`+doc.ID+`","trainer":"admin"}`, 200, &rec)
+	wantExpiry := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+	if rec.Revision != "A" || rec.ExpiresAt == nil || *rec.ExpiresAt != wantExpiry {
+		t.Errorf("record = %+v", rec)
+	}
+	if q := qualification("tech"); !q.Qualified {
+		t.Errorf("trained qualification = %+v", q)
+	}
+
+	// Expired training no longer qualifies.
+	post(createRecord, `{"username":"lapsed","document_id":"`+doc.ID+`","completed_at":"2024-01-10","expires_at":"2025-01-10"}`, 200, nil)
+	if q := qualification("lapsed"); q.Qualified || q.Gaps[0].Reason != "expired" || q.Gaps[0].ExpiredAt != "2025-01-10" {
+		t.Errorf("expired qualification = %+v", q)
+	}
+
+	// Releasing revision B opens retraining tasks for everyone trained on A.
+	w := httptest.NewRecorder()
+	h.UpdateDoc(w, testutil.AuthedRequest("PUT", "/api/v1/docs/"+doc.ID, []byte(`{"title":"ASY-100 functional test procedure","revision":"B"}`), cookie), doc.ID)
+	w = httptest.NewRecorder()
+	h.ReleaseDoc(w, testutil.AuthedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", []byte(`{"password":"changeme"}`), cookie), doc.ID)
+	if w.Code != 200 {
+		t.Fatalf("release: %d %s", w.Code, w.Body.String())
+	}
+	// Training on A still counts until the retraining task is due.
+	if q := qualification("tech"); !q.Qualified {
+		t.Errorf("qualification during retraining window = %+v", q)
+	}
+	if q := qualification("lapsed"); q.Qualified {
+		t.Errorf("expired training must not get a retraining window: %+v", q)
+	}
+	db.Exec("UPDATE training_tasks SET due_date=? WHERE username='tech'", time.Now().AddDate(0, 0, -1).Format("2006-01-02"))
+	q := qualification("tech")
+	if q.Qualified || q.Gaps[0].Reason != "revision" || q.Gaps[0].Revision != "B" || q.Gaps[0].TrainedRevision != "A" {
+		t.Errorf("qualification after retraining due date = %+v", q)
+	}
+	var tasks []models.TrainingTask
+	w = httptest.NewRecorder()
+	h.ListTrainingTasks(w, testutil.AuthedRequest("GET", "/api/v1/training/tasks?status=open", nil, cookie))
+	testutil.DecodeEnvelope(t, w, &tasks)
+	if len(tasks) != 2 || tasks[0].Reason != "revision" || tasks[0].Revision != "B" || tasks[0].DueDate == "" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	var notified int
+	db.QueryRow("SELECT COUNT(*) FROM notifications WHERE type='training_due' AND user_id='tech'").Scan(&notified)
+	if notified != 1 {
+		t.Errorf("tech got %d notifications", notified)
+	}
+
+	// Re-releasing the same revision does not open more tasks.
+	w = httptest.NewRecorder()
+	h.ReleaseDoc(w, testutil.AuthedRequest("POST", "/api/v1/docs/"+doc.ID+"/release", []byte(`{"password":"changeme"}`), cookie), doc.ID)
+	db.QueryRow("SELECT COUNT(*) FROM training_tasks").Scan(&notified)
+	if notified != 2 {
+		t.Errorf("re-release made %d tasks", notified)
+	}
+
+	// Training on B completes the task and restores the qualification.
+	post(createRecord, `{"username":"tech","document_id":"`+doc.ID+`"}`, 200, &rec)
+	var status string
+	var recordID int
+	db.QueryRow("SELECT status, COALESCE(record_id,0) FROM training_tasks WHERE username='tech'").Scan(&status, &recordID)
+	if status != "completed" || recordID != rec.ID {
+		t.Errorf("task status %q record %d", status, recordID)
+	}
+	if q := qualification("tech"); !q.Qualified {
+		t.Errorf("retrained qualification = %+v", q)
+	}
+}
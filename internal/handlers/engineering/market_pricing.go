@@ -11,7 +11,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
 )
 
 // MarketPricingResult represents pricing data from a distributor.
@@ -29,7 +28,10 @@ type MarketPricingResult struct {
 	PriceBreaks   []PriceBreak `json:"price_breaks"`
 	ProductURL    string       `json:"product_url"`
 	DatasheetURL  string       `json:"datasheet_url"`
-	FetchedAt     string       `json:"fetched_at"`
+	// LifecycleStatus is the distributor's product status, such as
+	// "Active", "Not For New Designs" or "Obsolete".
+	LifecycleStatus string `json:"lifecycle_status"`
+	FetchedAt       string `json:"fetched_at"`
 }
 
 // PriceBreak represents a quantity-based price tier.
@@ -151,7 +153,10 @@ func (d *digikeyClient) Search(mpn string) ([]MarketPricingResult, error) {
 			ManufacturerLeadWeeks string `json:"ManufacturerLeadWeeks"`
 			ProductUrl            string `json:"ProductUrl"`
 			DatasheetUrl          string `json:"DatasheetUrl"`
-			StandardPricing       []struct {
+			ProductStatus         struct {
+				Status string `json:"Status"`
+			} `json:"ProductStatus"`
+			StandardPricing []struct {
 				BreakQuantity int     `json:"BreakQuantity"`
 				UnitPrice     float64 `json:"UnitPrice"`
 			} `json:"StandardPricing"`
@@ -178,18 +183,19 @@ func (d *digikeyClient) Search(mpn string) ([]MarketPricingResult, error) {
 		}
 
 		results = append(results, MarketPricingResult{
-			MPN:           p.ManufacturerPartNumber,
-			Distributor:   "Digikey",
-			DistributorPN: p.DigiKeyPartNumber,
-			Manufacturer:  p.Manufacturer.Name,
-			Description:   p.ProductDescription,
-			StockQty:      p.QuantityAvailable,
-			LeadTimeDays:  leadDays,
-			Currency:      "USD",
-			PriceBreaks:   pbs,
-			ProductURL:    p.ProductUrl,
-			DatasheetURL:  p.DatasheetUrl,
-			FetchedAt:     time.Now().UTC().Format(time.RFC3339),
+			MPN:             p.ManufacturerPartNumber,
+			Distributor:     "Digikey",
+			DistributorPN:   p.DigiKeyPartNumber,
+			Manufacturer:    p.Manufacturer.Name,
+			Description:     p.ProductDescription,
+			StockQty:        p.QuantityAvailable,
+			LeadTimeDays:    leadDays,
+			Currency:        "USD",
+			PriceBreaks:     pbs,
+			ProductURL:      p.ProductUrl,
+			DatasheetURL:    p.DatasheetUrl,
+			LifecycleStatus: p.ProductStatus.Status,
+			FetchedAt:       time.Now().UTC().Format(time.RFC3339),
 		})
 	}
 	return results, nil
@@ -256,6 +262,7 @@ func (m *mouserClient) Search(mpn string) ([]MarketPricingResult, error) {
 				LeadTime               string `json:"LeadTime"`
 				ProductDetailUrl       string `json:"ProductDetailUrl"`
 				DataSheetUrl           string `json:"DataSheetUrl"`
+				LifecycleStatus        string `json:"LifecycleStatus"`
 				PriceBreaks            []struct {
 					Quantity int    `json:"Quantity"`
 					Price    string `json:"Price"`
@@ -289,18 +296,19 @@ func (m *mouserClient) Search(mpn string) ([]MarketPricingResult, error) {
 		leadDays := ParseMouserLeadTime(p.LeadTime)
 
 		results = append(results, MarketPricingResult{
-			MPN:           p.ManufacturerPartNumber,
-			Distributor:   "Mouser",
-			DistributorPN: p.MouserPartNumber,
-			Manufacturer:  p.Manufacturer,
-			Description:   p.Description,
-			StockQty:      stock,
-			LeadTimeDays:  leadDays,
-			Currency:      "USD",
-			PriceBreaks:   pbs,
-			ProductURL:    p.ProductDetailUrl,
-			DatasheetURL:  p.DataSheetUrl,
-			FetchedAt:     time.Now().UTC().Format(time.RFC3339),
+			MPN:             p.ManufacturerPartNumber,
+			Distributor:     "Mouser",
+			DistributorPN:   p.MouserPartNumber,
+			Manufacturer:    p.Manufacturer,
+			Description:     p.Description,
+			StockQty:        stock,
+			LeadTimeDays:    leadDays,
+			Currency:        "USD",
+			PriceBreaks:     pbs,
+			ProductURL:      p.ProductDetailUrl,
+			DatasheetURL:    p.DataSheetUrl,
+			LifecycleStatus: p.LifecycleStatus,
+			FetchedAt:       time.Now().UTC().Format(time.RFC3339),
 		})
 	}
 	return results, nil
@@ -362,7 +370,8 @@ func Truncate(s string, maxLen int) string {
 func (h *Handler) GetCachedPricing(partIPN string) ([]MarketPricingResult, error) {
 	cutoff := time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC3339)
 	rows, err := h.DB.Query(`SELECT id, part_ipn, mpn, distributor, distributor_pn, manufacturer,
-		description, stock_qty, lead_time_days, currency, price_breaks, product_url, datasheet_url, fetched_at
+		description, stock_qty, lead_time_days, currency, price_breaks, product_url, datasheet_url,
+		COALESCE(lifecycle_status,''), fetched_at
 		FROM market_pricing WHERE part_ipn = ? AND fetched_at > ?`, partIPN, cutoff)
 	if err != nil {
 		return nil, err
@@ -375,7 +384,7 @@ func (h *Handler) GetCachedPricing(partIPN string) ([]MarketPricingResult, error
 		var pb string
 		err := rows.Scan(&r.ID, &r.PartIPN, &r.MPN, &r.Distributor, &r.DistributorPN,
 			&r.Manufacturer, &r.Description, &r.StockQty, &r.LeadTimeDays,
-			&r.Currency, &pb, &r.ProductURL, &r.DatasheetURL, &r.FetchedAt)
+			&r.Currency, &pb, &r.ProductURL, &r.DatasheetURL, &r.LifecycleStatus, &r.FetchedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -390,10 +399,10 @@ func (h *Handler) CachePricingResult(r MarketPricingResult) error {
 	pb, _ := json.Marshal(r.PriceBreaks)
 	_, err := h.DB.Exec(`INSERT OR REPLACE INTO market_pricing
 		(part_ipn, mpn, distributor, distributor_pn, manufacturer, description,
-		 stock_qty, lead_time_days, currency, price_breaks, product_url, datasheet_url, fetched_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		 stock_qty, lead_time_days, currency, price_breaks, product_url, datasheet_url, lifecycle_status, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		r.PartIPN, r.MPN, r.Distributor, r.DistributorPN, r.Manufacturer, r.Description,
-		r.StockQty, r.LeadTimeDays, r.Currency, string(pb), r.ProductURL, r.DatasheetURL, r.FetchedAt)
+		r.StockQty, r.LeadTimeDays, r.Currency, string(pb), r.ProductURL, r.DatasheetURL, r.LifecycleStatus, r.FetchedAt)
 	return err
 }
 
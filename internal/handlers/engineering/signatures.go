@@ -0,0 +1,151 @@
+package engineering
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+)
+
+// decodeSignature reads the optional signature fields (password, meaning,
+// reason) of an approval body; an empty body signs nothing.
+func decodeSignature(r *http.Request) (audit.SignatureRequest, error) {
+	var sig audit.SignatureRequest
+	if err := response.DecodeBody(r, &sig); err != nil && err != io.EOF {
+		return sig, err
+	}
+	return sig, nil
+}
+
+func (h *Handler) loadECO(id string) (models.ECO, error) {
+	var e models.ECO
+	err := h.DB.QueryRow("SELECT id,title,COALESCE(description,''),COALESCE(status,''),COALESCE(priority,''),COALESCE(affected_ipns,''),COALESCE(created_by,''),COALESCE(created_at,''),COALESCE(updated_at,'') FROM ecos WHERE id=?", id).
+		Scan(&e.ID, &e.Title, &e.Description, &e.Status, &e.Priority, &e.AffectedIPNs, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt)
+	return e, err
+}
+
+func (h *Handler) loadDoc(id string) (models.Document, error) {
+	var d models.Document
+	err := h.DB.QueryRow("SELECT id,title,COALESCE(category,''),COALESCE(ipn,''),revision,status,COALESCE(content,''),COALESCE(file_path,''),created_by,created_at,updated_at FROM documents WHERE id=?", id).
+		Scan(&d.ID, &d.Title, &d.Category, &d.IPN, &d.Revision, &d.Status, &d.Content, &d.FilePath, &d.CreatedBy, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+// ecoSignedContent is what a signature on an ECO binds: the change
+// itself, not its workflow status.
+func ecoSignedContent(e models.ECO) map[string]string {
+	return map[string]string{"id": e.ID, "title": e.Title, "description": e.Description,
+		"priority": e.Priority, "affected_ipns": e.AffectedIPNs}
+}
+
+// docSignedContent is what a signature on a document binds: the
+// revision and its content.
+func docSignedContent(d models.Document) map[string]string {
+	return map[string]string{"id": d.ID, "title": d.Title, "category": d.Category, "ipn": d.IPN,
+		"revision": d.Revision, "content": d.Content, "file_path": d.FilePath}
+}
+
+// ECOSignatures handles GET /api/ecos/:id/signatures.
+func (h *Handler) ECOSignatures(w http.ResponseWriter, r *http.Request, id string) {
+	e, err := h.loadECO(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	response.JSON(w, audit.Signatures(h.DB, "eco", id, ecoSignedContent(e)))
+}
+
+// DocSignatures handles GET /api/docs/:id/signatures.
+func (h *Handler) DocSignatures(w http.ResponseWriter, r *http.Request, id string) {
+	d, err := h.loadDoc(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	response.JSON(w, audit.Signatures(h.DB, "document", id, docSignedContent(d)))
+}
+
+const printStyle = `<style>
+  * { margin: 0; padding: 0; box-sizing: border-box; }
+  body { font-family: Arial, Helvetica, sans-serif; font-size: 11pt; color: #000; padding: 0.5in; }
+  h1 { font-size: 18pt; margin-bottom: 2pt; }
+  h2 { font-size: 13pt; margin: 16pt 0 6pt; border-bottom: 2px solid #000; padding-bottom: 3pt; }
+  table { width: 100%; border-collapse: collapse; margin-bottom: 12pt; }
+  th, td { border: 1px solid #000; padding: 4pt 6pt; text-align: left; font-size: 10pt; }
+  th { background: #eee; font-weight: bold; }
+  .header { display: flex; justify-content: space-between; align-items: flex-start; border-bottom: 3px solid #000; padding-bottom: 8pt; margin-bottom: 12pt; }
+  .info-grid { display: grid; grid-template-columns: auto 1fr; gap: 4pt 12pt; margin-bottom: 12pt; font-size: 10pt; }
+  .info-grid dt { font-weight: bold; }
+  .content { white-space: pre-wrap; font-size: 10pt; }
+  @media print { body { padding: 0; } @page { margin: 0.5in; } }
+</style>`
+
+// writePrintPage writes a printable record: a header, a field grid, an
+// optional body text and the signature manifest.
+func writePrintPage(w http.ResponseWriter, kind, id, status string, fields [][2]string, body string, sigs []models.ESignature) {
+	grid := ""
+	for _, f := range fields {
+		grid += fmt.Sprintf("  <dt>%s:</dt><dd>%s</dd>\n", html.EscapeString(f[0]), html.EscapeString(f[1]))
+	}
+	content := ""
+	if body != "" {
+		content = `<h2>Content</h2>
+<div class="content">` + html.EscapeString(body) + "</div>\n"
+	}
+	out := fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>%s — %s</title>
+%s
+</head><body>
+<div class="header">
+  <div><h1>ZRP — %s</h1></div>
+  <div style="text-align:right;font-size:10pt">
+    <div><strong>%s</strong></div>
+    <div><strong>Status:</strong> %s</div>
+  </div>
+</div>
+<div class="info-grid">
+%s</div>
+%s%s
+<script>window.onload = () => window.print()</script>
+</body></html>`,
+		html.EscapeString(kind), html.EscapeString(id), printStyle, html.EscapeString(kind),
+		html.EscapeString(id), html.EscapeString(status), grid, content, audit.SignatureManifestHTML(sigs))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write([]byte(out))
+}
+
+// ECOPDF handles GET /api/ecos/:id/pdf: a printable ECO with its
+// signature manifest.
+func (h *Handler) ECOPDF(w http.ResponseWriter, r *http.Request, id string) {
+	e, err := h.loadECO(id)
+	if err != nil {
+		http.Error(w, "ECO not found", 404)
+		return
+	}
+	writePrintPage(w, "Engineering Change Order", e.ID, e.Status, [][2]string{
+		{"Title", e.Title}, {"Priority", e.Priority}, {"Affected IPNs", e.AffectedIPNs},
+		{"Created by", e.CreatedBy}, {"Created", e.CreatedAt},
+	}, e.Description, audit.Signatures(h.DB, "eco", id, ecoSignedContent(e)))
+}
+
+// DocPDF handles GET /api/docs/:id/pdf: a printable document revision
+// with its signature manifest.
+func (h *Handler) DocPDF(w http.ResponseWriter, r *http.Request, id string) {
+	d, err := h.loadDoc(id)
+	if err != nil {
+		http.Error(w, "Document not found", 404)
+		return
+	}
+	writePrintPage(w, "Document", d.ID, d.Status, [][2]string{
+		{"Title", d.Title}, {"Category", d.Category}, {"IPN", d.IPN}, {"Revision", d.Revision},
+		{"File", d.FilePath}, {"Updated", d.UpdatedAt},
+	}, d.Content, audit.Signatures(h.DB, "document", id, docSignedContent(d)))
+}
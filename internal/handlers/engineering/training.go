@@ -0,0 +1,363 @@
+package engineering
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/training"
+	"zrp/internal/validation"
+)
+
+var validTrainingTaskStatuses = []string{"open", "completed", "cancelled"}
+
+// userExists reports whether username is a known user.
+func (h *Handler) userExists(username string) bool {
+	var n int
+	h.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username=?", username).Scan(&n)
+	return n > 0
+}
+
+// ListTrainingRequirements handles GET /api/training/requirements.
+func (h *Handler) ListTrainingRequirements(w http.ResponseWriter, r *http.Request) {
+	q := `SELECT t.id, t.document_id, COALESCE(d.title,''), t.ipn, t.activity, t.revision, t.valid_months,
+		COALESCE(t.created_by,''), t.created_at
+		FROM training_requirements t LEFT JOIN documents d ON d.id = t.document_id WHERE 1=1`
+	var args []interface{}
+	for _, f := range []string{"document_id", "ipn", "activity"} {
+		if v := r.URL.Query().Get(f); v != "" {
+			q += " AND t." + f + "=?"
+			args = append(args, v)
+		}
+	}
+	rows, err := h.DB.Query(q+" ORDER BY t.ipn, t.activity, t.document_id", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.TrainingRequirement{}
+	for rows.Next() {
+		var t models.TrainingRequirement
+		rows.Scan(&t.ID, &t.DocumentID, &t.DocumentTitle, &t.IPN, &t.Activity, &t.Revision, &t.ValidMonths, &t.CreatedBy, &t.CreatedAt)
+		items = append(items, t)
+	}
+	response.JSON(w, items)
+}
+
+// CreateTrainingRequirement handles POST /api/training/requirements.
+// The revision defaults to the document's current revision.
+func (h *Handler) CreateTrainingRequirement(w http.ResponseWriter, r *http.Request) {
+	var t models.TrainingRequirement
+	if err := response.DecodeBody(r, &t); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "document_id", t.DocumentID)
+	validation.RequireField(ve, "ipn", t.IPN)
+	validation.RequireField(ve, "activity", t.Activity)
+	validation.ValidateEnum(ve, "activity", t.Activity, training.Activities)
+	validation.ValidateIntRange(ve, "valid_months", t.ValidMonths, 0, 120)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	var docRev string
+	if err := h.DB.QueryRow("SELECT revision FROM documents WHERE id=?", t.DocumentID).Scan(&docRev); err != nil {
+		response.Err(w, "document not found", 404)
+		return
+	}
+	if t.Revision == "" {
+		t.Revision = docRev
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	res, err := h.DB.Exec("INSERT INTO training_requirements (document_id, ipn, activity, revision, valid_months, created_by) VALUES (?, ?, ?, ?, ?, ?)",
+		t.DocumentID, t.IPN, t.Activity, t.Revision, t.ValidMonths, username)
+	if err != nil {
+		response.Err(w, "requirement already exists", 409)
+		return
+	}
+	id, _ := res.LastInsertId()
+	t.ID = int(id)
+	t.CreatedBy = username
+	audit.LogAudit(h.DB, h.Hub, username, "created", "training", strconv.Itoa(t.ID),
+		fmt.Sprintf("Required %s rev %s to %s %s", t.DocumentID, t.Revision, t.Activity, t.IPN))
+	response.JSON(w, t)
+}
+
+// DeleteTrainingRequirement handles DELETE /api/training/requirements/:id.
+func (h *Handler) DeleteTrainingRequirement(w http.ResponseWriter, r *http.Request, id string) {
+	res, err := h.DB.Exec("DELETE FROM training_requirements WHERE id=?", id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, "not found", 404)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "deleted", "training", id, "Deleted training requirement "+id)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// ListTrainingRecords handles GET /api/training/records.
+func (h *Handler) ListTrainingRecords(w http.ResponseWriter, r *http.Request) {
+	q := `SELECT id, username, document_id, revision, CAST(completed_at AS TEXT), CAST(expires_at AS TEXT),
+		COALESCE(trainer,''), COALESCE(notes,''), COALESCE(created_by,''), created_at
+		FROM training_records WHERE 1=1`
+	var args []interface{}
+	for _, f := range []string{"username", "document_id"} {
+		if v := r.URL.Query().Get(f); v != "" {
+			q += " AND " + f + "=?"
+			args = append(args, v)
+		}
+	}
+	rows, err := h.DB.Query(q+" ORDER BY completed_at DESC, id DESC", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.TrainingRecord{}
+	for rows.Next() {
+		var t models.TrainingRecord
+		var expires sql.NullString
+		rows.Scan(&t.ID, &t.Username, &t.DocumentID, &t.Revision, &t.CompletedAt, &expires, &t.Trainer, &t.Notes, &t.CreatedBy, &t.CreatedAt)
+		if expires.Valid {
+			t.ExpiresAt = &expires.String
+		}
+		items = append(items, t)
+	}
+	response.JSON(w, items)
+}
+
+// CreateTrainingRecord handles POST /api/training/records. Revision
+// defaults to the document's current revision and completed_at to today.
+// Without an explicit expires_at the record expires after the shortest
+// valid_months of the document's requirements. Matching open tasks are
+// completed.
+func (h *Handler) CreateTrainingRecord(w http.ResponseWriter, r *http.Request) {
+	var t models.TrainingRecord
+	if err := response.DecodeBody(r, &t); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if t.CompletedAt == "" {
+		t.CompletedAt = time.Now().Format("2006-01-02")
+	}
+
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "username", t.Username)
+	validation.RequireField(ve, "document_id", t.DocumentID)
+	validation.ValidateDate(ve, "completed_at", t.CompletedAt)
+	if t.ExpiresAt != nil {
+		validation.ValidateDate(ve, "expires_at", *t.ExpiresAt)
+	}
+	validation.ValidateMaxLength(ve, "notes", t.Notes, 2000)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if !h.userExists(t.Username) {
+		response.Err(w, "user not found", 404)
+		return
+	}
+	var docRev string
+	if err := h.DB.QueryRow("SELECT revision FROM documents WHERE id=?", t.DocumentID).Scan(&docRev); err != nil {
+		response.Err(w, "document not found", 404)
+		return
+	}
+	if t.Revision == "" {
+		t.Revision = docRev
+	}
+	if t.ExpiresAt == nil {
+		var months sql.NullInt64
+		h.DB.QueryRow("SELECT MIN(valid_months) FROM training_requirements WHERE document_id=? AND valid_months > 0", t.DocumentID).Scan(&months)
+		if months.Valid {
+			completed, _ := time.Parse("2006-01-02", t.CompletedAt)
+			exp := completed.AddDate(0, int(months.Int64), 0).Format("2006-01-02")
+			t.ExpiresAt = &exp
+		}
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	res, err := h.DB.Exec(`INSERT INTO training_records (username, document_id, revision, completed_at, expires_at, trainer, notes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, t.Username, t.DocumentID, t.Revision, t.CompletedAt, t.ExpiresAt, t.Trainer, t.Notes, username)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	t.ID = int(id)
+	t.CreatedBy = username
+	h.DB.Exec("UPDATE training_tasks SET status='completed', record_id=?, completed_at=CURRENT_TIMESTAMP WHERE username=? AND document_id=? AND revision=? AND status='open'",
+		t.ID, t.Username, t.DocumentID, t.Revision)
+	audit.LogAudit(h.DB, h.Hub, username, "created", "training", strconv.Itoa(t.ID),
+		fmt.Sprintf("Recorded %s trained on %s rev %s", t.Username, t.DocumentID, t.Revision))
+	response.JSON(w, t)
+}
+
+// ListTrainingTasks handles GET /api/training/tasks.
+func (h *Handler) ListTrainingTasks(w http.ResponseWriter, r *http.Request) {
+	q := `SELECT id, username, document_id, revision, reason, status, COALESCE(CAST(due_date AS TEXT),''),
+		record_id, created_at, completed_at FROM training_tasks WHERE 1=1`
+	var args []interface{}
+	for _, f := range []string{"username", "document_id", "status"} {
+		if v := r.URL.Query().Get(f); v != "" {
+			q += " AND " + f + "=?"
+			args = append(args, v)
+		}
+	}
+	rows, err := h.DB.Query(q+" ORDER BY status='open' DESC, due_date, id", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.TrainingTask{}
+	for rows.Next() {
+		var t models.TrainingTask
+		var recordID sql.NullInt64
+		var completed sql.NullString
+		rows.Scan(&t.ID, &t.Username, &t.DocumentID, &t.Revision, &t.Reason, &t.Status, &t.DueDate, &recordID, &t.CreatedAt, &completed)
+		if recordID.Valid {
+			id := int(recordID.Int64)
+			t.RecordID = &id
+		}
+		if completed.Valid {
+			t.CompletedAt = &completed.String
+		}
+		items = append(items, t)
+	}
+	response.JSON(w, items)
+}
+
+// CreateTrainingTask handles POST /api/training/tasks, assigning training on
+// a document to a user.
+func (h *Handler) CreateTrainingTask(w http.ResponseWriter, r *http.Request) {
+	var t models.TrainingTask
+	if err := response.DecodeBody(r, &t); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "username", t.Username)
+	validation.RequireField(ve, "document_id", t.DocumentID)
+	if t.DueDate != "" {
+		validation.ValidateDate(ve, "due_date", t.DueDate)
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if !h.userExists(t.Username) {
+		response.Err(w, "user not found", 404)
+		return
+	}
+	var docRev string
+	if err := h.DB.QueryRow("SELECT revision FROM documents WHERE id=?", t.DocumentID).Scan(&docRev); err != nil {
+		response.Err(w, "document not found", 404)
+		return
+	}
+	if t.Revision == "" {
+		t.Revision = docRev
+	}
+	var open int
+	h.DB.QueryRow("SELECT COUNT(*) FROM training_tasks WHERE username=? AND document_id=? AND revision=? AND status='open'",
+		t.Username, t.DocumentID, t.Revision).Scan(&open)
+	if open > 0 {
+		response.Err(w, "an open task already exists", 409)
+		return
+	}
+
+	res, err := h.DB.Exec("INSERT INTO training_tasks (username, document_id, revision, reason, due_date) VALUES (?, ?, ?, 'assigned', ?)",
+		t.Username, t.DocumentID, t.Revision, sql.NullString{String: t.DueDate, Valid: t.DueDate != ""})
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	t.ID, t.Reason, t.Status = int(id), "assigned", "open"
+	t.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	msg := fmt.Sprintf("You have been assigned training on %s rev %s.", t.DocumentID, t.Revision)
+	if t.DueDate != "" {
+		msg = fmt.Sprintf("You have been assigned training on %s rev %s, due %s.", t.DocumentID, t.Revision, t.DueDate)
+	}
+	h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module, user_id)
+		VALUES ('training_due', 'info', ?, ?, ?, 'training', ?)`,
+		fmt.Sprintf("Training assigned: %s rev %s", t.DocumentID, t.Revision), msg, t.DocumentID, t.Username)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "assigned", "training", strconv.Itoa(t.ID),
+		fmt.Sprintf("Assigned %s training on %s rev %s", t.Username, t.DocumentID, t.Revision))
+	response.JSON(w, t)
+}
+
+// UpdateTrainingTask handles PUT /api/training/tasks/:id. Only cancelling
+// an open task is allowed; tasks complete by recording training.
+func (h *Handler) UpdateTrainingTask(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	ve := &validation.ValidationErrors{}
+	validation.ValidateEnum(ve, "status", body.Status, validTrainingTaskStatuses)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if body.Status != "cancelled" {
+		response.Err(w, "tasks are completed by recording training", 400)
+		return
+	}
+	var status string
+	if err := h.DB.QueryRow("SELECT status FROM training_tasks WHERE id=?", id).Scan(&status); err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	if status != "open" {
+		response.Err(w, "task is "+status, 409)
+		return
+	}
+	h.DB.Exec("UPDATE training_tasks SET status='cancelled' WHERE id=?", id)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "cancelled", "training", id, "Cancelled training task "+id)
+	response.JSON(w, map[string]string{"status": "cancelled"})
+}
+
+// GetQualification handles GET /api/training/qualification?username=&ipn=&activity=.
+// The username defaults to the caller.
+func (h *Handler) GetQualification(w http.ResponseWriter, r *http.Request) {
+	q := models.Qualification{
+		Username: r.URL.Query().Get("username"),
+		IPN:      r.URL.Query().Get("ipn"),
+		Activity: r.URL.Query().Get("activity"),
+	}
+	if q.Username == "" {
+		q.Username = audit.GetUsername(h.DB, r)
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "ipn", q.IPN)
+	validation.RequireField(ve, "activity", q.Activity)
+	validation.ValidateEnum(ve, "activity", q.Activity, training.Activities)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	gaps, err := training.Check(h.DB, q.Username, q.IPN, q.Activity)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	q.Gaps, q.Qualified = gaps, len(gaps) == 0
+	response.JSON(w, q)
+}
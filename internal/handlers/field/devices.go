@@ -49,6 +49,8 @@ func (h *Handler) GetDevice(w http.ResponseWriter, r *http.Request, serial strin
 		return
 	}
 	d.LastSeen = database.SP(ls)
+	cov := h.coverage(serial, time.Now().Format("2006-01-02"))
+	d.Warranty = &cov
 	response.JSON(w, d)
 }
 
@@ -253,5 +255,22 @@ func (h *Handler) DeviceHistory(w http.ResponseWriter, r *http.Request, serial s
 			campaigns = append(campaigns, cd)
 		}
 	}
-	response.JSON(w, map[string]interface{}{"tests": tests, "campaigns": campaigns})
+	// Get service contracts covering the device
+	contracts := []models.ServiceContract{}
+	var customer string
+	h.DB.QueryRow("SELECT COALESCE(customer,'') FROM devices WHERE serial_number=?", serial).Scan(&customer)
+	rows3, _ := h.DB.Query("SELECT "+serviceContractColumns+` FROM service_contracts c
+		WHERE EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id AND d.serial_number=?)
+		OR (c.customer=? AND NOT EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id))
+		ORDER BY c.end_date DESC`, serial, customer)
+	if rows3 != nil {
+		defer rows3.Close()
+		for rows3.Next() {
+			if c, err := scanServiceContract(rows3); err == nil {
+				contracts = append(contracts, c)
+			}
+		}
+	}
+	warranty := h.coverage(serial, time.Now().Format("2006-01-02"))
+	response.JSON(w, map[string]interface{}{"tests": tests, "campaigns": campaigns, "warranty": warranty, "contracts": contracts})
 }
@@ -0,0 +1,486 @@
+package field
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// maxIntakeMessage caps the size of an inbound email.
+const maxIntakeMessage = 25 << 20
+
+// ErrIntakeDisabled is returned while no support address is configured.
+var ErrIntakeDisabled = errors.New("email intake is disabled: no support address configured")
+
+var (
+	reportRefPattern = regexp.MustCompile(`\[(FR-[A-Za-z0-9-]+)\]`)
+	serialToken      = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9_./-]{2,}`)
+	htmlTag          = regexp.MustCompile(`<[^>]*>`)
+)
+
+// EmailIntakeSettings configures the support mailbox that turns customer
+// email into field reports.
+type EmailIntakeSettings struct {
+	SupportAddress  string `json:"support_address"`
+	AutoAcknowledge bool   `json:"auto_acknowledge"`
+}
+
+// EmailIntakeResult says what became of an inbound email.
+type EmailIntakeResult struct {
+	ReportID     string   `json:"report_id"`
+	Created      bool     `json:"created"`
+	Duplicate    bool     `json:"duplicate,omitempty"`
+	Attachments  int      `json:"attachments"`
+	Skipped      []string `json:"skipped,omitempty"`
+	Acknowledged bool     `json:"acknowledged"`
+}
+
+func (h *Handler) emailIntakeSettings() EmailIntakeSettings {
+	var s EmailIntakeSettings
+	var ack string
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='email_intake_address'").Scan(&s.SupportAddress)
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='email_intake_auto_ack'").Scan(&ack)
+	s.AutoAcknowledge = ack == "true"
+	return s
+}
+
+// GetEmailIntakeSettings handles GET /api/settings/email-intake.
+func (h *Handler) GetEmailIntakeSettings(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, h.emailIntakeSettings())
+}
+
+// UpdateEmailIntakeSettings handles PUT /api/settings/email-intake.
+func (h *Handler) UpdateEmailIntakeSettings(w http.ResponseWriter, r *http.Request) {
+	var body EmailIntakeSettings
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	body.SupportAddress = strings.ToLower(strings.TrimSpace(body.SupportAddress))
+	ve := &validation.ValidationErrors{}
+	validation.ValidateEmail(ve, "support_address", body.SupportAddress)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	for key, value := range map[string]string{
+		"email_intake_address":  body.SupportAddress,
+		"email_intake_auto_ack": fmt.Sprintf("%t", body.AutoAcknowledge),
+	} {
+		if _, err := h.DB.Exec(`INSERT INTO app_settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value); err != nil {
+			response.Err(w, "failed to save setting", 500)
+			return
+		}
+	}
+	summary := "Disabled field report email intake"
+	if body.SupportAddress != "" {
+		summary = "Set field report email intake to " + body.SupportAddress
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "settings", "email-intake", summary)
+	response.JSON(w, body)
+}
+
+// AcceptsRecipient reports whether mail to addr is for the support mailbox.
+func (h *Handler) AcceptsRecipient(addr string) bool {
+	support := h.emailIntakeSettings().SupportAddress
+	return support != "" && strings.EqualFold(strings.Trim(strings.TrimSpace(addr), "<>"), support)
+}
+
+// inboundFile is an attachment carried by an inbound email.
+type inboundFile struct {
+	name, mimeType string
+	data           []byte
+}
+
+// decodePart undoes a part's Content-Transfer-Encoding.
+func decodePart(r io.Reader, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(r))
+	}
+	return io.ReadAll(r)
+}
+
+// walkPart collects the text and attachments of a MIME entity, descending
+// into multiparts. Plain text wins over HTML.
+func walkPart(header map[string][]string, body io.Reader, plain, html *string, files *[]inboundFile) error {
+	get := func(k string) string {
+		if v := header[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(p.Header, p, plain, html, files); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := decodePart(body, get("Content-Transfer-Encoding"))
+	if err != nil {
+		return err
+	}
+	disposition, dparams, _ := mime.ParseMediaType(get("Content-Disposition"))
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if dec, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = dec
+	}
+	switch {
+	case name != "" || disposition == "attachment":
+		if name == "" {
+			name = "attachment"
+		}
+		*files = append(*files, inboundFile{name: name, mimeType: mediaType, data: data})
+	case mediaType == "text/plain" && *plain == "":
+		*plain = string(data)
+	case mediaType == "text/html" && *html == "":
+		*html = string(data)
+	}
+	return nil
+}
+
+// messageIDs splits an In-Reply-To or References header into message IDs.
+func messageIDs(v string) []string {
+	var ids []string
+	for _, f := range strings.Fields(v) {
+		if f = strings.Trim(f, "<>,"); f != "" {
+			ids = append(ids, f)
+		}
+	}
+	return ids
+}
+
+// matchDevice finds the first installed device whose serial number is
+// mentioned in the text.
+func (h *Handler) matchDevice(text string) (serial, ipn, customer string) {
+	seen := map[string]bool{}
+	var tokens []string
+	for _, t := range serialToken.FindAllString(text, 500) {
+		t = strings.ToUpper(strings.TrimRight(t, "./-_"))
+		if len(t) >= 3 && !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return "", "", ""
+	}
+	args := make([]interface{}, len(tokens))
+	for i, t := range tokens {
+		args[i] = t
+	}
+	rows, err := h.DB.Query(`SELECT serial_number, COALESCE(ipn,''), COALESCE(customer,'') FROM devices
+		WHERE UPPER(serial_number) IN (?`+strings.Repeat(",?", len(tokens)-1)+`)`, args...)
+	if err != nil {
+		return "", "", ""
+	}
+	defer rows.Close()
+	best := len(tokens)
+	for rows.Next() {
+		var s, i, c string
+		rows.Scan(&s, &i, &c)
+		for pos, t := range tokens[:best] {
+			if t == strings.ToUpper(s) {
+				best, serial, ipn, customer = pos, s, i, c
+				break
+			}
+		}
+	}
+	return serial, ipn, customer
+}
+
+// matchCustomer finds the longest known customer name mentioned in the text.
+func (h *Handler) matchCustomer(text string) string {
+	text = strings.ToLower(text)
+	var names []string
+	for _, q := range []string{
+		"SELECT DISTINCT customer FROM devices WHERE COALESCE(customer,'')!=''",
+		"SELECT DISTINCT customer FROM sales_orders WHERE COALESCE(customer,'')!=''",
+		"SELECT DISTINCT customer FROM quotes WHERE COALESCE(customer,'')!=''",
+	} {
+		rows, err := h.DB.Query(q)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var n string
+			rows.Scan(&n)
+			names = append(names, n)
+		}
+		rows.Close()
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, n := range names {
+		if len(n) >= 3 && strings.Contains(text, strings.ToLower(n)) {
+			return n
+		}
+	}
+	return ""
+}
+
+// threadReport finds the report an email replies to, by its In-Reply-To
+// and References headers or a [FR-...] tag in the subject.
+func (h *Handler) threadReport(refs []string, subject string) string {
+	var id string
+	for _, ref := range refs {
+		if h.DB.QueryRow("SELECT report_id FROM field_report_emails WHERE message_id=? ORDER BY id LIMIT 1", ref).Scan(&id) == nil {
+			return id
+		}
+	}
+	if m := reportRefPattern.FindStringSubmatch(subject); m != nil {
+		if h.DB.QueryRow("SELECT id FROM field_reports WHERE id=?", m[1]).Scan(&id) == nil {
+			return id
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// IngestEmail files a raw RFC 5322 message sent to the support address:
+// a reply is threaded onto its field report, anything else opens a new
+// report against the device and customer named in it. The message and
+// its attachments are kept as attachments of the report. rcpt is the SMTP
+// envelope recipient list; when empty the To and Cc headers are checked.
+func (h *Handler) IngestEmail(raw []byte, rcpt []string) (EmailIntakeResult, error) {
+	var res EmailIntakeResult
+	settings := h.emailIntakeSettings()
+	if settings.SupportAddress == "" {
+		return res, ErrIntakeDisabled
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return res, fmt.Errorf("invalid message: %w", err)
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return res, fmt.Errorf("invalid From header: %w", err)
+	}
+	from.Address = strings.ToLower(from.Address)
+
+	if len(rcpt) == 0 {
+		for _, k := range []string{"To", "Cc"} {
+			list, _ := msg.Header.AddressList(k)
+			for _, a := range list {
+				rcpt = append(rcpt, a.Address)
+			}
+		}
+	}
+	addressed := false
+	for _, a := range rcpt {
+		addressed = addressed || h.AcceptsRecipient(a)
+	}
+	if !addressed {
+		return res, fmt.Errorf("message is not addressed to %s", settings.SupportAddress)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	subject = strings.TrimSpace(subject)
+	messageID := strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>")
+	if messageID != "" {
+		var existing string
+		if h.DB.QueryRow("SELECT report_id FROM field_report_emails WHERE message_id=? AND direction='inbound'", messageID).Scan(&existing) == nil {
+			res.ReportID, res.Duplicate = existing, true
+			return res, nil
+		}
+	}
+
+	var plain, html string
+	var files []inboundFile
+	if err := walkPart(msg.Header, msg.Body, &plain, &html, &files); err != nil {
+		return res, fmt.Errorf("invalid message body: %w", err)
+	}
+	if plain == "" && html != "" {
+		plain = htmlTag.ReplaceAllString(html, " ")
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(plain, "\r\n", "\n"))
+
+	inReplyTo := messageIDs(msg.Header.Get("In-Reply-To"))
+	now := time.Now().Format("2006-01-02 15:04:05")
+	reportID := h.threadReport(append(inReplyTo, messageIDs(msg.Header.Get("References"))...), subject)
+	if reportID == "" {
+		fr := models.FieldReport{
+			ID:          h.NextIDFunc("FR", "field_reports", 3),
+			Title:       truncate(subject, 255),
+			ReportType:  "failure",
+			Status:      "open",
+			Priority:    "medium",
+			ReportedBy:  from.Address,
+			ReportedAt:  now,
+			Description: truncate(text, 1000),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if fr.Title == "" {
+			fr.Title = "Email from " + from.Address
+		}
+		if d, err := msg.Header.Date(); err == nil {
+			fr.ReportedAt = d.Local().Format("2006-01-02 15:04:05")
+		}
+		fr.DeviceSerial, fr.DeviceIPN, fr.CustomerName = h.matchDevice(subject + "\n" + text)
+		if fr.CustomerName == "" {
+			fr.CustomerName = h.matchCustomer(subject + "\n" + text + "\n" + from.Name)
+		}
+		var cov models.WarrantyStatus
+		if fr.DeviceSerial != "" {
+			cov = h.coverage(fr.DeviceSerial, fr.ReportedAt)
+		}
+		if _, err := h.DB.Exec(`INSERT INTO field_reports (id,title,report_type,status,priority,customer_name,
+			device_ipn,device_serial,reported_by,reported_at,description,warranty,contract_id,created_at,updated_at)
+			VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			fr.ID, fr.Title, fr.ReportType, fr.Status, fr.Priority, fr.CustomerName,
+			fr.DeviceIPN, fr.DeviceSerial, fr.ReportedBy, fr.ReportedAt, fr.Description,
+			cov.Status, cov.ContractID, fr.CreatedAt, fr.UpdatedAt); err != nil {
+			return res, err
+		}
+		reportID, res.Created = fr.ID, true
+		audit.LogAudit(h.DB, h.Hub, from.Address, "created", "field_report", fr.ID, "Created "+fr.ID+" from email: "+fr.Title)
+		h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module)
+			VALUES ('field_report_email', 'info', ?, ?, ?, 'field-reports')`,
+			fmt.Sprintf("New field report %s by email", fr.ID), fmt.Sprintf("%s: %s", from.Address, fr.Title), fr.ID)
+	} else {
+		h.DB.Exec("UPDATE field_reports SET updated_at=? WHERE id=?", now, reportID)
+		audit.LogAudit(h.DB, h.Hub, from.Address, "email_reply", "field_report", reportID, "Email reply from "+from.Address)
+		h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module)
+			VALUES ('field_report_email', 'info', ?, ?, ?, 'field-reports')`,
+			fmt.Sprintf("Email reply on %s", reportID), fmt.Sprintf("%s: %s", from.Address, subject), reportID)
+	}
+	res.ReportID = reportID
+
+	inReply := ""
+	if len(inReplyTo) > 0 {
+		inReply = inReplyTo[0]
+	}
+	ins, err := h.DB.Exec(`INSERT INTO field_report_emails (report_id, direction, message_id, in_reply_to, from_address, from_name,
+		to_address, subject, body, created_at) VALUES (?, 'inbound', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		reportID, messageID, inReply, from.Address, from.Name, settings.SupportAddress, subject, text, now)
+	if err != nil {
+		return res, err
+	}
+	emailID, _ := ins.LastInsertId()
+
+	if h.StoreAttachment != nil {
+		all := append([]inboundFile{{name: fmt.Sprintf("email-%d.eml", emailID), mimeType: "message/rfc822", data: raw}}, files...)
+		for _, f := range all {
+			if err := h.StoreAttachment("field_report", reportID, f.name, f.mimeType, f.data, from.Address); err != nil {
+				res.Skipped = append(res.Skipped, f.name)
+				continue
+			}
+			res.Attachments++
+		}
+		h.DB.Exec("UPDATE field_report_emails SET attachment_count=? WHERE id=?", res.Attachments, emailID)
+	}
+
+	// Only new reports are acknowledged, and never to mail robots or to
+	// ourselves, so two auto-responders cannot loop.
+	auto := strings.ToLower(msg.Header.Get("Auto-Submitted"))
+	precedence := strings.ToLower(msg.Header.Get("Precedence"))
+	robot := (auto != "" && auto != "no") || precedence == "bulk" || precedence == "junk" || precedence == "list" ||
+		precedence == "auto_reply" || from.Address == settings.SupportAddress
+	if res.Created && settings.AutoAcknowledge && h.SendEmail != nil && !robot {
+		ackSubject := fmt.Sprintf("Re: %s [%s]", subject, reportID)
+		if subject == "" {
+			ackSubject = fmt.Sprintf("Your report [%s]", reportID)
+		}
+		ackBody := fmt.Sprintf("Thank you for contacting us. Your report has been logged as %s and our team will follow up.\n\n"+
+			"To add details, reply to this email and keep [%s] in the subject.\n\n— ZRP", reportID, reportID)
+		if err := h.SendEmail(from.Address, ackSubject, ackBody); err != nil {
+			log.Printf("field report %s: acknowledgement to %s failed: %v", reportID, from.Address, err)
+		} else {
+			res.Acknowledged = true
+			h.DB.Exec(`INSERT INTO field_report_emails (report_id, direction, from_address, to_address, subject, body, created_at)
+				VALUES (?, 'outbound', ?, ?, ?, ?, ?)`, reportID, settings.SupportAddress, from.Address, ackSubject, ackBody, now)
+		}
+	}
+	return res, nil
+}
+
+// ReceiveFieldReportEmail handles POST /api/field-reports/inbound: a raw
+// RFC 5322 message relayed by a mail gateway or poller.
+func (h *Handler) ReceiveFieldReportEmail(w http.ResponseWriter, r *http.Request) {
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIntakeMessage))
+	if err != nil {
+		response.Err(w, "message too large", 413)
+		return
+	}
+	res, err := h.IngestEmail(raw, nil)
+	if errors.Is(err, ErrIntakeDisabled) {
+		response.Err(w, err.Error(), 409)
+		return
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	response.JSON(w, res)
+}
+
+// ListFieldReportEmails handles GET /api/field-reports/:id/emails.
+func (h *Handler) ListFieldReportEmails(w http.ResponseWriter, r *http.Request, id string) {
+	rows, err := h.DB.Query(`SELECT id, report_id, direction, COALESCE(message_id,''), COALESCE(in_reply_to,''),
+		from_address, COALESCE(from_name,''), COALESCE(to_address,''), COALESCE(subject,''), COALESCE(body,''),
+		attachment_count, created_at FROM field_report_emails WHERE report_id=? ORDER BY id`, id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.FieldReportEmail{}
+	for rows.Next() {
+		var e models.FieldReportEmail
+		rows.Scan(&e.ID, &e.ReportID, &e.Direction, &e.MessageID, &e.InReplyTo, &e.FromAddress, &e.FromName,
+			&e.ToAddress, &e.Subject, &e.Body, &e.AttachmentCount, &e.CreatedAt)
+		items = append(items, e)
+	}
+	response.JSON(w, items)
+}
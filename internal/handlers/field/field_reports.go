@@ -89,6 +89,7 @@ func (h *Handler) GetFieldReport(w http.ResponseWriter, r *http.Request, id stri
 		return
 	}
 	fr.ResolvedAt = database.SP(ra)
+	h.DB.QueryRow("SELECT COALESCE(warranty,''), COALESCE(contract_id,'') FROM field_reports WHERE id=?", id).Scan(&fr.Warranty, &fr.ContractID)
 	response.JSON(w, fr)
 }
 
@@ -139,6 +140,21 @@ func (h *Handler) CreateFieldReport(w http.ResponseWriter, r *http.Request) {
 	if fr.ReportedAt == "" {
 		fr.ReportedAt = now
 	}
+	// Reports against a known unit pick up its product and customer, and
+	// record whether it was covered when the problem was reported.
+	var cov models.WarrantyStatus
+	if fr.DeviceSerial != "" {
+		var ipn, customer string
+		if h.DB.QueryRow("SELECT COALESCE(ipn,''), COALESCE(customer,'') FROM devices WHERE serial_number=?", fr.DeviceSerial).Scan(&ipn, &customer) == nil {
+			if fr.DeviceIPN == "" {
+				fr.DeviceIPN = ipn
+			}
+			if fr.CustomerName == "" {
+				fr.CustomerName = customer
+			}
+		}
+		cov = h.coverage(fr.DeviceSerial, fr.ReportedAt)
+	}
 
 	_, err := h.DB.Exec(`INSERT INTO field_reports (id,title,report_type,status,priority,customer_name,
 		site_location,device_ipn,device_serial,reported_by,reported_at,description,
@@ -151,6 +167,11 @@ func (h *Handler) CreateFieldReport(w http.ResponseWriter, r *http.Request) {
 		response.Err(w, err.Error(), 500)
 		return
 	}
+	if fr.DeviceSerial != "" {
+		if _, err := h.DB.Exec("UPDATE field_reports SET warranty=?, contract_id=? WHERE id=?", cov.Status, cov.ContractID, fr.ID); err == nil {
+			fr.Warranty, fr.ContractID = cov.Status, cov.ContractID
+		}
+	}
 	username := audit.GetUsername(h.DB, r)
 	audit.LogAudit(h.DB, h.Hub, username, "created", "field_report", fr.ID, "Created "+fr.ID+": "+fr.Title)
 	response.JSON(w, fr)
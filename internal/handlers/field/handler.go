@@ -2,7 +2,9 @@ package field
 
 import (
 	"database/sql"
+	"net/http"
 
+	"zrp/internal/models"
 	"zrp/internal/websocket"
 )
 
@@ -22,4 +24,18 @@ type Handler struct {
 
 	// GetRMASnapshot returns a snapshot of an RMA row.
 	GetRMASnapshot func(id string) (map[string]interface{}, error)
+
+	// CreateShipment saves a new shipment through the shipments module,
+	// filling in its ID.
+	CreateShipment func(s *models.Shipment) error
+
+	// SendEmail sends a plain-text email with the configured SMTP settings.
+	SendEmail func(to, subject, body string) error
+
+	// StoreAttachment saves a file on a record through the attachments module.
+	StoreAttachment func(module, recordID, name, mimeType string, data []byte, uploadedBy string) error
+
+	// ExportCSV and ExportExcel write tabular exports.
+	ExportCSV   func(w http.ResponseWriter, filename string, headers []string, data [][]string)
+	ExportExcel func(w http.ResponseWriter, sheetName string, headers []string, data [][]string)
 }
@@ -0,0 +1,153 @@
+package field_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/field"
+	"zrp/internal/models"
+)
+
+func TestEmailIntake(t *testing.T) {
+	db, h, _ := setupRMARepairHandler(t)
+	type sent struct{ to, subject string }
+	var acks []sent
+	var stored []string
+	h.SendEmail = func(to, subject, body string) error {
+		acks = append(acks, sent{to, subject})
+		return nil
+	}
+	h.StoreAttachment = func(module, recordID, name, mimeType string, data []byte, uploadedBy string) error {
+		if strings.HasSuffix(name, ".exe") {
+			return errors.New("file type not allowed")
+		}
+		stored = append(stored, module+"/"+recordID+"/"+name)
+		return nil
+	}
+	db.Exec(`INSERT INTO devices (serial_number, ipn, customer, status, install_date) VALUES ('SN-1001','ASY-100','Acme Robotics','active','2026-01-01')`)
+	db.Exec(`INSERT INTO quotes (id, customer) VALUES ('Q-001', 'Beta Corp')`)
+
+	complaint := strings.ReplaceAll(`From: Jane Doe <Jane@Acme.example>
+To: Support <support@zrp.test>
+Subject: Unit keeps rebooting
+Message-ID: <m1@acme.example>
+Date: Mon, 12 Oct 2026 09:30:00 +0000
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Our unit sn-1001 reboots every hour since the last =
+update.
+--b1
+Content-Type: image/jpeg; name="photo.jpg"
+Content-Disposition: attachment; filename="photo.jpg"
+Content-Transfer-Encoding: base64
+
+/9j/4AAQSkZJRg==
+--b1
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="tool.exe"
+
+MZ
+--b1--
+`, "\n", "\r\n")
+
+	if _, err := h.IngestEmail([]byte(complaint), nil); !errors.Is(err, field.ErrIntakeDisabled) {
+		t.Fatalf("expected intake disabled, got %v", err)
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateEmailIntakeSettings(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"support_address":"not-an-address"}`)))
+	}, 400, nil)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateEmailIntakeSettings(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"support_address":"Support@ZRP.test","auto_acknowledge":true}`)))
+	}, 200, nil)
+
+	var res field.EmailIntakeResult
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.ReceiveFieldReportEmail(w, httptest.NewRequest("POST", "/", strings.NewReader(complaint)))
+	}, 200, &res)
+	if !res.Created || res.ReportID != "FR-001" || res.Attachments != 2 || len(res.Skipped) != 1 || !res.Acknowledged {
+		t.Fatalf("intake = %+v", res)
+	}
+	var fr models.FieldReport
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.GetFieldReport(w, httptest.NewRequest("GET", "/", nil), "FR-001")
+	}, 200, &fr)
+	if fr.Title != "Unit keeps rebooting" || fr.DeviceSerial != "SN-1001" || fr.DeviceIPN != "ASY-100" || fr.CustomerName != "Acme Robotics" ||
+		fr.ReportedBy != "jane@acme.example" || !strings.Contains(fr.Description, "reboots every hour since the last update.") {
+		t.Errorf("report = %+v", fr)
+	}
+	if strings.Join(stored, ",") != "field_report/FR-001/email-1.eml,field_report/FR-001/photo.jpg" {
+		t.Errorf("attachments = %v", stored)
+	}
+	if len(acks) != 1 || acks[0].to != "jane@acme.example" || acks[0].subject != "Re: Unit keeps rebooting [FR-001]" {
+		t.Errorf("acks = %+v", acks)
+	}
+
+	// Redelivery is recognised by its Message-ID.
+	if res, err := h.IngestEmail([]byte(complaint), nil); err != nil || !res.Duplicate || res.ReportID != "FR-001" {
+		t.Errorf("redelivery = %+v, %v", res, err)
+	}
+
+	// Replies thread by header or by the reference in the subject.
+	reply := "From: jane@acme.example\r\nTo: support@zrp.test\r\nSubject: Re: Unit keeps rebooting [FR-001]\r\n" +
+		"Message-ID: <m2@acme.example>\r\nIn-Reply-To: <m1@acme.example>\r\n\r\nIt happened again.\r\n"
+	tagged := "From: jane@acme.example\r\nTo: support@zrp.test\r\nSubject: Fwd: [FR-001] logs\r\n\r\nLogs below.\r\n"
+	for _, raw := range []string{reply, tagged} {
+		if res, err := h.IngestEmail([]byte(raw), nil); err != nil || res.Created || res.ReportID != "FR-001" || res.Acknowledged {
+			t.Errorf("reply = %+v, %v", res, err)
+		}
+	}
+
+	if _, err := h.IngestEmail([]byte("From: a@b.example\r\nTo: sales@zrp.test\r\nSubject: hi\r\n\r\nhello\r\n"), nil); err == nil {
+		t.Error("mail to another address was accepted")
+	}
+
+	// Auto-replies still open a report but are never acknowledged.
+	auto := "From: Bot <noreply@beta.example>\r\nTo: support@zrp.test\r\nSubject: Fault at Beta Corp plant\r\nAuto-Submitted: auto-generated\r\n\r\nController fault.\r\n"
+	res, err := h.IngestEmail([]byte(auto), nil)
+	if err != nil || !res.Created || res.Acknowledged || len(acks) != 1 {
+		t.Fatalf("auto mail = %+v, %v", res, err)
+	}
+	var customer string
+	db.QueryRow("SELECT customer_name FROM field_reports WHERE id=?", res.ReportID).Scan(&customer)
+	if customer != "Beta Corp" {
+		t.Errorf("customer = %q", customer)
+	}
+
+	var thread []models.FieldReportEmail
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.ListFieldReportEmails(w, httptest.NewRequest("GET", "/", nil), "FR-001")
+	}, 200, &thread)
+	if len(thread) != 4 || thread[1].Direction != "outbound" || thread[2].InReplyTo != "m1@acme.example" || thread[0].AttachmentCount != 2 {
+		t.Errorf("thread = %+v", thread)
+	}
+
+	// The SMTP receiver only accepts the support address.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go h.ServeSMTP(l, "zrp.test")
+	if err := smtp.SendMail(l.Addr().String(), nil, "ops@gamma.example", []string{"sales@zrp.test"}, []byte("Subject: x\r\n\r\nx\r\n")); err == nil {
+		t.Error("SMTP accepted mail for another address")
+	}
+	msg := "From: ops@gamma.example\r\nTo: support@zrp.test\r\nSubject: Dead on arrival\r\n\r\nSN-1001 will not power up.\r\n"
+	if err := smtp.SendMail(l.Addr().String(), nil, "ops@gamma.example", []string{"support@zrp.test"}, []byte(msg)); err != nil {
+		t.Fatalf("SMTP send: %v", err)
+	}
+	var title string
+	db.QueryRow("SELECT title FROM field_reports WHERE reported_by='ops@gamma.example'").Scan(&title)
+	if title != "Dead on arrival" || len(acks) != 2 {
+		t.Errorf("SMTP report %q, acks %d", title, len(acks))
+	}
+}
@@ -0,0 +1,99 @@
+package field_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/common"
+	"zrp/internal/models"
+)
+
+func TestReliabilityReport(t *testing.T) {
+	db, h, _ := setupRMARepairHandler(t)
+	h.ExportCSV = common.ExportCSV
+	h.ExportExcel = common.ExportExcel
+	for _, stmt := range []string{
+		`INSERT INTO work_orders (id, assembly_ipn, qty) VALUES ('WO-1', 'ASY-100', 2), ('WO-2', 'ASY-100', 2)`,
+		`INSERT INTO devices (serial_number, ipn, firmware_version, status, install_date) VALUES
+			('SN-1','ASY-100','1.0','active','2025-10-01'), ('SN-2','ASY-100','1.0','active','2025-10-01'),
+			('SN-3','ASY-100','2.0','active','2026-04-01'), ('SN-4','ASY-100','2.0','active','2026-04-01'),
+			('SN-5','ASY-200','','active','2026-01-01'), ('SN-6','ASY-100','1.0','active',NULL)`,
+		`INSERT INTO wo_serials (wo_id, serial_number, status) VALUES
+			('WO-1','SN-1','complete'), ('WO-1','SN-2','complete'), ('WO-2','SN-3','complete'), ('WO-2','SN-4','complete')`,
+		`INSERT INTO field_reports (id, title, report_type, device_ipn, device_serial, reported_at, root_cause) VALUES
+			('FR-1','Dead on site','failure','ASY-100','SN-1','2026-01-15 09:00:00','Connector'),
+			('FR-2','Hangs at boot','failure','ASY-100','SN-1','2026-06-01 09:00:00','Firmware hang'),
+			('FR-3','Slow','performance','ASY-100','SN-2','2026-06-01 09:00:00',''),
+			('FR-4','Too late','failure','ASY-100','SN-4','2026-11-01 09:00:00','')`,
+		// RMA-1 follows FR-1 and is the same failure.
+		`INSERT INTO rmas (id, serial_number, reason, created_at) VALUES
+			('RMA-1','SN-1','connector','2026-01-20 10:00:00'), ('RMA-2','SN-3','','2026-05-01 10:00:00'),
+			('RMA-3','SN-99','Connector','2026-03-01 10:00:00')`,
+		`INSERT INTO rma_lines (rma_id, serial_number, ipn, defect_description) VALUES
+			('RMA-1','SN-1','ASY-100',''), ('RMA-2','SN-3','ASY-100','connector')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	var rep models.ReliabilityReport
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.GetReliability(w, httptest.NewRequest("GET", "/api/v1/reliability?as_of=2026-10-01", nil))
+	}, 200, &rep)
+
+	if len(rep.Products) != 2 || rep.Unmatched != 1 {
+		t.Fatalf("report = %+v", rep)
+	}
+	p := rep.Products[0]
+	if p.Key != "ASY-100" || p.Units != 4 || p.Failures != 3 || p.FailedUnits != 2 || p.OperatingHours != 26304 ||
+		p.MTBFHours == nil || *p.MTBFHours != 8768 || p.AFRPct != 99.91 {
+		t.Errorf("ASY-100 = %+v", p)
+	}
+	if p.Weibull == nil || p.Weibull.Failures != 2 || p.Weibull.Suspensions != 2 || p.Weibull.Beta <= 0 || p.Weibull.EtaDays <= 0 {
+		t.Errorf("weibull = %+v", p.Weibull)
+	}
+	if q := rep.Products[1]; q.Key != "ASY-200" || q.Failures != 0 || q.MTBFHours != nil || q.Weibull != nil {
+		t.Errorf("ASY-200 = %+v", q)
+	}
+
+	if len(rep.Months) != 12 || rep.Months[0].AtRisk != 5 || rep.Months[0].Failures != 1 || rep.Months[0].RatePct != 20 ||
+		rep.Months[3].Failures != 1 || rep.Months[7].Failures != 1 {
+		t.Errorf("months = %+v", rep.Months)
+	}
+	if len(rep.Pareto) != 2 || rep.Pareto[0].DefectType != "connector" || rep.Pareto[0].Failures != 3 ||
+		rep.Pareto[0].Pct != 75 || rep.Pareto[1].CumulativePct != 100 {
+		t.Errorf("pareto = %+v", rep.Pareto)
+	}
+	if len(rep.Firmware) != 3 || rep.Firmware[0].Key != "1.0" || rep.Firmware[0].Failures != 2 ||
+		rep.Firmware[1].Key != "2.0" || rep.Firmware[1].Failures != 1 || rep.Firmware[2].Key != "unknown" {
+		t.Errorf("firmware = %+v", rep.Firmware)
+	}
+	if len(rep.Lots) != 3 || rep.Lots[0].Key != "WO-1" || rep.Lots[0].FailedUnits != 1 || rep.Lots[1].Failures != 1 {
+		t.Errorf("lots = %+v", rep.Lots)
+	}
+
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.GetReliability(w, httptest.NewRequest("GET", "/api/v1/reliability?as_of=2026-10-01&ipn=ASY-200", nil))
+	}, 200, &rep)
+	if len(rep.Products) != 1 || len(rep.Pareto) != 0 || rep.Unmatched != 0 {
+		t.Errorf("ASY-200 report = %+v", rep)
+	}
+
+	w := httptest.NewRecorder()
+	h.GetReliability(w, httptest.NewRequest("GET", "/api/v1/reliability?as_of=2026-10-01&format=csv&section=pareto", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "connector,3,75,75") {
+		t.Errorf("csv export %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.GetReliability(w, httptest.NewRequest("GET", "/api/v1/reliability?format=xlsx&section=lots", nil))
+	if w.Code != 200 || !strings.Contains(w.Header().Get("Content-Type"), "spreadsheet") {
+		t.Errorf("xlsx export %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, q := range []string{"as_of=last-week", "format=pdf", "format=csv&section=customers"} {
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.GetReliability(w, httptest.NewRequest("GET", "/api/v1/reliability?"+q, nil))
+		}, 400, nil)
+	}
+}
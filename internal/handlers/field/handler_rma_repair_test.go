@@ -0,0 +1,277 @@
+package field_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zrp/internal/handlers/field"
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func setupRMARepairHandler(t *testing.T) (*sql.DB, *field.Handler, *[]models.Shipment) {
+	t.Helper()
+	db := testutil.SetupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	counters := map[string]int{}
+	shipments := &[]models.Shipment{}
+	h := &field.Handler{
+		DB: db,
+		NextIDFunc: func(prefix, table string, digits int) string {
+			counters[prefix]++
+			return fmt.Sprintf("%s-%0*d", prefix, digits, counters[prefix])
+		},
+		RecordChangeJSON: func(userID, tableName, recordID, operation string, oldData, newData interface{}) (int64, error) {
+			return 0, nil
+		},
+		GetRMASnapshot: func(id string) (map[string]interface{}, error) { return nil, nil },
+		CreateShipment: func(s *models.Shipment) error {
+			s.ID = fmt.Sprintf("SHP-%04d", len(*shipments)+1)
+			*shipments = append(*shipments, *s)
+			return nil
+		},
+	}
+	return db, h, shipments
+}
+
+func rmaCall(t *testing.T, fn func(w *httptest.ResponseRecorder), want int, out interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	fn(w)
+	if w.Code != want {
+		t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+	}
+	if out != nil && w.Code == 200 {
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func deviceStatus(t *testing.T, db *sql.DB, serial string) string {
+	t.Helper()
+	var s string
+	db.QueryRow("SELECT status FROM devices WHERE serial_number=?", serial).Scan(&s)
+	return s
+}
+
+func TestRMARepairWorkflow(t *testing.T) {
+	db, h, shipments := setupRMARepairHandler(t)
+	recent := time.Now().AddDate(0, -3, 0).Format("2006-01-02")
+	db.Exec(`INSERT INTO devices (serial_number, ipn, customer, status, install_date) VALUES
+		('SN-1','ASY-100','Acme','active',?), ('SN-2','ASY-100','Acme','active','2020-01-01'), ('SN-3','ASY-200','Acme','active',?)`, recent, recent)
+	db.Exec(`INSERT INTO inventory (ipn, qty_on_hand, qty_reserved) VALUES ('RES-001', 10, 8)`)
+
+	// One RMA returning three units; warranty comes from the install date.
+	var rma models.RMA
+	body := `{"customer":"Acme","reason":"Dead on arrival","lines":[{"serial_number":"SN-1"},{"serial_number":"SN-2"},{"serial_number":"SN-3"},{"serial_number":"SN-X"}]}`
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMA(w, httptest.NewRequest("POST", "/api/v1/rmas", bytes.NewBufferString(body)))
+	}, 200, &rma)
+	if rma.SerialNumber != "SN-1" || len(rma.Lines) != 4 {
+		t.Fatalf("rma = %+v", rma)
+	}
+	var warranty []string
+	for _, l := range rma.Lines {
+		warranty = append(warranty, l.IPN+":"+l.Warranty)
+	}
+	if fmt.Sprint(warranty) != "[ASY-100:in ASY-100:out ASY-200:in :unknown]" {
+		t.Errorf("warranty = %v", warranty)
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMA(w, httptest.NewRequest("POST", "/api/v1/rmas", bytes.NewBufferString(`{"reason":"x","lines":[{"serial_number":"A"},{"serial_number":"A"}]}`)))
+	}, 400, nil)
+
+	// Receiving puts the units into RMA.
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateRMA(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"serial_number":"SN-1","customer":"Acme","reason":"Dead on arrival","status":"received"}`)), rma.ID)
+	}, 200, nil)
+	if s := deviceStatus(t, db, "SN-2"); s != "rma" {
+		t.Errorf("SN-2 after receipt = %s", s)
+	}
+
+	line := func(i int) string { return fmt.Sprint(rma.Lines[i].ID) }
+	updateLine := func(i int, body string, want int) models.RMALine {
+		t.Helper()
+		var l models.RMALine
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.UpdateRMALine(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(body)), rma.ID, line(i))
+		}, want, &l)
+		return l
+	}
+	updateLine(0, `{"disposition":"repair"}`, 200)
+	updateLine(1, `{"disposition":"credit","credit_amount":250}`, 200)
+	updateLine(1, `{"status":"repaired"}`, 400)
+	updateLine(1, `{"disposition":"swap"}`, 400)
+
+	// SN-3 gets an advance replacement.
+	var adv struct {
+		Line     models.RMALine  `json:"line"`
+		Shipment models.Shipment `json:"shipment"`
+	}
+	advance := func(i int, body string, want int) {
+		t.Helper()
+		var out interface{}
+		if want == 200 {
+			out = &adv
+		}
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.AdvanceReplacement(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)), rma.ID, line(i))
+		}, want, out)
+	}
+	advance(1, `{"replacement_serial":"SN-9"}`, 400)
+	advance(2, `{"replacement_serial":"SN-3"}`, 400)
+	advance(2, `{"replacement_serial":"SN-30","to_address":"1 Main St"}`, 200)
+	advance(2, `{"replacement_serial":"SN-31"}`, 409)
+	if adv.Line.Disposition != "replace" || adv.Line.AdvanceShipmentID != "SHP-0001" || len(*shipments) != 1 {
+		t.Fatalf("advance = %+v", adv)
+	}
+	if l := (*shipments)[0].Lines; len(l) != 1 || l[0].SerialNumber != "SN-30" || l[0].IPN != "ASY-200" || l[0].RMAID != rma.ID {
+		t.Errorf("shipment lines = %+v", l)
+	}
+	if s := deviceStatus(t, db, "SN-30"); s != "active" {
+		t.Errorf("SN-30 = %s", s)
+	}
+
+	// A repair work order for SN-1, then parts issued to it.
+	var repair struct {
+		WorkOrders []struct {
+			ID          string   `json:"id"`
+			AssemblyIPN string   `json:"assembly_ipn"`
+			Serials     []string `json:"serials"`
+		} `json:"work_orders"`
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMARepairWO(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`)), rma.ID)
+	}, 200, &repair)
+	if len(repair.WorkOrders) != 1 || repair.WorkOrders[0].AssemblyIPN != "ASY-100" || fmt.Sprint(repair.WorkOrders[0].Serials) != "[SN-1]" {
+		t.Fatalf("repair = %+v", repair)
+	}
+	woID := repair.WorkOrders[0].ID
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMARepairWO(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`)), rma.ID)
+	}, 400, nil)
+
+	consume := func(body string, want int) {
+		t.Helper()
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.ConsumeRMAPart(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)), rma.ID)
+		}, want, nil)
+	}
+	consume(`{"ipn":"RES-001","qty":3}`, 400) // only 2 unreserved
+	consume(`{"ipn":"RES-001","qty":1,"wo_id":"WO-9999"}`, 400)
+	consume(`{"ipn":"RES-001","qty":2,"notes":"R4 burnt"}`, 200)
+	var onHand float64
+	db.QueryRow("SELECT qty_on_hand FROM inventory WHERE ipn='RES-001'").Scan(&onHand)
+	var ref string
+	db.QueryRow("SELECT reference FROM inventory_transactions WHERE ipn='RES-001' AND type='issue'").Scan(&ref)
+	if onHand != 8 || ref != woID {
+		t.Errorf("after issue: on hand %g, reference %q", onHand, ref)
+	}
+
+	// Closing the RMA finishes each line by its disposition.
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateRMA(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"serial_number":"SN-1","customer":"Acme","reason":"Dead on arrival","status":"closed"}`)), rma.ID)
+	}, 200, &rma)
+	var statuses []string
+	for _, l := range rma.Lines {
+		statuses = append(statuses, l.SerialNumber+":"+l.Status+":"+deviceStatus(t, db, l.SerialNumber))
+	}
+	if fmt.Sprint(statuses) != "[SN-1:repaired:active SN-2:credited:decommissioned SN-3:replaced:decommissioned SN-X:open:]" {
+		t.Errorf("after close = %v", statuses)
+	}
+	if len(rma.Parts) != 1 || rma.Parts[0].WOID != woID || rma.Parts[0].Qty != 2 {
+		t.Errorf("parts = %+v", rma.Parts)
+	}
+	updateLine(3, `{"disposition":"repair"}`, 400)
+}
+
+func TestRMASettings_WarrantyTerm(t *testing.T) {
+	db, h, _ := setupRMARepairHandler(t)
+	installed := time.Now().AddDate(0, -18, 0).Format("2006-01-02")
+	db.Exec(`INSERT INTO devices (serial_number, ipn, status, install_date) VALUES ('SN-1','ASY-100','active',?)`, installed)
+
+	var s field.RMASettings
+	rmaCall(t, func(w *httptest.ResponseRecorder) { h.GetRMASettings(w, httptest.NewRequest("GET", "/", nil)) }, 200, &s)
+	if s.WarrantyMonths != field.DefaultWarrantyMonths {
+		t.Errorf("default = %d", s.WarrantyMonths)
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateRMASettings(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"warranty_months":-1}`)))
+	}, 400, nil)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateRMASettings(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"warranty_months":24}`)))
+	}, 200, nil)
+
+	var rma models.RMA
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMA(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"serial_number":"SN-1","reason":"Fan noise"}`)))
+	}, 200, &rma)
+	want := time.Now().AddDate(0, -18, 0).AddDate(0, 24, 0).Format("2006-01-02")
+	if len(rma.Lines) != 1 || rma.Lines[0].Warranty != "in" || rma.Lines[0].WarrantyExpires != want {
+		t.Errorf("lines = %+v", rma.Lines)
+	}
+}
+
+func TestRMARepair_WritesAreAtomic(t *testing.T) {
+	db, h, _ := setupRMARepairHandler(t)
+	db.Exec(`INSERT INTO devices (serial_number, ipn, customer, status) VALUES
+		('SN-1','ASY-100','Acme','active'), ('SN-2','ASY-200','Acme','active')`)
+	var rma models.RMA
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMA(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"reason":"x","status":"received","lines":[{"serial_number":"SN-1"},{"serial_number":"SN-2"}]}`)))
+	}, 200, &rma)
+	for _, l := range rma.Lines {
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.UpdateRMALine(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"disposition":"repair"}`)), rma.ID, fmt.Sprint(l.ID))
+		}, 200, nil)
+	}
+
+	// The second work order fails: nothing of the first is kept.
+	db.Exec(`CREATE TRIGGER fail_wo BEFORE INSERT ON work_orders WHEN NEW.assembly_ipn = 'ASY-200'
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END`)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMARepairWO(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`)), rma.ID)
+	}, 500, nil)
+	var wos, repairing int
+	db.QueryRow("SELECT COUNT(*) FROM work_orders").Scan(&wos)
+	db.QueryRow("SELECT COUNT(*) FROM rma_lines WHERE status='repairing'").Scan(&repairing)
+	if wos != 0 || repairing != 0 {
+		t.Errorf("after failed repair WO: %d work orders, %d repairing lines", wos, repairing)
+	}
+
+	// Without the failure both work orders are created with their own IDs.
+	db.Exec("DROP TRIGGER fail_wo")
+	var repair struct {
+		WorkOrders []struct {
+			ID string `json:"id"`
+		} `json:"work_orders"`
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMARepairWO(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`)), rma.ID)
+	}, 200, &repair)
+	if len(repair.WorkOrders) != 2 || repair.WorkOrders[0].ID == repair.WorkOrders[1].ID {
+		t.Fatalf("repair = %+v", repair)
+	}
+
+	// Closing a line whose device update fails leaves the line open.
+	db.Exec(`CREATE TRIGGER fail_device BEFORE UPDATE ON devices WHEN NEW.status = 'active'
+		BEGIN SELECT RAISE(ABORT, 'locked'); END`)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateRMALine(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"status":"repaired"}`)), rma.ID, fmt.Sprint(rma.Lines[0].ID))
+	}, 500, nil)
+	var status string
+	db.QueryRow("SELECT status FROM rma_lines WHERE id=?", rma.Lines[0].ID).Scan(&status)
+	if status != "repairing" {
+		t.Errorf("line status after failed close = %s", status)
+	}
+}
@@ -47,6 +47,32 @@ func setupRMATestDB(t *testing.T) (*sql.DB, *field.Handler) {
 		t.Fatalf("Failed to create rmas table: %v", err)
 	}
 
+	// Create rma_lines table (CreateRMA records the returned serials)
+	_, err = testDB.Exec(`
+		CREATE TABLE rma_lines (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rma_id TEXT NOT NULL,
+			serial_number TEXT NOT NULL,
+			ipn TEXT DEFAULT '',
+			defect_description TEXT DEFAULT '',
+			status TEXT DEFAULT 'open',
+			disposition TEXT DEFAULT '',
+			warranty TEXT DEFAULT 'unknown',
+			warranty_expires TEXT DEFAULT '',
+			repair_wo_id TEXT DEFAULT '',
+			replacement_serial TEXT DEFAULT '',
+			advance_shipment_id TEXT DEFAULT '',
+			contract_id TEXT DEFAULT '',
+			credit_amount REAL DEFAULT 0,
+			notes TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (rma_id) REFERENCES rmas(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create rma_lines table: %v", err)
+	}
+
 	// Create audit_log table (needed for logAudit)
 	_, err = testDB.Exec(`
 		CREATE TABLE audit_log (
@@ -45,6 +45,21 @@ func setupTestingHandlerTestDB(t *testing.T) (*sql.DB, *quality.Handler) {
 		t.Fatalf("Failed to create test_records table: %v", err)
 	}
 
+	// Create training_requirements table
+	_, err = testDB.Exec(`
+		CREATE TABLE training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			activity TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			valid_months INTEGER DEFAULT 0
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create training_requirements table: %v", err)
+	}
+
 	// Create audit_log table
 	_, err = testDB.Exec(`
 		CREATE TABLE audit_log (
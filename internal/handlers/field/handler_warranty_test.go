@@ -0,0 +1,137 @@
+package field_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zrp/internal/models"
+)
+
+func TestWarrantyCoverage(t *testing.T) {
+	db, h, _ := setupRMARepairHandler(t)
+	day := func(months, days int) string { return time.Now().AddDate(0, months, days).Format("2006-01-02") }
+	db.Exec(`INSERT INTO devices (serial_number, ipn, customer, status, install_date) VALUES
+		('SN-1','ASY-100','Acme','active',?), ('SN-2','ASY-200','Acme','active',?),
+		('SN-3','ASY-200','Acme','active',?), ('SN-4','ASY-200','Beta','active',?)`,
+		day(-18, 0), day(-18, 0), day(-18, 0), day(-18, 0))
+
+	// ASY-100 carries a 24 month policy; ASY-200 falls back to 12 months.
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateWarrantyPolicy(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"ipn":"ASY-100","term_months":24,"coverage":"parts"}`)))
+	}, 200, nil)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateWarrantyPolicy(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"ipn":"ASY-100","term_months":12}`)))
+	}, 409, nil)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateWarrantyPolicy(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"ipn":"ASY-300","term_months":12,"coverage":"gold"}`)))
+	}, 400, nil)
+
+	device := func(serial string) models.WarrantyStatus {
+		t.Helper()
+		var d models.Device
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.GetDevice(w, httptest.NewRequest("GET", "/", nil), serial)
+		}, 200, &d)
+		if d.Warranty == nil {
+			t.Fatalf("%s: no warranty", serial)
+		}
+		return *d.Warranty
+	}
+	if w := device("SN-1"); w.Status != "in" || w.Source != "warranty" || w.Coverage != "parts" || w.Expires != day(6, 0) {
+		t.Errorf("SN-1 = %+v", w)
+	}
+	if w := device("SN-2"); w.Status != "out" || w.WarrantyExpires != day(-6, 0) {
+		t.Errorf("SN-2 = %+v", w)
+	}
+
+	// A contract listing SN-2, and a blanket one for all of Beta's units.
+	contract := func(body string, want int) models.ServiceContract {
+		t.Helper()
+		var c models.ServiceContract
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.CreateServiceContract(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)))
+		}, want, &c)
+		return c
+	}
+	contract(`{"customer":"Acme","start_date":"2026-01-01","end_date":"2025-01-01"}`, 400)
+	contract(`{"customer":"Acme","start_date":"2026-01-01","end_date":"2027-01-01","devices":["SN-404"]}`, 400)
+	sc1 := contract(`{"customer":"Acme","name":"Gold","start_date":"`+day(-7, 0)+`","end_date":"`+day(0, 10)+`","devices":["SN-2"]}`, 200)
+	sc2 := contract(`{"customer":"Beta","start_date":"`+day(-7, 0)+`","end_date":"`+day(2, 0)+`","coverage":"replacement"}`, 200)
+	if sc1.ID != "SC-001" || len(sc1.Devices) != 1 {
+		t.Fatalf("contract = %+v", sc1)
+	}
+	if w := device("SN-2"); w.Status != "in" || w.Source != "contract" || w.ContractID != sc1.ID || w.Expires != day(0, 10) {
+		t.Errorf("SN-2 = %+v", w)
+	}
+	if w := device("SN-3"); w.Status != "out" {
+		t.Errorf("SN-3 = %+v", w)
+	}
+	if w := device("SN-4"); w.ContractID != sc2.ID || w.Coverage != "replacement" {
+		t.Errorf("SN-4 = %+v", w)
+	}
+
+	// New RMA lines and field reports record the coverage.
+	var rma models.RMA
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateRMA(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"reason":"No boot","lines":[{"serial_number":"SN-2"},{"serial_number":"SN-3"}]}`)))
+	}, 200, &rma)
+	if l := rma.Lines; l[0].Warranty != "in" || l[0].ContractID != sc1.ID || l[1].Warranty != "out" || l[1].ContractID != "" {
+		t.Errorf("rma lines = %+v", l)
+	}
+	var fr models.FieldReport
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.CreateFieldReport(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"title":"Fan noise","device_serial":"SN-4"}`)))
+	}, 200, &fr)
+	if fr.Warranty != "in" || fr.ContractID != sc2.ID || fr.DeviceIPN != "ASY-200" || fr.CustomerName != "Beta" {
+		t.Errorf("field report = %+v", fr)
+	}
+
+	// Cancelled contracts stop covering and drop off the expiring report.
+	expiring := func(query string) []string {
+		t.Helper()
+		var out struct {
+			Contracts []struct {
+				ID          string `json:"id"`
+				DaysLeft    int    `json:"days_left"`
+				DeviceCount int    `json:"device_count"`
+			} `json:"contracts"`
+		}
+		rmaCall(t, func(w *httptest.ResponseRecorder) {
+			h.ExpiringServiceContracts(w, httptest.NewRequest("GET", "/api/v1/service-contracts/expiring"+query, nil))
+		}, 200, &out)
+		var ids []string
+		for _, c := range out.Contracts {
+			b, _ := json.Marshal(c)
+			ids = append(ids, string(b))
+		}
+		return ids
+	}
+	if got := expiring(""); len(got) != 1 || got[0] != `{"id":"SC-001","days_left":10,"device_count":1}` {
+		t.Errorf("expiring 30 = %v", got)
+	}
+	if got := expiring("?days=90"); len(got) != 2 || got[1] != `{"id":"SC-002","days_left":`+daysUntil(day(2, 0))+`,"device_count":1}` {
+		t.Errorf("expiring 90 = %v", got)
+	}
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.ExpiringServiceContracts(w, httptest.NewRequest("GET", "/?days=x", nil))
+	}, 400, nil)
+	rmaCall(t, func(w *httptest.ResponseRecorder) {
+		h.UpdateServiceContract(w, httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"customer":"Acme","start_date":"`+day(-7, 0)+`","end_date":"`+day(0, 10)+`","status":"cancelled"}`)), sc1.ID)
+	}, 200, nil)
+	if w := device("SN-2"); w.Status != "out" {
+		t.Errorf("SN-2 after cancel = %+v", w)
+	}
+	if got := expiring(""); len(got) != 0 {
+		t.Errorf("expiring after cancel = %v", got)
+	}
+}
+
+func daysUntil(date string) string {
+	end, _ := time.Parse("2006-01-02", date)
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	b, _ := json.Marshal(int(end.Sub(today).Hours() / 24))
+	return string(b)
+}
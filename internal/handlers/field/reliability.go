@@ -0,0 +1,425 @@
+package field
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/models"
+	"zrp/internal/response"
+)
+
+const (
+	// monthDays is the average month length used for month-in-service.
+	monthDays = 30.4375
+	// maxServiceMonths caps the month-in-service curve.
+	maxServiceMonths = 60
+	// repeatFailureDays folds an RMA raised shortly after a field failure
+	// report on the same serial into that one failure.
+	repeatFailureDays = 30
+)
+
+// fleetUnit is an installed device with its days in service on the report date.
+type fleetUnit struct {
+	serial, ipn, firmware, lot string
+	installed                  time.Time
+	ageDays                    float64
+	failAges                   []float64
+}
+
+// failureEvent is a field failure report or a returned RMA unit.
+type failureEvent struct {
+	serial, ipn, defect string
+	day                 time.Time
+}
+
+// parseDay reads the date part of a DATE or DATETIME column.
+func parseDay(s string) (time.Time, bool) {
+	if len(s) < 10 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	return t, err == nil
+}
+
+// defectLabel picks the first classification on record for a failure.
+func defectLabel(candidates ...string) string {
+	for _, c := range candidates {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			return c
+		}
+	}
+	return "unclassified"
+}
+
+// fleet loads the devices in service on asOf, keyed by serial number.
+func (h *Handler) fleet(ipn string, asOf time.Time) (map[string]*fleetUnit, error) {
+	query := `SELECT d.serial_number, d.ipn, COALESCE(d.firmware_version,''), CAST(COALESCE(d.install_date,'') AS TEXT),
+		COALESCE((SELECT wo_id FROM wo_serials WHERE serial_number=d.serial_number),'')
+		FROM devices d`
+	var args []interface{}
+	if ipn != "" {
+		query += " WHERE d.ipn=?"
+		args = append(args, ipn)
+	}
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	units := map[string]*fleetUnit{}
+	for rows.Next() {
+		var u fleetUnit
+		var installed string
+		rows.Scan(&u.serial, &u.ipn, &u.firmware, &installed, &u.lot)
+		day, ok := parseDay(installed)
+		if !ok || day.After(asOf) {
+			continue
+		}
+		u.installed = day
+		u.ageDays = asOf.Sub(day).Hours() / 24
+		units[u.serial] = &u
+	}
+	return units, rows.Err()
+}
+
+// failureEvents loads failures up to asOf, oldest first, with RMAs that
+// follow a field report on the same serial folded into it.
+func (h *Handler) failureEvents(asOf time.Time) ([]failureEvent, error) {
+	queries := []string{
+		`SELECT fr.device_serial, COALESCE(fr.device_ipn,''), CAST(COALESCE(fr.reported_at, fr.created_at) AS TEXT),
+			COALESCE((SELECT defect_type FROM ncrs WHERE id=fr.ncr_id),''), COALESCE(fr.root_cause,'')
+			FROM field_reports fr WHERE fr.report_type='failure' AND COALESCE(fr.device_serial,'')!=''`,
+		`SELECT l.serial_number, COALESCE(l.ipn,''), CAST(r.created_at AS TEXT), COALESCE(l.defect_description,''), COALESCE(r.reason,'')
+			FROM rma_lines l JOIN rmas r ON r.id=l.rma_id`,
+		`SELECT r.serial_number, '', CAST(r.created_at AS TEXT), COALESCE(r.defect_description,''), COALESCE(r.reason,'')
+			FROM rmas r WHERE NOT EXISTS (SELECT 1 FROM rma_lines WHERE rma_id=r.id)`,
+	}
+	var events []failureEvent
+	for _, q := range queries {
+		rows, err := h.DB.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var e failureEvent
+			var at, primary, secondary string
+			rows.Scan(&e.serial, &e.ipn, &at, &primary, &secondary)
+			day, ok := parseDay(at)
+			if !ok || day.After(asOf) {
+				continue
+			}
+			e.day = day
+			e.defect = defectLabel(primary, secondary)
+			events = append(events, e)
+		}
+		rows.Close()
+	}
+
+	// Field reports come first, so a stable sort keeps them ahead of an
+	// RMA for the same serial on the same day.
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].serial != events[j].serial {
+			return events[i].serial < events[j].serial
+		}
+		return events[i].day.Before(events[j].day)
+	})
+	var kept []failureEvent
+	for _, e := range events {
+		if n := len(kept); n > 0 && kept[n-1].serial == e.serial &&
+			e.day.Sub(kept[n-1].day).Hours()/24 <= repeatFailureDays {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, nil
+}
+
+// fitWeibull fits time to first failure by median rank regression on Y,
+// with suspended (still running) units handled by Johnson's adjusted
+// ranks and Bernard's approximation. It needs two failures at distinct ages.
+func fitWeibull(failures, suspensions []float64) *models.WeibullFit {
+	type item struct {
+		t      float64
+		failed bool
+	}
+	var items []item
+	for _, t := range failures {
+		items = append(items, item{math.Max(t, 0.5), true})
+	}
+	for _, t := range suspensions {
+		items = append(items, item{math.Max(t, 0.5), false})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].t != items[j].t {
+			return items[i].t < items[j].t
+		}
+		return items[i].failed && !items[j].failed
+	})
+
+	n := float64(len(items))
+	var xs, ys []float64
+	rank := 0.0
+	for i, it := range items {
+		if !it.failed {
+			continue
+		}
+		reverse := n - float64(i)
+		rank += (n + 1 - rank) / (1 + reverse)
+		f := (rank - 0.3) / (n + 0.4)
+		xs = append(xs, math.Log(it.t))
+		ys = append(ys, math.Log(-math.Log(1-f)))
+	}
+	if len(xs) < 2 {
+		return nil
+	}
+
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+	var sxx, syy, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		syy += (ys[i] - my) * (ys[i] - my)
+		sxy += (xs[i] - mx) * (ys[i] - my)
+	}
+	if sxx == 0 || sxy <= 0 {
+		return nil
+	}
+	beta := sxy / sxx
+	eta := math.Exp(mx - my/beta)
+	return &models.WeibullFit{
+		Beta:        round2(beta),
+		EtaDays:     round2(eta),
+		RSquared:    round2(sxy * sxy / (sxx * syy)),
+		Failures:    len(failures),
+		Suspensions: len(suspensions),
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// groupReliability rolls the fleet up by key; failures count every
+// failure, so MTBF treats units as repairable.
+func groupReliability(units map[string]*fleetUnit, key func(*fleetUnit) string, weibull bool) []models.ReliabilityGroup {
+	groups := map[string]*models.ReliabilityGroup{}
+	firsts := map[string][]float64{}
+	running := map[string][]float64{}
+	for _, u := range units {
+		k := key(u)
+		if k == "" {
+			k = "unknown"
+		}
+		g := groups[k]
+		if g == nil {
+			g = &models.ReliabilityGroup{Key: k}
+			groups[k] = g
+		}
+		g.Units++
+		g.OperatingHours += u.ageDays * 24
+		g.Failures += len(u.failAges)
+		if len(u.failAges) > 0 {
+			g.FailedUnits++
+			firsts[k] = append(firsts[k], u.failAges[0])
+		} else {
+			running[k] = append(running[k], u.ageDays)
+		}
+	}
+
+	out := []models.ReliabilityGroup{}
+	for k, g := range groups {
+		if g.Failures > 0 {
+			mtbf := round2(g.OperatingHours / float64(g.Failures))
+			g.MTBFHours = &mtbf
+		}
+		if g.OperatingHours > 0 {
+			g.AFRPct = round2(float64(g.Failures) / (g.OperatingHours / 8760) * 100)
+		}
+		g.OperatingHours = round2(g.OperatingHours)
+		if weibull {
+			g.Weibull = fitWeibull(firsts[k], running[k])
+		}
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// reliability computes the report for one IPN, or the whole fleet.
+func (h *Handler) reliability(ipn string, asOf time.Time) (models.ReliabilityReport, error) {
+	rep := models.ReliabilityReport{AsOf: asOf.Format("2006-01-02"), IPN: ipn}
+	units, err := h.fleet(ipn, asOf)
+	if err != nil {
+		return rep, err
+	}
+	events, err := h.failureEvents(asOf)
+	if err != nil {
+		return rep, err
+	}
+
+	defects := map[string]int{}
+	total := 0
+	for _, e := range events {
+		u := units[e.serial]
+		if u == nil {
+			if ipn != "" && e.ipn != ipn {
+				continue
+			}
+			rep.Unmatched++
+		} else {
+			u.failAges = append(u.failAges, math.Max(e.day.Sub(u.installed).Hours()/24, 0))
+		}
+		defects[e.defect]++
+		total++
+	}
+
+	rep.Products = groupReliability(units, func(u *fleetUnit) string { return u.ipn }, true)
+	rep.Firmware = groupReliability(units, func(u *fleetUnit) string { return u.firmware }, false)
+	rep.Lots = groupReliability(units, func(u *fleetUnit) string { return u.lot }, false)
+
+	maxAge := 0.0
+	for _, u := range units {
+		maxAge = math.Max(maxAge, u.ageDays)
+	}
+	months := int(math.Min(math.Ceil(maxAge/monthDays), maxServiceMonths))
+	rep.Months = []models.ReliabilityMonth{}
+	for m := 0; m < months; m++ {
+		start, end := float64(m)*monthDays, float64(m+1)*monthDays
+		rm := models.ReliabilityMonth{Month: m + 1}
+		for _, u := range units {
+			if u.ageDays > start {
+				rm.AtRisk++
+			}
+			for _, a := range u.failAges {
+				if a >= start && a < end {
+					rm.Failures++
+				}
+			}
+		}
+		if rm.AtRisk > 0 {
+			rm.RatePct = round2(float64(rm.Failures) / float64(rm.AtRisk) * 100)
+		}
+		rep.Months = append(rep.Months, rm)
+	}
+
+	rep.Pareto = []models.ReliabilityDefect{}
+	for d, n := range defects {
+		rep.Pareto = append(rep.Pareto, models.ReliabilityDefect{DefectType: d, Failures: n})
+	}
+	sort.Slice(rep.Pareto, func(i, j int) bool {
+		if rep.Pareto[i].Failures != rep.Pareto[j].Failures {
+			return rep.Pareto[i].Failures > rep.Pareto[j].Failures
+		}
+		return rep.Pareto[i].DefectType < rep.Pareto[j].DefectType
+	})
+	cum := 0
+	for i := range rep.Pareto {
+		cum += rep.Pareto[i].Failures
+		rep.Pareto[i].Pct = round2(float64(rep.Pareto[i].Failures) / float64(total) * 100)
+		rep.Pareto[i].CumulativePct = round2(float64(cum) / float64(total) * 100)
+	}
+	return rep, nil
+}
+
+// reliabilitySection flattens one part of the report for export.
+func reliabilitySection(rep models.ReliabilityReport, section string) ([]string, [][]string, bool) {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	groupRows := func(groups []models.ReliabilityGroup) [][]string {
+		var data [][]string
+		for _, g := range groups {
+			mtbf, beta, eta := "", "", ""
+			if g.MTBFHours != nil {
+				mtbf = f(*g.MTBFHours)
+			}
+			if g.Weibull != nil {
+				beta, eta = f(g.Weibull.Beta), f(g.Weibull.EtaDays)
+			}
+			data = append(data, []string{g.Key, strconv.Itoa(g.Units), strconv.Itoa(g.Failures), strconv.Itoa(g.FailedUnits),
+				f(g.OperatingHours), mtbf, f(g.AFRPct), beta, eta})
+		}
+		return data
+	}
+	groupHeaders := func(key string) []string {
+		return []string{key, "Units", "Failures", "Failed Units", "Operating Hours", "MTBF Hours", "AFR %", "Weibull Beta", "Weibull Eta Days"}
+	}
+
+	switch section {
+	case "products":
+		return groupHeaders("IPN"), groupRows(rep.Products), true
+	case "firmware":
+		return groupHeaders("Firmware"), groupRows(rep.Firmware), true
+	case "lots":
+		return groupHeaders("Build Lot"), groupRows(rep.Lots), true
+	case "months":
+		var data [][]string
+		for _, m := range rep.Months {
+			data = append(data, []string{strconv.Itoa(m.Month), strconv.Itoa(m.AtRisk), strconv.Itoa(m.Failures), f(m.RatePct)})
+		}
+		return []string{"Month In Service", "At Risk", "Failures", "Rate %"}, data, true
+	case "pareto":
+		var data [][]string
+		for _, d := range rep.Pareto {
+			data = append(data, []string{d.DefectType, strconv.Itoa(d.Failures), f(d.Pct), f(d.CumulativePct)})
+		}
+		return []string{"Defect Type", "Failures", "%", "Cumulative %"}, data, true
+	}
+	return nil, nil, false
+}
+
+// GetReliability handles GET /api/v1/reliability: MTBF, failure rate by
+// month in service, Weibull fits, the failure Pareto and failure rates by
+// firmware version and build lot. ?format=csv|xlsx exports one ?section
+// (products, months, pareto, firmware or lots).
+func (h *Handler) GetReliability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	asOf := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := q.Get("as_of"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			response.Err(w, "as_of must be a valid date (YYYY-MM-DD)", 400)
+			return
+		}
+		asOf = t
+	}
+
+	format := q.Get("format")
+	section := q.Get("section")
+	if section == "" {
+		section = "products"
+	}
+	if format != "" && format != "csv" && format != "xlsx" {
+		response.Err(w, "format must be csv or xlsx", 400)
+		return
+	}
+	if _, _, ok := reliabilitySection(models.ReliabilityReport{}, section); !ok {
+		response.Err(w, "section must be one of: products, months, pareto, firmware, lots", 400)
+		return
+	}
+
+	rep, err := h.reliability(q.Get("ipn"), asOf)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if format == "" {
+		response.JSON(w, rep)
+		return
+	}
+
+	headers, data, _ := reliabilitySection(rep, section)
+	if format == "xlsx" {
+		h.ExportExcel(w, fmt.Sprintf("Reliability %s", section), headers, data)
+	} else {
+		h.ExportCSV(w, fmt.Sprintf("reliability_%s.csv", section), headers, data)
+	}
+}
@@ -2,6 +2,7 @@ package field
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -47,6 +48,8 @@ func (h *Handler) GetRMA(w http.ResponseWriter, r *http.Request, id string) {
 	}
 	rm.ReceivedAt = database.SP(ra)
 	rm.ResolvedAt = database.SP(resa)
+	rm.Lines = h.rmaLines(id)
+	rm.Parts = h.rmaParts(id)
 	response.JSON(w, rm)
 }
 
@@ -58,9 +61,26 @@ func (h *Handler) CreateRMA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rm.SerialNumber == "" && len(rm.Lines) > 0 {
+		rm.SerialNumber = rm.Lines[0].SerialNumber
+	}
+	if len(rm.Lines) == 0 {
+		rm.Lines = []models.RMALine{{SerialNumber: rm.SerialNumber, DefectDescription: rm.DefectDescription}}
+	}
+
 	ve := &validation.ValidationErrors{}
 	validation.RequireField(ve, "serial_number", rm.SerialNumber)
 	validation.RequireField(ve, "reason", rm.Reason)
+	seen := map[string]bool{}
+	for i, l := range rm.Lines {
+		field := fmt.Sprintf("lines[%d].serial_number", i)
+		validation.RequireField(ve, field, l.SerialNumber)
+		validation.ValidateMaxLength(ve, field, l.SerialNumber, 100)
+		if seen[l.SerialNumber] {
+			ve.Add(field, "is listed twice")
+		}
+		seen[l.SerialNumber] = true
+	}
 	validation.ValidateMaxLength(ve, "serial_number", rm.SerialNumber, 100)
 	validation.ValidateMaxLength(ve, "customer", rm.Customer, 255)
 	validation.ValidateMaxLength(ve, "reason", rm.Reason, 255)
@@ -86,6 +106,12 @@ func (h *Handler) CreateRMA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rm.CreatedAt = now
+	for i := range rm.Lines {
+		if err := h.addRMALine(rm.ID, now, &rm.Lines[i]); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
 	username := audit.GetUsername(h.DB, r)
 	audit.LogAudit(h.DB, h.Hub, username, "created", "rma", rm.ID, "Created "+rm.ID+": "+rm.Reason)
 	h.RecordChangeJSON(username, "rmas", rm.ID, "create", nil, rm)
@@ -120,12 +146,27 @@ func (h *Handler) UpdateRMA(w http.ResponseWriter, r *http.Request, id string) {
 	if rm.Status == "closed" || rm.Status == "shipped" {
 		resolvedAt = now
 	}
-	_, err := h.DB.Exec("UPDATE rmas SET serial_number=?,customer=?,reason=?,status=?,defect_description=?,resolution=?,received_at=COALESCE(?,received_at),resolved_at=COALESCE(?,resolved_at) WHERE id=?",
+	lines := h.rmaLines(id)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE rmas SET serial_number=?,customer=?,reason=?,status=?,defect_description=?,resolution=?,received_at=COALESCE(?,received_at),resolved_at=COALESCE(?,resolved_at) WHERE id=?",
 		rm.SerialNumber, rm.Customer, rm.Reason, rm.Status, rm.DefectDescription, rm.Resolution, receivedAt, resolvedAt, id)
 	if err != nil {
 		response.Err(w, err.Error(), 500)
 		return
 	}
+	if err := syncRMAStatus(tx, lines, rm.Status); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
 	username := audit.GetUsername(h.DB, r)
 	audit.LogAudit(h.DB, h.Hub, username, "updated", "rma", id, "Updated "+id+": status="+rm.Status)
 	newSnap, _ := h.GetRMASnapshot(id)
@@ -0,0 +1,722 @@
+package field
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// Dispositions of a returned unit, and the line status each one ends in.
+var rmaClosingStatus = map[string]string{
+	"repair":  "repaired",
+	"replace": "replaced",
+	"credit":  "credited",
+}
+
+var validRMALineStatuses = []string{"open", "repairing", "repaired", "replaced", "credited", "scrapped"}
+
+// DefaultWarrantyMonths is the warranty term when rma_warranty_months is
+// not set.
+const DefaultWarrantyMonths = 12
+
+// RMASettings configures the RMA workflow.
+type RMASettings struct {
+	WarrantyMonths int `json:"warranty_months"`
+}
+
+func (h *Handler) warrantyMonths() int {
+	var v string
+	if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key='rma_warranty_months'").Scan(&v); err == nil {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return DefaultWarrantyMonths
+}
+
+// GetRMASettings handles GET /api/settings/rma.
+func (h *Handler) GetRMASettings(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, RMASettings{WarrantyMonths: h.warrantyMonths()})
+}
+
+// UpdateRMASettings handles PUT /api/settings/rma.
+func (h *Handler) UpdateRMASettings(w http.ResponseWriter, r *http.Request) {
+	var body RMASettings
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if body.WarrantyMonths < 0 || body.WarrantyMonths > 240 {
+		response.Err(w, "warranty_months must be between 0 and 240", 400)
+		return
+	}
+	if _, err := h.DB.Exec(`INSERT INTO app_settings (key, value) VALUES ('rma_warranty_months', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, strconv.Itoa(body.WarrantyMonths)); err != nil {
+		response.Err(w, "failed to save setting", 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "settings", "rma",
+		fmt.Sprintf("Set RMA warranty term to %d months", body.WarrantyMonths))
+	response.JSON(w, body)
+}
+
+// addRMALine saves a returned unit on an RMA opened at openedAt, taking
+// its IPN from the device when not given and its warranty or service
+// contract coverage as of openedAt.
+func (h *Handler) addRMALine(rmaID, openedAt string, l *models.RMALine) error {
+	l.RMAID = rmaID
+	l.SerialNumber = strings.TrimSpace(l.SerialNumber)
+	if l.IPN == "" {
+		h.DB.QueryRow("SELECT COALESCE(ipn,'') FROM devices WHERE serial_number=?", l.SerialNumber).Scan(&l.IPN)
+	}
+	cov := h.coverage(l.SerialNumber, openedAt)
+	l.Warranty, l.WarrantyExpires, l.ContractID = cov.Status, cov.Expires, cov.ContractID
+	l.Status = "open"
+	l.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	res, err := h.DB.Exec(`INSERT INTO rma_lines (rma_id, serial_number, ipn, defect_description, status, warranty, warranty_expires, contract_id, notes, created_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`, rmaID, l.SerialNumber, l.IPN, l.DefectDescription, l.Status, l.Warranty, l.WarrantyExpires, l.ContractID, l.Notes, l.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	l.ID = int(id)
+	return nil
+}
+
+const rmaLineColumns = `id, rma_id, serial_number, COALESCE(ipn,''), COALESCE(defect_description,''), status,
+	COALESCE(disposition,''), warranty, COALESCE(warranty_expires,''), COALESCE(repair_wo_id,''),
+	COALESCE(replacement_serial,''), COALESCE(advance_shipment_id,''), COALESCE(credit_amount,0), COALESCE(notes,''), created_at,
+	COALESCE(contract_id,'')`
+
+func scanRMALine(row interface{ Scan(...interface{}) error }) (models.RMALine, error) {
+	var l models.RMALine
+	err := row.Scan(&l.ID, &l.RMAID, &l.SerialNumber, &l.IPN, &l.DefectDescription, &l.Status,
+		&l.Disposition, &l.Warranty, &l.WarrantyExpires, &l.RepairWOID,
+		&l.ReplacementSerial, &l.AdvanceShipmentID, &l.CreditAmount, &l.Notes, &l.CreatedAt, &l.ContractID)
+	return l, err
+}
+
+func (h *Handler) rmaLines(rmaID string) []models.RMALine {
+	rows, err := h.DB.Query("SELECT "+rmaLineColumns+" FROM rma_lines WHERE rma_id=? ORDER BY id", rmaID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var lines []models.RMALine
+	for rows.Next() {
+		if l, err := scanRMALine(rows); err == nil {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func (h *Handler) rmaLine(rmaID, lineID string) (models.RMALine, error) {
+	return scanRMALine(h.DB.QueryRow("SELECT "+rmaLineColumns+" FROM rma_lines WHERE rma_id=? AND id=?", rmaID, lineID))
+}
+
+func (h *Handler) rmaParts(rmaID string) []models.RMAPart {
+	rows, err := h.DB.Query(`SELECT id, rma_id, COALESCE(line_id,0), wo_id, ipn, qty, COALESCE(notes,''), COALESCE(created_by,''), created_at
+		FROM rma_parts WHERE rma_id=? ORDER BY id`, rmaID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var parts []models.RMAPart
+	for rows.Next() {
+		var p models.RMAPart
+		if rows.Scan(&p.ID, &p.RMAID, &p.LineID, &p.WOID, &p.IPN, &p.Qty, &p.Notes, &p.CreatedBy, &p.CreatedAt) == nil {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// rmaOpen loads an RMA's status, reporting 404 when it does not exist and
+// 400 when it is already closed or scrapped.
+func (h *Handler) rmaOpen(w http.ResponseWriter, rmaID string) (status string, ok bool) {
+	if err := h.DB.QueryRow("SELECT status FROM rmas WHERE id=?", rmaID).Scan(&status); err != nil {
+		response.Err(w, "not found", 404)
+		return "", false
+	}
+	if status == "closed" || status == "scrapped" {
+		response.Err(w, "RMA is "+status, 400)
+		return "", false
+	}
+	return status, true
+}
+
+// rmaDB is what the line helpers need from *sql.DB or *sql.Tx, so they can
+// run inside the caller's transaction.
+type rmaDB interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func setDeviceStatus(db rmaDB, serial, status string) error {
+	if serial == "" {
+		return nil
+	}
+	_, err := db.Exec("UPDATE devices SET status=? WHERE serial_number=?", status, serial)
+	return err
+}
+
+// activateReplacement registers the replacement unit of a line as an
+// active device of the returned unit's customer; it starts its own
+// warranty on the day it goes out.
+func activateReplacement(db rmaDB, l models.RMALine) error {
+	if l.ReplacementSerial == "" {
+		return nil
+	}
+	var customer, location sql.NullString
+	if db.QueryRow("SELECT customer, location FROM devices WHERE serial_number=?", l.SerialNumber).Scan(&customer, &location) != nil {
+		db.QueryRow("SELECT customer FROM rmas WHERE id=?", l.RMAID).Scan(&customer)
+	}
+	today := time.Now().Format("2006-01-02")
+	if _, err := db.Exec(`INSERT OR IGNORE INTO devices (serial_number, ipn, customer, location, status, install_date, notes)
+		VALUES (?,?,?,?,'active',?,?)`, l.ReplacementSerial, l.IPN, customer.String, location.String, today,
+		"Replacement for "+l.SerialNumber+" ("+l.RMAID+")"); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE devices SET status='active', customer=? WHERE serial_number=?", customer.String, l.ReplacementSerial)
+	return err
+}
+
+// finishLine closes a line with status and moves its devices on: a
+// repaired unit goes back into service, a replaced, credited or scrapped
+// one is decommissioned and a replacement becomes active.
+func finishLine(tx *sql.Tx, l models.RMALine, status string) error {
+	if _, err := tx.Exec("UPDATE rma_lines SET status=? WHERE id=?", status, l.ID); err != nil {
+		return err
+	}
+	switch status {
+	case "repaired":
+		return setDeviceStatus(tx, l.SerialNumber, "active")
+	case "replaced":
+		if err := setDeviceStatus(tx, l.SerialNumber, "decommissioned"); err != nil {
+			return err
+		}
+		return activateReplacement(tx, l)
+	case "credited", "scrapped":
+		return setDeviceStatus(tx, l.SerialNumber, "decommissioned")
+	}
+	return nil
+}
+
+func lineClosed(status string) bool {
+	return status != "open" && status != "repairing"
+}
+
+// syncRMAStatus carries a new RMA status to its lines and devices. Units
+// are in RMA from receipt; resolving or closing the RMA finishes every
+// line with a disposition and returns undispositioned units as they are;
+// scrapping it scraps the open lines.
+func syncRMAStatus(tx *sql.Tx, lines []models.RMALine, status string) error {
+	for _, l := range lines {
+		if lineClosed(l.Status) {
+			continue
+		}
+		var err error
+		switch status {
+		case "received", "diagnosing", "repairing":
+			err = setDeviceStatus(tx, l.SerialNumber, "rma")
+		case "resolved", "closed":
+			if closing, ok := rmaClosingStatus[l.Disposition]; ok {
+				err = finishLine(tx, l, closing)
+			} else {
+				err = setDeviceStatus(tx, l.SerialNumber, "active")
+			}
+		case "scrapped":
+			err = finishLine(tx, l, "scrapped")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddRMALine handles POST /api/rmas/:id/lines.
+func (h *Handler) AddRMALine(w http.ResponseWriter, r *http.Request, rmaID string) {
+	status, ok := h.rmaOpen(w, rmaID)
+	if !ok {
+		return
+	}
+	var l models.RMALine
+	if err := response.DecodeBody(r, &l); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "serial_number", strings.TrimSpace(l.SerialNumber))
+	validation.ValidateMaxLength(ve, "serial_number", l.SerialNumber, 100)
+	validation.ValidateMaxLength(ve, "defect_description", l.DefectDescription, 1000)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	var n int
+	h.DB.QueryRow("SELECT COUNT(*) FROM rma_lines WHERE rma_id=? AND serial_number=?", rmaID, strings.TrimSpace(l.SerialNumber)).Scan(&n)
+	if n > 0 {
+		response.Err(w, l.SerialNumber+" is already on "+rmaID, 409)
+		return
+	}
+	var openedAt string
+	h.DB.QueryRow("SELECT created_at FROM rmas WHERE id=?", rmaID).Scan(&openedAt)
+	if err := h.addRMALine(rmaID, openedAt, &l); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if status != "open" {
+		if err := setDeviceStatus(h.DB, l.SerialNumber, "rma"); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "rma", rmaID, "Added "+l.SerialNumber+" to "+rmaID)
+	response.JSON(w, l)
+}
+
+// UpdateRMALine handles PUT /api/rmas/:id/lines/:lineID. Only the fields
+// given change. Setting a closing status (repaired, replaced, credited)
+// needs the matching disposition, and replaced a replacement_serial.
+func (h *Handler) UpdateRMALine(w http.ResponseWriter, r *http.Request, rmaID, lineID string) {
+	if _, ok := h.rmaOpen(w, rmaID); !ok {
+		return
+	}
+	l, err := h.rmaLine(rmaID, lineID)
+	if err != nil {
+		response.Err(w, "line not found", 404)
+		return
+	}
+	var body struct {
+		Disposition       *string  `json:"disposition"`
+		Status            *string  `json:"status"`
+		ReplacementSerial *string  `json:"replacement_serial"`
+		CreditAmount      *float64 `json:"credit_amount"`
+		DefectDescription *string  `json:"defect_description"`
+		Notes             *string  `json:"notes"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if lineClosed(l.Status) {
+		response.Err(w, "line is already "+l.Status, 400)
+		return
+	}
+	next := l
+	if body.Disposition != nil {
+		next.Disposition = *body.Disposition
+	}
+	if body.ReplacementSerial != nil {
+		next.ReplacementSerial = strings.TrimSpace(*body.ReplacementSerial)
+	}
+	if body.CreditAmount != nil {
+		next.CreditAmount = *body.CreditAmount
+	}
+	if body.DefectDescription != nil {
+		next.DefectDescription = *body.DefectDescription
+	}
+	if body.Notes != nil {
+		next.Notes = *body.Notes
+	}
+	if body.Status != nil {
+		next.Status = *body.Status
+	}
+
+	ve := &validation.ValidationErrors{}
+	if next.Disposition != "" {
+		validation.ValidateEnum(ve, "disposition", next.Disposition, []string{"repair", "replace", "credit"})
+	}
+	validation.ValidateEnum(ve, "status", next.Status, validRMALineStatuses)
+	validation.ValidateNonNegativeFloat(ve, "credit_amount", next.CreditAmount)
+	validation.ValidateMaxLength(ve, "defect_description", next.DefectDescription, 1000)
+	if next.ReplacementSerial != "" && next.ReplacementSerial == l.SerialNumber {
+		ve.Add("replacement_serial", "must differ from the returned unit")
+	}
+	if l.AdvanceShipmentID != "" && next.Disposition != "replace" {
+		ve.Add("disposition", "must stay replace after an advance replacement shipped")
+	}
+	if lineClosed(next.Status) && next.Status != "scrapped" && rmaClosingStatus[next.Disposition] != next.Status {
+		ve.Add("status", next.Status+" needs the matching disposition")
+	}
+	if next.Status == "replaced" && next.ReplacementSerial == "" {
+		ve.Add("replacement_serial", "is required to close a replacement")
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE rma_lines SET disposition=?, replacement_serial=?, credit_amount=?, defect_description=?, notes=? WHERE id=?`,
+		next.Disposition, next.ReplacementSerial, next.CreditAmount, next.DefectDescription, next.Notes, l.ID)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if next.Status != l.Status {
+		if lineClosed(next.Status) {
+			err = finishLine(tx, next, next.Status)
+		} else {
+			_, err = tx.Exec("UPDATE rma_lines SET status=? WHERE id=?", next.Status, l.ID)
+		}
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	summary := fmt.Sprintf("Line %s on %s: disposition=%s status=%s", l.SerialNumber, rmaID, next.Disposition, next.Status)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "rma", rmaID, summary)
+	l, _ = h.rmaLine(rmaID, lineID)
+	response.JSON(w, l)
+}
+
+// CreateRMARepairWO handles POST /api/rmas/:id/repair-wo, opening repair
+// work orders for the lines dispositioned repair (or those in line_ids,
+// which are set to repair), one per IPN. The lines and the RMA move to
+// repairing.
+func (h *Handler) CreateRMARepairWO(w http.ResponseWriter, r *http.Request, rmaID string) {
+	status, ok := h.rmaOpen(w, rmaID)
+	if !ok {
+		return
+	}
+	var body struct {
+		LineIDs  []int  `json:"line_ids"`
+		Priority string `json:"priority"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if body.Priority == "" {
+		body.Priority = "normal"
+	}
+	ve := &validation.ValidationErrors{}
+	validation.ValidateEnum(ve, "priority", body.Priority, validation.ValidWOPriorities)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	listed := map[int]bool{}
+	for _, id := range body.LineIDs {
+		listed[id] = true
+	}
+
+	byIPN := map[string][]models.RMALine{}
+	for _, l := range h.rmaLines(rmaID) {
+		if len(listed) > 0 && !listed[l.ID] {
+			continue
+		}
+		if l.Status != "open" || l.RepairWOID != "" {
+			if listed[l.ID] {
+				response.Err(w, fmt.Sprintf("line %d (%s) is not open for repair", l.ID, l.SerialNumber), 400)
+				return
+			}
+			continue
+		}
+		if l.Disposition != "repair" && !(listed[l.ID] && l.Disposition == "") {
+			if listed[l.ID] {
+				response.Err(w, fmt.Sprintf("line %d (%s) is dispositioned %s", l.ID, l.SerialNumber, l.Disposition), 400)
+				return
+			}
+			continue
+		}
+		if l.IPN == "" {
+			response.Err(w, fmt.Sprintf("line %d (%s) has no IPN to repair", l.ID, l.SerialNumber), 400)
+			return
+		}
+		byIPN[l.IPN] = append(byIPN[l.IPN], l)
+	}
+	if len(byIPN) == 0 {
+		response.Err(w, "no lines to repair", 400)
+		return
+	}
+	ipns := make([]string, 0, len(byIPN))
+	for ipn := range byIPN {
+		ipns = append(ipns, ipn)
+	}
+	sort.Strings(ipns)
+
+	type RepairWO struct {
+		ID          string   `json:"id"`
+		AssemblyIPN string   `json:"assembly_ipn"`
+		Qty         int      `json:"qty"`
+		Serials     []string `json:"serials"`
+	}
+	username := audit.GetUsername(h.DB, r)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	// The work orders are written in one transaction, so NextIDFunc cannot
+	// see the earlier ones; later IDs follow on from the first.
+	created := []RepairWO{}
+	firstID := h.NextIDFunc("WO", "work_orders", 4)
+	for i, ipn := range ipns {
+		wo := RepairWO{ID: followingID(firstID, i), AssemblyIPN: ipn, Qty: len(byIPN[ipn])}
+		for _, l := range byIPN[ipn] {
+			wo.Serials = append(wo.Serials, l.SerialNumber)
+		}
+		created = append(created, wo)
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	for _, wo := range created {
+		notes := "Repair for " + rmaID + ": " + strings.Join(wo.Serials, ", ")
+		if _, err := tx.Exec("INSERT INTO work_orders (id,assembly_ipn,qty,status,priority,notes,created_at) VALUES (?,?,?,'open',?,?,?)",
+			wo.ID, wo.AssemblyIPN, wo.Qty, body.Priority, notes, now); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		for _, l := range byIPN[wo.AssemblyIPN] {
+			// The status guard keeps a line from getting two repair orders
+			// when requests overlap.
+			res, err := tx.Exec("UPDATE rma_lines SET disposition='repair', repair_wo_id=?, status='repairing' WHERE id=? AND status='open' AND COALESCE(repair_wo_id,'')=''", wo.ID, l.ID)
+			if err != nil {
+				response.Err(w, err.Error(), 500)
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				response.Err(w, fmt.Sprintf("line %d (%s) is not open for repair", l.ID, l.SerialNumber), 409)
+				return
+			}
+			if err := setDeviceStatus(tx, l.SerialNumber, "rma"); err != nil {
+				response.Err(w, err.Error(), 500)
+				return
+			}
+		}
+	}
+	if status == "open" || status == "received" || status == "diagnosing" {
+		if _, err := tx.Exec("UPDATE rmas SET status='repairing', received_at=COALESCE(received_at,?) WHERE id=?", now, rmaID); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	for _, wo := range created {
+		audit.LogAudit(h.DB, h.Hub, username, "created", "workorder", wo.ID, "Created WO "+wo.ID+" to repair "+rmaID)
+	}
+	audit.LogAudit(h.DB, h.Hub, username, "updated", "rma", rmaID, fmt.Sprintf("Opened %d repair work order(s) for %s", len(created), rmaID))
+	response.JSON(w, map[string]interface{}{"rma_id": rmaID, "work_orders": created})
+}
+
+// followingID returns the ID n places after id in its sequence: the
+// trailing number increased by n, keeping its width.
+func followingID(id string, n int) string {
+	i := len(id)
+	for i > 0 && id[i-1] >= '0' && id[i-1] <= '9' {
+		i--
+	}
+	seq, err := strconv.Atoi(id[i:])
+	if n == 0 || err != nil {
+		return id
+	}
+	return fmt.Sprintf("%s%0*d", id[:i], len(id)-i, seq+n)
+}
+
+// ConsumeRMAPart handles POST /api/rmas/:id/parts: spare components
+// issued from inventory to one of the RMA's repair work orders (wo_id,
+// the repair work order of line_id, or the RMA's only one).
+func (h *Handler) ConsumeRMAPart(w http.ResponseWriter, r *http.Request, rmaID string) {
+	if _, ok := h.rmaOpen(w, rmaID); !ok {
+		return
+	}
+	var p models.RMAPart
+	if err := response.DecodeBody(r, &p); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	p.IPN = strings.TrimSpace(p.IPN)
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "ipn", p.IPN)
+	validation.ValidatePositiveFloat(ve, "qty", p.Qty)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+
+	repairWOs := map[string]bool{}
+	for _, l := range h.rmaLines(rmaID) {
+		if p.LineID != 0 && l.ID == p.LineID {
+			if l.RepairWOID == "" {
+				response.Err(w, "line has no repair work order", 400)
+				return
+			}
+			p.WOID = l.RepairWOID
+		}
+		if l.RepairWOID != "" {
+			repairWOs[l.RepairWOID] = true
+		}
+	}
+	if p.WOID == "" && len(repairWOs) == 1 {
+		for id := range repairWOs {
+			p.WOID = id
+		}
+	}
+	if p.WOID == "" {
+		response.Err(w, "wo_id or line_id must name a repair work order of "+rmaID, 400)
+		return
+	}
+	if !repairWOs[p.WOID] {
+		response.Err(w, p.WOID+" is not a repair work order of "+rmaID, 400)
+		return
+	}
+
+	p.RMAID = rmaID
+	p.CreatedBy = audit.GetUsername(h.DB, r)
+	p.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	// Read and take the stock inside the transaction so concurrent issues
+	// cannot draw it below what is reserved.
+	var onHand, reserved float64
+	if err := tx.QueryRow("SELECT qty_on_hand, qty_reserved FROM inventory WHERE ipn=?", p.IPN).Scan(&onHand, &reserved); err != nil {
+		response.Err(w, p.IPN+" is not in inventory", 400)
+		return
+	}
+	res, err := tx.Exec("UPDATE inventory SET qty_on_hand=qty_on_hand-?, updated_at=? WHERE ipn=? AND qty_on_hand-qty_reserved>=?",
+		p.Qty, p.CreatedAt, p.IPN, p.Qty)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, fmt.Sprintf("only %g of %s available", onHand-reserved, p.IPN), 400)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO inventory_transactions (ipn,type,qty,reference,notes,created_at) VALUES (?,'issue',?,?,?,?)",
+		p.IPN, p.Qty, p.WOID, "Repair for "+rmaID, p.CreatedAt); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	res, err = tx.Exec("INSERT INTO rma_parts (rma_id, line_id, wo_id, ipn, qty, notes, created_by, created_at) VALUES (?,?,?,?,?,?,?,?)",
+		rmaID, p.LineID, p.WOID, p.IPN, p.Qty, p.Notes, p.CreatedBy, p.CreatedAt)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	p.ID = int(id)
+	audit.LogAudit(h.DB, h.Hub, p.CreatedBy, "updated", "rma", rmaID, fmt.Sprintf("Issued %g %s to %s", p.Qty, p.IPN, p.WOID))
+	response.JSON(w, p)
+}
+
+// AdvanceReplacement handles POST /api/rmas/:id/lines/:lineID/advance-replacement:
+// a replacement unit shipped before the returned one is received. The
+// line becomes a replacement and the shipment is created as a draft in
+// the shipments module.
+func (h *Handler) AdvanceReplacement(w http.ResponseWriter, r *http.Request, rmaID, lineID string) {
+	if _, ok := h.rmaOpen(w, rmaID); !ok {
+		return
+	}
+	l, err := h.rmaLine(rmaID, lineID)
+	if err != nil {
+		response.Err(w, "line not found", 404)
+		return
+	}
+	var body struct {
+		ReplacementSerial string `json:"replacement_serial"`
+		IPN               string `json:"ipn"`
+		ToAddress         string `json:"to_address"`
+		Carrier           string `json:"carrier"`
+		Notes             string `json:"notes"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	body.ReplacementSerial = strings.TrimSpace(body.ReplacementSerial)
+	if body.IPN == "" {
+		body.IPN = l.IPN
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "replacement_serial", body.ReplacementSerial)
+	validation.RequireField(ve, "ipn", body.IPN)
+	if body.ReplacementSerial != "" && body.ReplacementSerial == l.SerialNumber {
+		ve.Add("replacement_serial", "must differ from the returned unit")
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if l.AdvanceShipmentID != "" {
+		response.Err(w, "replacement already shipped on "+l.AdvanceShipmentID, 409)
+		return
+	}
+	if lineClosed(l.Status) || (l.Disposition != "" && l.Disposition != "replace") {
+		response.Err(w, "line is not open for replacement", 400)
+		return
+	}
+	if h.CreateShipment == nil {
+		response.Err(w, "shipments are not available", 500)
+		return
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	notes := "Advance replacement for " + l.SerialNumber + " (" + rmaID + ")"
+	if body.Notes != "" {
+		notes += ": " + body.Notes
+	}
+	shp := models.Shipment{Type: "outbound", Carrier: body.Carrier, ToAddress: body.ToAddress, Notes: notes, CreatedBy: username,
+		Lines: []models.ShipmentLine{{IPN: body.IPN, SerialNumber: body.ReplacementSerial, Qty: 1, RMAID: rmaID}}}
+	if err := h.CreateShipment(&shp); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	l.Disposition, l.ReplacementSerial, l.AdvanceShipmentID = "replace", body.ReplacementSerial, shp.ID
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE rma_lines SET disposition='replace', replacement_serial=?, advance_shipment_id=? WHERE id=?",
+		body.ReplacementSerial, shp.ID, l.ID); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := activateReplacement(tx, l); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	l, _ = h.rmaLine(rmaID, lineID)
+	audit.LogAudit(h.DB, h.Hub, username, "created", "shipment", shp.ID, "Created shipment "+shp.ID)
+	audit.LogAudit(h.DB, h.Hub, username, "updated", "rma", rmaID, "Advance replacement "+body.ReplacementSerial+" for "+l.SerialNumber+" on "+shp.ID)
+	response.JSON(w, map[string]interface{}{"line": l, "shipment": shp})
+}
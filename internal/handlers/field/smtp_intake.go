@@ -0,0 +1,132 @@
+package field
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// smtpIdleTimeout drops SMTP clients that stop talking.
+const smtpIdleTimeout = 5 * time.Minute
+
+// ServeSMTP accepts mail for the support address on l and files each
+// message with IngestEmail. It is a minimal receiving MTA (no relaying,
+// no TLS or AUTH) meant to sit behind the site's mail server or on a
+// private network. It returns when l is closed.
+func (h *Handler) ServeSMTP(l net.Listener, hostname string) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go h.smtpSession(conn, hostname)
+	}
+}
+
+// smtpPath extracts the address from "FROM:<a@b> SIZE=..." style arguments.
+func smtpPath(arg string) string {
+	if i := strings.Index(arg, ":"); i >= 0 {
+		arg = arg[i+1:]
+	}
+	arg = strings.TrimSpace(arg)
+	if i := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && i > 0 {
+		return arg[1:i]
+	}
+	if f := strings.Fields(arg); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+func (h *Handler) smtpSession(conn net.Conn, hostname string) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) bool {
+		return tp.PrintfLine("%d %s", code, msg) == nil
+	}
+	if !reply(220, hostname+" ZRP field report intake") {
+		return
+	}
+
+	var from string
+	var rcpt []string
+	haveFrom := false
+	for {
+		conn.SetDeadline(time.Now().Add(smtpIdleTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		ok := true
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			ok = reply(250, hostname)
+		case "EHLO":
+			ok = tp.PrintfLine("250-%s", hostname) == nil &&
+				tp.PrintfLine("250-SIZE %d", maxIntakeMessage) == nil &&
+				reply(250, "8BITMIME")
+		case "MAIL":
+			from, rcpt, haveFrom = smtpPath(arg), nil, true
+			ok = reply(250, "OK")
+		case "RCPT":
+			switch addr := smtpPath(arg); {
+			case !haveFrom:
+				ok = reply(503, "MAIL first")
+			case h.AcceptsRecipient(addr):
+				rcpt = append(rcpt, addr)
+				ok = reply(250, "OK")
+			default:
+				ok = reply(550, "no such mailbox")
+			}
+		case "DATA":
+			if len(rcpt) == 0 {
+				ok = reply(503, "RCPT first")
+				break
+			}
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			dr := tp.DotReader()
+			raw, err := io.ReadAll(io.LimitReader(dr, maxIntakeMessage+1))
+			if err != nil {
+				return
+			}
+			if len(raw) > maxIntakeMessage {
+				io.Copy(io.Discard, dr)
+				ok = reply(552, "message too large")
+			} else if res, err := h.IngestEmail(raw, rcpt); errors.Is(err, ErrIntakeDisabled) {
+				ok = reply(451, err.Error())
+			} else if err != nil {
+				log.Printf("email intake: message from %s rejected: %v", from, err)
+				ok = reply(554, err.Error())
+			} else {
+				ok = reply(250, fmt.Sprintf("OK filed on %s", res.ReportID))
+			}
+			from, rcpt, haveFrom = "", nil, false
+		case "RSET":
+			from, rcpt, haveFrom = "", nil, false
+			ok = reply(250, "OK")
+		case "NOOP":
+			ok = reply(250, "OK")
+		case "VRFY":
+			ok = reply(252, "cannot verify")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			ok = reply(502, "command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package field
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// Coverages a warranty policy or service contract can give.
+var validCoverages = []string{"parts_labor", "parts", "labor", "replacement"}
+
+// coverage reports whether the device with serial is covered on asOf
+// (YYYY-MM-DD...). The product warranty of the device's IPN (its
+// warranty_policies term, else the RMA warranty term) runs from the
+// install date; when it has run out, an active service contract covering
+// the device on that date still counts. Contracts list their devices or,
+// without any, cover every device of their customer.
+func (h *Handler) coverage(serial, asOf string) models.WarrantyStatus {
+	if len(asOf) >= 10 {
+		asOf = asOf[:10]
+	} else {
+		asOf = time.Now().Format("2006-01-02")
+	}
+	st := models.WarrantyStatus{Status: "unknown", AsOf: asOf}
+
+	var ipn, customer, installDate sql.NullString
+	found := h.DB.QueryRow("SELECT ipn, customer, install_date FROM devices WHERE serial_number=?", serial).
+		Scan(&ipn, &customer, &installDate) == nil
+	if found && len(installDate.String) >= 10 {
+		if installed, err := time.Parse("2006-01-02", installDate.String[:10]); err == nil {
+			term, cov := h.warrantyMonths(), "parts_labor"
+			var policyTerm int
+			var policyCov string
+			if h.DB.QueryRow("SELECT term_months, COALESCE(coverage,'') FROM warranty_policies WHERE ipn=?", ipn.String).Scan(&policyTerm, &policyCov) == nil {
+				term = policyTerm
+				if policyCov != "" {
+					cov = policyCov
+				}
+			}
+			st.WarrantyExpires = installed.AddDate(0, term, 0).Format("2006-01-02")
+			st.Status, st.Expires = "out", st.WarrantyExpires
+			if asOf < st.WarrantyExpires {
+				st.Status, st.Source, st.Coverage = "in", "warranty", cov
+				return st
+			}
+		}
+	}
+
+	var id, end, cov string
+	err := h.DB.QueryRow(`SELECT c.id, c.end_date, COALESCE(c.coverage,'') FROM service_contracts c
+		WHERE c.status='active' AND c.start_date <= ? AND c.end_date >= ?
+		AND (EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id AND d.serial_number=?)
+			OR (c.customer=? AND NOT EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id)))
+		ORDER BY c.end_date DESC LIMIT 1`, asOf, asOf, serial, customer.String).Scan(&id, &end, &cov)
+	if err == nil {
+		st.Status, st.Source, st.Coverage, st.Expires, st.ContractID = "in", "contract", cov, end, id
+	}
+	return st
+}
+
+// --- Warranty policies ---
+
+const warrantyPolicyColumns = `id, ipn, term_months, COALESCE(coverage,''), COALESCE(terms,''), COALESCE(created_by,''), created_at, updated_at`
+
+func scanWarrantyPolicy(row interface{ Scan(...interface{}) error }) (models.WarrantyPolicy, error) {
+	var p models.WarrantyPolicy
+	err := row.Scan(&p.ID, &p.IPN, &p.TermMonths, &p.Coverage, &p.Terms, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func validateWarrantyPolicy(p *models.WarrantyPolicy) *validation.ValidationErrors {
+	p.IPN = strings.TrimSpace(p.IPN)
+	if p.Coverage == "" {
+		p.Coverage = "parts_labor"
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "ipn", p.IPN)
+	validation.ValidateMaxLength(ve, "ipn", p.IPN, 100)
+	validation.ValidateIntRange(ve, "term_months", p.TermMonths, 0, 240)
+	validation.ValidateEnum(ve, "coverage", p.Coverage, validCoverages)
+	validation.ValidateMaxLength(ve, "terms", p.Terms, 10000)
+	return ve
+}
+
+// ListWarrantyPolicies handles GET /api/warranty-policies.
+func (h *Handler) ListWarrantyPolicies(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT " + warrantyPolicyColumns + " FROM warranty_policies ORDER BY ipn")
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.WarrantyPolicy{}
+	for rows.Next() {
+		if p, err := scanWarrantyPolicy(rows); err == nil {
+			items = append(items, p)
+		}
+	}
+	response.JSON(w, items)
+}
+
+// CreateWarrantyPolicy handles POST /api/warranty-policies.
+func (h *Handler) CreateWarrantyPolicy(w http.ResponseWriter, r *http.Request) {
+	var p models.WarrantyPolicy
+	if err := response.DecodeBody(r, &p); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if ve := validateWarrantyPolicy(&p); ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	var n int
+	h.DB.QueryRow("SELECT COUNT(*) FROM warranty_policies WHERE ipn=?", p.IPN).Scan(&n)
+	if n > 0 {
+		response.Err(w, p.IPN+" already has a warranty policy", 409)
+		return
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	p.CreatedBy = audit.GetUsername(h.DB, r)
+	res, err := h.DB.Exec("INSERT INTO warranty_policies (ipn, term_months, coverage, terms, created_by, created_at, updated_at) VALUES (?,?,?,?,?,?,?)",
+		p.IPN, p.TermMonths, p.Coverage, p.Terms, p.CreatedBy, now, now)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	p.ID = int(id)
+	p.CreatedAt, p.UpdatedAt = now, now
+	audit.LogAudit(h.DB, h.Hub, p.CreatedBy, "created", "device", p.IPN, fmt.Sprintf("Set %d month %s warranty for %s", p.TermMonths, p.Coverage, p.IPN))
+	response.JSON(w, p)
+}
+
+// UpdateWarrantyPolicy handles PUT /api/warranty-policies/:id.
+func (h *Handler) UpdateWarrantyPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	old, err := scanWarrantyPolicy(h.DB.QueryRow("SELECT "+warrantyPolicyColumns+" FROM warranty_policies WHERE id=?", id))
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	var p models.WarrantyPolicy
+	if err := response.DecodeBody(r, &p); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	p.IPN = old.IPN
+	if ve := validateWarrantyPolicy(&p); ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := h.DB.Exec("UPDATE warranty_policies SET term_months=?, coverage=?, terms=?, updated_at=? WHERE id=?",
+		p.TermMonths, p.Coverage, p.Terms, now, id); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "device", p.IPN,
+		fmt.Sprintf("Changed %s warranty from %d to %d months", p.IPN, old.TermMonths, p.TermMonths))
+	p, _ = scanWarrantyPolicy(h.DB.QueryRow("SELECT "+warrantyPolicyColumns+" FROM warranty_policies WHERE id=?", id))
+	response.JSON(w, p)
+}
+
+// DeleteWarrantyPolicy handles DELETE /api/warranty-policies/:id.
+func (h *Handler) DeleteWarrantyPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	var ipn string
+	if err := h.DB.QueryRow("SELECT ipn FROM warranty_policies WHERE id=?", id).Scan(&ipn); err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM warranty_policies WHERE id=?", id); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "deleted", "device", ipn, "Removed warranty policy for "+ipn)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// --- Service contracts ---
+
+const serviceContractColumns = `id, customer, COALESCE(name,''), start_date, end_date, COALESCE(coverage,''), COALESCE(terms,''),
+	status, COALESCE(created_by,''), created_at`
+
+func scanServiceContract(row interface{ Scan(...interface{}) error }) (models.ServiceContract, error) {
+	var c models.ServiceContract
+	err := row.Scan(&c.ID, &c.Customer, &c.Name, &c.StartDate, &c.EndDate, &c.Coverage, &c.Terms, &c.Status, &c.CreatedBy, &c.CreatedAt)
+	return c, err
+}
+
+func (h *Handler) contractDevices(id string) []string {
+	devices := []string{}
+	rows, err := h.DB.Query("SELECT serial_number FROM service_contract_devices WHERE contract_id=? ORDER BY serial_number", id)
+	if err != nil {
+		return devices
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if rows.Scan(&s) == nil {
+			devices = append(devices, s)
+		}
+	}
+	return devices
+}
+
+func (h *Handler) serviceContract(id string) (models.ServiceContract, error) {
+	c, err := scanServiceContract(h.DB.QueryRow("SELECT "+serviceContractColumns+" FROM service_contracts WHERE id=?", id))
+	if err == nil {
+		c.Devices = h.contractDevices(id)
+	}
+	return c, err
+}
+
+// validateServiceContract checks a contract and that the devices it
+// lists are registered.
+func (h *Handler) validateServiceContract(c *models.ServiceContract) *validation.ValidationErrors {
+	c.Customer = strings.TrimSpace(c.Customer)
+	if c.Coverage == "" {
+		c.Coverage = "parts_labor"
+	}
+	if c.Status == "" {
+		c.Status = "active"
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "customer", c.Customer)
+	validation.ValidateMaxLength(ve, "customer", c.Customer, 255)
+	validation.ValidateMaxLength(ve, "name", c.Name, 255)
+	validation.RequireField(ve, "start_date", c.StartDate)
+	validation.RequireField(ve, "end_date", c.EndDate)
+	validation.ValidateDate(ve, "start_date", c.StartDate)
+	validation.ValidateDate(ve, "end_date", c.EndDate)
+	if c.StartDate != "" && c.EndDate != "" && c.EndDate < c.StartDate {
+		ve.Add("end_date", "must not be before start_date")
+	}
+	validation.ValidateEnum(ve, "coverage", c.Coverage, validCoverages)
+	validation.ValidateEnum(ve, "status", c.Status, []string{"active", "cancelled"})
+	validation.ValidateMaxLength(ve, "terms", c.Terms, 10000)
+	seen := map[string]bool{}
+	devices := []string{}
+	for _, s := range c.Devices {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		var n int
+		h.DB.QueryRow("SELECT COUNT(*) FROM devices WHERE serial_number=?", s).Scan(&n)
+		if n == 0 {
+			ve.Add("devices", "unknown device "+s)
+		}
+		devices = append(devices, s)
+	}
+	c.Devices = devices
+	return ve
+}
+
+func (h *Handler) saveContractDevices(tx *sql.Tx, c models.ServiceContract) error {
+	if _, err := tx.Exec("DELETE FROM service_contract_devices WHERE contract_id=?", c.ID); err != nil {
+		return err
+	}
+	for _, s := range c.Devices {
+		if _, err := tx.Exec("INSERT INTO service_contract_devices (contract_id, serial_number) VALUES (?,?)", c.ID, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListServiceContracts handles GET /api/service-contracts, filtered by
+// ?customer=, ?status= and ?serial= (contracts covering that device).
+func (h *Handler) ListServiceContracts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := "SELECT " + serviceContractColumns + " FROM service_contracts c WHERE 1=1"
+	var args []interface{}
+	if v := q.Get("customer"); v != "" {
+		query += " AND customer=?"
+		args = append(args, v)
+	}
+	if v := q.Get("status"); v != "" {
+		query += " AND status=?"
+		args = append(args, v)
+	}
+	if v := q.Get("serial"); v != "" {
+		query += ` AND (EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id AND d.serial_number=?)
+			OR (NOT EXISTS (SELECT 1 FROM service_contract_devices d WHERE d.contract_id=c.id)
+				AND customer=(SELECT customer FROM devices WHERE serial_number=?)))`
+		args = append(args, v, v)
+	}
+	rows, err := h.DB.Query(query+" ORDER BY end_date DESC, id", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	items := []models.ServiceContract{}
+	for rows.Next() {
+		if c, err := scanServiceContract(rows); err == nil {
+			items = append(items, c)
+		}
+	}
+	rows.Close()
+	for i := range items {
+		items[i].Devices = h.contractDevices(items[i].ID)
+	}
+	response.JSON(w, items)
+}
+
+// GetServiceContract handles GET /api/service-contracts/:id.
+func (h *Handler) GetServiceContract(w http.ResponseWriter, r *http.Request, id string) {
+	c, err := h.serviceContract(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	response.JSON(w, c)
+}
+
+// CreateServiceContract handles POST /api/service-contracts.
+func (h *Handler) CreateServiceContract(w http.ResponseWriter, r *http.Request) {
+	var c models.ServiceContract
+	if err := response.DecodeBody(r, &c); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if ve := h.validateServiceContract(&c); ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	c.ID = h.NextIDFunc("SC", "service_contracts", 3)
+	c.CreatedBy = audit.GetUsername(h.DB, r)
+	c.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO service_contracts (id, customer, name, start_date, end_date, coverage, terms, status, created_by, created_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`, c.ID, c.Customer, c.Name, c.StartDate, c.EndDate, c.Coverage, c.Terms, c.Status, c.CreatedBy, c.CreatedAt); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := h.saveContractDevices(tx, c); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, c.CreatedBy, "created", "device", c.ID,
+		fmt.Sprintf("Created service contract %s for %s, %s to %s", c.ID, c.Customer, c.StartDate, c.EndDate))
+	response.JSON(w, c)
+}
+
+// UpdateServiceContract handles PUT /api/service-contracts/:id. The
+// device list is replaced when given.
+func (h *Handler) UpdateServiceContract(w http.ResponseWriter, r *http.Request, id string) {
+	old, err := h.serviceContract(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	var c models.ServiceContract
+	if err := response.DecodeBody(r, &c); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	c.ID = id
+	if c.Devices == nil {
+		c.Devices = old.Devices
+	}
+	if ve := h.validateServiceContract(&c); ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE service_contracts SET customer=?, name=?, start_date=?, end_date=?, coverage=?, terms=?, status=? WHERE id=?`,
+		c.Customer, c.Name, c.StartDate, c.EndDate, c.Coverage, c.Terms, c.Status, id); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := h.saveContractDevices(tx, c); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "device", id,
+		fmt.Sprintf("Updated service contract %s: %s to %s, status=%s", id, c.StartDate, c.EndDate, c.Status))
+	c, _ = h.serviceContract(id)
+	response.JSON(w, c)
+}
+
+// ExpiringServiceContracts handles GET /api/service-contracts/expiring?days=30:
+// active contracts ending within the next days (default 30), soonest
+// first, with the number of devices each covers.
+func (h *Handler) ExpiringServiceContracts(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 3650 {
+			response.Err(w, "days must be between 0 and 3650", 400)
+			return
+		}
+		days = n
+	}
+	today := time.Now()
+	from, to := today.Format("2006-01-02"), today.AddDate(0, 0, days).Format("2006-01-02")
+	rows, err := h.DB.Query("SELECT "+serviceContractColumns+` FROM service_contracts
+		WHERE status='active' AND end_date >= ? AND end_date <= ? ORDER BY end_date, id`, from, to)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var contracts []models.ServiceContract
+	for rows.Next() {
+		if c, err := scanServiceContract(rows); err == nil {
+			contracts = append(contracts, c)
+		}
+	}
+	rows.Close()
+
+	type Expiring struct {
+		models.ServiceContract
+		DaysLeft    int `json:"days_left"`
+		DeviceCount int `json:"device_count"`
+	}
+	items := []Expiring{}
+	for _, c := range contracts {
+		c.Devices = h.contractDevices(c.ID)
+		e := Expiring{ServiceContract: c, DeviceCount: len(c.Devices)}
+		if end, err := time.Parse("2006-01-02", c.EndDate); err == nil {
+			e.DaysLeft = int(end.Sub(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		}
+		if len(c.Devices) == 0 {
+			h.DB.QueryRow("SELECT COUNT(*) FROM devices WHERE customer=?", c.Customer).Scan(&e.DeviceCount)
+		}
+		items = append(items, e)
+	}
+	response.JSON(w, map[string]interface{}{"days": days, "through": to, "contracts": items})
+}
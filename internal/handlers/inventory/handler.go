@@ -105,6 +105,11 @@ func (h *Handler) Transact(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Remember whether stock was above the reorder point before this transaction
+	var prevQty, reorderPoint float64
+	wasAboveReorder := h.DB.QueryRow("SELECT qty_on_hand, reorder_point FROM inventory WHERE ipn=?", t.IPN).
+		Scan(&prevQty, &reorderPoint) != nil || prevQty >= reorderPoint
+
 	// Begin transaction to ensure atomicity
 	tx, err := h.DB.Begin()
 	if err != nil {
@@ -150,6 +155,21 @@ func (h *Handler) Transact(w http.ResponseWriter, r *http.Request) {
 
 	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), t.Type, "inventory", t.IPN, "Inventory "+t.Type+": "+t.IPN)
 
+	// Announce a reorder point crossing once, when stock first drops below it
+	if h.Hub != nil && wasAboveReorder {
+		var qty float64
+		if h.DB.QueryRow("SELECT qty_on_hand, reorder_point FROM inventory WHERE ipn=?", t.IPN).Scan(&qty, &reorderPoint) == nil &&
+			reorderPoint > 0 && qty < reorderPoint {
+			h.Hub.Broadcast(websocket.Event{
+				Type:     "inventory_below_reorder",
+				ID:       t.IPN,
+				Action:   "below_reorder",
+				Resource: "inventory",
+				Data:     map[string]float64{"qty_on_hand": qty, "reorder_point": reorderPoint},
+			})
+		}
+	}
+
 	// Check low stock in background
 	if h.EmailOnLowStock != nil {
 		currentDB := h.DB
@@ -0,0 +1,555 @@
+package manufacturing
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// resolveBOM returns the work order's BOM resolved by ResolveBOM, nil when
+// there is none to resolve.
+func (h *Handler) resolveBOM(id, date string) (*models.BuildBOM, error) {
+	if h.ResolveBOM == nil {
+		return nil, nil
+	}
+	return h.ResolveBOM(id, date)
+}
+
+// stockLevel is the inventory of one IPN.
+type stockLevel struct {
+	onHand   float64
+	reserved float64
+}
+
+// stockLevels reads the inventory of the parts in lines and their
+// alternates. Parts without an inventory row have none.
+func (h *Handler) stockLevels(lines []models.BOMRequirement) map[string]stockLevel {
+	out := map[string]stockLevel{}
+	read := func(ipn string) {
+		if _, seen := out[ipn]; seen {
+			return
+		}
+		var s stockLevel
+		h.DB.QueryRow("SELECT qty_on_hand, qty_reserved FROM inventory WHERE ipn=?", ipn).Scan(&s.onHand, &s.reserved)
+		out[ipn] = s
+	}
+	for _, l := range lines {
+		read(l.IPN)
+		for _, alt := range l.Alternates {
+			read(alt)
+		}
+	}
+	return out
+}
+
+// altUse is the qty of one alternate used for a BOM line.
+type altUse struct {
+	IPN string  `json:"ipn"`
+	Qty float64 `json:"qty"`
+}
+
+// allocation is how one BOM line is covered: primary from its own part,
+// the rest from alternates.
+type allocation struct {
+	primary float64
+	alts    []altUse
+}
+
+func (a allocation) covered() float64 {
+	total := a.primary
+	for _, u := range a.alts {
+		total += u.Qty
+	}
+	return total
+}
+
+// allocateStock covers lines from avail, which it draws down. Every line
+// takes its own part first, in BOM order; lines still short then take
+// their alternates in order of preference. A part's stock so goes to the
+// lines that need it before it is used as a substitute.
+func allocateStock(lines []models.BOMRequirement, avail map[string]float64) []allocation {
+	out := make([]allocation, len(lines))
+	for i, l := range lines {
+		take := math.Min(l.Qty, math.Max(avail[l.IPN], 0))
+		out[i].primary = take
+		avail[l.IPN] -= take
+	}
+	for i, l := range lines {
+		short := l.Qty - out[i].primary
+		for _, alt := range l.Alternates {
+			if short <= 0 {
+				break
+			}
+			if take := math.Min(short, math.Max(avail[alt], 0)); take > 0 {
+				out[i].alts = append(out[i].alts, altUse{IPN: alt, Qty: take})
+				avail[alt] -= take
+				short -= take
+			}
+		}
+	}
+	return out
+}
+
+// writeResolvedBOM writes the BOM of a work order resolved for its build:
+// each line is the part revision in effect for the build date (?date=,
+// else the start date, else today) and the work order's serial numbers.
+// On-hand stock is shared between lines as in allocateStock; a line
+// covered only with the help of its alternates has status "alternate".
+func (h *Handler) writeResolvedBOM(w http.ResponseWriter, id, assemblyIPN string, qty int, bom *models.BuildBOM) {
+	type AlternateStock struct {
+		IPN       string  `json:"ipn"`
+		QtyOnHand float64 `json:"qty_on_hand"`
+		QtyUsed   float64 `json:"qty_used"`
+	}
+	type BOMLine struct {
+		IPN          string           `json:"ipn"`
+		Revision     string           `json:"revision,omitempty"`
+		Description  string           `json:"description"`
+		QtyRequired  float64          `json:"qty_required"`
+		QtyOnHand    float64          `json:"qty_on_hand"`
+		QtyAlternate float64          `json:"qty_alternate,omitempty"`
+		Shortage     float64          `json:"shortage"`
+		Status       string           `json:"status"`
+		Alternates   []AlternateStock `json:"alternates,omitempty"`
+	}
+
+	stock := h.stockLevels(bom.Lines)
+	avail := map[string]float64{}
+	for ipn, s := range stock {
+		avail[ipn] = s.onHand
+	}
+	allocs := allocateStock(bom.Lines, avail)
+
+	lines := []BOMLine{}
+	for i, l := range bom.Lines {
+		a := allocs[i]
+		bl := BOMLine{IPN: l.IPN, Revision: l.Revision, Description: l.Description, QtyRequired: l.Qty,
+			QtyOnHand: stock[l.IPN].onHand, QtyAlternate: a.covered() - a.primary}
+		bl.Shortage = math.Max(l.Qty-a.covered(), 0)
+		switch {
+		case a.primary >= l.Qty:
+			bl.Status = "ok"
+		case bl.Shortage == 0:
+			bl.Status = "alternate"
+		case a.covered() > 0:
+			bl.Status = "low"
+		default:
+			bl.Status = "shortage"
+		}
+		for _, alt := range l.Alternates {
+			as := AlternateStock{IPN: alt, QtyOnHand: stock[alt].onHand}
+			for _, u := range a.alts {
+				if u.IPN == alt {
+					as.QtyUsed = u.Qty
+				}
+			}
+			bl.Alternates = append(bl.Alternates, as)
+		}
+		lines = append(lines, bl)
+	}
+	out := map[string]interface{}{"wo_id": id, "assembly_ipn": assemblyIPN, "qty": qty, "bom": lines, "build_date": bom.Date}
+	if len(bom.Warnings) > 0 {
+		out["warnings"] = bom.Warnings
+	}
+	response.JSON(w, out)
+}
+
+// unitSubstitutions spreads the alternates used for each line over the
+// units of the build. Units take the line's own part first, in the order
+// of bom.Units (serials, then units without one), so the alternates go to
+// the last units.
+func unitSubstitutions(woID string, bom *models.BuildBOM, allocs []allocation) []models.WOSubstitution {
+	var out []models.WOSubstitution
+	add := func(serial string, l models.BOMRequirement, alt string, qty float64) {
+		for i := range out {
+			s := &out[i]
+			if s.SerialNumber == serial && s.IPN == l.IPN && s.Revision == l.Revision && s.AlternateIPN == alt {
+				s.Qty += qty
+				return
+			}
+		}
+		out = append(out, models.WOSubstitution{WOID: woID, SerialNumber: serial, IPN: l.IPN, Revision: l.Revision, AlternateIPN: alt, Qty: qty})
+	}
+	for i, l := range bom.Lines {
+		if len(allocs[i].alts) == 0 {
+			continue
+		}
+		primary := allocs[i].primary
+		alts := append([]altUse{}, allocs[i].alts...)
+		for _, u := range bom.Units {
+			need := 0.0
+			for _, ul := range u.Lines {
+				if ul.IPN == l.IPN && ul.Revision == l.Revision {
+					need += ul.Qty * u.Count
+				}
+			}
+			take := math.Min(need, primary)
+			primary -= take
+			need -= take
+			for len(alts) > 0 && need > 0 {
+				take := math.Min(need, alts[0].Qty)
+				add(u.Serial, l, alts[0].IPN, take)
+				need -= take
+				if alts[0].Qty -= take; alts[0].Qty <= 0 {
+					alts = alts[1:]
+				}
+			}
+		}
+		for _, rest := range alts {
+			add("", l, rest.IPN, rest.Qty)
+		}
+	}
+	return out
+}
+
+// kitResolvedBOM reserves the parts of a work order's resolved BOM. Short
+// lines are kitted from their alternates as in allocateStock, and each
+// alternate used is recorded as a substitution on the work order against
+// the serial number it goes into (see unitSubstitutions).
+func (h *Handler) kitResolvedBOM(w http.ResponseWriter, r *http.Request, id string, bom *models.BuildBOM) {
+	type KitResult struct {
+		IPN         string   `json:"ipn"`
+		Revision    string   `json:"revision,omitempty"`
+		Required    float64  `json:"required"`
+		OnHand      float64  `json:"on_hand"`
+		Reserved    float64  `json:"reserved"`
+		Kitted      float64  `json:"kitted"`
+		Status      string   `json:"status"`
+		Substitutes []altUse `json:"substitutes,omitempty"`
+	}
+
+	stock := h.stockLevels(bom.Lines)
+	avail := map[string]float64{}
+	for ipn, s := range stock {
+		avail[ipn] = s.onHand - s.reserved
+	}
+	allocs := allocateStock(bom.Lines, avail)
+	username := audit.GetUsername(h.DB, r)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+
+	reserve := func(ipn string, qty float64) error {
+		if qty <= 0 {
+			return nil
+		}
+		_, err := tx.Exec("UPDATE inventory SET qty_reserved = qty_reserved + ? WHERE ipn = ?", qty, ipn)
+		return err
+	}
+	kitResults := []KitResult{}
+	for i, l := range bom.Lines {
+		a := allocs[i]
+		result := KitResult{IPN: l.IPN, Revision: l.Revision, Required: l.Qty,
+			OnHand: stock[l.IPN].onHand, Reserved: stock[l.IPN].reserved, Substitutes: a.alts}
+		err := reserve(l.IPN, a.primary)
+		for _, u := range a.alts {
+			if err == nil {
+				err = reserve(u.IPN, u.Qty)
+			}
+		}
+		result.Kitted = a.covered()
+		switch {
+		case err != nil:
+			result.Status = "error"
+			result.Kitted = 0
+		case result.Kitted >= l.Qty:
+			result.Status = "kitted"
+		case result.Kitted > 0:
+			result.Status = "partial"
+		default:
+			result.Status = "shortage"
+		}
+		kitResults = append(kitResults, result)
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	subs := unitSubstitutions(id, bom, allocs)
+	for i := range subs {
+		s := &subs[i]
+		s.Reason, s.CreatedBy, s.CreatedAt = "kitting: "+s.IPN+" short", username, now
+		res, err := tx.Exec(`INSERT INTO wo_substitutions (wo_id, serial_number, ipn, revision, alternate_ipn, qty, reason, created_by, created_at)
+			VALUES (?,?,?,?,?,?,?,?,?)`, s.WOID, s.SerialNumber, s.IPN, s.Revision, s.AlternateIPN, s.Qty, s.Reason, s.CreatedBy, s.CreatedAt)
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		sid, _ := res.LastInsertId()
+		s.ID = int(sid)
+	}
+	if subs == nil {
+		subs = []models.WOSubstitution{}
+	}
+
+	if _, err := tx.Exec("UPDATE work_orders SET status = CASE WHEN status = 'open' THEN 'in_progress' ELSE status END WHERE id = ?", id); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	summary := "Kitted materials for WO " + id
+	if len(subs) > 0 {
+		summary += " using alternates"
+	}
+	audit.LogAudit(h.DB, h.Hub, username, "kitted", "workorder", id, summary)
+
+	response.JSON(w, map[string]interface{}{
+		"wo_id":         id,
+		"status":        "kitted",
+		"items":         kitResults,
+		"substitutions": subs,
+		"build_date":    bom.Date,
+		"kitted_at":     now,
+	})
+}
+
+// woSubstitutions lists the substitutions recorded on a work order.
+func (h *Handler) woSubstitutions(id string) ([]models.WOSubstitution, error) {
+	rows, err := h.DB.Query(`SELECT id, wo_id, COALESCE(serial_number,''), ipn, COALESCE(revision,''), alternate_ipn, qty,
+		COALESCE(reason,''), COALESCE(created_by,''), created_at FROM wo_substitutions WHERE wo_id=? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs := []models.WOSubstitution{}
+	for rows.Next() {
+		var s models.WOSubstitution
+		if err := rows.Scan(&s.ID, &s.WOID, &s.SerialNumber, &s.IPN, &s.Revision, &s.AlternateIPN, &s.Qty,
+			&s.Reason, &s.CreatedBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// WorkOrderSubstitutions handles GET /api/workorders/:id/substitutions.
+func (h *Handler) WorkOrderSubstitutions(w http.ResponseWriter, r *http.Request, id string) {
+	var exists int
+	if err := h.DB.QueryRow("SELECT 1 FROM work_orders WHERE id=?", id).Scan(&exists); err != nil {
+		response.Err(w, "work order not found", 404)
+		return
+	}
+	subs, err := h.woSubstitutions(id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, subs)
+}
+
+// WorkOrderAddSubstitution handles POST /api/workorders/:id/substitutions,
+// recording an alternate used by hand. The alternate must be approved for
+// the BOM line. With a serial_number the quantity is first taken from
+// substitutions kitting left without one, so it is not counted twice.
+// Inventory is not changed.
+func (h *Handler) WorkOrderAddSubstitution(w http.ResponseWriter, r *http.Request, id string) {
+	var exists int
+	if err := h.DB.QueryRow("SELECT 1 FROM work_orders WHERE id=?", id).Scan(&exists); err != nil {
+		response.Err(w, "work order not found", 404)
+		return
+	}
+	var s models.WOSubstitution
+	if err := response.DecodeBody(r, &s); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	s.IPN = strings.TrimSpace(s.IPN)
+	s.AlternateIPN = strings.TrimSpace(s.AlternateIPN)
+	s.SerialNumber = strings.TrimSpace(s.SerialNumber)
+
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "ipn", s.IPN)
+	validation.RequireField(ve, "alternate_ipn", s.AlternateIPN)
+	if s.Qty <= 0 {
+		ve.Add("qty", "must be positive")
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	bom, err := h.resolveBOM(id, "")
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	if bom == nil {
+		response.Err(w, "work order has no BOM to substitute on", 400)
+		return
+	}
+	var line *models.BOMRequirement
+	for i, l := range bom.Lines {
+		if l.IPN == s.IPN && (s.Revision == "" || strings.EqualFold(l.Revision, s.Revision)) {
+			line = &bom.Lines[i]
+			break
+		}
+	}
+	if line == nil {
+		response.Err(w, s.IPN+" is not on the work order's BOM", 400)
+		return
+	}
+	approved := false
+	for _, alt := range line.Alternates {
+		approved = approved || alt == s.AlternateIPN
+	}
+	if !approved {
+		response.Err(w, s.AlternateIPN+" is not an approved alternate for "+s.IPN, 400)
+		return
+	}
+	if s.SerialNumber != "" {
+		if err := h.DB.QueryRow("SELECT 1 FROM wo_serials WHERE wo_id=? AND serial_number=?", id, s.SerialNumber).Scan(&exists); err != nil {
+			response.Err(w, "serial "+s.SerialNumber+" is not on this work order", 400)
+			return
+		}
+	}
+
+	s.WOID, s.Revision = id, line.Revision
+	s.CreatedBy = audit.GetUsername(h.DB, r)
+	s.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if s.SerialNumber != "" {
+		rows, err := tx.Query(`SELECT id, qty FROM wo_substitutions
+			WHERE wo_id=? AND serial_number='' AND ipn=? AND revision=? AND alternate_ipn=? ORDER BY id`, id, s.IPN, s.Revision, s.AlternateIPN)
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		type pooled struct {
+			id  int
+			qty float64
+		}
+		var pool []pooled
+		for rows.Next() {
+			var p pooled
+			if rows.Scan(&p.id, &p.qty) == nil {
+				pool = append(pool, p)
+			}
+		}
+		rows.Close()
+		need := s.Qty
+		for _, p := range pool {
+			if need <= 0 {
+				break
+			}
+			if p.qty <= need {
+				_, err = tx.Exec("DELETE FROM wo_substitutions WHERE id=?", p.id)
+			} else {
+				_, err = tx.Exec("UPDATE wo_substitutions SET qty=qty-? WHERE id=?", need, p.id)
+			}
+			if err != nil {
+				response.Err(w, err.Error(), 500)
+				return
+			}
+			need -= math.Min(need, p.qty)
+		}
+	}
+	res, err := tx.Exec(`INSERT INTO wo_substitutions (wo_id, serial_number, ipn, revision, alternate_ipn, qty, reason, created_by, created_at)
+		VALUES (?,?,?,?,?,?,?,?,?)`, s.WOID, s.SerialNumber, s.IPN, s.Revision, s.AlternateIPN, s.Qty, s.Reason, s.CreatedBy, s.CreatedAt)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	sid, _ := res.LastInsertId()
+	s.ID = int(sid)
+	target := "WO " + id
+	if s.SerialNumber != "" {
+		target = s.SerialNumber
+	}
+	audit.LogAudit(h.DB, h.Hub, s.CreatedBy, "substituted", "workorder", id, "Used "+s.AlternateIPN+" for "+s.IPN+" in "+target)
+	response.JSON(w, s)
+}
+
+// WorkOrderAsBuilt handles GET /api/workorders/:id/serials/:serial/as-built:
+// the BOM of that unit with the part actually used for each line, its own
+// part or the alternates recorded against the serial. Substitutions not
+// yet tied to a serial are listed separately.
+func (h *Handler) WorkOrderAsBuilt(w http.ResponseWriter, r *http.Request, id, serial string) {
+	var status string
+	if err := h.DB.QueryRow("SELECT status FROM wo_serials WHERE wo_id=? AND serial_number=?", id, serial).Scan(&status); err != nil {
+		response.Err(w, "serial not found on this work order", 404)
+		return
+	}
+	bom, err := h.resolveBOM(id, "")
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	if bom == nil {
+		response.Err(w, "work order has no BOM", 400)
+		return
+	}
+	subs, err := h.woSubstitutions(id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	type UsedPart struct {
+		IPN        string  `json:"ipn"`
+		Qty        float64 `json:"qty"`
+		Substitute bool    `json:"substitute,omitempty"`
+	}
+	type AsBuiltLine struct {
+		IPN         string     `json:"ipn"`
+		Revision    string     `json:"revision,omitempty"`
+		Description string     `json:"description"`
+		Qty         float64    `json:"qty"`
+		Used        []UsedPart `json:"used"`
+	}
+	lines := []AsBuiltLine{}
+	for _, u := range bom.Units {
+		if u.Serial != serial {
+			continue
+		}
+		for _, l := range u.Lines {
+			line := AsBuiltLine{IPN: l.IPN, Revision: l.Revision, Description: l.Description, Qty: l.Qty}
+			own := l.Qty
+			for _, s := range subs {
+				if s.SerialNumber == serial && s.IPN == l.IPN && s.Revision == l.Revision {
+					line.Used = append(line.Used, UsedPart{IPN: s.AlternateIPN, Qty: s.Qty, Substitute: true})
+					own -= s.Qty
+				}
+			}
+			if own > 0 {
+				line.Used = append([]UsedPart{{IPN: l.IPN, Qty: own}}, line.Used...)
+			}
+			lines = append(lines, line)
+		}
+	}
+	unassigned := []models.WOSubstitution{}
+	for _, s := range subs {
+		if s.SerialNumber == "" {
+			unassigned = append(unassigned, s)
+		}
+	}
+	response.JSON(w, map[string]interface{}{
+		"wo_id":                    id,
+		"serial_number":            serial,
+		"status":                   status,
+		"assembly_ipn":             bom.AssemblyIPN,
+		"build_date":               bom.Date,
+		"lines":                    lines,
+		"unassigned_substitutions": unassigned,
+	})
+}
@@ -2,6 +2,7 @@ package manufacturing
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"html"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"zrp/internal/database"
 	"zrp/internal/models"
 	"zrp/internal/response"
+	"zrp/internal/training"
 	"zrp/internal/validation"
 	"zrp/internal/websocket"
 )
@@ -35,6 +37,11 @@ type Handler struct {
 
 	// EmailOnOverdueWorkOrder sends an email notification for overdue work orders.
 	EmailOnOverdueWorkOrder func(woID string)
+
+	// ResolveBOM resolves a work order's BOM for a build date ("" for the
+	// default) and its serial numbers. It returns nil when the assembly has
+	// no BOM file.
+	ResolveBOM func(woID, date string) (*models.BuildBOM, error)
 }
 
 // ListWorkOrders handles GET /api/workorders.
@@ -201,6 +208,21 @@ func (h *Handler) UpdateWorkOrder(w http.ResponseWriter, r *http.Request, id str
 		return
 	}
 
+	username := audit.GetUsername(h.DB, r)
+
+	// Completing a build requires current training on its documents
+	if wo.Status == "completed" && currentWO.Status != "completed" {
+		if err := training.Require(h.DB, username, wo.AssemblyIPN, training.ActivityBuild); err != nil {
+			var nq *training.NotQualifiedError
+			if errors.As(err, &nq) {
+				response.Err(w, nq.Error(), 403)
+			} else {
+				response.Err(w, err.Error(), 500)
+			}
+			return
+		}
+	}
+
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	// Start transaction for atomic updates
@@ -219,8 +241,6 @@ func (h *Handler) UpdateWorkOrder(w http.ResponseWriter, r *http.Request, id str
 		return
 	}
 
-	username := audit.GetUsername(h.DB, r)
-
 	// Handle inventory integration on completion
 	if wo.Status == "completed" && currentWO.Status != "completed" {
 		err = HandleWorkOrderCompletion(tx, id, wo.AssemblyIPN, wo.Qty, username)
@@ -245,6 +265,9 @@ func (h *Handler) UpdateWorkOrder(w http.ResponseWriter, r *http.Request, id str
 	}
 
 	audit.LogAudit(h.DB, h.Hub, username, "updated", "workorder", id, "Updated WO "+id+": status="+wo.Status)
+	if wo.Status == "completed" && currentWO.Status != "completed" {
+		audit.LogAudit(h.DB, h.Hub, username, "completed", "workorder", id, fmt.Sprintf("Completed WO %s: %d x %s", id, wo.Qty, wo.AssemblyIPN))
+	}
 	newSnap, _ := h.GetWorkOrderSnapshot(id)
 	h.RecordChangeJSON(username, "work_orders", id, "update", oldSnap, newSnap)
 	if h.EmailOnOverdueWorkOrder != nil {
@@ -365,7 +388,9 @@ func HandleWorkOrderCancellation(tx *sql.Tx, woID string) error {
 	return nil
 }
 
-// WorkOrderBOM handles GET /api/workorders/:id/bom.
+// WorkOrderBOM handles GET /api/workorders/:id/bom. When the assembly has a
+// BOM file the BOM is resolved for the build (see writeResolvedBOM);
+// otherwise every stocked part is listed at the work order qty.
 func (h *Handler) WorkOrderBOM(w http.ResponseWriter, r *http.Request, id string) {
 	var assemblyIPN string
 	var qty int
@@ -384,6 +409,16 @@ func (h *Handler) WorkOrderBOM(w http.ResponseWriter, r *http.Request, id string
 		Status      string  `json:"status"`
 	}
 
+	resolved, err := h.resolveBOM(id, r.URL.Query().Get("date"))
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	if resolved != nil {
+		h.writeResolvedBOM(w, id, assemblyIPN, qty, resolved)
+		return
+	}
+
 	rows, _ := h.DB.Query(`SELECT ipn, qty_on_hand FROM inventory
 		WHERE qty_on_hand > 0 OR qty_reserved > 0
 		ORDER BY ipn LIMIT 1000`)
@@ -575,7 +610,9 @@ func (h *Handler) WorkOrderPDF(w http.ResponseWriter, r *http.Request, id string
 	w.Write([]byte(htmlOutput))
 }
 
-// WorkOrderKit handles POST /api/workorders/:id/kit.
+// WorkOrderKit handles POST /api/workorders/:id/kit. It reserves the parts
+// of the resolved BOM (see kitResolvedBOM); without a BOM file it reserves
+// the work order qty of every stocked part.
 func (h *Handler) WorkOrderKit(w http.ResponseWriter, r *http.Request, id string) {
 	var assemblyIPN string
 	var qty int
@@ -591,6 +628,16 @@ func (h *Handler) WorkOrderKit(w http.ResponseWriter, r *http.Request, id string
 		return
 	}
 
+	resolved, err := h.resolveBOM(id, "")
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	if resolved != nil {
+		h.kitResolvedBOM(w, r, id, resolved)
+		return
+	}
+
 	type KitResult struct {
 		IPN      string  `json:"ipn"`
 		Required float64 `json:"required"`
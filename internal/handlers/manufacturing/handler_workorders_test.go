@@ -346,3 +346,216 @@ func TestGenerateSerialNumber(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkOrderKit_ResolvedBOM(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	h.ResolveBOM = func(woID, date string) (*models.BuildBOM, error) {
+		return &models.BuildBOM{AssemblyIPN: "ASY-001", Date: "2026-05-20", Lines: []models.BOMRequirement{
+			{IPN: "PART-001", Revision: "A", Qty: 4},
+			{IPN: "PART-001", Revision: "B", Qty: 8},
+			{IPN: "PART-004", Qty: 1},
+		}, Warnings: []string{"PART-001 rev B is draft"}}, nil
+	}
+
+	testDB.Exec(`INSERT INTO work_orders (id, assembly_ipn, qty, status, created_at) VALUES ('WO001', 'ASY-001', 4, 'open', '2026-01-01 00:00:00')`)
+	testDB.Exec(`INSERT INTO inventory (ipn, qty_on_hand, qty_reserved) VALUES ('PART-001', 10.0, 0.0), ('PART-002', 3.0, 0.0)`)
+
+	rr := httptest.NewRecorder()
+	h.WorkOrderBOM(rr, httptest.NewRequest("GET", "/api/v1/workorders/WO001/bom", nil), "WO001")
+	var bom struct {
+		Data struct {
+			BuildDate string   `json:"build_date"`
+			Warnings  []string `json:"warnings"`
+			BOM       []struct {
+				IPN         string  `json:"ipn"`
+				Revision    string  `json:"revision"`
+				QtyRequired float64 `json:"qty_required"`
+				Status      string  `json:"status"`
+			} `json:"bom"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.Data.BuildDate != "2026-05-20" || len(bom.Data.Warnings) != 1 || len(bom.Data.BOM) != 3 {
+		t.Fatalf("bom = %+v", bom.Data)
+	}
+	if l := bom.Data.BOM[1]; l.Revision != "B" || l.QtyRequired != 8 || l.Status != "low" {
+		t.Errorf("rev B line = %+v", l)
+	}
+
+	rr = httptest.NewRecorder()
+	h.WorkOrderKit(rr, httptest.NewRequest("POST", "/api/v1/workorders/WO001/kit", nil), "WO001")
+	var kit struct {
+		Data struct {
+			Items []struct {
+				IPN      string  `json:"ipn"`
+				Revision string  `json:"revision"`
+				Kitted   float64 `json:"kitted"`
+				Status   string  `json:"status"`
+			} `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &kit); err != nil {
+		t.Fatal(err)
+	}
+	// Both revisions of PART-001 draw on the same 10 on hand.
+	items := kit.Data.Items
+	if len(items) != 3 || items[0].Kitted != 4 || items[1].Kitted != 6 || items[1].Status != "partial" || items[2].Status != "shortage" {
+		t.Fatalf("kit items = %+v", items)
+	}
+	var reserved float64
+	testDB.QueryRow("SELECT qty_reserved FROM inventory WHERE ipn = 'PART-001'").Scan(&reserved)
+	if reserved != 10 {
+		t.Errorf("PART-001 reserved = %v", reserved)
+	}
+	testDB.QueryRow("SELECT qty_reserved FROM inventory WHERE ipn = 'PART-002'").Scan(&reserved)
+	if reserved != 0 {
+		t.Errorf("PART-002 reserved = %v", reserved)
+	}
+}
+
+func TestWorkOrderKit_Alternates(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	// Two PART-001 per unit, with PART-002 then PART-003 approved in its
+	// place; one unit per serial on the work order, the rest unassigned.
+	h.ResolveBOM = func(woID, date string) (*models.BuildBOM, error) {
+		line := func(qty float64) []models.BOMRequirement {
+			return []models.BOMRequirement{{IPN: "PART-001", Qty: qty, Alternates: []string{"PART-002", "PART-003"}}}
+		}
+		bom := &models.BuildBOM{AssemblyIPN: "ASY-001", Date: "2026-05-20", Lines: line(6)}
+		rows, _ := testDB.Query("SELECT serial_number FROM wo_serials WHERE wo_id=? ORDER BY id", woID)
+		defer rows.Close()
+		for rows.Next() {
+			var sn string
+			rows.Scan(&sn)
+			bom.Units = append(bom.Units, models.BuildUnit{Serial: sn, Count: 1, Lines: line(2)})
+		}
+		if rest := 3 - len(bom.Units); rest > 0 {
+			bom.Units = append(bom.Units, models.BuildUnit{Count: float64(rest), Lines: line(2)})
+		}
+		return bom, nil
+	}
+
+	testDB.Exec(`INSERT INTO work_orders (id, assembly_ipn, qty, status, created_at) VALUES ('WO-ALT', 'ASY-001', 3, 'open', '2026-01-01 00:00:00')`)
+	testDB.Exec(`INSERT INTO wo_serials (wo_id, serial_number) VALUES ('WO-ALT', 'SN-1'), ('WO-ALT', 'SN-2')`)
+	testDB.Exec(`INSERT INTO inventory (ipn, qty_on_hand, qty_reserved) VALUES ('PART-001', 3, 0), ('PART-002', 2, 1), ('PART-003', 5, 0)`)
+
+	rr := httptest.NewRecorder()
+	h.WorkOrderBOM(rr, httptest.NewRequest("GET", "/api/v1/workorders/WO-ALT/bom", nil), "WO-ALT")
+	var bom struct {
+		Data struct {
+			BOM []struct {
+				QtyAlternate float64 `json:"qty_alternate"`
+				Shortage     float64 `json:"shortage"`
+				Status       string  `json:"status"`
+			} `json:"bom"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &bom)
+	if len(bom.Data.BOM) != 1 || bom.Data.BOM[0].Status != "alternate" || bom.Data.BOM[0].QtyAlternate != 3 || bom.Data.BOM[0].Shortage != 0 {
+		t.Fatalf("bom = %+v", bom.Data.BOM)
+	}
+
+	rr = httptest.NewRecorder()
+	h.WorkOrderKit(rr, httptest.NewRequest("POST", "/api/v1/workorders/WO-ALT/kit", nil), "WO-ALT")
+	var kit struct {
+		Data struct {
+			Items []struct {
+				Kitted float64 `json:"kitted"`
+				Status string  `json:"status"`
+			} `json:"items"`
+			Substitutions []models.WOSubstitution `json:"substitutions"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &kit)
+	if len(kit.Data.Items) != 1 || kit.Data.Items[0].Kitted != 6 || kit.Data.Items[0].Status != "kitted" {
+		t.Fatalf("kit items = %+v", kit.Data.Items)
+	}
+	// Only one PART-002 is free. SN-1 gets its own parts, SN-2 is one
+	// short and the unassigned unit is built from PART-003.
+	subs := kit.Data.Substitutions
+	if len(subs) != 2 || subs[0].SerialNumber != "SN-2" || subs[0].AlternateIPN != "PART-002" || subs[0].Qty != 1 ||
+		subs[1].SerialNumber != "" || subs[1].AlternateIPN != "PART-003" || subs[1].Qty != 2 {
+		t.Fatalf("substitutions = %+v", subs)
+	}
+	for ipn, want := range map[string]float64{"PART-001": 3, "PART-002": 2, "PART-003": 2} {
+		var reserved float64
+		testDB.QueryRow("SELECT qty_reserved FROM inventory WHERE ipn=?", ipn).Scan(&reserved)
+		if reserved != want {
+			t.Errorf("%s reserved = %v, want %v", ipn, reserved, want)
+		}
+	}
+
+	addSub := func(body string, want int) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.WorkOrderAddSubstitution(rr, httptest.NewRequest("POST", "/api/v1/workorders/WO-ALT/substitutions", bytes.NewBufferString(body)), "WO-ALT")
+		if rr.Code != want {
+			t.Fatalf("%s: expected %d, got %d: %s", body, want, rr.Code, rr.Body.String())
+		}
+	}
+	addSub(`{"ipn":"PART-001","alternate_ipn":"PART-009","qty":1}`, 400)
+	addSub(`{"ipn":"PART-004","alternate_ipn":"PART-002","qty":1}`, 400)
+	addSub(`{"ipn":"PART-001","alternate_ipn":"PART-003","qty":0}`, 400)
+	addSub(`{"serial_number":"SN-9","ipn":"PART-001","alternate_ipn":"PART-003","qty":2}`, 400)
+
+	// The third unit gets its serial; the kitted PART-003 moves to it.
+	testDB.Exec(`INSERT INTO wo_serials (wo_id, serial_number) VALUES ('WO-ALT', 'SN-3')`)
+	addSub(`{"serial_number":"SN-3","ipn":"PART-001","alternate_ipn":"PART-003","qty":2,"reason":"reel change"}`, 200)
+
+	rr = httptest.NewRecorder()
+	h.WorkOrderSubstitutions(rr, httptest.NewRequest("GET", "/api/v1/workorders/WO-ALT/substitutions", nil), "WO-ALT")
+	var list struct {
+		Data []models.WOSubstitution `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Data) != 2 || list.Data[1].SerialNumber != "SN-3" || list.Data[1].Qty != 2 {
+		t.Fatalf("substitutions = %+v", list.Data)
+	}
+
+	type used struct {
+		IPN        string  `json:"ipn"`
+		Qty        float64 `json:"qty"`
+		Substitute bool    `json:"substitute"`
+	}
+	asBuilt := func(serial string) []used {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.WorkOrderAsBuilt(rr, httptest.NewRequest("GET", "/", nil), "WO-ALT", serial)
+		if rr.Code != 200 {
+			t.Fatalf("as-built %s: %d %s", serial, rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Lines []struct {
+					Used []used `json:"used"`
+				} `json:"lines"`
+				Unassigned []models.WOSubstitution `json:"unassigned_substitutions"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if len(resp.Data.Lines) != 1 || len(resp.Data.Unassigned) != 0 {
+			t.Fatalf("as-built %s = %+v", serial, resp.Data)
+		}
+		return resp.Data.Lines[0].Used
+	}
+	if u := asBuilt("SN-1"); len(u) != 1 || u[0].IPN != "PART-001" || u[0].Qty != 2 {
+		t.Errorf("SN-1 used %+v", u)
+	}
+	if u := asBuilt("SN-2"); len(u) != 2 || u[0].Qty != 1 || u[1].IPN != "PART-002" || !u[1].Substitute {
+		t.Errorf("SN-2 used %+v", u)
+	}
+	if u := asBuilt("SN-3"); len(u) != 1 || u[0].IPN != "PART-003" || u[0].Qty != 2 {
+		t.Errorf("SN-3 used %+v", u)
+	}
+	rr = httptest.NewRecorder()
+	h.WorkOrderAsBuilt(rr, httptest.NewRequest("GET", "/", nil), "WO-ALT", "SN-9")
+	if rr.Code != 404 {
+		t.Errorf("unknown serial: expected 404, got %d", rr.Code)
+	}
+}
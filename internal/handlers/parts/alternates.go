@@ -0,0 +1,181 @@
+package parts
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"zrp/internal/response"
+)
+
+// PartAlternate approves AlternateIPN as a substitute for IPN. An empty
+// AssemblyIPN approves it everywhere; otherwise only in the BOM of that
+// assembly and its sub-assemblies. Lower Priority is preferred.
+type PartAlternate struct {
+	ID           int    `json:"id"`
+	IPN          string `json:"ipn"`
+	AlternateIPN string `json:"alternate_ipn"`
+	AssemblyIPN  string `json:"assembly_ipn,omitempty"`
+	Priority     int    `json:"priority"`
+	Notes        string `json:"notes,omitempty"`
+	CreatedBy    string `json:"created_by"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// splitAlternates reads the alternates cell of a BOM line.
+func splitAlternates(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|' || r == ' '
+	})
+}
+
+// mergeAlternates appends the alternates in add not already in list.
+func mergeAlternates(list, add []string) []string {
+	for _, a := range add {
+		if !containsString(list, a) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// approvedAlternates lists the alternates of ipn approved globally or for
+// any of assemblies, preferred first.
+func (h *Handler) approvedAlternates(ipn string, assemblies []string) []string {
+	if h.DB == nil {
+		return nil
+	}
+	args := []interface{}{ipn}
+	scope := "assembly_ipn=''"
+	for _, a := range assemblies {
+		scope += " OR assembly_ipn=?"
+		args = append(args, a)
+	}
+	rows, err := h.DB.Query(`SELECT alternate_ipn FROM part_alternates WHERE ipn=? AND (`+scope+`)
+		ORDER BY priority, id`, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var alt string
+		if rows.Scan(&alt) == nil && !containsString(out, alt) {
+			out = append(out, alt)
+		}
+	}
+	return out
+}
+
+// ListPartAlternates handles GET /api/parts/:ipn/alternates. alternate_for
+// lists the parts this one may replace.
+func (h *Handler) ListPartAlternates(w http.ResponseWriter, r *http.Request, ipn string) {
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	query := `SELECT id, ipn, alternate_ipn, COALESCE(assembly_ipn,''), priority, COALESCE(notes,''),
+		COALESCE(created_by,''), created_at FROM part_alternates WHERE %s=? ORDER BY assembly_ipn, priority, id`
+	list := func(col string) ([]PartAlternate, error) {
+		rows, err := h.DB.Query(fmt.Sprintf(query, col), ipn)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		out := []PartAlternate{}
+		for rows.Next() {
+			var a PartAlternate
+			if err := rows.Scan(&a.ID, &a.IPN, &a.AlternateIPN, &a.AssemblyIPN, &a.Priority, &a.Notes, &a.CreatedBy, &a.CreatedAt); err != nil {
+				return nil, err
+			}
+			out = append(out, a)
+		}
+		return out, rows.Err()
+	}
+	alts, err := list("ipn")
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	altFor, err := list("alternate_ipn")
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, map[string]interface{}{"ipn": ipn, "alternates": alts, "alternate_for": altFor})
+}
+
+// CreatePartAlternate handles POST /api/parts/:ipn/alternates.
+func (h *Handler) CreatePartAlternate(w http.ResponseWriter, r *http.Request, ipn string) {
+	var a PartAlternate
+	if err := response.DecodeBody(r, &a); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	a.AlternateIPN = strings.TrimSpace(a.AlternateIPN)
+	a.AssemblyIPN = strings.TrimSpace(a.AssemblyIPN)
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	if a.AlternateIPN == "" || strings.EqualFold(a.AlternateIPN, ipn) {
+		response.Err(w, "alternate_ipn must name another part", 400)
+		return
+	}
+	if _, ok := h.catalog().Get(a.AlternateIPN); !ok {
+		response.Err(w, "alternate part not found: "+a.AlternateIPN, 400)
+		return
+	}
+	if a.AssemblyIPN != "" {
+		if _, ok := h.bomLines(a.AssemblyIPN); !ok {
+			response.Err(w, a.AssemblyIPN+" has no BOM", 400)
+			return
+		}
+	}
+	var n int
+	h.DB.QueryRow("SELECT COUNT(*) FROM part_alternates WHERE ipn=? AND alternate_ipn=? AND assembly_ipn=?",
+		ipn, a.AlternateIPN, a.AssemblyIPN).Scan(&n)
+	if n > 0 {
+		response.Err(w, a.AlternateIPN+" is already an alternate for "+ipn, 409)
+		return
+	}
+	a.IPN = ipn
+	a.CreatedBy = h.getUsername(r)
+	res, err := h.DB.Exec(`INSERT INTO part_alternates (ipn, alternate_ipn, assembly_ipn, priority, notes, created_by)
+		VALUES (?,?,?,?,?,?)`, ipn, a.AlternateIPN, a.AssemblyIPN, a.Priority, a.Notes, a.CreatedBy)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	a.ID = int(id)
+	h.DB.QueryRow("SELECT created_at FROM part_alternates WHERE id=?", id).Scan(&a.CreatedAt)
+	scope := "everywhere"
+	if a.AssemblyIPN != "" {
+		scope = "in " + a.AssemblyIPN
+	}
+	h.logAudit(a.CreatedBy, "created", "part", ipn, fmt.Sprintf("Approved %s as an alternate %s", a.AlternateIPN, scope))
+	w.WriteHeader(201)
+	response.JSON(w, a)
+}
+
+// DeletePartAlternate handles DELETE /api/parts/:ipn/alternates/:id.
+func (h *Handler) DeletePartAlternate(w http.ResponseWriter, r *http.Request, ipn, idStr string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		response.Err(w, "invalid id", 400)
+		return
+	}
+	var alt string
+	if err := h.DB.QueryRow("SELECT alternate_ipn FROM part_alternates WHERE id=? AND ipn=?", id, ipn).Scan(&alt); err != nil {
+		response.Err(w, "alternate not found", 404)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM part_alternates WHERE id=?", id); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.logAudit(h.getUsername(r), "deleted", "part", ipn, "Removed alternate "+alt)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
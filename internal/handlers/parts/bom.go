@@ -0,0 +1,605 @@
+package parts
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/response"
+)
+
+// BOMNode represents a node in the BOM tree.
+type BOMNode struct {
+	IPN         string    `json:"ipn"`
+	Description string    `json:"description"`
+	Qty         float64   `json:"qty,omitempty"`
+	ExtQty      float64   `json:"ext_qty,omitempty"`
+	Ref         string    `json:"ref,omitempty"`
+	Assembly    bool      `json:"assembly,omitempty"`
+	Attrition   *float64  `json:"attrition_pct,omitempty"`
+	Children    []BOMNode `json:"children"`
+
+	// Revision pins the child's revision; the effectivity fields limit the
+	// line to builds by date or serial number (see bomEffectivity).
+	Revision      string `json:"revision,omitempty"`
+	EffectiveFrom string `json:"effective_from,omitempty"`
+	EffectiveTo   string `json:"effective_to,omitempty"`
+	SerialFrom    string `json:"serial_from,omitempty"`
+	SerialTo      string `json:"serial_to,omitempty"`
+	// Alternates are the approved substitutes for the child, preferred
+	// first: the line's alternates column, then part_alternates.
+	Alternates []string `json:"alternates,omitempty"`
+}
+
+// BOMLine is one row of an indented or summarized BOM. Level is the depth
+// below the top assembly in the indented view; Refs and UsedIn are set in
+// the summarized view only.
+type BOMLine struct {
+	Level       int      `json:"level"`
+	IPN         string   `json:"ipn"`
+	Description string   `json:"description"`
+	Qty         float64  `json:"qty"`
+	ExtQty      float64  `json:"ext_qty"`
+	Ref         string   `json:"ref,omitempty"`
+	Revision    string   `json:"revision,omitempty"`
+	Assembly    bool     `json:"assembly,omitempty"`
+	Alternates  []string `json:"alternates,omitempty"`
+	Refs        []string `json:"refs,omitempty"`
+	UsedIn      []string `json:"used_in,omitempty"`
+}
+
+// BOMView is the response for the indented and summarized BOM views.
+type BOMView struct {
+	IPN         string    `json:"ipn"`
+	Description string    `json:"description"`
+	View        string    `json:"view"`
+	BuildQty    float64   `json:"build_qty"`
+	Lines       []BOMLine `json:"lines"`
+}
+
+// BOMCycleError reports a BOM that contains itself. Path runs from the top
+// assembly to the repeated IPN.
+type BOMCycleError struct {
+	Path []string
+}
+
+func (e *BOMCycleError) Error() string {
+	return "circular BOM reference: " + strings.Join(e.Path, " > ")
+}
+
+// AssemblyRules decide which parts are assemblies and so have a BOM. A part
+// is an assembly if any rule matches.
+type AssemblyRules struct {
+	// Prefixes are IPN prefixes, matched case-insensitively.
+	Prefixes []string `json:"prefixes"`
+	// Categories are part category IDs.
+	Categories []string `json:"categories"`
+	// BOMFile makes any part with a <IPN>.csv BOM file an assembly.
+	BOMFile bool `json:"bom_file"`
+}
+
+// BOMSettings are the assembly rules plus the costing defaults.
+type BOMSettings struct {
+	AssemblyRules
+	// DefaultAttritionPct is added to leaf lines whose BOM row has no
+	// attrition column value.
+	DefaultAttritionPct float64 `json:"default_attrition_pct"`
+	// CostMethod is the costing method used when a request names none.
+	CostMethod string `json:"cost_method"`
+	// CostPeriod is the costing period whose frozen rolls are the standard
+	// cost. Empty means the current calendar quarter, e.g. 2026-Q4.
+	CostPeriod string `json:"cost_period"`
+}
+
+// DefaultAssemblyPrefixes apply until the bom_assembly_prefixes setting is
+// saved.
+var DefaultAssemblyPrefixes = []string{"PCA-", "ASY-"}
+
+func splitList(s string) []string {
+	out := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// assemblyRules loads the rules from app_settings and keeps the catalog's
+// BOM file detection in step with the prefixes.
+func (h *Handler) assemblyRules() AssemblyRules {
+	rules := h.loadAssemblyRules()
+	h.catalog().SetAssemblyPrefixes(rules.Prefixes)
+	return rules
+}
+
+// AssemblyMatcher loads the assembly rules once and returns a predicate
+// reporting whether an IPN is an assembly under them.
+func (h *Handler) AssemblyMatcher() func(ipn string) bool {
+	rules := h.assemblyRules()
+	return func(ipn string) bool { return h.isAssembly(rules, ipn) }
+}
+
+func (h *Handler) loadAssemblyRules() AssemblyRules {
+	rules := AssemblyRules{Prefixes: DefaultAssemblyPrefixes, Categories: []string{}}
+	if h.DB == nil {
+		return rules
+	}
+	var v string
+	if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_assembly_prefixes'").Scan(&v); err == nil {
+		rules.Prefixes = splitList(v)
+	}
+	v = ""
+	if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_assembly_categories'").Scan(&v); err == nil {
+		rules.Categories = splitList(v)
+	}
+	v = ""
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_assembly_by_file'").Scan(&v)
+	rules.BOMFile = v == "true"
+	return rules
+}
+
+// isAssembly reports whether ipn is an assembly under rules.
+func (h *Handler) isAssembly(rules AssemblyRules, ipn string) bool {
+	upper := strings.ToUpper(ipn)
+	for _, p := range rules.Prefixes {
+		if strings.HasPrefix(upper, strings.ToUpper(p)) {
+			return true
+		}
+	}
+	if len(rules.Categories) > 0 {
+		if p, ok := h.catalog().Get(ipn); ok {
+			for _, c := range rules.Categories {
+				if strings.EqualFold(c, p.Fields["_category"]) {
+					return true
+				}
+			}
+		}
+	}
+	if rules.BOMFile {
+		if _, ok := h.catalog().Records(ipn); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// notAssemblyMessage explains why ipn has no BOM in terms of the detection
+// rules that are actually configured.
+func notAssemblyMessage(rules AssemblyRules, ipn string) string {
+	var ways []string
+	if len(rules.Prefixes) > 0 {
+		ways = append(ways, "IPN prefixes "+strings.Join(rules.Prefixes, ", "))
+	}
+	if len(rules.Categories) > 0 {
+		ways = append(ways, "categories "+strings.Join(rules.Categories, ", "))
+	}
+	if rules.BOMFile {
+		ways = append(ways, "parts with a BOM file")
+	}
+	if len(ways) == 0 {
+		return ipn + " is not an assembly; no assembly rules are configured"
+	}
+	return ipn + " is not an assembly; BOMs are available for " + strings.Join(ways, " or ")
+}
+
+// bomSettings loads the assembly rules and costing defaults.
+func (h *Handler) bomSettings() BOMSettings {
+	s := BOMSettings{AssemblyRules: h.assemblyRules(), CostMethod: CostLastPO}
+	if h.DB == nil {
+		return s
+	}
+	var v string
+	if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_default_attrition_pct'").Scan(&v); err == nil {
+		s.DefaultAttritionPct, _ = strconv.ParseFloat(v, 64)
+	}
+	v = ""
+	if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_cost_method'").Scan(&v); err == nil && validCostMethod(v) {
+		s.CostMethod = v
+	}
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='bom_cost_period'").Scan(&s.CostPeriod)
+	return s
+}
+
+// GetBOMSettings handles GET /api/settings/bom.
+func (h *Handler) GetBOMSettings(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, h.bomSettings())
+}
+
+// UpdateBOMSettings handles PUT /api/settings/bom.
+func (h *Handler) UpdateBOMSettings(w http.ResponseWriter, r *http.Request) {
+	var body BOMSettings
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	if body.DefaultAttritionPct < 0 || body.DefaultAttritionPct >= 100 {
+		response.Err(w, "default_attrition_pct must be at least 0 and below 100", 400)
+		return
+	}
+	if body.CostMethod == "" {
+		body.CostMethod = CostLastPO
+	}
+	if !validCostMethod(body.CostMethod) {
+		response.Err(w, "cost_method must be one of "+strings.Join(CostMethods, ", "), 400)
+		return
+	}
+	rules := body.AssemblyRules
+	if rules.Prefixes == nil {
+		rules.Prefixes = []string{}
+	}
+	if rules.Categories == nil {
+		rules.Categories = []string{}
+	}
+	settings := map[string]string{
+		"bom_assembly_prefixes":     strings.Join(rules.Prefixes, ","),
+		"bom_assembly_categories":   strings.Join(rules.Categories, ","),
+		"bom_assembly_by_file":      strconv.FormatBool(rules.BOMFile),
+		"bom_default_attrition_pct": strconv.FormatFloat(body.DefaultAttritionPct, 'f', -1, 64),
+		"bom_cost_method":           body.CostMethod,
+		"bom_cost_period":           strings.TrimSpace(body.CostPeriod),
+	}
+	for k, v := range settings {
+		if _, err := h.DB.Exec(`INSERT INTO app_settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, k, v); err != nil {
+			response.Err(w, "failed to save setting", 500)
+			return
+		}
+	}
+	h.logAudit(h.getUsername(r), "updated", "settings", "bom", "Updated BOM assembly detection and costing settings")
+	response.JSON(w, h.bomSettings())
+}
+
+// bomLine is one row of an assembly's BOM file. Attrition is the scrap
+// allowance in percent, nil when the row does not set one. Revision pins
+// the revision of the part; the effectivity dates (YYYY-MM-DD) and serial
+// range are empty when the row applies to every build. Alternates are
+// substitutes approved on this line only.
+type bomLine struct {
+	IPN           string
+	Qty           float64
+	Ref           string
+	Description   string
+	Attrition     *float64
+	Revision      string
+	EffectiveFrom string
+	EffectiveTo   string
+	SerialFrom    string
+	SerialTo      string
+	Alternates    []string
+}
+
+// bomReader returns the BOM lines of an assembly; ok is false when it has
+// no BOM file. h.bomLines reads the working tree, revisionBOMReader a git
+// revision.
+type bomReader func(ipn string) (lines []bomLine, ok bool)
+
+// bomLines reads the <IPN>.csv BOM of an assembly from the catalog. ok is
+// false when there is no BOM file.
+func (h *Handler) bomLines(ipn string) ([]bomLine, bool) {
+	records, ok := h.catalog().Records(ipn)
+	if !ok {
+		return nil, false
+	}
+	return parseBOMRecords(records), true
+}
+
+// parseBOMRecords reads BOM lines from CSV records, header row first.
+func parseBOMRecords(records [][]string) []bomLine {
+	if len(records) < 2 {
+		return nil
+	}
+	ipnIdx, qtyIdx, refIdx, descIdx, attrIdx := -1, -1, -1, -1, -1
+	revIdx, fromIdx, toIdx, serFromIdx, serToIdx, altIdx := -1, -1, -1, -1, -1, -1
+	for i, hdr := range records[0] {
+		hl := strings.ToLower(hdr)
+		switch {
+		case isIPNHeader(hdr):
+			ipnIdx = i
+		case hl == "qty" || hl == "quantity":
+			qtyIdx = i
+		case hl == "ref" || hl == "reference" || hl == "designator" || hl == "ref_des":
+			refIdx = i
+		case hl == "description" || hl == "desc":
+			descIdx = i
+		case hl == "attrition" || hl == "attrition_pct" || hl == "scrap" || hl == "scrap_pct":
+			attrIdx = i
+		case hl == "rev" || hl == "revision":
+			revIdx = i
+		case hl == "effective_from" || hl == "eff_from":
+			fromIdx = i
+		case hl == "effective_to" || hl == "eff_to":
+			toIdx = i
+		case hl == "serial_from":
+			serFromIdx = i
+		case hl == "serial_to":
+			serToIdx = i
+		case hl == "alternates" || hl == "alternate" || hl == "alt" || hl == "alts":
+			altIdx = i
+		}
+	}
+	cell := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	if ipnIdx == -1 {
+		ipnIdx = 0
+	}
+	var lines []bomLine
+	for _, row := range records[1:] {
+		if ipnIdx >= len(row) {
+			continue
+		}
+		l := bomLine{IPN: strings.TrimSpace(row[ipnIdx]), Qty: 1}
+		if l.IPN == "" {
+			continue
+		}
+		if qtyIdx >= 0 && qtyIdx < len(row) {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(row[qtyIdx]), 64); err == nil {
+				l.Qty = q
+			}
+		}
+		if refIdx >= 0 && refIdx < len(row) {
+			l.Ref = strings.TrimSpace(row[refIdx])
+		}
+		if descIdx >= 0 && descIdx < len(row) {
+			l.Description = strings.TrimSpace(row[descIdx])
+		}
+		if attrIdx >= 0 && attrIdx < len(row) {
+			v := strings.TrimSuffix(strings.TrimSpace(row[attrIdx]), "%")
+			if a, err := strconv.ParseFloat(v, 64); err == nil && a >= 0 && a < 100 {
+				l.Attrition = &a
+			}
+		}
+		l.Revision = strings.ToUpper(cell(row, revIdx))
+		l.EffectiveFrom = bomDate(cell(row, fromIdx))
+		l.EffectiveTo = bomDate(cell(row, toIdx))
+		l.SerialFrom = cell(row, serFromIdx)
+		l.SerialTo = cell(row, serToIdx)
+		l.Alternates = splitAlternates(cell(row, altIdx))
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// bomDate reduces an effectivity cell to YYYY-MM-DD, dropping any time of
+// day. Cells that are not dates are kept as written.
+func bomDate(v string) string {
+	if len(v) > 10 {
+		if _, err := time.Parse("2006-01-02", v[:10]); err == nil {
+			return v[:10]
+		}
+	}
+	return v
+}
+
+// partDescription returns the description of a part from the catalog.
+func (h *Handler) partDescription(ipn string) string {
+	p, ok := h.catalog().Get(ipn)
+	if !ok {
+		return ""
+	}
+	for k, v := range p.Fields {
+		if strings.EqualFold(k, "description") || strings.EqualFold(k, "desc") {
+			return v
+		}
+	}
+	return ""
+}
+
+// buildBOMTree explodes the BOM of ipn to every level for buildQty units.
+// Sub-assemblies with a BOM file are expanded; anything else is a leaf. A
+// BOM that contains itself returns a *BOMCycleError naming the path.
+// Every line is included whatever its effectivity.
+func (h *Handler) buildBOMTree(ipn string, buildQty float64) (*BOMNode, error) {
+	return h.buildBOMTreeFrom(h.bomLines, ipn, buildQty)
+}
+
+// buildBOMTreeAt is buildBOMTree with only the lines in effect under eff.
+func (h *Handler) buildBOMTreeAt(ipn string, buildQty float64, eff *bomEffectivity) (*BOMNode, error) {
+	return h.explodeBOM(h.bomLines, ipn, buildQty, eff)
+}
+
+// buildBOMTreeFrom is buildBOMTree with the BOM files read by read.
+func (h *Handler) buildBOMTreeFrom(read bomReader, ipn string, buildQty float64) (*BOMNode, error) {
+	return h.explodeBOM(read, ipn, buildQty, nil)
+}
+
+func (h *Handler) explodeBOM(read bomReader, ipn string, buildQty float64, eff *bomEffectivity) (*BOMNode, error) {
+	b := &bomBuilder{h: h, read: read, rules: h.assemblyRules(), boms: map[string]cachedBOM{}, eff: eff}
+	node := &BOMNode{IPN: ipn, Description: h.partDescription(ipn), ExtQty: buildQty, Assembly: true}
+	if err := b.expand(node, []string{ipn}); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+type bomBuilder struct {
+	h     *Handler
+	read  bomReader
+	rules AssemblyRules
+	boms  map[string]cachedBOM
+	eff   *bomEffectivity
+}
+
+type cachedBOM struct {
+	lines []bomLine
+	ok    bool
+}
+
+// bom returns the BOM lines of ipn, reading each file once per explosion.
+func (b *bomBuilder) bom(ipn string) ([]bomLine, bool) {
+	c, seen := b.boms[ipn]
+	if !seen {
+		c.lines, c.ok = b.read(ipn)
+		b.boms[ipn] = c
+	}
+	return c.lines, c.ok
+}
+
+func (b *bomBuilder) expand(node *BOMNode, path []string) error {
+	node.Children = []BOMNode{}
+	lines, _ := b.bom(node.IPN)
+	for _, l := range lines {
+		if !b.eff.includes(l) {
+			continue
+		}
+		child := BOMNode{IPN: l.IPN, Description: l.Description, Qty: l.Qty, ExtQty: l.Qty * node.ExtQty, Ref: l.Ref, Attrition: l.Attrition, Children: []BOMNode{},
+			Revision: l.Revision, EffectiveFrom: l.EffectiveFrom, EffectiveTo: l.EffectiveTo, SerialFrom: l.SerialFrom, SerialTo: l.SerialTo,
+			Alternates: mergeAlternates(append([]string{}, l.Alternates...), b.h.approvedAlternates(l.IPN, path))}
+		if len(child.Alternates) == 0 {
+			child.Alternates = nil
+		}
+		if child.Description == "" {
+			child.Description = b.h.partDescription(l.IPN)
+		}
+		if b.h.isAssembly(b.rules, l.IPN) {
+			child.Assembly = true
+			for _, p := range path {
+				if p == l.IPN {
+					cycle := append(append([]string{}, path...), l.IPN)
+					return &BOMCycleError{Path: cycle}
+				}
+			}
+			if _, ok := b.bom(l.IPN); ok {
+				if err := b.expand(&child, append(path, l.IPN)); err != nil {
+					return err
+				}
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+	return nil
+}
+
+// indentedBOM lists the tree depth first, top assembly at level 0.
+func indentedBOM(node *BOMNode, level int, out []BOMLine) []BOMLine {
+	qty := node.Qty
+	if level == 0 {
+		qty = 1
+	}
+	out = append(out, BOMLine{Level: level, IPN: node.IPN, Description: node.Description, Qty: qty,
+		ExtQty: node.ExtQty, Ref: node.Ref, Revision: node.Revision, Assembly: node.Assembly, Alternates: node.Alternates})
+	for i := range node.Children {
+		out = indentedBOM(&node.Children[i], level+1, out)
+	}
+	return out
+}
+
+// summarizedBOM totals the quantities of every leaf part across all
+// sub-assemblies, sorted by IPN. Qty is per top assembly.
+func summarizedBOM(root *BOMNode) []BOMLine {
+	byIPN := map[string]*BOMLine{}
+	var walk func(n *BOMNode, parent string, mult float64)
+	walk = func(n *BOMNode, parent string, mult float64) {
+		for i := range n.Children {
+			c := &n.Children[i]
+			if len(c.Children) > 0 {
+				walk(c, c.IPN, mult*c.Qty)
+				continue
+			}
+			l := byIPN[c.IPN]
+			if l == nil {
+				l = &BOMLine{IPN: c.IPN, Description: c.Description, Assembly: c.Assembly}
+				byIPN[c.IPN] = l
+			}
+			l.Qty += mult * c.Qty
+			l.ExtQty += c.ExtQty
+			if c.Ref != "" {
+				l.Refs = append(l.Refs, c.Ref)
+			}
+			if !containsString(l.UsedIn, parent) {
+				l.UsedIn = append(l.UsedIn, parent)
+			}
+			l.Alternates = mergeAlternates(l.Alternates, c.Alternates)
+		}
+	}
+	walk(root, root.IPN, 1)
+	out := make([]BOMLine, 0, len(byIPN))
+	for _, l := range byIPN {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].IPN < out[j].IPN })
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBOMCycle reports a circular BOM as 422 with the offending path.
+func writeBOMCycle(w http.ResponseWriter, err *BOMCycleError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "cycle": err.Path})
+}
+
+// PartBOM handles GET /api/parts/:ipn/bom. view=tree (default) returns the
+// nested tree, view=indented a flat depth-first list with levels, and
+// view=summarized (or flat) the total quantity of each leaf part. qty sets
+// the build quantity used for ext_qty. date and serial limit the BOM to the
+// lines in effect for a unit built on that date (today if only serial is
+// given) with that serial number; without either every line is shown.
+func (h *Handler) PartBOM(w http.ResponseWriter, r *http.Request, ipn string) {
+	rules := h.assemblyRules()
+	if !h.isAssembly(rules, ipn) {
+		response.Err(w, notAssemblyMessage(rules, ipn), 400)
+		return
+	}
+	buildQty := 1.0
+	if q := r.URL.Query().Get("qty"); q != "" {
+		v, err := strconv.ParseFloat(q, 64)
+		if err != nil || v <= 0 {
+			response.Err(w, "qty must be a positive number", 400)
+			return
+		}
+		buildQty = v
+	}
+	view := r.URL.Query().Get("view")
+	if view == "flat" {
+		view = "summarized"
+	}
+	if view != "" && view != "tree" && view != "indented" && view != "summarized" {
+		response.Err(w, "view must be tree, indented or summarized", 400)
+		return
+	}
+
+	var eff *bomEffectivity
+	if date, serial := r.URL.Query().Get("date"), r.URL.Query().Get("serial"); date != "" || serial != "" {
+		if date == "" {
+			date = today()
+		} else if _, err := time.Parse("2006-01-02", date); err != nil {
+			response.Err(w, "date must be YYYY-MM-DD", 400)
+			return
+		}
+		eff = &bomEffectivity{Date: date, Serial: serial}
+	}
+
+	node, err := h.buildBOMTreeAt(ipn, buildQty, eff)
+	if cerr, ok := err.(*BOMCycleError); ok {
+		writeBOMCycle(w, cerr)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	switch view {
+	case "indented":
+		response.JSON(w, BOMView{IPN: ipn, Description: node.Description, View: view, BuildQty: buildQty, Lines: indentedBOM(node, 0, nil)})
+	case "summarized":
+		response.JSON(w, BOMView{IPN: ipn, Description: node.Description, View: view, BuildQty: buildQty, Lines: summarizedBOM(node)})
+	default:
+		response.JSON(w, node)
+	}
+}
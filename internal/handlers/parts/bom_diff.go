@@ -0,0 +1,439 @@
+package parts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zrp/internal/catalog"
+	"zrp/internal/response"
+)
+
+// BOMChange is one difference between two BOMs. Path lists the
+// sub-assemblies between the top assembly and the line; it is empty for top
+// level lines. Change is "added", "removed" or "changed"; a changed line has
+// a different quantity or reference designators.
+type BOMChange struct {
+	Path        []string `json:"path"`
+	IPN         string   `json:"ipn"`
+	Description string   `json:"description"`
+	Change      string   `json:"change"`
+	OldQty      float64  `json:"old_qty"`
+	NewQty      float64  `json:"new_qty"`
+	RefsAdded   []string `json:"refs_added,omitempty"`
+	RefsRemoved []string `json:"refs_removed,omitempty"`
+}
+
+// BOMDiffSide names one side of a comparison. Rev is empty for the working
+// tree.
+type BOMDiffSide struct {
+	IPN string `json:"ipn"`
+	Rev string `json:"rev,omitempty"`
+}
+
+// BOMDiff is the difference between two BOMs at every level.
+type BOMDiff struct {
+	From    BOMDiffSide `json:"from"`
+	To      BOMDiffSide `json:"to"`
+	Added   int         `json:"added"`
+	Removed int         `json:"removed"`
+	Changed int         `json:"changed"`
+	Changes []BOMChange `json:"changes"`
+}
+
+// gitRevPattern limits revisions to names git accepts that cannot be read
+// as options.
+var gitRevPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./~^@{}-]*$`)
+
+// revisionBOMReader reads BOM files from the parts directory as they were at
+// rev of its git repository. Files are matched by base name, top level
+// first, as in the catalog.
+func (h *Handler) revisionBOMReader(rev string) (bomReader, error) {
+	if !gitRevPattern.MatchString(rev) || strings.Contains(rev, "..") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+	if h.PartsDir == "" {
+		return nil, fmt.Errorf("parts directory is not configured")
+	}
+	out, err := exec.Command("git", "-C", h.PartsDir, "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision %q in the parts repository", rev)
+	}
+	commit := strings.TrimSpace(string(out))
+	out, err = exec.Command("git", "-C", h.PartsDir, "ls-tree", "-r", "--name-only", commit, "--", ".").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing parts at %s: %v", rev, err)
+	}
+	files := map[string]string{}
+	for _, p := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.EqualFold(filepath.Ext(p), ".csv") {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if prev, ok := files[name]; !ok || strings.Count(p, "/") < strings.Count(prev, "/") {
+			files[name] = p
+		}
+	}
+	return func(ipn string) ([]bomLine, bool) {
+		p, ok := files[ipn]
+		if !ok {
+			return nil, false
+		}
+		content, err := exec.Command("git", "-C", h.PartsDir, "show", commit+":./"+p).Output()
+		if err != nil {
+			return nil, false
+		}
+		_, _, _, records, err := catalog.ParseCSV(content, "")
+		if err != nil {
+			return nil, false
+		}
+		return parseBOMRecords(records), true
+	}, nil
+}
+
+// bomTreeAt explodes one unit of ipn from the working tree (rev "") or a
+// git revision.
+func (h *Handler) bomTreeAt(ipn, rev string) (*BOMNode, error) {
+	read := h.bomLines
+	if rev != "" {
+		r, err := h.revisionBOMReader(rev)
+		if err != nil {
+			return nil, err
+		}
+		read = r
+	}
+	return h.buildBOMTreeFrom(read, ipn, 1)
+}
+
+// diffBOMTrees compares two exploded BOMs. Lines are matched by IPN within
+// each assembly, so repeated rows of one IPN are compared as their total.
+// Sub-assemblies present on both sides are compared recursively, each once.
+func diffBOMTrees(from, to *BOMNode) []BOMChange {
+	changes := []BOMChange{}
+	seen := map[string]bool{}
+	var walk func(a, b *BOMNode, path []string)
+	walk = func(a, b *BOMNode, path []string) {
+		old, cur := groupChildren(a), groupChildren(b)
+		ipns := make([]string, 0, len(old)+len(cur))
+		for ipn := range old {
+			ipns = append(ipns, ipn)
+		}
+		for ipn := range cur {
+			if _, ok := old[ipn]; !ok {
+				ipns = append(ipns, ipn)
+			}
+		}
+		sort.Strings(ipns)
+		var subs []string
+		for _, ipn := range ipns {
+			o, n := old[ipn], cur[ipn]
+			c := BOMChange{Path: append([]string{}, path...), IPN: ipn}
+			switch {
+			case n == nil:
+				c.Change, c.Description, c.OldQty, c.RefsRemoved = "removed", o.desc, o.qty, o.refs
+			case o == nil:
+				c.Change, c.Description, c.NewQty, c.RefsAdded = "added", n.desc, n.qty, n.refs
+			default:
+				c.Description, c.OldQty, c.NewQty = n.desc, o.qty, n.qty
+				c.RefsAdded, c.RefsRemoved = subtractRefs(n.refs, o.refs), subtractRefs(o.refs, n.refs)
+				if o.qty != n.qty || len(c.RefsAdded) > 0 || len(c.RefsRemoved) > 0 {
+					c.Change = "changed"
+				}
+				if o.node != nil && n.node != nil && !seen[ipn] {
+					seen[ipn] = true
+					subs = append(subs, ipn)
+				}
+			}
+			if c.Change != "" {
+				changes = append(changes, c)
+			}
+		}
+		for _, ipn := range subs {
+			walk(old[ipn].node, cur[ipn].node, append(append([]string{}, path...), ipn))
+		}
+	}
+	walk(from, to, []string{})
+	return changes
+}
+
+type groupedLine struct {
+	desc string
+	qty  float64
+	refs []string
+	node *BOMNode // set for expanded sub-assemblies
+}
+
+func groupChildren(n *BOMNode) map[string]*groupedLine {
+	out := map[string]*groupedLine{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		g := out[c.IPN]
+		if g == nil {
+			g = &groupedLine{desc: c.Description}
+			out[c.IPN] = g
+		}
+		g.qty += c.Qty
+		g.refs = append(g.refs, expandRefs(c.Ref)...)
+		if len(c.Children) > 0 {
+			g.node = c
+		}
+	}
+	return out
+}
+
+var refRangePattern = regexp.MustCompile(`^([A-Za-z]+)(\d+)-([A-Za-z]*)(\d+)$`)
+
+// expandRefs splits a reference designator field on commas, semicolons and
+// spaces and expands ranges such as R1-R4.
+func expandRefs(s string) []string {
+	var out []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\t' }) {
+		m := refRangePattern.FindStringSubmatch(f)
+		if m != nil && (m[3] == "" || m[3] == m[1]) {
+			lo, _ := strconv.Atoi(m[2])
+			hi, _ := strconv.Atoi(m[4])
+			if lo <= hi && hi-lo < 1000 {
+				for i := lo; i <= hi; i++ {
+					out = append(out, m[1]+strconv.Itoa(i))
+				}
+				continue
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// subtractRefs returns the designators in a that are not in b.
+func subtractRefs(a, b []string) []string {
+	in := map[string]bool{}
+	for _, r := range b {
+		in[strings.ToUpper(r)] = true
+	}
+	var out []string
+	for _, r := range a {
+		if !in[strings.ToUpper(r)] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func newBOMDiff(from, to BOMDiffSide, changes []BOMChange) *BOMDiff {
+	d := &BOMDiff{From: from, To: to, Changes: changes}
+	for _, c := range changes {
+		switch c.Change {
+		case "added":
+			d.Added++
+		case "removed":
+			d.Removed++
+		default:
+			d.Changed++
+		}
+	}
+	return d
+}
+
+// writeBOMError writes a cycle as 422 and anything else as 400.
+func writeBOMError(w http.ResponseWriter, err error) {
+	if cerr, ok := err.(*BOMCycleError); ok {
+		writeBOMCycle(w, cerr)
+		return
+	}
+	response.Err(w, err.Error(), 400)
+}
+
+// BOMDiff handles GET /api/parts/:ipn/bom/diff. ?with=IPN compares ipn
+// against another assembly; ?from= and ?to= name git revisions of the parts
+// repository for the ipn and with sides (empty is the working tree).
+func (h *Handler) BOMDiff(w http.ResponseWriter, r *http.Request, ipn string) {
+	q := r.URL.Query()
+	from := BOMDiffSide{IPN: ipn, Rev: q.Get("from")}
+	to := BOMDiffSide{IPN: ipn, Rev: q.Get("to")}
+	if with := q.Get("with"); with != "" {
+		to.IPN = with
+	}
+	if from == to {
+		response.Err(w, "give with= to compare assemblies or from=/to= to compare revisions", 400)
+		return
+	}
+	rules := h.assemblyRules()
+	for _, side := range []BOMDiffSide{from, to} {
+		if !h.isAssembly(rules, side.IPN) {
+			response.Err(w, side.IPN+" is not an assembly", 400)
+			return
+		}
+	}
+	a, err := h.bomTreeAt(from.IPN, from.Rev)
+	if err != nil {
+		writeBOMError(w, err)
+		return
+	}
+	b, err := h.bomTreeAt(to.IPN, to.Rev)
+	if err != nil {
+		writeBOMError(w, err)
+		return
+	}
+	response.JSON(w, newBOMDiff(from, to, diffBOMTrees(a, b)))
+}
+
+// ECOBOMImpactItem is the BOM impact of one affected IPN. Assemblies carry
+// a diff and cost delta; DiffError says why they could not be compared.
+type ECOBOMImpactItem struct {
+	IPN        string   `json:"ipn"`
+	Assembly   bool     `json:"assembly"`
+	Diff       *BOMDiff `json:"diff,omitempty"`
+	DiffError  string   `json:"diff_error,omitempty"`
+	CostBefore *float64 `json:"cost_before,omitempty"`
+	CostAfter  *float64 `json:"cost_after,omitempty"`
+	CostDelta  *float64 `json:"cost_delta,omitempty"`
+	Missing    []string `json:"missing_prices,omitempty"`
+}
+
+// ECOWorkOrder is an open work order building something an ECO touches.
+type ECOWorkOrder struct {
+	ID          string   `json:"id"`
+	AssemblyIPN string   `json:"assembly_ipn"`
+	Qty         int      `json:"qty"`
+	Status      string   `json:"status"`
+	AffectedBy  []string `json:"affected_by"`
+}
+
+// ECOBOMImpact is the impact summary of an ECO's affected IPNs.
+type ECOBOMImpact struct {
+	ECOID          string             `json:"eco_id"`
+	From           string             `json:"from"`
+	To             string             `json:"to,omitempty"`
+	Method         string             `json:"method"`
+	Items          []ECOBOMImpactItem `json:"items"`
+	TotalCostDelta float64            `json:"total_cost_delta"`
+	WorkOrders     []ECOWorkOrder     `json:"work_orders"`
+}
+
+// parseAffectedIPNs reads an ECO's affected_ipns, a JSON array or a comma
+// separated list.
+func parseAffectedIPNs(s string) []string {
+	var ipns []string
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		json.Unmarshal([]byte(s), &ipns)
+		return ipns
+	}
+	return splitList(s)
+}
+
+// ECOBOMImpact handles GET /api/ecos/:id/bom-impact. Each affected assembly
+// is compared between the ?from= revision (default HEAD) and ?to= (default
+// the working tree) and costed on both sides with ?method=. Open work orders
+// whose BOM contains an affected IPN are listed.
+func (h *Handler) ECOBOMImpact(w http.ResponseWriter, r *http.Request, ecoID string) {
+	var affected string
+	if err := h.DB.QueryRow("SELECT COALESCE(affected_ipns,'') FROM ecos WHERE id=?", ecoID).Scan(&affected); err != nil {
+		response.Err(w, "ECO not found", 404)
+		return
+	}
+	method, _, err := h.costParams(r)
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	q := r.URL.Query()
+	impact := ECOBOMImpact{ECOID: ecoID, From: q.Get("from"), To: q.Get("to"), Method: method,
+		Items: []ECOBOMImpactItem{}, WorkOrders: []ECOWorkOrder{}}
+	if impact.From == "" {
+		impact.From = "HEAD"
+	}
+
+	rules := h.assemblyRules()
+	ipns := parseAffectedIPNs(affected)
+	for _, ipn := range ipns {
+		item := ECOBOMImpactItem{IPN: ipn, Assembly: h.isAssembly(rules, ipn)}
+		if item.Assembly {
+			h.assemblyImpact(&item, impact.From, impact.To, method)
+			if item.CostDelta != nil {
+				impact.TotalCostDelta += *item.CostDelta
+			}
+		}
+		impact.Items = append(impact.Items, item)
+	}
+	impact.TotalCostDelta = round6(impact.TotalCostDelta)
+	impact.WorkOrders = h.affectedWorkOrders(ipns)
+	response.JSON(w, impact)
+}
+
+func (h *Handler) assemblyImpact(item *ECOBOMImpactItem, fromRev, toRev, method string) {
+	a, err := h.bomTreeAt(item.IPN, fromRev)
+	if err != nil {
+		item.DiffError = err.Error()
+		return
+	}
+	b, err := h.bomTreeAt(item.IPN, toRev)
+	if err != nil {
+		item.DiffError = err.Error()
+		return
+	}
+	item.Diff = newBOMDiff(BOMDiffSide{IPN: item.IPN, Rev: fromRev}, BOMDiffSide{IPN: item.IPN, Rev: toRev}, diffBOMTrees(a, b))
+	before, after := h.costTree(a, method), h.costTree(b, method)
+	delta := round6(after.UnitCost - before.UnitCost)
+	item.CostBefore, item.CostAfter, item.CostDelta = &before.UnitCost, &after.UnitCost, &delta
+	for _, m := range append(before.Missing, after.Missing...) {
+		if !containsString(item.Missing, m) {
+			item.Missing = append(item.Missing, m)
+		}
+	}
+}
+
+// affectedWorkOrders lists open work orders whose assembly is, or contains
+// at any level, one of ipns.
+func (h *Handler) affectedWorkOrders(ipns []string) []ECOWorkOrder {
+	out := []ECOWorkOrder{}
+	if len(ipns) == 0 {
+		return out
+	}
+	rows, err := h.DB.Query(`SELECT id, assembly_ipn, qty, status FROM work_orders
+		WHERE status IN ('draft','open','in_progress','on_hold') ORDER BY id`)
+	if err != nil {
+		return out
+	}
+	var wos []ECOWorkOrder
+	for rows.Next() {
+		var wo ECOWorkOrder
+		if rows.Scan(&wo.ID, &wo.AssemblyIPN, &wo.Qty, &wo.Status) == nil {
+			wos = append(wos, wo)
+		}
+	}
+	rows.Close()
+
+	contents := map[string]map[string]bool{}
+	for _, wo := range wos {
+		parts, ok := contents[wo.AssemblyIPN]
+		if !ok {
+			parts = map[string]bool{wo.AssemblyIPN: true}
+			if node, err := h.buildBOMTree(wo.AssemblyIPN, 1); err == nil {
+				collectIPNs(node, parts)
+			}
+			contents[wo.AssemblyIPN] = parts
+		}
+		for _, ipn := range ipns {
+			if parts[ipn] {
+				wo.AffectedBy = append(wo.AffectedBy, ipn)
+			}
+		}
+		if len(wo.AffectedBy) > 0 {
+			out = append(out, wo)
+		}
+	}
+	return out
+}
+
+func collectIPNs(n *BOMNode, into map[string]bool) {
+	for i := range n.Children {
+		into[n.Children[i].IPN] = true
+		collectIPNs(&n.Children[i], into)
+	}
+}
@@ -0,0 +1,478 @@
+package parts
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zrp/internal/models"
+	"zrp/internal/response"
+)
+
+// partBOMField is the field name of a pending change that replaces the
+// part's BOM file; its new value is the whole <IPN>.csv.
+const partBOMField = "_bom"
+
+// maxBOMImportSize limits uploaded EDA exports.
+const maxBOMImportSize = 10 << 20
+
+// Match states of an imported BOM line.
+const (
+	ImportMatched   = "matched"
+	ImportUnknown   = "unknown"
+	ImportAmbiguous = "ambiguous"
+)
+
+// BOMImportNewPart is a part to create for an unknown BOM line, in the
+// shape of POST /api/parts. Fields that are not columns of the category are
+// dropped when the part is created.
+type BOMImportNewPart struct {
+	IPN      string            `json:"ipn"`
+	Category string            `json:"category"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// BOMImportLine is one grouped line of an imported EDA BOM. Status is
+// matched when IPN was found, ambiguous when several parts carry the MPN
+// (Candidates lists them) and unknown when none does; unknown lines carry a
+// NewPart suggestion in the category SuggestedCategory.
+type BOMImportLine struct {
+	IPN               string            `json:"ipn"`
+	Qty               float64           `json:"qty"`
+	Refs              []string          `json:"refs"`
+	Value             string            `json:"value,omitempty"`
+	Footprint         string            `json:"footprint,omitempty"`
+	Description       string            `json:"description,omitempty"`
+	MPN               string            `json:"mpn,omitempty"`
+	Manufacturer      string            `json:"manufacturer,omitempty"`
+	Status            string            `json:"status"`
+	Candidates        []string          `json:"candidates,omitempty"`
+	SuggestedCategory string            `json:"suggested_category,omitempty"`
+	NewPart           *BOMImportNewPart `json:"new_part,omitempty"`
+}
+
+// BOMImportPreview is the parsed export and the <IPN>.csv it would become.
+// Ready is true when every line has an IPN. Diff compares the matched lines
+// with the current BOM, when there is one.
+type BOMImportPreview struct {
+	IPN       string          `json:"ipn"`
+	Format    string          `json:"format"`
+	Path      string          `json:"path"`
+	Exists    bool            `json:"exists"`
+	Lines     []BOMImportLine `json:"lines"`
+	Matched   int             `json:"matched"`
+	Unknown   int             `json:"unknown"`
+	Ambiguous int             `json:"ambiguous"`
+	DNP       []string        `json:"dnp"`
+	Ready     bool            `json:"ready"`
+	CSV       string          `json:"csv"`
+	Diff      *BOMDiff        `json:"diff,omitempty"`
+}
+
+// validBOMName rejects IPNs that cannot name a file in the parts directory.
+func validBOMName(ipn string) bool {
+	return ipn != "" && !strings.ContainsAny(ipn, `/\`) && !strings.Contains(ipn, "..")
+}
+
+// bomPath is where the BOM of ipn lives: its existing file, or <IPN>.csv at
+// the top of the parts directory.
+func (h *Handler) bomPath(ipn string) (path string, exists bool) {
+	if p, ok := h.catalog().Path(ipn); ok {
+		return p, true
+	}
+	return filepath.Join(h.PartsDir, ipn+".csv"), false
+}
+
+// writeBOMFile replaces the BOM of ipn under the file lock.
+func (h *Handler) writeBOMFile(ipn string, content []byte) error {
+	if h.PartsDir == "" {
+		return fmt.Errorf("no parts directory configured")
+	}
+	path, _ := h.bomPath(ipn)
+	unlock, err := lockPartCSV(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = writeFileAtomic(path, content)
+	h.catalog().Invalidate()
+	return err
+}
+
+// PreviewBOMImport handles POST /api/parts/:ipn/bom/import. It takes a
+// multipart "file" holding a KiCad or Altium BOM export, with an optional
+// "format" field, and returns the preview without writing anything.
+func (h *Handler) PreviewBOMImport(w http.ResponseWriter, r *http.Request, ipn string) {
+	if !validBOMName(ipn) {
+		response.Err(w, "invalid ipn", 400)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBOMImportSize+1024)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			response.Err(w, "BOM export too large. Maximum size is 10MB.", 413)
+			return
+		}
+		response.Err(w, "file required", 400)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		response.Err(w, "failed to read file", 400)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = detectEDAFormat(header.Filename, content)
+	}
+	rows, err := parseEDAExport(format, content)
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	preview, err := h.bomImportPreview(ipn, format, rows)
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	response.JSON(w, preview)
+}
+
+func (h *Handler) bomImportPreview(ipn, format string, rows []edaRow) (*BOMImportPreview, error) {
+	groups, dnp := groupEDARows(rows)
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no components to import")
+	}
+	cat := h.catalog()
+	p := &BOMImportPreview{IPN: ipn, Format: format, DNP: dnp}
+	if p.DNP == nil {
+		p.DNP = []string{}
+	}
+
+	// Categories of the matched parts, by designator prefix, steer where
+	// unknown parts are suggested.
+	learned := map[string]map[string]int{}
+	for _, g := range groups {
+		line := BOMImportLine{Qty: g.qty, Refs: g.refs, Value: g.value, Footprint: g.footprint,
+			Description: g.description, MPN: g.mpn, Manufacturer: g.manufacturer, Status: ImportUnknown}
+		if line.Refs == nil {
+			line.Refs = []string{}
+		}
+		var match []models.Part
+		if g.ipn != "" {
+			if part, ok := cat.Get(g.ipn); ok {
+				match = []models.Part{part}
+			}
+		} else if g.mpn != "" {
+			match = cat.ByMPN(g.mpn)
+		}
+		switch {
+		case len(match) == 1:
+			line.IPN, line.Status = match[0].IPN, ImportMatched
+			if len(line.Refs) > 0 {
+				prefix, _ := splitRef(line.Refs[0])
+				if learned[prefix] == nil {
+					learned[prefix] = map[string]int{}
+				}
+				learned[prefix][match[0].Fields["_category"]]++
+			}
+		case len(match) > 1:
+			line.Status = ImportAmbiguous
+			for _, m := range match {
+				line.Candidates = append(line.Candidates, m.IPN)
+			}
+			sort.Strings(line.Candidates)
+		}
+		p.Lines = append(p.Lines, line)
+	}
+
+	categories := h.partCategories()
+	for i := range p.Lines {
+		line := &p.Lines[i]
+		switch line.Status {
+		case ImportMatched:
+			p.Matched++
+			continue
+		case ImportAmbiguous:
+			p.Ambiguous++
+			continue
+		}
+		p.Unknown++
+		if len(line.Refs) > 0 {
+			prefix, _ := splitRef(line.Refs[0])
+			line.SuggestedCategory = suggestCategory(prefix, learned[prefix], categories)
+		}
+		fields := map[string]string{}
+		for k, v := range map[string]string{"mpn": line.MPN, "manufacturer": line.Manufacturer,
+			"description": line.Description, "value": line.Value, "footprint": line.Footprint} {
+			if v != "" {
+				fields[k] = v
+			}
+		}
+		line.NewPart = &BOMImportNewPart{IPN: groups[i].ipn, Category: line.SuggestedCategory, Fields: fields}
+	}
+	p.Ready = p.Unknown == 0 && p.Ambiguous == 0
+
+	path, exists := h.bomPath(ipn)
+	p.Exists = exists
+	p.Path = path
+	if rel, err := filepath.Rel(h.PartsDir, path); err == nil {
+		p.Path = rel
+	}
+	p.CSV = string(h.renderBOMImport(ipn, p.Lines))
+	if exists {
+		from := &BOMNode{IPN: ipn}
+		if lines, ok := h.bomLines(ipn); ok {
+			for _, l := range lines {
+				from.Children = append(from.Children, BOMNode{IPN: l.IPN, Qty: l.Qty, Ref: l.Ref, Description: l.Description})
+			}
+		}
+		to := &BOMNode{IPN: ipn}
+		for _, l := range p.Lines {
+			if l.IPN != "" {
+				to.Children = append(to.Children, BOMNode{IPN: l.IPN, Qty: l.Qty, Ref: strings.Join(l.Refs, ",")})
+			}
+		}
+		p.Diff = newBOMDiff(BOMDiffSide{IPN: ipn}, BOMDiffSide{IPN: ipn, Rev: "import"}, diffBOMTrees(from, to))
+	}
+	return p, nil
+}
+
+// partCategories lists the categories new parts can be created in: the
+// top-level CSVs of the parts directory that are not assembly BOMs, sorted.
+func (h *Handler) partCategories() []string {
+	entries, err := os.ReadDir(h.PartsDir)
+	if err != nil {
+		return nil
+	}
+	prefixes := AssemblyRules{Prefixes: h.assemblyRules().Prefixes}
+	var out []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".csv")
+		if !e.IsDir() && name != e.Name() && !h.isAssembly(prefixes, name) {
+			out = append(out, strings.ToLower(name))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// suggestCategory picks a category for a part with the designator prefix:
+// the one most matched parts with that prefix belong to, else the first
+// category whose name contains a word the prefix hints at.
+func suggestCategory(prefix string, learned map[string]int, categories []string) string {
+	best, n := "", 0
+	for c, count := range learned {
+		if c != "" && (count > n || count == n && c < best) {
+			best, n = c, count
+		}
+	}
+	if best != "" {
+		return best
+	}
+	for _, hint := range refCategoryHints[prefix] {
+		for _, c := range categories {
+			if strings.Contains(c, hint) {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// bomImportColumns are the columns of a new BOM file.
+var bomImportColumns = []string{"IPN", "qty", "ref", "description", "mpn", "manufacturer"}
+
+// renderBOMImport renders lines as the BOM file of ipn. An existing file
+// keeps its columns, and columns the import does not fill (such as
+// attrition) keep their values for IPNs that stay on the BOM.
+func (h *Handler) renderBOMImport(ipn string, lines []BOMImportLine) []byte {
+	headers := bomImportColumns
+	existing := map[string][]string{}
+	if records, ok := h.catalog().Records(ipn); ok && len(records) > 0 {
+		ipnCol := -1
+		for i, hdr := range records[0] {
+			if isIPNHeader(hdr) {
+				ipnCol = i
+				break
+			}
+		}
+		if ipnCol >= 0 {
+			headers = records[0]
+			for _, rec := range records[1:] {
+				if ipnCol < len(rec) && existing[rec[ipnCol]] == nil {
+					existing[rec[ipnCol]] = rec
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	cw := csv.NewWriter(&b)
+	cw.Write(headers)
+	for _, l := range lines {
+		desc := h.partDescription(l.IPN)
+		if desc == "" {
+			desc = l.Description
+		}
+		rec := make([]string, len(headers))
+		for i, hdr := range headers {
+			switch key := normalizeHeader(hdr); {
+			case isIPNHeader(hdr):
+				rec[i] = l.IPN
+			case key == "qty" || key == "quantity":
+				rec[i] = strconv.FormatFloat(l.Qty, 'f', -1, 64)
+			case edaColumns[key] == "ref":
+				rec[i] = strings.Join(l.Refs, ",")
+			case edaColumns[key] == "description":
+				rec[i] = desc
+			case edaColumns[key] == "mpn":
+				rec[i] = l.MPN
+			case edaColumns[key] == "manufacturer":
+				rec[i] = l.Manufacturer
+			case edaColumns[key] == "value":
+				rec[i] = l.Value
+			case edaColumns[key] == "footprint":
+				rec[i] = l.Footprint
+			default:
+				if old := existing[l.IPN]; i < len(old) {
+					rec[i] = old[i]
+				}
+			}
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+	return b.Bytes()
+}
+
+// ConfirmBOMImport handles POST /api/parts/:ipn/bom/import/confirm. It takes
+// the lines of a preview, with IPNs filled in for unknown and ambiguous
+// lines, plus any parts to create for them, and writes the BOM file. With
+// via_eco, or when the assembly is released and released parts require an
+// ECO, the BOM is stored as a pending part change on a new ECO instead and
+// is written when the ECO is implemented. New parts are created at once.
+func (h *Handler) ConfirmBOMImport(w http.ResponseWriter, r *http.Request, ipn string) {
+	var body struct {
+		Lines       []BOMImportLine    `json:"lines"`
+		CreateParts []BOMImportNewPart `json:"create_parts"`
+		partEditBody
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	if !validBOMName(ipn) {
+		response.Err(w, "invalid ipn", 400)
+		return
+	}
+	if len(body.Lines) == 0 {
+		response.Err(w, "lines required", 400)
+		return
+	}
+	if h.PartsDir == "" {
+		response.Err(w, "no parts directory configured", 500)
+		return
+	}
+
+	user := h.getUsername(r)
+	cat := h.catalog()
+	creating := map[string]bool{}
+	for _, np := range body.CreateParts {
+		if np.IPN == "" || np.Category == "" {
+			response.Err(w, "create_parts entries need ipn and category", 400)
+			return
+		}
+		if h.FindCategoryCSV(np.Category) == "" {
+			response.Err(w, "category not found: "+np.Category, 404)
+			return
+		}
+		if _, ok := cat.Get(np.IPN); ok || creating[np.IPN] {
+			response.Err(w, "IPN already exists: "+np.IPN, 409)
+			return
+		}
+		if by, ok := h.ipnReservedBy(np.IPN); ok && by != user {
+			response.Err(w, fmt.Sprintf("IPN %s is reserved by %s", np.IPN, by), 409)
+			return
+		}
+		if err := h.checkIPNScheme(np.Category, np.IPN); err != nil {
+			response.Err(w, err.Error(), 400)
+			return
+		}
+		creating[np.IPN] = true
+	}
+	for i, l := range body.Lines {
+		switch {
+		case l.IPN == "":
+			response.Err(w, fmt.Sprintf("line %d (%s) has no IPN", i+1, strings.Join(l.Refs, ",")), 400)
+			return
+		case l.Qty <= 0:
+			response.Err(w, fmt.Sprintf("line %d (%s) needs a positive qty", i+1, l.IPN), 400)
+			return
+		case l.IPN == ipn:
+			response.Err(w, ipn+" cannot be on its own BOM", 400)
+			return
+		}
+		if _, ok := cat.Get(l.IPN); !ok && !creating[l.IPN] {
+			response.Err(w, "unknown IPN "+l.IPN+"; add it to create_parts", 400)
+			return
+		}
+	}
+
+	created := []models.Part{}
+	for _, np := range body.CreateParts {
+		part, err := h.createPart(np.IPN, np.Category, np.Fields)
+		if err == errIPNExists || err == ErrCSVLocked {
+			response.Err(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			response.Err(w, "failed to create "+np.IPN+": "+err.Error(), 500)
+			return
+		}
+		h.markIPNUsed(np.IPN)
+		h.logAudit(user, "created", "part", np.IPN, fmt.Sprintf("Created part %s in %s for the BOM import of %s", np.IPN, np.Category, ipn))
+		created = append(created, part)
+	}
+
+	content := h.renderBOMImport(ipn, body.Lines)
+	path, exists := h.bomPath(ipn)
+	released := false
+	if part, ok := cat.Get(ipn); ok {
+		released = isReleasedPart(part.Fields)
+	}
+	if body.ViaECO || (released && h.requireECOForReleased()) {
+		var old []byte
+		if exists {
+			old, _ = os.ReadFile(path)
+		}
+		h.routeThroughECO(w, r, ipn, body.partEditBody, []PartChange{{FieldName: partBOMField, OldValue: string(old), NewValue: string(content)}})
+		return
+	}
+
+	if err := h.writeBOMFile(ipn, content); err == ErrCSVLocked {
+		response.Err(w, err.Error(), 409)
+		return
+	} else if err != nil {
+		response.Err(w, "failed to write BOM: "+err.Error(), 500)
+		return
+	}
+	rel := path
+	if p, err := filepath.Rel(h.PartsDir, path); err == nil {
+		rel = p
+	}
+	h.logAudit(user, "updated", "part", ipn, fmt.Sprintf("Imported %d BOM lines into %s", len(body.Lines), rel))
+	response.JSON(w, map[string]interface{}{
+		"status": "written", "ipn": ipn, "path": rel,
+		"lines": len(body.Lines), "created_parts": created,
+	})
+}
@@ -0,0 +1,389 @@
+package parts
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/response"
+)
+
+// CostRoll is a stored BOM cost rollup of an assembly for a costing period.
+// A frozen roll is the standard cost for its period and cannot change; the
+// standard costing method prices parts from the latest frozen roll.
+type CostRoll struct {
+	ID           int            `json:"id"`
+	AssemblyIPN  string         `json:"assembly_ipn"`
+	Period       string         `json:"period"`
+	Method       string         `json:"method"`
+	BuildQty     float64        `json:"build_qty"`
+	TotalCost    float64        `json:"total_cost"`
+	UnitCost     float64        `json:"unit_cost"`
+	MissingCount int            `json:"missing_count"`
+	Status       string         `json:"status"`
+	CreatedBy    string         `json:"created_by"`
+	CreatedAt    string         `json:"created_at"`
+	FrozenBy     string         `json:"frozen_by,omitempty"`
+	FrozenAt     *string        `json:"frozen_at,omitempty"`
+	Lines        []CostRollLine `json:"lines,omitempty"`
+}
+
+// CostRollLine is one priced leaf part of a cost roll.
+type CostRollLine struct {
+	IPN         string   `json:"ipn"`
+	Description string   `json:"description"`
+	Qty         float64  `json:"qty"`
+	BuyQty      float64  `json:"buy_qty"`
+	UnitCost    *float64 `json:"unit_cost"`
+	ExtCost     float64  `json:"ext_cost"`
+	Source      string   `json:"source,omitempty"`
+}
+
+// CostVarianceLine compares a frozen (or draft) standard with actual cost,
+// per unit of the assembly. Either side is nil when the part is only in the
+// roll or only in the current BOM.
+type CostVarianceLine struct {
+	IPN            string   `json:"ipn"`
+	StdQty         float64  `json:"std_qty"`
+	ActualQty      float64  `json:"actual_qty"`
+	StdUnitCost    *float64 `json:"std_unit_cost"`
+	ActualUnitCost *float64 `json:"actual_unit_cost"`
+	StdCost        float64  `json:"std_cost"`
+	ActualCost     float64  `json:"actual_cost"`
+	Variance       float64  `json:"variance"`
+	VariancePct    *float64 `json:"variance_pct"`
+	ActualSource   string   `json:"actual_source,omitempty"`
+}
+
+// CostVariance is the standard vs actual comparison of a cost roll.
+type CostVariance struct {
+	RollID         int                `json:"roll_id"`
+	AssemblyIPN    string             `json:"assembly_ipn"`
+	Period         string             `json:"period"`
+	ActualMethod   string             `json:"actual_method"`
+	StdUnitCost    float64            `json:"std_unit_cost"`
+	ActualUnitCost float64            `json:"actual_unit_cost"`
+	Variance       float64            `json:"variance"`
+	VariancePct    *float64           `json:"variance_pct"`
+	Missing        []string           `json:"missing"`
+	Lines          []CostVarianceLine `json:"lines"`
+}
+
+const costRollColumns = `id, assembly_ipn, period, method, build_qty, total_cost, unit_cost,
+	missing_count, status, COALESCE(created_by,''), created_at, COALESCE(frozen_by,''), frozen_at`
+
+func scanCostRoll(row interface{ Scan(...interface{}) error }) (CostRoll, error) {
+	var c CostRoll
+	var frozenAt sql.NullString
+	err := row.Scan(&c.ID, &c.AssemblyIPN, &c.Period, &c.Method, &c.BuildQty, &c.TotalCost, &c.UnitCost,
+		&c.MissingCount, &c.Status, &c.CreatedBy, &c.CreatedAt, &c.FrozenBy, &frozenAt)
+	if frozenAt.Valid {
+		c.FrozenAt = &frozenAt.String
+	}
+	return c, err
+}
+
+// loadCostRoll reads a roll and its lines, writing 400/404/500 on failure.
+func (h *Handler) loadCostRoll(w http.ResponseWriter, id string) (CostRoll, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		response.Err(w, "invalid id", 400)
+		return CostRoll{}, false
+	}
+	c, err := scanCostRoll(h.DB.QueryRow("SELECT "+costRollColumns+" FROM cost_rolls WHERE id=?", n))
+	if err == sql.ErrNoRows {
+		response.Err(w, "cost roll not found", 404)
+		return c, false
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return c, false
+	}
+	rows, err := h.DB.Query(`SELECT ipn, description, qty, buy_qty, unit_cost, ext_cost, source
+		FROM cost_roll_lines WHERE roll_id=? ORDER BY ipn`, n)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return c, false
+	}
+	defer rows.Close()
+	c.Lines = []CostRollLine{}
+	for rows.Next() {
+		var l CostRollLine
+		var unit sql.NullFloat64
+		if err := rows.Scan(&l.IPN, &l.Description, &l.Qty, &l.BuyQty, &unit, &l.ExtCost, &l.Source); err != nil {
+			response.Err(w, err.Error(), 500)
+			return c, false
+		}
+		if unit.Valid {
+			l.UnitCost = &unit.Float64
+		}
+		c.Lines = append(c.Lines, l)
+	}
+	return c, true
+}
+
+// ListCostRolls handles GET /api/cost-rolls, filtered by ?ipn=, ?period=
+// and ?status=. Lines are not included.
+func (h *Handler) ListCostRolls(w http.ResponseWriter, r *http.Request) {
+	q := "SELECT " + costRollColumns + " FROM cost_rolls WHERE 1=1"
+	var args []interface{}
+	for param, col := range map[string]string{"ipn": "assembly_ipn", "period": "period", "status": "status"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			q += " AND " + col + "=?"
+			args = append(args, v)
+		}
+	}
+	rows, err := h.DB.Query(q+" ORDER BY created_at DESC, id DESC", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	rolls := []CostRoll{}
+	for rows.Next() {
+		c, err := scanCostRoll(rows)
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		rolls = append(rolls, c)
+	}
+	response.JSON(w, rolls)
+}
+
+// GetCostRoll handles GET /api/cost-rolls/:id.
+func (h *Handler) GetCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	if c, ok := h.loadCostRoll(w, id); ok {
+		response.JSON(w, c)
+	}
+}
+
+// CreateCostRoll handles POST /api/cost-rolls. It rolls up the assembly's
+// BOM with the given method and stores the result as a draft.
+func (h *Handler) CreateCostRoll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AssemblyIPN string  `json:"assembly_ipn"`
+		Period      string  `json:"period"`
+		Method      string  `json:"method"`
+		Qty         float64 `json:"qty"`
+	}
+	if err := response.DecodeBody(r, &req); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	req.AssemblyIPN = strings.TrimSpace(req.AssemblyIPN)
+	req.Period = strings.TrimSpace(req.Period)
+	if req.AssemblyIPN == "" || req.Period == "" {
+		response.Err(w, "assembly_ipn and period are required", 400)
+		return
+	}
+	if req.Method == "" {
+		req.Method = h.bomSettings().CostMethod
+	}
+	if !validCostMethod(req.Method) {
+		response.Err(w, "method must be one of "+strings.Join(CostMethods, ", "), 400)
+		return
+	}
+	if req.Qty == 0 {
+		req.Qty = 1
+	}
+	if req.Qty < 0 {
+		response.Err(w, "qty must be a positive number", 400)
+		return
+	}
+	if !h.isAssembly(h.assemblyRules(), req.AssemblyIPN) {
+		response.Err(w, req.AssemblyIPN+" is not an assembly", 400)
+		return
+	}
+	roll, err := h.costRollup(req.AssemblyIPN, req.Method, req.Qty)
+	if cerr, ok := err.(*BOMCycleError); ok {
+		writeBOMCycle(w, cerr)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	username := h.getUsername(r)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO cost_rolls (assembly_ipn, period, method, build_qty, total_cost, unit_cost, missing_count, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, req.AssemblyIPN, req.Period, req.Method, req.Qty, roll.TotalCost, roll.UnitCost, len(roll.Missing), username)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	for _, l := range roll.Lines {
+		if _, err := tx.Exec(`INSERT INTO cost_roll_lines (roll_id, ipn, description, qty, buy_qty, unit_cost, ext_cost, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, id, l.IPN, l.Description, l.Qty, l.BuyQty, l.UnitCost, l.ExtCost, l.Source); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	idStr := strconv.FormatInt(id, 10)
+	h.logAudit(username, "created", "cost_roll", idStr,
+		fmt.Sprintf("Rolled up %s for %s by %s: %.4f per unit", req.AssemblyIPN, req.Period, req.Method, roll.UnitCost))
+
+	c, ok := h.loadCostRoll(w, idStr)
+	if !ok {
+		return
+	}
+	w.WriteHeader(201)
+	response.JSON(w, c)
+}
+
+// FreezeCostRoll handles POST /api/cost-rolls/:id/freeze. Only one roll per
+// assembly and period can be frozen, and a roll with unpriced parts needs
+// {"allow_missing": true}.
+func (h *Handler) FreezeCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := h.loadCostRoll(w, id)
+	if !ok {
+		return
+	}
+	var req struct {
+		AllowMissing bool `json:"allow_missing"`
+	}
+	if r.ContentLength > 0 {
+		if err := response.DecodeBody(r, &req); err != nil {
+			response.Err(w, "invalid body", 400)
+			return
+		}
+	}
+	if c.Status == "frozen" {
+		response.Err(w, "cost roll is already frozen", 409)
+		return
+	}
+	if c.MissingCount > 0 && !req.AllowMissing {
+		response.Err(w, fmt.Sprintf("%d parts have no price; set allow_missing to freeze anyway", c.MissingCount), 409)
+		return
+	}
+	var other int
+	if err := h.DB.QueryRow("SELECT id FROM cost_rolls WHERE assembly_ipn=? AND period=? AND status='frozen'",
+		c.AssemblyIPN, c.Period).Scan(&other); err == nil {
+		response.Err(w, fmt.Sprintf("cost roll %d is already frozen for %s %s", other, c.AssemblyIPN, c.Period), 409)
+		return
+	}
+	username := h.getUsername(r)
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	// The checks above are only for the message; another request can freeze
+	// this roll or a sibling first, which the status guard and the unique
+	// index on frozen rolls catch.
+	res, err := h.DB.Exec("UPDATE cost_rolls SET status='frozen', frozen_by=?, frozen_at=? WHERE id=? AND status='draft'",
+		username, now, c.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			response.Err(w, fmt.Sprintf("another cost roll is already frozen for %s %s", c.AssemblyIPN, c.Period), 409)
+			return
+		}
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, "cost roll is already frozen", 409)
+		return
+	}
+	h.logAudit(username, "frozen", "cost_roll", id, fmt.Sprintf("Froze standard cost of %s for %s", c.AssemblyIPN, c.Period))
+	h.GetCostRoll(w, r, id)
+}
+
+// DeleteCostRoll handles DELETE /api/cost-rolls/:id. Frozen rolls are kept.
+func (h *Handler) DeleteCostRoll(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := h.loadCostRoll(w, id)
+	if !ok {
+		return
+	}
+	if c.Status == "frozen" {
+		response.Err(w, "frozen cost rolls cannot be deleted", 409)
+		return
+	}
+	if _, err := h.DB.Exec("DELETE FROM cost_rolls WHERE id=?", c.ID); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.logAudit(h.getUsername(r), "deleted", "cost_roll", id, "Deleted cost roll of "+c.AssemblyIPN+" for "+c.Period)
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// CostRollVariance handles GET /api/cost-rolls/:id/variance. It prices the
+// assembly's current BOM with ?method= (default weighted_avg, the actual
+// receipt cost) and compares each part with the roll, per assembly unit.
+func (h *Handler) CostRollVariance(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := h.loadCostRoll(w, id)
+	if !ok {
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = CostWeightedAvg
+	}
+	if !validCostMethod(method) {
+		response.Err(w, "method must be one of "+strings.Join(CostMethods, ", "), 400)
+		return
+	}
+	actual, err := h.costRollup(c.AssemblyIPN, method, c.BuildQty)
+	if cerr, ok := err.(*BOMCycleError); ok {
+		writeBOMCycle(w, cerr)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	byIPN := map[string]*CostVarianceLine{}
+	line := func(ipn string) *CostVarianceLine {
+		if l := byIPN[ipn]; l != nil {
+			return l
+		}
+		l := &CostVarianceLine{IPN: ipn}
+		byIPN[ipn] = l
+		return l
+	}
+	for _, sl := range c.Lines {
+		l := line(sl.IPN)
+		l.StdQty = round6(sl.BuyQty / c.BuildQty)
+		l.StdUnitCost = sl.UnitCost
+		l.StdCost = round6(sl.ExtCost / c.BuildQty)
+	}
+	for _, al := range actual.Lines {
+		l := line(al.IPN)
+		l.ActualQty = round6(al.BuyQty / c.BuildQty)
+		l.ActualUnitCost = al.UnitCost
+		l.ActualCost = round6(al.ExtCost / c.BuildQty)
+		l.ActualSource = al.Source
+	}
+
+	v := CostVariance{RollID: c.ID, AssemblyIPN: c.AssemblyIPN, Period: c.Period, ActualMethod: method,
+		StdUnitCost: c.UnitCost, ActualUnitCost: actual.UnitCost, Missing: actual.Missing}
+	v.Variance = round6(v.ActualUnitCost - v.StdUnitCost)
+	v.VariancePct = variancePct(v.Variance, v.StdUnitCost)
+	for _, l := range byIPN {
+		l.Variance = round6(l.ActualCost - l.StdCost)
+		l.VariancePct = variancePct(l.Variance, l.StdCost)
+		v.Lines = append(v.Lines, *l)
+	}
+	sort.Slice(v.Lines, func(i, j int) bool { return v.Lines[i].IPN < v.Lines[j].IPN })
+	if v.Lines == nil {
+		v.Lines = []CostVarianceLine{}
+	}
+	response.JSON(w, v)
+}
+
+func variancePct(variance, base float64) *float64 {
+	if base == 0 {
+		return nil
+	}
+	p := round6(variance / base * 100)
+	return &p
+}
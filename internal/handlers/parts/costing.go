@@ -0,0 +1,322 @@
+package parts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/response"
+)
+
+// Costing methods for BOM rollups.
+const (
+	// CostStandard prices a part at its unit cost in the frozen cost roll
+	// of the current costing period, falling back to a standard_cost column
+	// in the parts CSV.
+	CostStandard = "standard"
+	// CostLastPO prices a part at its most recent PO line price.
+	CostLastPO = "last_po"
+	// CostWeightedAvg prices a part at the average price of everything
+	// received against POs, weighted by quantity received.
+	CostWeightedAvg = "weighted_avg"
+	// CostVendorQuote prices a part at the lowest RFQ quote from an active
+	// or preferred vendor.
+	CostVendorQuote = "vendor_quote"
+	// CostMarket prices a part at the best distributor price break for the
+	// quantity to buy.
+	CostMarket = "market"
+)
+
+// CostMethods lists the valid costing methods.
+var CostMethods = []string{CostStandard, CostLastPO, CostWeightedAvg, CostVendorQuote, CostMarket}
+
+func validCostMethod(m string) bool {
+	for _, v := range CostMethods {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// CostLine is the cost of one leaf part of a rolled-up BOM. Qty is per top
+// assembly, ExtQty is for the build quantity and BuyQty adds attrition.
+// UnitCost is nil when the method found no price.
+type CostLine struct {
+	IPN          string   `json:"ipn"`
+	Description  string   `json:"description"`
+	Qty          float64  `json:"qty"`
+	ExtQty       float64  `json:"ext_qty"`
+	AttritionPct float64  `json:"attrition_pct"`
+	BuyQty       float64  `json:"buy_qty"`
+	UnitCost     *float64 `json:"unit_cost"`
+	ExtCost      float64  `json:"ext_cost"`
+	Source       string   `json:"source,omitempty"`
+}
+
+// CostRollup is the costed, summarized BOM of an assembly. Missing lists
+// the parts without a price; their cost is not included in the totals.
+type CostRollup struct {
+	IPN         string     `json:"ipn"`
+	Description string     `json:"description"`
+	Method      string     `json:"method"`
+	BuildQty    float64    `json:"build_qty"`
+	TotalCost   float64    `json:"total_cost"`
+	UnitCost    float64    `json:"unit_cost"`
+	Complete    bool       `json:"complete"`
+	Missing     []string   `json:"missing"`
+	Lines       []CostLine `json:"lines"`
+}
+
+// leafQty accumulates the quantities of one leaf part across the tree.
+type leafQty struct {
+	desc string
+	qty  float64
+	ext  float64
+	buy  float64
+}
+
+// costLeaves totals the leaf parts of node. Attrition on a sub-assembly line
+// scales everything below it; leaves without their own attrition use
+// defaultAttrition.
+func costLeaves(root *BOMNode, defaultAttrition float64) map[string]*leafQty {
+	out := map[string]*leafQty{}
+	var walk func(n *BOMNode, perUnit, buy float64)
+	walk = func(n *BOMNode, perUnit, buy float64) {
+		for i := range n.Children {
+			c := &n.Children[i]
+			attr := 0.0
+			if c.Attrition != nil {
+				attr = *c.Attrition
+			} else if len(c.Children) == 0 {
+				attr = defaultAttrition
+			}
+			childBuy := buy * c.Qty * (1 + attr/100)
+			if len(c.Children) > 0 {
+				walk(c, perUnit*c.Qty, childBuy)
+				continue
+			}
+			l := out[c.IPN]
+			if l == nil {
+				l = &leafQty{desc: c.Description}
+				out[c.IPN] = l
+			}
+			l.qty += perUnit * c.Qty
+			l.ext += c.ExtQty
+			l.buy += childBuy
+		}
+	}
+	walk(root, 1, root.ExtQty)
+	return out
+}
+
+// costRollup prices the summarized BOM of buildQty units of ipn with method,
+// using the lines in effect for a unit built today.
+func (h *Handler) costRollup(ipn, method string, buildQty float64) (*CostRollup, error) {
+	node, err := h.buildBOMTreeAt(ipn, buildQty, &bomEffectivity{Date: today()})
+	if err != nil {
+		return nil, err
+	}
+	return h.costTree(node, method), nil
+}
+
+// costTree prices an exploded BOM tree; the build quantity is the root's
+// ext_qty.
+func (h *Handler) costTree(node *BOMNode, method string) *CostRollup {
+	ipn, buildQty := node.IPN, node.ExtQty
+	settings := h.bomSettings()
+	period := settings.currentPeriod()
+	leaves := costLeaves(node, settings.DefaultAttritionPct)
+	ipns := make([]string, 0, len(leaves))
+	for k := range leaves {
+		ipns = append(ipns, k)
+	}
+	sort.Strings(ipns)
+
+	roll := &CostRollup{IPN: ipn, Description: node.Description, Method: method, BuildQty: buildQty,
+		Missing: []string{}, Lines: make([]CostLine, 0, len(ipns))}
+	for _, leaf := range ipns {
+		q := leaves[leaf]
+		line := CostLine{IPN: leaf, Description: q.desc, Qty: q.qty, ExtQty: q.ext, BuyQty: round6(q.buy)}
+		if q.ext > 0 {
+			line.AttritionPct = round6((q.buy/q.ext - 1) * 100)
+		}
+		if price, source, ok := h.unitCost(leaf, method, line.BuyQty, period); ok {
+			line.UnitCost = &price
+			line.ExtCost = round6(price * line.BuyQty)
+			line.Source = source
+			roll.TotalCost += line.ExtCost
+		} else {
+			roll.Missing = append(roll.Missing, leaf)
+		}
+		roll.Lines = append(roll.Lines, line)
+	}
+	roll.TotalCost = round6(roll.TotalCost)
+	roll.UnitCost = round6(roll.TotalCost / buildQty)
+	roll.Complete = len(roll.Missing) == 0
+	return roll
+}
+
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// currentPeriod is the costing period whose frozen rolls are the standard
+// cost: the configured period, or the current calendar quarter.
+func (s BOMSettings) currentPeriod() string {
+	if s.CostPeriod != "" {
+		return s.CostPeriod
+	}
+	now := time.Now()
+	return fmt.Sprintf("%d-Q%d", now.Year(), (int(now.Month())+2)/3)
+}
+
+// unitCost looks up the price of one unit of ipn by method. buyQty selects
+// the market price break and period the cost rolls used by CostStandard.
+// ok is false when there is no price.
+func (h *Handler) unitCost(ipn, method string, buyQty float64, period string) (price float64, source string, ok bool) {
+	switch method {
+	case CostStandard:
+		var rollID int
+		var p sql.NullFloat64
+		err := h.DB.QueryRow(`SELECT l.unit_cost, r.id FROM cost_roll_lines l
+			JOIN cost_rolls r ON r.id = l.roll_id
+			WHERE l.ipn=? AND r.period=? AND r.status='frozen' AND l.unit_cost IS NOT NULL
+			ORDER BY r.frozen_at DESC, r.id DESC LIMIT 1`, ipn, period).Scan(&p, &rollID)
+		if err == nil && p.Valid {
+			return p.Float64, fmt.Sprintf("cost roll %d (%s)", rollID, period), true
+		}
+		if part, found := h.catalog().Get(ipn); found {
+			for k, v := range part.Fields {
+				if strings.EqualFold(k, "standard_cost") || strings.EqualFold(k, "std_cost") {
+					if f, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(v), "$"), 64); err == nil && f >= 0 {
+						return f, "part " + k, true
+					}
+				}
+			}
+		}
+	case CostLastPO:
+		var poID string
+		if err := h.DB.QueryRow(`SELECT pl.unit_price, pl.po_id FROM po_lines pl
+			JOIN purchase_orders po ON po.id = pl.po_id
+			WHERE pl.ipn=? AND pl.unit_price > 0 ORDER BY po.created_at DESC LIMIT 1`, ipn).Scan(&price, &poID); err == nil {
+			return price, poID, true
+		}
+	case CostWeightedAvg:
+		var value, qty sql.NullFloat64
+		err := h.DB.QueryRow(`SELECT SUM(qty_received * unit_price), SUM(qty_received) FROM po_lines
+			WHERE ipn=? AND qty_received > 0 AND unit_price IS NOT NULL`, ipn).Scan(&value, &qty)
+		if err == nil && qty.Float64 > 0 {
+			return round6(value.Float64 / qty.Float64), fmt.Sprintf("%g received", qty.Float64), true
+		}
+	case CostVendorQuote:
+		var vendor, rfqID string
+		err := h.DB.QueryRow(`SELECT q.unit_price, v.name, q.rfq_id FROM rfq_quotes q
+			JOIN rfq_lines l ON l.id = q.rfq_line_id
+			JOIN rfq_vendors rv ON rv.id = q.rfq_vendor_id
+			JOIN vendors v ON v.id = rv.vendor_id
+			WHERE l.ipn=? AND q.unit_price > 0 AND v.status IN ('active','preferred')
+			ORDER BY q.unit_price ASC LIMIT 1`, ipn).Scan(&price, &vendor, &rfqID)
+		if err == nil {
+			return price, vendor + " (" + rfqID + ")", true
+		}
+	case CostMarket:
+		return h.marketPrice(ipn, buyQty)
+	}
+	return 0, "", false
+}
+
+// priceBreak mirrors the market_pricing.price_breaks JSON.
+type priceBreak struct {
+	Qty       int     `json:"qty"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+// marketPrice returns the lowest distributor price for buying qty units:
+// each distributor's highest break at or below qty, or its first break when
+// qty is below all of them.
+func (h *Handler) marketPrice(ipn string, qty float64) (float64, string, bool) {
+	rows, err := h.DB.Query("SELECT distributor, price_breaks FROM market_pricing WHERE part_ipn=?", ipn)
+	if err != nil {
+		return 0, "", false
+	}
+	defer rows.Close()
+	want := int(math.Ceil(qty))
+	best, source, found := 0.0, "", false
+	for rows.Next() {
+		var dist, raw string
+		if rows.Scan(&dist, &raw) != nil {
+			continue
+		}
+		var breaks []priceBreak
+		if json.Unmarshal([]byte(raw), &breaks) != nil || len(breaks) == 0 {
+			continue
+		}
+		sort.Slice(breaks, func(i, j int) bool { return breaks[i].Qty < breaks[j].Qty })
+		pb := breaks[0]
+		for _, b := range breaks {
+			if b.Qty <= want {
+				pb = b
+			}
+		}
+		if pb.UnitPrice <= 0 {
+			continue
+		}
+		if !found || pb.UnitPrice < best {
+			best, source, found = pb.UnitPrice, fmt.Sprintf("%s @ %d", dist, pb.Qty), true
+		}
+	}
+	return best, source, found
+}
+
+// costParams reads the method and qty query parameters.
+func (h *Handler) costParams(r *http.Request) (method string, qty float64, err error) {
+	method = r.URL.Query().Get("method")
+	if method == "" {
+		method = h.bomSettings().CostMethod
+	}
+	if !validCostMethod(method) {
+		return "", 0, fmt.Errorf("method must be one of %s", strings.Join(CostMethods, ", "))
+	}
+	qty = 1
+	if q := r.URL.Query().Get("qty"); q != "" {
+		v, perr := strconv.ParseFloat(q, 64)
+		if perr != nil || v <= 0 {
+			return "", 0, fmt.Errorf("qty must be a positive number")
+		}
+		qty = v
+	}
+	return method, qty, nil
+}
+
+// PartCostRollup handles GET /api/parts/:ipn/cost/rollup. It returns the
+// costed summarized BOM for ?qty= units priced by ?method=.
+func (h *Handler) PartCostRollup(w http.ResponseWriter, r *http.Request, ipn string) {
+	if h.LogSensitiveDataAccess != nil {
+		h.LogSensitiveDataAccess(r, "part", ipn, "cost rollup")
+	}
+	if !h.isAssembly(h.assemblyRules(), ipn) {
+		response.Err(w, ipn+" is not an assembly", 400)
+		return
+	}
+	method, qty, err := h.costParams(r)
+	if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	roll, err := h.costRollup(ipn, method, qty)
+	if cerr, ok := err.(*BOMCycleError); ok {
+		writeBOMCycle(w, cerr)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, roll)
+}
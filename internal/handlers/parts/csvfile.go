@@ -0,0 +1,336 @@
+package parts
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"zrp/internal/catalog"
+)
+
+// partCSV is a gitplm CSV file loaded for editing. Rows that are not
+// modified are written back byte-for-byte, so the quoting and layout of a
+// hand-edited file survive API edits.
+type partCSV struct {
+	path    string
+	title   string     // "# TITLE: ..." line without its newline, or ""
+	records [][]string // records[0] is the header row
+	raw     []string   // raw text of each record; "" once modified
+	crlf    bool
+	// quoteAll is set when the header row quotes every field; rewritten
+	// rows then quote every field too.
+	quoteAll bool
+}
+
+// readPartCSV parses a parts CSV, keeping the title line and the raw text
+// of every record.
+func readPartCSV(path string) (*partCSV, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &partCSV{path: path, crlf: bytes.Contains(content, []byte("\r\n"))}
+	if bytes.HasPrefix(content, []byte("# TITLE:")) {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+		} else {
+			content = nil
+		}
+		c.title = strings.TrimRight(string(line), "\r")
+	}
+
+	rd := csv.NewReader(bytes.NewReader(content))
+	rd.LazyQuotes = true
+	rd.TrimLeadingSpace = true
+	rd.FieldsPerRecord = -1
+	var prev int64
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		off := rd.InputOffset()
+		c.records = append(c.records, rec)
+		c.raw = append(c.raw, string(content[prev:off]))
+		prev = off
+	}
+	if len(c.records) == 0 {
+		return nil, fmt.Errorf("%s: empty csv", filepath.Base(path))
+	}
+	c.quoteAll = strings.HasPrefix(c.raw[0], `"`)
+	return c, nil
+}
+
+func (c *partCSV) headers() []string { return c.records[0] }
+
+// column returns the index of the named column, matched case-insensitively,
+// or -1.
+func (c *partCSV) column(name string) int {
+	for i, h := range c.records[0] {
+		if strings.EqualFold(h, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ipnColumn returns the index of the IPN column, defaulting to the first.
+func (c *partCSV) ipnColumn() int {
+	for i, h := range c.records[0] {
+		if isIPNHeader(h) {
+			return i
+		}
+	}
+	return 0
+}
+
+// find returns the row index of ipn, or -1.
+func (c *partCSV) find(ipn string) int {
+	col := c.ipnColumn()
+	for i := 1; i < len(c.records); i++ {
+		if col < len(c.records[i]) && c.records[i][col] == ipn {
+			return i
+		}
+	}
+	return -1
+}
+
+// set replaces record i.
+func (c *partCSV) set(i int, rec []string) {
+	c.records[i] = rec
+	c.raw[i] = ""
+}
+
+// remove deletes record i.
+func (c *partCSV) remove(i int) {
+	c.records = append(c.records[:i], c.records[i+1:]...)
+	c.raw = append(c.raw[:i], c.raw[i+1:]...)
+}
+
+// append adds a record at the end.
+func (c *partCSV) append(rec []string) {
+	c.records = append(c.records, rec)
+	c.raw = append(c.raw, "")
+}
+
+func (c *partCSV) encodeField(f string, only bool) string {
+	if c.quoteAll || f == "" && only || strings.ContainsAny(f, ",\"\r\n") || strings.TrimSpace(f) != f {
+		return `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+	}
+	return f
+}
+
+func (c *partCSV) newline() string {
+	if c.crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func (c *partCSV) encode(rec []string) string {
+	fields := make([]string, len(rec))
+	for i, f := range rec {
+		fields[i] = c.encodeField(f, len(rec) == 1)
+	}
+	return strings.Join(fields, ",") + c.newline()
+}
+
+// addColumn appends a column holding value on every row. Unmodified rows
+// keep their raw text with the new field tacked on.
+func (c *partCSV) addColumn(name, value string) {
+	width := len(c.records[0])
+	for i, rec := range c.records {
+		v := value
+		if i == 0 {
+			v = name
+		}
+		if c.raw[i] != "" && len(rec) == width {
+			raw := strings.TrimRight(c.raw[i], "\r\n")
+			c.raw[i] = raw + "," + c.encodeField(v, false) + c.newline()
+			c.records[i] = append(rec, v)
+			continue
+		}
+		for len(rec) < width {
+			rec = append(rec, "")
+		}
+		c.set(i, append(rec, v))
+	}
+}
+
+// removeColumn drops column idx from every row.
+func (c *partCSV) removeColumn(idx int) {
+	for i, rec := range c.records {
+		if idx < len(rec) {
+			c.set(i, append(append([]string(nil), rec[:idx]...), rec[idx+1:]...))
+		}
+	}
+}
+
+// bytes renders the file.
+func (c *partCSV) bytes() []byte {
+	var b bytes.Buffer
+	nl := c.newline()
+	if c.title != "" {
+		b.WriteString(c.title + nl)
+	}
+	for i, rec := range c.records {
+		raw := c.raw[i]
+		if raw == "" {
+			raw = c.encode(rec)
+		} else if !strings.HasSuffix(raw, "\n") {
+			// The last line of the original file had no newline.
+			raw += nl
+		}
+		b.WriteString(raw)
+	}
+	return b.Bytes()
+}
+
+// csvLockTimeout is how long a writer waits for another writer's lock, and
+// how old a lock file must be before it is treated as abandoned.
+var csvLockTimeout = 10 * time.Second
+
+var csvLocks sync.Map // path -> *sync.Mutex
+
+// ErrCSVLocked is returned when a CSV stays locked by another writer.
+var ErrCSVLocked = errors.New("parts file is locked by another writer")
+
+// lockPartCSV serialises writers to path: a mutex within this process and a
+// "<path>.lock" file against other processes (such as gitplm tooling that
+// honours the same convention).
+func lockPartCSV(path string) (func(), error) {
+	v, _ := csvLocks.LoadOrStore(path, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(csvLockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() {
+				os.Remove(lockPath)
+				mu.Unlock()
+			}, nil
+		}
+		if !os.IsExist(err) {
+			mu.Unlock()
+			return nil, err
+		}
+		if info, serr := os.Stat(lockPath); serr == nil && time.Since(info.ModTime()) > csvLockTimeout {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			mu.Unlock()
+			return nil, ErrCSVLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// editPartCSV locks path, loads it, applies fn and writes the result back
+// atomically. Nothing is written if fn returns an error.
+func editPartCSV(path string, fn func(c *partCSV) error) error {
+	unlock, err := lockPartCSV(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c, err := readPartCSV(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	return writePartCSV(c)
+}
+
+// writePartCSV replaces c.path with the rendered file via a temp file and
+// rename, so readers never see a partial write.
+func writePartCSV(c *partCSV) error {
+	return writeFileAtomic(c.path, c.bytes())
+}
+
+// writeFileAtomic replaces path with data via a temp file and rename,
+// keeping the mode of an existing file.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func isIPNHeader(h string) bool { return catalog.IsIPNHeader(h) }
+
+// partCSVPaths lists every parts CSV: top-level files and files one level
+// down in category directories.
+func (h *Handler) partCSVPaths() ([]string, error) {
+	entries, err := os.ReadDir(h.PartsDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			csvFiles, _ := filepath.Glob(filepath.Join(h.PartsDir, entry.Name(), "*.csv"))
+			paths = append(paths, csvFiles...)
+		} else if strings.HasSuffix(entry.Name(), ".csv") {
+			paths = append(paths, filepath.Join(h.PartsDir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// categoryCSVPaths returns the CSV files backing a category: the single
+// <category>.csv file, or every CSV in the <category>/ directory.
+func (h *Handler) categoryCSVPaths(category string) []string {
+	if h.PartsDir == "" || category == "" || strings.ContainsAny(category, `/\`) || strings.Contains(category, "..") {
+		return nil
+	}
+	if p := h.FindCategoryCSV(category); p != "" {
+		return []string{p}
+	}
+	entries, err := os.ReadDir(h.PartsDir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.EqualFold(e.Name(), category) {
+			paths, _ := filepath.Glob(filepath.Join(h.PartsDir, e.Name(), "*.csv"))
+			return paths
+		}
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+package parts
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// EDA export formats accepted by the BOM import.
+const (
+	// EDAKiCadCSV is a KiCad BOM CSV: one row per component or per group,
+	// with Reference/Value/Footprint/Qty and any custom fields as columns.
+	EDAKiCadCSV = "kicad_csv"
+	// EDAKiCadXML is the KiCad intermediate netlist (the XML the BOM
+	// plugins read), one <comp> per component.
+	EDAKiCadXML = "kicad_xml"
+	// EDAAltium is an Altium BOM report saved as CSV, TSV or XLSX, with
+	// Designator/Comment/Quantity and Manufacturer Part Number columns.
+	EDAAltium = "altium"
+)
+
+// EDAFormats lists the accepted import formats.
+var EDAFormats = []string{EDAKiCadCSV, EDAKiCadXML, EDAAltium}
+
+// edaRow is one component, or one grouped line, of an EDA export.
+type edaRow struct {
+	refs         []string
+	qty          float64 // 0 when the export has no quantity
+	value        string
+	footprint    string
+	description  string
+	mpn          string
+	manufacturer string
+	ipn          string
+	dnp          bool
+}
+
+// edaColumns maps normalized header names (lower case, letters and digits
+// only) to the edaRow field they fill.
+var edaColumns = map[string]string{
+	"reference": "ref", "references": "ref", "ref": "ref", "refs": "ref",
+	"designator": "ref", "designators": "ref", "refdes": "ref",
+	"qty": "qty", "quantity": "qty", "quantityperpcb": "qty",
+	"value": "value", "val": "value", "comment": "value",
+	"footprint": "footprint", "pcbfootprint": "footprint", "package": "footprint",
+	"description": "description", "desc": "description",
+	"mpn": "mpn", "mpn1": "mpn", "manufacturerpartnumber": "mpn", "manufacturerpartnumber1": "mpn",
+	"mfrpn": "mpn", "mfrpartnumber": "mpn", "mfgpn": "mpn", "mfgpartnumber": "mpn",
+	"manufacturer": "manufacturer", "manufacturer1": "manufacturer", "manufacturername": "manufacturer",
+	"mfr": "manufacturer", "mfg": "manufacturer",
+	"ipn": "ipn", "internalpartnumber": "ipn",
+	"dnp": "dnp", "dnf": "dnp", "donotpopulate": "dnp", "donotplace": "dnp",
+	"fitted": "fitted", "populate": "fitted", "populated": "fitted",
+	"excludefrombom": "exclude",
+}
+
+func normalizeHeader(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// set fills the field a header maps to. It reports whether the row is to be
+// skipped entirely (excluded from the BOM).
+func (row *edaRow) set(field, v string) (exclude bool) {
+	v = strings.TrimSpace(v)
+	switch field {
+	case "ref":
+		row.refs = append(row.refs, expandRefs(v)...)
+	case "qty":
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			row.qty = f
+		}
+	case "value":
+		row.value = v
+	case "footprint":
+		row.footprint = v
+	case "description":
+		row.description = v
+	case "mpn":
+		row.mpn = v
+	case "manufacturer":
+		row.manufacturer = v
+	case "ipn":
+		row.ipn = v
+	case "dnp":
+		row.dnp = row.dnp || truthy(v)
+	case "fitted":
+		l := strings.ToLower(v)
+		row.dnp = row.dnp || strings.HasPrefix(l, "not") || strings.HasPrefix(l, "no") || l == "dnp" || l == "false" || l == "0"
+	case "exclude":
+		return truthy(v)
+	}
+	return false
+}
+
+// truthy reads a DNP-style flag: anything but empty, 0, no or false.
+func truthy(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "0", "no", "n", "false":
+		return false
+	}
+	return true
+}
+
+// detectEDAFormat guesses the export format from the file name and content.
+func detectEDAFormat(filename string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xml":
+		return EDAKiCadXML
+	case ".xlsx":
+		return EDAAltium
+	}
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return EDAKiCadXML
+	}
+	if bytes.HasPrefix(content, []byte("PK")) {
+		return EDAAltium
+	}
+	records, err := readDelimited(content)
+	if err == nil {
+		if i := edaHeaderRow(records); i >= 0 {
+			for _, h := range records[i] {
+				switch normalizeHeader(h) {
+				case "designator", "comment", "libref":
+					return EDAAltium
+				}
+			}
+		}
+	}
+	return EDAKiCadCSV
+}
+
+// parseEDAExport reads the components of an export in format.
+func parseEDAExport(format string, content []byte) ([]edaRow, error) {
+	switch format {
+	case EDAKiCadXML:
+		return parseKiCadXML(content)
+	case EDAKiCadCSV, EDAAltium:
+		var records [][]string
+		var err error
+		if bytes.HasPrefix(content, []byte("PK")) {
+			records, err = readXLSX(content)
+		} else {
+			records, err = readDelimited(content)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseEDATable(records)
+	}
+	return nil, fmt.Errorf("format must be one of %s", strings.Join(EDAFormats, ", "))
+}
+
+// readDelimited reads CSV or, when the first line has more tabs than
+// commas, TSV. Ragged rows are allowed.
+func readDelimited(content []byte) ([][]string, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	first := content
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		first = content[:i]
+	}
+	cr := csv.NewReader(bytes.NewReader(content))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	if bytes.Count(first, []byte("\t")) > bytes.Count(first, []byte(",")) {
+		cr.Comma = '\t'
+	} else if bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) {
+		cr.Comma = ';'
+	}
+	return cr.ReadAll()
+}
+
+// readXLSX reads the first sheet of a workbook.
+func readXLSX(content []byte) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx: %w", err)
+	}
+	defer f.Close()
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	return f.GetRows(sheets[0])
+}
+
+// edaHeaderRow finds the header row: exports often start with a title
+// block, so the first of the leading rows naming a designator or MPN column
+// wins. It returns -1 when there is none.
+func edaHeaderRow(records [][]string) int {
+	for i := 0; i < len(records) && i < 30; i++ {
+		for _, h := range records[i] {
+			if f := edaColumns[normalizeHeader(h)]; f == "ref" || f == "mpn" {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseEDATable reads rows from a tabular export.
+func parseEDATable(records [][]string) ([]edaRow, error) {
+	hdr := edaHeaderRow(records)
+	if hdr < 0 {
+		return nil, errors.New("no designator or manufacturer part number column found")
+	}
+	fields := make([]string, len(records[hdr]))
+	for i, h := range records[hdr] {
+		fields[i] = edaColumns[normalizeHeader(h)]
+	}
+	var rows []edaRow
+	for _, rec := range records[hdr+1:] {
+		var row edaRow
+		exclude, empty := false, true
+		for i, v := range rec {
+			if i >= len(fields) || fields[i] == "" {
+				continue
+			}
+			if strings.TrimSpace(v) != "" {
+				empty = false
+			}
+			exclude = row.set(fields[i], v) || exclude
+		}
+		if empty || exclude {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// kicadNetlist is the part of the KiCad intermediate netlist the import
+// reads. KiCad 5 keeps user fields under <fields>; KiCad 6 and later also
+// write them, plus flags such as dnp, as <property> elements.
+type kicadNetlist struct {
+	XMLName    xml.Name `xml:"export"`
+	Components []struct {
+		Ref         string `xml:"ref,attr"`
+		Value       string `xml:"value"`
+		Footprint   string `xml:"footprint"`
+		Description string `xml:"description"`
+		Fields      []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"fields>field"`
+		Properties []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"property"`
+		LibSource struct {
+			Description string `xml:"description,attr"`
+		} `xml:"libsource"`
+	} `xml:"components>comp"`
+}
+
+func parseKiCadXML(content []byte) ([]edaRow, error) {
+	var nl kicadNetlist
+	if err := xml.Unmarshal(content, &nl); err != nil {
+		return nil, fmt.Errorf("invalid KiCad XML: %w", err)
+	}
+	var rows []edaRow
+	for _, c := range nl.Components {
+		row := edaRow{refs: expandRefs(c.Ref), value: strings.TrimSpace(c.Value),
+			footprint: strings.TrimSpace(c.Footprint), description: strings.TrimSpace(c.Description)}
+		if row.description == "" {
+			row.description = strings.TrimSpace(c.LibSource.Description)
+		}
+		exclude := false
+		for _, f := range c.Fields {
+			if field := edaColumns[normalizeHeader(f.Name)]; field != "" && field != "ref" && field != "qty" {
+				exclude = row.set(field, f.Value) || exclude
+			}
+		}
+		for _, p := range c.Properties {
+			field := edaColumns[normalizeHeader(p.Name)]
+			switch {
+			case field == "dnp" || field == "exclude":
+				// Flag properties are present without a value when set.
+				if p.Value == "" {
+					p.Value = "1"
+				}
+				exclude = row.set(field, p.Value) || exclude
+			case field != "" && field != "ref" && field != "qty" && p.Value != "":
+				exclude = row.set(field, p.Value) || exclude
+			}
+		}
+		if !exclude && len(row.refs) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	if len(nl.Components) == 0 {
+		return nil, errors.New("no components found")
+	}
+	return rows, nil
+}
+
+// groupEDARows merges the rows for one part into a BOM line: by IPN when the export
+// carries one, else by MPN, else by value and footprint. DNP components
+// are returned separately. Groups are ordered by their first designator.
+func groupEDARows(rows []edaRow) (groups []edaRow, dnp []string) {
+	index := map[string]int{}
+	for _, row := range rows {
+		if row.dnp {
+			dnp = append(dnp, row.refs...)
+			continue
+		}
+		var key string
+		switch {
+		case row.ipn != "":
+			key = "ipn:" + strings.ToUpper(row.ipn)
+		case row.mpn != "":
+			key = "mpn:" + strings.ToUpper(row.mpn)
+		default:
+			key = "val:" + strings.ToUpper(row.value) + "|" + strings.ToUpper(row.footprint)
+		}
+		qty := row.qty
+		if qty == 0 {
+			qty = float64(len(row.refs))
+		}
+		if qty == 0 {
+			qty = 1
+		}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(groups)
+			row.qty = qty
+			row.refs = append([]string(nil), row.refs...)
+			groups = append(groups, row)
+			continue
+		}
+		g := &groups[i]
+		g.qty += qty
+		g.refs = append(g.refs, row.refs...)
+		for _, f := range []struct {
+			dst *string
+			v   string
+		}{
+			{&g.value, row.value}, {&g.footprint, row.footprint}, {&g.description, row.description},
+			{&g.mpn, row.mpn}, {&g.manufacturer, row.manufacturer},
+		} {
+			if *f.dst == "" {
+				*f.dst = f.v
+			}
+		}
+	}
+	for i := range groups {
+		groups[i].refs = sortRefs(groups[i].refs)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].refs, groups[j].refs
+		if len(a) == 0 || len(b) == 0 {
+			return len(a) > len(b)
+		}
+		return refLess(a[0], b[0])
+	})
+	return groups, sortRefs(dnp)
+}
+
+// sortRefs removes duplicate designators and sorts them naturally, so R2
+// comes before R10.
+func sortRefs(refs []string) []string {
+	seen := map[string]bool{}
+	out := refs[:0:0]
+	for _, r := range refs {
+		if k := strings.ToUpper(r); !seen[k] {
+			seen[k] = true
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return refLess(out[i], out[j]) })
+	return out
+}
+
+func refLess(a, b string) bool {
+	pa, na := splitRef(a)
+	pb, nb := splitRef(b)
+	if pa != pb {
+		return pa < pb
+	}
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// splitRef splits a designator into its upper-cased letter prefix and
+// number; the number is -1 when there is none.
+func splitRef(ref string) (string, int) {
+	i := strings.IndexFunc(ref, unicode.IsDigit)
+	if i < 0 {
+		return strings.ToUpper(ref), -1
+	}
+	n, err := strconv.Atoi(ref[i:])
+	if err != nil {
+		n = -1
+	}
+	return strings.ToUpper(ref[:i]), n
+}
+
+// refCategoryHints maps designator prefixes to words found in the names of
+// the categories those parts usually live in.
+var refCategoryHints = map[string][]string{
+	"R": {"res"}, "RN": {"res"}, "C": {"cap"}, "L": {"ind"}, "FB": {"ferrite", "bead", "ind"},
+	"D": {"diode", "led"}, "LED": {"led", "diode"}, "Q": {"trans", "fet"},
+	"U": {"ic", "mcu", "reg"}, "IC": {"ic"}, "J": {"conn"}, "P": {"conn"}, "CN": {"conn"},
+	"Y": {"crystal", "xtal", "osc"}, "X": {"crystal", "xtal", "osc"}, "F": {"fuse"},
+	"SW": {"switch"}, "S": {"switch"}, "K": {"relay"}, "T": {"transformer", "xfmr"},
+	"BT": {"batt"}, "TP": {"test"},
+}
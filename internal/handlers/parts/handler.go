@@ -3,7 +3,9 @@ package parts
 import (
 	"database/sql"
 	"net/http"
+	"sync"
 
+	"zrp/internal/catalog"
 	"zrp/internal/models"
 	"zrp/internal/websocket"
 )
@@ -14,6 +16,12 @@ type Handler struct {
 	Hub      *websocket.Hub
 	PartsDir string
 
+	// Catalog is the indexed view of PartsDir. Created on first use when
+	// not set by the root package.
+	Catalog      *catalog.Catalog
+	catalogMu    sync.Mutex
+	catalogRuled *catalog.Catalog // catalog last given the assembly prefixes
+
 	// NextID generates the next sequential ID for a table. Set by the root package.
 	NextID func(prefix, table string, digits int) string
 
@@ -35,3 +43,24 @@ type Handler struct {
 	// LogSensitiveDataAccess logs access to sensitive data. Set by the root package.
 	LogSensitiveDataAccess func(r *http.Request, dataType, recordID, details string)
 }
+
+// catalog returns the parts catalog for PartsDir.
+func (h *Handler) catalog() *catalog.Catalog {
+	h.catalogMu.Lock()
+	defer h.catalogMu.Unlock()
+	if h.Catalog == nil || h.Catalog.Dir() != h.PartsDir {
+		h.Catalog = catalog.New(h.PartsDir)
+	}
+	if h.catalogRuled != h.Catalog {
+		h.Catalog.SetAssemblyPrefixes(h.loadAssemblyRules().Prefixes)
+		h.catalogRuled = h.Catalog
+	}
+	return h.Catalog
+}
+
+// editPartCSV edits a parts CSV under its lock and invalidates the catalog.
+func (h *Handler) editPartCSV(path string, fn func(c *partCSV) error) error {
+	err := editPartCSV(path, fn)
+	h.catalog().Invalidate()
+	return err
+}
@@ -0,0 +1,121 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+)
+
+func createAlternate(t *testing.T, h *parts.Handler, ipn, body string, want int) parts.PartAlternate {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.CreatePartAlternate(w, httptest.NewRequest("POST", "/api/v1/parts/"+ipn+"/alternates", strings.NewReader(body)), ipn)
+	if w.Code != want {
+		t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.PartAlternate `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func TestPartAlternates_CRUD(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(db, dir)
+
+	a := createAlternate(t, h, "RES-001", `{"alternate_ipn":"RES-002","notes":"same footprint"}`, 201)
+	if a.ID == 0 || a.IPN != "RES-001" || a.AssemblyIPN != "" {
+		t.Fatalf("alternate = %+v", a)
+	}
+	createAlternate(t, h, "RES-001", `{"alternate_ipn":"RES-002"}`, 409)
+	createAlternate(t, h, "RES-001", `{"alternate_ipn":"RES-001"}`, 400)
+	createAlternate(t, h, "RES-001", `{"alternate_ipn":"NOPE-1"}`, 400)
+	createAlternate(t, h, "RES-001", `{"alternate_ipn":"CAP-001","assembly_ipn":"IC-001"}`, 400)
+	createAlternate(t, h, "NOPE-1", `{"alternate_ipn":"RES-002"}`, 404)
+	createAlternate(t, h, "RES-001", `{"alternate_ipn":"IC-001","assembly_ipn":"PCA-SUB2"}`, 201)
+
+	w := httptest.NewRecorder()
+	h.ListPartAlternates(w, httptest.NewRequest("GET", "/api/v1/parts/RES-002/alternates", nil), "RES-002")
+	var resp struct {
+		Data struct {
+			Alternates   []parts.PartAlternate `json:"alternates"`
+			AlternateFor []parts.PartAlternate `json:"alternate_for"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data.Alternates) != 0 || len(resp.Data.AlternateFor) != 1 || resp.Data.AlternateFor[0].IPN != "RES-001" {
+		t.Errorf("RES-002 alternates = %+v", resp.Data)
+	}
+
+	w = httptest.NewRecorder()
+	h.DeletePartAlternate(w, httptest.NewRequest("DELETE", "/", nil), "RES-002", "1")
+	if w.Code != 404 {
+		t.Errorf("delete under wrong part: expected 404, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.DeletePartAlternate(w, httptest.NewRequest("DELETE", "/", nil), "RES-001", "1")
+	if w.Code != 200 {
+		t.Errorf("delete: expected 200, got %d", w.Code)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM part_alternates").Scan(&n)
+	if n != 1 {
+		t.Errorf("expected 1 alternate left, got %d", n)
+	}
+}
+
+func TestResolveBuildBOM_Alternates(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	createBOMFile(t, dir, "PCA-SUB1", [][]string{
+		{"IPN", "qty", "ref", "alternates"},
+		{"RES-001", "2", "R1,R2", ""},
+		{"CAP-001", "1", "C1", "CAP-002; CAP-003"},
+	})
+	h := newTestHandler(db, dir)
+	mustExec(t, db, `INSERT INTO part_alternates (ipn, alternate_ipn, assembly_ipn, priority) VALUES
+		('RES-001','RES-009','',2), ('RES-001','RES-002','',1), ('RES-001','RES-007','PCA-SUB2',0), ('CAP-001','CAP-002','',0)`)
+
+	bom, err := h.ResolveBuildBOM("ASY-MAIN", 2, "2026-05-01", []string{"SN-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alts := map[string]string{}
+	for _, l := range bom.Lines {
+		alts[l.IPN] = strings.Join(l.Alternates, ",")
+	}
+	// RES-001 is in both sub-assemblies, so its line carries the
+	// PCA-SUB2-only alternate too.
+	if alts["RES-001"] != "RES-002,RES-009,RES-007" {
+		t.Errorf("RES-001 alternates = %q", alts["RES-001"])
+	}
+	if alts["CAP-001"] != "CAP-002,CAP-003" {
+		t.Errorf("CAP-001 alternates = %q", alts["CAP-001"])
+	}
+	if alts["IC-002"] != "" {
+		t.Errorf("IC-002 alternates = %q", alts["IC-002"])
+	}
+	if len(bom.Units) != 2 || bom.Units[0].Serial != "SN-1" || bom.Units[1].Serial != "" || bom.Units[1].Count != 1 {
+		t.Fatalf("units = %+v", bom.Units)
+	}
+	for _, l := range bom.Units[0].Lines {
+		if l.IPN == "RES-001" && l.Qty != 7 {
+			t.Errorf("RES-001 per unit = %g", l.Qty)
+		}
+	}
+
+	// The PCA-SUB1 view alone does not see the PCA-SUB2 approval.
+	view := getBOMView(t, h, "/api/v1/parts/PCA-SUB1/bom?view=summarized", "PCA-SUB1")
+	for _, l := range view.Lines {
+		if l.IPN == "RES-001" && strings.Join(l.Alternates, ",") != "RES-002,RES-009" {
+			t.Errorf("PCA-SUB1 RES-001 alternates = %v", l.Alternates)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+)
+
+func getBOMDiff(t *testing.T, h *parts.Handler, ipn, query string) parts.BOMDiff {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.BOMDiff(w, httptest.NewRequest("GET", "/api/v1/parts/"+ipn+"/bom/diff?"+query, nil), ipn)
+	if w.Code != 200 {
+		t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.BOMDiff `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data
+}
+
+func changeSummary(d parts.BOMDiff) string {
+	var out []string
+	for _, c := range d.Changes {
+		s := strings.Join(append(c.Path, c.IPN), "/") + " " + c.Change
+		if len(c.RefsAdded) > 0 {
+			s += " +" + strings.Join(c.RefsAdded, ",")
+		}
+		if len(c.RefsRemoved) > 0 {
+			s += " -" + strings.Join(c.RefsRemoved, ",")
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, "; ")
+}
+
+func TestBOMDiff_BetweenAssemblies(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	// ASY-NEW drops PCA-SUB2, adds IC-001 at the top and uses a revised
+	// sub-assembly with one more resistor and a renumbered capacitor.
+	createBOMFile(t, dir, "PCA-SUB1B", [][]string{
+		{"IPN", "qty", "ref"},
+		{"RES-001", "3", "R1-R3"},
+		{"CAP-001", "1", "C2"},
+	})
+	createBOMFile(t, dir, "ASY-NEW", [][]string{
+		{"IPN", "qty", "ref"},
+		{"PCA-SUB1B", "2", "A1,A2"},
+		{"IC-001", "1", "U2"},
+		{"IC-002", "2", "U1 U3"},
+	})
+	h := newTestHandler(testDB, dir)
+
+	d := getBOMDiff(t, h, "ASY-MAIN", "with=ASY-NEW")
+	want := "IC-001 added +U2; IC-002 changed +U3; PCA-SUB1 removed -A1,A2; PCA-SUB1B added +A1,A2; PCA-SUB2 removed -A3"
+	if got := changeSummary(d); got != want {
+		t.Errorf("changes =\n  %s\nwant\n  %s", got, want)
+	}
+	if d.Added != 2 || d.Removed != 2 || d.Changed != 1 {
+		t.Errorf("counts = %d/%d/%d", d.Added, d.Removed, d.Changed)
+	}
+
+	// Comparing the sub-assemblies themselves shows the nested differences.
+	d = getBOMDiff(t, h, "PCA-SUB1", "with=PCA-SUB1B")
+	if got := changeSummary(d); got != "CAP-001 changed +C2 -C1; RES-001 changed +R3" {
+		t.Errorf("changes = %s", got)
+	}
+	if d.Changes[1].OldQty != 2 || d.Changes[1].NewQty != 3 {
+		t.Errorf("qty change = %+v", d.Changes[1])
+	}
+
+	w := httptest.NewRecorder()
+	h.BOMDiff(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-MAIN/bom/diff", nil), "ASY-MAIN")
+	if w.Code != 400 {
+		t.Errorf("nothing to compare: expected 400, got %d", w.Code)
+	}
+}
+
+// gitRun runs git in dir with a fixed identity.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func setupGitBOM(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "add", ".")
+	gitRun(t, dir, "commit", "-q", "-m", "initial")
+	gitRun(t, dir, "tag", "rev-a")
+	// Working tree change inside a sub-assembly.
+	createBOMFile(t, dir, "PCA-SUB2", [][]string{
+		{"IPN", "qty", "ref"},
+		{"RES-001", "4", "R1-R4"},
+		{"IC-001", "1", "U1"},
+		{"CAP-001", "2", "C1,C2"},
+	})
+	return dir
+}
+
+func TestBOMDiff_GitRevisions(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	dir := setupGitBOM(t)
+	h := newTestHandler(testDB, dir)
+
+	d := getBOMDiff(t, h, "ASY-MAIN", "from=HEAD")
+	if got := changeSummary(d); got != "PCA-SUB2/CAP-001 added +C1,C2; PCA-SUB2/RES-001 changed +R4" {
+		t.Errorf("changes = %s", got)
+	}
+	if d.From.Rev != "HEAD" || d.To.Rev != "" {
+		t.Errorf("sides = %+v %+v", d.From, d.To)
+	}
+
+	gitRun(t, dir, "commit", "-q", "-am", "more caps")
+	if d := getBOMDiff(t, h, "ASY-MAIN", "from=rev-a&to=HEAD"); len(d.Changes) != 2 {
+		t.Errorf("rev-a..HEAD changes = %s", changeSummary(d))
+	}
+	if d := getBOMDiff(t, h, "ASY-MAIN", "from=HEAD"); len(d.Changes) != 0 {
+		t.Errorf("clean tree changes = %s", changeSummary(d))
+	}
+
+	for _, rev := range []string{"--output=x", "nope", "HEAD..rev-a"} {
+		w := httptest.NewRecorder()
+		h.BOMDiff(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-MAIN/bom/diff?from="+rev, nil), "ASY-MAIN")
+		if w.Code != 400 {
+			t.Errorf("from=%s: expected 400, got %d", rev, w.Code)
+		}
+	}
+}
+
+func TestECOBOMImpact(t *testing.T) {
+	db := setupCostingDB(t)
+	seedCosts(t, db)
+	dir := setupGitBOM(t)
+	h := newTestHandler(db, dir)
+
+	mustExec(t, db, `INSERT INTO ecos (id, title, affected_ipns) VALUES ('ECO-1', 'More caps', '["PCA-SUB2","RES-001"]')`)
+	mustExec(t, db, `INSERT INTO work_orders (id, assembly_ipn, qty, status) VALUES
+		('WO-1','ASY-MAIN',5,'open'), ('WO-2','PCA-SUB1',10,'in_progress'),
+		('WO-3','ASY-MAIN',1,'completed'), ('WO-4','PCA-SUB2',2,'draft')`)
+
+	w := httptest.NewRecorder()
+	h.ECOBOMImpact(w, httptest.NewRequest("GET", "/api/v1/ecos/ECO-1/bom-impact?method=last_po", nil), "ECO-1")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.ECOBOMImpact `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	impact := resp.Data
+
+	if len(impact.Items) != 2 || !impact.Items[0].Assembly || impact.Items[1].Assembly {
+		t.Fatalf("items = %+v", impact.Items)
+	}
+	sub := impact.Items[0]
+	if sub.Diff == nil || sub.Diff.Added != 1 || sub.Diff.Changed != 1 {
+		t.Fatalf("PCA-SUB2 diff = %+v (%s)", sub.Diff, sub.DiffError)
+	}
+	// One more RES-001 at 0.12; the added CAP-001 has no price.
+	if sub.CostDelta == nil || !near(*sub.CostDelta, 0.12) || !near(impact.TotalCostDelta, 0.12) {
+		t.Errorf("cost delta = %v, total %v", sub.CostDelta, impact.TotalCostDelta)
+	}
+	if strings.Join(sub.Missing, ",") != "CAP-001" {
+		t.Errorf("missing prices = %v", sub.Missing)
+	}
+
+	var wos []string
+	for _, wo := range impact.WorkOrders {
+		wos = append(wos, wo.ID+":"+strings.Join(wo.AffectedBy, ","))
+	}
+	if got := strings.Join(wos, " "); got != "WO-1:PCA-SUB2,RES-001 WO-2:RES-001 WO-4:PCA-SUB2,RES-001" {
+		t.Errorf("work orders = %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ECOBOMImpact(w, httptest.NewRequest("GET", "/api/v1/ecos/ECO-404/bom-impact", nil), "ECO-404")
+	if w.Code != 404 {
+		t.Errorf("missing ECO: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,241 @@
+package parts_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+)
+
+// setupImportParts writes resistor, capacitor and IC categories carrying
+// MPNs. Two ICs share an MPN.
+func setupImportParts(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"resistors.csv":  "IPN,description,mpn,manufacturer\nRES-001,10k 0603,RC0603FR-0710KL,Yageo\nRES-002,1k 0603,RC0603FR-071KL,Yageo\n",
+		"capacitors.csv": "IPN,description,mpn,manufacturer\nCAP-001,100n 0402,GRM155R71C104KA88D,Murata\n",
+		"ics.csv":        "IPN,description,mpn,manufacturer\nIC-001,LDO,AP2112K-3.3,Diodes\nIC-002,LDO (alt),AP2112K-3.3,Diodes\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func previewImport(t *testing.T, h *parts.Handler, ipn, filename, content string) parts.BOMImportPreview {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write([]byte(content))
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/v1/parts/"+ipn+"/bom/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.PreviewBOMImport(w, req, ipn)
+	if w.Code != 200 {
+		t.Fatalf("%s: expected 200, got %d: %s", filename, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.BOMImportPreview `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data
+}
+
+func importSummary(p parts.BOMImportPreview) string {
+	var out []string
+	for _, l := range p.Lines {
+		s := l.Status + ":" + l.IPN + " " + strings.Join(l.Refs, ",")
+		if l.SuggestedCategory != "" {
+			s += " ->" + l.SuggestedCategory
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, "; ")
+}
+
+const kicadCSV = `"Source:","/home/eda/board.kicad_sch"
+"Date:","2026-10-01"
+
+"Reference","Value","Footprint","Qty","DNP","MPN","Manufacturer"
+"R1,R2,R10","10k","R_0603","3","","RC0603FR-0710KL","Yageo"
+"R3","10k","R_0603","1","DNP","RC0603FR-0710KL","Yageo"
+"C1 C2","100n","C_0402","2","","GRM155R71C104KA88D","Murata"
+"U1","AP2112","SOT-23-5","1","","AP2112K-3.3","Diodes"
+"C3","10u","C_0805","1","","CL21A106KOQNNNE","Samsung"
+`
+
+func TestBOMImport_KiCadCSVPreview(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupImportParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	p := previewImport(t, h, "PCA-100", "board.csv", kicadCSV)
+	if p.Format != parts.EDAKiCadCSV {
+		t.Errorf("format = %s", p.Format)
+	}
+	want := "matched:CAP-001 C1,C2; unknown: C3 ->capacitors; matched:RES-001 R1,R2,R10; ambiguous: U1"
+	if got := importSummary(p); got != want {
+		t.Errorf("lines =\n  %s\nwant\n  %s", got, want)
+	}
+	if p.Matched != 2 || p.Unknown != 1 || p.Ambiguous != 1 || p.Ready {
+		t.Errorf("counts = %d/%d/%d ready=%v", p.Matched, p.Unknown, p.Ambiguous, p.Ready)
+	}
+	if strings.Join(p.DNP, ",") != "R3" {
+		t.Errorf("dnp = %v", p.DNP)
+	}
+	if c := p.Lines[3].Candidates; strings.Join(c, ",") != "IC-001,IC-002" {
+		t.Errorf("candidates = %v", c)
+	}
+	np := p.Lines[1].NewPart
+	if np == nil || np.Category != "capacitors" || np.Fields["mpn"] != "CL21A106KOQNNNE" || np.Fields["manufacturer"] != "Samsung" {
+		t.Errorf("new part = %+v", np)
+	}
+	if p.Exists || p.Path != "PCA-100.csv" || p.Diff != nil {
+		t.Errorf("path = %s exists=%v diff=%v", p.Path, p.Exists, p.Diff)
+	}
+	if !strings.Contains(p.CSV, "RES-001,3,\"R1,R2,R10\",10k 0603,RC0603FR-0710KL,Yageo\n") {
+		t.Errorf("csv =\n%s", p.CSV)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "PCA-100.csv")); !os.IsNotExist(err) {
+		t.Error("preview wrote the BOM file")
+	}
+}
+
+func TestBOMImport_KiCadXMLAndAltium(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupImportParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<export version="E">
+  <components>
+    <comp ref="R2"><value>10k</value><footprint>R_0603</footprint>
+      <fields><field name="MPN">RC0603FR-0710KL</field></fields></comp>
+    <comp ref="R1"><value>10k</value><footprint>R_0603</footprint>
+      <property name="MPN" value="RC0603FR-0710KL"/></comp>
+    <comp ref="R5"><value>1k</value><property name="MPN" value="RC0603FR-071KL"/><property name="dnp"/></comp>
+    <comp ref="C1"><value>100n</value><property name="IPN" value="CAP-001"/></comp>
+  </components>
+</export>`
+	p := previewImport(t, h, "PCA-200", "board.xml", xml)
+	if p.Format != parts.EDAKiCadXML || importSummary(p) != "matched:CAP-001 C1; matched:RES-001 R1,R2" {
+		t.Errorf("%s: %s", p.Format, importSummary(p))
+	}
+	if p.Lines[1].Qty != 2 || strings.Join(p.DNP, ",") != "R5" || !p.Ready {
+		t.Errorf("qty=%v dnp=%v ready=%v", p.Lines[1].Qty, p.DNP, p.Ready)
+	}
+
+	altium := "Comment\tDescription\tDesignator\tFootprint\tQuantity\tManufacturer 1\tManufacturer Part Number 1\tFitted\n" +
+		"1k\tRes\tR1, R2\t0603\t2\tYageo\tRC0603FR-071KL\tFitted\n" +
+		"100n\tCap\tC1-C3\t0402\t3\tMurata\tGRM155R71C104KA88D\tFitted\n" +
+		"10k\tRes\tR9\t0603\t1\tYageo\tRC0603FR-0710KL\tNot Fitted\n"
+	p = previewImport(t, h, "PCA-200", "board.txt", altium)
+	if p.Format != parts.EDAAltium || importSummary(p) != "matched:CAP-001 C1,C2,C3; matched:RES-002 R1,R2" {
+		t.Errorf("%s: %s", p.Format, importSummary(p))
+	}
+	if strings.Join(p.DNP, ",") != "R9" {
+		t.Errorf("dnp = %v", p.DNP)
+	}
+}
+
+func confirmImport(t *testing.T, h *parts.Handler, ipn, body string, want int) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ConfirmBOMImport(w, httptest.NewRequest("POST", "/api/v1/parts/"+ipn+"/bom/import/confirm", strings.NewReader(body)), ipn)
+	if w.Code != want {
+		t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func TestBOMImport_ConfirmWritesAndCreatesParts(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupImportParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	p := previewImport(t, h, "PCA-100", "board.csv", kicadCSV)
+	p.Lines[1].IPN = "CAP-010"
+	p.Lines[3].IPN = "IC-001"
+	lines, _ := json.Marshal(p.Lines)
+	newPart, _ := json.Marshal(parts.BOMImportNewPart{IPN: "CAP-010", Category: p.Lines[1].NewPart.Category, Fields: p.Lines[1].NewPart.Fields})
+
+	// Unknown IPNs must be created as part of the confirmation.
+	confirmImport(t, h, "PCA-100", `{"lines":`+string(lines)+`}`, 400)
+
+	// Someone else's reservation is theirs here too.
+	mustExec(t, db, `INSERT INTO ipn_reservations (ipn, category, seq, reserved_by) VALUES ('CAP-010','capacitors',10,'bob')`)
+	confirmImport(t, h, "PCA-100", `{"lines":`+string(lines)+`,"create_parts":[`+string(newPart)+`]}`, 409)
+	mustExec(t, db, `DELETE FROM ipn_reservations WHERE ipn='CAP-010'`)
+
+	data := confirmImport(t, h, "PCA-100", `{"lines":`+string(lines)+`,"create_parts":[`+string(newPart)+`]}`, 200)
+	if data["status"] != "written" || data["path"] != "PCA-100.csv" {
+		t.Errorf("response = %v", data)
+	}
+	caps, _ := os.ReadFile(filepath.Join(dir, "capacitors.csv"))
+	if !strings.Contains(string(caps), "CAP-010,,CL21A106KOQNNNE,Samsung") {
+		t.Errorf("capacitors.csv =\n%s", caps)
+	}
+	bom, _ := os.ReadFile(filepath.Join(dir, "PCA-100.csv"))
+	if !strings.Contains(string(bom), "CAP-010,1,C3,") || !strings.Contains(string(bom), "IC-001,1,U1,LDO,AP2112K-3.3,Diodes") {
+		t.Errorf("PCA-100.csv =\n%s", bom)
+	}
+
+	// Re-importing keeps the file's own columns and their values.
+	os.WriteFile(filepath.Join(dir, "PCA-100.csv"), []byte("IPN,qty,ref,attrition\nRES-001,3,\"R1,R2,R10\",5\nCAP-001,2,\"C1,C2\",\n"), 0644)
+	h.Catalog.Invalidate()
+	p = previewImport(t, h, "PCA-100", "board.csv", kicadCSV)
+	if !p.Exists || p.Diff == nil || p.Diff.Added != 1 {
+		t.Fatalf("diff = %+v", p.Diff)
+	}
+	if !strings.Contains(p.CSV, "IPN,qty,ref,attrition\n") || !strings.Contains(p.CSV, "RES-001,3,\"R1,R2,R10\",5\n") {
+		t.Errorf("csv =\n%s", p.CSV)
+	}
+}
+
+func TestBOMImport_ViaECO(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupImportParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	lines := `[{"ipn":"RES-001","qty":2,"refs":["R1","R2"]},{"ipn":"CAP-001","qty":1,"refs":["C1"]}]`
+	data := confirmImport(t, h, "PCA-300", `{"lines":`+lines+`,"via_eco":true,"eco_title":"New board BOM"}`, 202)
+	ecoID, _ := data["eco_id"].(string)
+	if data["status"] != "pending_eco" || ecoID == "" {
+		t.Fatalf("response = %v", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "PCA-300.csv")); !os.IsNotExist(err) {
+		t.Fatal("BOM written before the ECO was implemented")
+	}
+
+	if err := h.ApplyPartChangesForECO(ecoID); err != nil {
+		t.Fatal(err)
+	}
+	bom, _ := os.ReadFile(filepath.Join(dir, "PCA-300.csv"))
+	if want := "IPN,qty,ref,description,mpn,manufacturer\nRES-001,2,\"R1,R2\",10k 0603,,\nCAP-001,1,C1,100n 0402,,\n"; string(bom) != want {
+		t.Errorf("PCA-300.csv =\n%s\nwant\n%s", bom, want)
+	}
+	var status string
+	db.QueryRow("SELECT status FROM part_changes WHERE eco_id=?", ecoID).Scan(&status)
+	if status != "applied" {
+		t.Errorf("change status = %s", status)
+	}
+}
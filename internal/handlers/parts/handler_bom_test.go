@@ -0,0 +1,186 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+)
+
+// setupNestedBOM builds ASY-MAIN = 2x PCA-SUB1 + 1x PCA-SUB2 + 1x IC-002,
+// where both sub-assemblies use RES-001.
+func setupNestedBOM(t *testing.T, dir string) {
+	t.Helper()
+	setupBOMTestParts(t, dir)
+	createBOMFile(t, dir, "PCA-SUB1", [][]string{
+		{"IPN", "qty", "ref"},
+		{"RES-001", "2", "R1,R2"},
+		{"CAP-001", "1", "C1"},
+	})
+	createBOMFile(t, dir, "PCA-SUB2", [][]string{
+		{"IPN", "qty", "ref"},
+		{"RES-001", "3", "R1-R3"},
+		{"IC-001", "1", "U1"},
+	})
+	createBOMFile(t, dir, "ASY-MAIN", [][]string{
+		{"IPN", "qty", "ref"},
+		{"PCA-SUB1", "2", "A1,A2"},
+		{"PCA-SUB2", "1", "A3"},
+		{"IC-002", "1", "U1"},
+	})
+}
+
+func getBOMView(t *testing.T, h *parts.Handler, url, ipn string) parts.BOMView {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", url, nil), ipn)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.BOMView `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return resp.Data
+}
+
+func TestPartBOM_SummarizedExtendedQuantities(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(testDB, dir)
+
+	view := getBOMView(t, h, "/api/v1/parts/ASY-MAIN/bom?view=summarized&qty=10", "ASY-MAIN")
+	if view.BuildQty != 10 {
+		t.Errorf("build_qty = %v", view.BuildQty)
+	}
+	want := map[string][2]float64{ // qty per unit, extended qty
+		"RES-001": {7, 70},
+		"CAP-001": {2, 20},
+		"IC-001":  {1, 10},
+		"IC-002":  {1, 10},
+	}
+	if len(view.Lines) != len(want) {
+		t.Fatalf("lines = %+v", view.Lines)
+	}
+	for _, l := range view.Lines {
+		if w, ok := want[l.IPN]; !ok || l.Qty != w[0] || l.ExtQty != w[1] {
+			t.Errorf("%s: qty %v ext %v, want %v", l.IPN, l.Qty, l.ExtQty, w)
+		}
+	}
+	if view.Lines[len(view.Lines)-1].IPN != "RES-001" {
+		t.Errorf("lines should be sorted by IPN: %+v", view.Lines)
+	}
+	for _, l := range view.Lines {
+		if l.IPN == "RES-001" && strings.Join(l.UsedIn, ",") != "PCA-SUB1,PCA-SUB2" {
+			t.Errorf("RES-001 used_in = %v", l.UsedIn)
+		}
+	}
+}
+
+func TestPartBOM_Indented(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(testDB, dir)
+
+	view := getBOMView(t, h, "/api/v1/parts/ASY-MAIN/bom?view=indented&qty=5", "ASY-MAIN")
+	var got []string
+	for _, l := range view.Lines {
+		got = append(got, strings.Repeat(".", l.Level)+l.IPN)
+	}
+	want := "ASY-MAIN|.PCA-SUB1|..RES-001|..CAP-001|.PCA-SUB2|..RES-001|..IC-001|.IC-002"
+	if strings.Join(got, "|") != want {
+		t.Errorf("indented order = %v", got)
+	}
+	// RES-001 under PCA-SUB1: 2 per board x 2 boards x 5 builds.
+	if l := view.Lines[2]; l.IPN != "RES-001" || l.Qty != 2 || l.ExtQty != 20 {
+		t.Errorf("line 2 = %+v", l)
+	}
+	if !view.Lines[1].Assembly || view.Lines[2].Assembly {
+		t.Errorf("assembly flags wrong: %+v", view.Lines[:3])
+	}
+}
+
+func TestPartBOM_RejectsBadParams(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(testDB, dir)
+
+	for _, url := range []string{"/bom?qty=0", "/bom?qty=abc", "/bom?view=sideways"} {
+		w := httptest.NewRecorder()
+		h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-MAIN"+url, nil), "ASY-MAIN")
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", url, w.Code)
+		}
+	}
+}
+
+func TestBOMSettings_AssemblyDetection(t *testing.T) {
+	testDB := setupBOMCostTestDB(t)
+	defer testDB.Close()
+	if _, err := testDB.Exec(`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	setupBOMTestParts(t, dir)
+	// An assembly without the default PCA-/ASY- prefix.
+	createBOMFile(t, dir, "IC-002", [][]string{
+		{"IPN", "qty"},
+		{"RES-001", "4"},
+	})
+	h := newTestHandler(testDB, dir)
+
+	w := httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/IC-002/bom", nil), "IC-002")
+	if w.Code != 400 {
+		t.Fatalf("expected 400 before settings change, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "IPN prefixes PCA-, ASY-") {
+		t.Errorf("error should name the prefix rule: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.UpdateBOMSettings(w, httptest.NewRequest("PUT", "/api/v1/settings/bom",
+		strings.NewReader(`{"prefixes":["KIT-"],"bom_file":true}`)))
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var saved struct {
+		Data parts.AssemblyRules `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &saved)
+	if !saved.Data.BOMFile || len(saved.Data.Prefixes) != 1 || saved.Data.Prefixes[0] != "KIT-" {
+		t.Errorf("saved rules = %+v", saved.Data)
+	}
+
+	view := getBOMView(t, h, "/api/v1/parts/IC-002/bom?view=summarized", "IC-002")
+	if len(view.Lines) != 1 || view.Lines[0].IPN != "RES-001" || view.Lines[0].Qty != 4 {
+		t.Errorf("lines = %+v", view.Lines)
+	}
+
+	// Category rule: every part in z-components is an assembly.
+	h.UpdateBOMSettings(httptest.NewRecorder(), httptest.NewRequest("PUT", "/api/v1/settings/bom",
+		strings.NewReader(`{"prefixes":[],"categories":["z-components"]}`)))
+	w = httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/CAP-001/bom", nil), "CAP-001")
+	if w.Code != 200 {
+		t.Errorf("category rule: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/PCA-SUB1/bom", nil), "PCA-SUB1")
+	if w.Code != 400 {
+		t.Errorf("cleared prefixes: expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "categories z-components") || strings.Contains(w.Body.String(), "IPN prefixes") {
+		t.Errorf("error should name the category rule: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,314 @@
+package parts_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/database"
+	"zrp/internal/handlers/parts"
+)
+
+func setupCostingDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := database.RunMigrations(db, nil); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, q string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(q, args...); err != nil {
+		t.Fatalf("%s: %v", q, err)
+	}
+}
+
+// seedCosts prices RES-001 from every source. CAP-001 has no price at all.
+func seedCosts(t *testing.T, db *sql.DB) {
+	t.Helper()
+	mustExec(t, db, `INSERT INTO vendors (id, name, status) VALUES ('V1','Acme','active'), ('V2','Shady','blocked')`)
+	mustExec(t, db, `INSERT INTO purchase_orders (id, vendor_id, created_at) VALUES ('PO-1','V1','2026-01-01'), ('PO-2','V1','2026-03-01')`)
+	mustExec(t, db, `INSERT INTO po_lines (po_id, ipn, qty_ordered, qty_received, unit_price) VALUES
+		('PO-1','RES-001',100,100,0.10), ('PO-2','RES-001',300,300,0.12),
+		('PO-2','IC-001',10,0,2.00), ('PO-2','IC-002',10,10,3.00)`)
+	mustExec(t, db, `INSERT INTO rfqs (id, title) VALUES ('RFQ-1','Resistors')`)
+	mustExec(t, db, `INSERT INTO rfq_vendors (id, rfq_id, vendor_id) VALUES (1,'RFQ-1','V1'), (2,'RFQ-1','V2')`)
+	mustExec(t, db, `INSERT INTO rfq_lines (id, rfq_id, ipn, qty) VALUES (1,'RFQ-1','RES-001',1000)`)
+	mustExec(t, db, `INSERT INTO rfq_quotes (rfq_id, rfq_vendor_id, rfq_line_id, unit_price) VALUES ('RFQ-1',1,1,0.09), ('RFQ-1',2,1,0.05)`)
+	mustExec(t, db, `INSERT INTO market_pricing (part_ipn, mpn, distributor, price_breaks, fetched_at) VALUES
+		('RES-001','RC0603','Digikey','[{"qty":1,"unit_price":0.5},{"qty":100,"unit_price":0.2},{"qty":1000,"unit_price":0.1}]','2026-01-01'),
+		('RES-001','RC0603','Mouser','[{"qty":10,"unit_price":0.3}]','2026-01-01')`)
+}
+
+func getRollup(t *testing.T, h *parts.Handler, query string) parts.CostRollup {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.PartCostRollup(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-MAIN/cost/rollup?"+query, nil), "ASY-MAIN")
+	if w.Code != 200 {
+		t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.CostRollup `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data
+}
+
+func costLine(t *testing.T, roll parts.CostRollup, ipn string) parts.CostLine {
+	t.Helper()
+	for _, l := range roll.Lines {
+		if l.IPN == ipn {
+			return l
+		}
+	}
+	t.Fatalf("%s not in rollup %+v", ipn, roll.Lines)
+	return parts.CostLine{}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestCostRollup_Methods(t *testing.T) {
+	db := setupCostingDB(t)
+	seedCosts(t, db)
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(db, dir)
+
+	tests := []struct {
+		query string
+		price float64
+	}{
+		{"method=last_po", 0.12},
+		{"method=weighted_avg", 0.115},
+		{"method=vendor_quote", 0.09},  // the blocked vendor's quote is ignored
+		{"method=market&qty=1", 0.3},   // 7 needed: Mouser's first break beats Digikey's 0.5
+		{"method=market&qty=15", 0.2},  // 105: Digikey's 100 break beats Mouser
+		{"method=market&qty=200", 0.1}, // 1400: Digikey's 1000 break
+	}
+	for _, tt := range tests {
+		roll := getRollup(t, h, tt.query)
+		l := costLine(t, roll, "RES-001")
+		if l.UnitCost == nil || !near(*l.UnitCost, tt.price) {
+			t.Errorf("%s: RES-001 unit cost = %v, want %v (%s)", tt.query, l.UnitCost, tt.price, l.Source)
+		}
+	}
+
+	roll := getRollup(t, h, "method=last_po")
+	if roll.Complete || strings.Join(roll.Missing, ",") != "CAP-001" {
+		t.Errorf("missing = %v, complete = %v", roll.Missing, roll.Complete)
+	}
+	if l := costLine(t, roll, "CAP-001"); l.UnitCost != nil || l.ExtCost != 0 {
+		t.Errorf("unpriced line = %+v", l)
+	}
+	// 7 x 0.12 + 1 x 2.00 + 1 x 3.00
+	if !near(roll.TotalCost, 5.84) || !near(roll.UnitCost, 5.84) {
+		t.Errorf("total = %v, unit = %v", roll.TotalCost, roll.UnitCost)
+	}
+	if l := costLine(t, roll, "RES-001"); l.Source != "PO-2" {
+		t.Errorf("source = %q", l.Source)
+	}
+
+	// weighted_avg only counts received quantities; IC-001 was never received.
+	if roll := getRollup(t, h, "method=weighted_avg"); strings.Join(roll.Missing, ",") != "CAP-001,IC-001" {
+		t.Errorf("weighted_avg missing = %v", roll.Missing)
+	}
+
+	w := httptest.NewRecorder()
+	h.PartCostRollup(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-MAIN/cost/rollup?method=guess", nil), "ASY-MAIN")
+	if w.Code != 400 {
+		t.Errorf("unknown method: expected 400, got %d", w.Code)
+	}
+}
+
+func TestCostRollup_Attrition(t *testing.T) {
+	db := setupCostingDB(t)
+	seedCosts(t, db)
+	dir := t.TempDir()
+	setupBOMTestParts(t, dir)
+	createBOMFile(t, dir, "PCA-SUB1", [][]string{
+		{"IPN", "qty", "attrition"},
+		{"RES-001", "10", "5%"},
+		{"IC-001", "1", ""},
+	})
+	createBOMFile(t, dir, "ASY-MAIN", [][]string{
+		{"IPN", "qty", "scrap"},
+		{"PCA-SUB1", "2", "50"},
+	})
+	h := newTestHandler(db, dir)
+
+	roll := getRollup(t, h, "method=last_po&qty=10")
+	// 10 x 2 boards x 1.5 board scrap x 1.05 = 31.5 per unit, 315 for 10.
+	if l := costLine(t, roll, "RES-001"); !near(l.ExtQty, 200) || !near(l.BuyQty, 315) || !near(l.AttritionPct, 57.5) {
+		t.Errorf("RES-001 = %+v", l)
+	}
+	if l := costLine(t, roll, "IC-001"); !near(l.BuyQty, 30) {
+		t.Errorf("IC-001 = %+v", l)
+	}
+
+	w := httptest.NewRecorder()
+	h.UpdateBOMSettings(w, httptest.NewRequest("PUT", "/api/v1/settings/bom",
+		strings.NewReader(`{"prefixes":["PCA-","ASY-"],"default_attrition_pct":10,"cost_method":"weighted_avg"}`)))
+	if w.Code != 200 {
+		t.Fatalf("settings: %d %s", w.Code, w.Body.String())
+	}
+	roll = getRollup(t, h, "qty=10")
+	if roll.Method != "weighted_avg" {
+		t.Errorf("default method = %q", roll.Method)
+	}
+	// The explicit 5% still wins over the default; IC-001 picks up 10%.
+	if l := costLine(t, roll, "RES-001"); !near(l.BuyQty, 315) {
+		t.Errorf("RES-001 = %+v", l)
+	}
+	if l := costLine(t, roll, "IC-001"); !near(l.BuyQty, 33) {
+		t.Errorf("IC-001 = %+v", l)
+	}
+
+	w = httptest.NewRecorder()
+	h.UpdateBOMSettings(w, httptest.NewRequest("PUT", "/api/v1/settings/bom", strings.NewReader(`{"cost_method":"cheapest"}`)))
+	if w.Code != 400 {
+		t.Errorf("bad cost_method: expected 400, got %d", w.Code)
+	}
+}
+
+func createRoll(t *testing.T, h *parts.Handler, body string) parts.CostRoll {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.CreateCostRoll(w, httptest.NewRequest("POST", "/api/v1/cost-rolls", strings.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.CostRoll `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func TestCostRolls_FreezeRace(t *testing.T) {
+	db := setupCostingDB(t)
+	seedCosts(t, db)
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(db, dir)
+
+	mine := createRoll(t, h, `{"assembly_ipn":"ASY-MAIN","period":"2026-Q4","method":"last_po"}`)
+	other := createRoll(t, h, `{"assembly_ipn":"ASY-MAIN","period":"2026-Q4","method":"weighted_avg"}`)
+	// Another request freezes the sibling roll after this one's checks.
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TRIGGER race BEFORE UPDATE OF status ON cost_rolls
+		WHEN NEW.id = %d BEGIN UPDATE cost_rolls SET status='frozen' WHERE id = %d; END`, mine.ID, other.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	id := fmt.Sprint(mine.ID)
+	w := httptest.NewRecorder()
+	h.FreezeCostRoll(w, httptest.NewRequest("POST", "/api/v1/cost-rolls/"+id+"/freeze", strings.NewReader(`{"allow_missing":true}`)), id)
+	if w.Code != 409 {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var status string
+	db.QueryRow("SELECT status FROM cost_rolls WHERE id=?", mine.ID).Scan(&status)
+	if status != "draft" {
+		t.Errorf("roll status = %q, want draft", status)
+	}
+}
+
+func TestCostRolls_FreezeAndVariance(t *testing.T) {
+	db := setupCostingDB(t)
+	seedCosts(t, db)
+	dir := t.TempDir()
+	setupNestedBOM(t, dir)
+	h := newTestHandler(db, dir)
+
+	roll := createRoll(t, h, `{"assembly_ipn":"ASY-MAIN","period":"2026-Q4","method":"last_po"}`)
+	if roll.Status != "draft" || roll.MissingCount != 1 || len(roll.Lines) != 4 || !near(roll.UnitCost, 5.84) {
+		t.Fatalf("roll = %+v", roll)
+	}
+	id := fmt.Sprint(roll.ID)
+
+	freeze := func(id, body string) int {
+		w := httptest.NewRecorder()
+		h.FreezeCostRoll(w, httptest.NewRequest("POST", "/api/v1/cost-rolls/"+id+"/freeze", strings.NewReader(body)), id)
+		return w.Code
+	}
+	if code := freeze(id, ""); code != 409 {
+		t.Errorf("freezing with a missing price: expected 409, got %d", code)
+	}
+	if code := freeze(id, `{"allow_missing":true}`); code != 200 {
+		t.Fatalf("freeze: expected 200, got %d", code)
+	}
+	if code := freeze(id, `{"allow_missing":true}`); code != 409 {
+		t.Errorf("refreeze: expected 409, got %d", code)
+	}
+	other := createRoll(t, h, `{"assembly_ipn":"ASY-MAIN","period":"2026-Q4","method":"weighted_avg"}`)
+	if code := freeze(fmt.Sprint(other.ID), `{"allow_missing":true}`); code != 409 {
+		t.Errorf("second frozen roll for the period: expected 409, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	h.DeleteCostRoll(w, httptest.NewRequest("DELETE", "/api/v1/cost-rolls/"+id, nil), id)
+	if w.Code != 409 {
+		t.Errorf("deleting a frozen roll: expected 409, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.DeleteCostRoll(w, httptest.NewRequest("DELETE", "/", nil), fmt.Sprint(other.ID))
+	if w.Code != 200 {
+		t.Errorf("deleting a draft roll: expected 200, got %d", w.Code)
+	}
+
+	// The standard method now prices from the frozen roll of the current
+	// costing period.
+	db.Exec("INSERT INTO app_settings (key, value) VALUES ('bom_cost_period', '2026-Q4')")
+	std := getRollup(t, h, "method=standard")
+	if l := costLine(t, std, "RES-001"); l.UnitCost == nil || !near(*l.UnitCost, 0.12) || !strings.Contains(l.Source, "2026-Q4") {
+		t.Errorf("standard RES-001 = %+v", l)
+	}
+	// A roll frozen for another period is not the standard.
+	db.Exec("UPDATE app_settings SET value='2027-Q1' WHERE key='bom_cost_period'")
+	if l := costLine(t, getRollup(t, h, "method=standard"), "RES-001"); l.UnitCost != nil {
+		t.Errorf("standard RES-001 outside the roll's period = %+v", l)
+	}
+	db.Exec("UPDATE app_settings SET value='2026-Q4' WHERE key='bom_cost_period'")
+
+	// Receipts came in cheaper than the last PO price.
+	w = httptest.NewRecorder()
+	h.CostRollVariance(w, httptest.NewRequest("GET", "/api/v1/cost-rolls/"+id+"/variance", nil), id)
+	if w.Code != 200 {
+		t.Fatalf("variance: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.CostVariance `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	v := resp.Data
+	if v.ActualMethod != "weighted_avg" || !near(v.StdUnitCost, 5.84) {
+		t.Errorf("variance = %+v", v)
+	}
+	for _, l := range v.Lines {
+		if l.IPN == "RES-001" && (!near(l.StdCost, 0.84) || !near(l.ActualCost, 0.805) || !near(l.Variance, -0.035)) {
+			t.Errorf("RES-001 variance = %+v", l)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ListCostRolls(w, httptest.NewRequest("GET", "/api/v1/cost-rolls?status=frozen", nil))
+	var list struct {
+		Data []parts.CostRoll `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].ID != roll.ID || list.Data[0].FrozenAt == nil {
+		t.Errorf("frozen rolls = %+v", list.Data)
+	}
+}
@@ -0,0 +1,299 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+	"zrp/internal/models"
+)
+
+// setupSchemeParts writes z-cap.csv with two IPNs that match the
+// "CAP-" + 4 digits + Luhn scheme and two that do not.
+func setupSchemeParts(t *testing.T, dir string) {
+	t.Helper()
+	caps := "IPN,description\nCAP-00018,100n\nCAP-00026,10u\nCAP-00031,1u\nC-10U,10u 0805\n"
+	if err := os.WriteFile(filepath.Join(dir, "z-cap.csv"), []byte(caps), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putScheme(t *testing.T, h *parts.Handler, cat, body string, want int) parts.IPNScheme {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.UpdateIPNScheme(w, httptest.NewRequest("PUT", "/api/v1/categories/"+cat+"/ipn-scheme", strings.NewReader(body)), cat)
+	if w.Code != want {
+		t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.IPNScheme `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func reserveIPN(t *testing.T, h *parts.Handler, cat, body string) parts.IPNReservation {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/"+cat+"/ipn-scheme/reserve", strings.NewReader(body)), cat)
+	if w.Code != 201 {
+		t.Fatalf("reserve: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.IPNReservation `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func TestIPNScheme_ReserveAndSuffixes(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	putScheme(t, h, "z-cap", `{"prefix":"CAP 1","digits":4}`, 400)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","checksum":"crc"}`, 400)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":2,"next_seq":100}`, 400)
+	putScheme(t, h, "z-nope", `{"prefix":"X-"}`, 404)
+
+	// Numbering continues after CAP-00026; CAP-00031 has a bad check digit
+	// and does not count.
+	s := putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn"}`, 200)
+	if s.NextSeq != 3 || s.Example != "CAP-00034" {
+		t.Fatalf("scheme = %+v", s)
+	}
+	if r := reserveIPN(t, h, "z-cap", ""); r.IPN != "CAP-00034" || r.Seq != 3 || r.Status != "reserved" {
+		t.Errorf("first reservation = %+v", r)
+	}
+	if r := reserveIPN(t, h, "z-cap", ""); r.IPN != "CAP-00042" {
+		t.Errorf("second reservation = %+v", r)
+	}
+
+	// Revision suffixes; next_seq set by hand skips numbers already taken.
+	s = putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn","suffix":"revision","next_seq":2}`, 200)
+	if s.SuffixSep != "-" || s.Example != "CAP-00026-A" {
+		t.Fatalf("scheme = %+v", s)
+	}
+	if r := reserveIPN(t, h, "z-cap", `{"suffix":"C"}`); r.IPN != "CAP-00059-C" {
+		t.Errorf("revision reservation = %+v", r)
+	}
+	w := httptest.NewRecorder()
+	h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/z-cap/ipn-scheme/reserve", strings.NewReader(`{"suffix":"c1"}`)), "z-cap")
+	if w.Code != 400 {
+		t.Errorf("bad suffix: expected 400, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/z-other/ipn-scheme/reserve", nil), "z-other")
+	if w.Code != 404 {
+		t.Errorf("no scheme: expected 404, got %d", w.Code)
+	}
+}
+
+func TestIPNScheme_ConcurrentReservations(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn"}`, 200)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	got := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/z-cap/ipn-scheme/reserve", nil), "z-cap")
+			var resp struct {
+				Data parts.IPNReservation `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != 201 {
+				t.Errorf("reserve: expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+			mu.Lock()
+			got[resp.Data.IPN] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(got) != 10 {
+		t.Errorf("got %d distinct IPNs: %v", len(got), got)
+	}
+	var next int
+	db.QueryRow("SELECT next_seq FROM ipn_schemes WHERE category='z-cap'").Scan(&next)
+	if next != 13 {
+		t.Errorf("next_seq = %d", next)
+	}
+}
+
+func TestIPNScheme_ReserveGivesUp(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4}`, 200)
+	if _, err := db.Exec(`CREATE TRIGGER block_reservations BEFORE INSERT ON ipn_reservations
+		BEGIN SELECT RAISE(ABORT, 'locked'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/z-cap/ipn-scheme/reserve", nil), "z-cap")
+	if w.Code != 503 {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	var next int
+	db.QueryRow("SELECT next_seq FROM ipn_schemes WHERE category='z-cap'").Scan(&next)
+	if next != 1 {
+		t.Errorf("next_seq = %d after failed reservation", next)
+	}
+}
+
+func TestIPNScheme_CreatePartAndValidation(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn","enforce":true}`, 200)
+
+	create := func(body string, want int) map[string]interface{} {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.CreatePart(w, httptest.NewRequest("POST", "/api/v1/parts", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+
+	// No IPN: the scheme picks one.
+	if data := create(`{"category":"z-cap","fields":{"description":"4u7"}}`, 200); data["ipn"] != "CAP-00034" {
+		t.Errorf("generated part = %v", data)
+	}
+	create(`{"category":"z-cap","ipn":"CAP-00041"}`, 400)
+	create(`{"category":"z-cap","ipn":"CAP-0004"}`, 400)
+	create(`{"category":"z-cap","ipn":"CAP-00042"}`, 200)
+
+	// Someone else's reservation is theirs.
+	mustExec(t, db, `INSERT INTO ipn_reservations (ipn, category, seq, reserved_by) VALUES ('CAP-00059','z-cap',5,'bob')`)
+	create(`{"category":"z-cap","ipn":"CAP-00059"}`, 409)
+
+	var status string
+	db.QueryRow("SELECT status FROM ipn_reservations WHERE ipn='CAP-00034'").Scan(&status)
+	if status != "used" {
+		t.Errorf("reservation status = %s", status)
+	}
+
+	check := func(query string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		h.CheckIPN(w, httptest.NewRequest("GET", "/api/v1/parts/check-ipn?"+query, nil))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+	if d := check("ipn=CAP-00041"); d["valid"] != false || d["problem"] != "check digit should be 2" || d["category"] != "z-cap" {
+		t.Errorf("check CAP-00041 = %v", d)
+	}
+	if d := check("ipn=CAP-00059&category=z-cap"); d["valid"] != true || d["reserved"] != true || d["exists"] != false {
+		t.Errorf("check CAP-00059 = %v", d)
+	}
+	if d := check("ipn=RES-1"); len(d) != 1 {
+		t.Errorf("check without scheme = %v", d)
+	}
+}
+
+func TestIPNScheme_CreatePartReleasesReservation(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn"}`, 200)
+
+	// Another writer adds the reserved IPN before this part is written.
+	load := h.LoadPartsFromDir
+	h.LoadPartsFromDir = func() (map[string][]models.Part, map[string][]string, map[string]string, error) {
+		cats, schemas, titles, err := load()
+		cats["z-cap"] = append(cats["z-cap"], models.Part{IPN: "CAP-00034"})
+		return cats, schemas, titles, err
+	}
+	w := httptest.NewRecorder()
+	h.CreatePart(w, httptest.NewRequest("POST", "/api/v1/parts", strings.NewReader(`{"category":"z-cap"}`)))
+	if w.Code != 409 {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var n, next int
+	db.QueryRow("SELECT COUNT(*) FROM ipn_reservations").Scan(&n)
+	db.QueryRow("SELECT next_seq FROM ipn_schemes WHERE category='z-cap'").Scan(&next)
+	if n != 0 || next != 3 {
+		t.Errorf("after failed create: %d reservations, next_seq %d", n, next)
+	}
+
+	h.LoadPartsFromDir = load
+	w = httptest.NewRecorder()
+	h.CreatePart(w, httptest.NewRequest("POST", "/api/v1/parts", strings.NewReader(`{"category":"z-cap"}`)))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "CAP-00034") {
+		t.Errorf("retry: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIPNScheme_SequenceExhausted(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":1}`, 200)
+	mustExec(t, db, "UPDATE ipn_schemes SET next_seq=10 WHERE category='z-cap'")
+
+	w := httptest.NewRecorder()
+	h.ReserveIPN(w, httptest.NewRequest("POST", "/api/v1/categories/z-cap/ipn-scheme/reserve", nil), "z-cap")
+	if w.Code != 422 {
+		t.Errorf("reserve: expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.CreatePart(w, httptest.NewRequest("POST", "/api/v1/parts", strings.NewReader(`{"category":"z-cap"}`)))
+	if w.Code != 422 {
+		t.Errorf("create: expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIPNScheme_Report(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupSchemeParts(t, dir)
+	h := newTestHandler(db, dir)
+	putScheme(t, h, "z-cap", `{"prefix":"CAP-","digits":4,"checksum":"luhn"}`, 200)
+
+	w := httptest.NewRecorder()
+	h.IPNSchemeReport(w, httptest.NewRequest("GET", "/api/v1/categories/ipn-schemes/report", nil))
+	var resp struct {
+		Data parts.IPNSchemeReport `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	rep := resp.Data
+	if rep.Categories != 1 || rep.Checked != 4 || rep.Conforming != 2 || len(rep.Nonconforming) != 2 {
+		t.Fatalf("report = %+v", rep)
+	}
+	want := []parts.IPNSchemeIssue{
+		{IPN: "C-10U", Category: "z-cap", Problem: `should start with "CAP-"`, Suggested: "CAP-00034"},
+		{IPN: "CAP-00031", Category: "z-cap", Problem: "check digit should be 4", Suggested: "CAP-00042"},
+	}
+	for i, issue := range rep.Nonconforming {
+		if issue != want[i] {
+			t.Errorf("issue %d = %+v, want %+v", i, issue, want[i])
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+)
+
+// setupLifecycleParts is the nested BOM with owners on the assemblies.
+// PCA-SUB2 has none.
+func setupLifecycleParts(t *testing.T, dir string) {
+	t.Helper()
+	setupNestedBOM(t, dir)
+	asm := "IPN,description,owner\nASY-MAIN,Main unit,alice\nPCA-SUB1,Power board,bob\nPCA-SUB2,Controller,\n"
+	if err := os.WriteFile(filepath.Join(dir, "assemblies.csv"), []byte(asm), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setLifecycle(t *testing.T, h *parts.Handler, ipn, body string, want int) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.SetPartLifecycle(w, httptest.NewRequest("POST", "/api/v1/parts/"+ipn+"/lifecycle", strings.NewReader(body)), ipn)
+	if w.Code != want {
+		t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+func getLifecycleImpact(t *testing.T, h *parts.Handler, ipn string) parts.LifecycleImpact {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.PartLifecycleImpact(w, httptest.NewRequest("GET", "/api/v1/parts/"+ipn+"/lifecycle/impact", nil), ipn)
+	var resp struct {
+		Data parts.LifecycleImpact `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data
+}
+
+func TestPartLifecycle_Transitions(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupLifecycleParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	setLifecycle(t, h, "RES-001", `{"state":"bogus"}`, 400)
+	setLifecycle(t, h, "NOPE-1", `{"state":"nrnd"}`, 404)
+	setLifecycle(t, h, "RES-002", `{"state":"prototype"}`, 409)
+
+	data := setLifecycle(t, h, "RES-002", `{"state":"NRND","reason":"PCN-1"}`, 200)
+	if data["from"] != "active" || data["lifecycle"] != "nrnd" {
+		t.Errorf("response = %v", data)
+	}
+	setLifecycle(t, h, "RES-002", `{"state":"last_time_buy"}`, 200)
+	setLifecycle(t, h, "RES-002", `{"state":"active"}`, 409)
+	setLifecycle(t, h, "RES-002", `{"state":"obsolete"}`, 200)
+	setLifecycle(t, h, "RES-002", `{"state":"last_time_buy"}`, 409)
+
+	w := httptest.NewRecorder()
+	h.GetPartLifecycle(w, httptest.NewRequest("GET", "/api/v1/parts/RES-002/lifecycle", nil), "RES-002")
+	var resp struct {
+		Data parts.PartLifecycleInfo `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	info := resp.Data
+	if info.Lifecycle != "obsolete" || len(info.Allowed) != 0 || len(info.History) != 3 {
+		t.Fatalf("info = %+v", info)
+	}
+	if h := info.History[2]; h.From != "active" || h.To != "nrnd" || h.Reason != "PCN-1" {
+		t.Errorf("first change = %+v", h)
+	}
+}
+
+func TestPartLifecycle_ImpactAndNotifications(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupLifecycleParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	mustExec(t, db, `INSERT INTO work_orders (id, assembly_ipn, qty, status) VALUES
+		('WO-1','ASY-MAIN',5,'open'), ('WO-2','PCA-SUB1',10,'in_progress'), ('WO-3','ASY-MAIN',1,'completed')`)
+	mustExec(t, db, `INSERT INTO sales_orders (id, customer, status) VALUES
+		('SO-1','Acme','confirmed'), ('SO-2','Acme','shipped'), ('SO-3','Initech','draft')`)
+	mustExec(t, db, `INSERT INTO sales_order_lines (sales_order_id, ipn, qty) VALUES
+		('SO-1','ASY-MAIN',2), ('SO-2','ASY-MAIN',1), ('SO-3','PCA-SUB1',4), ('SO-3','IC-001',10)`)
+
+	impact := getLifecycleImpact(t, h, "IC-001")
+	var asms []string
+	for _, a := range impact.Assemblies {
+		asms = append(asms, a.IPN+":"+a.Owner)
+	}
+	if got := strings.Join(asms, " "); got != "ASY-MAIN:alice PCA-SUB2:" {
+		t.Fatalf("assemblies = %s", got)
+	}
+	if a := impact.Assemblies[1]; !a.Direct || a.Qty != 1 || impact.Assemblies[0].Direct {
+		t.Errorf("assemblies = %+v", impact.Assemblies)
+	}
+	if len(impact.WorkOrders) != 1 || impact.WorkOrders[0].ID != "WO-1" {
+		t.Errorf("work orders = %+v", impact.WorkOrders)
+	}
+	var sos []string
+	for _, so := range impact.SalesOrders {
+		sos = append(sos, so.ID+":"+strings.Join(so.AffectedBy, ","))
+	}
+	if got := strings.Join(sos, " "); got != "SO-1:ASY-MAIN SO-3:IC-001" {
+		t.Errorf("sales orders = %s", got)
+	}
+
+	// RES-001 is in both sub-assemblies: 2*2 + 3 per ASY-MAIN.
+	impact = getLifecycleImpact(t, h, "RES-001")
+	if len(impact.Assemblies) != 3 || impact.Assemblies[0].Qty != 7 || len(impact.WorkOrders) != 2 {
+		t.Errorf("RES-001 impact = %+v", impact)
+	}
+
+	data := setLifecycle(t, h, "RES-001", `{"state":"obsolete","reason":"Vendor EOL"}`, 200)
+	if n, _ := data["notified"].([]interface{}); len(n) != 2 || n[0] != "alice" || n[1] != "bob" {
+		t.Errorf("notified = %v", data["notified"])
+	}
+	rows, _ := db.Query(`SELECT user_id, severity, title, message FROM notifications WHERE type='part_lifecycle' ORDER BY id`)
+	var got []string
+	for rows.Next() {
+		var user, sev, title, msg string
+		rows.Scan(&user, &sev, &title, &msg)
+		got = append(got, user+"|"+sev+"|"+title+"|"+msg)
+	}
+	rows.Close()
+	want := []string{
+		"alice|error|RES-001 is now obsolete|Used in ASY-MAIN; 2 open work order(s); 2 open sales order(s). Vendor EOL",
+		"bob|error|RES-001 is now obsolete|Used in PCA-SUB1; 2 open work order(s); 2 open sales order(s). Vendor EOL",
+		"|error|RES-001 is now obsolete|Used in PCA-SUB2; 2 open work order(s); 2 open sales order(s). Vendor EOL",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("notifications =\n%s", strings.Join(got, "\n"))
+	}
+
+	// notify:false skips the notifications; moving back to a safer state
+	// has no impact at all.
+	data = setLifecycle(t, h, "IC-002", `{"state":"nrnd","notify":false}`, 200)
+	if _, ok := data["notified"]; ok {
+		t.Errorf("notify false: %v", data)
+	}
+	data = setLifecycle(t, h, "IC-002", `{"state":"active"}`, 200)
+	if _, ok := data["impact"]; ok {
+		t.Errorf("nrnd -> active returned impact: %v", data)
+	}
+}
+
+func TestObsolescence_ManualAndScan(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupLifecycleParts(t, dir)
+	h := newTestHandler(db, dir)
+
+	w := httptest.NewRecorder()
+	h.UpdateObsolescence(w, httptest.NewRequest("PUT", "/api/v1/parts/IC-001/obsolescence",
+		strings.NewReader(`{"status":"Last Time Buy","ltb_date":"2027-03-31","replacement_ipn":"IC-002"}`)), "IC-001")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{`{"status":"soon"}`, `{"ltb_date":"31/03/2027"}`, `{"replacement_ipn":"NOPE-1"}`} {
+		w = httptest.NewRecorder()
+		h.UpdateObsolescence(w, httptest.NewRequest("PUT", "/api/v1/parts/IC-001/obsolescence", strings.NewReader(body)), "IC-001")
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	mustExec(t, db, `INSERT INTO market_pricing (part_ipn, mpn, distributor, lifecycle_status, fetched_at) VALUES
+		('IC-001','LM358','digikey','Obsolete','2026-10-01'), ('RES-001','R1','digikey','Active','2026-10-01'),
+		('RES-002','R2','mouser','Not Recommended for New Designs','2026-10-01'), ('RES-002','R2','digikey','Active','2026-10-01')`)
+
+	scan := func(query string) []parts.ObsolescenceAlert {
+		w := httptest.NewRecorder()
+		h.ScanObsolescence(w, httptest.NewRequest("POST", "/api/v1/parts/obsolescence/scan"+query, nil))
+		var resp struct {
+			Data struct {
+				Scanned int                       `json:"scanned"`
+				Alerts  []parts.ObsolescenceAlert `json:"alerts"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Data.Scanned != 3 {
+			t.Errorf("scanned = %d", resp.Data.Scanned)
+		}
+		return resp.Data.Alerts
+	}
+	alerts := scan("")
+	if len(alerts) != 2 || alerts[0].IPN != "IC-001" || alerts[0].Reported != "obsolete" ||
+		alerts[1].IPN != "RES-002" || alerts[1].Reported != "nrnd" || alerts[1].Source != "mouser" || alerts[1].Applied {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	// The manual entry for IC-001 is kept; RES-002 takes the distributor's.
+	var status, source string
+	db.QueryRow("SELECT status, source FROM part_obsolescence WHERE ipn='IC-001'").Scan(&status, &source)
+	if status != "last_time_buy" || source != "manual" {
+		t.Errorf("IC-001 obsolescence = %s/%s", status, source)
+	}
+	db.QueryRow("SELECT status, source FROM part_obsolescence WHERE ipn='RES-002'").Scan(&status, &source)
+	if status != "nrnd" || source != "mouser" {
+		t.Errorf("RES-002 obsolescence = %s/%s", status, source)
+	}
+
+	if alerts = scan("?apply=true"); len(alerts) != 2 || !alerts[0].Applied || !alerts[1].Applied {
+		t.Fatalf("applied alerts = %+v", alerts)
+	}
+	if alerts = scan(""); len(alerts) != 0 {
+		t.Errorf("alerts after apply = %+v", alerts)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM notifications WHERE type='part_lifecycle' AND record_id='IC-001'").Scan(&n)
+	if n != 2 {
+		t.Errorf("IC-001 notifications = %d", n)
+	}
+}
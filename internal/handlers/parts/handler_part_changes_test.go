@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"zrp/internal/handlers/parts"
@@ -412,3 +414,110 @@ func TestListAllPartChanges(t *testing.T) {
 		t.Errorf("expected 1 change, got %d", len(changes))
 	}
 }
+
+func TestUpdateReleasedPartRoutesThroughECO(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "z-res.csv")
+	original := "# TITLE: Resistors\nIPN,description,status\nRES-001,10k Resistor,released\nRES-002,1k Resistor,draft\n"
+	os.WriteFile(csvPath, []byte(original), 0644)
+	testDB.Exec("INSERT INTO app_settings (key, value) VALUES ('parts_require_eco_for_released', 'true')")
+	cookie := testutil.LoginAdmin(t, testDB)
+	h := newTestHandler(testDB, dir)
+
+	req := testutil.AuthedRequest("PUT", "/api/v1/parts/RES-001", []byte(`{"fields":{"description":"10k 1% Resistor"}}`), cookie)
+	w := httptest.NewRecorder()
+	h.UpdatePart(w, req, "RES-001")
+	if w.Code != 202 {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := os.ReadFile(csvPath); string(got) != original {
+		t.Fatalf("released part was written directly:\n%s", got)
+	}
+	var resp struct {
+		Data struct {
+			ECOID   string             `json:"eco_id"`
+			Changes []parts.PartChange `json:"changes"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Data.ECOID == "" || len(resp.Data.Changes) != 1 || resp.Data.Changes[0].Status != "pending" {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	// Unreleased parts are still written directly.
+	req = testutil.AuthedRequest("PUT", "/api/v1/parts/RES-002", []byte(`{"fields":{"description":"1k 1% Resistor"}}`), cookie)
+	w = httptest.NewRecorder()
+	h.UpdatePart(w, req, "RES-002")
+	if w.Code != 200 {
+		t.Fatalf("expected 200 for draft part, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Deleting the released part is queued on an ECO too.
+	w = httptest.NewRecorder()
+	h.DeletePart(w, testutil.AuthedRequest("DELETE", "/api/v1/parts/RES-001", nil, cookie), "RES-001")
+	if w.Code != 202 {
+		t.Fatalf("expected 202 for delete, got %d: %s", w.Code, w.Body.String())
+	}
+	var del struct {
+		Data struct {
+			ECOID string `json:"eco_id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &del)
+
+	// Implementing the ECOs applies the edit, then the delete.
+	if err := h.ApplyPartChangesForECO(resp.Data.ECOID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(csvPath)
+	want := "# TITLE: Resistors\nIPN,description,status\nRES-001,10k 1% Resistor,released\nRES-002,1k 1% Resistor,draft\n"
+	if string(got) != want {
+		t.Fatalf("after ECO:\n%s\nwant:\n%s", got, want)
+	}
+	if err := h.ApplyPartChangesForECO(del.Data.ECOID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = os.ReadFile(csvPath)
+	if want := "# TITLE: Resistors\nIPN,description,status\nRES-002,1k 1% Resistor,draft\n"; string(got) != want {
+		t.Fatalf("after delete ECO:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConcurrentPartUpdatesDoNotLoseWrites(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "z-res.csv")
+	var b strings.Builder
+	b.WriteString("IPN,description\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, "RES-%03d,old\n", i)
+	}
+	os.WriteFile(csvPath, []byte(b.String()), 0644)
+	h := newTestHandler(testDB, dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ipn := fmt.Sprintf("RES-%03d", i)
+			w := httptest.NewRecorder()
+			h.UpdatePart(w, httptest.NewRequest("PUT", "/api/v1/parts/"+ipn, strings.NewReader(`{"fields":{"description":"new"}}`)), ipn)
+			if w.Code != 200 {
+				t.Errorf("%s: got %d: %s", ipn, w.Code, w.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, _ := os.ReadFile(csvPath)
+	if n := strings.Count(string(got), ",new\n"); n != 20 {
+		t.Fatalf("expected 20 updated rows, got %d:\n%s", n, got)
+	}
+	if _, err := os.Stat(csvPath + ".lock"); !os.IsNotExist(err) {
+		t.Error("lock file left behind")
+	}
+}
@@ -98,6 +98,8 @@ func setupPartsTestDB(t *testing.T) *sql.DB {
 			username TEXT DEFAULT '',
 			summary TEXT DEFAULT '',
 			changes TEXT DEFAULT '{}',
+			before_value TEXT,
+			after_value TEXT,
 			ip_address TEXT DEFAULT '',
 			user_agent TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
@@ -815,16 +817,18 @@ func TestHandleUpdatePart(t *testing.T) {
 	tmpDir := t.TempDir()
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
-	csvContent := "IPN,description,status\nR-001,Original description,active\n"
-	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
+	csvContent := "# TITLE: Resistors\nIPN,description,status\nR-001,Original description,active\n\"R-002\",\"Keep, quoted\",active\n"
+	csvPath := filepath.Join(catDir, "test.csv")
+	os.WriteFile(csvPath, []byte(csvContent), 0644)
 
-	h := newTestHandler(nil, tmpDir)
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
 
 	updateBody := map[string]interface{}{
 		"fields": map[string]string{
-			"description": "Updated description",
+			"description": "Updated, description",
 			"status":      "obsolete",
-			"new_field":   "new value",
 		},
 	}
 
@@ -834,8 +838,46 @@ func TestHandleUpdatePart(t *testing.T) {
 	rr := httptest.NewRecorder()
 	h.UpdatePart(rr, req, "R-001")
 
-	if rr.Code != http.StatusNotImplemented {
-		t.Errorf("Expected status 501, got %d. Body: %s", rr.Code, rr.Body.String())
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	got, _ := os.ReadFile(csvPath)
+	want := "# TITLE: Resistors\nIPN,description,status\nR-001,\"Updated, description\",obsolete\n\"R-002\",\"Keep, quoted\",active\n"
+	if string(got) != want {
+		t.Errorf("CSV after update:\n%s\nwant:\n%s", got, want)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE module='part' AND record_id='R-001'").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 audit entry, got %d", count)
+	}
+}
+
+func TestHandleUpdatePart_RejectsUnknownFieldAndIPNChange(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "z-res.csv"), []byte("IPN,description\nR-001,Original\n"), 0644)
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
+
+	for _, body := range []string{
+		`{"fields":{"new_field":"x"}}`,
+		`{"fields":{"IPN":"R-999"}}`,
+		`{"fields":{}}`,
+	} {
+		rr := httptest.NewRecorder()
+		h.UpdatePart(rr, httptest.NewRequest("PUT", "/api/v1/parts/R-001", strings.NewReader(body)), "R-001")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.UpdatePart(rr, httptest.NewRequest("PUT", "/api/v1/parts/R-404", strings.NewReader(`{"fields":{"description":"x"}}`)), "R-404")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing part, got %d", rr.Code)
 	}
 }
 
@@ -844,28 +886,42 @@ func TestHandleDeletePart(t *testing.T) {
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
 	csvContent := "IPN,description\nR-001,Part to delete\nR-002,Part to keep\n"
-	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
+	csvPath := filepath.Join(catDir, "test.csv")
+	os.WriteFile(csvPath, []byte(csvContent), 0644)
 
-	h := newTestHandler(nil, tmpDir)
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
 
 	req := httptest.NewRequest("DELETE", "/api/v1/parts/R-001", nil)
 	rr := httptest.NewRecorder()
 	h.DeletePart(rr, req, "R-001")
 
-	if rr.Code != http.StatusNotImplemented {
-		t.Errorf("Expected status 501, got %d", rr.Code)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	got, _ := os.ReadFile(csvPath)
+	if string(got) != "IPN,description\nR-002,Part to keep\n" {
+		t.Errorf("CSV after delete:\n%s", got)
+	}
+
+	rr = httptest.NewRecorder()
+	h.DeletePart(rr, httptest.NewRequest("DELETE", "/api/v1/parts/R-001", nil), "R-001")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting twice, got %d", rr.Code)
 	}
 }
 
 func TestHandleAddColumn(t *testing.T) {
-	t.Skip("Column addition not yet implemented - stub handler only")
 	tmpDir := t.TempDir()
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
 	csvContent := "IPN,description\nR-001,Test part\n"
 	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
 
-	h := newTestHandler(nil, tmpDir)
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
 
 	addColBody := map[string]interface{}{
 		"name": "tolerance",
@@ -906,17 +962,45 @@ func TestHandleAddColumn(t *testing.T) {
 	if !found {
 		t.Errorf("Column 'tolerance' not found in category schema")
 	}
+
+	rr = httptest.NewRecorder()
+	h.AddColumn(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"Tolerance"}`)), "resistors")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for duplicate column, got %d", rr.Code)
+	}
+}
+
+func TestHandleAddColumn_KeepsTitleAndQuoting(t *testing.T) {
+	tmpDir := t.TempDir()
+	csvPath := filepath.Join(tmpDir, "z-cap.csv")
+	os.WriteFile(csvPath, []byte("# TITLE: Capacitors\r\n\"IPN\",\"value\"\r\n\"C-001\",\"10uF\"\r\n"), 0644)
+
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
+
+	rr := httptest.NewRecorder()
+	h.AddColumn(rr, httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"voltage","default":"16V"}`)), "z-cap")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	got, _ := os.ReadFile(csvPath)
+	want := "# TITLE: Capacitors\r\n\"IPN\",\"value\",\"voltage\"\r\n\"C-001\",\"10uF\",\"16V\"\r\n"
+	if string(got) != want {
+		t.Errorf("CSV after add column:\n%q\nwant:\n%q", got, want)
+	}
 }
 
 func TestHandleDeleteColumn(t *testing.T) {
-	t.Skip("Column deletion not yet implemented - stub handler only")
 	tmpDir := t.TempDir()
 	catDir := filepath.Join(tmpDir, "resistors")
 	os.MkdirAll(catDir, 0755)
 	csvContent := "IPN,description,tolerance\nR-001,Test part,1%\n"
 	os.WriteFile(filepath.Join(catDir, "test.csv"), []byte(csvContent), 0644)
 
-	h := newTestHandler(nil, tmpDir)
+	db := setupPartsTestDB(t)
+	defer db.Close()
+	h := newTestHandler(db, tmpDir)
 
 	req := httptest.NewRequest("DELETE", "/api/v1/parts/categories/resistors/columns/tolerance", nil)
 	rr := httptest.NewRecorder()
@@ -945,6 +1029,12 @@ func TestHandleDeleteColumn(t *testing.T) {
 			}
 		}
 	}
+
+	rr = httptest.NewRecorder()
+	h.DeleteColumn(rr, httptest.NewRequest("DELETE", "/", nil), "resistors", "IPN")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 deleting the IPN column, got %d", rr.Code)
+	}
 }
 
 func TestLoadPartsFromDir_EmptyDir(t *testing.T) {
@@ -0,0 +1,170 @@
+package parts_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zrp/internal/handlers/parts"
+	"zrp/internal/models"
+)
+
+func createRevision(t *testing.T, h *parts.Handler, ipn, body string, want int) parts.PartRevision {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.CreatePartRevision(w, httptest.NewRequest("POST", "/api/v1/parts/"+ipn+"/revisions", strings.NewReader(body)), ipn)
+	if w.Code != want {
+		t.Fatalf("%s: expected %d, got %d: %s", body, want, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data parts.PartRevision `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Data
+}
+
+// setupEffectivityBOM writes ASY-NEW, whose U1 changes from IC-001 to
+// IC-002 rev B at serial SN-0100 and whose C1 changes from CAP-001 to
+// RES-002 on 2026-06-01.
+func setupEffectivityBOM(t *testing.T, dir string) {
+	t.Helper()
+	setupBOMTestParts(t, dir)
+	createBOMFile(t, dir, "ASY-NEW", [][]string{
+		{"IPN", "qty", "ref", "rev", "effective_from", "effective_to", "serial_from", "serial_to"},
+		{"RES-001", "2", "R1,R2", "", "", "", "", ""},
+		{"IC-001", "1", "U1", "", "", "", "", "SN-0099"},
+		{"IC-002", "1", "U1", "b", "", "", "SN-0100", ""},
+		{"CAP-001", "1", "C1", "", "", "2026-06-01", "", ""},
+		{"RES-002", "1", "C1", "", "2026-06-01T00:00:00Z", "", "", ""},
+	})
+}
+
+func TestPartRevisions_ECORelease(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupBOMTestParts(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "z-fw.csv"), []byte("IPN,description,status\nFW-001,Firmware,released\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(db, dir)
+	mustExec(t, db, `INSERT INTO ecos (id, title, status) VALUES ('ECO-1','Rev B','approved'), ('ECO-2','Rev C','draft'), ('ECO-3','No','rejected')`)
+
+	a := createRevision(t, h, "RES-001", `{"revision":"a","effective_date":"2026-01-01"}`, 201)
+	if a.Revision != "A" || a.Status != "released" || a.ReleasedAt == nil {
+		t.Fatalf("rev A = %+v", a)
+	}
+	createRevision(t, h, "RES-001", `{"revision":"A"}`, 409)
+	createRevision(t, h, "RES-001", `{"revision":"A B"}`, 400)
+	createRevision(t, h, "RES-001", `{"revision":"B","effective_date":"June"}`, 400)
+	createRevision(t, h, "RES-001", `{"revision":"B","eco_id":"ECO-9"}`, 400)
+	createRevision(t, h, "RES-001", `{"revision":"B","eco_id":"ECO-3"}`, 400)
+	createRevision(t, h, "NOPE-1", `{"revision":"A"}`, 404)
+
+	if b := createRevision(t, h, "RES-001", `{"revision":"B","eco_id":"ECO-1","effective_date":"2026-06-01"}`, 201); b.Status != "draft" {
+		t.Errorf("rev B = %+v", b)
+	}
+	createRevision(t, h, "RES-001", `{"revision":"C","eco_id":"ECO-2"}`, 201)
+	if err := h.ApplyPartChangesForECO("ECO-1"); err != nil {
+		t.Fatal(err)
+	}
+	h.RejectPartChangesForECO("ECO-2")
+
+	w := httptest.NewRecorder()
+	h.ListPartRevisions(w, httptest.NewRequest("GET", "/api/v1/parts/RES-001/revisions", nil), "RES-001")
+	var resp struct {
+		Data struct {
+			Revisions []parts.PartRevision `json:"revisions"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	var got []string
+	for _, rev := range resp.Data.Revisions {
+		got = append(got, rev.Revision+":"+rev.Status+":"+rev.EffectiveDate)
+	}
+	if s := strings.Join(got, " "); s != "C:cancelled: B:released:2026-06-01 A:superseded:2026-01-01" {
+		t.Errorf("revisions = %s", s)
+	}
+
+	// Released parts need an ECO once the setting is on.
+	createRevision(t, h, "FW-001", `{"revision":"A"}`, 201)
+	mustExec(t, db, `INSERT INTO app_settings (key, value) VALUES ('parts_require_eco_for_released','true')`)
+	createRevision(t, h, "FW-001", `{"revision":"B"}`, 400)
+	createRevision(t, h, "FW-001", `{"revision":"B","eco_id":"ECO-2"}`, 201)
+}
+
+func TestResolveBuildBOM_Effectivity(t *testing.T) {
+	db := setupCostingDB(t)
+	dir := t.TempDir()
+	setupEffectivityBOM(t, dir)
+	h := newTestHandler(db, dir)
+	mustExec(t, db, `INSERT INTO part_revisions (ipn, revision, status, effective_date) VALUES
+		('RES-001','A','superseded','2026-01-01'), ('RES-001','B','released','2026-06-01'), ('IC-002','B','draft','')`)
+
+	lines := func(bom *models.BuildBOM) string {
+		var out []string
+		for _, l := range bom.Lines {
+			ipn := l.IPN
+			if l.Revision != "" {
+				ipn += "@" + l.Revision
+			}
+			out = append(out, fmt.Sprintf("%s=%g", ipn, l.Qty))
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Three serials known, one still to be assigned; built before the
+	// date cut-in.
+	bom, err := h.ResolveBuildBOM("ASY-NEW", 4, "2026-05-15", []string{"SN-0098", "SN-0099", "SN-0100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lines(bom); got != "CAP-001=4 IC-001=2 IC-002@B=2 RES-001@A=8" {
+		t.Errorf("May build = %s", got)
+	}
+	if len(bom.Warnings) != 1 || bom.Warnings[0] != "IC-002 rev B is draft" {
+		t.Errorf("warnings = %v", bom.Warnings)
+	}
+
+	bom, _ = h.ResolveBuildBOM("ASY-NEW", 2, "2026-07-01", nil)
+	if got := lines(bom); got != "IC-002@B=2 RES-001@B=4 RES-002=2" {
+		t.Errorf("July build = %s", got)
+	}
+	if bom, err := h.ResolveBuildBOM("IC-001", 1, "", nil); bom != nil || err != nil {
+		t.Errorf("part without BOM = %+v, %v", bom, err)
+	}
+
+	// A work order resolves with its start date and serials.
+	mustExec(t, db, `INSERT INTO work_orders (id, assembly_ipn, qty, status, started_at) VALUES ('WO-1','ASY-NEW',2,'in_progress','2026-05-20 08:00:00')`)
+	mustExec(t, db, `INSERT INTO wo_serials (wo_id, serial_number, status) VALUES ('WO-1','SN-99','building')`)
+	bom, err = h.ResolveWorkOrderBOM("WO-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lines(bom); bom.Date != "2026-05-20" || got != "CAP-001=2 IC-001=1 IC-002@B=1 RES-001@A=4" {
+		t.Errorf("WO-1 = %s on %s", got, bom.Date)
+	}
+
+	// The BOM view can be filtered the same way.
+	w := httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-NEW/bom?view=summarized&date=2026-07-01&serial=SN-0050", nil), "ASY-NEW")
+	var resp struct {
+		Data parts.BOMView `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	var ipns []string
+	for _, l := range resp.Data.Lines {
+		ipns = append(ipns, l.IPN)
+	}
+	if got := strings.Join(ipns, " "); got != "IC-001 RES-001 RES-002" {
+		t.Errorf("filtered BOM = %s", got)
+	}
+	w = httptest.NewRecorder()
+	h.PartBOM(w, httptest.NewRequest("GET", "/api/v1/parts/ASY-NEW/bom?date=July", nil), "ASY-NEW")
+	if w.Code != 400 {
+		t.Errorf("bad date: expected 400, got %d", w.Code)
+	}
+}
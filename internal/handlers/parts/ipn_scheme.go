@@ -0,0 +1,573 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zrp/internal/response"
+)
+
+// IPN suffix kinds. A variant is two digits ("-01"), a revision one or two
+// capital letters ("-A").
+const (
+	IPNSuffixVariant  = "variant"
+	IPNSuffixRevision = "revision"
+)
+
+// IPNChecksumLuhn appends a Luhn check digit to the sequence number.
+const IPNChecksumLuhn = "luhn"
+
+// IPNScheme is the numbering template of a category: prefix, zero-padded
+// sequence, optional check digit and optional suffix, e.g. "CAP-00427" or
+// "PCA-01230-A" (digits 4, luhn, revision).
+type IPNScheme struct {
+	Category  string `json:"category"`
+	Prefix    string `json:"prefix"`
+	Digits    int    `json:"digits"`
+	Checksum  string `json:"checksum"`
+	Suffix    string `json:"suffix"`
+	SuffixSep string `json:"suffix_sep"`
+	NextSeq   int    `json:"next_seq"`
+	Enforce   bool   `json:"enforce"`
+	Example   string `json:"example"`
+	UpdatedBy string `json:"updated_by"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+var errIPNSequenceExhausted = errors.New("IPN sequence exhausted; increase digits")
+
+// IPNSchemeError is an IPN that does not match its category's scheme.
+type IPNSchemeError struct {
+	IPN, Category, Problem string
+}
+
+func (e *IPNSchemeError) Error() string {
+	return fmt.Sprintf("IPN %s does not match the %s numbering scheme: %s", e.IPN, e.Category, e.Problem)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// luhnDigit is the Luhn check digit for a string of digits.
+func luhnDigit(digits string) byte {
+	sum, double := 0, true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// initialSuffix is the suffix of a new IPN.
+func (s *IPNScheme) initialSuffix() string {
+	switch s.Suffix {
+	case IPNSuffixVariant:
+		return "01"
+	case IPNSuffixRevision:
+		return "A"
+	}
+	return ""
+}
+
+func (s *IPNScheme) validSuffix(v string) bool {
+	switch s.Suffix {
+	case IPNSuffixVariant:
+		return len(v) == 2 && allDigits(v)
+	case IPNSuffixRevision:
+		if len(v) < 1 || len(v) > 2 {
+			return false
+		}
+		for i := 0; i < len(v); i++ {
+			if v[i] < 'A' || v[i] > 'Z' {
+				return false
+			}
+		}
+		return true
+	}
+	return v == ""
+}
+
+// format renders sequence number seq, with the initial suffix when suffix
+// is empty.
+func (s *IPNScheme) format(seq int, suffix string) (string, error) {
+	digits := fmt.Sprintf("%0*d", s.Digits, seq)
+	if seq < 1 || len(digits) > s.Digits {
+		return "", errIPNSequenceExhausted
+	}
+	ipn := s.Prefix + digits
+	if s.Checksum == IPNChecksumLuhn {
+		ipn += string(luhnDigit(digits))
+	}
+	if s.Suffix != "" {
+		if suffix == "" {
+			suffix = s.initialSuffix()
+		}
+		if !s.validSuffix(suffix) {
+			return "", fmt.Errorf("invalid %s suffix %q", s.Suffix, suffix)
+		}
+		ipn += s.SuffixSep + suffix
+	}
+	return ipn, nil
+}
+
+// parse splits an IPN into its sequence number and suffix, describing the
+// first way it fails to match.
+func (s *IPNScheme) parse(ipn string) (seq int, suffix string, problem string) {
+	seq, rest, problem := s.parseSeq(ipn)
+	if problem != "" {
+		return 0, "", problem
+	}
+	if s.Suffix == "" {
+		if rest != "" {
+			return 0, "", fmt.Sprintf("unexpected %q after the sequence number", rest)
+		}
+		return seq, "", ""
+	}
+	if !strings.HasPrefix(rest, s.SuffixSep) || !s.validSuffix(rest[len(s.SuffixSep):]) {
+		return 0, "", fmt.Sprintf("should end with a %s suffix like %q", s.Suffix, s.SuffixSep+s.initialSuffix())
+	}
+	return seq, rest[len(s.SuffixSep):], ""
+}
+
+// parseSeq checks the prefix, sequence number and check digit of an IPN
+// and returns what follows them.
+func (s *IPNScheme) parseSeq(ipn string) (seq int, rest string, problem string) {
+	if !strings.HasPrefix(ipn, s.Prefix) {
+		return 0, "", fmt.Sprintf("should start with %q", s.Prefix)
+	}
+	rest = ipn[len(s.Prefix):]
+	n := s.Digits
+	if s.Checksum != "" {
+		n++
+	}
+	if len(rest) < n || !allDigits(rest[:n]) || (len(rest) > n && rest[n] >= '0' && rest[n] <= '9') {
+		return 0, "", fmt.Sprintf("should have %d digits after %q", n, s.Prefix)
+	}
+	digits := rest[:s.Digits]
+	if s.Checksum == IPNChecksumLuhn {
+		if want := luhnDigit(digits); rest[s.Digits] != want {
+			return 0, "", fmt.Sprintf("check digit should be %c", want)
+		}
+	}
+	seq, _ = strconv.Atoi(digits)
+	if seq < 1 {
+		return 0, "", "sequence number should start at 1"
+	}
+	return seq, rest[n:], ""
+}
+
+const ipnSchemeColumns = `category, prefix, digits, COALESCE(checksum,''), COALESCE(suffix,''), COALESCE(suffix_sep,''),
+	next_seq, COALESCE(enforce,0), COALESCE(updated_by,''), COALESCE(updated_at,'')`
+
+func scanIPNScheme(row interface{ Scan(...interface{}) error }) (*IPNScheme, error) {
+	s := &IPNScheme{}
+	if err := row.Scan(&s.Category, &s.Prefix, &s.Digits, &s.Checksum, &s.Suffix, &s.SuffixSep,
+		&s.NextSeq, &s.Enforce, &s.UpdatedBy, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	s.Example, _ = s.format(s.NextSeq, "")
+	return s, nil
+}
+
+// ipnScheme returns the scheme of category, or nil when it has none.
+func (h *Handler) ipnScheme(category string) *IPNScheme {
+	if h.DB == nil || category == "" {
+		return nil
+	}
+	s, err := scanIPNScheme(h.DB.QueryRow("SELECT "+ipnSchemeColumns+" FROM ipn_schemes WHERE category=?", strings.ToLower(category)))
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+func (h *Handler) ipnSchemes() []*IPNScheme {
+	out := []*IPNScheme{}
+	if h.DB == nil {
+		return out
+	}
+	rows, err := h.DB.Query("SELECT " + ipnSchemeColumns + " FROM ipn_schemes ORDER BY category")
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if s, err := scanIPNScheme(rows); err == nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// checkIPNScheme returns an *IPNSchemeError when category enforces a
+// scheme that ipn does not match.
+func (h *Handler) checkIPNScheme(category, ipn string) error {
+	s := h.ipnScheme(category)
+	if s == nil || !s.Enforce {
+		return nil
+	}
+	if _, _, problem := s.parse(ipn); problem != "" {
+		return &IPNSchemeError{IPN: ipn, Category: s.Category, Problem: problem}
+	}
+	return nil
+}
+
+// usedSeqs collects the sequence numbers taken by parts and reservations
+// under s. A part counts whatever its suffix, so variants of one number
+// are never handed out as another.
+func (h *Handler) usedSeqs(s *IPNScheme) map[int]bool {
+	used := map[int]bool{}
+	cats, _, _, _ := h.catalog().Parts()
+	for _, ps := range cats {
+		for _, p := range ps {
+			if seq, _, problem := s.parseSeq(p.IPN); problem == "" {
+				used[seq] = true
+			}
+		}
+	}
+	rows, err := h.DB.Query("SELECT seq FROM ipn_reservations WHERE category=?", s.Category)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var seq int
+			if rows.Scan(&seq) == nil {
+				used[seq] = true
+			}
+		}
+	}
+	return used
+}
+
+// IPNReservation is an IPN handed out by a scheme. It stays reserved until
+// a part is created with it.
+type IPNReservation struct {
+	IPN        string `json:"ipn"`
+	Category   string `json:"category"`
+	Seq        int    `json:"seq"`
+	Status     string `json:"status"`
+	ReservedBy string `json:"reserved_by"`
+}
+
+var errNoIPNScheme = errors.New("category has no IPN scheme")
+
+var errIPNBusy = errors.New("could not reserve an IPN; try again")
+
+// maxIPNReserveAttempts bounds reserveIPN overall, however often other
+// callers get ahead.
+const maxIPNReserveAttempts = 100
+
+// reserveIPN takes the next free sequence number of category's scheme. The
+// next_seq update is conditional on the value read and the reservation's
+// primary key is the IPN, so concurrent callers, in this process or
+// another, never get the same number; a caller that loses the race tries
+// again. Only attempts on which no other caller got ahead count towards
+// the per-number limit, so a burst of reservations all succeed, but no
+// caller tries more than maxIPNReserveAttempts times in all.
+func (h *Handler) reserveIPN(category, suffix, user string) (IPNReservation, error) {
+	lastSeq, stalled := -1, 0
+	for total := 0; total < maxIPNReserveAttempts && stalled < 5; total++ {
+		s := h.ipnScheme(category)
+		if s == nil {
+			return IPNReservation{}, errNoIPNScheme
+		}
+		if s.NextSeq != lastSeq {
+			lastSeq, stalled = s.NextSeq, 0
+		}
+		stalled++
+		used := h.usedSeqs(s)
+		seq := s.NextSeq
+		for used[seq] {
+			seq++
+		}
+		ipn, err := s.format(seq, suffix)
+		if err != nil {
+			return IPNReservation{}, err
+		}
+
+		tx, err := h.DB.Begin()
+		if err != nil {
+			return IPNReservation{}, err
+		}
+		res, err := tx.Exec("UPDATE ipn_schemes SET next_seq=? WHERE category=? AND next_seq=?", seq+1, s.Category, s.NextSeq)
+		if err != nil {
+			tx.Rollback()
+			return IPNReservation{}, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			tx.Rollback()
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO ipn_reservations (ipn, category, seq, reserved_by) VALUES (?,?,?,?)",
+			ipn, s.Category, seq, user); err != nil {
+			tx.Rollback()
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			return IPNReservation{}, err
+		}
+		return IPNReservation{IPN: ipn, Category: s.Category, Seq: seq, Status: "reserved", ReservedBy: user}, nil
+	}
+	return IPNReservation{}, errIPNBusy
+}
+
+// releaseIPN drops an unused reservation, for a part that could not be
+// created with it. The scheme's next number is wound back when nothing has
+// been reserved since, so the number is handed out again.
+func (h *Handler) releaseIPN(res IPNReservation) error {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM ipn_reservations WHERE ipn=? AND status='reserved'", res.IPN); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE ipn_schemes SET next_seq=? WHERE category=? AND next_seq=?", res.Seq, res.Category, res.Seq+1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ipnReservedBy returns who holds an unused reservation of ipn.
+func (h *Handler) ipnReservedBy(ipn string) (string, bool) {
+	if h.DB == nil {
+		return "", false
+	}
+	var by string
+	if err := h.DB.QueryRow("SELECT COALESCE(reserved_by,'') FROM ipn_reservations WHERE ipn=? AND status='reserved'", ipn).Scan(&by); err != nil {
+		return "", false
+	}
+	return by, true
+}
+
+func (h *Handler) markIPNUsed(ipn string) {
+	if h.DB != nil {
+		h.DB.Exec("UPDATE ipn_reservations SET status='used', used_at=CURRENT_TIMESTAMP WHERE ipn=? AND status='reserved'", ipn)
+	}
+}
+
+// schemeForIPN finds the scheme whose prefix ipn starts with, preferring
+// the longest prefix.
+func (h *Handler) schemeForIPN(ipn string) *IPNScheme {
+	var best *IPNScheme
+	for _, s := range h.ipnSchemes() {
+		if strings.HasPrefix(ipn, s.Prefix) && (best == nil || len(s.Prefix) > len(best.Prefix)) {
+			best = s
+		}
+	}
+	return best
+}
+
+// ListIPNSchemes handles GET /api/categories/ipn-schemes.
+func (h *Handler) ListIPNSchemes(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, h.ipnSchemes())
+}
+
+// GetIPNScheme handles GET /api/categories/:id/ipn-scheme.
+func (h *Handler) GetIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	s := h.ipnScheme(catID)
+	if s == nil {
+		response.Err(w, "no IPN scheme for this category", 404)
+		return
+	}
+	response.JSON(w, s)
+}
+
+func validIPNPrefix(p string) bool {
+	for _, c := range p {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return p != ""
+}
+
+// UpdateIPNScheme handles PUT /api/categories/:id/ipn-scheme. Without
+// next_seq, numbering continues after the highest existing IPN that
+// matches.
+func (h *Handler) UpdateIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	var s IPNScheme
+	if err := response.DecodeBody(r, &s); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	if len(h.categoryCSVPaths(catID)) == 0 {
+		response.Err(w, "category not found", 404)
+		return
+	}
+	s.Category = strings.ToLower(catID)
+	if s.Digits == 0 {
+		s.Digits = 4
+	}
+	if s.Suffix != "" && s.SuffixSep == "" {
+		s.SuffixSep = "-"
+	}
+	switch {
+	case !validIPNPrefix(s.Prefix):
+		response.Err(w, "prefix is required and may only contain letters, digits, '-', '_' and '.'", 400)
+		return
+	case s.Digits < 1 || s.Digits > 12:
+		response.Err(w, "digits must be between 1 and 12", 400)
+		return
+	case s.Checksum != "" && s.Checksum != IPNChecksumLuhn:
+		response.Err(w, "checksum must be empty or luhn", 400)
+		return
+	case s.Suffix != "" && s.Suffix != IPNSuffixVariant && s.Suffix != IPNSuffixRevision:
+		response.Err(w, "suffix must be empty, variant or revision", 400)
+		return
+	case s.Suffix != "" && strings.Trim(s.SuffixSep, "-_.") != "":
+		response.Err(w, "suffix_sep must be '-', '_' or '.'", 400)
+		return
+	case s.NextSeq < 0:
+		response.Err(w, "next_seq must be positive", 400)
+		return
+	}
+	if s.Suffix == "" {
+		s.SuffixSep = ""
+	}
+	if s.NextSeq == 0 {
+		s.NextSeq = 1
+		for seq := range h.usedSeqs(&s) {
+			if seq >= s.NextSeq {
+				s.NextSeq = seq + 1
+			}
+		}
+	}
+	if _, err := s.format(s.NextSeq, ""); err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+
+	user := h.getUsername(r)
+	_, err := h.DB.Exec(`INSERT INTO ipn_schemes (category, prefix, digits, checksum, suffix, suffix_sep, next_seq, enforce, updated_by, updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,CURRENT_TIMESTAMP)
+		ON CONFLICT(category) DO UPDATE SET prefix=excluded.prefix, digits=excluded.digits, checksum=excluded.checksum,
+			suffix=excluded.suffix, suffix_sep=excluded.suffix_sep, next_seq=excluded.next_seq, enforce=excluded.enforce,
+			updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		s.Category, s.Prefix, s.Digits, s.Checksum, s.Suffix, s.SuffixSep, s.NextSeq, s.Enforce, user)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	out := h.ipnScheme(s.Category)
+	h.logAudit(user, "updated", "part_category", s.Category, "Set IPN scheme, e.g. "+out.Example)
+	response.JSON(w, out)
+}
+
+// DeleteIPNScheme handles DELETE /api/categories/:id/ipn-scheme.
+// Reservations are kept.
+func (h *Handler) DeleteIPNScheme(w http.ResponseWriter, r *http.Request, catID string) {
+	res, err := h.DB.Exec("DELETE FROM ipn_schemes WHERE category=?", strings.ToLower(catID))
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, "no IPN scheme for this category", 404)
+		return
+	}
+	h.logAudit(h.getUsername(r), "updated", "part_category", strings.ToLower(catID), "Removed IPN scheme")
+	response.JSON(w, map[string]string{"status": "deleted"})
+}
+
+// ReserveIPN handles POST /api/categories/:id/ipn-scheme/reserve.
+func (h *Handler) ReserveIPN(w http.ResponseWriter, r *http.Request, catID string) {
+	var body struct {
+		Suffix string `json:"suffix"`
+	}
+	if r.ContentLength != 0 {
+		if err := response.DecodeBody(r, &body); err != nil {
+			response.Err(w, "invalid request body", 400)
+			return
+		}
+	}
+	user := h.getUsername(r)
+	res, err := h.reserveIPN(catID, body.Suffix, user)
+	if err == errNoIPNScheme {
+		response.Err(w, err.Error(), 404)
+		return
+	} else if err == errIPNSequenceExhausted {
+		response.Err(w, err.Error(), 422)
+		return
+	} else if err == errIPNBusy {
+		response.Err(w, err.Error(), 503)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 400)
+		return
+	}
+	h.logAudit(user, "created", "part", res.IPN, "Reserved IPN "+res.IPN)
+	w.WriteHeader(201)
+	response.JSON(w, res)
+}
+
+// IPNSchemeIssue is an existing IPN that does not match its category's
+// scheme. Suggested is a free IPN it could be renumbered to; it is not
+// reserved.
+type IPNSchemeIssue struct {
+	IPN       string `json:"ipn"`
+	Category  string `json:"category"`
+	Problem   string `json:"problem"`
+	Suggested string `json:"suggested"`
+}
+
+// IPNSchemeReport lists the parts that do not conform to their category's
+// scheme.
+type IPNSchemeReport struct {
+	Categories    int              `json:"categories"`
+	Checked       int              `json:"checked"`
+	Conforming    int              `json:"conforming"`
+	Nonconforming []IPNSchemeIssue `json:"nonconforming"`
+}
+
+// IPNSchemeReport handles GET /api/categories/ipn-schemes/report, the
+// migration report for categories that have a scheme (or just ?category=).
+func (h *Handler) IPNSchemeReport(w http.ResponseWriter, r *http.Request) {
+	only := strings.ToLower(r.URL.Query().Get("category"))
+	cat := h.catalog()
+	report := IPNSchemeReport{Nonconforming: []IPNSchemeIssue{}}
+	for _, s := range h.ipnSchemes() {
+		if only != "" && s.Category != only {
+			continue
+		}
+		report.Categories++
+		used := h.usedSeqs(s)
+		next := s.NextSeq
+		ps := cat.Category(s.Category)
+		sort.Slice(ps, func(i, j int) bool { return ps[i].IPN < ps[j].IPN })
+		for _, p := range ps {
+			report.Checked++
+			_, _, problem := s.parse(p.IPN)
+			if problem == "" {
+				report.Conforming++
+				continue
+			}
+			issue := IPNSchemeIssue{IPN: p.IPN, Category: s.Category, Problem: problem}
+			for used[next] {
+				next++
+			}
+			if ipn, err := s.format(next, ""); err == nil {
+				issue.Suggested = ipn
+				used[next] = true
+			}
+			report.Nonconforming = append(report.Nonconforming, issue)
+		}
+	}
+	response.JSON(w, report)
+}
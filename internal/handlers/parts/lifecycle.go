@@ -0,0 +1,622 @@
+package parts
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"zrp/internal/response"
+)
+
+// Part lifecycle states, kept in the lifecycle column of the parts table.
+const (
+	LifecyclePrototype   = "prototype"
+	LifecycleActive      = "active"
+	LifecycleNRND        = "nrnd" // not recommended for new designs
+	LifecycleLastTimeBuy = "last_time_buy"
+	LifecycleObsolete    = "obsolete"
+)
+
+// LifecycleStates lists the states in order of increasing risk.
+var LifecycleStates = []string{LifecyclePrototype, LifecycleActive, LifecycleNRND, LifecycleLastTimeBuy, LifecycleObsolete}
+
+// lifecycleTransitions are the allowed moves from each state. Obsolete is
+// final; a part coming back needs a new IPN.
+var lifecycleTransitions = map[string][]string{
+	LifecyclePrototype:   {LifecycleActive, LifecycleObsolete},
+	LifecycleActive:      {LifecycleNRND, LifecycleLastTimeBuy, LifecycleObsolete},
+	LifecycleNRND:        {LifecycleActive, LifecycleLastTimeBuy, LifecycleObsolete},
+	LifecycleLastTimeBuy: {LifecycleObsolete},
+	LifecycleObsolete:    {},
+}
+
+// lifecycleRisk ranks states; NRND and later put the part's users at risk.
+func lifecycleRisk(state string) int {
+	switch state {
+	case LifecycleNRND:
+		return 1
+	case LifecycleLastTimeBuy:
+		return 2
+	case LifecycleObsolete:
+		return 3
+	}
+	return 0
+}
+
+func validLifecycle(state string) bool {
+	_, ok := lifecycleTransitions[state]
+	return ok
+}
+
+// normalizeLifecycle maps the spellings used by people and distributors
+// ("NRND", "Last Time Buy", "End of Life", "Not For New Designs") to a
+// state. It returns "" when the text names none.
+func normalizeLifecycle(s string) string {
+	l := strings.ToLower(strings.TrimSpace(s))
+	l = strings.NewReplacer("-", " ", "_", " ").Replace(l)
+	switch {
+	case l == "":
+		return ""
+	case strings.Contains(l, "obsolete") || strings.Contains(l, "discontinued") ||
+		strings.Contains(l, "end of life") || l == "eol":
+		return LifecycleObsolete
+	case strings.Contains(l, "last time buy") || l == "ltb":
+		return LifecycleLastTimeBuy
+	case l == "nrnd" || strings.Contains(l, "not recommended") || strings.Contains(l, "not for new design"):
+		return LifecycleNRND
+	case l == "prototype" || strings.Contains(l, "preliminary") || strings.Contains(l, "pre release"):
+		return LifecyclePrototype
+	case l == "active" || strings.Contains(l, "new product") || strings.Contains(l, "in production"):
+		return LifecycleActive
+	}
+	return ""
+}
+
+// partLifecycle returns the lifecycle state of ipn: the parts table row,
+// else a lifecycle column in the part's CSV when it names a state, else
+// active.
+func (h *Handler) partLifecycle(ipn string) string {
+	var v string
+	if err := h.DB.QueryRow("SELECT COALESCE(lifecycle,'') FROM parts WHERE ipn=?", ipn).Scan(&v); err == nil {
+		if s := normalizeLifecycle(v); s != "" {
+			return s
+		}
+	}
+	if part, ok := h.catalog().Get(ipn); ok {
+		for k, v := range part.Fields {
+			if strings.EqualFold(k, "lifecycle") {
+				if s := normalizeLifecycle(v); s != "" {
+					return s
+				}
+			}
+		}
+	}
+	return LifecycleActive
+}
+
+// Obsolescence is what is known about a part's end of life, entered by hand
+// (source "manual") or taken from distributor data (source is the
+// distributor).
+type Obsolescence struct {
+	IPN            string `json:"ipn"`
+	Status         string `json:"status"`
+	LTBDate        string `json:"ltb_date"`
+	EOLDate        string `json:"eol_date"`
+	ReplacementIPN string `json:"replacement_ipn"`
+	Source         string `json:"source"`
+	SourceDetail   string `json:"source_detail"`
+	Notes          string `json:"notes"`
+	UpdatedBy      string `json:"updated_by"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+func (h *Handler) obsolescence(ipn string) *Obsolescence {
+	o := &Obsolescence{}
+	err := h.DB.QueryRow(`SELECT ipn, COALESCE(status,''), COALESCE(ltb_date,''), COALESCE(eol_date,''),
+		COALESCE(replacement_ipn,''), COALESCE(source,''), COALESCE(source_detail,''), COALESCE(notes,''),
+		COALESCE(updated_by,''), COALESCE(updated_at,'') FROM part_obsolescence WHERE ipn=?`, ipn).
+		Scan(&o.IPN, &o.Status, &o.LTBDate, &o.EOLDate, &o.ReplacementIPN, &o.Source, &o.SourceDetail,
+			&o.Notes, &o.UpdatedBy, &o.UpdatedAt)
+	if err != nil {
+		return nil
+	}
+	return o
+}
+
+// MarketLifecycle is a distributor's reported status for a part.
+type MarketLifecycle struct {
+	Distributor string `json:"distributor"`
+	Status      string `json:"status"`
+	State       string `json:"state"`
+	FetchedAt   string `json:"fetched_at"`
+}
+
+func (h *Handler) marketLifecycle(ipn string) []MarketLifecycle {
+	out := []MarketLifecycle{}
+	rows, err := h.DB.Query(`SELECT distributor, COALESCE(lifecycle_status,''), fetched_at FROM market_pricing
+		WHERE part_ipn=? AND COALESCE(lifecycle_status,'') != '' ORDER BY distributor`, ipn)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m MarketLifecycle
+		if rows.Scan(&m.Distributor, &m.Status, &m.FetchedAt) == nil {
+			m.State = normalizeLifecycle(m.Status)
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// LifecycleEvent is one recorded state change.
+type LifecycleEvent struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Reason    string `json:"reason"`
+	ChangedBy string `json:"changed_by"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// PartLifecycleInfo is the lifecycle view of a part.
+type PartLifecycleInfo struct {
+	IPN          string            `json:"ipn"`
+	Lifecycle    string            `json:"lifecycle"`
+	Allowed      []string          `json:"allowed_transitions"`
+	Obsolescence *Obsolescence     `json:"obsolescence"`
+	Market       []MarketLifecycle `json:"market"`
+	History      []LifecycleEvent  `json:"history"`
+}
+
+// GetPartLifecycle handles GET /api/parts/:ipn/lifecycle.
+func (h *Handler) GetPartLifecycle(w http.ResponseWriter, r *http.Request, ipn string) {
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	state := h.partLifecycle(ipn)
+	info := PartLifecycleInfo{IPN: ipn, Lifecycle: state, Allowed: lifecycleTransitions[state],
+		Obsolescence: h.obsolescence(ipn), Market: h.marketLifecycle(ipn), History: []LifecycleEvent{}}
+	rows, err := h.DB.Query(`SELECT COALESCE(from_state,''), to_state, COALESCE(reason,''), COALESCE(changed_by,''), changed_at
+		FROM part_lifecycle_history WHERE ipn=? ORDER BY id DESC`, ipn)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var e LifecycleEvent
+			if rows.Scan(&e.From, &e.To, &e.Reason, &e.ChangedBy, &e.ChangedAt) == nil {
+				info.History = append(info.History, e)
+			}
+		}
+	}
+	response.JSON(w, info)
+}
+
+// LifecycleTransitionError is returned for a move lifecycleTransitions does
+// not allow.
+type LifecycleTransitionError struct {
+	From, To string
+}
+
+func (e *LifecycleTransitionError) Error() string {
+	return fmt.Sprintf("cannot move from %s to %s", e.From, e.To)
+}
+
+// setLifecycle moves ipn to state and records the change. The parts table
+// row is created on first use, seeded from the CSV.
+func (h *Handler) setLifecycle(ipn, state, reason, user string) (from string, err error) {
+	from = h.partLifecycle(ipn)
+	if from == state {
+		return from, nil
+	}
+	if !containsString(lifecycleTransitions[from], state) {
+		return from, &LifecycleTransitionError{From: from, To: state}
+	}
+	part, _ := h.catalog().Get(ipn)
+	field := func(names ...string) string {
+		for k, v := range part.Fields {
+			for _, n := range names {
+				if strings.EqualFold(k, n) {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return from, err
+	}
+	defer tx.Rollback()
+	now := time.Now().Format("2006-01-02 15:04:05")
+	_, err = tx.Exec(`INSERT INTO parts (ipn, category, description, mpn, manufacturer, lifecycle, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,?)
+		ON CONFLICT(ipn) DO UPDATE SET lifecycle=excluded.lifecycle, updated_at=excluded.updated_at`,
+		ipn, part.Fields["_category"], field("description", "desc"), field("mpn", "manufacturer_part_number"),
+		field("manufacturer"), state, now, now)
+	if err != nil {
+		return from, err
+	}
+	if _, err = tx.Exec(`INSERT INTO part_lifecycle_history (ipn, from_state, to_state, reason, changed_by, changed_at)
+		VALUES (?,?,?,?,?,?)`, ipn, from, state, reason, user, now); err != nil {
+		return from, err
+	}
+	return from, tx.Commit()
+}
+
+// SetPartLifecycle handles POST /api/parts/:ipn/lifecycle. Moving a part to
+// NRND, last-time-buy or obsolete returns the where-used impact and
+// notifies the owners of the affected assemblies unless notify is false.
+func (h *Handler) SetPartLifecycle(w http.ResponseWriter, r *http.Request, ipn string) {
+	var body struct {
+		State  string `json:"state"`
+		Reason string `json:"reason"`
+		Notify *bool  `json:"notify"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	state := normalizeLifecycle(body.State)
+	if !validLifecycle(state) {
+		response.Err(w, "state must be one of "+strings.Join(LifecycleStates, ", "), 400)
+		return
+	}
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	user := h.getUsername(r)
+	from, err := h.setLifecycle(ipn, state, body.Reason, user)
+	if terr, ok := err.(*LifecycleTransitionError); ok {
+		response.Err(w, terr.Error(), 409)
+		return
+	} else if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	out := map[string]interface{}{"ipn": ipn, "from": from, "lifecycle": state}
+	if from != state {
+		h.logAudit(user, "updated", "part", ipn, fmt.Sprintf("Lifecycle %s -> %s", from, state))
+		if lifecycleRisk(state) > lifecycleRisk(from) {
+			impact := h.lifecycleImpact(ipn)
+			out["impact"] = impact
+			if body.Notify == nil || *body.Notify {
+				out["notified"] = h.notifyLifecycleOwners(impact, body.Reason)
+			}
+		}
+	}
+	response.JSON(w, out)
+}
+
+// UpdateObsolescence handles PUT /api/parts/:ipn/obsolescence, the manual
+// entry of end-of-life information. Manual entries are not overwritten by
+// distributor scans.
+func (h *Handler) UpdateObsolescence(w http.ResponseWriter, r *http.Request, ipn string) {
+	var o Obsolescence
+	if err := response.DecodeBody(r, &o); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	if o.Status != "" {
+		if o.Status = normalizeLifecycle(o.Status); o.Status == "" {
+			response.Err(w, "status must be one of "+strings.Join(LifecycleStates, ", "), 400)
+			return
+		}
+	}
+	for _, d := range []string{o.LTBDate, o.EOLDate} {
+		if d != "" {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				response.Err(w, "dates must be YYYY-MM-DD", 400)
+				return
+			}
+		}
+	}
+	if o.ReplacementIPN != "" {
+		if _, ok := h.catalog().Get(o.ReplacementIPN); !ok {
+			response.Err(w, "replacement part not found: "+o.ReplacementIPN, 400)
+			return
+		}
+	}
+	user := h.getUsername(r)
+	_, err := h.DB.Exec(`INSERT INTO part_obsolescence (ipn, status, ltb_date, eol_date, replacement_ipn, source, source_detail, notes, updated_by, updated_at)
+		VALUES (?,?,?,?,?,'manual','',?,?,CURRENT_TIMESTAMP)
+		ON CONFLICT(ipn) DO UPDATE SET status=excluded.status, ltb_date=excluded.ltb_date, eol_date=excluded.eol_date,
+			replacement_ipn=excluded.replacement_ipn, source='manual', source_detail='', notes=excluded.notes,
+			updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		ipn, o.Status, o.LTBDate, o.EOLDate, o.ReplacementIPN, o.Notes, user)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.logAudit(user, "updated", "part", ipn, "Updated obsolescence information")
+	response.JSON(w, h.obsolescence(ipn))
+}
+
+// ObsolescenceAlert is a part whose reported status is riskier than its
+// lifecycle state.
+type ObsolescenceAlert struct {
+	IPN       string `json:"ipn"`
+	Lifecycle string `json:"lifecycle"`
+	Reported  string `json:"reported"`
+	Source    string `json:"source"`
+	Applied   bool   `json:"applied"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ScanObsolescence handles POST /api/parts/obsolescence/scan. It records
+// the riskiest status distributors report for each part (leaving manual
+// entries alone) and lists the parts whose reported status is riskier than
+// their lifecycle. With ?apply=true those parts are moved to the reported
+// state, with the same impact notifications as a manual change.
+func (h *Handler) ScanObsolescence(w http.ResponseWriter, r *http.Request) {
+	apply := r.URL.Query().Get("apply") == "true"
+	rows, err := h.DB.Query(`SELECT part_ipn, distributor, lifecycle_status FROM market_pricing
+		WHERE COALESCE(lifecycle_status,'') != '' ORDER BY part_ipn, distributor`)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	type report struct{ state, source, detail string }
+	reported := map[string]report{}
+	var ipns []string
+	for rows.Next() {
+		var ipn, dist, status string
+		if rows.Scan(&ipn, &dist, &status) != nil {
+			continue
+		}
+		state := normalizeLifecycle(status)
+		if state == "" {
+			continue
+		}
+		cur, seen := reported[ipn]
+		if !seen {
+			ipns = append(ipns, ipn)
+		}
+		if !seen || lifecycleRisk(state) > lifecycleRisk(cur.state) {
+			reported[ipn] = report{state, dist, status}
+		}
+	}
+	rows.Close()
+
+	user := h.getUsername(r)
+	alerts := []ObsolescenceAlert{}
+	for _, ipn := range ipns {
+		rep := reported[ipn]
+		if o := h.obsolescence(ipn); o == nil || o.Source != "manual" {
+			h.DB.Exec(`INSERT INTO part_obsolescence (ipn, status, source, source_detail, updated_by, updated_at)
+				VALUES (?,?,?,?,?,CURRENT_TIMESTAMP)
+				ON CONFLICT(ipn) DO UPDATE SET status=excluded.status, source=excluded.source,
+					source_detail=excluded.source_detail, updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+				ipn, rep.state, rep.source, rep.detail, user)
+		}
+		cur := h.partLifecycle(ipn)
+		if lifecycleRisk(rep.state) <= lifecycleRisk(cur) {
+			continue
+		}
+		a := ObsolescenceAlert{IPN: ipn, Lifecycle: cur, Reported: rep.state, Source: rep.source}
+		if apply {
+			reason := fmt.Sprintf("%s reports %q", rep.source, rep.detail)
+			if _, err := h.setLifecycle(ipn, rep.state, reason, user); err != nil {
+				a.Error = err.Error()
+			} else {
+				a.Applied = true
+				h.logAudit(user, "updated", "part", ipn, fmt.Sprintf("Lifecycle %s -> %s (%s)", cur, rep.state, reason))
+				h.notifyLifecycleOwners(h.lifecycleImpact(ipn), reason)
+			}
+		}
+		alerts = append(alerts, a)
+	}
+	response.JSON(w, map[string]interface{}{"scanned": len(ipns), "alerts": alerts})
+}
+
+// ImpactAssembly is an assembly that uses the part, at any level. Qty is
+// the number of the part in one assembly.
+type ImpactAssembly struct {
+	IPN         string  `json:"ipn"`
+	Description string  `json:"description"`
+	Direct      bool    `json:"direct"`
+	Qty         float64 `json:"qty"`
+	Owner       string  `json:"owner"`
+}
+
+// ImpactSalesOrder is an open sales order for the part or an assembly
+// using it.
+type ImpactSalesOrder struct {
+	ID         string   `json:"id"`
+	Customer   string   `json:"customer"`
+	Status     string   `json:"status"`
+	AffectedBy []string `json:"affected_by"`
+}
+
+// LifecycleImpact is the where-used impact of a part going NRND or EOL.
+type LifecycleImpact struct {
+	IPN          string             `json:"ipn"`
+	Lifecycle    string             `json:"lifecycle"`
+	Obsolescence *Obsolescence      `json:"obsolescence"`
+	Assemblies   []ImpactAssembly   `json:"assemblies"`
+	WorkOrders   []ECOWorkOrder     `json:"work_orders"`
+	SalesOrders  []ImpactSalesOrder `json:"sales_orders"`
+}
+
+// PartLifecycleImpact handles GET /api/parts/:ipn/lifecycle/impact.
+func (h *Handler) PartLifecycleImpact(w http.ResponseWriter, r *http.Request, ipn string) {
+	response.JSON(w, h.lifecycleImpact(ipn))
+}
+
+// usedIn maps each part to the assemblies whose BOM lists it directly.
+func (h *Handler) usedIn() map[string][]string {
+	rules := h.assemblyRules()
+	parents := map[string][]string{}
+	for _, name := range h.catalog().Names() {
+		if !h.isAssembly(rules, name) {
+			continue
+		}
+		lines, ok := h.bomLines(name)
+		if !ok {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, l := range lines {
+			if !seen[l.IPN] {
+				seen[l.IPN] = true
+				parents[l.IPN] = append(parents[l.IPN], name)
+			}
+		}
+	}
+	return parents
+}
+
+// partOwner is the owner column of a part's CSV row.
+func (h *Handler) partOwner(ipn string) string {
+	if part, ok := h.catalog().Get(ipn); ok {
+		for k, v := range part.Fields {
+			if strings.EqualFold(k, "owner") {
+				return strings.TrimSpace(v)
+			}
+		}
+	}
+	return ""
+}
+
+func (h *Handler) lifecycleImpact(ipn string) *LifecycleImpact {
+	impact := &LifecycleImpact{IPN: ipn, Lifecycle: h.partLifecycle(ipn), Obsolescence: h.obsolescence(ipn),
+		Assemblies: []ImpactAssembly{}, SalesOrders: []ImpactSalesOrder{}}
+
+	parents := h.usedIn()
+	direct := map[string]bool{}
+	for _, p := range parents[ipn] {
+		direct[p] = true
+	}
+	found := map[string]bool{}
+	queue := append([]string(nil), parents[ipn]...)
+	for len(queue) > 0 {
+		asm := queue[0]
+		queue = queue[1:]
+		if found[asm] || asm == ipn {
+			continue
+		}
+		found[asm] = true
+		queue = append(queue, parents[asm]...)
+	}
+	affected := []string{ipn}
+	for asm := range found {
+		a := ImpactAssembly{IPN: asm, Description: h.partDescription(asm), Direct: direct[asm], Owner: h.partOwner(asm)}
+		if node, err := h.buildBOMTree(asm, 1); err == nil {
+			a.Qty = round6(countInTree(node, ipn))
+		}
+		impact.Assemblies = append(impact.Assemblies, a)
+		affected = append(affected, asm)
+	}
+	sort.Slice(impact.Assemblies, func(i, j int) bool { return impact.Assemblies[i].IPN < impact.Assemblies[j].IPN })
+
+	impact.WorkOrders = h.affectedWorkOrders([]string{ipn})
+	impact.SalesOrders = h.openSalesOrdersFor(affected)
+	return impact
+}
+
+// countInTree totals the ext_qty of ipn across an exploded BOM.
+func countInTree(n *BOMNode, ipn string) float64 {
+	total := 0.0
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.IPN == ipn {
+			total += c.ExtQty
+		}
+		total += countInTree(c, ipn)
+	}
+	return total
+}
+
+// openSalesOrdersFor lists the sales orders not yet shipped with a line for
+// any of ipns.
+func (h *Handler) openSalesOrdersFor(ipns []string) []ImpactSalesOrder {
+	out := []ImpactSalesOrder{}
+	if len(ipns) == 0 {
+		return out
+	}
+	args := make([]interface{}, len(ipns))
+	for i, v := range ipns {
+		args[i] = v
+	}
+	rows, err := h.DB.Query(`SELECT so.id, so.customer, so.status, l.ipn FROM sales_orders so
+		JOIN sales_order_lines l ON l.sales_order_id = so.id
+		WHERE so.status IN ('draft','confirmed','allocated','picked')
+		AND l.ipn IN (?`+strings.Repeat(",?", len(ipns)-1)+`)
+		ORDER BY so.id, l.ipn`, args...)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, customer, status, ipn string
+		if rows.Scan(&id, &customer, &status, &ipn) != nil {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].ID == id {
+			if !containsString(out[n-1].AffectedBy, ipn) {
+				out[n-1].AffectedBy = append(out[n-1].AffectedBy, ipn)
+			}
+			continue
+		}
+		out = append(out, ImpactSalesOrder{ID: id, Customer: customer, Status: status, AffectedBy: []string{ipn}})
+	}
+	return out
+}
+
+// notifyLifecycleOwners sends one part_lifecycle notification to the owner
+// of each affected assembly, or a single unaddressed one when none has an
+// owner. Repeats within 24 hours are skipped. It returns the recipients.
+func (h *Handler) notifyLifecycleOwners(impact *LifecycleImpact, reason string) []string {
+	if len(impact.Assemblies) == 0 {
+		return []string{}
+	}
+	byOwner := map[string][]string{}
+	for _, a := range impact.Assemblies {
+		byOwner[a.Owner] = append(byOwner[a.Owner], a.IPN)
+	}
+	owners := make([]string, 0, len(byOwner))
+	for o := range byOwner {
+		owners = append(owners, o)
+	}
+	sort.Strings(owners)
+	if len(owners) > 1 && owners[0] == "" {
+		// Assemblies without an owner go to everyone, once.
+		owners = append(owners[1:], "")
+	}
+
+	severity := "warning"
+	if impact.Lifecycle == LifecycleObsolete {
+		severity = "error"
+	}
+	title := fmt.Sprintf("%s is now %s", impact.IPN, impact.Lifecycle)
+	notified := []string{}
+	for _, owner := range owners {
+		msg := "Used in " + strings.Join(byOwner[owner], ", ")
+		if n := len(impact.WorkOrders); n > 0 {
+			msg += fmt.Sprintf("; %d open work order(s)", n)
+		}
+		if n := len(impact.SalesOrders); n > 0 {
+			msg += fmt.Sprintf("; %d open sales order(s)", n)
+		}
+		if reason != "" {
+			msg += ". " + reason
+		}
+		var count int
+		h.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE type='part_lifecycle' AND record_id=? AND user_id=? AND title=?
+			AND created_at > datetime('now', '-24 hours')`, impact.IPN, owner, title).Scan(&count)
+		if count > 0 {
+			continue
+		}
+		if _, err := h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module, user_id)
+			VALUES ('part_lifecycle', ?, ?, ?, ?, 'parts', ?)`, severity, title, msg, impact.IPN, owner); err == nil && owner != "" {
+			notified = append(notified, owner)
+		}
+	}
+	return notified
+}
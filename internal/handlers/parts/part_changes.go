@@ -171,26 +171,41 @@ func (h *Handler) CreateECOFromChanges(w http.ResponseWriter, r *http.Request, i
 	}
 
 	user := h.getUsername(r)
+	ecoID, err := h.createPartChangeECO(ipn, user, body.Title, body.Description, body.Priority, changeIDs, summaryParts)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	h.logAudit(user, "created", "eco", ecoID, fmt.Sprintf("Created ECO from %d part changes for %s", len(changeIDs), ipn))
+	response.JSON(w, map[string]interface{}{
+		"eco_id":        ecoID,
+		"changes_count": len(changeIDs),
+	})
+}
+
+// createPartChangeECO opens a draft ECO for the given part changes and moves
+// them from draft to pending.
+func (h *Handler) createPartChangeECO(ipn, user, title, description, priority string, changeIDs []int64, summaryParts []string) (string, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
-	if body.Title == "" {
-		body.Title = fmt.Sprintf("Part changes for %s", ipn)
+	if title == "" {
+		title = fmt.Sprintf("Part changes for %s", ipn)
 	}
-	if body.Priority == "" {
-		body.Priority = "normal"
+	if priority == "" {
+		priority = "normal"
 	}
-	if body.Description == "" {
-		body.Description = "Changes:\n" + strings.Join(summaryParts, "\n")
+	if description == "" {
+		description = "Changes:\n" + strings.Join(summaryParts, "\n")
 	}
 
 	ecoID := h.NextID("ECO", "ecos", 3)
 	ipnsJSON, _ := json.Marshal([]string{ipn})
 
-	_, err = h.DB.Exec("INSERT INTO ecos (id,title,description,status,priority,affected_ipns,created_by,created_at,updated_at) VALUES (?,?,?,?,?,?,?,?,?)",
-		ecoID, body.Title, body.Description, "draft", body.Priority, string(ipnsJSON), user, now, now)
+	_, err := h.DB.Exec("INSERT INTO ecos (id,title,description,status,priority,affected_ipns,created_by,created_at,updated_at) VALUES (?,?,?,?,?,?,?,?,?)",
+		ecoID, title, description, "draft", priority, string(ipnsJSON), user, now, now)
 	if err != nil {
-		response.Err(w, err.Error(), 500)
-		return
+		return "", err
 	}
 	h.EnsureInitialRevision(ecoID, user, now)
 
@@ -198,12 +213,7 @@ func (h *Handler) CreateECOFromChanges(w http.ResponseWriter, r *http.Request, i
 	for _, cid := range changeIDs {
 		h.DB.Exec("UPDATE part_changes SET eco_id=?, status='pending' WHERE id=?", ecoID, cid)
 	}
-
-	h.logAudit(user, "created", "eco", ecoID, fmt.Sprintf("Created ECO from %d part changes for %s", len(changeIDs), ipn))
-	response.JSON(w, map[string]interface{}{
-		"eco_id":        ecoID,
-		"changes_count": len(changeIDs),
-	})
+	return ecoID, nil
 }
 
 // ListECOPartChanges handles GET /api/ecos/:id/part-changes.
@@ -228,7 +238,8 @@ func (h *Handler) ListECOPartChanges(w http.ResponseWriter, r *http.Request, eco
 }
 
 // ApplyPartChangesForECO is called when an ECO is implemented. It applies all
-// pending part_changes linked to the ECO by updating the CSV files on disk.
+// pending part_changes linked to the ECO by updating the CSV files on disk
+// and releases the part revisions drafted on it.
 func (h *Handler) ApplyPartChangesForECO(ecoID string) error {
 	rows, err := h.DB.Query("SELECT id, part_ipn, field_name, new_value FROM part_changes WHERE eco_id=? AND status='pending'", ecoID)
 	if err != nil {
@@ -236,13 +247,32 @@ func (h *Handler) ApplyPartChangesForECO(ecoID string) error {
 	}
 	defer rows.Close()
 
-	// Group changes by part IPN
+	// Group changes by part IPN; BOM replacements go to the BOM file.
 	changesByIPN := make(map[string][]partFieldChange)
+	bomChanges := make(map[string]partFieldChange)
+	var bomIPNs []string
 	for rows.Next() {
 		var id int64
 		var ipn, fn, nv string
 		rows.Scan(&id, &ipn, &fn, &nv)
-		changesByIPN[ipn] = append(changesByIPN[ipn], partFieldChange{id: id, field: fn, newValue: nv})
+		c := partFieldChange{id: id, field: fn, newValue: nv}
+		if fn == partBOMField {
+			if _, ok := bomChanges[ipn]; !ok {
+				bomIPNs = append(bomIPNs, ipn)
+			}
+			bomChanges[ipn] = c
+			continue
+		}
+		changesByIPN[ipn] = append(changesByIPN[ipn], c)
+	}
+
+	for _, ipn := range bomIPNs {
+		c := bomChanges[ipn]
+		status := "applied"
+		if err := h.writeBOMFile(ipn, []byte(c.newValue)); err != nil {
+			status = "rejected"
+		}
+		h.DB.Exec("UPDATE part_changes SET status=? WHERE id=?", status, c.id)
 	}
 
 	for ipn, changes := range changesByIPN {
@@ -257,14 +287,21 @@ func (h *Handler) ApplyPartChangesForECO(ecoID string) error {
 			h.DB.Exec("UPDATE part_changes SET status='applied' WHERE id=?", c.id)
 		}
 	}
-	return nil
+	_, err = h.releaseRevisionsForECO(ecoID)
+	return err
 }
 
-// RejectPartChangesForECO marks all pending changes linked to an ECO as rejected.
+// RejectPartChangesForECO marks all pending changes linked to an ECO as
+// rejected and cancels the revisions drafted on it.
 func (h *Handler) RejectPartChangesForECO(ecoID string) {
 	h.DB.Exec("UPDATE part_changes SET status='rejected' WHERE eco_id=? AND status='pending'", ecoID)
+	h.DB.Exec("UPDATE part_revisions SET status='cancelled' WHERE eco_id=? AND status='draft'", ecoID)
 }
 
+// partDeleteField is the field name of a pending change that deletes the
+// part rather than editing one of its fields.
+const partDeleteField = "_delete"
+
 type partFieldChange struct {
 	id       int64
 	field    string
@@ -277,108 +314,53 @@ func (h *Handler) applyChangesToCSV(ipn string, changes []partFieldChange) error
 	}
 
 	// Find which CSV file contains this IPN
-	csvPath, rowIdx, headers, records, err := h.findPartInCSV(ipn)
+	found, _, err := h.findPartInCSV(ipn)
 	if err != nil {
 		return err
 	}
 
-	// Build header index
-	headerIdx := make(map[string]int)
-	for i, hdr := range headers {
-		headerIdx[hdr] = i
-		headerIdx[strings.ToLower(hdr)] = i
-	}
-
-	// Apply changes to the row
-	row := records[rowIdx]
-	for _, c := range changes {
-		idx, ok := headerIdx[c.field]
-		if !ok {
-			idx, ok = headerIdx[strings.ToLower(c.field)]
-		}
-		if !ok {
-			continue // field not found in CSV, skip
+	return h.editPartCSV(found.path, func(c *partCSV) error {
+		rowIdx := c.find(ipn)
+		if rowIdx < 0 {
+			return fmt.Errorf("part %s not found in %s", ipn, filepath.Base(c.path))
 		}
-		if idx < len(row) {
-			row[idx] = c.newValue
+		row := append([]string(nil), c.records[rowIdx]...)
+		for _, ch := range changes {
+			if ch.field == partDeleteField {
+				c.remove(rowIdx)
+				return nil
+			}
+			idx := c.column(ch.field)
+			if idx < 0 {
+				continue // field not found in CSV, skip
+			}
+			for len(row) <= idx {
+				row = append(row, "")
+			}
+			row[idx] = ch.newValue
 		}
-	}
-	records[rowIdx] = row
-
-	// Write back
-	return writePartCSV(csvPath, records)
+		c.set(rowIdx, row)
+		return nil
+	})
 }
 
-func (h *Handler) findPartInCSV(ipn string) (string, int, []string, [][]string, error) {
-	entries, err := os.ReadDir(h.PartsDir)
+// findPartInCSV returns the CSV file containing ipn and the row index of
+// the part within it.
+func (h *Handler) findPartInCSV(ipn string) (*partCSV, int, error) {
+	csvPaths, err := h.partCSVPaths()
 	if err != nil {
-		return "", 0, nil, nil, err
-	}
-
-	// Check all CSV files
-	var csvPaths []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			catDir := filepath.Join(h.PartsDir, entry.Name())
-			csvFiles, _ := filepath.Glob(filepath.Join(catDir, "*.csv"))
-			csvPaths = append(csvPaths, csvFiles...)
-		} else if strings.HasSuffix(entry.Name(), ".csv") {
-			csvPaths = append(csvPaths, filepath.Join(h.PartsDir, entry.Name()))
-		}
+		return nil, 0, err
 	}
-
 	for _, csvPath := range csvPaths {
-		f, err := os.Open(csvPath)
+		c, err := readPartCSV(csvPath)
 		if err != nil {
 			continue
 		}
-		rd := csv.NewReader(f)
-		rd.LazyQuotes = true
-		rd.TrimLeadingSpace = true
-		records, err := rd.ReadAll()
-		f.Close()
-		if err != nil || len(records) < 2 {
-			continue
-		}
-
-		headers := records[0]
-		// Find IPN column
-		ipnCol := -1
-		for i, hdr := range headers {
-			hl := strings.ToLower(hdr)
-			if hl == "ipn" || hl == "part_number" || hl == "pn" {
-				ipnCol = i
-				break
-			}
+		if rowIdx := c.find(ipn); rowIdx > 0 {
+			return c, rowIdx, nil
 		}
-		if ipnCol == -1 {
-			ipnCol = 0
-		}
-
-		for rowIdx := 1; rowIdx < len(records); rowIdx++ {
-			if ipnCol < len(records[rowIdx]) && records[rowIdx][ipnCol] == ipn {
-				return csvPath, rowIdx, headers, records, nil
-			}
-		}
-	}
-
-	return "", 0, nil, nil, fmt.Errorf("part %s not found in any CSV", ipn)
-}
-
-func writePartCSV(path string, records [][]string) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	err = w.WriteAll(records)
-	if err != nil {
-		return err
 	}
-	w.Flush()
-	return w.Error()
+	return nil, 0, fmt.Errorf("part %s not found in any CSV", ipn)
 }
 
 // ListAllPartChanges handles GET /api/part-changes.
@@ -438,6 +420,7 @@ func (h *Handler) UpdateBOMReferencesForPartIPN(partsDir, oldIPN, newIPN string)
 	}
 
 	// Update each BOM file
+	defer h.catalog().Invalidate()
 	for _, bomPath := range bomFiles {
 		if err := updateIPNInBOMFile(bomPath, oldIPN, newIPN); err != nil {
 			return fmt.Errorf("failed to update BOM %s: %w", bomPath, err)
@@ -2,30 +2,34 @@ package parts
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"zrp/internal/audit"
+	"zrp/internal/catalog"
 	"zrp/internal/models"
 	"zrp/internal/response"
 )
 
-// BOMNode represents a node in the BOM tree.
-type BOMNode struct {
-	IPN         string    `json:"ipn"`
-	Description string    `json:"description"`
-	Qty         float64   `json:"qty,omitempty"`
-	Ref         string    `json:"ref,omitempty"`
-	Children    []BOMNode `json:"children"`
+// GenerationHeader carries the parts catalog generation on parts
+// responses, so clients can tell when cached part data is stale.
+const GenerationHeader = "X-Parts-Generation"
+
+func (h *Handler) setGeneration(w http.ResponseWriter) {
+	w.Header().Set(GenerationHeader, strconv.FormatUint(h.catalog().Generation(), 10))
 }
 
 // ListParts handles GET /api/parts.
 func (h *Handler) ListParts(w http.ResponseWriter, r *http.Request) {
+	h.setGeneration(w)
 	cats, _, _, _ := h.LoadPartsFromDir()
 	category := r.URL.Query().Get("category")
 	q := strings.ToLower(r.URL.Query().Get("q"))
@@ -95,6 +99,7 @@ func (h *Handler) ListParts(w http.ResponseWriter, r *http.Request) {
 
 // GetPart handles GET /api/parts/:ipn.
 func (h *Handler) GetPart(w http.ResponseWriter, r *http.Request, ipn string) {
+	h.setGeneration(w)
 	cats, _, _, _ := h.LoadPartsFromDir()
 	for _, parts := range cats {
 		for _, p := range parts {
@@ -107,6 +112,11 @@ func (h *Handler) GetPart(w http.ResponseWriter, r *http.Request, ipn string) {
 	response.Err(w, "part not found", 404)
 }
 
+var (
+	errIPNExists        = errors.New("IPN already exists")
+	errCategoryNotFound = errors.New("category not found")
+)
+
 // CreatePart handles POST /api/parts.
 func (h *Handler) CreatePart(w http.ResponseWriter, r *http.Request) {
 	var body struct {
@@ -118,7 +128,10 @@ func (h *Handler) CreatePart(w http.ResponseWriter, r *http.Request) {
 		response.Err(w, "invalid request body", 400)
 		return
 	}
-	if body.IPN == "" {
+	// Without an IPN, a category with a numbering scheme hands out the
+	// next one.
+	scheme := h.ipnScheme(body.Category)
+	if body.IPN == "" && scheme == nil {
 		response.Err(w, "ipn is required", 400)
 		return
 	}
@@ -126,74 +139,111 @@ func (h *Handler) CreatePart(w http.ResponseWriter, r *http.Request) {
 		response.Err(w, "category is required", 400)
 		return
 	}
+	user := h.getUsername(r)
+	var reserved *IPNReservation
+	if body.IPN == "" {
+		if h.FindCategoryCSV(body.Category) == "" {
+			response.Err(w, errCategoryNotFound.Error(), 404)
+			return
+		}
+		res, err := h.reserveIPN(body.Category, "", user)
+		if err == errIPNBusy {
+			response.Err(w, err.Error(), 503)
+			return
+		} else if err == errIPNSequenceExhausted {
+			response.Err(w, err.Error(), 422)
+			return
+		} else if err != nil {
+			response.Err(w, err.Error(), 409)
+			return
+		}
+		body.IPN = res.IPN
+		reserved = &res
+	} else if by, ok := h.ipnReservedBy(body.IPN); ok && by != user {
+		response.Err(w, fmt.Sprintf("IPN %s is reserved by %s", body.IPN, by), 409)
+		return
+	}
 
+	part, err := h.createPart(body.IPN, body.Category, body.Fields)
+	if err != nil && reserved != nil {
+		// The IPN was only reserved for this part; hand it back.
+		if rerr := h.releaseIPN(*reserved); rerr != nil {
+			log.Printf("release IPN %s: %v", reserved.IPN, rerr)
+		}
+	}
+	var schemeErr *IPNSchemeError
+	if errors.As(err, &schemeErr) {
+		response.Err(w, err.Error(), 400)
+		return
+	} else if err == errCategoryNotFound {
+		response.Err(w, err.Error(), 404)
+		return
+	} else if err == errIPNExists || err == ErrCSVLocked {
+		response.Err(w, err.Error(), 409)
+		return
+	} else if err != nil {
+		response.Err(w, "failed to write CSV", 500)
+		return
+	}
+	h.markIPNUsed(body.IPN)
+	response.JSON(w, part)
+}
+
+// createPart appends a part to the CSV of category. Fields are matched to
+// the file's columns by exact or lower-cased name; others are ignored. An
+// IPN that breaks the category's enforced scheme is an *IPNSchemeError.
+func (h *Handler) createPart(ipn, category string, fields map[string]string) (models.Part, error) {
 	// Find the CSV file for this category
-	csvPath := h.FindCategoryCSV(body.Category)
+	csvPath := h.FindCategoryCSV(category)
 	if csvPath == "" {
-		response.Err(w, "category not found", 404)
-		return
+		return models.Part{}, errCategoryNotFound
+	}
+	if err := h.checkIPNScheme(category, ipn); err != nil {
+		return models.Part{}, err
 	}
 
 	// Check IPN uniqueness across all categories
 	cats, _, _, _ := h.LoadPartsFromDir()
 	for _, parts := range cats {
 		for _, p := range parts {
-			if p.IPN == body.IPN {
-				response.Err(w, "IPN already exists", 409)
-				return
+			if p.IPN == ipn {
+				return models.Part{}, errIPNExists
 			}
 		}
 	}
 
-	// Read existing CSV to get headers
-	f, err := os.Open(csvPath)
-	if err != nil {
-		response.Err(w, "failed to read category CSV", 500)
-		return
-	}
-	csvReader := csv.NewReader(f)
-	csvReader.LazyQuotes = true
-	csvReader.TrimLeadingSpace = true
-	records, err := csvReader.ReadAll()
-	f.Close()
-	if err != nil || len(records) < 1 {
-		response.Err(w, "failed to parse category CSV", 500)
-		return
-	}
-
-	headers := records[0]
-
-	// Build the new row
-	row := make([]string, len(headers))
-	for i, hdr := range headers {
-		hl := strings.ToLower(hdr)
-		if hl == "ipn" || hl == "part_number" || hl == "pn" {
-			row[i] = body.IPN
-		} else if v, ok := body.Fields[hdr]; ok {
-			row[i] = v
-		} else if v, ok := body.Fields[strings.ToLower(hdr)]; ok {
-			row[i] = v
+	// Append the row under the file lock, keeping the title line and the
+	// existing rows as they are.
+	var headers, row []string
+	err := h.editPartCSV(csvPath, func(c *partCSV) error {
+		if c.find(ipn) > 0 {
+			return errIPNExists
 		}
-	}
-
-	// Append to CSV
-	records = append(records, row)
-	wf, err := os.Create(csvPath)
+		headers = c.headers()
+		row = make([]string, len(headers))
+		for i, hdr := range headers {
+			hl := strings.ToLower(hdr)
+			if hl == "ipn" || hl == "part_number" || hl == "pn" {
+				row[i] = ipn
+			} else if v, ok := fields[hdr]; ok {
+				row[i] = v
+			} else if v, ok := fields[strings.ToLower(hdr)]; ok {
+				row[i] = v
+			}
+		}
+		c.append(row)
+		return nil
+	})
 	if err != nil {
-		response.Err(w, "failed to write CSV", 500)
-		return
+		return models.Part{}, err
 	}
-	csvWriter := csv.NewWriter(wf)
-	csvWriter.WriteAll(records)
-	wf.Close()
 
-	fields := make(map[string]string)
+	out := make(map[string]string)
 	for i, hdr := range headers {
-		fields[hdr] = row[i]
+		out[hdr] = row[i]
 	}
-	fields["_category"] = body.Category
-
-	response.JSON(w, models.Part{IPN: body.IPN, Fields: fields})
+	out["_category"] = category
+	return models.Part{IPN: ipn, Fields: out}, nil
 }
 
 // findCategoryCSV locates the CSV file for a given category name.
@@ -255,6 +305,7 @@ func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	csvWriter.Write([]string{"IPN", "description", "manufacturer", "value"})
 	csvWriter.Flush()
 	f.Close()
+	h.catalog().Invalidate()
 
 	catID := strings.TrimSuffix(filename, ".csv")
 	response.JSON(w, models.Category{ID: catID, Name: body.Title, Count: 0, Columns: []string{"IPN", "description", "manufacturer", "value"}})
@@ -280,207 +331,398 @@ func (h *Handler) CheckIPN(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
-	response.JSON(w, map[string]bool{"exists": exists})
+	out := map[string]interface{}{"exists": exists}
+	// Check the IPN against the scheme of ?category=, else of the scheme
+	// whose prefix it starts with.
+	scheme := h.ipnScheme(r.URL.Query().Get("category"))
+	if scheme == nil && r.URL.Query().Get("category") == "" {
+		scheme = h.schemeForIPN(ipn)
+	}
+	if scheme != nil {
+		_, _, problem := scheme.parse(ipn)
+		out["category"] = scheme.Category
+		out["valid"] = problem == ""
+		if problem != "" {
+			out["problem"] = problem
+		}
+		_, reserved := h.ipnReservedBy(ipn)
+		out["reserved"] = reserved
+	}
+	response.JSON(w, out)
 }
 
-// UpdatePart handles PUT /api/parts/:ipn.
-func (h *Handler) UpdatePart(w http.ResponseWriter, r *http.Request, ipn string) {
-	response.Err(w, "updating parts via API not yet supported -- edit CSVs directly", 501)
+// releasedStatuses are status/lifecycle values marking a part as released
+// to production.
+var releasedStatuses = map[string]bool{"released": true, "production": true}
+
+// isReleasedPart reports whether a part's status or lifecycle column marks
+// it as released.
+func isReleasedPart(fields map[string]string) bool {
+	for k, v := range fields {
+		kl := strings.ToLower(k)
+		if (kl == "status" || kl == "lifecycle") && releasedStatuses[strings.ToLower(strings.TrimSpace(v))] {
+			return true
+		}
+	}
+	return false
 }
 
-// DeletePart handles DELETE /api/parts/:ipn.
-func (h *Handler) DeletePart(w http.ResponseWriter, r *http.Request, ipn string) {
-	response.Err(w, "deleting parts via API not yet supported -- edit CSVs directly", 501)
+// requireECOForReleased reports whether edits to released parts must go
+// through an ECO (app setting parts_require_eco_for_released).
+func (h *Handler) requireECOForReleased() bool {
+	var v string
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='parts_require_eco_for_released'").Scan(&v)
+	return v == "true"
 }
 
-// ListCategories handles GET /api/parts/categories.
-func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
-	cats, schemas, titles, _ := h.LoadPartsFromDir()
-	var result []models.Category
-	for name, parts := range cats {
-		cols := schemas[name]
-		if cols == nil {
-			cols = []string{}
-		}
-		displayName := titles[name]
-		if displayName == "" {
-			displayName = name // Fallback to filename if no title
+// partEditBody is the optional ECO routing part of an update or delete.
+type partEditBody struct {
+	// ViaECO records the edit as pending part changes on a new ECO instead
+	// of writing the CSV. Forced for released parts when
+	// parts_require_eco_for_released is on.
+	ViaECO         bool   `json:"via_eco"`
+	ECOTitle       string `json:"eco_title"`
+	ECODescription string `json:"eco_description"`
+	ECOPriority    string `json:"eco_priority"`
+}
+
+// routeThroughECO stores changes as pending part_changes on a new ECO and
+// writes the 202 response.
+func (h *Handler) routeThroughECO(w http.ResponseWriter, r *http.Request, ipn string, opts partEditBody, changes []PartChange) {
+	user := h.getUsername(r)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	var ids []int64
+	var summary []string
+	for i, c := range changes {
+		res, err := h.DB.Exec(
+			"INSERT INTO part_changes (part_ipn, field_name, old_value, new_value, status, created_by, created_at) VALUES (?,?,?,?,?,?,?)",
+			ipn, c.FieldName, c.OldValue, c.NewValue, "draft", user, now)
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+		changes[i].ID, changes[i].PartIPN, changes[i].CreatedBy, changes[i].CreatedAt = id, ipn, user, now
+		if c.FieldName == partDeleteField {
+			summary = append(summary, "delete part "+ipn)
+		} else if c.FieldName == partBOMField {
+			summary = append(summary, fmt.Sprintf("replace BOM %s.csv (%d lines)", ipn, strings.Count(c.NewValue, "\n")-1))
+		} else {
+			summary = append(summary, fmt.Sprintf("%s: %q -> %q", c.FieldName, c.OldValue, c.NewValue))
 		}
-		result = append(result, models.Category{ID: name, Name: displayName, Count: len(parts), Columns: cols})
 	}
-	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
-	response.JSON(w, result)
+	ecoID, err := h.createPartChangeECO(ipn, user, opts.ECOTitle, opts.ECODescription, opts.ECOPriority, ids, summary)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	for i := range changes {
+		changes[i].ECOID, changes[i].Status = ecoID, "pending"
+	}
+	h.logAudit(user, "created", "eco", ecoID, fmt.Sprintf("Created ECO for %d change(s) to %s", len(changes), ipn))
+	w.WriteHeader(http.StatusAccepted)
+	response.JSON(w, map[string]interface{}{"status": "pending_eco", "eco_id": ecoID, "changes": changes})
 }
 
-// AddColumn handles POST /api/parts/categories/:id/columns.
-func (h *Handler) AddColumn(w http.ResponseWriter, r *http.Request, catID string) {
+// UpdatePart handles PUT /api/parts/:ipn. Only existing columns can be set
+// and the IPN itself cannot be changed.
+func (h *Handler) UpdatePart(w http.ResponseWriter, r *http.Request, ipn string) {
 	var body struct {
-		Name string `json:"name"`
+		Fields map[string]string `json:"fields"`
+		partEditBody
 	}
-	if err := response.DecodeBody(r, &body); err != nil || body.Name == "" {
-		response.Err(w, "name required", 400)
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid request body", 400)
 		return
 	}
-	// Would need to modify CSV files - stub for now
-	response.JSON(w, map[string]string{"status": "column add not yet implemented for CSV backend"})
-}
-
-// DeleteColumn handles DELETE /api/parts/categories/:id/columns/:name.
-func (h *Handler) DeleteColumn(w http.ResponseWriter, r *http.Request, catID, colName string) {
-	response.JSON(w, map[string]string{"status": "column delete not yet implemented for CSV backend"})
-}
-
-// PartBOM handles GET /api/parts/:ipn/bom.
-func (h *Handler) PartBOM(w http.ResponseWriter, r *http.Request, ipn string) {
-	// Only works for assembly IPNs
-	upper := strings.ToUpper(ipn)
-	if !strings.HasPrefix(upper, "PCA-") && !strings.HasPrefix(upper, "ASY-") {
-		response.Err(w, "BOM only available for assembly IPNs (PCA, ASY prefix)", 400)
+	delete(body.Fields, "_category")
+	if len(body.Fields) == 0 {
+		response.Err(w, "fields are required", 400)
 		return
 	}
 
-	node, err := h.buildBOMTree(ipn, 0, 5)
+	found, rowIdx, err := h.findPartInCSV(ipn)
 	if err != nil {
-		response.Err(w, err.Error(), 404)
+		response.Err(w, "part not found", 404)
 		return
 	}
-	response.JSON(w, node)
-}
-
-func (h *Handler) buildBOMTree(ipn string, depth, maxDepth int) (*BOMNode, error) {
-	if depth > maxDepth {
-		return &BOMNode{IPN: ipn, Description: "(max depth reached)", Children: []BOMNode{}}, nil
+	headers := found.headers()
+	before := make(map[string]string)
+	for i, hdr := range headers {
+		if i < len(found.records[rowIdx]) {
+			before[hdr] = found.records[rowIdx][i]
+		}
 	}
 
-	// Look up part description
-	desc := ""
-	fields, _ := h.GetPartByIPN(h.PartsDir, ipn)
-	if fields != nil {
-		for k, v := range fields {
-			if strings.EqualFold(k, "description") || strings.EqualFold(k, "desc") {
-				desc = v
-				break
+	var unknown []string
+	var changes []PartChange
+	for name, value := range body.Fields {
+		idx := found.column(name)
+		if idx < 0 {
+			unknown = append(unknown, name)
+			continue
+		}
+		if idx == found.ipnColumn() {
+			if value != ipn {
+				response.Err(w, "the IPN column cannot be changed", 400)
+				return
 			}
+			continue
+		}
+		if old := before[headers[idx]]; old != value {
+			changes = append(changes, PartChange{FieldName: headers[idx], OldValue: old, NewValue: value})
 		}
 	}
-
-	node := &BOMNode{IPN: ipn, Description: desc, Children: []BOMNode{}}
-
-	// Try to find BOM CSV: look for <IPN>.csv in PartsDir
-	if h.PartsDir == "" {
-		return node, nil
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		response.Err(w, "unknown field(s): "+strings.Join(unknown, ", ")+" -- add the column to the category first", 400)
+		return
 	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].FieldName < changes[j].FieldName })
 
-	// Search for BOM file: try exact IPN.csv, then in subdirectories
-	bomPaths := []string{
-		filepath.Join(h.PartsDir, ipn+".csv"),
+	if len(changes) > 0 && (body.ViaECO || (isReleasedPart(before) && h.requireECOForReleased())) {
+		h.routeThroughECO(w, r, ipn, body.partEditBody, changes)
+		return
 	}
-	// Also check subdirectories
-	entries, _ := os.ReadDir(h.PartsDir)
-	for _, e := range entries {
-		if e.IsDir() {
-			bomPaths = append(bomPaths, filepath.Join(h.PartsDir, e.Name(), ipn+".csv"))
-		}
+
+	after := make(map[string]string, len(before))
+	for k, v := range before {
+		after[k] = v
 	}
+	if len(changes) > 0 {
+		err = h.editPartCSV(found.path, func(c *partCSV) error {
+			row := c.find(ipn)
+			if row < 0 {
+				return fmt.Errorf("part %s was removed", ipn)
+			}
+			rec := append([]string(nil), c.records[row]...)
+			for _, ch := range changes {
+				idx := c.column(ch.FieldName)
+				if idx < 0 {
+					return fmt.Errorf("column %s was removed", ch.FieldName)
+				}
+				for len(rec) <= idx {
+					rec = append(rec, "")
+				}
+				rec[idx] = ch.NewValue
+				after[ch.FieldName] = ch.NewValue
+			}
+			c.set(row, rec)
+			return nil
+		})
+		if err == ErrCSVLocked {
+			response.Err(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			response.Err(w, "failed to update part: "+err.Error(), 500)
+			return
+		}
+		audit.LogUpdateWithDiff(h.DB, h.Hub, r, "part", ipn, before, after)
+	}
+
+	fields := after
+	fields["_category"] = h.categoryOf(found.path)
+	response.JSON(w, models.Part{IPN: ipn, Fields: fields})
+}
 
-	var bomFile string
-	for _, p := range bomPaths {
-		if _, err := os.Stat(p); err == nil {
-			bomFile = p
-			break
+// DeletePart handles DELETE /api/parts/:ipn. The body is optional; see
+// partEditBody for routing the delete through an ECO.
+func (h *Handler) DeletePart(w http.ResponseWriter, r *http.Request, ipn string) {
+	var body partEditBody
+	if r.ContentLength > 0 {
+		if err := response.DecodeBody(r, &body); err != nil {
+			response.Err(w, "invalid request body", 400)
+			return
 		}
 	}
-
-	if bomFile == "" {
-		return node, nil
+	if r.URL.Query().Get("via_eco") == "true" {
+		body.ViaECO = true
 	}
 
-	f, err := os.Open(bomFile)
+	found, rowIdx, err := h.findPartInCSV(ipn)
 	if err != nil {
-		return node, nil
+		response.Err(w, "part not found", 404)
+		return
+	}
+	fields := make(map[string]string)
+	for i, hdr := range found.headers() {
+		if i < len(found.records[rowIdx]) {
+			fields[hdr] = found.records[rowIdx][i]
+		}
 	}
-	defer f.Close()
 
-	rdr := csv.NewReader(f)
-	rdr.LazyQuotes = true
-	rdr.TrimLeadingSpace = true
-	records, err := rdr.ReadAll()
-	if err != nil || len(records) < 2 {
-		return node, nil
+	if body.ViaECO || (isReleasedPart(fields) && h.requireECOForReleased()) {
+		h.routeThroughECO(w, r, ipn, body, []PartChange{{FieldName: partDeleteField, OldValue: ipn}})
+		return
 	}
 
-	headers := records[0]
-	ipnIdx, qtyIdx, refIdx, descIdx := -1, -1, -1, -1
-	for i, hdr := range headers {
-		hl := strings.ToLower(hdr)
-		switch {
-		case hl == "ipn" || hl == "part_number" || hl == "pn":
-			ipnIdx = i
-		case hl == "qty" || hl == "quantity":
-			qtyIdx = i
-		case hl == "ref" || hl == "reference" || hl == "designator" || hl == "ref_des":
-			refIdx = i
-		case hl == "description" || hl == "desc":
-			descIdx = i
+	err = h.editPartCSV(found.path, func(c *partCSV) error {
+		row := c.find(ipn)
+		if row < 0 {
+			return fmt.Errorf("part %s was removed", ipn)
 		}
+		c.remove(row)
+		return nil
+	})
+	if err == ErrCSVLocked {
+		response.Err(w, err.Error(), 409)
+		return
+	} else if err != nil {
+		response.Err(w, "failed to delete part: "+err.Error(), 500)
+		return
 	}
-	if ipnIdx == -1 {
-		ipnIdx = 0
+	h.logAudit(h.getUsername(r), "deleted", "part", ipn, fmt.Sprintf("Deleted part %s from %s", ipn, filepath.Base(found.path)))
+	response.JSON(w, map[string]string{"status": "deleted", "ipn": ipn})
+}
+
+// categoryOf returns the category ID for a parts CSV path, matching
+// LoadPartsFromDirImpl.
+func (h *Handler) categoryOf(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Clean(dir) != filepath.Clean(h.PartsDir) {
+		return strings.ToLower(filepath.Base(dir))
 	}
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".csv"))
+}
 
-	for _, row := range records[1:] {
-		if ipnIdx >= len(row) {
-			continue
-		}
-		childIPN := strings.TrimSpace(row[ipnIdx])
-		if childIPN == "" {
-			continue
-		}
-		var qty float64 = 1
-		if qtyIdx >= 0 && qtyIdx < len(row) {
-			if q, err := strconv.ParseFloat(strings.TrimSpace(row[qtyIdx]), 64); err == nil {
-				qty = q
-			}
+// ListCategories handles GET /api/parts/categories.
+func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	cats, schemas, titles, _ := h.LoadPartsFromDir()
+	var result []models.Category
+	for name, parts := range cats {
+		cols := schemas[name]
+		if cols == nil {
+			cols = []string{}
 		}
-		ref := ""
-		if refIdx >= 0 && refIdx < len(row) {
-			ref = strings.TrimSpace(row[refIdx])
+		displayName := titles[name]
+		if displayName == "" {
+			displayName = name // Fallback to filename if no title
 		}
-		childDesc := ""
-		if descIdx >= 0 && descIdx < len(row) {
-			childDesc = strings.TrimSpace(row[descIdx])
+		result = append(result, models.Category{ID: name, Name: displayName, Count: len(parts), Columns: cols})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	response.JSON(w, result)
+}
+
+// validColumnName rejects names that would break the CSV header or clash
+// with internal fields.
+func validColumnName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "_") && !strings.ContainsAny(name, "\r\n") && strings.TrimSpace(name) == name
+}
+
+// categoryResponse returns the current state of a category after a column
+// edit.
+func (h *Handler) categoryResponse(w http.ResponseWriter, catID string) {
+	cats, schemas, titles, _ := h.LoadPartsFromDir()
+	id := strings.ToLower(catID)
+	name := titles[id]
+	if name == "" {
+		name = id
+	}
+	cols := schemas[id]
+	if cols == nil {
+		cols = []string{}
+	}
+	response.JSON(w, models.Category{ID: id, Name: name, Count: len(cats[id]), Columns: cols})
+}
+
+// AddColumn handles POST /api/parts/categories/:id/columns. The column is
+// appended to every CSV in the category, filled with the optional default.
+func (h *Handler) AddColumn(w http.ResponseWriter, r *http.Request, catID string) {
+	var body struct {
+		Name    string `json:"name"`
+		Default string `json:"default"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil || body.Name == "" {
+		response.Err(w, "name required", 400)
+		return
+	}
+	if !validColumnName(body.Name) {
+		response.Err(w, "invalid column name", 400)
+		return
+	}
+	paths := h.categoryCSVPaths(catID)
+	if len(paths) == 0 {
+		response.Err(w, "category not found", 404)
+		return
+	}
+	for _, p := range paths {
+		c, err := readPartCSV(p)
+		if err == nil && c.column(body.Name) >= 0 {
+			response.Err(w, "column already exists", 409)
+			return
 		}
+	}
 
-		childUpper := strings.ToUpper(childIPN)
-		if strings.HasPrefix(childUpper, "PCA-") || strings.HasPrefix(childUpper, "ASY-") {
-			// Recursively expand sub-assemblies
-			childNode, _ := h.buildBOMTree(childIPN, depth+1, maxDepth)
-			if childNode != nil {
-				childNode.Qty = qty
-				childNode.Ref = ref
-				if childNode.Description == "" {
-					childNode.Description = childDesc
-				}
-				node.Children = append(node.Children, *childNode)
+	for _, p := range paths {
+		err := h.editPartCSV(p, func(c *partCSV) error {
+			if c.column(body.Name) >= 0 {
+				return nil
 			}
-		} else {
-			// Leaf part - get description from parts DB if not in BOM
-			if childDesc == "" {
-				childFields, _ := h.GetPartByIPN(h.PartsDir, childIPN)
-				if childFields != nil {
-					for k, v := range childFields {
-						if strings.EqualFold(k, "description") || strings.EqualFold(k, "desc") {
-							childDesc = v
-							break
-						}
-					}
-				}
+			c.addColumn(body.Name, body.Default)
+			return nil
+		})
+		if err == ErrCSVLocked {
+			response.Err(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			response.Err(w, "failed to add column: "+err.Error(), 500)
+			return
+		}
+	}
+	h.logAudit(h.getUsername(r), "updated", "part_category", strings.ToLower(catID), fmt.Sprintf("Added column %q", body.Name))
+	h.categoryResponse(w, catID)
+}
+
+// DeleteColumn handles DELETE /api/parts/categories/:id/columns/:name. The
+// IPN column cannot be removed.
+func (h *Handler) DeleteColumn(w http.ResponseWriter, r *http.Request, catID, colName string) {
+	paths := h.categoryCSVPaths(catID)
+	if len(paths) == 0 {
+		response.Err(w, "category not found", 404)
+		return
+	}
+	if isIPNHeader(colName) {
+		response.Err(w, "the IPN column cannot be removed", 400)
+		return
+	}
+	exists := false
+	for _, p := range paths {
+		c, err := readPartCSV(p)
+		if err != nil {
+			continue
+		}
+		if idx := c.column(colName); idx >= 0 {
+			if idx == c.ipnColumn() {
+				response.Err(w, "the IPN column cannot be removed", 400)
+				return
 			}
-			node.Children = append(node.Children, BOMNode{IPN: childIPN, Description: childDesc, Qty: qty, Ref: ref, Children: []BOMNode{}})
+			exists = true
 		}
 	}
+	if !exists {
+		response.Err(w, "column not found", 404)
+		return
+	}
 
-	return node, nil
+	for _, p := range paths {
+		err := h.editPartCSV(p, func(c *partCSV) error {
+			if idx := c.column(colName); idx >= 0 {
+				c.removeColumn(idx)
+			}
+			return nil
+		})
+		if err == ErrCSVLocked {
+			response.Err(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			response.Err(w, "failed to delete column: "+err.Error(), 500)
+			return
+		}
+	}
+	h.logAudit(h.getUsername(r), "updated", "part_category", strings.ToLower(catID), fmt.Sprintf("Removed column %q", colName))
+	h.categoryResponse(w, catID)
 }
 
 // PartCost handles GET /api/parts/:ipn/cost.
@@ -504,89 +746,27 @@ func (h *Handler) PartCost(w http.ResponseWriter, r *http.Request, ipn string) {
 		result["last_ordered"] = lastOrdered
 	}
 
-	// BOM cost for assemblies
-	upper := strings.ToUpper(ipn)
-	if strings.HasPrefix(upper, "PCA-") || strings.HasPrefix(upper, "ASY-") {
-		bomCost := h.calcBOMCost(ipn, 0, 5)
-		result["bom_cost"] = bomCost
-	}
-
-	response.JSON(w, result)
-}
-
-func (h *Handler) calcBOMCost(ipn string, depth, maxDepth int) float64 {
-	if depth > maxDepth || h.PartsDir == "" {
-		return 0
-	}
-	// Find BOM file
-	bomPaths := []string{filepath.Join(h.PartsDir, ipn+".csv")}
-	entries, _ := os.ReadDir(h.PartsDir)
-	for _, e := range entries {
-		if e.IsDir() {
-			bomPaths = append(bomPaths, filepath.Join(h.PartsDir, e.Name(), ipn+".csv"))
-		}
-	}
-	var bomFile string
-	for _, p := range bomPaths {
-		if _, err := os.Stat(p); err == nil {
-			bomFile = p
-			break
-		}
-	}
-	if bomFile == "" {
-		return 0
-	}
-	f, err := os.Open(bomFile)
-	if err != nil {
-		return 0
-	}
-	defer f.Close()
-	rdr := csv.NewReader(f)
-	rdr.LazyQuotes = true
-	rdr.TrimLeadingSpace = true
-	records, err := rdr.ReadAll()
-	if err != nil || len(records) < 2 {
-		return 0
-	}
-	headers := records[0]
-	ipnIdx, qtyIdx := -1, -1
-	for i, hdr := range headers {
-		hl := strings.ToLower(hdr)
-		if hl == "ipn" || hl == "part_number" || hl == "pn" {
-			ipnIdx = i
-		}
-		if hl == "qty" || hl == "quantity" {
-			qtyIdx = i
-		}
-	}
-	if ipnIdx == -1 {
-		ipnIdx = 0
-	}
-	var total float64
-	for _, row := range records[1:] {
-		if ipnIdx >= len(row) {
-			continue
-		}
-		childIPN := strings.TrimSpace(row[ipnIdx])
-		if childIPN == "" {
-			continue
+	// BOM cost for assemblies, priced by ?method= (default from the BOM
+	// settings). Parts without a price are listed in bom_missing. A circular
+	// BOM has no cost; the cycle is reported instead.
+	if h.isAssembly(h.assemblyRules(), ipn) {
+		method, _, err := h.costParams(r)
+		if err != nil {
+			response.Err(w, err.Error(), 400)
+			return
 		}
-		var qty float64 = 1
-		if qtyIdx >= 0 && qtyIdx < len(row) {
-			if q, e := strconv.ParseFloat(strings.TrimSpace(row[qtyIdx]), 64); e == nil {
-				qty = q
-			}
-		}
-		childUpper := strings.ToUpper(childIPN)
-		if strings.HasPrefix(childUpper, "PCA-") || strings.HasPrefix(childUpper, "ASY-") {
-			total += qty * h.calcBOMCost(childIPN, depth+1, maxDepth)
-		} else {
-			var price float64
-			h.DB.QueryRow("SELECT pl.unit_price FROM po_lines pl JOIN purchase_orders po ON po.id=pl.po_id WHERE pl.ipn=? AND pl.unit_price>0 ORDER BY po.created_at DESC LIMIT 1", childIPN).Scan(&price)
-			total += qty * price
+		roll, err := h.costRollup(ipn, method, 1)
+		if cerr, ok := err.(*BOMCycleError); ok {
+			result["bom_error"] = cerr.Error()
+			result["bom_cycle"] = cerr.Path
+		} else if err == nil {
+			result["bom_cost"] = roll.UnitCost
+			result["bom_cost_method"] = roll.Method
+			result["bom_missing"] = roll.Missing
 		}
 	}
-	return total
+
+	response.JSON(w, result)
 }
 
 // Dashboard handles GET /api/dashboard.
@@ -610,54 +790,10 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 // LoadPartsFromDirImpl is the default implementation of LoadPartsFromDir.
-// It reads parts from CSV files in the parts directory.
+// It returns the parts in the catalog, which re-reads only the CSV files
+// that changed since the last call.
 func (h *Handler) LoadPartsFromDirImpl() (map[string][]models.Part, map[string][]string, map[string]string, error) {
-	categories := make(map[string][]models.Part)
-	schemas := make(map[string][]string)
-	titles := make(map[string]string)
-
-	if h.PartsDir == "" {
-		return categories, schemas, titles, nil
-	}
-
-	entries, err := os.ReadDir(h.PartsDir)
-	if err != nil {
-		return categories, schemas, titles, err
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			catDir := filepath.Join(h.PartsDir, entry.Name())
-			csvFiles, _ := filepath.Glob(filepath.Join(catDir, "*.csv"))
-			catName := strings.ToLower(entry.Name())
-			for _, csvFile := range csvFiles {
-				parts, cols, title, err := ReadCSV(csvFile, catName)
-				if err != nil {
-					continue
-				}
-				categories[catName] = append(categories[catName], parts...)
-				if len(cols) > len(schemas[catName]) {
-					schemas[catName] = cols
-				}
-				if title != "" {
-					titles[catName] = title
-				}
-			}
-		} else if strings.HasSuffix(entry.Name(), ".csv") {
-			catName := strings.TrimSuffix(entry.Name(), ".csv")
-			catName = strings.ToLower(catName)
-			parts, cols, title, err := ReadCSV(filepath.Join(h.PartsDir, entry.Name()), catName)
-			if err != nil {
-				continue
-			}
-			categories[catName] = append(categories[catName], parts...)
-			schemas[catName] = cols
-			if title != "" {
-				titles[catName] = title
-			}
-		}
-	}
-	return categories, schemas, titles, nil
+	return h.catalog().Parts()
 }
 
 // ReadCSV reads a CSV file and returns parts, headers, title, and any error.
@@ -666,69 +802,22 @@ func ReadCSV(path string, category string) ([]models.Part, []string, string, err
 	if err != nil {
 		return nil, nil, "", err
 	}
-
-	// Extract title from comment line if present: # TITLE: <title>
-	title := ""
-	lines := strings.Split(string(content), "\n")
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "# TITLE:") {
-		title = strings.TrimSpace(strings.TrimPrefix(lines[0], "# TITLE:"))
-		// Remove the comment line for CSV parsing
-		content = []byte(strings.Join(lines[1:], "\n"))
-	}
-
-	r := csv.NewReader(strings.NewReader(string(content)))
-	r.LazyQuotes = true
-	r.TrimLeadingSpace = true
-	records, err := r.ReadAll()
-	if err != nil {
-		return nil, nil, "", err
-	}
-	if len(records) < 1 {
-		return nil, nil, "", fmt.Errorf("empty csv")
-	}
-
-	headers := records[0]
-	var parts []models.Part
-	for _, row := range records[1:] {
-		fields := make(map[string]string)
-		ipn := ""
-		for i, hdr := range headers {
-			if i < len(row) {
-				fields[hdr] = row[i]
-				hl := strings.ToLower(hdr)
-				if hl == "ipn" || hl == "part_number" || hl == "pn" {
-					ipn = row[i]
-				}
-			}
-		}
-		fields["_category"] = category
-		if ipn == "" {
-			// Try to derive from filename
-			ipn = fields[headers[0]]
-		}
-		if ipn != "" {
-			parts = append(parts, models.Part{IPN: ipn, Fields: fields})
-		}
-	}
-	return parts, headers, title, nil
+	parts, headers, title, _, err := catalog.ParseCSV(content, category)
+	return parts, headers, title, err
 }
 
 // GetPartByIPNImpl is the default implementation of GetPartByIPN.
-// It looks up a single IPN across all CSV categories and returns its fields.
+// It looks up a single IPN in the catalog's index and returns its fields.
 func (h *Handler) GetPartByIPNImpl(pmDir, ipn string) (map[string]string, error) {
 	if pmDir == "" {
 		return nil, fmt.Errorf("no parts directory configured")
 	}
-	cats, _, _, err := h.LoadPartsFromDir()
-	if err != nil {
-		return nil, err
+	c := h.catalog()
+	if pmDir != c.Dir() {
+		c = catalog.New(pmDir)
 	}
-	for _, parts := range cats {
-		for _, p := range parts {
-			if p.IPN == ipn {
-				return p.Fields, nil
-			}
-		}
+	if p, ok := c.Get(ipn); ok {
+		return p.Fields, nil
 	}
 	return nil, fmt.Errorf("part not found: %s", ipn)
 }
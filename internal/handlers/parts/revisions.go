@@ -0,0 +1,435 @@
+package parts
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/models"
+	"zrp/internal/response"
+)
+
+// PartRevision is one item revision of a part. Revisions raised on an ECO
+// stay draft until the ECO is implemented; the others are released when
+// created. A released revision is superseded when a newer one is released
+// but stays in effect for builds dated before the newer one's
+// effective_date.
+type PartRevision struct {
+	ID            int     `json:"id"`
+	IPN           string  `json:"ipn"`
+	Revision      string  `json:"revision"`
+	Status        string  `json:"status"`
+	ECOID         string  `json:"eco_id,omitempty"`
+	EffectiveDate string  `json:"effective_date,omitempty"`
+	Notes         string  `json:"notes,omitempty"`
+	CreatedBy     string  `json:"created_by"`
+	CreatedAt     string  `json:"created_at"`
+	ReleasedAt    *string `json:"released_at,omitempty"`
+}
+
+var revisionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]{0,15}$`)
+
+func today() string { return time.Now().Format("2006-01-02") }
+
+// partRevisions lists the revisions of ipn, newest first.
+func (h *Handler) partRevisions(ipn string) ([]PartRevision, error) {
+	rows, err := h.DB.Query(`SELECT id, ipn, revision, status, COALESCE(eco_id,''), COALESCE(effective_date,''),
+		COALESCE(notes,''), COALESCE(created_by,''), created_at, released_at
+		FROM part_revisions WHERE ipn=? ORDER BY id DESC`, ipn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revs := []PartRevision{}
+	for rows.Next() {
+		var rev PartRevision
+		var released sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.IPN, &rev.Revision, &rev.Status, &rev.ECOID, &rev.EffectiveDate,
+			&rev.Notes, &rev.CreatedBy, &rev.CreatedAt, &released); err != nil {
+			return nil, err
+		}
+		if released.Valid {
+			rev.ReleasedAt = &released.String
+		}
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+// revisionAt returns the revision of ipn in effect on date: the released
+// or superseded revision with the latest effective_date on or before it.
+// It is "" when the part has no revision in effect.
+func (h *Handler) revisionAt(ipn, date string) string {
+	if h.DB == nil {
+		return ""
+	}
+	var rev string
+	h.DB.QueryRow(`SELECT revision FROM part_revisions
+		WHERE ipn=? AND status IN ('released','superseded') AND effective_date<=?
+		ORDER BY effective_date DESC, id DESC LIMIT 1`, ipn, date).Scan(&rev)
+	return rev
+}
+
+// revisionStatus returns the status of one revision, "" if there is no
+// such revision.
+func (h *Handler) revisionStatus(ipn, rev string) string {
+	if h.DB == nil {
+		return ""
+	}
+	var status string
+	h.DB.QueryRow("SELECT status FROM part_revisions WHERE ipn=? AND revision=? COLLATE NOCASE", ipn, rev).Scan(&status)
+	return status
+}
+
+// releaseRevision releases a draft revision. An empty effective_date is
+// set to the release date; older released revisions become superseded.
+func (h *Handler) releaseRevision(id int) error {
+	now := time.Now()
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var ipn string
+	if err := tx.QueryRow("SELECT ipn FROM part_revisions WHERE id=?", id).Scan(&ipn); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE part_revisions SET status='released', released_at=?,
+		effective_date=CASE WHEN COALESCE(effective_date,'')='' THEN ? ELSE effective_date END
+		WHERE id=?`, now.Format("2006-01-02 15:04:05"), now.Format("2006-01-02"), id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE part_revisions SET status='superseded' WHERE ipn=? AND status='released' AND id<>?", ipn, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// releaseRevisionsForECO releases the draft revisions raised on an ECO and
+// returns how many it released.
+func (h *Handler) releaseRevisionsForECO(ecoID string) (int, error) {
+	rows, err := h.DB.Query("SELECT id FROM part_revisions WHERE eco_id=? AND status='draft' ORDER BY id", ecoID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for i, id := range ids {
+		if err := h.releaseRevision(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// ListPartRevisions handles GET /api/parts/:ipn/revisions. current is the
+// revision in effect today.
+func (h *Handler) ListPartRevisions(w http.ResponseWriter, r *http.Request, ipn string) {
+	if _, ok := h.catalog().Get(ipn); !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	revs, err := h.partRevisions(ipn)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, map[string]interface{}{"ipn": ipn, "current": h.revisionAt(ipn, today()), "revisions": revs})
+}
+
+// CreatePartRevision handles POST /api/parts/:ipn/revisions. A revision
+// with an eco_id is a draft released when that ECO is implemented; without
+// one it is released at once, which released parts only allow when
+// parts_require_eco_for_released is off.
+func (h *Handler) CreatePartRevision(w http.ResponseWriter, r *http.Request, ipn string) {
+	var body struct {
+		Revision      string `json:"revision"`
+		ECOID         string `json:"eco_id"`
+		EffectiveDate string `json:"effective_date"`
+		Notes         string `json:"notes"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid request body", 400)
+		return
+	}
+	body.Revision = strings.ToUpper(strings.TrimSpace(body.Revision))
+	if !revisionPattern.MatchString(body.Revision) {
+		response.Err(w, "revision must be 1-16 letters, digits, dots or dashes", 400)
+		return
+	}
+	if body.EffectiveDate != "" {
+		if _, err := time.Parse("2006-01-02", body.EffectiveDate); err != nil {
+			response.Err(w, "effective_date must be YYYY-MM-DD", 400)
+			return
+		}
+	}
+	part, ok := h.catalog().Get(ipn)
+	if !ok {
+		response.Err(w, "part not found", 404)
+		return
+	}
+	ecoStatus := ""
+	if body.ECOID != "" {
+		if err := h.DB.QueryRow("SELECT status FROM ecos WHERE id=?", body.ECOID).Scan(&ecoStatus); err != nil {
+			response.Err(w, "ECO not found: "+body.ECOID, 400)
+			return
+		}
+		if ecoStatus == "rejected" {
+			response.Err(w, body.ECOID+" is rejected", 400)
+			return
+		}
+	} else if isReleasedPart(part.Fields) && h.requireECOForReleased() {
+		response.Err(w, ipn+" is released; new revisions need an eco_id", 400)
+		return
+	}
+	if h.revisionStatus(ipn, body.Revision) != "" {
+		response.Err(w, fmt.Sprintf("%s rev %s already exists", ipn, body.Revision), 409)
+		return
+	}
+
+	user := h.getUsername(r)
+	res, err := h.DB.Exec(`INSERT INTO part_revisions (ipn, revision, status, eco_id, effective_date, notes, created_by)
+		VALUES (?,?,'draft',?,?,?,?)`, ipn, body.Revision, body.ECOID, body.EffectiveDate, body.Notes, user)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	summary := fmt.Sprintf("Added rev %s (draft on %s)", body.Revision, body.ECOID)
+	if body.ECOID == "" || ecoStatus == "implemented" {
+		if err := h.releaseRevision(int(id)); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		summary = fmt.Sprintf("Released rev %s", body.Revision)
+	}
+	h.logAudit(user, "created", "part", ipn, summary)
+
+	revs, _ := h.partRevisions(ipn)
+	for _, rev := range revs {
+		if rev.ID == int(id) {
+			w.WriteHeader(201)
+			response.JSON(w, rev)
+			return
+		}
+	}
+	response.Err(w, "revision not found after insert", 500)
+}
+
+// bomEffectivity selects the BOM lines in effect for one unit of a build.
+// Date is YYYY-MM-DD. An empty Serial is a unit built after every serial
+// cut-in: lines ending at a serial are left out and lines starting at one
+// are kept.
+type bomEffectivity struct {
+	Date   string
+	Serial string
+}
+
+// includes reports whether l is in effect. effective_from is inclusive and
+// effective_to exclusive, so a part phased in on a date can replace one
+// phased out on the same date; serial ranges include both ends.
+func (e *bomEffectivity) includes(l bomLine) bool {
+	if e == nil {
+		return true
+	}
+	if e.Date != "" {
+		if l.EffectiveFrom != "" && e.Date < l.EffectiveFrom {
+			return false
+		}
+		if l.EffectiveTo != "" && e.Date >= l.EffectiveTo {
+			return false
+		}
+	}
+	if e.Serial == "" {
+		return l.SerialTo == ""
+	}
+	if l.SerialFrom != "" && compareSerial(e.Serial, l.SerialFrom) < 0 {
+		return false
+	}
+	if l.SerialTo != "" && compareSerial(e.Serial, l.SerialTo) > 0 {
+		return false
+	}
+	return true
+}
+
+// splitSerial splits a serial number into its prefix and trailing digits.
+func splitSerial(s string) (prefix, digits string) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// compareSerial orders serial numbers. Serials with the same prefix compare
+// by their numeric tail, so SN-99 comes before SN-100; anything else
+// compares as text.
+func compareSerial(a, b string) int {
+	pa, da := splitSerial(a)
+	pb, db := splitSerial(b)
+	if da != "" && db != "" && strings.EqualFold(pa, pb) {
+		na, erra := strconv.ParseUint(da, 10, 64)
+		nb, errb := strconv.ParseUint(db, 10, 64)
+		if erra == nil && errb == nil {
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToUpper(a), strings.ToUpper(b))
+}
+
+// ResolveBuildBOM resolves the BOM of an assembly for a build of qty units
+// dated date (today if empty). Each known serial is exploded with the
+// lines in effect for it; units without a serial yet take the lines after
+// every serial cut-in. Leaf parts are totalled by IPN and revision: a
+// line's rev column pins the revision, otherwise the part's revision in
+// effect on the build date is used. Units holds the per-unit lines of each
+// serial, then of the units without one. It returns nil when the assembly
+// has no BOM file.
+func (h *Handler) ResolveBuildBOM(assemblyIPN string, qty int, date string, serials []string) (*models.BuildBOM, error) {
+	if _, ok := h.bomLines(assemblyIPN); !ok {
+		return nil, nil
+	}
+	if date == "" {
+		date = today()
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, fmt.Errorf("build date must be YYYY-MM-DD")
+	}
+	units := []models.BuildUnit{}
+	for _, s := range serials {
+		units = append(units, models.BuildUnit{Serial: s, Count: 1})
+	}
+	if rest := qty - len(serials); rest > 0 {
+		units = append(units, models.BuildUnit{Count: float64(rest)})
+	}
+
+	out := &models.BuildBOM{AssemblyIPN: assemblyIPN, Date: date, Serials: serials, Lines: []models.BOMRequirement{}}
+	warned := map[string]bool{}
+	warn := func(msg string) {
+		if !warned[msg] {
+			warned[msg] = true
+			out.Warnings = append(out.Warnings, msg)
+		}
+	}
+	// explode returns the leaf parts of one unit with the given serial.
+	explode := func(serial string) ([]models.BOMRequirement, error) {
+		node, err := h.buildBOMTreeAt(assemblyIPN, 1, &bomEffectivity{Date: date, Serial: serial})
+		if err != nil {
+			return nil, err
+		}
+		byKey := map[string]*models.BOMRequirement{}
+		var keys []string
+		var walk func(n *BOMNode)
+		walk = func(n *BOMNode) {
+			for i := range n.Children {
+				child := &n.Children[i]
+				if len(child.Children) > 0 {
+					walk(child)
+					continue
+				}
+				rev := child.Revision
+				if rev == "" {
+					rev = h.revisionAt(child.IPN, date)
+				} else if status := h.revisionStatus(child.IPN, rev); status == "" {
+					warn(fmt.Sprintf("%s rev %s is not a recorded revision", child.IPN, rev))
+				} else if status != "released" && status != "superseded" {
+					warn(fmt.Sprintf("%s rev %s is %s", child.IPN, rev, status))
+				}
+				key := child.IPN + "\x00" + rev
+				req := byKey[key]
+				if req == nil {
+					req = &models.BOMRequirement{IPN: child.IPN, Revision: rev, Description: child.Description}
+					byKey[key] = req
+					keys = append(keys, key)
+				}
+				req.Qty += child.ExtQty
+				req.Alternates = mergeAlternates(req.Alternates, child.Alternates)
+			}
+		}
+		walk(node)
+		sort.Strings(keys)
+		lines := make([]models.BOMRequirement, 0, len(keys))
+		for _, k := range keys {
+			lines = append(lines, *byKey[k])
+		}
+		return lines, nil
+	}
+
+	totals := map[string]*models.BOMRequirement{}
+	var keys []string
+	for i := range units {
+		lines, err := explode(units[i].Serial)
+		if err != nil {
+			return nil, err
+		}
+		units[i].Lines = lines
+		for _, l := range lines {
+			key := l.IPN + "\x00" + l.Revision
+			t := totals[key]
+			if t == nil {
+				t = &models.BOMRequirement{IPN: l.IPN, Revision: l.Revision, Description: l.Description}
+				totals[key] = t
+				keys = append(keys, key)
+			}
+			t.Qty += l.Qty * units[i].Count
+			t.Alternates = mergeAlternates(t.Alternates, l.Alternates)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out.Lines = append(out.Lines, *totals[k])
+	}
+	out.Units = units
+	return out, nil
+}
+
+// ResolveWorkOrderBOM resolves the BOM of a work order for its serial
+// numbers, dated date or else the day the work order started, else today.
+// It returns nil when the assembly has no BOM file.
+func (h *Handler) ResolveWorkOrderBOM(woID, date string) (*models.BuildBOM, error) {
+	var assemblyIPN string
+	var qty int
+	if err := h.DB.QueryRow("SELECT assembly_ipn, qty FROM work_orders WHERE id=?", woID).Scan(&assemblyIPN, &qty); err != nil {
+		return nil, err
+	}
+	if _, ok := h.bomLines(assemblyIPN); !ok {
+		return nil, nil
+	}
+	if date == "" {
+		var started sql.NullString
+		h.DB.QueryRow("SELECT started_at FROM work_orders WHERE id=?", woID).Scan(&started)
+		if started.Valid && len(started.String) >= 10 {
+			date = started.String[:10]
+		}
+	}
+	var serials []string
+	rows, err := h.DB.Query("SELECT serial_number FROM wo_serials WHERE wo_id=? ORDER BY id", woID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s string
+		if rows.Scan(&s) == nil {
+			serials = append(serials, s)
+		}
+	}
+	rows.Close()
+	return h.ResolveBuildBOM(assemblyIPN, qty, date, serials)
+}
@@ -36,6 +36,10 @@ type Handler struct {
 	// LoadPartsFromDir loads parts from the parts directory. Set by the root package.
 	LoadPartsFromDir func() (map[string][]models.Part, map[string][]string, map[string]string, error)
 
+	// AssemblyMatcher returns a predicate reporting whether an IPN is an
+	// assembly under the configured BOM assembly rules. Set by the root package.
+	AssemblyMatcher func() func(ipn string) bool
+
 	// EmailOnPOReceived sends email notification when a PO is received. Set by the root package.
 	EmailOnPOReceived func(poID string)
 
@@ -47,4 +51,8 @@ type Handler struct {
 
 	// GetUsername extracts the username from the request. Set by the root package.
 	GetUsername func(r *http.Request) string
+
+	// ResolveBOM resolves a work order's BOM for its build date and serial
+	// numbers, nil when the assembly has no BOM file. Set by the root package.
+	ResolveBOM func(woID, date string) (*models.BuildBOM, error)
 }
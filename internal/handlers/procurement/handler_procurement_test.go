@@ -56,6 +56,11 @@ func newTestHandler(db *sql.DB) *procurement.Handler {
 		LoadPartsFromDir: func() (map[string][]models.Part, map[string][]string, map[string]string, error) {
 			return nil, nil, nil, nil
 		},
+		AssemblyMatcher: func() func(string) bool {
+			return func(ipn string) bool {
+				return strings.HasPrefix(ipn, "PCA-") || strings.HasPrefix(ipn, "ASY-")
+			}
+		},
 		EmailOnPOReceived: func(poID string) {},
 		RecordPriceFromPO: func(poID, ipn string, unitPrice float64, vendorID string) {},
 		LogAudit: func(username, action, module, recordID, summary string) {
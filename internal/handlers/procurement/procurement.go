@@ -138,7 +138,52 @@ func (h *Handler) UpdatePO(w http.ResponseWriter, r *http.Request, id string) {
 	h.GetPO(w, r, id)
 }
 
-// GeneratePOFromWO generates a PO from a work order's BOM shortages.
+// woRequirement is the total qty of one part a work order needs, with the
+// revisions its BOM resolved to.
+type woRequirement struct {
+	IPN       string
+	Revisions []string
+	Qty       float64
+}
+
+// woRequirements totals the resolved BOM of a work order by IPN. ok is
+// false when there is no BOM to resolve.
+func (h *Handler) woRequirements(woID string) (reqs []woRequirement, ok bool, err error) {
+	if h.ResolveBOM == nil {
+		return nil, false, nil
+	}
+	bom, err := h.ResolveBOM(woID, "")
+	if err != nil || bom == nil {
+		return nil, false, err
+	}
+	idx := map[string]int{}
+	for _, l := range bom.Lines {
+		i, seen := idx[l.IPN]
+		if !seen {
+			i = len(reqs)
+			idx[l.IPN] = i
+			reqs = append(reqs, woRequirement{IPN: l.IPN})
+		}
+		reqs[i].Qty += l.Qty
+		if l.Revision != "" {
+			reqs[i].Revisions = append(reqs[i].Revisions, l.Revision)
+		}
+	}
+	return reqs, true, nil
+}
+
+// revisionNote is the PO line note naming the revisions to buy.
+func (r woRequirement) revisionNote() string {
+	if len(r.Revisions) == 0 {
+		return ""
+	}
+	return "Rev " + strings.Join(r.Revisions, ", ")
+}
+
+// GeneratePOFromWO generates a PO from a work order's BOM shortages. With a
+// BOM file the shortages are of the resolved BOM and each line notes the
+// revisions needed; without one every stocked part is checked against the
+// work order qty.
 func (h *Handler) GeneratePOFromWO(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		WOID     string `json:"wo_id"`
@@ -158,21 +203,32 @@ func (h *Handler) GeneratePOFromWO(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get BOM shortages
-	rows, err := h.DB.Query("SELECT ipn, qty_on_hand FROM inventory")
+	reqs, resolved, err := h.woRequirements(body.WOID)
 	if err != nil {
-		response.Err(w, err.Error(), 500)
+		response.Err(w, err.Error(), 400)
 		return
 	}
-	defer rows.Close()
+	if !resolved {
+		rows, err := h.DB.Query("SELECT ipn FROM inventory")
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		for rows.Next() {
+			var ipn string
+			rows.Scan(&ipn)
+			reqs = append(reqs, woRequirement{IPN: ipn, Qty: float64(qty)})
+		}
+		rows.Close()
+	}
 
+	// Get BOM shortages
 	var lines []models.POLine
-	for rows.Next() {
-		var ipn string
+	for _, req := range reqs {
 		var onHand float64
-		rows.Scan(&ipn, &onHand)
-		qtyRequired := float64(qty)
-		shortage := qtyRequired - onHand
+		h.DB.QueryRow("SELECT qty_on_hand FROM inventory WHERE ipn=?", req.IPN).Scan(&onHand)
+		ipn := req.IPN
+		shortage := req.Qty - onHand
 		if shortage > 0 {
 			var mpn, manufacturer string
 			if h.GetPartByIPN != nil {
@@ -189,7 +245,7 @@ func (h *Handler) GeneratePOFromWO(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
-			lines = append(lines, models.POLine{IPN: ipn, MPN: mpn, Manufacturer: manufacturer, QtyOrdered: shortage})
+			lines = append(lines, models.POLine{IPN: ipn, MPN: mpn, Manufacturer: manufacturer, QtyOrdered: shortage, Notes: req.revisionNote()})
 		}
 	}
 
@@ -209,8 +265,8 @@ func (h *Handler) GeneratePOFromWO(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, l := range lines {
-		h.DB.Exec("INSERT INTO po_lines (po_id, ipn, mpn, manufacturer, qty_ordered) VALUES (?, ?, ?, ?, ?)",
-			poID, l.IPN, l.MPN, l.Manufacturer, l.QtyOrdered)
+		h.DB.Exec("INSERT INTO po_lines (po_id, ipn, mpn, manufacturer, qty_ordered, notes) VALUES (?, ?, ?, ?, ?, ?)",
+			poID, l.IPN, l.MPN, l.Manufacturer, l.QtyOrdered, l.Notes)
 	}
 
 	h.LogAudit(h.GetUsername(r), "created", "po", poID, "Auto-generated PO from WO "+body.WOID)
@@ -293,28 +349,42 @@ func (h *Handler) GeneratePOSuggestions(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get BOM for the assembly
+	// Get BOM for the assembly: the resolved BOM file, else bom_items
 	type BOMRequirement struct {
 		IPN      string
 		QtyPer   float64
 		Required float64
 		OnHand   float64
 		Shortage float64
+		Notes    string
 	}
 
-	bomRows, err := h.DB.Query("SELECT child_ipn, qty_per FROM bom_items WHERE parent_ipn = ?", assemblyIPN)
+	reqs, resolved, err := h.woRequirements(body.WOID)
 	if err != nil {
-		response.Err(w, err.Error(), 500)
+		response.Err(w, err.Error(), 400)
 		return
 	}
-	defer bomRows.Close()
+	var bom []BOMRequirement
+	for _, req := range reqs {
+		bom = append(bom, BOMRequirement{IPN: req.IPN, Required: req.Qty, Notes: req.revisionNote()})
+	}
+	if !resolved {
+		bomRows, err := h.DB.Query("SELECT child_ipn, qty_per FROM bom_items WHERE parent_ipn = ?", assemblyIPN)
+		if err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		for bomRows.Next() {
+			var req BOMRequirement
+			bomRows.Scan(&req.IPN, &req.QtyPer)
+			req.Required = req.QtyPer * float64(woQty)
+			bom = append(bom, req)
+		}
+		bomRows.Close()
+	}
 
 	var requirements []BOMRequirement
-	for bomRows.Next() {
-		var req BOMRequirement
-		bomRows.Scan(&req.IPN, &req.QtyPer)
-		req.Required = req.QtyPer * float64(woQty)
-
+	for _, req := range bom {
 		// Get current inventory
 		req.OnHand = 0.0
 		var onHand sql.NullFloat64
@@ -343,6 +413,7 @@ func (h *Handler) GeneratePOSuggestions(w http.ResponseWriter, r *http.Request)
 			Manufacturer string
 			Shortage     float64
 			UnitPrice    float64
+			Notes        string
 		}
 	}
 
@@ -375,12 +446,14 @@ func (h *Handler) GeneratePOSuggestions(w http.ResponseWriter, r *http.Request)
 			Manufacturer string
 			Shortage     float64
 			UnitPrice    float64
+			Notes        string
 		}{
 			IPN:          req.IPN,
 			MPN:          mpn,
 			Manufacturer: manufacturer,
 			Shortage:     req.Shortage,
 			UnitPrice:    unitPrice,
+			Notes:        req.Notes,
 		})
 	}
 
@@ -408,9 +481,9 @@ func (h *Handler) GeneratePOSuggestions(w http.ResponseWriter, r *http.Request)
 		for _, item := range group.Items {
 			h.DB.Exec(`
 				INSERT INTO po_suggestion_lines
-				(suggestion_id, ipn, mpn, manufacturer, qty_needed, estimated_unit_price)
-				VALUES (?, ?, ?, ?, ?, ?)
-			`, suggestionID, item.IPN, item.MPN, item.Manufacturer, item.Shortage, item.UnitPrice)
+				(suggestion_id, ipn, mpn, manufacturer, qty_needed, estimated_unit_price, notes)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, suggestionID, item.IPN, item.MPN, item.Manufacturer, item.Shortage, item.UnitPrice, item.Notes)
 		}
 	}
 
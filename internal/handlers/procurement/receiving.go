@@ -125,6 +125,11 @@ func (h *Handler) InspectReceiving(w http.ResponseWriter, r *http.Request, idStr
 		ncrDesc := fmt.Sprintf("%.0f units failed receiving inspection.\nInspector: %s\nNotes: %s", body.QtyFailed, inspector, body.Notes)
 		h.DB.Exec(`INSERT INTO ncrs (id,title,description,ipn,defect_type,severity,status,created_at) VALUES (?,?,?,?,?,?,?,?)`,
 			ncrID, ncrTitle, ncrDesc, ri.IPN, "receiving", "minor", "open", now)
+		// The failed units go to MRB quarantine, priced at the PO line.
+		h.DB.Exec(`INSERT INTO mrb_quarantine (ncr_id,ipn,qty,source,receiving_inspection_id,po_id,vendor_id,unit_cost,created_by,created_at)
+			SELECT ?,?,?,'receiving',?,?,COALESCE((SELECT vendor_id FROM purchase_orders WHERE id=?),''),
+				COALESCE((SELECT unit_price FROM po_lines WHERE id=?),0),?,?`,
+			ncrID, ri.IPN, body.QtyFailed, id, ri.POID, ri.POID, ri.POLineID, inspector, now)
 		h.LogAudit(inspector, "created", "ncr", ncrID, "Auto-created from receiving inspection failure")
 	}
 
@@ -154,13 +159,15 @@ func (h *Handler) WhereUsed(w http.ResponseWriter, r *http.Request, ipn string)
 
 	cats, _, _, _ := h.LoadPartsFromDir()
 
-	// Collect all assembly IPNs (PCA- or ASY- prefixed parts)
+	// Collect all assembly IPNs under the configured assembly rules
 	var assemblyIPNs []string
-	for _, parts := range cats {
-		for _, p := range parts {
-			upper := strings.ToUpper(p.IPN)
-			if strings.HasPrefix(upper, "PCA-") || strings.HasPrefix(upper, "ASY-") {
-				assemblyIPNs = append(assemblyIPNs, p.IPN)
+	if h.AssemblyMatcher != nil {
+		isAssembly := h.AssemblyMatcher()
+		for _, parts := range cats {
+			for _, p := range parts {
+				if isAssembly(p.IPN) {
+					assemblyIPNs = append(assemblyIPNs, p.IPN)
+				}
 			}
 		}
 	}
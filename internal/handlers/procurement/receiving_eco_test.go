@@ -483,6 +483,37 @@ func TestWhereUsedFindsParentAssembly(t *testing.T) {
 	}
 }
 
+func TestWhereUsedFollowsAssemblyRules(t *testing.T) {
+	db := setupReceivingEcoTestDB(t)
+	defer db.Close()
+	resetIDCounter()
+
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "MOD-7.csv"), []byte("IPN,qty,ref\nIPN-001,3,R1-R3\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "PCA-100.csv"), []byte("IPN,qty,ref\nIPN-001,4,R1-R4\n"), 0644)
+
+	h := newTestHandler(db)
+	h.PartsDir = tmpDir
+	h.LoadPartsFromDir = func() (map[string][]models.Part, map[string][]string, map[string]string, error) {
+		return map[string][]models.Part{
+			"assemblies": {{IPN: "MOD-7"}, {IPN: "PCA-100"}},
+		}, nil, nil, nil
+	}
+	// Only MOD- parts are assemblies under the configured rules.
+	h.AssemblyMatcher = func() func(string) bool {
+		return func(ipn string) bool { return strings.HasPrefix(ipn, "MOD-") }
+	}
+
+	w := httptest.NewRecorder()
+	h.WhereUsed(w, httptest.NewRequest("GET", "/api/v1/parts/IPN-001/where-used", nil), "IPN-001")
+
+	var results []map[string]interface{}
+	json.Unmarshal(extractDataJSON(w.Body.Bytes()), &results)
+	if len(results) != 1 || results[0]["assembly_ipn"] != "MOD-7" {
+		t.Fatalf("expected only MOD-7, got %s", w.Body.String())
+	}
+}
+
 func TestWhereUsedMultipleAssemblies(t *testing.T) {
 	db := setupReceivingEcoTestDB(t)
 	defer db.Close()
@@ -62,6 +62,7 @@ func (h *Handler) GetCAPA(w http.ResponseWriter, r *http.Request, id string) {
 	}
 	c.ApprovedByQEAt = database.SP(qeAt)
 	c.ApprovedByMgrAt = database.SP(mgrAt)
+	c.Signatures = audit.Signatures(h.DB, "capa", id, capaSignedContent(c))
 	response.JSON(w, c)
 }
 
@@ -263,6 +264,17 @@ func (h *Handler) UpdateCAPA(w http.ResponseWriter, r *http.Request, id string)
 		newMgrAt = now
 	}
 
+	// Approvals are electronically signed when the approver re-enters
+	// their password, and must be when signatures are required.
+	var signer *audit.Signer
+	if newQEAt != nil || newMgrAt != nil {
+		sig := audit.SignatureRequest{Password: getString("password"), Meaning: getString("meaning"), Reason: getString("reason")}
+		if signer, err = audit.Authenticate(h.DB, r, sig, "approved", "reviewed"); err != nil {
+			response.Err(w, err.Error(), audit.SignatureStatus(err))
+			return
+		}
+	}
+
 	// Auto-advance status when both approvals are received (Gap 5.5)
 	newStatus := status
 	if status == "" {
@@ -270,14 +282,21 @@ func (h *Handler) UpdateCAPA(w http.ResponseWriter, r *http.Request, id string)
 	}
 
 	// Check if we should auto-advance to pending_review
+	autoAdvanced := false
 	if (newApprovedByQE != "" && newApprovedByMgr != "") &&
 		(currentCAPA.Status == "open" || currentCAPA.Status == "in_progress") &&
 		newStatus != "pending_review" && newStatus != "closed" {
-		newStatus = "pending_review"
-		audit.LogAudit(h.DB, h.Hub, username, "auto-advanced", "capa", id, "Auto-advanced to pending_review status after both approvals received")
+		newStatus, autoAdvanced = "pending_review", true
 	}
 
-	_, err = h.DB.Exec(`UPDATE capas SET title=?,type=?,linked_ncr_id=?,linked_rma_id=?,root_cause=?,action_plan=?,
+	// The update and any approval signatures commit together.
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE capas SET title=?,type=?,linked_ncr_id=?,linked_rma_id=?,root_cause=?,action_plan=?,
 		owner=?,due_date=?,status=?,effectiveness_check=?,approved_by_qe=?,
 		approved_by_qe_at=COALESCE(?,approved_by_qe_at),approved_by_mgr=?,
 		approved_by_mgr_at=COALESCE(?,approved_by_mgr_at),updated_at=? WHERE id=?`,
@@ -289,6 +308,41 @@ func (h *Handler) UpdateCAPA(w http.ResponseWriter, r *http.Request, id string)
 		return
 	}
 
+	var signatures []models.ESignature
+	if signer != nil {
+		content := capaSignedContent(models.CAPA{ID: id, Title: title, Type: capaType, LinkedNCRID: linkedNCRID,
+			LinkedRMAID: linkedRMAID, RootCause: rootCause, ActionPlan: actionPlan, EffectivenessCheck: effectivenessCheck})
+		for _, role := range []struct {
+			at    interface{}
+			label string
+		}{{newQEAt, "QE approval"}, {newMgrAt, "Manager approval"}} {
+			if role.at == nil {
+				continue
+			}
+			s := *signer
+			s.Reason = role.label
+			if signer.Reason != "" {
+				s.Reason += ": " + signer.Reason
+			}
+			signature, err := s.Sign(tx, "capa", id, content)
+			if err != nil {
+				response.Err(w, err.Error(), 500)
+				return
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	for _, signature := range signatures {
+		audit.LogSignature(h.DB, signature)
+	}
+	if autoAdvanced {
+		audit.LogAudit(h.DB, h.Hub, username, "auto-advanced", "capa", id, "Auto-advanced to pending_review status after both approvals received")
+	}
+
 	audit.LogAudit(h.DB, h.Hub, username, "updated", "capa", id, "Updated "+id+": status="+newStatus)
 	newSnap, _ := h.GetCAPASnapshot(id)
 	h.RecordChangeJSON(username, "capas", id, "update", oldSnap, newSnap)
@@ -0,0 +1,114 @@
+package quality
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+
+	"zrp/internal/audit"
+	"zrp/internal/database"
+	"zrp/internal/models"
+	"zrp/internal/response"
+)
+
+// capaSignedContent is what a QE or manager signature on a CAPA binds:
+// the problem, the actions and their effectiveness check.
+func capaSignedContent(c models.CAPA) map[string]string {
+	return map[string]string{"id": c.ID, "title": c.Title, "type": c.Type,
+		"linked_ncr_id": c.LinkedNCRID, "linked_rma_id": c.LinkedRMAID, "root_cause": c.RootCause,
+		"action_plan": c.ActionPlan, "effectiveness_check": c.EffectivenessCheck}
+}
+
+func (h *Handler) loadCAPA(id string) (models.CAPA, error) {
+	var c models.CAPA
+	var qeAt, mgrAt sql.NullString
+	err := h.DB.QueryRow(`SELECT id,title,type,COALESCE(linked_ncr_id,''),COALESCE(linked_rma_id,''),
+		COALESCE(root_cause,''),COALESCE(action_plan,''),COALESCE(owner,''),COALESCE(due_date,''),
+		status,COALESCE(effectiveness_check,''),COALESCE(approved_by_qe,''),approved_by_qe_at,
+		COALESCE(approved_by_mgr,''),approved_by_mgr_at,created_at,updated_at
+		FROM capas WHERE id=?`, id).
+		Scan(&c.ID, &c.Title, &c.Type, &c.LinkedNCRID, &c.LinkedRMAID,
+			&c.RootCause, &c.ActionPlan, &c.Owner, &c.DueDate,
+			&c.Status, &c.EffectivenessCheck, &c.ApprovedByQE, &qeAt,
+			&c.ApprovedByMgr, &mgrAt, &c.CreatedAt, &c.UpdatedAt)
+	c.ApprovedByQEAt = database.SP(qeAt)
+	c.ApprovedByMgrAt = database.SP(mgrAt)
+	return c, err
+}
+
+// CAPASignatures handles GET /api/v1/capas/:id/signatures.
+func (h *Handler) CAPASignatures(w http.ResponseWriter, r *http.Request, id string) {
+	c, err := h.loadCAPA(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	response.JSON(w, audit.Signatures(h.DB, "capa", id, capaSignedContent(c)))
+}
+
+// CAPAPDF handles GET /api/v1/capas/:id/pdf: a printable CAPA with its
+// signature manifest.
+func (h *Handler) CAPAPDF(w http.ResponseWriter, r *http.Request, id string) {
+	c, err := h.loadCAPA(id)
+	if err != nil {
+		http.Error(w, "CAPA not found", 404)
+		return
+	}
+	sigs := audit.Signatures(h.DB, "capa", id, capaSignedContent(c))
+
+	htmlOutput := fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>CAPA — %s</title>
+<style>
+  * { margin: 0; padding: 0; box-sizing: border-box; }
+  body { font-family: Arial, Helvetica, sans-serif; font-size: 11pt; color: #000; padding: 0.5in; }
+  h1 { font-size: 18pt; margin-bottom: 2pt; }
+  h2 { font-size: 13pt; margin: 16pt 0 6pt; border-bottom: 2px solid #000; padding-bottom: 3pt; }
+  table { width: 100%%; border-collapse: collapse; margin-bottom: 12pt; }
+  th, td { border: 1px solid #000; padding: 4pt 6pt; text-align: left; font-size: 10pt; }
+  th { background: #eee; font-weight: bold; }
+  .header { display: flex; justify-content: space-between; align-items: flex-start; border-bottom: 3px solid #000; padding-bottom: 8pt; margin-bottom: 12pt; }
+  .info-grid { display: grid; grid-template-columns: auto 1fr; gap: 4pt 12pt; margin-bottom: 12pt; font-size: 10pt; }
+  .info-grid dt { font-weight: bold; }
+  .text { white-space: pre-wrap; font-size: 10pt; }
+  @media print { body { padding: 0; } @page { margin: 0.5in; } }
+</style>
+</head><body>
+<div class="header">
+  <div><h1>ZRP — Corrective and Preventive Action</h1></div>
+  <div style="text-align:right;font-size:10pt">
+    <div><strong>CAPA:</strong> %s</div>
+    <div><strong>Type:</strong> %s</div>
+    <div><strong>Status:</strong> %s</div>
+  </div>
+</div>
+<div class="info-grid">
+  <dt>Title:</dt><dd>%s</dd>
+  <dt>Owner:</dt><dd>%s</dd>
+  <dt>Due:</dt><dd>%s</dd>
+  <dt>NCR:</dt><dd>%s</dd>
+  <dt>RMA:</dt><dd>%s</dd>
+</div>
+
+<h2>Root Cause</h2>
+<div class="text">%s</div>
+<h2>Action Plan</h2>
+<div class="text">%s</div>
+<h2>Effectiveness Check</h2>
+<div class="text">%s</div>
+
+%s
+<script>window.onload = () => window.print()</script>
+</body></html>`,
+		html.EscapeString(c.ID), html.EscapeString(c.ID), html.EscapeString(c.Type), html.EscapeString(c.Status),
+		html.EscapeString(c.Title), html.EscapeString(c.Owner), html.EscapeString(c.DueDate),
+		html.EscapeString(c.LinkedNCRID), html.EscapeString(c.LinkedRMAID),
+		html.EscapeString(c.RootCause), html.EscapeString(c.ActionPlan), html.EscapeString(c.EffectivenessCheck),
+		audit.SignatureManifestHTML(sigs))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write([]byte(htmlOutput))
+}
@@ -0,0 +1,773 @@
+package quality
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/database"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// eightDNames are the disciplines of an 8D report, D1 to D8.
+var eightDNames = []string{"Team", "Problem description", "Containment", "Root cause",
+	"Permanent corrective actions", "Verification", "Prevention", "Closure"}
+
+var (
+	validEightDRoles       = []string{"champion", "leader", "member"}
+	validEightDCauseKinds  = []string{"why", "fishbone"}
+	validFishboneGroups    = []string{"man", "machine", "method", "material", "measurement", "environment"}
+	validEightDActionSteps = []int{3, 5, 7}
+)
+
+func (h *Handler) loadEightD(id string) (models.EightD, error) {
+	var e models.EightD
+	var closedAt sql.NullString
+	err := h.DB.QueryRow(`SELECT id,title,COALESCE(ncr_id,''),COALESCE(capa_id,''),status,current_step,
+		COALESCE(created_by,''),created_at,updated_at,closed_at FROM eight_d WHERE id=?`, id).
+		Scan(&e.ID, &e.Title, &e.NCRID, &e.CAPAID, &e.Status, &e.CurrentStep,
+			&e.CreatedBy, &e.CreatedAt, &e.UpdatedAt, &closedAt)
+	e.ClosedAt = database.SP(closedAt)
+	return e, err
+}
+
+// loadEightDDetail fills the disciplines, team, causes and actions.
+func (h *Handler) loadEightDDetail(e *models.EightD) {
+	e.Disciplines = []models.EightDDiscipline{}
+	rows, err := h.DB.Query(`SELECT discipline,COALESCE(content,''),COALESCE(completed_by,''),completed_at
+		FROM eight_d_disciplines WHERE eight_d_id=? ORDER BY discipline`, e.ID)
+	if err == nil {
+		for rows.Next() {
+			var d models.EightDDiscipline
+			var at sql.NullString
+			rows.Scan(&d.Number, &d.Content, &d.CompletedBy, &at)
+			d.CompletedAt = database.SP(at)
+			d.Name = eightDNames[d.Number-1]
+			switch {
+			case at.Valid:
+				d.Status = "complete"
+			case d.Number == e.CurrentStep && e.Status == "open":
+				d.Status = "current"
+			default:
+				d.Status = "locked"
+			}
+			e.Disciplines = append(e.Disciplines, d)
+		}
+		rows.Close()
+	}
+
+	e.Team = []models.EightDMember{}
+	rows, err = h.DB.Query(`SELECT username,role,added_at FROM eight_d_team WHERE eight_d_id=?
+		ORDER BY CASE role WHEN 'champion' THEN 0 WHEN 'leader' THEN 1 ELSE 2 END, username`, e.ID)
+	if err == nil {
+		for rows.Next() {
+			var m models.EightDMember
+			rows.Scan(&m.Username, &m.Role, &m.AddedAt)
+			e.Team = append(e.Team, m)
+		}
+		rows.Close()
+	}
+
+	e.Causes = []models.EightDCause{}
+	rows, err = h.DB.Query(`SELECT id,kind,COALESCE(category,''),text,created_at FROM eight_d_causes
+		WHERE eight_d_id=? ORDER BY kind DESC, id`, e.ID)
+	if err == nil {
+		for rows.Next() {
+			var c models.EightDCause
+			rows.Scan(&c.ID, &c.Kind, &c.Category, &c.Text, &c.CreatedAt)
+			e.Causes = append(e.Causes, c)
+		}
+		rows.Close()
+	}
+
+	e.Actions = []models.EightDAction{}
+	rows, err = h.DB.Query(`SELECT id,discipline,description,owner,due_date,status,completed_at,created_at
+		FROM eight_d_actions WHERE eight_d_id=? ORDER BY discipline, id`, e.ID)
+	if err == nil {
+		for rows.Next() {
+			var a models.EightDAction
+			var at sql.NullString
+			rows.Scan(&a.ID, &a.Discipline, &a.Description, &a.Owner, &a.DueDate, &a.Status, &at, &a.CreatedAt)
+			a.CompletedAt = database.SP(at)
+			e.Actions = append(e.Actions, a)
+		}
+		rows.Close()
+	}
+}
+
+// notifyEightD sends an 8D notification to a user.
+func (h *Handler) notifyEightD(username, title, message, id string) {
+	h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module, user_id)
+		VALUES ('8d_task', 'info', ?, ?, ?, '8d', ?)`, title, message, id, username)
+}
+
+func (h *Handler) activeUser(username string) bool {
+	var n int
+	h.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username=? AND active=1", username).Scan(&n)
+	return n > 0
+}
+
+func (h *Handler) touchEightD(id string) {
+	h.DB.Exec("UPDATE eight_d SET updated_at=? WHERE id=?", time.Now().Format("2006-01-02 15:04:05"), id)
+}
+
+// openEightD loads a report for a change, writing the error response when
+// it is missing or closed.
+func (h *Handler) openEightD(w http.ResponseWriter, id string) (models.EightD, bool) {
+	e, err := h.loadEightD(id)
+	if err != nil {
+		response.Err(w, "8D not found", 404)
+		return e, false
+	}
+	if e.Status != "open" {
+		response.Err(w, "8D "+id+" is closed", 409)
+		return e, false
+	}
+	return e, true
+}
+
+// ListEightDs handles GET /api/v1/8d with optional ncr_id, capa_id and
+// status filters.
+func (h *Handler) ListEightDs(w http.ResponseWriter, r *http.Request) {
+	q := `SELECT id FROM eight_d WHERE 1=1`
+	var args []interface{}
+	for _, f := range []string{"ncr_id", "capa_id", "status"} {
+		if v := r.URL.Query().Get(f); v != "" {
+			q += " AND " + f + "=?"
+			args = append(args, v)
+		}
+	}
+	rows, err := h.DB.Query(q+" ORDER BY created_at DESC, id DESC", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	items := []models.EightD{}
+	for _, id := range ids {
+		if e, err := h.loadEightD(id); err == nil {
+			items = append(items, e)
+		}
+	}
+	response.JSON(w, items)
+}
+
+// GetEightD handles GET /api/v1/8d/:id.
+func (h *Handler) GetEightD(w http.ResponseWriter, r *http.Request, id string) {
+	e, err := h.loadEightD(id)
+	if err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	h.loadEightDDetail(&e)
+	response.JSON(w, e)
+}
+
+// CreateEightD handles POST /api/v1/8d. The report must be raised
+// against an NCR, a CAPA or both.
+func (h *Handler) CreateEightD(w http.ResponseWriter, r *http.Request) {
+	var e models.EightD
+	if err := response.DecodeBody(r, &e); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	e.Title = strings.TrimSpace(e.Title)
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "title", e.Title)
+	validation.ValidateMaxLength(ve, "title", e.Title, 255)
+	if e.NCRID == "" && e.CAPAID == "" {
+		ve.Add("ncr_id", "an NCR or a CAPA is required")
+	}
+	var n int
+	if e.NCRID != "" {
+		if h.DB.QueryRow("SELECT COUNT(*) FROM ncrs WHERE id=?", e.NCRID).Scan(&n); n == 0 {
+			ve.Add("ncr_id", "NCR "+e.NCRID+" not found")
+		}
+	}
+	if e.CAPAID != "" {
+		if h.DB.QueryRow("SELECT COUNT(*) FROM capas WHERE id=?", e.CAPAID).Scan(&n); n == 0 {
+			ve.Add("capa_id", "CAPA "+e.CAPAID+" not found")
+		}
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	e.ID = h.NextIDFunc("8D", "eight_d", 3)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO eight_d (id,title,ncr_id,capa_id,status,current_step,created_by,created_at,updated_at)
+		VALUES (?,?,?,?,'open',1,?,?,?)`, e.ID, e.Title, e.NCRID, e.CAPAID, username, now, now); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	for d := 1; d <= len(eightDNames); d++ {
+		if _, err := tx.Exec("INSERT INTO eight_d_disciplines (eight_d_id, discipline) VALUES (?,?)", e.ID, d); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, username, "created", "8d", e.ID, "Created "+e.ID+": "+e.Title)
+	e, _ = h.loadEightD(e.ID)
+	h.loadEightDDetail(&e)
+	response.JSON(w, e)
+}
+
+// eightDStep parses a discipline number from the URL.
+func eightDStep(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 1 && n <= len(eightDNames)
+}
+
+// UpdateEightDDiscipline handles PUT /api/v1/8d/:id/disciplines/:n. Only
+// the current discipline can be edited; completed ones are locked.
+func (h *Handler) UpdateEightDDiscipline(w http.ResponseWriter, r *http.Request, id, step string) {
+	n, ok := eightDStep(step)
+	if !ok {
+		response.Err(w, "discipline must be 1-8", 400)
+		return
+	}
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	ve := &validation.ValidationErrors{}
+	validation.ValidateMaxLength(ve, "content", body.Content, 10000)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if n != e.CurrentStep {
+		response.Err(w, fmt.Sprintf("D%d is not the current discipline (D%d)", n, e.CurrentStep), 409)
+		return
+	}
+	h.DB.Exec("UPDATE eight_d_disciplines SET content=? WHERE eight_d_id=? AND discipline=?", body.Content, id, n)
+	h.touchEightD(id)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "8d", id,
+		fmt.Sprintf("Updated %s D%d %s", id, n, eightDNames[n-1]))
+	h.GetEightD(w, r, id)
+}
+
+// eightDGate returns why discipline n of e cannot be completed yet, or "".
+func (h *Handler) eightDGate(e models.EightD, n int) string {
+	var content string
+	h.DB.QueryRow("SELECT COALESCE(content,'') FROM eight_d_disciplines WHERE eight_d_id=? AND discipline=?", e.ID, n).Scan(&content)
+	count := func(q string, args ...interface{}) int {
+		var c int
+		h.DB.QueryRow(q, args...).Scan(&c)
+		return c
+	}
+	needContent := func(what string) string {
+		if strings.TrimSpace(content) == "" {
+			return what + " is required"
+		}
+		return ""
+	}
+	switch n {
+	case 1:
+		if count("SELECT COUNT(*) FROM eight_d_team WHERE eight_d_id=? AND role='leader'", e.ID) == 0 {
+			return "the team needs a leader"
+		}
+	case 2:
+		return needContent("a problem description")
+	case 3:
+		return needContent("a containment summary")
+	case 4:
+		if msg := needContent("a root cause statement"); msg != "" {
+			return msg
+		}
+		if count("SELECT COUNT(*) FROM eight_d_causes WHERE eight_d_id=?", e.ID) == 0 {
+			return "at least one 5-Why or fishbone entry is required"
+		}
+	case 5:
+		if count("SELECT COUNT(*) FROM eight_d_actions WHERE eight_d_id=? AND discipline=5", e.ID) == 0 {
+			return "at least one permanent corrective action is required"
+		}
+	case 6:
+		if msg := needContent("a verification summary"); msg != "" {
+			return msg
+		}
+		if c := count("SELECT COUNT(*) FROM eight_d_actions WHERE eight_d_id=? AND discipline=5 AND status<>'done'", e.ID); c > 0 {
+			return fmt.Sprintf("%d corrective action(s) are still open", c)
+		}
+	case 7:
+		return needContent("a prevention summary")
+	case 8:
+		if msg := needContent("a closure summary"); msg != "" {
+			return msg
+		}
+		if c := count("SELECT COUNT(*) FROM eight_d_actions WHERE eight_d_id=? AND status<>'done'", e.ID); c > 0 {
+			return fmt.Sprintf("%d action(s) are still open", c)
+		}
+	}
+	return ""
+}
+
+// CompleteEightDDiscipline handles POST /api/v1/8d/:id/disciplines/:n/complete.
+// Disciplines complete in order and each has its own requirements;
+// completing D8 closes the report and fills in the root cause and actions
+// of the linked NCR and CAPA where those are still blank.
+func (h *Handler) CompleteEightDDiscipline(w http.ResponseWriter, r *http.Request, id, step string) {
+	n, ok := eightDStep(step)
+	if !ok {
+		response.Err(w, "discipline must be 1-8", 400)
+		return
+	}
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if n != e.CurrentStep {
+		response.Err(w, fmt.Sprintf("D%d is not the current discipline (D%d)", n, e.CurrentStep), 409)
+		return
+	}
+	if msg := h.eightDGate(e, n); msg != "" {
+		response.Err(w, fmt.Sprintf("cannot complete D%d %s: %s", n, eightDNames[n-1], msg), 400)
+		return
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	// Moving on only from step n makes a concurrent completion of the
+	// same discipline lose instead of skipping the next one.
+	var res sql.Result
+	if n < len(eightDNames) {
+		res, err = tx.Exec("UPDATE eight_d SET current_step=?, updated_at=? WHERE id=? AND current_step=? AND status='open'", n+1, now, id, n)
+	} else {
+		res, err = tx.Exec("UPDATE eight_d SET status='closed', closed_at=?, updated_at=? WHERE id=? AND current_step=? AND status='open'", now, now, id, n)
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		response.Err(w, fmt.Sprintf("D%d of %s was completed by someone else", n, id), 409)
+		return
+	}
+	if _, err := tx.Exec("UPDATE eight_d_disciplines SET completed_by=?, completed_at=? WHERE eight_d_id=? AND discipline=?", username, now, id, n); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n == len(eightDNames) {
+		h.syncEightDLinks(e)
+	}
+	audit.LogAudit(h.DB, h.Hub, username, "completed", "8d", id, fmt.Sprintf("Completed %s D%d %s", id, n, eightDNames[n-1]))
+
+	var next string
+	if n < len(eightDNames) {
+		next = fmt.Sprintf("; D%d %s is now open", n+1, eightDNames[n])
+	}
+	rows, err := h.DB.Query("SELECT username FROM eight_d_team WHERE eight_d_id=? AND username<>?", id, username)
+	if err == nil {
+		var team []string
+		for rows.Next() {
+			var u string
+			rows.Scan(&u)
+			team = append(team, u)
+		}
+		rows.Close()
+		for _, u := range team {
+			h.notifyEightD(u, fmt.Sprintf("%s: D%d %s complete", id, n, eightDNames[n-1]), e.Title+next, id)
+		}
+	}
+	h.GetEightD(w, r, id)
+}
+
+// syncEightDLinks copies the 8D root cause and corrective actions into
+// the linked NCR and CAPA free-text fields that are still empty.
+func (h *Handler) syncEightDLinks(e models.EightD) {
+	var rootCause string
+	h.DB.QueryRow("SELECT COALESCE(content,'') FROM eight_d_disciplines WHERE eight_d_id=? AND discipline=4", e.ID).Scan(&rootCause)
+	var actions []string
+	rows, err := h.DB.Query("SELECT description, owner, due_date FROM eight_d_actions WHERE eight_d_id=? AND discipline=5 ORDER BY id", e.ID)
+	if err == nil {
+		for rows.Next() {
+			var d, o, due string
+			rows.Scan(&d, &o, &due)
+			actions = append(actions, fmt.Sprintf("- %s (%s, due %s)", d, o, due))
+		}
+		rows.Close()
+	}
+	plan := fmt.Sprintf("See %s.\n%s", e.ID, strings.Join(actions, "\n"))
+	if e.NCRID != "" {
+		h.DB.Exec("UPDATE ncrs SET root_cause=? WHERE id=? AND COALESCE(root_cause,'')=''", rootCause, e.NCRID)
+		h.DB.Exec("UPDATE ncrs SET corrective_action=? WHERE id=? AND COALESCE(corrective_action,'')=''", plan, e.NCRID)
+	}
+	if e.CAPAID != "" {
+		h.DB.Exec("UPDATE capas SET root_cause=? WHERE id=? AND COALESCE(root_cause,'')=''", rootCause, e.CAPAID)
+		h.DB.Exec("UPDATE capas SET action_plan=? WHERE id=? AND COALESCE(action_plan,'')=''", plan, e.CAPAID)
+	}
+}
+
+// AddEightDMember handles POST /api/v1/8d/:id/team. Adding an existing
+// member changes their role.
+func (h *Handler) AddEightDMember(w http.ResponseWriter, r *http.Request, id string) {
+	var m models.EightDMember
+	if err := response.DecodeBody(r, &m); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if m.Role == "" {
+		m.Role = "member"
+	}
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "username", m.Username)
+	validation.ValidateEnum(ve, "role", m.Role, validEightDRoles)
+	if m.Username != "" && !h.activeUser(m.Username) {
+		ve.Add("username", "no active user "+m.Username)
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if _, err := h.DB.Exec(`INSERT INTO eight_d_team (eight_d_id, username, role) VALUES (?,?,?)
+		ON CONFLICT(eight_d_id, username) DO UPDATE SET role=excluded.role`, id, m.Username, m.Role); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.touchEightD(id)
+	username := audit.GetUsername(h.DB, r)
+	audit.LogAudit(h.DB, h.Hub, username, "updated", "8d", id, fmt.Sprintf("Added %s to %s team as %s", m.Username, id, m.Role))
+	if m.Username != username {
+		h.notifyEightD(m.Username, fmt.Sprintf("Added to 8D team %s as %s", id, m.Role), e.Title, id)
+	}
+	h.GetEightD(w, r, id)
+}
+
+// RemoveEightDMember handles DELETE /api/v1/8d/:id/team/:username.
+func (h *Handler) RemoveEightDMember(w http.ResponseWriter, r *http.Request, id, member string) {
+	if _, ok := h.openEightD(w, id); !ok {
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM eight_d_team WHERE eight_d_id=? AND username=?", id, member)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, member+" is not on the team", 404)
+		return
+	}
+	h.touchEightD(id)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "8d", id, fmt.Sprintf("Removed %s from %s team", member, id))
+	h.GetEightD(w, r, id)
+}
+
+// AddEightDCause handles POST /api/v1/8d/:id/causes: a 5-Why step or a
+// fishbone cause, recorded while D4 is the current discipline.
+func (h *Handler) AddEightDCause(w http.ResponseWriter, r *http.Request, id string) {
+	var c models.EightDCause
+	if err := response.DecodeBody(r, &c); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	c.Text = strings.TrimSpace(c.Text)
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "text", c.Text)
+	validation.ValidateMaxLength(ve, "text", c.Text, 1000)
+	validation.ValidateEnum(ve, "kind", c.Kind, validEightDCauseKinds)
+	if c.Kind == "fishbone" {
+		validation.ValidateEnum(ve, "category", c.Category, validFishboneGroups)
+	} else {
+		c.Category = ""
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if e.CurrentStep != 4 {
+		response.Err(w, fmt.Sprintf("root cause entries can only be added during D4 (current D%d)", e.CurrentStep), 409)
+		return
+	}
+	if _, err := h.DB.Exec("INSERT INTO eight_d_causes (eight_d_id, kind, category, text) VALUES (?,?,?,?)",
+		id, c.Kind, c.Category, c.Text); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.touchEightD(id)
+	h.GetEightD(w, r, id)
+}
+
+// DeleteEightDCause handles DELETE /api/v1/8d/:id/causes/:causeId.
+func (h *Handler) DeleteEightDCause(w http.ResponseWriter, r *http.Request, id, causeID string) {
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if e.CurrentStep != 4 {
+		response.Err(w, fmt.Sprintf("root cause entries can only be changed during D4 (current D%d)", e.CurrentStep), 409)
+		return
+	}
+	res, err := h.DB.Exec("DELETE FROM eight_d_causes WHERE id=? AND eight_d_id=?", causeID, id)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Err(w, "cause not found", 404)
+		return
+	}
+	h.touchEightD(id)
+	h.GetEightD(w, r, id)
+}
+
+// AddEightDAction handles POST /api/v1/8d/:id/actions: a containment
+// (D3), permanent corrective (D5) or preventive (D7) action, added while
+// that discipline is current. The owner is notified of the assignment.
+func (h *Handler) AddEightDAction(w http.ResponseWriter, r *http.Request, id string) {
+	var a models.EightDAction
+	if err := response.DecodeBody(r, &a); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	a.Description = strings.TrimSpace(a.Description)
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "description", a.Description)
+	validation.ValidateMaxLength(ve, "description", a.Description, 1000)
+	validation.RequireField(ve, "owner", a.Owner)
+	validation.RequireField(ve, "due_date", a.DueDate)
+	validation.ValidateDate(ve, "due_date", a.DueDate)
+	valid := false
+	for _, d := range validEightDActionSteps {
+		valid = valid || a.Discipline == d
+	}
+	if !valid {
+		ve.Add("discipline", "must be 3 (containment), 5 (corrective) or 7 (preventive)")
+	}
+	if a.Owner != "" && !h.activeUser(a.Owner) {
+		ve.Add("owner", "no active user "+a.Owner)
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	e, ok := h.openEightD(w, id)
+	if !ok {
+		return
+	}
+	if a.Discipline != e.CurrentStep {
+		response.Err(w, fmt.Sprintf("D%d actions can only be added while D%d is current (current D%d)", a.Discipline, a.Discipline, e.CurrentStep), 409)
+		return
+	}
+	if _, err := h.DB.Exec(`INSERT INTO eight_d_actions (eight_d_id, discipline, description, owner, due_date, status)
+		VALUES (?,?,?,?,?,'open')`, id, a.Discipline, a.Description, a.Owner, a.DueDate); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.touchEightD(id)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "8d", id,
+		fmt.Sprintf("Assigned %s D%d action to %s: %s", id, a.Discipline, a.Owner, a.Description))
+	h.notifyEightD(a.Owner, fmt.Sprintf("8D task assigned: %s D%d", id, a.Discipline),
+		fmt.Sprintf("%s (due %s)", a.Description, a.DueDate), id)
+	h.GetEightD(w, r, id)
+}
+
+// UpdateEightDAction handles PUT /api/v1/8d/:id/actions/:actionId: mark
+// an action done or open, or reassign it. A new owner is notified.
+func (h *Handler) UpdateEightDAction(w http.ResponseWriter, r *http.Request, id, actionID string) {
+	var body struct {
+		Status  string `json:"status"`
+		Owner   string `json:"owner"`
+		DueDate string `json:"due_date"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	ve := &validation.ValidationErrors{}
+	if body.Status != "" {
+		validation.ValidateEnum(ve, "status", body.Status, []string{"open", "done"})
+	}
+	validation.ValidateDate(ve, "due_date", body.DueDate)
+	if body.Owner != "" && !h.activeUser(body.Owner) {
+		ve.Add("owner", "no active user "+body.Owner)
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if _, ok := h.openEightD(w, id); !ok {
+		return
+	}
+	var a models.EightDAction
+	var completedAt sql.NullString
+	if err := h.DB.QueryRow("SELECT discipline, description, owner, due_date, status, completed_at FROM eight_d_actions WHERE id=? AND eight_d_id=?", actionID, id).
+		Scan(&a.Discipline, &a.Description, &a.Owner, &a.DueDate, &a.Status, &completedAt); err != nil {
+		response.Err(w, "action not found", 404)
+		return
+	}
+	reassigned := body.Owner != "" && body.Owner != a.Owner
+	if body.Owner != "" {
+		a.Owner = body.Owner
+	}
+	if body.DueDate != "" {
+		a.DueDate = body.DueDate
+	}
+	if body.Status != "" {
+		a.Status = body.Status
+	}
+	if a.Status != "done" {
+		completedAt = sql.NullString{}
+	} else if !completedAt.Valid {
+		completedAt = sql.NullString{String: time.Now().Format("2006-01-02 15:04:05"), Valid: true}
+	}
+	if _, err := h.DB.Exec("UPDATE eight_d_actions SET owner=?, due_date=?, status=?, completed_at=? WHERE id=?",
+		a.Owner, a.DueDate, a.Status, completedAt, actionID); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	h.touchEightD(id)
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "8d", id,
+		fmt.Sprintf("Updated %s action %s: %s, owner %s", id, actionID, a.Status, a.Owner))
+	if reassigned {
+		h.notifyEightD(a.Owner, fmt.Sprintf("8D task assigned: %s D%d", id, a.Discipline),
+			fmt.Sprintf("%s (due %s)", a.Description, a.DueDate), id)
+	}
+	h.GetEightD(w, r, id)
+}
+
+// EightDPDF handles GET /api/v1/8d/:id/pdf: a printable 8D report.
+func (h *Handler) EightDPDF(w http.ResponseWriter, r *http.Request, id string) {
+	e, err := h.loadEightD(id)
+	if err != nil {
+		http.Error(w, "8D not found", 404)
+		return
+	}
+	h.loadEightDDetail(&e)
+	esc := html.EscapeString
+
+	var b strings.Builder
+	for _, d := range e.Disciplines {
+		done := "Open"
+		if d.CompletedAt != nil {
+			done = fmt.Sprintf("Completed by %s on %s", esc(d.CompletedBy), esc(*d.CompletedAt))
+		}
+		fmt.Fprintf(&b, "<h2>D%d — %s</h2>\n<div class=\"meta\">%s</div>\n", d.Number, esc(d.Name), done)
+		switch d.Number {
+		case 1:
+			b.WriteString("<table><thead><tr><th>Member</th><th>Role</th></tr></thead><tbody>")
+			for _, m := range e.Team {
+				fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>", esc(m.Username), esc(m.Role))
+			}
+			b.WriteString("</tbody></table>\n")
+		case 4:
+			whys := 0
+			for _, c := range e.Causes {
+				if c.Kind == "why" {
+					whys++
+					fmt.Fprintf(&b, "<div><strong>Why %d:</strong> %s</div>\n", whys, esc(c.Text))
+				}
+			}
+			for _, g := range validFishboneGroups {
+				var items []string
+				for _, c := range e.Causes {
+					if c.Kind == "fishbone" && c.Category == g {
+						items = append(items, esc(c.Text))
+					}
+				}
+				if len(items) > 0 {
+					fmt.Fprintf(&b, "<div><strong>%s:</strong> %s</div>\n", strings.ToUpper(g[:1])+g[1:], strings.Join(items, "; "))
+				}
+			}
+		}
+		if d.Content != "" {
+			fmt.Fprintf(&b, "<div class=\"text\">%s</div>\n", esc(d.Content))
+		}
+		var rows []string
+		for _, a := range e.Actions {
+			if a.Discipline == d.Number {
+				rows = append(rows, fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+					esc(a.Description), esc(a.Owner), esc(a.DueDate), esc(a.Status)))
+			}
+		}
+		if len(rows) > 0 {
+			b.WriteString("<table><thead><tr><th>Action</th><th>Owner</th><th>Due</th><th>Status</th></tr></thead><tbody>" +
+				strings.Join(rows, "") + "</tbody></table>\n")
+		}
+	}
+
+	htmlOutput := fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>8D — %s</title>
+<style>
+  * { margin: 0; padding: 0; box-sizing: border-box; }
+  body { font-family: Arial, Helvetica, sans-serif; font-size: 11pt; color: #000; padding: 0.5in; }
+  h1 { font-size: 18pt; margin-bottom: 2pt; }
+  h2 { font-size: 13pt; margin: 16pt 0 4pt; border-bottom: 2px solid #000; padding-bottom: 3pt; }
+  table { width: 100%%; border-collapse: collapse; margin: 6pt 0 12pt; }
+  th, td { border: 1px solid #000; padding: 4pt 6pt; text-align: left; font-size: 10pt; }
+  th { background: #eee; font-weight: bold; }
+  .header { display: flex; justify-content: space-between; align-items: flex-start; border-bottom: 3px solid #000; padding-bottom: 8pt; margin-bottom: 12pt; }
+  .meta { font-size: 9pt; color: #555; margin-bottom: 4pt; }
+  .text { white-space: pre-wrap; font-size: 10pt; margin-top: 4pt; }
+  @media print { body { padding: 0; } @page { margin: 0.5in; } }
+</style>
+</head><body>
+<div class="header">
+  <div><h1>ZRP — 8D Report</h1><div>%s</div></div>
+  <div style="text-align:right;font-size:10pt">
+    <div><strong>8D:</strong> %s</div>
+    <div><strong>NCR:</strong> %s</div>
+    <div><strong>CAPA:</strong> %s</div>
+    <div><strong>Status:</strong> %s</div>
+  </div>
+</div>
+%s
+<script>window.onload = () => window.print()</script>
+</body></html>`,
+		esc(e.ID), esc(e.Title), esc(e.ID), esc(e.NCRID), esc(e.CAPAID), esc(e.Status), b.String())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write([]byte(htmlOutput))
+}
@@ -3,6 +3,7 @@ package quality
 import (
 	"database/sql"
 	"net/http"
+	"sync"
 
 	"zrp/internal/models"
 	"zrp/internal/websocket"
@@ -45,4 +46,9 @@ type Handler struct {
 
 	// SendEmail sends an email.
 	SendEmail func(to, subject, body string) error
+
+	// spcCounts caches the number of test records on each control chart;
+	// see spcRecordCount.
+	spcMu     sync.Mutex
+	spcCounts map[spcSeries]spcCount
 }
@@ -0,0 +1,172 @@
+package quality_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func TestEightDWorkflow(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+	testutil.CreateTestUser(t, testDB, "lee", "pw-lee-123", "user", true)
+	testutil.CreateTestUser(t, testDB, "kim", "pw-kim-123", "user", true)
+	testDB.Exec(`INSERT INTO ncrs (id, title, status) VALUES ('NCR-001', 'Cold joints on U3', 'open')`)
+
+	call := func(want int, fn func(w *httptest.ResponseRecorder)) models.EightD {
+		t.Helper()
+		w := httptest.NewRecorder()
+		fn(w)
+		if w.Code != want {
+			t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+		}
+		e, _ := unmarshalResp[models.EightD](w.Body.Bytes())
+		return e
+	}
+
+	call(400, func(w *httptest.ResponseRecorder) {
+		h.CreateEightD(w, testutil.AuthedRequest("POST", "/", []byte(`{"title":"No link"}`), cookie))
+	})
+	call(400, func(w *httptest.ResponseRecorder) {
+		h.CreateEightD(w, testutil.AuthedRequest("POST", "/", []byte(`{"title":"Bad","ncr_id":"NCR-404"}`), cookie))
+	})
+	e := call(200, func(w *httptest.ResponseRecorder) {
+		h.CreateEightD(w, testutil.AuthedRequest("POST", "/", []byte(`{"title":"U3 solder","ncr_id":"NCR-001"}`), cookie))
+	})
+	if !strings.HasPrefix(e.ID, "8D-") || e.CurrentStep != 1 || len(e.Disciplines) != 8 || e.Disciplines[0].Status != "current" || e.Disciplines[1].Status != "locked" {
+		t.Fatalf("created = %+v", e)
+	}
+	id := e.ID
+	complete := func(n, want int) models.EightD {
+		t.Helper()
+		return call(want, func(w *httptest.ResponseRecorder) {
+			h.CompleteEightDDiscipline(w, testutil.AuthedRequest("POST", "/", nil, cookie), id, fmt.Sprint(n))
+		})
+	}
+	content := func(n, want int, text string) {
+		t.Helper()
+		call(want, func(w *httptest.ResponseRecorder) {
+			h.UpdateEightDDiscipline(w, testutil.AuthedRequest("PUT", "/", []byte(`{"content":"`+text+`"}`), cookie), id, fmt.Sprint(n))
+		})
+	}
+	member := func(body string, want int) {
+		t.Helper()
+		call(want, func(w *httptest.ResponseRecorder) {
+			h.AddEightDMember(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie), id)
+		})
+	}
+	action := func(body string, want int) models.EightD {
+		t.Helper()
+		return call(want, func(w *httptest.ResponseRecorder) {
+			h.AddEightDAction(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie), id)
+		})
+	}
+	cause := func(body string, want int) {
+		t.Helper()
+		call(want, func(w *httptest.ResponseRecorder) {
+			h.AddEightDCause(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie), id)
+		})
+	}
+	notifications := func(user string) []string {
+		t.Helper()
+		rows, _ := testDB.Query("SELECT title FROM notifications WHERE user_id=? AND type='8d_task' ORDER BY id", user)
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var s string
+			rows.Scan(&s)
+			out = append(out, s)
+		}
+		return out
+	}
+
+	// D1: a team needs a leader; later steps are locked until then.
+	complete(1, 400)
+	content(2, 409, "Too early")
+	member(`{"username":"ghost"}`, 400)
+	member(`{"username":"lee","role":"boss"}`, 400)
+	member(`{"username":"lee","role":"leader"}`, 200)
+	member(`{"username":"kim"}`, 200)
+	if n := notifications("lee"); len(n) != 1 || n[0] != "Added to 8D team "+id+" as leader" {
+		t.Errorf("lee notifications = %v", n)
+	}
+	// A failed write leaves the 8D on the same discipline.
+	testDB.Exec(`CREATE TRIGGER fail_d1 BEFORE UPDATE OF completed_by ON eight_d_disciplines BEGIN SELECT RAISE(ABORT, 'disk full'); END`)
+	complete(1, 500)
+	var step int
+	testDB.QueryRow("SELECT current_step FROM eight_d WHERE id=?", id).Scan(&step)
+	if step != 1 {
+		t.Fatalf("failed completion moved the 8D to D%d", step)
+	}
+	testDB.Exec("DROP TRIGGER fail_d1")
+	complete(1, 200)
+
+	// D2 and D3 need their write-ups; containment tasks go to their owners.
+	complete(2, 400)
+	content(2, 200, "U3 shows cold joints on 12 of 40 boards")
+	complete(2, 200)
+	action(`{"discipline":5,"description":"Too early","owner":"kim","due_date":"2026-12-01"}`, 409)
+	action(`{"discipline":3,"description":"Sort WIP","owner":"kim"}`, 400)
+	e = action(`{"discipline":3,"description":"Sort WIP","owner":"kim","due_date":"2026-12-01"}`, 200)
+	containment := e.Actions[0].ID
+	content(3, 200, "WIP quarantined")
+	complete(3, 200)
+
+	// D4: the root cause needs a statement and 5-Why or fishbone entries.
+	cause(`{"kind":"fishbone","category":"weather","text":"Humidity"}`, 400)
+	content(4, 200, "Reflow profile too cool at zone 5")
+	complete(4, 400)
+	cause(`{"kind":"why","text":"Joints did not wet"}`, 200)
+	cause(`{"kind":"fishbone","category":"machine","text":"Zone 5 heater drift"}`, 200)
+	complete(4, 200)
+	cause(`{"kind":"why","text":"Late"}`, 409)
+
+	// D5/D6: verification waits for the corrective actions.
+	complete(5, 400)
+	e = action(`{"discipline":5,"description":"Recalibrate zone 5","owner":"lee","due_date":"2026-12-15"}`, 200)
+	if n := notifications("lee"); len(n) != 6 || n[5] != "8D task assigned: "+id+" D5" {
+		t.Errorf("lee notifications = %v", n)
+	}
+	corrective := e.Actions[1].ID
+	complete(5, 200)
+	content(6, 200, "Three lots with zero cold joints")
+	complete(6, 400)
+	call(200, func(w *httptest.ResponseRecorder) {
+		h.UpdateEightDAction(w, testutil.AuthedRequest("PUT", "/", []byte(`{"status":"done"}`), cookie), id, fmt.Sprint(corrective))
+	})
+	complete(6, 200)
+	content(7, 200, "Weekly profile check added to PM")
+	complete(7, 200)
+
+	// D8 closes the report once every action is done, and fills the NCR.
+	content(8, 200, "Closed with team sign-off")
+	complete(8, 400)
+	call(200, func(w *httptest.ResponseRecorder) {
+		h.UpdateEightDAction(w, testutil.AuthedRequest("PUT", "/", []byte(`{"status":"done"}`), cookie), id, fmt.Sprint(containment))
+	})
+	e = complete(8, 200)
+	if e.Status != "closed" || e.ClosedAt == nil || e.Disciplines[7].Status != "complete" {
+		t.Errorf("closed = %+v", e)
+	}
+	content(8, 409, "Reopen")
+	var rootCause, corrective2 string
+	testDB.QueryRow("SELECT COALESCE(root_cause,''), COALESCE(corrective_action,'') FROM ncrs WHERE id='NCR-001'").Scan(&rootCause, &corrective2)
+	if rootCause != "Reflow profile too cool at zone 5" || !strings.Contains(corrective2, "Recalibrate zone 5 (lee, due 2026-12-15)") {
+		t.Errorf("ncr = %q / %q", rootCause, corrective2)
+	}
+	if n := notifications("kim"); len(n) < 9 {
+		t.Errorf("kim notifications = %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	h.EightDPDF(w, httptest.NewRequest("GET", "/", nil), id)
+	if body := w.Body.String(); !strings.Contains(body, "D4 — Root cause") || !strings.Contains(body, "Why 1:</strong> Joints did not wet") || !strings.Contains(body, "Machine:</strong> Zone 5 heater drift") {
+		t.Errorf("pdf = %s", body)
+	}
+}
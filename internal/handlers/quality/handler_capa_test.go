@@ -127,7 +127,7 @@ func TestCAPACloseRequiresEffectivenessAndApproval(t *testing.T) {
 
 	// Close with all requirements
 	w = httptest.NewRecorder()
-	req = testutil.AuthedRequest("PUT", "/api/v1/capas/"+c.ID, []byte(`{"title":"Test close","type":"corrective","owner":"eng","status":"closed","effectiveness_check":"Verified OK","approved_by_qe":"QE Approved","approved_by_mgr":"Manager Approved"}`), cookie)
+	req = testutil.AuthedRequest("PUT", "/api/v1/capas/"+c.ID, []byte(`{"title":"Test close","type":"corrective","owner":"eng","status":"closed","effectiveness_check":"Verified OK","approved_by_qe":"QE Approved","approved_by_mgr":"Manager Approved","password":"changeme"}`), cookie)
 	h.UpdateCAPA(w, req, c.ID)
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
@@ -226,3 +226,73 @@ func TestCAPADefaultType(t *testing.T) {
 		t.Fatalf("expected default 'corrective', got '%s'", c.Type)
 	}
 }
+
+func TestCAPAApprovalSignatures(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+
+	w := httptest.NewRecorder()
+	h.CreateCAPA(w, testutil.AuthedRequest("POST", "/api/v1/capas", []byte(`{"title":"Signed","type":"corrective","root_cause":"Flux","action_plan":"Profile"}`), cookie))
+	c, _ := unmarshalResp[models.CAPA](w.Body.Bytes())
+
+	// A wrong password blocks the approval; the right one signs it.
+	w = httptest.NewRecorder()
+	h.UpdateCAPA(w, testutil.AuthedRequest("PUT", "/", []byte(`{"approved_by_qe":"yes","password":"nope"}`), cookie), c.ID)
+	if w.Code != 401 {
+		t.Fatalf("expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.UpdateCAPA(w, testutil.AuthedRequest("PUT", "/", []byte(`{"approved_by_qe":"yes","approved_by_mgr":"yes","password":"changeme","reason":"Verified"}`), cookie), c.ID)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	signed, _ := unmarshalResp[models.CAPA](w.Body.Bytes())
+	var reasons []string
+	for _, s := range signed.Signatures {
+		if s.Meaning != "approved" || s.Username != "admin" || !s.Intact {
+			t.Errorf("signature = %+v", s)
+		}
+		reasons = append(reasons, s.Reason)
+	}
+	if fmt.Sprint(reasons) != "[QE approval: Verified Manager approval: Verified]" {
+		t.Errorf("reasons = %v", reasons)
+	}
+
+	w = httptest.NewRecorder()
+	h.CAPAPDF(w, httptest.NewRequest("GET", "/", nil), c.ID)
+	if !strings.Contains(w.Body.String(), "Administrator (admin)") {
+		t.Errorf("pdf missing signer: %s", w.Body.String())
+	}
+}
+
+func TestCAPAApprovalRolledBackWhenSigningFails(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+
+	w := httptest.NewRecorder()
+	h.CreateCAPA(w, testutil.AuthedRequest("POST", "/api/v1/capas", []byte(`{"title":"Signed","type":"corrective","status":"open"}`), cookie))
+	c, _ := unmarshalResp[models.CAPA](w.Body.Bytes())
+
+	// The QE signature is written, then the manager's fails.
+	if _, err := testDB.Exec(`CREATE TRIGGER fail_mgr_signature BEFORE INSERT ON e_signatures
+		WHEN NEW.reason LIKE 'Manager%' BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	h.UpdateCAPA(w, testutil.AuthedRequest("PUT", "/", []byte(`{"approved_by_qe":"yes","approved_by_mgr":"yes","password":"changeme"}`), cookie), c.ID)
+	if w.Code != 500 {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var status, qe, mgr string
+	var sigs int
+	testDB.QueryRow("SELECT status, COALESCE(approved_by_qe,''), COALESCE(approved_by_mgr,'') FROM capas WHERE id=?", c.ID).Scan(&status, &qe, &mgr)
+	testDB.QueryRow("SELECT COUNT(*) FROM e_signatures WHERE record_id=?", c.ID).Scan(&sigs)
+	if status != "open" || qe != "" || mgr != "" || sigs != 0 {
+		t.Errorf("after failed signature: status=%q qe=%q mgr=%q signatures=%d", status, qe, mgr, sigs)
+	}
+}
@@ -0,0 +1,180 @@
+package quality_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func TestMRBDispositions(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+	for _, ddl := range []string{
+		`CREATE TABLE purchase_orders (id TEXT PRIMARY KEY, vendor_id TEXT NOT NULL, status TEXT DEFAULT 'draft', created_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE po_lines (id INTEGER PRIMARY KEY AUTOINCREMENT, po_id TEXT NOT NULL, ipn TEXT NOT NULL, qty_ordered REAL NOT NULL, unit_price REAL)`,
+		`CREATE TABLE receiving_inspections (id INTEGER PRIMARY KEY AUTOINCREMENT, po_id TEXT NOT NULL, po_line_id INTEGER NOT NULL, ipn TEXT NOT NULL,
+			qty_received REAL NOT NULL DEFAULT 0, qty_passed REAL DEFAULT 0, qty_failed REAL DEFAULT 0, qty_on_hold REAL DEFAULT 0,
+			inspector TEXT, inspected_at DATETIME, notes TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`INSERT INTO vendors (id, name, address) VALUES ('V-001', 'Acme Passives', '1 Main St')`,
+		`INSERT INTO purchase_orders (id, vendor_id) VALUES ('PO-001', 'V-001')`,
+		`INSERT INTO po_lines (po_id, ipn, qty_ordered, unit_price) VALUES ('PO-001', 'RES-100', 50, 2.5)`,
+		`INSERT INTO receiving_inspections (po_id, po_line_id, ipn, qty_received, qty_passed, qty_on_hold, inspected_at)
+			VALUES ('PO-001', 1, 'RES-100', 50, 40, 10, '2026-10-01 10:00:00')`,
+		`INSERT INTO inventory (ipn, qty_on_hand) VALUES ('RES-100', 20)`,
+		`INSERT INTO ncrs (id, title, ipn, status) VALUES ('NCR-001', 'Wrong tolerance on RES-100', 'RES-100', 'open')`,
+	} {
+		if _, err := testDB.Exec(ddl); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	call := func(want int, fn func(w *httptest.ResponseRecorder)) []byte {
+		t.Helper()
+		w := httptest.NewRecorder()
+		fn(w)
+		if w.Code != want {
+			t.Fatalf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+		}
+		return w.Body.Bytes()
+	}
+	quarantine := func(body string, want int) models.MRBSummary {
+		t.Helper()
+		s, _ := unmarshalResp[models.MRBSummary](call(want, func(w *httptest.ResponseRecorder) {
+			h.QuarantineNCRStock(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie), "NCR-001")
+		}))
+		return s
+	}
+	dispose := func(body string, want int) models.MRBDisposition {
+		t.Helper()
+		d, _ := unmarshalResp[models.MRBDisposition](call(want, func(w *httptest.ResponseRecorder) {
+			h.DispositionNCR(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie), "NCR-001")
+		}))
+		return d
+	}
+	onHand := func() float64 {
+		var q float64
+		testDB.QueryRow("SELECT qty_on_hand FROM inventory WHERE ipn='RES-100'").Scan(&q)
+		return q
+	}
+
+	// Held units are released to the MRB at the PO price; suspect stock is
+	// pulled out of inventory.
+	quarantine(`{"qty":12,"receiving_inspection_id":1}`, 400)
+	s := quarantine(`{"qty":10,"receiving_inspection_id":1}`, 200)
+	if s.QtyRemaining != 10 || s.Quarantine[0].VendorID != "V-001" || s.Quarantine[0].UnitCost != 2.5 || s.Quarantine[0].Source != "hold" {
+		t.Fatalf("after hold = %+v", s)
+	}
+	quarantine(`{"qty":1,"receiving_inspection_id":1}`, 400)
+	quarantine(`{"qty":25}`, 400)
+	s = quarantine(`{"qty":5}`, 200)
+	if s.QtyQuarantined != 15 || onHand() != 15 {
+		t.Fatalf("after stock = %+v, on hand %g", s, onHand())
+	}
+
+	dispose(`{"disposition":"sell","qty":1}`, 400)
+	dispose(`{"disposition":"scrap","qty":16}`, 400)
+	dispose(`{"disposition":"use_as_is","qty":3}`, 200)
+	if onHand() != 18 {
+		t.Errorf("use-as-is on hand = %g", onHand())
+	}
+	dispose(`{"disposition":"rework","qty":1.5}`, 400)
+	d := dispose(`{"disposition":"rework","qty":2,"priority":"high"}`, 200)
+	var woIPN, woStatus string
+	var woQty int
+	testDB.QueryRow("SELECT assembly_ipn, qty, status FROM work_orders WHERE id=?", d.WorkOrderID).Scan(&woIPN, &woQty, &woStatus)
+	if !strings.HasPrefix(d.WorkOrderID, "WO-") || woIPN != "RES-100" || woQty != 2 || woStatus != "open" {
+		t.Errorf("rework wo %q = %s x%d %s", d.WorkOrderID, woIPN, woQty, woStatus)
+	}
+	d = dispose(`{"disposition":"return_to_vendor","qty":4}`, 200)
+	var to string
+	var lineQty int
+	testDB.QueryRow("SELECT s.to_address, l.qty FROM shipments s JOIN shipment_lines l ON l.shipment_id=s.id WHERE s.id=?", d.ShipmentID).Scan(&to, &lineQty)
+	if d.VendorID != "V-001" || !strings.HasPrefix(to, "Acme Passives") || lineQty != 4 {
+		t.Errorf("rtv %+v to %q qty %d", d, to, lineQty)
+	}
+	dispose(`{"disposition":"scrap","qty":7}`, 400)
+	d = dispose(`{"disposition":"scrap","qty":6,"notes":"Out of tolerance"}`, 200)
+	if d.TotalCost != 15 {
+		t.Errorf("scrap cost = %g", d.TotalCost)
+	}
+	if onHand() != 18 {
+		t.Errorf("final on hand = %g", onHand())
+	}
+
+	rows, _ := testDB.Query("SELECT type FROM inventory_transactions WHERE ipn='RES-100' ORDER BY id")
+	var kinds []string
+	for rows.Next() {
+		var k string
+		rows.Scan(&k)
+		kinds = append(kinds, k)
+	}
+	rows.Close()
+	if got := strings.Join(kinds, ","); got != "transfer,receive,issue,return,scrap" {
+		t.Errorf("transactions = %s", got)
+	}
+
+	// Fully dispositioned NCRs leave the MRB queue.
+	list, _ := unmarshalResp[[]models.MRBSummary](call(200, func(w *httptest.ResponseRecorder) {
+		h.ListMRB(w, httptest.NewRequest("GET", "/api/v1/mrb", nil))
+	}))
+	all, _ := unmarshalResp[[]models.MRBSummary](call(200, func(w *httptest.ResponseRecorder) {
+		h.ListMRB(w, httptest.NewRequest("GET", "/api/v1/mrb?all=1", nil))
+	}))
+	if len(list) != 0 || len(all) != 1 || all[0].QtyRemaining != 0 || len(all[0].Dispositions) != 4 {
+		t.Errorf("queue = %+v / %+v", list, all)
+	}
+
+	rep, _ := unmarshalResp[struct {
+		TotalCost float64 `json:"total_cost"`
+		ByIPN     []struct {
+			IPN string  `json:"ipn"`
+			Qty float64 `json:"qty"`
+		} `json:"by_ipn"`
+	}](call(200, func(w *httptest.ResponseRecorder) {
+		h.ReportScrapCost(w, httptest.NewRequest("GET", "/api/v1/reports/scrap-cost?from=2020-01-01", nil))
+	}))
+	if rep.TotalCost != 15 || len(rep.ByIPN) != 1 || rep.ByIPN[0].Qty != 6 {
+		t.Errorf("report = %+v", rep)
+	}
+	call(400, func(w *httptest.ResponseRecorder) {
+		h.ReportScrapCost(w, httptest.NewRequest("GET", "/api/v1/reports/scrap-cost?from=yesterday", nil))
+	})
+}
+
+func TestMRBDispositionRechecksRemaining(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+	testDB.Exec(`INSERT INTO inventory (ipn, qty_on_hand) VALUES ('RES-100', 20)`)
+	testDB.Exec(`INSERT INTO ncrs (id, title, ipn, status) VALUES ('NCR-001', 'Wrong tolerance on RES-100', 'RES-100', 'open')`)
+	w := httptest.NewRecorder()
+	h.QuarantineNCRStock(w, testutil.AuthedRequest("POST", "/", []byte(`{"qty":5}`), cookie), "NCR-001")
+	if w.Code != 200 {
+		t.Fatalf("quarantine: %d %s", w.Code, w.Body.String())
+	}
+
+	// Another request scraps the units after this one has checked what
+	// is left but before it writes.
+	nextID := h.NextIDFunc
+	h.NextIDFunc = func(prefix, table string, digits int) string {
+		testDB.Exec(`INSERT INTO mrb_dispositions (ncr_id, ipn, disposition, qty, decided_by, decided_at)
+			VALUES ('NCR-001', 'RES-100', 'scrap', 5, 'other', '2026-10-01 10:00:00')`)
+		return nextID(prefix, table, digits)
+	}
+	w = httptest.NewRecorder()
+	h.DispositionNCR(w, testutil.AuthedRequest("POST", "/", []byte(`{"disposition":"rework","qty":5}`), cookie), "NCR-001")
+	if w.Code != 400 {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var n int
+	testDB.QueryRow("SELECT COUNT(*) FROM mrb_dispositions WHERE ncr_id='NCR-001'").Scan(&n)
+	if n != 1 {
+		t.Errorf("%d dispositions, want 1", n)
+	}
+}
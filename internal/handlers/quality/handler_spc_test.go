@@ -0,0 +1,170 @@
+package quality_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"zrp/internal/models"
+	"zrp/internal/testutil"
+)
+
+func TestSPCViolationOnCreateTest(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+
+	w := httptest.NewRecorder()
+	h.UpdateSPCSettings(w, testutil.AuthedRequest("PUT", "/", []byte(`{"subgroup_size":11,"p_subgroup_size":25,"min_subgroups":5,"window":25}`), cookie))
+	if w.Code != 400 {
+		t.Fatalf("subgroup of 11: expected 400, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.UpdateSPCSettings(w, testutil.AuthedRequest("PUT", "/", []byte(`{"subgroup_size":5,"p_subgroup_size":25,"min_subgroups":5,"window":25,"auto_ncr":true}`), cookie))
+	if w.Code != 200 {
+		t.Fatalf("settings: %d %s", w.Code, w.Body.String())
+	}
+
+	// Five in-control subgroups of five readings.
+	for i, v := range []float64{11.9, 12.0, 12.1, 12.0, 12.0, 11.9, 12.0, 12.1, 12.0, 12.0, 11.9, 12.0, 12.1, 12.0, 12.0,
+		11.9, 12.0, 12.1, 12.0, 12.0, 11.9, 12.0, 12.1, 12.0, 12.0} {
+		testDB.Exec(`INSERT INTO test_records (serial_number, ipn, test_type, result, measurements, tested_at)
+			VALUES (?, 'PCB-100', 'factory', 'pass', ?, ?)`, fmt.Sprintf("SN-%03d", i), fmt.Sprintf(`{"voltage":%g}`, v),
+			fmt.Sprintf("2026-01-01 08:00:%02d", i))
+	}
+
+	create := func(serial string) models.TestRecord {
+		t.Helper()
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"serial_number":%q,"ipn":"PCB-100","test_type":"factory","result":"pass","measurements":"{\"voltage\":13.5}"}`, serial)
+		h.CreateTest(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie))
+		if w.Code != 200 {
+			t.Fatalf("create test: %d %s", w.Code, w.Body.String())
+		}
+		rec, _ := unmarshalResp[models.TestRecord](w.Body.Bytes())
+		return rec
+	}
+	// The subgroup is only judged once it is complete.
+	for i := 0; i < 4; i++ {
+		if rec := create(fmt.Sprintf("SN-1%02d", i)); len(rec.SPCViolations) != 0 {
+			t.Fatalf("partial subgroup flagged: %+v", rec.SPCViolations)
+		}
+	}
+	rec := create("SN-104")
+	if len(rec.SPCViolations) == 0 || rec.SPCViolations[0].Chart != "xbar" || rec.SPCViolations[0].Rule != 1 || rec.SPCViolations[0].NCRID == "" {
+		t.Fatalf("violations = %+v", rec.SPCViolations)
+	}
+	var defect, notified string
+	testDB.QueryRow("SELECT defect_type FROM ncrs WHERE id=?", rec.SPCViolations[0].NCRID).Scan(&defect)
+	testDB.QueryRow("SELECT title FROM notifications WHERE type='spc_violation'").Scan(&notified)
+	if defect != "spc" || notified != "SPC violation on PCB-100 after test of SN-104" {
+		t.Errorf("ncr defect %q, notification %q", defect, notified)
+	}
+
+	chart := func(query string, want int) models.SPCChart {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.GetSPCChart(w, httptest.NewRequest("GET", "/api/v1/spc/chart?"+query, nil))
+		if w.Code != want {
+			t.Fatalf("chart %s: expected %d, got %d: %s", query, want, w.Code, w.Body.String())
+		}
+		c, _ := unmarshalResp[models.SPCChart](w.Body.Bytes())
+		return c
+	}
+	chart("ipn=PCB-100", 400)
+	c := chart("type=xbar_r&ipn=PCB-100&measurement=voltage&test_type=factory", 200)
+	if len(c.Points) != 6 || !c.EnoughData || c.Points[5].Value != 13.5 || len(c.Points[5].Rules) == 0 || c.Points[0].Range < 0.19 {
+		t.Errorf("xbar chart = %+v", c)
+	}
+	if c := chart("type=p&ipn=PCB-100", 200); len(c.Points) != 1 || c.EnoughData || c.Center != 0 {
+		t.Errorf("p chart = %+v", c)
+	}
+
+	// Receiving lots make a p-chart of their own.
+	testDB.Exec(`CREATE TABLE receiving_inspections (id INTEGER PRIMARY KEY AUTOINCREMENT, po_id TEXT, po_line_id INTEGER, ipn TEXT,
+		qty_received REAL, qty_passed REAL, qty_failed REAL, qty_on_hold REAL, inspected_at DATETIME)`)
+	for i, failed := range []int{2, 1, 2, 3, 2, 30} {
+		testDB.Exec(`INSERT INTO receiving_inspections (po_id, po_line_id, ipn, qty_received, qty_passed, qty_failed, qty_on_hold, inspected_at)
+			VALUES ('PO-001', 1, 'RES-100', 100, ?, ?, 0, ?)`, 100-failed, failed, fmt.Sprintf("2026-02-0%d 09:00:00", i+1))
+	}
+	c = chart("type=p&source=receiving", 200)
+	if len(c.Violations) == 0 {
+		t.Fatalf("receiving p chart has no violations: %+v", c)
+	}
+	last := c.Violations[len(c.Violations)-1]
+	if len(c.Points) != 6 || last.Chart != "p" || last.Rule != 1 || last.Value != 0.3 || last.TestRecordID != 6 {
+		t.Errorf("receiving p chart = %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	h.DashboardSPC(w, httptest.NewRequest("GET", "/api/v1/dashboard/spc", nil))
+	charts, _ := unmarshalResp[[]models.SPCChart](w.Body.Bytes())
+	if len(charts) != 1 || charts[0].Measurement != "voltage" || charts[0].IPN != "PCB-100" {
+		t.Errorf("dashboard = %+v", charts)
+	}
+	w = httptest.NewRecorder()
+	h.ListSPCViolations(w, httptest.NewRequest("GET", "/api/v1/spc/violations?ipn=PCB-100", nil))
+	list, _ := unmarshalResp[[]models.SPCViolation](w.Body.Bytes())
+	if len(list) != len(rec.SPCViolations) {
+		t.Errorf("violations = %+v", list)
+	}
+}
+
+func TestSPCCheckMatchesChartBeyondWindow(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+	w := httptest.NewRecorder()
+	h.UpdateSPCSettings(w, testutil.AuthedRequest("PUT", "/", []byte(`{"subgroup_size":5,"p_subgroup_size":25,"min_subgroups":5,"window":5}`), cookie))
+	if w.Code != 200 {
+		t.Fatalf("settings: %d %s", w.Code, w.Body.String())
+	}
+
+	// Wide old subgroups fall outside the window; the recent ones are
+	// tight, so 12.6 is only out of control against the recent limits.
+	insert := func(i int, v float64) {
+		testDB.Exec(`INSERT INTO test_records (serial_number, ipn, test_type, result, measurements, tested_at)
+			VALUES (?, 'PCB-100', 'factory', 'pass', ?, ?)`, fmt.Sprintf("SN-%03d", i), fmt.Sprintf(`{"voltage":%g}`, v),
+			fmt.Sprintf("2026-01-01 08:%02d:%02d", i/60, i%60))
+	}
+	for i := 0; i < 50; i++ {
+		insert(i, []float64{10, 14}[i%2])
+	}
+	for i := 50; i < 70; i++ {
+		insert(i, []float64{11.9, 12.0, 12.1, 12.0, 12.0}[i%5])
+	}
+
+	var rec models.TestRecord
+	for i := 0; i < 4; i++ {
+		if len(rec.SPCViolations) != 0 {
+			t.Fatalf("partial subgroup flagged: %+v", rec.SPCViolations)
+		}
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"serial_number":"SN-2%02d","ipn":"PCB-100","test_type":"factory","result":"pass","measurements":"{\"voltage\":12.6}"}`, i)
+		h.CreateTest(w, testutil.AuthedRequest("POST", "/", []byte(body), cookie))
+		rec, _ = unmarshalResp[models.TestRecord](w.Body.Bytes())
+		if i == 1 {
+			// Records added behind the handler's back still count.
+			insert(70, 12.0)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.GetSPCChart(w, httptest.NewRequest("GET", "/api/v1/spc/chart?type=xbar_r&ipn=PCB-100&measurement=voltage&test_type=factory", nil))
+	c, _ := unmarshalResp[models.SPCChart](w.Body.Bytes())
+	var want []string
+	for _, v := range c.Violations {
+		if v.TestRecordID == rec.ID {
+			want = append(want, fmt.Sprint(v.Chart, v.Rule))
+		}
+	}
+	var got []string
+	for _, v := range rec.SPCViolations {
+		got = append(got, fmt.Sprint(v.Chart, v.Rule))
+	}
+	if len(want) == 0 || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("check found %v, chart shows %v", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package quality_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zrp/internal/testutil"
+)
+
+func TestCreateTestRequiresTraining(t *testing.T) {
+	testDB := testutil.SetupTestDB(t)
+	defer testDB.Close()
+	h := newTestHandler(testDB)
+	cookie := testutil.LoginAdmin(t, testDB)
+	testDB.Exec(`INSERT INTO training_requirements (document_id, ipn, activity, revision) VALUES ('DOC-001', 'PCB-100', 'test', 'B')`)
+	testDB.Exec(`INSERT INTO training_records (username, document_id, revision, completed_at) VALUES ('admin', 'DOC-001', 'A', '2026-01-05')`)
+
+	create := func(ipn string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.CreateTest(w, testutil.AuthedRequest("POST", "/", []byte(`{"serial_number":"SN-1","ipn":"`+ipn+`","test_type":"factory","result":"pass"}`), cookie))
+		return w
+	}
+	if w := create("PCB-100"); w.Code != 403 || !strings.Contains(w.Body.String(), "DOC-001 rev B (revision)") {
+		t.Fatalf("untrained tester: %d %s", w.Code, w.Body.String())
+	}
+	if w := create("PCB-200"); w.Code != 200 {
+		t.Fatalf("ungated IPN: %d %s", w.Code, w.Body.String())
+	}
+	testDB.Exec(`INSERT INTO training_records (username, document_id, revision, completed_at) VALUES ('admin', 'DOC-001', 'B', '2026-02-01')`)
+	if w := create("PCB-100"); w.Code != 200 {
+		t.Fatalf("trained tester: %d %s", w.Code, w.Body.String())
+	}
+	var n int
+	testDB.QueryRow("SELECT COUNT(*) FROM test_records WHERE tested_by='admin'").Scan(&n)
+	if n != 2 {
+		t.Errorf("expected 2 test records by admin, got %d", n)
+	}
+}
@@ -0,0 +1,508 @@
+package quality
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+var validMRBDispositions = []string{"use_as_is", "rework", "return_to_vendor", "scrap"}
+
+// mrbSummary loads the quarantine ledger and dispositions of an NCR.
+func (h *Handler) mrbSummary(ncrID string) (models.MRBSummary, error) {
+	s := models.MRBSummary{NCRID: ncrID, Quarantine: []models.MRBQuarantine{}, Dispositions: []models.MRBDisposition{}}
+	if err := h.DB.QueryRow("SELECT title, status FROM ncrs WHERE id=?", ncrID).Scan(&s.Title, &s.Status); err != nil {
+		return s, err
+	}
+	rows, err := h.DB.Query(`SELECT id,ncr_id,ipn,qty,source,receiving_inspection_id,COALESCE(po_id,''),COALESCE(vendor_id,''),
+		COALESCE(unit_cost,0),COALESCE(created_by,''),created_at FROM mrb_quarantine WHERE ncr_id=? ORDER BY id`, ncrID)
+	if err != nil {
+		return s, err
+	}
+	for rows.Next() {
+		var q models.MRBQuarantine
+		var ri sql.NullInt64
+		rows.Scan(&q.ID, &q.NCRID, &q.IPN, &q.Qty, &q.Source, &ri, &q.POID, &q.VendorID, &q.UnitCost, &q.CreatedBy, &q.CreatedAt)
+		if ri.Valid {
+			id := int(ri.Int64)
+			q.ReceivingInspectionID = &id
+		}
+		s.QtyQuarantined += q.Qty
+		s.Quarantine = append(s.Quarantine, q)
+	}
+	rows.Close()
+	rows, err = h.DB.Query(`SELECT id,ncr_id,ipn,disposition,qty,COALESCE(unit_cost,0),COALESCE(total_cost,0),COALESCE(work_order_id,''),
+		COALESCE(shipment_id,''),COALESCE(vendor_id,''),COALESCE(notes,''),COALESCE(decided_by,''),decided_at
+		FROM mrb_dispositions WHERE ncr_id=? ORDER BY id`, ncrID)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := scanMRBDisposition(rows)
+		s.QtyDispositioned += d.Qty
+		s.Dispositions = append(s.Dispositions, d)
+	}
+	s.QtyRemaining = s.QtyQuarantined - s.QtyDispositioned
+	return s, nil
+}
+
+func scanMRBDisposition(rows *sql.Rows) models.MRBDisposition {
+	var d models.MRBDisposition
+	rows.Scan(&d.ID, &d.NCRID, &d.IPN, &d.Disposition, &d.Qty, &d.UnitCost, &d.TotalCost, &d.WorkOrderID,
+		&d.ShipmentID, &d.VendorID, &d.Notes, &d.DecidedBy, &d.DecidedAt)
+	return d
+}
+
+// mrbRemaining returns the quarantined quantity of an IPN under the NCR
+// that has not been dispositioned yet.
+func mrbRemaining(s models.MRBSummary, ipn string) float64 {
+	qty := 0.0
+	for _, q := range s.Quarantine {
+		if q.IPN == ipn {
+			qty += q.Qty
+		}
+	}
+	for _, d := range s.Dispositions {
+		if d.IPN == ipn {
+			qty -= d.Qty
+		}
+	}
+	return qty
+}
+
+// mrbRemainingTx is mrbRemaining read inside tx, for the check that
+// guards a disposition against concurrent ones.
+func mrbRemainingTx(tx *sql.Tx, ncrID, ipn string) float64 {
+	var qty float64
+	tx.QueryRow(`SELECT COALESCE((SELECT SUM(qty) FROM mrb_quarantine WHERE ncr_id=? AND ipn=?),0)
+		- COALESCE((SELECT SUM(qty) FROM mrb_dispositions WHERE ncr_id=? AND ipn=?),0)`, ncrID, ipn, ncrID, ipn).Scan(&qty)
+	return qty
+}
+
+// ListMRB handles GET /api/v1/mrb: the Material Review Board queue of NCRs
+// with quarantined stock still awaiting a disposition (?all=1 includes
+// fully dispositioned ones).
+func (h *Handler) ListMRB(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT DISTINCT ncr_id FROM mrb_quarantine ORDER BY ncr_id")
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	all := r.URL.Query().Get("all") == "1"
+	items := []models.MRBSummary{}
+	for _, id := range ids {
+		s, err := h.mrbSummary(id)
+		if err != nil || (!all && s.QtyRemaining <= 0) {
+			continue
+		}
+		items = append(items, s)
+	}
+	response.JSON(w, items)
+}
+
+// GetNCRMRB handles GET /api/v1/ncrs/:id/mrb.
+func (h *Handler) GetNCRMRB(w http.ResponseWriter, r *http.Request, ncrID string) {
+	s, err := h.mrbSummary(ncrID)
+	if err == sql.ErrNoRows {
+		response.Err(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, s)
+}
+
+// QuarantineNCRStock handles POST /api/v1/ncrs/:id/quarantine. With a
+// receiving_inspection_id it releases units held at receiving inspection
+// to the MRB; otherwise it pulls suspect units out of stock on hand.
+func (h *Handler) QuarantineNCRStock(w http.ResponseWriter, r *http.Request, ncrID string) {
+	var body struct {
+		IPN                   string  `json:"ipn"`
+		Qty                   float64 `json:"qty"`
+		ReceivingInspectionID int     `json:"receiving_inspection_id"`
+		UnitCost              float64 `json:"unit_cost"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	var ncrIPN, status string
+	if err := h.DB.QueryRow("SELECT COALESCE(ipn,''), status FROM ncrs WHERE id=?", ncrID).Scan(&ncrIPN, &status); err != nil {
+		response.Err(w, "not found", 404)
+		return
+	}
+	if status == "closed" {
+		response.Err(w, "NCR "+ncrID+" is closed", 409)
+		return
+	}
+
+	ve := &validation.ValidationErrors{}
+	validation.ValidatePositiveFloat(ve, "qty", body.Qty)
+	if body.UnitCost < 0 {
+		ve.Add("unit_cost", "must be non-negative")
+	}
+	q := models.MRBQuarantine{NCRID: ncrID, IPN: strings.TrimSpace(body.IPN), Qty: body.Qty, UnitCost: body.UnitCost, Source: "stock"}
+	var onHold, held float64
+	if body.ReceivingInspectionID != 0 {
+		q.Source = "hold"
+		ri := body.ReceivingInspectionID
+		q.ReceivingInspectionID = &ri
+		var ipn string
+		var price sql.NullFloat64
+		var inspected sql.NullString
+		err := h.DB.QueryRow(`SELECT ri.ipn, ri.qty_on_hold, ri.inspected_at, ri.po_id, COALESCE(po.vendor_id,''), pl.unit_price
+			FROM receiving_inspections ri LEFT JOIN purchase_orders po ON po.id=ri.po_id LEFT JOIN po_lines pl ON pl.id=ri.po_line_id
+			WHERE ri.id=?`, ri).Scan(&ipn, &onHold, &inspected, &q.POID, &q.VendorID, &price)
+		switch {
+		case err != nil:
+			ve.Add("receiving_inspection_id", fmt.Sprintf("receiving inspection %d not found", ri))
+		case !inspected.Valid:
+			ve.Add("receiving_inspection_id", fmt.Sprintf("receiving inspection %d has not been inspected", ri))
+		default:
+			if q.IPN != "" && q.IPN != ipn {
+				ve.Add("ipn", "does not match the receiving inspection ("+ipn+")")
+			}
+			q.IPN = ipn
+			if q.UnitCost == 0 {
+				q.UnitCost = price.Float64
+			}
+		}
+	} else {
+		if q.IPN == "" {
+			q.IPN = ncrIPN
+		}
+		validation.RequireField(ve, "ipn", q.IPN)
+		if q.UnitCost == 0 {
+			q.UnitCost = h.lastUnitCost(q.IPN)
+		}
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+
+	username := audit.GetUsername(h.DB, r)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if q.Source == "hold" {
+		// Read inside the transaction so concurrent requests cannot
+		// quarantine more than is on hold.
+		tx.QueryRow("SELECT COALESCE(SUM(qty),0) FROM mrb_quarantine WHERE receiving_inspection_id=? AND source='hold'", *q.ReceivingInspectionID).Scan(&held)
+		if body.Qty > onHold-held {
+			response.Err(w, fmt.Sprintf("only %g units of RI-%d are still on hold", onHold-held, *q.ReceivingInspectionID), 400)
+			return
+		}
+	}
+	if q.Source == "stock" {
+		var available float64
+		tx.QueryRow("SELECT COALESCE(qty_on_hand,0)-COALESCE(qty_reserved,0) FROM inventory WHERE ipn=?", q.IPN).Scan(&available)
+		if body.Qty > available {
+			response.Err(w, fmt.Sprintf("only %g units of %s are available to quarantine", available, q.IPN), 400)
+			return
+		}
+		if _, err := tx.Exec("UPDATE inventory SET qty_on_hand=qty_on_hand-?, updated_at=? WHERE ipn=?", body.Qty, now, q.IPN); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+		if _, err := tx.Exec("INSERT INTO inventory_transactions (ipn,type,qty,reference,notes,created_at) VALUES (?,?,?,?,?,?)",
+			q.IPN, "transfer", body.Qty, ncrID, "Moved to MRB quarantine under "+ncrID, now); err != nil {
+			response.Err(w, err.Error(), 500)
+			return
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO mrb_quarantine (ncr_id,ipn,qty,source,receiving_inspection_id,po_id,vendor_id,unit_cost,created_by,created_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`, ncrID, q.IPN, q.Qty, q.Source, q.ReceivingInspectionID, q.POID, q.VendorID, q.UnitCost, username, now); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	audit.LogAudit(h.DB, h.Hub, username, "quarantined", "ncr", ncrID, fmt.Sprintf("Quarantined %g x %s (%s) under %s", q.Qty, q.IPN, q.Source, ncrID))
+	h.GetNCRMRB(w, r, ncrID)
+}
+
+// lastUnitCost is the most recent purchase price of an IPN, or 0.
+func (h *Handler) lastUnitCost(ipn string) float64 {
+	var cost float64
+	h.DB.QueryRow(`SELECT COALESCE(pl.unit_price,0) FROM po_lines pl JOIN purchase_orders po ON po.id=pl.po_id
+		WHERE pl.ipn=? AND pl.unit_price IS NOT NULL ORDER BY po.created_at DESC, pl.id DESC LIMIT 1`, ipn).Scan(&cost)
+	return cost
+}
+
+// DispositionNCR handles POST /api/v1/ncrs/:id/dispositions. The MRB
+// decision moves quarantined units on: use-as-is returns them to stock,
+// rework issues them to a new work order, return-to-vendor puts them on a
+// draft outbound shipment to the vendor, and scrap writes them off at
+// their unit cost.
+func (h *Handler) DispositionNCR(w http.ResponseWriter, r *http.Request, ncrID string) {
+	var body struct {
+		models.MRBDisposition
+		UnitCost *float64 `json:"unit_cost"`
+		Priority string   `json:"priority"`
+	}
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	d := body.MRBDisposition
+	s, err := h.mrbSummary(ncrID)
+	if err == sql.ErrNoRows {
+		response.Err(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if s.Status == "closed" {
+		response.Err(w, "NCR "+ncrID+" is closed", 409)
+		return
+	}
+
+	ve := &validation.ValidationErrors{}
+	validation.RequireField(ve, "disposition", d.Disposition)
+	validation.ValidateEnum(ve, "disposition", d.Disposition, validMRBDispositions)
+	validation.ValidatePositiveFloat(ve, "qty", d.Qty)
+	validation.ValidateMaxLength(ve, "notes", d.Notes, 1000)
+	if body.Priority != "" {
+		validation.ValidateEnum(ve, "priority", body.Priority, validation.ValidWOPriorities)
+	}
+	if (d.Disposition == "rework" || d.Disposition == "return_to_vendor") && d.Qty != math.Trunc(d.Qty) {
+		ve.Add("qty", "must be a whole number for "+d.Disposition)
+	}
+	if body.UnitCost != nil && *body.UnitCost < 0 {
+		ve.Add("unit_cost", "must be non-negative")
+	}
+	d.IPN = strings.TrimSpace(d.IPN)
+	if d.IPN == "" {
+		ipns := map[string]bool{}
+		for _, q := range s.Quarantine {
+			ipns[q.IPN] = true
+		}
+		if len(ipns) == 1 {
+			d.IPN = s.Quarantine[0].IPN
+		}
+	}
+	validation.RequireField(ve, "ipn", d.IPN)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	if left := mrbRemaining(s, d.IPN); d.Qty > left {
+		response.Err(w, fmt.Sprintf("only %g units of %s are awaiting disposition on %s", left, d.IPN, ncrID), 400)
+		return
+	}
+
+	// Cost and vendor come from the latest quarantine entry for the IPN.
+	for _, q := range s.Quarantine {
+		if q.IPN != d.IPN {
+			continue
+		}
+		d.UnitCost = q.UnitCost
+		if d.VendorID == "" && q.VendorID != "" {
+			d.VendorID = q.VendorID
+		}
+	}
+	if body.UnitCost != nil {
+		d.UnitCost = *body.UnitCost
+	}
+	if d.UnitCost == 0 {
+		d.UnitCost = h.lastUnitCost(d.IPN)
+	}
+	var vendorName, vendorAddress string
+	if d.Disposition == "return_to_vendor" {
+		if d.VendorID == "" {
+			response.Err(w, "vendor_id is required to return stock to the vendor", 400)
+			return
+		}
+		if err := h.DB.QueryRow("SELECT name, COALESCE(address,'') FROM vendors WHERE id=?", d.VendorID).Scan(&vendorName, &vendorAddress); err != nil {
+			response.Err(w, "vendor "+d.VendorID+" not found", 400)
+			return
+		}
+	}
+	if d.Disposition == "scrap" {
+		d.TotalCost = math.Round(d.Qty*d.UnitCost*100) / 100
+	}
+
+	switch d.Disposition {
+	case "rework":
+		d.WorkOrderID = h.NextIDFunc("WO", "work_orders", 4)
+	case "return_to_vendor":
+		d.ShipmentID = h.NextIDFunc("SHP", "shipments", 4)
+	}
+	d.NCRID = ncrID
+	d.DecidedBy = audit.GetUsername(h.DB, r)
+	d.DecidedAt = time.Now().Format("2006-01-02 15:04:05")
+	if body.Priority == "" {
+		body.Priority = "normal"
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	if left := mrbRemainingTx(tx, ncrID, d.IPN); d.Qty > left {
+		response.Err(w, fmt.Sprintf("only %g units of %s are awaiting disposition on %s", left, d.IPN, ncrID), 400)
+		return
+	}
+	txn := func(kind, ref, notes string) error {
+		_, err := tx.Exec("INSERT INTO inventory_transactions (ipn,type,qty,reference,notes,created_at) VALUES (?,?,?,?,?,?)",
+			d.IPN, kind, d.Qty, ref, notes, d.DecidedAt)
+		return err
+	}
+	switch d.Disposition {
+	case "use_as_is":
+		if _, err = tx.Exec("INSERT OR IGNORE INTO inventory (ipn) VALUES (?)", d.IPN); err == nil {
+			_, err = tx.Exec("UPDATE inventory SET qty_on_hand=qty_on_hand+?, updated_at=? WHERE ipn=?", d.Qty, d.DecidedAt, d.IPN)
+		}
+		if err == nil {
+			err = txn("receive", ncrID, "MRB use-as-is from quarantine ("+ncrID+")")
+		}
+	case "rework":
+		_, err = tx.Exec("INSERT INTO work_orders (id,assembly_ipn,qty,status,priority,notes,created_at) VALUES (?,?,?,'open',?,?,?)",
+			d.WorkOrderID, d.IPN, int(d.Qty), body.Priority, "Rework per MRB disposition of "+ncrID, d.DecidedAt)
+		if err == nil {
+			err = txn("issue", d.WorkOrderID, "MRB rework: issued from quarantine ("+ncrID+") to "+d.WorkOrderID)
+		}
+	case "return_to_vendor":
+		to := vendorName
+		if vendorAddress != "" {
+			to += "\n" + vendorAddress
+		}
+		_, err = tx.Exec(`INSERT INTO shipments (id,type,status,to_address,notes,created_by,created_at,updated_at)
+			VALUES (?,'outbound','draft',?,?,?,?,?)`, d.ShipmentID, to, "Return to vendor per MRB disposition of "+ncrID, d.DecidedBy, d.DecidedAt, d.DecidedAt)
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO shipment_lines (shipment_id,ipn,qty) VALUES (?,?,?)", d.ShipmentID, d.IPN, int(d.Qty))
+		}
+		if err == nil {
+			err = txn("return", d.ShipmentID, "MRB return to vendor "+d.VendorID+" from quarantine ("+ncrID+")")
+		}
+	case "scrap":
+		err = txn("scrap", ncrID, fmt.Sprintf("MRB scrap from quarantine (%s), cost %.2f", ncrID, d.TotalCost))
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	res, err := tx.Exec(`INSERT INTO mrb_dispositions (ncr_id,ipn,disposition,qty,unit_cost,total_cost,work_order_id,shipment_id,vendor_id,notes,decided_by,decided_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`, d.NCRID, d.IPN, d.Disposition, d.Qty, d.UnitCost, d.TotalCost,
+		d.WorkOrderID, d.ShipmentID, d.VendorID, d.Notes, d.DecidedBy, d.DecidedAt)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+	d.ID = int(id)
+
+	audit.LogAudit(h.DB, h.Hub, d.DecidedBy, "dispositioned", "ncr", ncrID,
+		fmt.Sprintf("MRB %s: %g x %s on %s", strings.ReplaceAll(d.Disposition, "_", "-"), d.Qty, d.IPN, ncrID))
+	if d.WorkOrderID != "" {
+		audit.LogAudit(h.DB, h.Hub, d.DecidedBy, "created", "workorder", d.WorkOrderID, "Created WO "+d.WorkOrderID+" to rework "+ncrID)
+	}
+	if d.ShipmentID != "" {
+		audit.LogAudit(h.DB, h.Hub, d.DecidedBy, "created", "shipment", d.ShipmentID, "Created RTV shipment "+d.ShipmentID+" for "+ncrID)
+	}
+	response.JSON(w, d)
+}
+
+// ScrapCostEntry is the scrap charged to one IPN in the scrap cost report.
+type ScrapCostEntry struct {
+	IPN       string  `json:"ipn"`
+	Qty       float64 `json:"qty"`
+	TotalCost float64 `json:"total_cost"`
+}
+
+// ScrapCostReport is the cost of MRB scrap dispositions over a period.
+type ScrapCostReport struct {
+	From         string                  `json:"from"`
+	To           string                  `json:"to"`
+	TotalQty     float64                 `json:"total_qty"`
+	TotalCost    float64                 `json:"total_cost"`
+	ByIPN        []ScrapCostEntry        `json:"by_ipn"`
+	Dispositions []models.MRBDisposition `json:"dispositions"`
+}
+
+// ReportScrapCost handles GET /api/v1/reports/scrap-cost?from=&to=, the
+// cost of scrapped nonconforming stock by IPN (dates inclusive).
+func (h *Handler) ReportScrapCost(w http.ResponseWriter, r *http.Request) {
+	rep := ScrapCostReport{From: r.URL.Query().Get("from"), To: r.URL.Query().Get("to"),
+		ByIPN: []ScrapCostEntry{}, Dispositions: []models.MRBDisposition{}}
+	ve := &validation.ValidationErrors{}
+	validation.ValidateDate(ve, "from", rep.From)
+	validation.ValidateDate(ve, "to", rep.To)
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	query := `SELECT id,ncr_id,ipn,disposition,qty,COALESCE(unit_cost,0),COALESCE(total_cost,0),COALESCE(work_order_id,''),
+		COALESCE(shipment_id,''),COALESCE(vendor_id,''),COALESCE(notes,''),COALESCE(decided_by,''),decided_at
+		FROM mrb_dispositions WHERE disposition='scrap'`
+	var args []interface{}
+	if rep.From != "" {
+		query += " AND date(decided_at) >= ?"
+		args = append(args, rep.From)
+	}
+	if rep.To != "" {
+		query += " AND date(decided_at) <= ?"
+		args = append(args, rep.To)
+	}
+	rows, err := h.DB.Query(query+" ORDER BY decided_at, id", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	byIPN := map[string]*ScrapCostEntry{}
+	for rows.Next() {
+		d := scanMRBDisposition(rows)
+		rep.Dispositions = append(rep.Dispositions, d)
+		rep.TotalQty += d.Qty
+		rep.TotalCost += d.TotalCost
+		e := byIPN[d.IPN]
+		if e == nil {
+			e = &ScrapCostEntry{IPN: d.IPN}
+			byIPN[d.IPN] = e
+		}
+		e.Qty += d.Qty
+		e.TotalCost += d.TotalCost
+	}
+	for _, e := range byIPN {
+		e.TotalCost = math.Round(e.TotalCost*100) / 100
+		rep.ByIPN = append(rep.ByIPN, *e)
+	}
+	sort.Slice(rep.ByIPN, func(i, j int) bool { return rep.ByIPN[i].TotalCost > rep.ByIPN[j].TotalCost })
+	rep.TotalCost = math.Round(rep.TotalCost*100) / 100
+	response.JSON(w, rep)
+}
@@ -12,6 +12,7 @@ import (
 	"zrp/internal/models"
 	"zrp/internal/testutil"
 
+	"golang.org/x/crypto/bcrypt"
 	_ "modernc.org/sqlite"
 )
 
@@ -24,8 +25,15 @@ func newWorkflowHandler(testDB *sql.DB, opts ...func(h *quality.Handler)) *quali
 	return h
 }
 
+// testUserPassword signs approvals for the seeded users.
+const testUserPassword = "test-pass"
+
 func seedTestUsers(t *testing.T, testDB *sql.DB) {
 	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testUserPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash test password: %v", err)
+	}
 	// Create test users with different roles
 	users := []struct {
 		username string
@@ -39,7 +47,7 @@ func seedTestUsers(t *testing.T, testDB *sql.DB) {
 
 	for _, user := range users {
 		_, err := testDB.Exec(`INSERT OR IGNORE INTO users (username, password_hash, role) VALUES (?, ?, ?)`,
-			user.username, "test_hash", user.role)
+			user.username, string(hash), user.role)
 		if err != nil {
 			t.Fatalf("Failed to create test user %s: %v", user.username, err)
 		}
@@ -261,6 +269,7 @@ func testCAPAApprovalSecurity(t *testing.T, testDB *sql.DB) {
 
 		updateData := map[string]interface{}{
 			"approved_by_qe": "approve",
+			"password":       testUserPassword,
 		}
 
 		body, _ := json.Marshal(updateData)
@@ -286,6 +295,7 @@ func testCAPAApprovalSecurity(t *testing.T, testDB *sql.DB) {
 
 		updateData := map[string]interface{}{
 			"approved_by_qe": "approve",
+			"password":       testUserPassword,
 		}
 
 		body, _ := json.Marshal(updateData)
@@ -346,6 +356,7 @@ func testCAPAStatusAutoAdvancement(t *testing.T, testDB *sql.DB) {
 
 	updateData := map[string]interface{}{
 		"approved_by_qe": "approve",
+		"password":       testUserPassword,
 	}
 
 	body, _ := json.Marshal(updateData)
@@ -370,6 +381,7 @@ func testCAPAStatusAutoAdvancement(t *testing.T, testDB *sql.DB) {
 
 	updateData = map[string]interface{}{
 		"approved_by_mgr": "approve",
+		"password":        testUserPassword,
 	}
 
 	body, _ = json.Marshal(updateData)
@@ -0,0 +1,708 @@
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zrp/internal/audit"
+	"zrp/internal/models"
+	"zrp/internal/response"
+	"zrp/internal/validation"
+)
+
+// Control chart defaults, used when the spc_* settings are not set.
+const (
+	DefaultSPCSubgroupSize  = 5
+	DefaultSPCPSubgroupSize = 25
+	DefaultSPCMinSubgroups  = 5
+	DefaultSPCWindow        = 25
+)
+
+// SPCSettings configures the control charts. Subgroups are consecutive
+// test records (SubgroupSize for X-bar/R, PSubgroupSize for p-charts);
+// limits are computed over the last Window subgroups and rules are only
+// checked once there are MinSubgroups of them.
+type SPCSettings struct {
+	SubgroupSize  int  `json:"subgroup_size"`
+	PSubgroupSize int  `json:"p_subgroup_size"`
+	MinSubgroups  int  `json:"min_subgroups"`
+	Window        int  `json:"window"`
+	AutoNCR       bool `json:"auto_ncr"`
+}
+
+// xbarRConstants are the A2, D3 and D4 factors by subgroup size.
+var xbarRConstants = map[int][3]float64{
+	2: {1.880, 0, 3.267}, 3: {1.023, 0, 2.574}, 4: {0.729, 0, 2.282},
+	5: {0.577, 0, 2.114}, 6: {0.483, 0, 2.004}, 7: {0.419, 0.076, 1.924},
+	8: {0.373, 0.136, 1.864}, 9: {0.337, 0.184, 1.816}, 10: {0.308, 0.223, 1.777},
+}
+
+// spcRules describes the Western Electric rules.
+var spcRules = map[int]string{
+	1: "1 point beyond 3 sigma",
+	2: "2 of 3 points beyond 2 sigma on one side",
+	3: "4 of 5 points beyond 1 sigma on one side",
+	4: "8 points in a row on one side of the center line",
+}
+
+func (h *Handler) spcSettings() SPCSettings {
+	s := SPCSettings{SubgroupSize: DefaultSPCSubgroupSize, PSubgroupSize: DefaultSPCPSubgroupSize,
+		MinSubgroups: DefaultSPCMinSubgroups, Window: DefaultSPCWindow}
+	for key, dst := range map[string]*int{"spc_subgroup_size": &s.SubgroupSize, "spc_p_subgroup_size": &s.PSubgroupSize,
+		"spc_min_subgroups": &s.MinSubgroups, "spc_window": &s.Window} {
+		var v string
+		if err := h.DB.QueryRow("SELECT value FROM app_settings WHERE key=?", key).Scan(&v); err == nil {
+			if n, err := strconv.Atoi(v); err == nil {
+				*dst = n
+			}
+		}
+	}
+	var v string
+	h.DB.QueryRow("SELECT value FROM app_settings WHERE key='spc_auto_ncr'").Scan(&v)
+	s.AutoNCR = v == "true"
+	return s
+}
+
+func (s SPCSettings) validate() string {
+	switch {
+	case s.SubgroupSize < 2 || s.SubgroupSize > 10:
+		return "subgroup_size must be between 2 and 10"
+	case s.PSubgroupSize < 2 || s.PSubgroupSize > 1000:
+		return "p_subgroup_size must be between 2 and 1000"
+	case s.MinSubgroups < 2 || s.MinSubgroups > 100:
+		return "min_subgroups must be between 2 and 100"
+	case s.Window < s.MinSubgroups || s.Window > 500:
+		return "window must be at least min_subgroups and at most 500"
+	}
+	return ""
+}
+
+// GetSPCSettings handles GET /api/v1/settings/spc.
+func (h *Handler) GetSPCSettings(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, h.spcSettings())
+}
+
+// UpdateSPCSettings handles PUT /api/v1/settings/spc.
+func (h *Handler) UpdateSPCSettings(w http.ResponseWriter, r *http.Request) {
+	var body SPCSettings
+	if err := response.DecodeBody(r, &body); err != nil {
+		response.Err(w, "invalid body", 400)
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		response.Err(w, msg, 400)
+		return
+	}
+	settings := map[string]string{
+		"spc_subgroup_size":   strconv.Itoa(body.SubgroupSize),
+		"spc_p_subgroup_size": strconv.Itoa(body.PSubgroupSize),
+		"spc_min_subgroups":   strconv.Itoa(body.MinSubgroups),
+		"spc_window":          strconv.Itoa(body.Window),
+		"spc_auto_ncr":        strconv.FormatBool(body.AutoNCR),
+	}
+	for k, v := range settings {
+		if _, err := h.DB.Exec(`INSERT INTO app_settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, k, v); err != nil {
+			response.Err(w, "failed to save setting", 500)
+			return
+		}
+	}
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "updated", "settings", "spc",
+		fmt.Sprintf("Set SPC subgroups to %d (X-bar/R) and %d (p), auto NCR %t", body.SubgroupSize, body.PSubgroupSize, body.AutoNCR))
+	response.JSON(w, h.spcSettings())
+}
+
+// measurementValues returns the numeric entries of a test record's
+// measurements JSON object.
+func measurementValues(raw string) map[string]float64 {
+	var m map[string]interface{}
+	if json.Unmarshal([]byte(raw), &m) != nil {
+		return nil
+	}
+	out := map[string]float64{}
+	for k, v := range m {
+		switch x := v.(type) {
+		case float64:
+			out[k] = x
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				out[k] = f
+			}
+		}
+	}
+	return out
+}
+
+// spcGroup is one subgroup of samples before limits are computed.
+type spcGroup struct {
+	Label           string
+	FirstID, LastID int
+	Values          []float64
+	N               int
+	Defectives      float64
+}
+
+// testGroups splits the test records of an IPN (and test type) into
+// consecutive subgroups of size n, oldest first. With a measurement only
+// records carrying it count and Values holds the readings; otherwise
+// failures are counted as defectives. With limit > 0 only the newest
+// limit records are read. It also returns the number of records waiting
+// for the next subgroup.
+func (h *Handler) testGroups(ipn, testType, measurement string, n, limit int) ([]spcGroup, int, error) {
+	q := "SELECT id, CAST(tested_at AS TEXT), result, COALESCE(measurements,'') FROM test_records WHERE ipn=?"
+	args := []interface{}{ipn}
+	if testType != "" {
+		q += " AND test_type=?"
+		args = append(args, testType)
+	}
+	order := " ORDER BY tested_at, id"
+	if limit > 0 {
+		order = " ORDER BY tested_at DESC, id DESC"
+	}
+	rows, err := h.DB.Query(q+order, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	type record struct {
+		id         int
+		at, result string
+		value      float64
+	}
+	var recs []record
+	for rows.Next() && (limit <= 0 || len(recs) < limit) {
+		var rec record
+		var m string
+		rows.Scan(&rec.id, &rec.at, &rec.result, &m)
+		if measurement != "" {
+			v, ok := measurementValues(m)[measurement]
+			if !ok {
+				continue
+			}
+			rec.value = v
+		}
+		recs = append(recs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if limit > 0 {
+		for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+			recs[i], recs[j] = recs[j], recs[i]
+		}
+	}
+
+	var groups []spcGroup
+	cur := spcGroup{}
+	for _, rec := range recs {
+		if measurement != "" {
+			cur.Values = append(cur.Values, rec.value)
+		}
+		if cur.N == 0 {
+			cur.FirstID = rec.id
+		}
+		cur.N++
+		cur.LastID, cur.Label = rec.id, rec.at
+		if rec.result == "fail" {
+			cur.Defectives++
+		}
+		if cur.N == n {
+			groups = append(groups, cur)
+			cur = spcGroup{}
+		}
+	}
+	return groups, cur.N, nil
+}
+
+// spcSeries identifies the test records of one chart; measurement is
+// empty for the p-chart.
+type spcSeries struct{ ipn, testType, measurement string }
+
+type spcCount struct{ maxID, n int }
+
+// spcRecordCount returns how many test records the chart of s holds.
+// Counts are kept on the handler and only records added since the last
+// call are read, so checking a new record does not rescan the history.
+func (h *Handler) spcRecordCount(s spcSeries) (int, error) {
+	h.spcMu.Lock()
+	defer h.spcMu.Unlock()
+	c := h.spcCounts[s]
+	q := "SELECT id, COALESCE(measurements,'') FROM test_records WHERE ipn=? AND id>?"
+	args := []interface{}{s.ipn, c.maxID}
+	if s.testType != "" {
+		q += " AND test_type=?"
+		args = append(args, s.testType)
+	}
+	rows, err := h.DB.Query(q, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var m string
+		rows.Scan(&id, &m)
+		c.maxID = max(c.maxID, id)
+		if s.measurement != "" {
+			if _, ok := measurementValues(m)[s.measurement]; !ok {
+				continue
+			}
+		}
+		c.n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if h.spcCounts == nil {
+		h.spcCounts = map[spcSeries]spcCount{}
+	}
+	h.spcCounts[s] = c
+	return c.n, nil
+}
+
+// receivingGroups treats every inspected receiving lot as a subgroup: the
+// units passed or failed, with the failures as defectives.
+func (h *Handler) receivingGroups(ipn string) ([]spcGroup, error) {
+	q := `SELECT id, CAST(inspected_at AS TEXT), qty_passed, qty_failed FROM receiving_inspections
+		WHERE inspected_at IS NOT NULL AND qty_passed + qty_failed > 0`
+	var args []interface{}
+	if ipn != "" {
+		q += " AND ipn=?"
+		args = append(args, ipn)
+	}
+	rows, err := h.DB.Query(q+" ORDER BY inspected_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups []spcGroup
+	for rows.Next() {
+		var g spcGroup
+		var passed, failed float64
+		rows.Scan(&g.FirstID, &g.Label, &passed, &failed)
+		g.LastID = g.FirstID
+		g.N = int(math.Round(passed + failed))
+		g.Defectives = failed
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// westernElectric returns the rules broken at point i, given each point's
+// deviation from the center line and its sigma.
+func westernElectric(dev, sigma []float64, i int) []int {
+	z := func(j int) float64 {
+		if sigma[j] <= 0 {
+			return 0
+		}
+		return dev[j] / sigma[j]
+	}
+	rules := []int{}
+	if math.Abs(z(i)) > 3 {
+		rules = append(rules, 1)
+	}
+	for _, side := range []float64{1, -1} {
+		beyond := func(from int, k float64) int {
+			n := 0
+			for j := from; j <= i; j++ {
+				if side*z(j) > k {
+					n++
+				}
+			}
+			return n
+		}
+		if i >= 2 && side*z(i) > 2 && beyond(i-2, 2) >= 2 {
+			rules = append(rules, 2)
+		}
+		if i >= 4 && side*z(i) > 1 && beyond(i-4, 1) >= 4 {
+			rules = append(rules, 3)
+		}
+		if i >= 7 {
+			run := true
+			for j := i - 7; j <= i; j++ {
+				if side*dev[j] <= 0 {
+					run = false
+					break
+				}
+			}
+			if run {
+				rules = append(rules, 4)
+			}
+		}
+	}
+	return rules
+}
+
+// window keeps the last n groups and numbers them from the start.
+func window(groups []spcGroup, n int) ([]spcGroup, int) {
+	if len(groups) > n {
+		return groups[len(groups)-n:], len(groups) - n
+	}
+	return groups, 0
+}
+
+// xbarRChart computes X-bar and R limits over the groups and checks the
+// Western Electric rules on the means and rule 1 on the ranges.
+func xbarRChart(groups []spcGroup, n int, st SPCSettings) models.SPCChart {
+	c := models.SPCChart{Type: "xbar_r", Source: "tests", SubgroupSize: n, Points: []models.SPCPoint{}}
+	groups, offset := window(groups, st.Window)
+	if len(groups) == 0 {
+		return c
+	}
+	var xbar, rbar float64
+	for i, g := range groups {
+		lo, hi, sum := g.Values[0], g.Values[0], 0.0
+		for _, v := range g.Values {
+			sum += v
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		p := models.SPCPoint{Index: offset + i + 1, Label: g.Label, FirstID: g.FirstID, LastID: g.LastID,
+			N: g.N, Value: sum / float64(g.N), Range: hi - lo, Rules: []int{}, RangeRules: []int{}}
+		xbar += p.Value
+		rbar += p.Range
+		c.Points = append(c.Points, p)
+	}
+	xbar /= float64(len(groups))
+	rbar /= float64(len(groups))
+	k := xbarRConstants[n]
+	c.Center, c.UCL, c.LCL = xbar, xbar+k[0]*rbar, xbar-k[0]*rbar
+	c.RangeCenter, c.RangeUCL, c.RangeLCL = rbar, k[2]*rbar, k[1]*rbar
+	c.EnoughData = len(c.Points) >= st.MinSubgroups
+	dev := make([]float64, len(c.Points))
+	sigma := make([]float64, len(c.Points))
+	for i := range c.Points {
+		c.Points[i].UCL, c.Points[i].LCL = c.UCL, c.LCL
+		dev[i] = c.Points[i].Value - xbar
+		sigma[i] = k[0] * rbar / 3
+	}
+	if !c.EnoughData {
+		return c
+	}
+	for i, p := range c.Points {
+		c.Points[i].Rules = westernElectric(dev, sigma, i)
+		if rbar > 0 && (p.Range > c.RangeUCL || p.Range < c.RangeLCL) {
+			c.Points[i].RangeRules = []int{1}
+		}
+	}
+	return c
+}
+
+// pChart computes p-chart limits, which vary with each subgroup's size,
+// and checks the Western Electric rules on the fractions defective.
+func pChart(groups []spcGroup, st SPCSettings) models.SPCChart {
+	c := models.SPCChart{Type: "p", Points: []models.SPCPoint{}}
+	groups, offset := window(groups, st.Window)
+	if len(groups) == 0 {
+		return c
+	}
+	var total, defective float64
+	for _, g := range groups {
+		total += float64(g.N)
+		defective += g.Defectives
+	}
+	pbar := defective / total
+	limits := func(n float64) (float64, float64, float64) {
+		s := math.Sqrt(pbar * (1 - pbar) / n)
+		return s, math.Min(1, pbar+3*s), math.Max(0, pbar-3*s)
+	}
+	c.Center = pbar
+	_, c.UCL, c.LCL = limits(total / float64(len(groups)))
+	c.EnoughData = len(groups) >= st.MinSubgroups
+	dev := make([]float64, len(groups))
+	sigma := make([]float64, len(groups))
+	for i, g := range groups {
+		p := models.SPCPoint{Index: offset + i + 1, Label: g.Label, FirstID: g.FirstID, LastID: g.LastID,
+			N: g.N, Value: g.Defectives / float64(g.N), Defectives: g.Defectives, Rules: []int{}}
+		sigma[i], p.UCL, p.LCL = limits(float64(g.N))
+		dev[i] = p.Value - pbar
+		c.Points = append(c.Points, p)
+	}
+	if c.EnoughData {
+		for i := range c.Points {
+			c.Points[i].Rules = westernElectric(dev, sigma, i)
+		}
+	}
+	return c
+}
+
+// fillViolations lists the rules broken on a chart's points.
+func fillViolations(c *models.SPCChart) {
+	c.Violations = []models.SPCViolation{}
+	add := func(chart string, p models.SPCPoint, rule int, value, center, ucl, lcl float64) {
+		c.Violations = append(c.Violations, models.SPCViolation{Chart: chart, Source: c.Source, IPN: c.IPN,
+			Measurement: c.Measurement, TestType: c.TestType, Rule: rule, Description: spcRules[rule],
+			Value: value, Center: center, UCL: ucl, LCL: lcl, TestRecordID: p.LastID})
+	}
+	for _, p := range c.Points {
+		chart := "xbar"
+		if c.Type == "p" {
+			chart = "p"
+		}
+		for _, rule := range p.Rules {
+			add(chart, p, rule, p.Value, c.Center, p.UCL, p.LCL)
+		}
+		for _, rule := range p.RangeRules {
+			add("range", p, rule, p.Range, c.RangeCenter, c.RangeUCL, c.RangeLCL)
+		}
+	}
+}
+
+// spcXbarRChart builds the X-bar/R chart of one measurement of an IPN,
+// from the newest limit records when limit > 0.
+func (h *Handler) spcXbarRChart(ipn, measurement, testType string, n, limit int, st SPCSettings) (models.SPCChart, error) {
+	groups, pending, err := h.testGroups(ipn, testType, measurement, n, limit)
+	if err != nil {
+		return models.SPCChart{}, err
+	}
+	c := xbarRChart(groups, n, st)
+	c.IPN, c.Measurement, c.TestType, c.Pending = ipn, measurement, testType, pending
+	fillViolations(&c)
+	return c, nil
+}
+
+// spcPChart builds the p-chart of an IPN's test failures or of receiving
+// inspection failures (all IPNs when ipn is empty). For test failures,
+// limit > 0 reads only the newest limit records.
+func (h *Handler) spcPChart(source, ipn, testType string, n, limit int, st SPCSettings) (models.SPCChart, error) {
+	var groups []spcGroup
+	var pending int
+	var err error
+	if source == "receiving" {
+		groups, err = h.receivingGroups(ipn)
+		n = 0
+	} else {
+		groups, pending, err = h.testGroups(ipn, testType, "", n, limit)
+	}
+	if err != nil {
+		return models.SPCChart{}, err
+	}
+	c := pChart(groups, st)
+	c.Source, c.IPN, c.TestType, c.SubgroupSize, c.Pending = source, ipn, testType, n, pending
+	fillViolations(&c)
+	return c, nil
+}
+
+// GetSPCChart handles GET /api/v1/spc/chart. Query: type (xbar_r or p),
+// source (tests or receiving, p-charts only), ipn, measurement (X-bar/R),
+// test_type and subgroup_size to override the setting.
+func (h *Handler) GetSPCChart(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	st := h.spcSettings()
+	chartType, source := q.Get("type"), q.Get("source")
+	if chartType == "" {
+		chartType = "xbar_r"
+	}
+	if source == "" {
+		source = "tests"
+	}
+	ve := &validation.ValidationErrors{}
+	validation.ValidateEnum(ve, "type", chartType, []string{"xbar_r", "p"})
+	validation.ValidateEnum(ve, "source", source, []string{"tests", "receiving"})
+	if source == "tests" {
+		validation.RequireField(ve, "ipn", q.Get("ipn"))
+	}
+	if chartType == "xbar_r" {
+		validation.RequireField(ve, "measurement", q.Get("measurement"))
+		if source != "tests" {
+			ve.Add("source", "X-bar/R charts are built from test records")
+		}
+	}
+	n := st.SubgroupSize
+	if chartType == "p" {
+		n = st.PSubgroupSize
+	}
+	if v := q.Get("subgroup_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		max := 10
+		if chartType == "p" {
+			max = 1000
+		}
+		if err != nil || size < 2 || size > max {
+			ve.Add("subgroup_size", fmt.Sprintf("must be between 2 and %d", max))
+		}
+		n = size
+	}
+	if ve.HasErrors() {
+		response.Err(w, ve.Error(), 400)
+		return
+	}
+	var c models.SPCChart
+	var err error
+	if chartType == "p" {
+		c, err = h.spcPChart(source, q.Get("ipn"), q.Get("test_type"), n, 0, st)
+	} else {
+		c, err = h.spcXbarRChart(q.Get("ipn"), q.Get("measurement"), q.Get("test_type"), n, 0, st)
+	}
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	response.JSON(w, c)
+}
+
+// ListSPCViolations handles GET /api/v1/spc/violations?ipn=, the rule
+// violations recorded as test results came in, newest first.
+func (h *Handler) ListSPCViolations(w http.ResponseWriter, r *http.Request) {
+	q := `SELECT id,chart,source,ipn,COALESCE(measurement,''),COALESCE(test_type,''),rule,COALESCE(description,''),
+		COALESCE(value,0),COALESCE(center,0),COALESCE(ucl,0),COALESCE(lcl,0),COALESCE(test_record_id,0),COALESCE(ncr_id,''),created_at
+		FROM spc_violations`
+	var args []interface{}
+	if ipn := r.URL.Query().Get("ipn"); ipn != "" {
+		q += " WHERE ipn=?"
+		args = append(args, ipn)
+	}
+	rows, err := h.DB.Query(q+" ORDER BY id DESC LIMIT 200", args...)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	items := []models.SPCViolation{}
+	for rows.Next() {
+		var v models.SPCViolation
+		rows.Scan(&v.ID, &v.Chart, &v.Source, &v.IPN, &v.Measurement, &v.TestType, &v.Rule, &v.Description,
+			&v.Value, &v.Center, &v.UCL, &v.LCL, &v.TestRecordID, &v.NCRID, &v.CreatedAt)
+		items = append(items, v)
+	}
+	response.JSON(w, items)
+}
+
+// DashboardSPC handles GET /api/v1/dashboard/spc?limit=, the data of the
+// chart_spc dashboard widget: X-bar/R charts of the most recently tested
+// measurements.
+func (h *Handler) DashboardSPC(w http.ResponseWriter, r *http.Request) {
+	limit := 6
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 24 {
+		limit = v
+	}
+	rows, err := h.DB.Query(`SELECT ipn, COALESCE(test_type,''), COALESCE(measurements,'') FROM test_records
+		ORDER BY tested_at DESC, id DESC LIMIT 500`)
+	if err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+	type series struct{ ipn, testType, measurement string }
+	var recent []series
+	seen := map[series]bool{}
+	for rows.Next() {
+		var ipn, testType, m string
+		rows.Scan(&ipn, &testType, &m)
+		values := measurementValues(m)
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := series{ipn, testType, k}
+			if !seen[s] {
+				seen[s] = true
+				recent = append(recent, s)
+			}
+		}
+	}
+	rows.Close()
+	st := h.spcSettings()
+	charts := []models.SPCChart{}
+	for _, s := range recent {
+		if len(charts) == limit {
+			break
+		}
+		if c, err := h.spcXbarRChart(s.ipn, s.measurement, s.testType, st.SubgroupSize, 0, st); err == nil && len(c.Points) > 0 {
+			charts = append(charts, c)
+		}
+	}
+	response.JSON(w, charts)
+}
+
+// checkSPC runs the control charts a new test record belongs to. When the
+// record completes a subgroup, the rules broken by that subgroup are
+// recorded, announced with an spc_violation notification and, with
+// auto_ncr set, put on a new NCR.
+func (h *Handler) checkSPC(t models.TestRecord) []models.SPCViolation {
+	st := h.spcSettings()
+	var found []models.SPCViolation
+	latest := func(c models.SPCChart, err error) {
+		if err != nil || !c.EnoughData || c.Pending != 0 || len(c.Points) == 0 || c.Points[len(c.Points)-1].LastID != t.ID {
+			return
+		}
+		for _, v := range c.Violations {
+			if v.TestRecordID == t.ID {
+				found = append(found, v)
+			}
+		}
+	}
+	// Only a record that completes a subgroup can break a rule, and the
+	// rules only look at the subgroups in the window, so just their
+	// records are read.
+	recent := func(measurement string, n int) int {
+		total, err := h.spcRecordCount(spcSeries{t.IPN, t.TestType, measurement})
+		if err != nil || total == 0 || total%n != 0 {
+			return 0
+		}
+		return min(total, st.Window*n)
+	}
+	values := measurementValues(t.Measurements)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if limit := recent(k, st.SubgroupSize); limit > 0 {
+			latest(h.spcXbarRChart(t.IPN, k, t.TestType, st.SubgroupSize, limit, st))
+		}
+	}
+	if limit := recent("", st.PSubgroupSize); limit > 0 {
+		latest(h.spcPChart("tests", t.IPN, t.TestType, st.PSubgroupSize, limit, st))
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	var lines []string
+	for _, v := range found {
+		what := v.Chart + " chart"
+		if v.Measurement != "" {
+			what = v.Measurement + " " + what
+		}
+		lines = append(lines, fmt.Sprintf("%s: rule %d, %s (%.4g, limits %.4g to %.4g)", what, v.Rule, v.Description, v.Value, v.LCL, v.UCL))
+	}
+	title := fmt.Sprintf("SPC violation on %s after test of %s", t.IPN, t.SerialNumber)
+	message := strings.Join(lines, "\n")
+	var ncrID string
+	if st.AutoNCR {
+		ncrID = h.NextIDFunc("NCR", "ncrs", 3)
+		if _, err := h.DB.Exec(`INSERT INTO ncrs (id,title,description,ipn,serial_number,defect_type,severity,status,created_by,created_at)
+			VALUES (?,?,?,?,?,'spc','minor','open','spc',?)`, ncrID, title, message, t.IPN, t.SerialNumber, now); err != nil {
+			ncrID = ""
+		} else {
+			audit.LogAudit(h.DB, h.Hub, "spc", "created", "ncr", ncrID, "Auto-created from SPC violation on "+t.IPN)
+		}
+	}
+	for i := range found {
+		v := &found[i]
+		v.NCRID, v.CreatedAt = ncrID, now
+		res, err := h.DB.Exec(`INSERT INTO spc_violations (chart,source,ipn,measurement,test_type,rule,description,value,center,ucl,lcl,test_record_id,ncr_id,created_at)
+			VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, v.Chart, v.Source, v.IPN, v.Measurement, v.TestType, v.Rule, v.Description,
+			v.Value, v.Center, v.UCL, v.LCL, v.TestRecordID, v.NCRID, now)
+		if err == nil {
+			id, _ := res.LastInsertId()
+			v.ID = int(id)
+		}
+	}
+	recordID := t.IPN
+	if ncrID != "" {
+		recordID = ncrID
+	}
+	h.DB.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module)
+		VALUES ('spc_violation', 'warning', ?, ?, ?, 'tests')`, title, message, recordID)
+	return found
+}
@@ -1,6 +1,7 @@
 package quality
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"zrp/internal/audit"
 	"zrp/internal/models"
 	"zrp/internal/response"
+	"zrp/internal/training"
 )
 
 // ListTests handles GET /api/v1/tests.
@@ -57,9 +59,19 @@ func (h *Handler) CreateTest(w http.ResponseWriter, r *http.Request) {
 		response.Err(w, "invalid body", 400)
 		return
 	}
+	username := audit.GetUsername(h.DB, r)
+	if err := training.Require(h.DB, username, t.IPN, training.ActivityTest); err != nil {
+		var nq *training.NotQualifiedError
+		if errors.As(err, &nq) {
+			response.Err(w, nq.Error(), 403)
+		} else {
+			response.Err(w, err.Error(), 500)
+		}
+		return
+	}
 	now := time.Now().Format("2006-01-02 15:04:05")
 	res, err := h.DB.Exec("INSERT INTO test_records (serial_number,ipn,firmware_version,test_type,result,measurements,notes,tested_by,tested_at) VALUES (?,?,?,?,?,?,?,?,?)",
-		t.SerialNumber, t.IPN, t.FirmwareVersion, t.TestType, t.Result, t.Measurements, t.Notes, "operator", now)
+		t.SerialNumber, t.IPN, t.FirmwareVersion, t.TestType, t.Result, t.Measurements, t.Notes, username, now)
 	if err != nil {
 		response.Err(w, err.Error(), 500)
 		return
@@ -67,8 +79,9 @@ func (h *Handler) CreateTest(w http.ResponseWriter, r *http.Request) {
 	id, _ := res.LastInsertId()
 	t.ID = int(id)
 	t.TestedAt = now
-	t.TestedBy = "operator"
-	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "created", "test", t.SerialNumber, "Test "+t.Result+" for "+t.SerialNumber)
+	t.TestedBy = username
+	audit.LogAudit(h.DB, h.Hub, username, "created", "test", t.SerialNumber, "Test "+t.Result+" for "+t.SerialNumber)
+	t.SPCViolations = h.checkSPC(t)
 	response.JSON(w, t)
 }
 
@@ -95,6 +95,20 @@ func (h *Handler) CreateShipment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.CreatedBy = audit.GetUsername(h.DB, r)
+	if err := h.InsertShipment(&s); err != nil {
+		response.Err(w, err.Error(), 500)
+		return
+	}
+
+	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "created", "shipment", s.ID, "Created shipment "+s.ID)
+	response.JSON(w, s)
+}
+
+// InsertShipment saves a new shipment and its lines, filling in the ID,
+// default type and status, timestamps and the stored lines. Other modules
+// create shipments through it.
+func (h *Handler) InsertShipment(s *models.Shipment) error {
 	s.ID = h.NextID("SHP", "shipments", 4)
 	if s.Type == "" {
 		s.Type = "outbound"
@@ -103,12 +117,10 @@ func (h *Handler) CreateShipment(w http.ResponseWriter, r *http.Request) {
 		s.Status = "draft"
 	}
 	now := time.Now().Format("2006-01-02 15:04:05")
-	s.CreatedBy = audit.GetUsername(h.DB, r)
 	_, err := h.DB.Exec("INSERT INTO shipments (id,type,status,tracking_number,carrier,from_address,to_address,notes,created_by,created_at,updated_at) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
 		s.ID, s.Type, s.Status, s.TrackingNumber, s.Carrier, s.FromAddress, s.ToAddress, s.Notes, s.CreatedBy, now, now)
 	if err != nil {
-		response.Err(w, err.Error(), 500)
-		return
+		return err
 	}
 	s.CreatedAt = now
 	s.UpdatedAt = now
@@ -118,14 +130,11 @@ func (h *Handler) CreateShipment(w http.ResponseWriter, r *http.Request) {
 		_, err := h.DB.Exec("INSERT INTO shipment_lines (shipment_id,ipn,serial_number,qty,work_order_id,rma_id) VALUES (?,?,?,?,?,?)",
 			s.ID, line.IPN, line.SerialNumber, line.Qty, line.WorkOrderID, line.RMAID)
 		if err != nil {
-			response.Err(w, err.Error(), 500)
-			return
+			return err
 		}
 	}
-
-	audit.LogAudit(h.DB, h.Hub, audit.GetUsername(h.DB, r), "created", "shipment", s.ID, "Created shipment "+s.ID)
 	s.Lines = h.getShipmentLines(s.ID)
-	response.JSON(w, s)
+	return nil
 }
 
 // UpdateShipment handles PUT /api/shipments/:id.
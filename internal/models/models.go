@@ -140,6 +140,52 @@ type WOSerial struct {
 	Notes        string `json:"notes"`
 }
 
+// BOMRequirement is one part a build consumes, at the revision effective
+// for the build. Qty is for the whole build. Alternates are the approved
+// substitutes, preferred first.
+type BOMRequirement struct {
+	IPN         string   `json:"ipn"`
+	Revision    string   `json:"revision,omitempty"`
+	Description string   `json:"description"`
+	Qty         float64  `json:"qty"`
+	Alternates  []string `json:"alternates,omitempty"`
+}
+
+// BuildUnit is the BOM of Count units of a build: one serial number, or
+// the units without a serial yet when Serial is empty. Line quantities are
+// per unit.
+type BuildUnit struct {
+	Serial string           `json:"serial,omitempty"`
+	Count  float64          `json:"count"`
+	Lines  []BOMRequirement `json:"lines"`
+}
+
+// BuildBOM is an assembly's BOM resolved for a build date and the serial
+// numbers being built.
+type BuildBOM struct {
+	AssemblyIPN string           `json:"assembly_ipn"`
+	Date        string           `json:"date"`
+	Serials     []string         `json:"serials,omitempty"`
+	Lines       []BOMRequirement `json:"lines"`
+	Units       []BuildUnit      `json:"units,omitempty"`
+	Warnings    []string         `json:"warnings,omitempty"`
+}
+
+// WOSubstitution records an alternate part used in place of a BOM part on
+// a work order. SerialNumber is empty for units not yet serialized.
+type WOSubstitution struct {
+	ID           int     `json:"id"`
+	WOID         string  `json:"wo_id"`
+	SerialNumber string  `json:"serial_number,omitempty"`
+	IPN          string  `json:"ipn"`
+	Revision     string  `json:"revision,omitempty"`
+	AlternateIPN string  `json:"alternate_ipn"`
+	Qty          float64 `json:"qty"`
+	Reason       string  `json:"reason,omitempty"`
+	CreatedBy    string  `json:"created_by"`
+	CreatedAt    string  `json:"created_at"`
+}
+
 type TestRecord struct {
 	ID              int    `json:"id"`
 	SerialNumber    string `json:"serial_number"`
@@ -151,6 +197,10 @@ type TestRecord struct {
 	Notes           string `json:"notes"`
 	TestedBy        string `json:"tested_by"`
 	TestedAt        string `json:"tested_at"`
+
+	// SPCViolations are the control chart rules the record broke when it
+	// was created.
+	SPCViolations []SPCViolation `json:"spc_violations,omitempty"`
 }
 
 type FieldReport struct {
@@ -171,10 +221,29 @@ type FieldReport struct {
 	ResolvedAt   *string `json:"resolved_at"`
 	NcrID        string  `json:"ncr_id,omitempty"`
 	EcoID        string  `json:"eco_id,omitempty"`
+	Warranty     string  `json:"warranty,omitempty"`
+	ContractID   string  `json:"contract_id,omitempty"`
 	CreatedAt    string  `json:"created_at"`
 	UpdatedAt    string  `json:"updated_at"`
 }
 
+// FieldReportEmail is a message on a field report's email thread: the
+// customer's inbound mail or our acknowledgement.
+type FieldReportEmail struct {
+	ID              int    `json:"id"`
+	ReportID        string `json:"report_id"`
+	Direction       string `json:"direction"`
+	MessageID       string `json:"message_id,omitempty"`
+	InReplyTo       string `json:"in_reply_to,omitempty"`
+	FromAddress     string `json:"from_address"`
+	FromName        string `json:"from_name,omitempty"`
+	ToAddress       string `json:"to_address,omitempty"`
+	Subject         string `json:"subject"`
+	Body            string `json:"body"`
+	AttachmentCount int    `json:"attachment_count"`
+	CreatedAt       string `json:"created_at"`
+}
+
 type NCR struct {
 	ID               string  `json:"id"`
 	Title            string  `json:"title"`
@@ -192,16 +261,60 @@ type NCR struct {
 }
 
 type Device struct {
-	SerialNumber    string  `json:"serial_number"`
-	IPN             string  `json:"ipn"`
-	FirmwareVersion string  `json:"firmware_version"`
-	Customer        string  `json:"customer"`
-	Location        string  `json:"location"`
-	Status          string  `json:"status"`
-	InstallDate     string  `json:"install_date"`
-	LastSeen        *string `json:"last_seen"`
-	Notes           string  `json:"notes"`
-	CreatedAt       string  `json:"created_at"`
+	SerialNumber    string          `json:"serial_number"`
+	IPN             string          `json:"ipn"`
+	FirmwareVersion string          `json:"firmware_version"`
+	Customer        string          `json:"customer"`
+	Location        string          `json:"location"`
+	Status          string          `json:"status"`
+	InstallDate     string          `json:"install_date"`
+	LastSeen        *string         `json:"last_seen"`
+	Notes           string          `json:"notes"`
+	CreatedAt       string          `json:"created_at"`
+	Warranty        *WarrantyStatus `json:"warranty,omitempty"`
+}
+
+// WarrantyStatus says whether a device is covered on a date, by its
+// product warranty or a service contract. Status is "in", "out" or
+// "unknown" (no install date and no contract on record).
+type WarrantyStatus struct {
+	Status          string `json:"status"`
+	Source          string `json:"source,omitempty"`
+	Coverage        string `json:"coverage,omitempty"`
+	Expires         string `json:"expires,omitempty"`
+	WarrantyExpires string `json:"warranty_expires,omitempty"`
+	ContractID      string `json:"contract_id,omitempty"`
+	AsOf            string `json:"as_of"`
+}
+
+// WarrantyPolicy is the standard warranty of a product IPN, running from
+// the device's install date.
+type WarrantyPolicy struct {
+	ID         int    `json:"id"`
+	IPN        string `json:"ipn"`
+	TermMonths int    `json:"term_months"`
+	Coverage   string `json:"coverage"`
+	Terms      string `json:"terms"`
+	CreatedBy  string `json:"created_by"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// ServiceContract extends coverage for a customer's devices between two
+// dates, both included. Without Devices it covers every device of the
+// customer.
+type ServiceContract struct {
+	ID        string   `json:"id"`
+	Customer  string   `json:"customer"`
+	Name      string   `json:"name"`
+	StartDate string   `json:"start_date"`
+	EndDate   string   `json:"end_date"`
+	Coverage  string   `json:"coverage"`
+	Terms     string   `json:"terms"`
+	Status    string   `json:"status"`
+	Devices   []string `json:"devices"`
+	CreatedBy string   `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
 }
 
 type FirmwareCampaign struct {
@@ -225,16 +338,107 @@ type CampaignDevice struct {
 }
 
 type RMA struct {
-	ID                string  `json:"id"`
+	ID                string    `json:"id"`
+	SerialNumber      string    `json:"serial_number"`
+	Customer          string    `json:"customer"`
+	Reason            string    `json:"reason"`
+	Status            string    `json:"status"`
+	DefectDescription string    `json:"defect_description"`
+	Resolution        string    `json:"resolution"`
+	CreatedAt         string    `json:"created_at"`
+	ReceivedAt        *string   `json:"received_at"`
+	ResolvedAt        *string   `json:"resolved_at"`
+	Lines             []RMALine `json:"lines,omitempty"`
+	Parts             []RMAPart `json:"parts,omitempty"`
+}
+
+// RMALine is one returned unit of an RMA. Warranty is "in", "out" or
+// "unknown" (no device or install date on record).
+type RMALine struct {
+	ID                int     `json:"id"`
+	RMAID             string  `json:"rma_id"`
 	SerialNumber      string  `json:"serial_number"`
-	Customer          string  `json:"customer"`
-	Reason            string  `json:"reason"`
-	Status            string  `json:"status"`
+	IPN               string  `json:"ipn"`
 	DefectDescription string  `json:"defect_description"`
-	Resolution        string  `json:"resolution"`
+	Status            string  `json:"status"`
+	Disposition       string  `json:"disposition"`
+	Warranty          string  `json:"warranty"`
+	WarrantyExpires   string  `json:"warranty_expires,omitempty"`
+	RepairWOID        string  `json:"repair_wo_id,omitempty"`
+	ReplacementSerial string  `json:"replacement_serial,omitempty"`
+	AdvanceShipmentID string  `json:"advance_shipment_id,omitempty"`
+	ContractID        string  `json:"contract_id,omitempty"`
+	CreditAmount      float64 `json:"credit_amount,omitempty"`
+	Notes             string  `json:"notes,omitempty"`
 	CreatedAt         string  `json:"created_at"`
-	ReceivedAt        *string `json:"received_at"`
-	ResolvedAt        *string `json:"resolved_at"`
+}
+
+// RMAPart is a spare component consumed from inventory by an RMA repair.
+type RMAPart struct {
+	ID        int     `json:"id"`
+	RMAID     string  `json:"rma_id"`
+	LineID    int     `json:"line_id,omitempty"`
+	WOID      string  `json:"wo_id"`
+	IPN       string  `json:"ipn"`
+	Qty       float64 `json:"qty"`
+	Notes     string  `json:"notes,omitempty"`
+	CreatedBy string  `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// WeibullFit is a two-parameter Weibull fit of time to first failure by
+// median rank regression. Eta (characteristic life) is in days in service.
+type WeibullFit struct {
+	Beta        float64 `json:"beta"`
+	EtaDays     float64 `json:"eta_days"`
+	RSquared    float64 `json:"r_squared"`
+	Failures    int     `json:"failures"`
+	Suspensions int     `json:"suspensions"`
+}
+
+// ReliabilityGroup is field reliability for a slice of the installed fleet:
+// a product IPN, a firmware version or a build lot (work order). MTBFHours
+// is nil while the group has no failures.
+type ReliabilityGroup struct {
+	Key            string      `json:"key"`
+	Units          int         `json:"units"`
+	Failures       int         `json:"failures"`
+	FailedUnits    int         `json:"failed_units"`
+	OperatingHours float64     `json:"operating_hours"`
+	MTBFHours      *float64    `json:"mtbf_hours"`
+	AFRPct         float64     `json:"afr_pct"`
+	Weibull        *WeibullFit `json:"weibull,omitempty"`
+}
+
+// ReliabilityMonth is the failure rate in one month in service: failures
+// in that month over the units that reached it.
+type ReliabilityMonth struct {
+	Month    int     `json:"month"`
+	AtRisk   int     `json:"at_risk"`
+	Failures int     `json:"failures"`
+	RatePct  float64 `json:"rate_pct"`
+}
+
+// ReliabilityDefect is one bar of the failure Pareto.
+type ReliabilityDefect struct {
+	DefectType    string  `json:"defect_type"`
+	Failures      int     `json:"failures"`
+	Pct           float64 `json:"pct"`
+	CumulativePct float64 `json:"cumulative_pct"`
+}
+
+// ReliabilityReport is field reliability computed from devices, failure
+// field reports and returned RMA units. Unmatched counts failures whose
+// serial is not an installed device; they only feed the Pareto.
+type ReliabilityReport struct {
+	AsOf      string              `json:"as_of"`
+	IPN       string              `json:"ipn,omitempty"`
+	Products  []ReliabilityGroup  `json:"products"`
+	Months    []ReliabilityMonth  `json:"months"`
+	Pareto    []ReliabilityDefect `json:"pareto"`
+	Firmware  []ReliabilityGroup  `json:"firmware"`
+	Lots      []ReliabilityGroup  `json:"lots"`
+	Unmatched int                 `json:"unmatched"`
 }
 
 type Quote struct {
@@ -374,6 +578,69 @@ type DocumentVersion struct {
 	ECOID         *string `json:"eco_id"`
 }
 
+// TrainingRequirement says that performing Activity ("test" or "build") on
+// assembly IPN requires training on a document at Revision, the document's
+// last released revision. ValidMonths > 0 makes training expire.
+type TrainingRequirement struct {
+	ID            int    `json:"id"`
+	DocumentID    string `json:"document_id"`
+	DocumentTitle string `json:"document_title,omitempty"`
+	IPN           string `json:"ipn"`
+	Activity      string `json:"activity"`
+	Revision      string `json:"revision"`
+	ValidMonths   int    `json:"valid_months"`
+	CreatedBy     string `json:"created_by"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// TrainingRecord is a user's completed training on a document revision.
+type TrainingRecord struct {
+	ID          int     `json:"id"`
+	Username    string  `json:"username"`
+	DocumentID  string  `json:"document_id"`
+	Revision    string  `json:"revision"`
+	CompletedAt string  `json:"completed_at"`
+	ExpiresAt   *string `json:"expires_at"`
+	Trainer     string  `json:"trainer,omitempty"`
+	Notes       string  `json:"notes,omitempty"`
+	CreatedBy   string  `json:"created_by"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// TrainingTask is training a user still has to complete. Reason is
+// "assigned" or "revision" (opened when a new revision was released).
+type TrainingTask struct {
+	ID          int     `json:"id"`
+	Username    string  `json:"username"`
+	DocumentID  string  `json:"document_id"`
+	Revision    string  `json:"revision"`
+	Reason      string  `json:"reason"`
+	Status      string  `json:"status"`
+	DueDate     string  `json:"due_date,omitempty"`
+	RecordID    *int    `json:"record_id"`
+	CreatedAt   string  `json:"created_at"`
+	CompletedAt *string `json:"completed_at"`
+}
+
+// TrainingGap is a requirement a user does not meet. Reason is
+// "untrained", "revision" (TrainedRevision is older) or "expired".
+type TrainingGap struct {
+	DocumentID      string `json:"document_id"`
+	Revision        string `json:"revision"`
+	Reason          string `json:"reason"`
+	TrainedRevision string `json:"trained_revision,omitempty"`
+	ExpiredAt       string `json:"expired_at,omitempty"`
+}
+
+// Qualification says whether a user may perform an activity on an IPN.
+type Qualification struct {
+	Username  string        `json:"username"`
+	IPN       string        `json:"ipn"`
+	Activity  string        `json:"activity"`
+	Qualified bool          `json:"qualified"`
+	Gaps      []TrainingGap `json:"gaps"`
+}
+
 type SalesOrder struct {
 	ID         string           `json:"id"`
 	QuoteID    string           `json:"quote_id"`
@@ -443,6 +710,79 @@ type AuditEntry struct {
 	CreatedAt   string `json:"created_at"`
 }
 
+// ESignature is an electronic signature on a record: the signer
+// re-entered their password and stated what the signature means, and the
+// record content they signed is bound by its hash.
+type ESignature struct {
+	ID            int    `json:"id"`
+	Module        string `json:"module"`
+	RecordID      string `json:"record_id"`
+	Meaning       string `json:"meaning"`
+	Reason        string `json:"reason,omitempty"`
+	UserID        int    `json:"user_id"`
+	Username      string `json:"username"`
+	FullName      string `json:"full_name"`
+	ContentHash   string `json:"content_hash"`
+	SignatureHash string `json:"signature_hash"`
+	IPAddress     string `json:"ip_address,omitempty"`
+	SignedAt      string `json:"signed_at"`
+	// Intact reports whether the record content still hashes to
+	// ContentHash; it is filled when the manifest is read.
+	Intact bool `json:"intact"`
+}
+
+// AuditCheckpoint is a signed snapshot of the audit log hash chain head.
+// A checkpoint proves the log reached LastID with hash LastHash, so
+// entries removed from the end afterwards are detected.
+type AuditCheckpoint struct {
+	ID        int    `json:"id"`
+	Kind      string `json:"kind"`
+	LastID    int    `json:"last_id"`
+	LastHash  string `json:"last_hash"`
+	Entries   int    `json:"entries"`
+	CreatedAt string `json:"created_at"`
+	Signature string `json:"signature"`
+}
+
+// AuditArchive records audit entries moved out of the database by
+// retention cleanup into a sealed export file.
+type AuditArchive struct {
+	ID         int    `json:"id"`
+	File       string `json:"file"`
+	FirstID    int    `json:"first_id"`
+	LastID     int    `json:"last_id"`
+	Entries    int    `json:"entries"`
+	PrevHash   string `json:"prev_hash"`
+	LastHash   string `json:"last_hash"`
+	FileSHA256 string `json:"file_sha256"`
+	CreatedAt  string `json:"created_at"`
+	Signature  string `json:"signature"`
+}
+
+// AuditChainIssue is one problem found verifying the audit log: a
+// modified entry, a gap in the chain, an entry written outside the
+// chain, or a checkpoint or archive that no longer matches.
+type AuditChainIssue struct {
+	Kind   string `json:"kind"`
+	ID     int    `json:"id,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// AuditChainReport is the result of verifying the audit log hash chain.
+type AuditChainReport struct {
+	Intact      bool              `json:"intact"`
+	Entries     int               `json:"entries"`
+	Unchained   int               `json:"unchained"`
+	Archived    int               `json:"archived"`
+	FirstID     int               `json:"first_id"`
+	LastID      int               `json:"last_id"`
+	HeadHash    string            `json:"head_hash"`
+	Checkpoints int               `json:"checkpoints"`
+	Archives    int               `json:"archives"`
+	Issues      []AuditChainIssue `json:"issues"`
+	VerifiedAt  string            `json:"verified_at"`
+}
+
 // Permission represents a single permission assignment.
 type Permission struct {
 	ID     int    `json:"id"`
@@ -499,6 +839,174 @@ type CAPA struct {
 	ApprovedByMgrAt    *string `json:"approved_by_mgr_at"`
 	CreatedAt          string  `json:"created_at"`
 	UpdatedAt          string  `json:"updated_at"`
+
+	Signatures []ESignature `json:"signatures,omitempty"`
+}
+
+// EightD is a structured 8D problem-solving report on an NCR and/or a
+// CAPA. Its eight disciplines are worked through in order; CurrentStep is
+// the one open for editing.
+type EightD struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	NCRID       string  `json:"ncr_id"`
+	CAPAID      string  `json:"capa_id"`
+	Status      string  `json:"status"`
+	CurrentStep int     `json:"current_step"`
+	CreatedBy   string  `json:"created_by"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	ClosedAt    *string `json:"closed_at"`
+
+	Disciplines []EightDDiscipline `json:"disciplines,omitempty"`
+	Team        []EightDMember     `json:"team,omitempty"`
+	Causes      []EightDCause      `json:"causes,omitempty"`
+	Actions     []EightDAction     `json:"actions,omitempty"`
+}
+
+// EightDDiscipline is one step (D1-D8) of an 8D report. Status is
+// complete, current or locked.
+type EightDDiscipline struct {
+	Number      int     `json:"number"`
+	Name        string  `json:"name"`
+	Content     string  `json:"content"`
+	Status      string  `json:"status"`
+	CompletedBy string  `json:"completed_by"`
+	CompletedAt *string `json:"completed_at"`
+}
+
+// EightDMember is a user on an 8D team.
+type EightDMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	AddedAt  string `json:"added_at"`
+}
+
+// EightDCause is a root-cause analysis entry: a 5-Why step or a fishbone
+// cause under one of its categories.
+type EightDCause struct {
+	ID        int    `json:"id"`
+	Kind      string `json:"kind"`
+	Category  string `json:"category"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+}
+
+// EightDAction is a task on an 8D report (containment, permanent
+// corrective or preventive action) assigned to a user.
+type EightDAction struct {
+	ID          int     `json:"id"`
+	Discipline  int     `json:"discipline"`
+	Description string  `json:"description"`
+	Owner       string  `json:"owner"`
+	DueDate     string  `json:"due_date"`
+	Status      string  `json:"status"`
+	CompletedAt *string `json:"completed_at"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// MRBQuarantine is a quantity of nonconforming stock held under an NCR
+// until the Material Review Board dispositions it.
+type MRBQuarantine struct {
+	ID                    int     `json:"id"`
+	NCRID                 string  `json:"ncr_id"`
+	IPN                   string  `json:"ipn"`
+	Qty                   float64 `json:"qty"`
+	Source                string  `json:"source"`
+	ReceivingInspectionID *int    `json:"receiving_inspection_id"`
+	POID                  string  `json:"po_id"`
+	VendorID              string  `json:"vendor_id"`
+	UnitCost              float64 `json:"unit_cost"`
+	CreatedBy             string  `json:"created_by"`
+	CreatedAt             string  `json:"created_at"`
+}
+
+// MRBDisposition is a Material Review Board decision on quarantined stock.
+type MRBDisposition struct {
+	ID          int     `json:"id"`
+	NCRID       string  `json:"ncr_id"`
+	IPN         string  `json:"ipn"`
+	Disposition string  `json:"disposition"`
+	Qty         float64 `json:"qty"`
+	UnitCost    float64 `json:"unit_cost"`
+	TotalCost   float64 `json:"total_cost"`
+	WorkOrderID string  `json:"work_order_id"`
+	ShipmentID  string  `json:"shipment_id"`
+	VendorID    string  `json:"vendor_id"`
+	Notes       string  `json:"notes"`
+	DecidedBy   string  `json:"decided_by"`
+	DecidedAt   string  `json:"decided_at"`
+}
+
+// MRBSummary is the quarantine and disposition state of one NCR.
+type MRBSummary struct {
+	NCRID            string           `json:"ncr_id"`
+	Title            string           `json:"title"`
+	Status           string           `json:"status"`
+	QtyQuarantined   float64          `json:"qty_quarantined"`
+	QtyDispositioned float64          `json:"qty_dispositioned"`
+	QtyRemaining     float64          `json:"qty_remaining"`
+	Quarantine       []MRBQuarantine  `json:"quarantine"`
+	Dispositions     []MRBDisposition `json:"dispositions"`
+}
+
+// SPCPoint is one subgroup on a control chart. For X-bar/R charts Value is
+// the subgroup mean and Range its range; for p-charts Value is the
+// fraction defective and the limits vary with the subgroup size.
+type SPCPoint struct {
+	Index      int     `json:"index"`
+	Label      string  `json:"label"`
+	FirstID    int     `json:"first_id"`
+	LastID     int     `json:"last_id"`
+	N          int     `json:"n"`
+	Value      float64 `json:"value"`
+	Range      float64 `json:"range,omitempty"`
+	Defectives float64 `json:"defectives,omitempty"`
+	UCL        float64 `json:"ucl"`
+	LCL        float64 `json:"lcl"`
+	Rules      []int   `json:"rules"`
+	RangeRules []int   `json:"range_rules,omitempty"`
+}
+
+// SPCViolation is a Western Electric rule broken on a control chart.
+// TestRecordID is the last record of the offending subgroup; on receiving
+// p-charts it is the receiving inspection.
+type SPCViolation struct {
+	ID           int     `json:"id"`
+	Chart        string  `json:"chart"`
+	Source       string  `json:"source"`
+	IPN          string  `json:"ipn"`
+	Measurement  string  `json:"measurement"`
+	TestType     string  `json:"test_type"`
+	Rule         int     `json:"rule"`
+	Description  string  `json:"description"`
+	Value        float64 `json:"value"`
+	Center       float64 `json:"center"`
+	UCL          float64 `json:"ucl"`
+	LCL          float64 `json:"lcl"`
+	TestRecordID int     `json:"test_record_id"`
+	NCRID        string  `json:"ncr_id"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// SPCChart is the data behind an X-bar/R chart or a p-chart.
+type SPCChart struct {
+	Type         string         `json:"type"`
+	Source       string         `json:"source"`
+	IPN          string         `json:"ipn"`
+	Measurement  string         `json:"measurement,omitempty"`
+	TestType     string         `json:"test_type,omitempty"`
+	SubgroupSize int            `json:"subgroup_size"`
+	Center       float64        `json:"center"`
+	UCL          float64        `json:"ucl"`
+	LCL          float64        `json:"lcl"`
+	RangeCenter  float64        `json:"range_center,omitempty"`
+	RangeUCL     float64        `json:"range_ucl,omitempty"`
+	RangeLCL     float64        `json:"range_lcl,omitempty"`
+	EnoughData   bool           `json:"enough_data"`
+	Pending      int            `json:"pending"`
+	Points       []SPCPoint     `json:"points"`
+	Violations   []SPCViolation `json:"violations"`
 }
 
 // PriceHistory represents a vendor price history entry.
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// VersionedResource describes a table whose single-record endpoints are
+// protected by optimistic concurrency control.
+type VersionedResource struct {
+	Table    string
+	IDColumn string
+}
+
+// VersionedResources maps the first API path segment to the table backing
+// GET/PUT /api/v1/{segment}/{id}.
+var VersionedResources = map[string]VersionedResource{
+	"ecos":          {"ecos", "id"},
+	"workorders":    {"work_orders", "id"},
+	"ncrs":          {"ncrs", "id"},
+	"capas":         {"capas", "id"},
+	"docs":          {"documents", "id"},
+	"vendors":       {"vendors", "id"},
+	"pos":           {"purchase_orders", "id"},
+	"rmas":          {"rmas", "id"},
+	"quotes":        {"quotes", "id"},
+	"devices":       {"devices", "serial_number"},
+	"inventory":     {"inventory", "ipn"},
+	"sales-orders":  {"sales_orders", "id"},
+	"field-reports": {"field_reports", "id"},
+	"shipments":     {"shipments", "id"},
+	"invoices":      {"invoices", "id"},
+}
+
+// RecordETag returns a strong ETag derived from the current contents of a row,
+// or "" if the row does not exist.
+func RecordETag(dbConn *sql.DB, res VersionedResource, id string) (string, error) {
+	rows, err := dbConn.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", res.Table, res.IDColumn), id)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		if b, ok := values[i].([]byte); ok {
+			row[col] = string(b)
+		} else {
+			row[col] = values[i]
+		}
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// etagMatches reports whether an If-Match header value matches etag using
+// the strong comparison RFC 9110 requires for If-Match: a weak validator
+// never matches, even if its opaque tag is the same.
+func etagMatches(header, etag string) bool {
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds a response until the handler finishes so that
+// headers can still be set afterwards.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header         { return b.header }
+func (b *bufferedWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedWriter) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+// recordLock is a per-record mutex shared by the requests waiting on it.
+type recordLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// recordLocks serializes writes to the same record so the If-Match check and
+// the update happen atomically with respect to other requests. Entries are
+// removed when the last holder unlocks, so the map only holds records with
+// a write in flight.
+var (
+	recordLocks   = map[string]*recordLock{}
+	recordLocksMu sync.Mutex
+)
+
+func lockRecord(key string) func() {
+	recordLocksMu.Lock()
+	l := recordLocks[key]
+	if l == nil {
+		l = &recordLock{}
+		recordLocks[key] = l
+	}
+	l.waiters++
+	recordLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		recordLocksMu.Lock()
+		if l.waiters--; l.waiters == 0 {
+			delete(recordLocks, key)
+		}
+		recordLocksMu.Unlock()
+	}
+}
+
+// IfMatchRequired reports whether PUT requests must carry If-Match. It is on
+// unless the app setting "require_if_match" is "false".
+func IfMatchRequired(dbConn *sql.DB) bool {
+	var val string
+	if err := dbConn.QueryRow("SELECT value FROM app_settings WHERE key = 'require_if_match'").Scan(&val); err != nil {
+		return true
+	}
+	return val != "false"
+}
+
+// OptimisticConcurrency sets an ETag on GET /api/v1/{resource}/{id} and, for
+// PUT, rejects requests whose If-Match does not match the current record
+// with 409 Conflict (or 428 Precondition Required when If-Match is missing).
+func OptimisticConcurrency(dbConn *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" && r.Method != "PUT" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			apiPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/")
+			parts := strings.Split(apiPath, "/")
+			if !strings.HasPrefix(r.URL.Path, "/api/v1/") || len(parts) != 2 || parts[1] == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, ok := VersionedResources[parts[0]]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			id := parts[1]
+
+			if r.Method == "GET" {
+				if etag, err := RecordETag(dbConn, res, id); err == nil && etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			unlock := lockRecord(res.Table + "/" + id)
+			defer unlock()
+
+			current, err := RecordETag(dbConn, res, id)
+			if err != nil || current == "" {
+				// Let the handler produce its own 404/500.
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ifMatch := r.Header.Get("If-Match")
+			if ifMatch == "" {
+				if IfMatchRequired(dbConn) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("ETag", current)
+					w.WriteHeader(http.StatusPreconditionRequired)
+					json.NewEncoder(w).Encode(map[string]string{
+						"error": "If-Match header required; fetch the record and retry with its ETag",
+						"code":  "PRECONDITION_REQUIRED",
+					})
+					return
+				}
+			} else if !etagMatches(ifMatch, current) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", current)
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "Record was modified by someone else; reload and reapply your changes",
+					"code":  "CONFLICT",
+					"etag":  current,
+				})
+				return
+			}
+
+			buf := &bufferedWriter{header: w.Header()}
+			next.ServeHTTP(buf, r)
+			if buf.status == 0 {
+				buf.status = http.StatusOK
+			}
+			if buf.status < 300 {
+				if etag, err := RecordETag(dbConn, res, id); err == nil && etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+			}
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupConcurrencyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`CREATE TABLE ecos (id TEXT PRIMARY KEY, title TEXT, status TEXT)`,
+		`CREATE TABLE app_settings (key TEXT PRIMARY KEY, value TEXT)`,
+		`INSERT INTO ecos VALUES ('ECO-2024-003', 'Swap regulator', 'draft')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ecoUpdater applies {"title": ...} to the ECO named in the path.
+func ecoUpdater(db *sql.DB, calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.Method == "PUT" {
+			var body struct{ Title string }
+			json.NewDecoder(r.Body).Decode(&body)
+			db.Exec("UPDATE ecos SET title = ? WHERE id = ?", body.Title, strings.TrimPrefix(r.URL.Path, "/api/v1/ecos/"))
+		}
+		w.Write([]byte(`{"data":{}}`))
+	})
+}
+
+func TestOptimisticConcurrency_ETagAndConflict(t *testing.T) {
+	db := setupConcurrencyDB(t)
+	var calls int32
+	h := OptimisticConcurrency(db)(ecoUpdater(db, &calls))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/ecos/ECO-2024-003", nil))
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("expected strong ETag on GET, got %q", etag)
+	}
+
+	// Alice saves with the ETag she loaded.
+	req := httptest.NewRequest("PUT", "/api/v1/ecos/ECO-2024-003", strings.NewReader(`{"title":"Alice"}`))
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	newTag := w.Header().Get("ETag")
+	if newTag == "" || newTag == etag {
+		t.Errorf("expected a new ETag after update, got %q", newTag)
+	}
+
+	// Bob saves with the stale ETag and must be rejected.
+	req = httptest.NewRequest("PUT", "/api/v1/ecos/ECO-2024-003", strings.NewReader(`{"title":"Bob"}`))
+	req.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+	if w.Header().Get("ETag") != newTag {
+		t.Errorf("conflict response should carry current ETag")
+	}
+
+	var title string
+	db.QueryRow("SELECT title FROM ecos WHERE id = 'ECO-2024-003'").Scan(&title)
+	if title != "Alice" {
+		t.Errorf("stale update was applied: title=%q", title)
+	}
+	if calls != 2 {
+		t.Errorf("expected handler to run twice (GET + accepted PUT), ran %d", calls)
+	}
+}
+
+func TestOptimisticConcurrency_IfMatchRequired(t *testing.T) {
+	db := setupConcurrencyDB(t)
+	var calls int32
+	h := OptimisticConcurrency(db)(ecoUpdater(db, &calls))
+
+	put := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/ecos/ECO-2024-003", strings.NewReader(`{"title":"x"}`)))
+		return w.Code
+	}
+	if code := put(); code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without If-Match, got %d", code)
+	}
+
+	db.Exec("INSERT INTO app_settings (key, value) VALUES ('require_if_match', 'false')")
+	if code := put(); code != 200 {
+		t.Errorf("expected 200 with If-Match optional, got %d", code)
+	}
+}
+
+func TestOptimisticConcurrency_PassThrough(t *testing.T) {
+	db := setupConcurrencyDB(t)
+	var calls int32
+	h := OptimisticConcurrency(db)(ecoUpdater(db, &calls))
+
+	for _, tc := range []struct{ method, path string }{
+		{"PUT", "/api/v1/ecos/ECO-404"},       // unknown record: handler decides
+		{"PUT", "/api/v1/ecos/ECO-1/approve"}, // sub-resource
+		{"PUT", "/api/v1/settings/general"},   // unversioned module
+		{"POST", "/api/v1/ecos"},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{}`)))
+		if w.Code != 200 {
+			t.Errorf("%s %s: expected pass-through, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	if !etagMatches(`"abc"`, `"abc"`) || !etagMatches(`"x", "abc"`, `"abc"`) || !etagMatches("*", `"abc"`) {
+		t.Error("expected match")
+	}
+	if etagMatches(`"abd"`, `"abc"`) {
+		t.Error("expected mismatch")
+	}
+	// If-Match uses strong comparison: weak validators never match.
+	if etagMatches(`W/"abc"`, `"abc"`) || etagMatches(`"x", W/"abc"`, `"abc"`) || etagMatches(`"abc"`, `W/"abc"`) {
+		t.Error("expected weak validator to be rejected")
+	}
+}
+
+func TestLockRecordReleasesEntries(t *testing.T) {
+	var inside, maxInside int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unlock := lockRecord("ecos/ECO-" + strconv.Itoa(i%2))
+			if n := atomic.AddInt32(&inside, 1); n > 2 {
+				atomic.StoreInt32(&maxInside, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inside, -1)
+			unlock()
+		}(i)
+	}
+	wg.Wait()
+	if maxInside != 0 {
+		t.Errorf("%d writers held two record locks at once", maxInside)
+	}
+	recordLocksMu.Lock()
+	defer recordLocksMu.Unlock()
+	if len(recordLocks) != 0 {
+		t.Errorf("%d record locks left after all writers finished", len(recordLocks))
+	}
+}
@@ -209,7 +209,7 @@ func RequireAuth(dbConn *sql.DB, bearerValidator func(string) bool) func(http.Ha
 func IsAdminOnly(apiPath string) bool {
 	seg := strings.SplitN(apiPath, "/", 2)[0]
 	switch seg {
-	case "users", "apikeys", "api-keys":
+	case "users", "apikeys", "api-keys", "webhooks":
 		return true
 	}
 	if strings.HasPrefix(apiPath, "email/") || strings.HasPrefix(apiPath, "settings/email") {
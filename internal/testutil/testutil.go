@@ -169,6 +169,7 @@ func createTables(t *testing.T, db *sql.DB) {
 			priority TEXT DEFAULT 'medium',
 			root_cause TEXT DEFAULT '',
 			corrective_action TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			resolved_at DATETIME
@@ -185,7 +186,8 @@ func createTables(t *testing.T, db *sql.DB) {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			approved_at DATETIME,
-			approved_by TEXT DEFAULT ''
+			approved_by TEXT DEFAULT '',
+			ncr_id TEXT DEFAULT ''
 		)`},
 		{"work_orders", `CREATE TABLE IF NOT EXISTS work_orders (
 			id TEXT PRIMARY KEY, assembly_ipn TEXT NOT NULL,
@@ -206,6 +208,18 @@ func createTables(t *testing.T, db *sql.DB) {
 			notes TEXT, UNIQUE(serial_number),
 			FOREIGN KEY (wo_id) REFERENCES work_orders(id) ON DELETE CASCADE
 		)`},
+		{"wo_substitutions", `CREATE TABLE IF NOT EXISTS wo_substitutions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			wo_id TEXT NOT NULL,
+			serial_number TEXT DEFAULT '',
+			ipn TEXT NOT NULL,
+			revision TEXT DEFAULT '',
+			alternate_ipn TEXT NOT NULL,
+			qty REAL NOT NULL CHECK(qty > 0),
+			reason TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
 		{"parts", `CREATE TABLE IF NOT EXISTS parts (
 			ipn TEXT PRIMARY KEY,
 			category TEXT DEFAULT '',
@@ -273,9 +287,13 @@ func createTables(t *testing.T, db *sql.DB) {
 			username TEXT DEFAULT '',
 			summary TEXT DEFAULT '',
 			changes TEXT DEFAULT '{}',
+			before_value TEXT,
+			after_value TEXT,
 			ip_address TEXT DEFAULT '',
 			user_agent TEXT DEFAULT '',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			prev_hash TEXT,
+			entry_hash TEXT
 		)`},
 		{"vendors", `CREATE TABLE IF NOT EXISTS vendors (
 			id TEXT PRIMARY KEY,
@@ -323,6 +341,258 @@ func createTables(t *testing.T, db *sql.DB) {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (shipment_id) REFERENCES shipments(id) ON DELETE CASCADE
 		)`},
+		{"devices", `CREATE TABLE IF NOT EXISTS devices (
+			serial_number TEXT PRIMARY KEY,
+			ipn TEXT NOT NULL,
+			firmware_version TEXT,
+			customer TEXT,
+			location TEXT,
+			status TEXT DEFAULT 'active' CHECK(status IN ('active','inactive','rma','decommissioned','maintenance')),
+			install_date DATE,
+			last_seen DATETIME,
+			notes TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"rmas", `CREATE TABLE IF NOT EXISTS rmas (
+			id TEXT PRIMARY KEY,
+			serial_number TEXT NOT NULL,
+			customer TEXT,
+			reason TEXT,
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','received','diagnosing','repairing','resolved','closed','scrapped')),
+			defect_description TEXT,
+			resolution TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			received_at DATETIME,
+			resolved_at DATETIME
+		)`},
+		{"field_reports", `CREATE TABLE IF NOT EXISTS field_reports (
+			id TEXT PRIMARY KEY, title TEXT NOT NULL,
+			report_type TEXT DEFAULT 'failure' CHECK(report_type IN ('failure','performance','safety','visit','other')),
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','investigating','resolved','closed')),
+			priority TEXT DEFAULT 'medium' CHECK(priority IN ('low','medium','high','critical')),
+			customer_name TEXT DEFAULT '', site_location TEXT DEFAULT '',
+			device_ipn TEXT DEFAULT '', device_serial TEXT DEFAULT '',
+			reported_by TEXT DEFAULT '', reported_at DATETIME,
+			description TEXT DEFAULT '', root_cause TEXT DEFAULT '',
+			resolution TEXT DEFAULT '', resolved_at DATETIME,
+			ncr_id TEXT DEFAULT '', eco_id TEXT DEFAULT '',
+			warranty TEXT DEFAULT '', contract_id TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"rma_lines", `CREATE TABLE IF NOT EXISTS rma_lines (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rma_id TEXT NOT NULL,
+			serial_number TEXT NOT NULL,
+			ipn TEXT DEFAULT '',
+			defect_description TEXT DEFAULT '',
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','repairing','repaired','replaced','credited','scrapped')),
+			disposition TEXT DEFAULT '' CHECK(disposition IN ('','repair','replace','credit')),
+			warranty TEXT DEFAULT 'unknown' CHECK(warranty IN ('in','out','unknown')),
+			warranty_expires TEXT DEFAULT '',
+			repair_wo_id TEXT DEFAULT '',
+			replacement_serial TEXT DEFAULT '',
+			advance_shipment_id TEXT DEFAULT '',
+			contract_id TEXT DEFAULT '',
+			credit_amount REAL DEFAULT 0,
+			notes TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(rma_id, serial_number),
+			FOREIGN KEY (rma_id) REFERENCES rmas(id) ON DELETE CASCADE
+		)`},
+		{"rma_parts", `CREATE TABLE IF NOT EXISTS rma_parts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rma_id TEXT NOT NULL,
+			line_id INTEGER DEFAULT 0,
+			wo_id TEXT NOT NULL,
+			ipn TEXT NOT NULL,
+			qty REAL NOT NULL CHECK(qty > 0),
+			notes TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (rma_id) REFERENCES rmas(id) ON DELETE CASCADE
+		)`},
+		{"warranty_policies", `CREATE TABLE IF NOT EXISTS warranty_policies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ipn TEXT NOT NULL UNIQUE,
+			term_months INTEGER NOT NULL CHECK(term_months >= 0),
+			coverage TEXT DEFAULT 'parts_labor',
+			terms TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"service_contracts", `CREATE TABLE IF NOT EXISTS service_contracts (
+			id TEXT PRIMARY KEY,
+			customer TEXT NOT NULL,
+			name TEXT DEFAULT '',
+			start_date TEXT NOT NULL,
+			end_date TEXT NOT NULL,
+			coverage TEXT DEFAULT 'parts_labor',
+			terms TEXT DEFAULT '',
+			status TEXT DEFAULT 'active' CHECK(status IN ('active','cancelled')),
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"service_contract_devices", `CREATE TABLE IF NOT EXISTS service_contract_devices (
+			contract_id TEXT NOT NULL,
+			serial_number TEXT NOT NULL,
+			PRIMARY KEY(contract_id, serial_number),
+			FOREIGN KEY (contract_id) REFERENCES service_contracts(id) ON DELETE CASCADE
+		)`},
+		{"e_signatures", `CREATE TABLE IF NOT EXISTS e_signatures (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			module TEXT NOT NULL, record_id TEXT NOT NULL,
+			meaning TEXT NOT NULL CHECK(meaning IN ('reviewed','approved','released')),
+			reason TEXT DEFAULT '',
+			user_id INTEGER NOT NULL, username TEXT NOT NULL, full_name TEXT DEFAULT '',
+			content_hash TEXT NOT NULL, signature_hash TEXT NOT NULL,
+			ip_address TEXT DEFAULT '', signed_at TEXT NOT NULL
+		)`},
+		{"e_signatures_no_update", `CREATE TRIGGER IF NOT EXISTS e_signatures_no_update BEFORE UPDATE ON e_signatures
+			BEGIN SELECT RAISE(ABORT, 'electronic signatures cannot be changed'); END`},
+		{"e_signatures_no_delete", `CREATE TRIGGER IF NOT EXISTS e_signatures_no_delete BEFORE DELETE ON e_signatures
+			BEGIN SELECT RAISE(ABORT, 'electronic signatures cannot be deleted'); END`},
+		{"audit_checkpoints", `CREATE TABLE IF NOT EXISTS audit_checkpoints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL DEFAULT 'periodic',
+			last_id INTEGER NOT NULL, last_hash TEXT NOT NULL,
+			entries INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL, signature TEXT NOT NULL
+		)`},
+		{"audit_archives", `CREATE TABLE IF NOT EXISTS audit_archives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file TEXT NOT NULL,
+			first_id INTEGER NOT NULL, last_id INTEGER NOT NULL,
+			entries INTEGER NOT NULL DEFAULT 0,
+			prev_hash TEXT NOT NULL DEFAULT '', last_hash TEXT NOT NULL DEFAULT '',
+			file_sha256 TEXT NOT NULL,
+			created_at TEXT NOT NULL, signature TEXT NOT NULL
+		)`},
+		{"audit_checkpoints_no_update", `CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_update BEFORE UPDATE ON audit_checkpoints
+			BEGIN SELECT RAISE(ABORT, 'audit_checkpoints are append-only'); END`},
+		{"audit_checkpoints_no_delete", `CREATE TRIGGER IF NOT EXISTS audit_checkpoints_no_delete BEFORE DELETE ON audit_checkpoints
+			BEGIN SELECT RAISE(ABORT, 'audit_checkpoints are append-only'); END`},
+		{"audit_archives_no_update", `CREATE TRIGGER IF NOT EXISTS audit_archives_no_update BEFORE UPDATE ON audit_archives
+			BEGIN SELECT RAISE(ABORT, 'audit_archives are append-only'); END`},
+		{"audit_archives_no_delete", `CREATE TRIGGER IF NOT EXISTS audit_archives_no_delete BEFORE DELETE ON audit_archives
+			BEGIN SELECT RAISE(ABORT, 'audit_archives are append-only'); END`},
+		{"eight_d", `CREATE TABLE IF NOT EXISTS eight_d (
+			id TEXT PRIMARY KEY, title TEXT NOT NULL,
+			ncr_id TEXT DEFAULT '', capa_id TEXT DEFAULT '',
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','closed')),
+			current_step INTEGER DEFAULT 1,
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			closed_at DATETIME
+		)`},
+		{"eight_d_disciplines", `CREATE TABLE IF NOT EXISTS eight_d_disciplines (
+			eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+			discipline INTEGER NOT NULL CHECK(discipline BETWEEN 1 AND 8),
+			content TEXT DEFAULT '',
+			completed_by TEXT DEFAULT '', completed_at DATETIME,
+			PRIMARY KEY (eight_d_id, discipline)
+		)`},
+		{"eight_d_team", `CREATE TABLE IF NOT EXISTS eight_d_team (
+			eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+			username TEXT NOT NULL,
+			role TEXT DEFAULT 'member' CHECK(role IN ('champion','leader','member')),
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (eight_d_id, username)
+		)`},
+		{"eight_d_causes", `CREATE TABLE IF NOT EXISTS eight_d_causes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK(kind IN ('why','fishbone')),
+			category TEXT DEFAULT '', text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"eight_d_actions", `CREATE TABLE IF NOT EXISTS eight_d_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			eight_d_id TEXT NOT NULL REFERENCES eight_d(id) ON DELETE CASCADE,
+			discipline INTEGER NOT NULL CHECK(discipline IN (3,5,7)),
+			description TEXT NOT NULL, owner TEXT NOT NULL, due_date TEXT NOT NULL,
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','done')),
+			completed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"mrb_quarantine", `CREATE TABLE IF NOT EXISTS mrb_quarantine (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ncr_id TEXT NOT NULL REFERENCES ncrs(id) ON DELETE CASCADE,
+			ipn TEXT NOT NULL, qty REAL NOT NULL CHECK(qty > 0),
+			source TEXT NOT NULL CHECK(source IN ('receiving','hold','stock')),
+			receiving_inspection_id INTEGER,
+			po_id TEXT DEFAULT '', vendor_id TEXT DEFAULT '',
+			unit_cost REAL DEFAULT 0 CHECK(unit_cost >= 0),
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"mrb_dispositions", `CREATE TABLE IF NOT EXISTS mrb_dispositions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ncr_id TEXT NOT NULL REFERENCES ncrs(id) ON DELETE CASCADE,
+			ipn TEXT NOT NULL, qty REAL NOT NULL CHECK(qty > 0),
+			disposition TEXT NOT NULL CHECK(disposition IN ('use_as_is','rework','return_to_vendor','scrap')),
+			unit_cost REAL DEFAULT 0 CHECK(unit_cost >= 0), total_cost REAL DEFAULT 0,
+			work_order_id TEXT DEFAULT '', shipment_id TEXT DEFAULT '', vendor_id TEXT DEFAULT '',
+			notes TEXT DEFAULT '', decided_by TEXT DEFAULT '',
+			decided_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"test_records", `CREATE TABLE IF NOT EXISTS test_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, serial_number TEXT NOT NULL,
+			ipn TEXT NOT NULL, firmware_version TEXT,
+			test_type TEXT CHECK(test_type IN ('factory','incoming','final','field','calibration')),
+			result TEXT NOT NULL CHECK(result IN ('pass','fail','conditional')),
+			measurements TEXT, notes TEXT,
+			tested_by TEXT DEFAULT 'operator',
+			tested_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"spc_violations", `CREATE TABLE IF NOT EXISTS spc_violations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chart TEXT NOT NULL CHECK(chart IN ('xbar','range','p')),
+			source TEXT NOT NULL CHECK(source IN ('tests','receiving')),
+			ipn TEXT NOT NULL, measurement TEXT DEFAULT '', test_type TEXT DEFAULT '',
+			rule INTEGER NOT NULL CHECK(rule BETWEEN 1 AND 4), description TEXT DEFAULT '',
+			value REAL, center REAL, ucl REAL, lcl REAL,
+			test_record_id INTEGER, ncr_id TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"field_report_emails", `CREATE TABLE IF NOT EXISTS field_report_emails (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			report_id TEXT NOT NULL,
+			direction TEXT DEFAULT 'inbound' CHECK(direction IN ('inbound','outbound')),
+			message_id TEXT DEFAULT '', in_reply_to TEXT DEFAULT '',
+			from_address TEXT NOT NULL, from_name TEXT DEFAULT '', to_address TEXT DEFAULT '',
+			subject TEXT DEFAULT '', body TEXT DEFAULT '',
+			attachment_count INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"training_requirements", `CREATE TABLE IF NOT EXISTS training_requirements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_id TEXT NOT NULL, ipn TEXT NOT NULL,
+			activity TEXT NOT NULL CHECK(activity IN ('test','build')),
+			revision TEXT NOT NULL, valid_months INTEGER DEFAULT 0,
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(document_id, ipn, activity)
+		)`},
+		{"training_records", `CREATE TABLE IF NOT EXISTS training_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL, document_id TEXT NOT NULL, revision TEXT NOT NULL,
+			completed_at DATE NOT NULL, expires_at DATE,
+			trainer TEXT DEFAULT '', notes TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`},
+		{"training_tasks", `CREATE TABLE IF NOT EXISTS training_tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL, document_id TEXT NOT NULL, revision TEXT NOT NULL,
+			reason TEXT DEFAULT 'assigned' CHECK(reason IN ('assigned','revision')),
+			status TEXT DEFAULT 'open' CHECK(status IN ('open','completed','cancelled')),
+			due_date DATE, record_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		)`},
 		{"part_changes", `CREATE TABLE IF NOT EXISTS part_changes (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			part_ipn TEXT NOT NULL,
@@ -334,6 +604,30 @@ func createTables(t *testing.T, db *sql.DB) {
 			created_by TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`},
+		{"part_revisions", `CREATE TABLE IF NOT EXISTS part_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ipn TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			status TEXT DEFAULT 'draft',
+			eco_id TEXT DEFAULT '',
+			effective_date TEXT DEFAULT '',
+			notes TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			released_at DATETIME,
+			UNIQUE(ipn, revision)
+		)`},
+		{"part_alternates", `CREATE TABLE IF NOT EXISTS part_alternates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ipn TEXT NOT NULL,
+			alternate_ipn TEXT NOT NULL,
+			assembly_ipn TEXT DEFAULT '',
+			priority INTEGER DEFAULT 0,
+			notes TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(ipn, alternate_ipn, assembly_ipn)
+		)`},
 		{"product_pricing", `CREATE TABLE IF NOT EXISTS product_pricing (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			product_ipn TEXT NOT NULL,
@@ -383,6 +677,7 @@ func createTables(t *testing.T, db *sql.DB) {
 			price_breaks TEXT DEFAULT '[]',
 			product_url TEXT DEFAULT '',
 			datasheet_url TEXT DEFAULT '',
+			lifecycle_status TEXT DEFAULT '',
 			fetched_at TEXT NOT NULL,
 			UNIQUE(part_ipn, distributor)
 		)`},
@@ -0,0 +1,3 @@
+// Package training tracks who is trained on which document revision and
+// gates the work those documents cover.
+package training
@@ -0,0 +1,162 @@
+package training
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"zrp/internal/models"
+)
+
+// Activities gated by training.
+const (
+	ActivityTest  = "test"
+	ActivityBuild = "build"
+)
+
+// Activities lists the valid requirement activities.
+var Activities = []string{ActivityTest, ActivityBuild}
+
+// RetrainDays is how long users get to retrain on a new revision. Until
+// their retraining task is due, training on the previous revision still
+// qualifies them.
+const RetrainDays = 30
+
+// NotQualifiedError is returned by Require when a user lacks training.
+type NotQualifiedError struct {
+	Username, IPN, Activity string
+	Gaps                    []models.TrainingGap
+}
+
+func (e *NotQualifiedError) Error() string {
+	var needs []string
+	for _, g := range e.Gaps {
+		needs = append(needs, fmt.Sprintf("%s rev %s (%s)", g.DocumentID, g.Revision, g.Reason))
+	}
+	return fmt.Sprintf("%s is not qualified to %s %s: needs training on %s", e.Username, e.Activity, e.IPN, strings.Join(needs, ", "))
+}
+
+// Check returns the requirements for activity on ipn that username does not
+// meet today. IPNs without requirements are not gated. A current record on
+// an older revision still meets a requirement while the user has an open
+// task for the required revision that is not yet due.
+func Check(db *sql.DB, username, ipn, activity string) ([]models.TrainingGap, error) {
+	rows, err := db.Query("SELECT document_id, revision FROM training_requirements WHERE ipn=? AND activity=? ORDER BY document_id", ipn, activity)
+	if err != nil {
+		return nil, err
+	}
+	type req struct{ doc, rev string }
+	var reqs []req
+	for rows.Next() {
+		var q req
+		rows.Scan(&q.doc, &q.rev)
+		reqs = append(reqs, q)
+	}
+	rows.Close()
+
+	today := time.Now().Format("2006-01-02")
+	gaps := []models.TrainingGap{}
+	for _, q := range reqs {
+		gap := models.TrainingGap{DocumentID: q.doc, Revision: q.rev, Reason: "untrained"}
+		recs, err := db.Query(`SELECT revision, COALESCE(CAST(expires_at AS TEXT),'') FROM training_records
+			WHERE username=? AND document_id=? ORDER BY completed_at DESC, id DESC`, username, q.doc)
+		if err != nil {
+			return nil, err
+		}
+		met, older := false, false
+		for recs.Next() && !met {
+			var rev, expires string
+			recs.Scan(&rev, &expires)
+			expired := expires != "" && expires[:min(10, len(expires))] < today
+			switch {
+			case rev != q.rev:
+				older = older || !expired
+				if gap.Reason == "untrained" {
+					gap.Reason, gap.TrainedRevision = "revision", rev
+				}
+			case expired:
+				if gap.Reason != "expired" {
+					gap.Reason, gap.TrainedRevision, gap.ExpiredAt = "expired", "", expires[:min(10, len(expires))]
+				}
+			default:
+				met = true
+			}
+		}
+		recs.Close()
+		if !met && older {
+			var pending int
+			db.QueryRow(`SELECT COUNT(*) FROM training_tasks WHERE username=? AND document_id=? AND revision=?
+				AND status='open' AND CAST(due_date AS TEXT) >= ?`, username, q.doc, q.rev, today).Scan(&pending)
+			met = pending > 0
+		}
+		if !met {
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps, nil
+}
+
+// Require returns a *NotQualifiedError when username may not perform
+// activity on ipn.
+func Require(db *sql.DB, username, ipn, activity string) error {
+	gaps, err := Check(db, username, ipn, activity)
+	if err != nil {
+		return err
+	}
+	if len(gaps) > 0 {
+		return &NotQualifiedError{Username: username, IPN: ipn, Activity: activity, Gaps: gaps}
+	}
+	return nil
+}
+
+// DocumentReleased moves the document's training requirements to revision.
+// When that is a new revision, everyone trained on an earlier one gets a
+// retraining task and a notification, and open tasks for earlier revisions
+// are cancelled. It returns the users given a task.
+func DocumentReleased(db *sql.DB, docID, revision string) ([]string, error) {
+	res, err := db.Exec("UPDATE training_requirements SET revision=? WHERE document_id=? AND revision!=?", revision, docID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	if _, err := db.Exec("UPDATE training_tasks SET status='cancelled' WHERE document_id=? AND revision!=? AND status='open'", docID, revision); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT DISTINCT username FROM training_records WHERE document_id=?
+		AND username NOT IN (SELECT username FROM training_records WHERE document_id=? AND revision=?)
+		ORDER BY username`, docID, docID, revision)
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for rows.Next() {
+		var u string
+		rows.Scan(&u)
+		users = append(users, u)
+	}
+	rows.Close()
+
+	due := time.Now().AddDate(0, 0, RetrainDays).Format("2006-01-02")
+	var tasked []string
+	for _, u := range users {
+		var open int
+		db.QueryRow("SELECT COUNT(*) FROM training_tasks WHERE username=? AND document_id=? AND revision=? AND status='open'", u, docID, revision).Scan(&open)
+		if open > 0 {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO training_tasks (username, document_id, revision, reason, due_date) VALUES (?, ?, ?, 'revision', ?)`,
+			u, docID, revision, due); err != nil {
+			return tasked, err
+		}
+		db.Exec(`INSERT INTO notifications (type, severity, title, message, record_id, module, user_id)
+			VALUES ('training_due', 'info', ?, ?, ?, 'training', ?)`,
+			fmt.Sprintf("Retraining required: %s rev %s", docID, revision),
+			fmt.Sprintf("%s was released at revision %s. Complete retraining by %s.", docID, revision, due), docID, u)
+		tasked = append(tasked, u)
+	}
+	return tasked, nil
+}
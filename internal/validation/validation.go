@@ -249,7 +249,7 @@ var AllowedExtensions = []string{
 	".zip", ".tar", ".gz", ".bz2", ".7z", ".rar",
 	".json", ".xml", ".yaml", ".yml", ".toml",
 	".dxf", ".dwg", ".step", ".stp", ".iges", ".igs", ".stl",
-	".log", ".md", ".markdown",
+	".log", ".md", ".markdown", ".eml",
 }
 
 // ValidateFileUpload validates uploaded file size, type, and name.
@@ -0,0 +1,3 @@
+// Package webhooks delivers record lifecycle events to external HTTP endpoints
+// with HMAC-signed payloads, a persistent retry queue, and dead-lettering.
+package webhooks
@@ -0,0 +1,376 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"zrp/internal/websocket"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-ZRP-Event"
+	HeaderDelivery  = "X-ZRP-Delivery"
+	HeaderTimestamp = "X-ZRP-Timestamp"
+	HeaderSignature = "X-ZRP-Signature"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// EventTypes lists the event names offered when configuring a webhook.
+// Filters may also use "<resource>.*" or "*".
+var EventTypes = []string{
+	"eco.created", "eco.updated", "eco.approved", "eco.implemented",
+	"workorder.created", "workorder.updated", "workorder.completed", "workorder.kitted",
+	"ncr.created", "ncr.updated",
+	"capa.created", "capa.updated",
+	"rma.created", "rma.updated",
+	"inventory.received", "inventory.issued", "inventory.adjusted", "inventory.below_reorder",
+	"po.created", "po.updated",
+	"shipment.created", "shipment.shipped", "shipment.delivered",
+	"device.created", "device.updated",
+	"field_report.created", "field_report.updated",
+	"quote.created", "quote.updated",
+}
+
+// Webhook is an outbound webhook subscription.
+type Webhook struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	Enabled   int      `json:"enabled"`
+	CreatedBy string   `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// Delivery is a single queued or attempted webhook delivery.
+type Delivery struct {
+	ID            int     `json:"id"`
+	WebhookID     int     `json:"webhook_id"`
+	Event         string  `json:"event"`
+	Payload       string  `json:"payload"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	NextAttemptAt *string `json:"next_attempt_at"`
+	ResponseCode  int     `json:"response_code"`
+	ResponseBody  string  `json:"response_body"`
+	LastError     string  `json:"last_error"`
+	RedeliveryOf  *int    `json:"redelivery_of"`
+	CreatedAt     string  `json:"created_at"`
+	DeliveredAt   *string `json:"delivered_at"`
+}
+
+// Payload is the JSON body posted to webhook endpoints.
+type Payload struct {
+	Event     string                           `json:"event"`
+	Resource  string                           `json:"resource"`
+	RecordID  any                              `json:"record_id"`
+	Action    string                           `json:"action"`
+	User      string                           `json:"user,omitempty"`
+	Changes   map[string]websocket.FieldChange `json:"changes,omitempty"`
+	Data      any                              `json:"data,omitempty"`
+	Timestamp string                           `json:"timestamp"`
+}
+
+// pastTense maps the verbs used by audit entries and hub broadcasts to the
+// past-tense form used in webhook event names.
+var pastTense = map[string]string{
+	"create":    "created",
+	"update":    "updated",
+	"delete":    "deleted",
+	"approve":   "approved",
+	"reject":    "rejected",
+	"implement": "implemented",
+	"complete":  "completed",
+	"receive":   "received",
+	"issue":     "issued",
+	"adjust":    "adjusted",
+	"return":    "returned",
+	"export":    "exported",
+}
+
+// EventName returns the webhook event name for a hub event, such as
+// "eco.approved". It returns "" for events that are not tied to a resource.
+func EventName(evt websocket.Event) string {
+	if evt.Resource == "" || evt.Action == "" {
+		return ""
+	}
+	action := strings.ToLower(evt.Action)
+	if past, ok := pastTense[action]; ok {
+		action = past
+	}
+	return strings.ToLower(evt.Resource) + "." + action
+}
+
+// Matches reports whether event is selected by any of the filters. A filter
+// is an exact event name, "<resource>.*", or "*".
+func Matches(filters []string, event string) bool {
+	for _, f := range filters {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "*" || f == event:
+			return true
+		case strings.HasSuffix(f, ".*") && strings.HasPrefix(event, strings.TrimSuffix(f, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEvents decodes the stored JSON event filter list.
+func ParseEvents(s string) []string {
+	var events []string
+	if err := json.Unmarshal([]byte(s), &events); err != nil || len(events) == 0 {
+		return []string{"*"}
+	}
+	return events
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+// Receivers recompute it and compare against the X-ZRP-Signature header,
+// which is sent as "sha256=<hex>".
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher queues events for matching webhooks and delivers them with
+// exponential backoff. Deliveries that still fail after MaxAttempts are
+// dead-lettered and only retried through Redeliver.
+type Dispatcher struct {
+	DB          *sql.DB
+	Client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	mu sync.Mutex
+}
+
+// NewDispatcher creates a Dispatcher with default retry settings.
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+	}
+}
+
+// Backoff returns the delay before the next attempt after the given number
+// of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := d.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if d.MaxDelay > 0 && delay >= d.MaxDelay {
+			return d.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Enqueue records a pending delivery for every enabled webhook whose filter
+// matches the event. It returns the number of deliveries queued.
+func (d *Dispatcher) Enqueue(evt websocket.Event) (int, error) {
+	name := EventName(evt)
+	if name == "" {
+		return 0, nil
+	}
+
+	rows, err := d.DB.Query("SELECT id, events FROM webhooks WHERE enabled = 1")
+	if err != nil {
+		return 0, err
+	}
+	var targets []int
+	for rows.Next() {
+		var id int
+		var events string
+		if err := rows.Scan(&id, &events); err != nil {
+			continue
+		}
+		if Matches(ParseEvents(events), name) {
+			targets = append(targets, id)
+		}
+	}
+	rows.Close()
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(Payload{
+		Event:     name,
+		Resource:  evt.Resource,
+		RecordID:  evt.ID,
+		Action:    evt.Action,
+		User:      evt.User,
+		Changes:   evt.Changes,
+		Data:      evt.Data,
+		Timestamp: now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, id := range targets {
+		_, err := d.DB.Exec(`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?)`, id, name, string(body), StatusPending, now.Format(timeFormat))
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+type dueDelivery struct {
+	id       int
+	event    string
+	payload  string
+	attempts int
+	url      string
+	secret   string
+}
+
+// ProcessDue attempts every pending delivery whose next attempt time has
+// passed. It returns the number of deliveries attempted.
+func (d *Dispatcher) ProcessDue() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().UTC()
+	rows, err := d.DB.Query(`SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND w.enabled = 1 AND (d.next_attempt_at IS NULL OR d.next_attempt_at <= ?)
+		ORDER BY d.id LIMIT 100`, StatusPending, now.Format(timeFormat))
+	if err != nil {
+		return 0, err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var dd dueDelivery
+		if err := rows.Scan(&dd.id, &dd.event, &dd.payload, &dd.attempts, &dd.url, &dd.secret); err != nil {
+			continue
+		}
+		due = append(due, dd)
+	}
+	rows.Close()
+
+	for _, dd := range due {
+		d.attempt(dd)
+	}
+	return len(due), nil
+}
+
+// attempt posts one delivery and records the outcome.
+func (d *Dispatcher) attempt(dd dueDelivery) {
+	ts := fmt.Sprintf("%d", time.Now().Unix())
+	body := []byte(dd.payload)
+
+	code, respBody, sendErr := d.post(dd, ts, body)
+	attempts := dd.attempts + 1
+	now := time.Now().UTC()
+
+	if sendErr == nil && code >= 200 && code < 300 {
+		d.DB.Exec(`UPDATE webhook_deliveries SET status=?, attempts=?, response_code=?, response_body=?,
+			last_error='', next_attempt_at=NULL, delivered_at=? WHERE id=?`,
+			StatusDelivered, attempts, code, respBody, now.Format(timeFormat), dd.id)
+		return
+	}
+
+	errMsg := ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	} else {
+		errMsg = fmt.Sprintf("endpoint returned HTTP %d", code)
+	}
+
+	if attempts >= d.MaxAttempts {
+		d.DB.Exec(`UPDATE webhook_deliveries SET status=?, attempts=?, response_code=?, response_body=?,
+			last_error=?, next_attempt_at=NULL WHERE id=?`,
+			StatusDead, attempts, code, respBody, errMsg, dd.id)
+		log.Printf("webhooks: delivery %d (%s) dead-lettered after %d attempts: %s", dd.id, dd.event, attempts, errMsg)
+		return
+	}
+
+	next := now.Add(d.Backoff(attempts))
+	d.DB.Exec(`UPDATE webhook_deliveries SET attempts=?, response_code=?, response_body=?,
+		last_error=?, next_attempt_at=? WHERE id=?`,
+		attempts, code, respBody, errMsg, next.Format(timeFormat), dd.id)
+}
+
+func (d *Dispatcher) post(dd dueDelivery, ts string, body []byte) (int, string, error) {
+	req, err := http.NewRequest("POST", dd.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ZRP-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, dd.event)
+	req.Header.Set(HeaderDelivery, fmt.Sprintf("%d", dd.id))
+	req.Header.Set(HeaderTimestamp, ts)
+	if dd.secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(dd.secret, ts, body))
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, string(snippet), nil
+}
+
+// Redeliver queues a fresh copy of an existing delivery, regardless of its
+// status, and returns the new delivery ID.
+func Redeliver(db *sql.DB, deliveryID int) (int64, error) {
+	var webhookID int
+	var event, payload string
+	err := db.QueryRow("SELECT webhook_id, event, payload FROM webhook_deliveries WHERE id = ?", deliveryID).
+		Scan(&webhookID, &event, &payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec(`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, redelivery_of)
+		VALUES (?, ?, ?, ?, ?, ?)`, webhookID, event, payload, StatusPending,
+		time.Now().UTC().Format(timeFormat), deliveryID)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,199 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zrp/internal/database"
+	"zrp/internal/websocket"
+
+	_ "modernc.org/sqlite"
+)
+
+func setupDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := database.RunMigrations(db, nil); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func addWebhook(t *testing.T, db *sql.DB, url, secret, events string) int {
+	t.Helper()
+	res, err := db.Exec("INSERT INTO webhooks (name, url, secret, events) VALUES ('test', ?, ?, ?)", url, secret, events)
+	if err != nil {
+		t.Fatalf("insert webhook: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestEventName(t *testing.T) {
+	tests := []struct {
+		evt  websocket.Event
+		want string
+	}{
+		{websocket.Event{Resource: "eco", Action: "approved"}, "eco.approved"},
+		{websocket.Event{Resource: "eco", Action: "UPDATE"}, "eco.updated"},
+		{websocket.Event{Resource: "workorder", Action: "complete"}, "workorder.completed"},
+		{websocket.Event{Resource: "inventory", Action: "below_reorder"}, "inventory.below_reorder"},
+		{websocket.Event{Type: "subscribed", Action: "subscribe"}, ""},
+	}
+	for _, tt := range tests {
+		if got := EventName(tt.evt); got != tt.want {
+			t.Errorf("EventName(%+v) = %q, want %q", tt.evt, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	if !Matches([]string{"*"}, "ncr.created") {
+		t.Error("* should match everything")
+	}
+	if !Matches([]string{"eco.*"}, "eco.approved") {
+		t.Error("eco.* should match eco.approved")
+	}
+	if Matches([]string{"eco.*"}, "ecommerce.created") {
+		t.Error("eco.* should not match ecommerce.created")
+	}
+	if Matches([]string{"eco.approved"}, "eco.created") {
+		t.Error("exact filter should not match a different action")
+	}
+}
+
+func TestEnqueueAndDeliver_SignedPayload(t *testing.T) {
+	db := setupDB(t)
+
+	var gotSig, gotTS, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get(HeaderSignature)
+		gotTS = r.Header.Get(HeaderTimestamp)
+		gotEvent = r.Header.Get(HeaderEvent)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(204)
+	}))
+	defer srv.Close()
+
+	addWebhook(t, db, srv.URL, "s3cret", `["eco.approved"]`)
+	addWebhook(t, db, srv.URL, "other", `["ncr.*"]`)
+
+	d := NewDispatcher(db)
+	n, err := d.Enqueue(websocket.Event{Resource: "eco", ID: "ECO-2024-001", Action: "approved", User: "alice"})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 queued delivery, got %d (err=%v)", n, err)
+	}
+
+	if n, err := d.ProcessDue(); err != nil || n != 1 {
+		t.Fatalf("expected 1 attempt, got %d (err=%v)", n, err)
+	}
+
+	if gotEvent != "eco.approved" {
+		t.Errorf("event header = %q", gotEvent)
+	}
+	if want := "sha256=" + Sign("s3cret", gotTS, gotBody); gotSig != want {
+		t.Errorf("signature = %q, want %q", gotSig, want)
+	}
+	var p Payload
+	if err := json.Unmarshal(gotBody, &p); err != nil {
+		t.Fatalf("payload not JSON: %v", err)
+	}
+	if p.RecordID != "ECO-2024-001" || p.User != "alice" {
+		t.Errorf("unexpected payload %+v", p)
+	}
+
+	var status string
+	var attempts int
+	db.QueryRow("SELECT status, attempts FROM webhook_deliveries").Scan(&status, &attempts)
+	if status != StatusDelivered || attempts != 1 {
+		t.Errorf("status=%s attempts=%d, want delivered/1", status, attempts)
+	}
+}
+
+func TestDeliver_RetryThenDeadLetter(t *testing.T) {
+	db := setupDB(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(500)
+	}))
+	defer srv.Close()
+
+	addWebhook(t, db, srv.URL, "", `["*"]`)
+	d := NewDispatcher(db)
+	d.MaxAttempts = 3
+	d.Enqueue(websocket.Event{Resource: "ncr", ID: "NCR-1", Action: "created"})
+
+	d.ProcessDue()
+	var status, next string
+	var attempts int
+	db.QueryRow("SELECT status, attempts, next_attempt_at FROM webhook_deliveries").Scan(&status, &attempts, &next)
+	if status != StatusPending || attempts != 1 {
+		t.Fatalf("after first failure: status=%s attempts=%d", status, attempts)
+	}
+	nextAt, _ := time.Parse(time.RFC3339, next)
+	if nextAt.Before(time.Now().UTC().Add(20 * time.Second)) {
+		t.Errorf("expected backoff of ~30s, next attempt at %s", next)
+	}
+
+	// Not due yet: nothing should be attempted.
+	if n, _ := d.ProcessDue(); n != 0 {
+		t.Errorf("expected no due deliveries, got %d", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		db.Exec("UPDATE webhook_deliveries SET next_attempt_at = '2000-01-01 00:00:00'")
+		d.ProcessDue()
+	}
+	db.QueryRow("SELECT status, attempts FROM webhook_deliveries").Scan(&status, &attempts)
+	if status != StatusDead || attempts != 3 {
+		t.Errorf("expected dead after 3 attempts, got status=%s attempts=%d", status, attempts)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expected 3 HTTP calls, got %d", calls)
+	}
+
+	newID, err := Redeliver(db, 1)
+	if err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	var redeliveryOf int
+	db.QueryRow("SELECT status, redelivery_of FROM webhook_deliveries WHERE id = ?", newID).Scan(&status, &redeliveryOf)
+	if status != StatusPending || redeliveryOf != 1 {
+		t.Errorf("redelivery status=%s of=%d", status, redeliveryOf)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := d.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestEnqueue_DisabledWebhookSkipped(t *testing.T) {
+	db := setupDB(t)
+	id := addWebhook(t, db, "http://example.invalid/hook", "", `["*"]`)
+	db.Exec("UPDATE webhooks SET enabled = 0 WHERE id = ?", id)
+
+	n, err := NewDispatcher(db).Enqueue(websocket.Event{Resource: "eco", ID: "ECO-1", Action: "created"})
+	if err != nil || n != 0 {
+		t.Errorf("expected disabled webhook to be skipped, got %d (err=%v)", n, err)
+	}
+}
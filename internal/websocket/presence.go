@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+)
+
+// Presence actions reported by clients.
+const (
+	PresenceViewing = "viewing"
+	PresenceEditing = "editing"
+	PresenceLeft    = "left"
+)
+
+// PresenceInfo describes one user looking at a record.
+type PresenceInfo struct {
+	UserID       int       `json:"user_id"`
+	Username     string    `json:"username"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	Action       string    `json:"action"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+func presenceKey(resourceType, resourceID string) string {
+	return resourceType + "/" + resourceID
+}
+
+// setPresence records that c is viewing or editing a record (or has left
+// it) and tells other interested clients.
+func (h *Hub) setPresence(c *client, resourceType, resourceID, action string) {
+	if resourceType == "" || resourceID == "" {
+		return
+	}
+	switch action {
+	case PresenceViewing, PresenceEditing, PresenceLeft:
+	case "":
+		action = PresenceViewing
+	default:
+		return
+	}
+	info := PresenceInfo{
+		UserID:       c.info.UserID,
+		Username:     c.info.Username,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Action:       action,
+		Timestamp:    time.Now().UTC(),
+	}
+	key := presenceKey(resourceType, resourceID)
+
+	c.subMu.Lock()
+	if action == PresenceLeft {
+		if _, ok := c.presence[key]; !ok {
+			c.subMu.Unlock()
+			return
+		}
+		delete(c.presence, key)
+	} else {
+		if c.presence == nil {
+			c.presence = make(map[string]PresenceInfo)
+		}
+		c.presence[key] = info
+	}
+	c.subMu.Unlock()
+
+	h.broadcastPresence(c, info)
+}
+
+// clearPresence drops every presence entry held by a disconnecting client.
+func (h *Hub) clearPresence(c *client) {
+	c.subMu.Lock()
+	entries := make([]PresenceInfo, 0, len(c.presence))
+	for _, info := range c.presence {
+		entries = append(entries, info)
+	}
+	c.presence = nil
+	c.subMu.Unlock()
+
+	for _, info := range entries {
+		info.Action = PresenceLeft
+		info.Timestamp = time.Now().UTC()
+		h.broadcastPresence(c, info)
+	}
+}
+
+// broadcastPresence sends a presence_update to every other client allowed
+// to see the record. Presence events are transient: they are not numbered,
+// kept for resume or passed to listeners.
+func (h *Hub) broadcastPresence(from *client, info PresenceInfo) {
+	evt := Event{
+		Type:     "presence_update",
+		ID:       info.ResourceID,
+		Action:   info.Action,
+		Resource: info.ResourceType,
+		UserID:   info.UserID,
+		User:     info.Username,
+		Data:     info,
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("ws: marshal error: %v", err)
+		return
+	}
+	h.mu.RLock()
+	clients := make([]*client, 0, len(h.clients))
+	for c := range h.clients {
+		if c != from {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		if !h.allowed(c, evt) || !c.subscribed(evt) {
+			continue
+		}
+		if err := c.write(data); err != nil {
+			h.unregister(c)
+		}
+	}
+}
+
+// Presence returns the users currently viewing or editing a record, one
+// entry per user. A user with several connections is reported as editing
+// if any of them is editing.
+func (h *Hub) Presence(resourceType, resourceID string) []PresenceInfo {
+	key := presenceKey(resourceType, resourceID)
+	byUser := make(map[int]PresenceInfo)
+
+	h.mu.RLock()
+	for c := range h.clients {
+		c.subMu.RLock()
+		info, ok := c.presence[key]
+		c.subMu.RUnlock()
+		if !ok {
+			continue
+		}
+		prev, seen := byUser[info.UserID]
+		if !seen || (prev.Action != PresenceEditing && info.Action == PresenceEditing) {
+			byUser[info.UserID] = info
+		}
+	}
+	h.mu.RUnlock()
+
+	out := make([]PresenceInfo, 0, len(byUser))
+	for _, info := range byUser {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
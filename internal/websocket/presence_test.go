@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func waitClients(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for hub.ClientCount() < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPresence_ViewingEditingAndLeft(t *testing.T) {
+	hub := NewHub()
+	alice := dialHub(t, hub, ClientInfo{UserID: 1, Username: "alice"}, "")
+	bob := dialHub(t, hub, ClientInfo{UserID: 2, Username: "bob"}, "")
+	waitClients(t, hub, 2)
+
+	alice.WriteJSON(map[string]string{
+		"type": "presence", "resource_type": "eco", "resource_id": "ECO-2024-003", "action": "editing",
+	})
+	evt, ok := readEvent(t, bob)
+	if !ok || evt.Type != "presence_update" || evt.Action != "editing" || evt.User != "alice" || evt.UserID != 1 {
+		t.Fatalf("expected alice editing presence, got %+v (ok=%v)", evt, ok)
+	}
+	if evt.Seq != 0 {
+		t.Errorf("presence events should not be sequenced, got seq %d", evt.Seq)
+	}
+	if _, ok := readEvent(t, alice); ok {
+		t.Error("sender should not receive its own presence update")
+	}
+
+	got := hub.Presence("eco", "ECO-2024-003")
+	if len(got) != 1 || got[0].Username != "alice" || got[0].Action != PresenceEditing {
+		t.Fatalf("unexpected presence %+v", got)
+	}
+
+	alice.WriteJSON(ClientMessage{Op: "presence", ResourceType: "eco", ResourceID: "ECO-2024-003", Action: "left"})
+	if evt, ok := readEvent(t, bob); !ok || evt.Action != PresenceLeft {
+		t.Fatalf("expected left presence, got %+v", evt)
+	}
+	if got := hub.Presence("eco", "ECO-2024-003"); len(got) != 0 {
+		t.Errorf("expected no presence after leaving, got %+v", got)
+	}
+}
+
+func TestPresence_ClearedOnDisconnect(t *testing.T) {
+	hub := NewHub()
+	alice := dialHub(t, hub, ClientInfo{UserID: 1, Username: "alice"}, "")
+	bob := dialHub(t, hub, ClientInfo{UserID: 2, Username: "bob"}, "")
+	waitClients(t, hub, 2)
+
+	alice.WriteJSON(ClientMessage{Op: "presence", ResourceType: "workorder", ResourceID: "WO-1", Action: "viewing"})
+	if _, ok := readEvent(t, bob); !ok {
+		t.Fatal("expected viewing presence")
+	}
+
+	alice.Close()
+	evt, ok := readEvent(t, bob)
+	if !ok || evt.Action != PresenceLeft || evt.User != "alice" {
+		t.Fatalf("expected left presence on disconnect, got %+v (ok=%v)", evt, ok)
+	}
+	if got := hub.Presence("workorder", "WO-1"); len(got) != 0 {
+		t.Errorf("expected presence cleared, got %+v", got)
+	}
+}
+
+func TestPresence_PermissionFilter(t *testing.T) {
+	hub := NewHub()
+	hub.Authorize = func(role, resource string) bool { return role != "readonly" }
+	alice := dialHub(t, hub, ClientInfo{UserID: 1, Username: "alice", Role: "admin"}, "")
+	viewer := dialHub(t, hub, ClientInfo{UserID: 2, Username: "vic", Role: "readonly"}, "")
+	waitClients(t, hub, 2)
+
+	alice.WriteJSON(ClientMessage{Op: "presence", ResourceType: "ncr", ResourceID: "NCR-1", Action: "editing"})
+	if _, ok := readEvent(t, viewer); ok {
+		t.Error("readonly client should not see presence on a forbidden resource")
+	}
+}
@@ -5,34 +5,163 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	ws "github.com/gorilla/websocket"
 )
 
-// Event is the payload broadcast to all connected WebSocket clients.
+// DefaultHistorySize is the number of recent events kept for client resume.
+const DefaultHistorySize = 500
+
+// Event is the payload broadcast to connected WebSocket clients.
 type Event struct {
-	Type   string `json:"type"`
-	ID     any    `json:"id"`
-	Action string `json:"action"`
+	Type     string                 `json:"type"`
+	ID       any                    `json:"id"`
+	Action   string                 `json:"action"`
+	Resource string                 `json:"resource,omitempty"`
+	UserID   int                    `json:"user_id,omitempty"`
+	User     string                 `json:"user,omitempty"`
+	Changes  map[string]FieldChange `json:"changes,omitempty"`
+	Data     any                    `json:"data,omitempty"`
+	// Seq is the hub sequence number; clients pass the last seen value as a
+	// resume token when reconnecting.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// FieldChange describes a single changed field in an update event.
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// ClientMessage is a control message sent by a client over the socket.
+//
+//	{"op":"subscribe","resources":["eco"],"ids":["ECO-2024-003"]}
+//	{"op":"unsubscribe","resources":["eco"]}
+//	{"op":"resume","token":"42"}
+//	{"type":"presence","resource_type":"eco","resource_id":"ECO-2024-003","action":"editing"}
+type ClientMessage struct {
+	Op        string   `json:"op"`
+	Resources []string `json:"resources,omitempty"`
+	IDs       []string `json:"ids,omitempty"`
+	Token     string   `json:"token,omitempty"`
+
+	// Presence fields. Type "presence" is accepted as an alias for Op.
+	Type         string `json:"type,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   any    `json:"resource_id,omitempty"`
+	Action       string `json:"action,omitempty"`
+}
+
+// ClientInfo identifies the user behind a WebSocket connection.
+type ClientInfo struct {
+	UserID   int
+	Username string
+	Role     string
 }
 
 // client wraps a WebSocket connection with a mutex for thread-safe writes.
 type client struct {
 	conn *ws.Conn
 	mu   sync.Mutex
+	info ClientInfo
+
+	subMu     sync.RWMutex
+	resources map[string]bool
+	ids       map[string]bool
+
+	// presence holds the records this client is viewing or editing, keyed
+	// by presenceKey. Guarded by subMu.
+	presence map[string]PresenceInfo
+}
+
+// subscribed reports whether the client's subscriptions match evt. A client
+// without any subscriptions receives every event.
+func (c *client) subscribed(evt Event) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	if len(c.resources) == 0 && len(c.ids) == 0 {
+		return true
+	}
+	if evt.Resource != "" && c.resources[evt.Resource] {
+		return true
+	}
+	if evt.ID != nil && c.ids[fmt.Sprint(evt.ID)] {
+		return true
+	}
+	return false
+}
+
+func (c *client) subscribe(resources, ids []string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.resources == nil {
+		c.resources = make(map[string]bool)
+	}
+	if c.ids == nil {
+		c.ids = make(map[string]bool)
+	}
+	for _, r := range resources {
+		c.resources[r] = true
+	}
+	for _, id := range ids {
+		c.ids[id] = true
+	}
+}
+
+func (c *client) unsubscribe(resources, ids []string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, r := range resources {
+		delete(c.resources, r)
+	}
+	for _, id := range ids {
+		delete(c.ids, id)
+	}
+}
+
+// write sends a single text frame to the client.
+func (c *client) write(data []byte) (writeErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ws: write panic: %v", r)
+			writeErr = fmt.Errorf("ws: write panic: %v", r)
+		}
+	}()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return c.conn.WriteMessage(ws.TextMessage, data)
 }
 
 // Hub maintains connected WebSocket clients and broadcasts events.
 type Hub struct {
 	mu      sync.RWMutex
 	clients map[*client]struct{}
+
+	// Authorize reports whether a user with the given role may receive
+	// events for resource. role is empty when the client's role is unknown.
+	// When nil, every client receives every event.
+	Authorize func(role, resource string) bool
+
+	listenMu  sync.RWMutex
+	listeners []func(Event)
+
+	histMu  sync.Mutex
+	seq     uint64
+	history []Event
+	histMax int
 }
 
 // NewHub creates a new Hub.
 func NewHub() *Hub {
-	return &Hub{clients: make(map[*client]struct{})}
+	return &Hub{
+		clients: make(map[*client]struct{}),
+		histMax: DefaultHistorySize,
+	}
 }
 
 func (h *Hub) register(c *client) {
@@ -43,8 +172,12 @@ func (h *Hub) register(c *client) {
 
 func (h *Hub) unregister(c *client) {
 	h.mu.Lock()
+	_, registered := h.clients[c]
 	delete(h.clients, c)
 	h.mu.Unlock()
+	if registered {
+		h.clearPresence(c)
+	}
 	if c.conn != nil {
 		defer func() {
 			if r := recover(); r != nil {
@@ -55,8 +188,78 @@ func (h *Hub) unregister(c *client) {
 	}
 }
 
-// Broadcast sends an event to all connected clients.
+// allowed reports whether c may see evt under the hub's permission filter.
+// A client without a role is passed to Authorize like any other, so the
+// filter denies it module events unless the hook explicitly grants them.
+func (h *Hub) allowed(c *client, evt Event) bool {
+	if h.Authorize == nil || evt.Resource == "" {
+		return true
+	}
+	return h.Authorize(c.info.Role, evt.Resource)
+}
+
+// record assigns the next sequence number to evt and stores it for resume.
+func (h *Hub) record(evt Event) Event {
+	h.histMu.Lock()
+	defer h.histMu.Unlock()
+	h.seq++
+	evt.Seq = h.seq
+	if h.histMax > 0 {
+		h.history = append(h.history, evt)
+		if len(h.history) > h.histMax {
+			h.history = h.history[len(h.history)-h.histMax:]
+		}
+	}
+	return evt
+}
+
+// Since returns the buffered events after the given sequence number. ok is
+// false when events after seq have already been evicted from the buffer and
+// the caller must refetch instead of replaying.
+func (h *Hub) Since(seq uint64) (events []Event, ok bool) {
+	h.histMu.Lock()
+	defer h.histMu.Unlock()
+	if seq >= h.seq {
+		return nil, true
+	}
+	if len(h.history) == 0 || h.history[0].Seq > seq+1 {
+		return nil, false
+	}
+	for _, evt := range h.history {
+		if evt.Seq > seq {
+			events = append(events, evt)
+		}
+	}
+	return events, true
+}
+
+// Seq returns the sequence number of the most recent event.
+func (h *Hub) Seq() uint64 {
+	h.histMu.Lock()
+	defer h.histMu.Unlock()
+	return h.seq
+}
+
+// AddListener registers fn to be called with every broadcast event, after
+// it has been assigned a sequence number. Listeners run on their own
+// goroutine so they may block without delaying clients.
+func (h *Hub) AddListener(fn func(Event)) {
+	h.listenMu.Lock()
+	h.listeners = append(h.listeners, fn)
+	h.listenMu.Unlock()
+}
+
+// Broadcast sends an event to every connected client whose subscriptions
+// and permissions match it.
 func (h *Hub) Broadcast(evt Event) {
+	evt = h.record(evt)
+
+	h.listenMu.RLock()
+	for _, fn := range h.listeners {
+		go fn(evt)
+	}
+	h.listenMu.RUnlock()
+
 	data, err := json.Marshal(evt)
 	if err != nil {
 		log.Printf("ws: marshal error: %v", err)
@@ -70,20 +273,10 @@ func (h *Hub) Broadcast(evt Event) {
 	h.mu.RUnlock()
 
 	for _, c := range clients {
-		c.mu.Lock()
-		writeErr := func() (writeErr error) {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("ws: write panic: %v", r)
-					writeErr = fmt.Errorf("ws: write panic: %v", r)
-				}
-			}()
-			_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-			return c.conn.WriteMessage(ws.TextMessage, data)
-		}()
-		c.mu.Unlock()
-
-		if writeErr != nil {
+		if !h.allowed(c, evt) || !c.subscribed(evt) {
+			continue
+		}
+		if err := c.write(data); err != nil {
 			h.unregister(c)
 		}
 	}
@@ -99,12 +292,72 @@ func (h *Hub) ClientCount() int {
 // BroadcastChange is a convenience helper for broadcasting resource changes.
 func (h *Hub) BroadcastChange(resourceType, action string, id any) {
 	h.Broadcast(Event{
-		Type:   resourceType + "_" + action + "d",
-		ID:     id,
-		Action: action,
+		Type:     resourceType + "_" + action + "d",
+		ID:       id,
+		Action:   action,
+		Resource: resourceType,
 	})
 }
 
+// replay sends the client every buffered event after token that it is
+// allowed and subscribed to see. If the token is too old, a single
+// "resync_required" event is sent instead.
+func (h *Hub) replay(c *client, token string) error {
+	seq, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return h.sendControl(c, Event{Type: "error", Action: "resume", Data: "invalid resume token"})
+	}
+	events, ok := h.Since(seq)
+	if !ok {
+		return h.sendControl(c, Event{Type: "resync_required", Action: "resume", Seq: h.Seq()})
+	}
+	for _, evt := range events {
+		if !h.allowed(c, evt) || !c.subscribed(evt) {
+			continue
+		}
+		data, err := json.Marshal(evt)
+		if err != nil {
+			continue
+		}
+		if err := c.write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendControl writes a hub-generated event directly to one client.
+func (h *Hub) sendControl(c *client, evt Event) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+// handleMessage applies a client control message.
+func (h *Hub) handleMessage(c *client, raw []byte) {
+	var msg ClientMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return
+	}
+	if msg.Op == "" {
+		msg.Op = msg.Type
+	}
+	switch msg.Op {
+	case "subscribe":
+		c.subscribe(msg.Resources, msg.IDs)
+		h.sendControl(c, Event{Type: "subscribed", Action: msg.Op, Seq: h.Seq()})
+	case "unsubscribe":
+		c.unsubscribe(msg.Resources, msg.IDs)
+		h.sendControl(c, Event{Type: "unsubscribed", Action: msg.Op, Seq: h.Seq()})
+	case "resume":
+		h.replay(c, msg.Token)
+	case "presence":
+		h.setPresence(c, msg.ResourceType, fmt.Sprint(msg.ResourceID), msg.Action)
+	}
+}
+
 // Upgrader is the default WebSocket upgrader.
 var Upgrader = ws.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
@@ -112,13 +365,23 @@ var Upgrader = ws.Upgrader{
 
 // HandleWebSocket upgrades the connection and keeps it alive with pings.
 func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	HandleWebSocketAs(hub, w, r, ClientInfo{})
+}
+
+// HandleWebSocketAs upgrades the connection for a known user so that events
+// can be filtered by the user's permissions. Initial subscriptions may be
+// given with the "resources" and "ids" query parameters (comma separated),
+// and a "resume" query parameter replays events missed since that token.
+func HandleWebSocketAs(hub *Hub, w http.ResponseWriter, r *http.Request, info ClientInfo) {
 	conn, err := Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("ws: upgrade error: %v", err)
 		return
 	}
 
-	c := &client{conn: conn}
+	c := &client{conn: conn, info: info}
+	q := r.URL.Query()
+	c.subscribe(splitList(q.Get("resources")), splitList(q.Get("ids")))
 	hub.register(c)
 
 	hub.mu.RLock()
@@ -127,6 +390,10 @@ func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("ws: client connected (%d total)", clientCount)
 
+	if token := q.Get("resume"); token != "" {
+		hub.replay(c, token)
+	}
+
 	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	conn.SetPongHandler(func(string) error {
 		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -147,11 +414,23 @@ func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}()
 
 	for {
-		_, _, err := conn.ReadMessage()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		hub.handleMessage(c, msg)
 	}
 	hub.unregister(c)
 	log.Printf("ws: client disconnected")
 }
+
+// splitList splits a comma separated query value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
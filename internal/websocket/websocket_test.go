@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+func dialHub(t *testing.T, hub *Hub, info ClientInfo, query string) *ws.Conn {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocketAs(hub, w, r, info)
+	}))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?" + query
+	conn, _, err := ws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	deadline := time.Now().Add(time.Second)
+	for hub.ClientCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return conn
+}
+
+func readEvent(t *testing.T, conn *ws.Conn) (Event, bool) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return Event{}, false
+	}
+	var evt Event
+	if err := json.Unmarshal(msg, &evt); err != nil {
+		t.Fatalf("invalid event JSON: %v", err)
+	}
+	return evt, true
+}
+
+func TestBroadcast_NoSubscriptionReceivesAll(t *testing.T) {
+	hub := NewHub()
+	conn := dialHub(t, hub, ClientInfo{}, "")
+
+	hub.BroadcastChange("eco", "update", "ECO-1")
+	evt, ok := readEvent(t, conn)
+	if !ok {
+		t.Fatal("expected event")
+	}
+	if evt.Resource != "eco" || evt.Seq != 1 {
+		t.Errorf("unexpected event %+v", evt)
+	}
+}
+
+func TestBroadcast_ResourceSubscription(t *testing.T) {
+	hub := NewHub()
+	conn := dialHub(t, hub, ClientInfo{}, "resources=work_order")
+
+	hub.BroadcastChange("eco", "update", "ECO-1")
+	hub.BroadcastChange("work_order", "update", "WO-1")
+
+	evt, ok := readEvent(t, conn)
+	if !ok || evt.ID != "WO-1" {
+		t.Fatalf("expected WO-1 event, got %+v (ok=%v)", evt, ok)
+	}
+	if _, ok := readEvent(t, conn); ok {
+		t.Error("expected no further events")
+	}
+}
+
+func TestBroadcast_IDSubscriptionViaMessage(t *testing.T) {
+	hub := NewHub()
+	conn := dialHub(t, hub, ClientInfo{}, "")
+
+	conn.WriteJSON(ClientMessage{Op: "subscribe", IDs: []string{"ECO-2"}})
+	if evt, ok := readEvent(t, conn); !ok || evt.Type != "subscribed" {
+		t.Fatalf("expected subscribed ack, got %+v", evt)
+	}
+
+	hub.BroadcastChange("eco", "update", "ECO-1")
+	hub.BroadcastChange("eco", "update", "ECO-2")
+	evt, ok := readEvent(t, conn)
+	if !ok || evt.ID != "ECO-2" {
+		t.Fatalf("expected ECO-2 event, got %+v", evt)
+	}
+}
+
+func TestBroadcast_PermissionFilter(t *testing.T) {
+	hub := NewHub()
+	hub.Authorize = func(role, resource string) bool {
+		return !(role == "readonly" && resource == "ncr")
+	}
+	conn := dialHub(t, hub, ClientInfo{Username: "ro", Role: "readonly"}, "")
+
+	hub.BroadcastChange("ncr", "create", "NCR-1")
+	hub.BroadcastChange("eco", "create", "ECO-1")
+
+	evt, ok := readEvent(t, conn)
+	if !ok || evt.Resource != "eco" {
+		t.Fatalf("expected only eco event, got %+v", evt)
+	}
+}
+
+func TestBroadcast_EmptyRoleDenied(t *testing.T) {
+	hub := NewHub()
+	hub.Authorize = func(role, resource string) bool {
+		return role == "admin" || resource == "presence"
+	}
+	conn := dialHub(t, hub, ClientInfo{Username: "anon"}, "")
+
+	hub.BroadcastChange("ncr", "create", "NCR-1")
+	hub.BroadcastChange("presence", "update", "ECO-1")
+
+	evt, ok := readEvent(t, conn)
+	if !ok || evt.Resource != "presence" {
+		t.Fatalf("expected only presence event, got %+v", evt)
+	}
+	if evt, ok := readEvent(t, conn); ok {
+		t.Errorf("unexpected event for client without role: %+v", evt)
+	}
+}
+
+func TestResume_ReplaysMissedEvents(t *testing.T) {
+	hub := NewHub()
+	hub.BroadcastChange("eco", "update", "ECO-1")
+	hub.BroadcastChange("eco", "update", "ECO-2")
+	hub.BroadcastChange("eco", "update", "ECO-3")
+
+	conn := dialHub(t, hub, ClientInfo{}, "resume=1")
+	var got []any
+	for {
+		evt, ok := readEvent(t, conn)
+		if !ok {
+			break
+		}
+		got = append(got, evt.ID)
+	}
+	if len(got) != 2 || got[0] != "ECO-2" || got[1] != "ECO-3" {
+		t.Errorf("expected ECO-2, ECO-3 replayed, got %v", got)
+	}
+}
+
+func TestResume_TokenTooOld(t *testing.T) {
+	hub := NewHub()
+	hub.histMax = 2
+	for i := 0; i < 5; i++ {
+		hub.BroadcastChange("eco", "update", i)
+	}
+	if _, ok := hub.Since(1); ok {
+		t.Fatal("expected evicted token to be rejected")
+	}
+
+	conn := dialHub(t, hub, ClientInfo{}, "resume=1")
+	evt, ok := readEvent(t, conn)
+	if !ok || evt.Type != "resync_required" || evt.Seq != 5 {
+		t.Errorf("expected resync_required at seq 5, got %+v", evt)
+	}
+}
@@ -59,6 +59,15 @@ func main() {
 	// Start auto-backup scheduler (default 2am, override with ZRP_BACKUP_TIME=HH:MM)
 	startAutoBackup(os.Getenv("ZRP_BACKUP_TIME"))
 
+	// Start outbound webhook delivery
+	startWebhookDispatcher()
+
+	// Accept support email into field reports (off unless ZRP_INTAKE_SMTP_ADDR is set, e.g. :2525)
+	startEmailIntake(os.Getenv("ZRP_INTAKE_SMTP_ADDR"))
+
+	// Load the parts catalog and watch the gitplm directory for changes
+	startPartsCatalogWatch(5 * time.Second)
+
 	// Start undo log cleanup goroutine
 	go cleanExpiredUndo()
 
@@ -158,6 +167,8 @@ func main() {
 			handleUpdateDashboardWidgets(w, r)
 		case path == "dashboard/widgets" && r.Method == "GET":
 			handleGetDashboardWidgets(w, r)
+		case path == "dashboard/spc" && r.Method == "GET":
+			handleDashboardSPC(w, r)
 
 		// Audit
 		case path == "audit" || (parts[0] == "audit" && len(parts) == 1):
@@ -170,6 +181,12 @@ func main() {
 			handleAuditRetention(w, r)
 		case parts[0] == "audit" && len(parts) == 2 && parts[1] == "cleanup" && r.Method == "POST":
 			handleAuditRetention(w, r)
+		case parts[0] == "audit" && len(parts) == 2 && parts[1] == "verify" && r.Method == "GET":
+			handleAuditVerify(w, r)
+		case parts[0] == "audit" && len(parts) == 2 && parts[1] == "checkpoints" && (r.Method == "GET" || r.Method == "POST"):
+			handleAuditCheckpoints(w, r)
+		case parts[0] == "audit" && len(parts) == 2 && parts[1] == "archives" && r.Method == "GET":
+			handleAuditArchives(w, r)
 
 		// Parts
 		case parts[0] == "parts" && len(parts) == 2 && parts[1] == "export" && r.Method == "GET":
@@ -186,8 +203,36 @@ func main() {
 			handleGetPart(w, r, parts[1])
 		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "bom" && r.Method == "GET":
 			handlePartBOM(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 4 && parts[2] == "bom" && parts[3] == "diff" && r.Method == "GET":
+			handleBOMDiff(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 4 && parts[2] == "bom" && parts[3] == "import" && r.Method == "POST":
+			handlePreviewBOMImport(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 5 && parts[2] == "bom" && parts[3] == "import" && parts[4] == "confirm" && r.Method == "POST":
+			handleConfirmBOMImport(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[1] == "obsolescence" && parts[2] == "scan" && r.Method == "POST":
+			handleScanObsolescence(w, r)
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "lifecycle" && r.Method == "GET":
+			handleGetPartLifecycle(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "lifecycle" && r.Method == "POST":
+			handleSetPartLifecycle(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 4 && parts[2] == "lifecycle" && parts[3] == "impact" && r.Method == "GET":
+			handlePartLifecycleImpact(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "obsolescence" && r.Method == "PUT":
+			handleUpdateObsolescence(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "revisions" && r.Method == "GET":
+			handleListPartRevisions(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "revisions" && r.Method == "POST":
+			handleCreatePartRevision(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "alternates" && r.Method == "GET":
+			handleListPartAlternates(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "alternates" && r.Method == "POST":
+			handleCreatePartAlternate(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 4 && parts[2] == "alternates" && r.Method == "DELETE":
+			handleDeletePartAlternate(w, r, parts[1], parts[3])
 		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "cost" && r.Method == "GET":
 			handlePartCost(w, r, parts[1])
+		case parts[0] == "parts" && len(parts) == 4 && parts[2] == "cost" && parts[3] == "rollup" && r.Method == "GET":
+			handlePartCostRollup(w, r, parts[1])
 		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "where-used" && r.Method == "GET":
 			handleWhereUsed(w, r, parts[1])
 		case parts[0] == "parts" && len(parts) == 3 && parts[2] == "changes" && r.Method == "POST":
@@ -216,6 +261,18 @@ func main() {
 			handleCreateCategory(w, r)
 		case parts[0] == "categories" && len(parts) == 1 && r.Method == "GET":
 			handleListCategories(w, r)
+		case parts[0] == "categories" && len(parts) == 2 && parts[1] == "ipn-schemes" && r.Method == "GET":
+			handleListIPNSchemes(w, r)
+		case parts[0] == "categories" && len(parts) == 3 && parts[1] == "ipn-schemes" && parts[2] == "report" && r.Method == "GET":
+			handleIPNSchemeReport(w, r)
+		case parts[0] == "categories" && len(parts) == 3 && parts[2] == "ipn-scheme" && r.Method == "GET":
+			handleGetIPNScheme(w, r, parts[1])
+		case parts[0] == "categories" && len(parts) == 3 && parts[2] == "ipn-scheme" && r.Method == "PUT":
+			handleUpdateIPNScheme(w, r, parts[1])
+		case parts[0] == "categories" && len(parts) == 3 && parts[2] == "ipn-scheme" && r.Method == "DELETE":
+			handleDeleteIPNScheme(w, r, parts[1])
+		case parts[0] == "categories" && len(parts) == 4 && parts[2] == "ipn-scheme" && parts[3] == "reserve" && r.Method == "POST":
+			handleReserveIPN(w, r, parts[1])
 		case parts[0] == "categories" && len(parts) == 3 && parts[2] == "columns" && r.Method == "POST":
 			handleAddColumn(w, r, parts[1])
 		case parts[0] == "categories" && len(parts) == 4 && parts[2] == "columns" && r.Method == "DELETE":
@@ -242,10 +299,16 @@ func main() {
 			handleUpdateECO(w, r, parts[1])
 		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "approve" && r.Method == "POST":
 			handleApproveECO(w, r, parts[1])
+		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "signatures" && r.Method == "GET":
+			handleECOSignatures(w, r, parts[1])
+		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "pdf" && r.Method == "GET":
+			handleECOPDF(w, r, parts[1])
 		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "implement" && r.Method == "POST":
 			handleImplementECO(w, r, parts[1])
 		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "part-changes" && r.Method == "GET":
 			handleListECOPartChanges(w, r, parts[1])
+		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "bom-impact" && r.Method == "GET":
+			handleECOBOMImpact(w, r, parts[1])
 		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "revisions" && r.Method == "GET":
 			handleListECORevisions(w, r, parts[1])
 		case parts[0] == "ecos" && len(parts) == 3 && parts[2] == "revisions" && r.Method == "POST":
@@ -264,6 +327,10 @@ func main() {
 			handleUpdateDoc(w, r, parts[1])
 		case parts[0] == "docs" && len(parts) == 3 && parts[2] == "approve" && r.Method == "POST":
 			handleApproveDoc(w, r, parts[1])
+		case parts[0] == "docs" && len(parts) == 3 && parts[2] == "signatures" && r.Method == "GET":
+			handleDocSignatures(w, r, parts[1])
+		case parts[0] == "docs" && len(parts) == 3 && parts[2] == "pdf" && r.Method == "GET":
+			handleDocPDF(w, r, parts[1])
 		case parts[0] == "docs" && len(parts) == 3 && parts[2] == "versions" && r.Method == "GET":
 			handleListDocVersions(w, r, parts[1])
 		case parts[0] == "docs" && len(parts) == 4 && parts[2] == "versions" && r.Method == "GET":
@@ -279,6 +346,26 @@ func main() {
 		case parts[0] == "docs" && len(parts) == 3 && parts[2] == "sync" && r.Method == "POST":
 			handleSyncDocFromGit(w, r, parts[1])
 
+		// Training
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "requirements" && r.Method == "GET":
+			handleListTrainingRequirements(w, r)
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "requirements" && r.Method == "POST":
+			handleCreateTrainingRequirement(w, r)
+		case parts[0] == "training" && len(parts) == 3 && parts[1] == "requirements" && r.Method == "DELETE":
+			handleDeleteTrainingRequirement(w, r, parts[2])
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "records" && r.Method == "GET":
+			handleListTrainingRecords(w, r)
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "records" && r.Method == "POST":
+			handleCreateTrainingRecord(w, r)
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "tasks" && r.Method == "GET":
+			handleListTrainingTasks(w, r)
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "tasks" && r.Method == "POST":
+			handleCreateTrainingTask(w, r)
+		case parts[0] == "training" && len(parts) == 3 && parts[1] == "tasks" && r.Method == "PUT":
+			handleUpdateTrainingTask(w, r, parts[2])
+		case parts[0] == "training" && len(parts) == 2 && parts[1] == "qualification" && r.Method == "GET":
+			handleGetQualification(w, r)
+
 		// Vendors
 		case parts[0] == "vendors" && len(parts) == 2 && parts[1] == "export" && r.Method == "GET":
 			handleExportVendors(w, r)
@@ -352,6 +439,12 @@ func main() {
 			handleWorkOrderPDF(w, r, parts[1])
 		case parts[0] == "workorders" && len(parts) == 3 && parts[2] == "bom" && r.Method == "GET":
 			handleWorkOrderBOM(w, r, parts[1])
+		case parts[0] == "workorders" && len(parts) == 3 && parts[2] == "substitutions" && r.Method == "GET":
+			handleWorkOrderSubstitutions(w, r, parts[1])
+		case parts[0] == "workorders" && len(parts) == 3 && parts[2] == "substitutions" && r.Method == "POST":
+			handleWorkOrderAddSubstitution(w, r, parts[1])
+		case parts[0] == "workorders" && len(parts) == 5 && parts[2] == "serials" && parts[4] == "as-built" && r.Method == "GET":
+			handleWorkOrderAsBuilt(w, r, parts[1], parts[3])
 
 		// Tests
 		case parts[0] == "tests" && len(parts) == 1 && r.Method == "GET":
@@ -376,6 +469,18 @@ func main() {
 			handleCreateCAPAFromNCR(w, r, parts[1])
 		case parts[0] == "ncrs" && len(parts) == 3 && parts[2] == "create-eco" && r.Method == "POST":
 			handleCreateECOFromNCR(w, r, parts[1])
+		case parts[0] == "ncrs" && len(parts) == 3 && parts[2] == "mrb" && r.Method == "GET":
+			handleGetNCRMRB(w, r, parts[1])
+		case parts[0] == "ncrs" && len(parts) == 3 && parts[2] == "quarantine" && r.Method == "POST":
+			handleQuarantineNCRStock(w, r, parts[1])
+		case parts[0] == "ncrs" && len(parts) == 3 && parts[2] == "dispositions" && r.Method == "POST":
+			handleDispositionNCR(w, r, parts[1])
+		case parts[0] == "mrb" && len(parts) == 1 && r.Method == "GET":
+			handleListMRB(w, r)
+		case parts[0] == "spc" && len(parts) == 2 && parts[1] == "chart" && r.Method == "GET":
+			handleGetSPCChart(w, r)
+		case parts[0] == "spc" && len(parts) == 2 && parts[1] == "violations" && r.Method == "GET":
+			handleListSPCViolations(w, r)
 
 		// Devices
 		case parts[0] == "devices" && len(parts) == 2 && parts[1] == "bulk" && r.Method == "POST":
@@ -456,6 +561,36 @@ func main() {
 			handleGetCAPA(w, r, parts[1])
 		case parts[0] == "capas" && len(parts) == 2 && r.Method == "PUT":
 			handleUpdateCAPA(w, r, parts[1])
+		case parts[0] == "capas" && len(parts) == 3 && parts[2] == "signatures" && r.Method == "GET":
+			handleCAPASignatures(w, r, parts[1])
+		case parts[0] == "capas" && len(parts) == 3 && parts[2] == "pdf" && r.Method == "GET":
+			handleCAPAPDF(w, r, parts[1])
+
+		// 8D reports
+		case parts[0] == "8d" && len(parts) == 1 && r.Method == "GET":
+			handleListEightDs(w, r)
+		case parts[0] == "8d" && len(parts) == 1 && r.Method == "POST":
+			handleCreateEightD(w, r)
+		case parts[0] == "8d" && len(parts) == 2 && r.Method == "GET":
+			handleGetEightD(w, r, parts[1])
+		case parts[0] == "8d" && len(parts) == 3 && parts[2] == "pdf" && r.Method == "GET":
+			handleEightDPDF(w, r, parts[1])
+		case parts[0] == "8d" && len(parts) == 4 && parts[2] == "disciplines" && r.Method == "PUT":
+			handleUpdateEightDDiscipline(w, r, parts[1], parts[3])
+		case parts[0] == "8d" && len(parts) == 5 && parts[2] == "disciplines" && parts[4] == "complete" && r.Method == "POST":
+			handleCompleteEightDDiscipline(w, r, parts[1], parts[3])
+		case parts[0] == "8d" && len(parts) == 3 && parts[2] == "team" && r.Method == "POST":
+			handleAddEightDMember(w, r, parts[1])
+		case parts[0] == "8d" && len(parts) == 4 && parts[2] == "team" && r.Method == "DELETE":
+			handleRemoveEightDMember(w, r, parts[1], parts[3])
+		case parts[0] == "8d" && len(parts) == 3 && parts[2] == "causes" && r.Method == "POST":
+			handleAddEightDCause(w, r, parts[1])
+		case parts[0] == "8d" && len(parts) == 4 && parts[2] == "causes" && r.Method == "DELETE":
+			handleDeleteEightDCause(w, r, parts[1], parts[3])
+		case parts[0] == "8d" && len(parts) == 3 && parts[2] == "actions" && r.Method == "POST":
+			handleAddEightDAction(w, r, parts[1])
+		case parts[0] == "8d" && len(parts) == 4 && parts[2] == "actions" && r.Method == "PUT":
+			handleUpdateEightDAction(w, r, parts[1], parts[3])
 
 		// RMAs
 		case parts[0] == "rmas" && len(parts) == 2 && parts[1] == "bulk" && r.Method == "POST":
@@ -468,6 +603,40 @@ func main() {
 			handleGetRMA(w, r, parts[1])
 		case parts[0] == "rmas" && len(parts) == 2 && r.Method == "PUT":
 			handleUpdateRMA(w, r, parts[1])
+		case parts[0] == "rmas" && len(parts) == 3 && parts[2] == "lines" && r.Method == "POST":
+			handleAddRMALine(w, r, parts[1])
+		case parts[0] == "rmas" && len(parts) == 4 && parts[2] == "lines" && r.Method == "PUT":
+			handleUpdateRMALine(w, r, parts[1], parts[3])
+		case parts[0] == "rmas" && len(parts) == 5 && parts[2] == "lines" && parts[4] == "advance-replacement" && r.Method == "POST":
+			handleAdvanceReplacement(w, r, parts[1], parts[3])
+		case parts[0] == "rmas" && len(parts) == 3 && parts[2] == "repair-wo" && r.Method == "POST":
+			handleCreateRMARepairWO(w, r, parts[1])
+		case parts[0] == "rmas" && len(parts) == 3 && parts[2] == "parts" && r.Method == "POST":
+			handleConsumeRMAPart(w, r, parts[1])
+
+		// Warranty policies and service contracts
+		case parts[0] == "warranty-policies" && len(parts) == 1 && r.Method == "GET":
+			handleListWarrantyPolicies(w, r)
+		case parts[0] == "warranty-policies" && len(parts) == 1 && r.Method == "POST":
+			handleCreateWarrantyPolicy(w, r)
+		case parts[0] == "warranty-policies" && len(parts) == 2 && r.Method == "PUT":
+			handleUpdateWarrantyPolicy(w, r, parts[1])
+		case parts[0] == "warranty-policies" && len(parts) == 2 && r.Method == "DELETE":
+			handleDeleteWarrantyPolicy(w, r, parts[1])
+		case parts[0] == "service-contracts" && len(parts) == 2 && parts[1] == "expiring" && r.Method == "GET":
+			handleExpiringServiceContracts(w, r)
+		case parts[0] == "service-contracts" && len(parts) == 1 && r.Method == "GET":
+			handleListServiceContracts(w, r)
+		case parts[0] == "service-contracts" && len(parts) == 1 && r.Method == "POST":
+			handleCreateServiceContract(w, r)
+		case parts[0] == "service-contracts" && len(parts) == 2 && r.Method == "GET":
+			handleGetServiceContract(w, r, parts[1])
+		case parts[0] == "service-contracts" && len(parts) == 2 && r.Method == "PUT":
+			handleUpdateServiceContract(w, r, parts[1])
+
+		// Reliability
+		case parts[0] == "reliability" && len(parts) == 1 && r.Method == "GET":
+			handleGetReliability(w, r)
 
 		// Quotes
 		case parts[0] == "quotes" && len(parts) == 1 && r.Method == "GET":
@@ -577,6 +746,48 @@ func main() {
 		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "gitplm" && r.Method == "PUT":
 			handleUpdateGitPLMConfig(w, r)
 
+		// Cost rolls
+		case parts[0] == "cost-rolls" && len(parts) == 1 && r.Method == "GET":
+			handleListCostRolls(w, r)
+		case parts[0] == "cost-rolls" && len(parts) == 1 && r.Method == "POST":
+			handleCreateCostRoll(w, r)
+		case parts[0] == "cost-rolls" && len(parts) == 2 && r.Method == "GET":
+			handleGetCostRoll(w, r, parts[1])
+		case parts[0] == "cost-rolls" && len(parts) == 2 && r.Method == "DELETE":
+			handleDeleteCostRoll(w, r, parts[1])
+		case parts[0] == "cost-rolls" && len(parts) == 3 && parts[2] == "freeze" && r.Method == "POST":
+			handleFreezeCostRoll(w, r, parts[1])
+		case parts[0] == "cost-rolls" && len(parts) == 3 && parts[2] == "variance" && r.Method == "GET":
+			handleCostRollVariance(w, r, parts[1])
+
+		// Settings/BOM
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "bom" && r.Method == "GET":
+			handleGetBOMSettings(w, r)
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "bom" && r.Method == "PUT":
+			handleUpdateBOMSettings(w, r)
+
+		// Settings/RMA
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "rma" && r.Method == "GET":
+			handleGetRMASettings(w, r)
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "rma" && r.Method == "PUT":
+			handleUpdateRMASettings(w, r)
+
+		// Settings/Email intake
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "email-intake" && r.Method == "GET":
+			handleGetEmailIntakeSettings(w, r)
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "email-intake" && r.Method == "PUT":
+			handleUpdateEmailIntakeSettings(w, r)
+
+		// Settings/SPC
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "spc" && r.Method == "GET":
+			handleGetSPCSettings(w, r)
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "spc" && r.Method == "PUT":
+			handleUpdateSPCSettings(w, r)
+
+		// Settings/E-signatures
+		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "esign" && (r.Method == "GET" || r.Method == "PUT"):
+			handleESignSettings(w, r)
+
 		// Settings/Git Docs
 		case parts[0] == "settings" && len(parts) == 2 && parts[1] == "git-docs" && r.Method == "GET":
 			handleGetGitDocsSettings(w, r)
@@ -626,6 +837,8 @@ func main() {
 			handleReportLowStock(w, r)
 		case parts[0] == "reports" && len(parts) == 2 && parts[1] == "ncr-summary":
 			handleReportNCRSummary(w, r)
+		case parts[0] == "reports" && len(parts) == 2 && parts[1] == "scrap-cost":
+			handleReportScrapCost(w, r)
 
 		// Notifications
 		case parts[0] == "notifications" && len(parts) == 1 && r.Method == "GET":
@@ -697,6 +910,28 @@ func main() {
 		case parts[0] == "changes" && len(parts) == 2 && r.Method == "POST":
 			handleUndoChange(w, r, parts[1])
 
+		// Webhooks
+		case parts[0] == "webhooks" && len(parts) == 1 && r.Method == "GET":
+			handleListWebhooks(w, r)
+		case parts[0] == "webhooks" && len(parts) == 1 && r.Method == "POST":
+			handleCreateWebhook(w, r)
+		case parts[0] == "webhooks" && len(parts) == 2 && parts[1] == "events" && r.Method == "GET":
+			handleListWebhookEvents(w, r)
+		case parts[0] == "webhooks" && len(parts) == 2 && r.Method == "GET":
+			handleGetWebhook(w, r, parts[1])
+		case parts[0] == "webhooks" && len(parts) == 2 && r.Method == "PUT":
+			handleUpdateWebhook(w, r, parts[1])
+		case parts[0] == "webhooks" && len(parts) == 2 && r.Method == "DELETE":
+			handleDeleteWebhook(w, r, parts[1])
+		case parts[0] == "webhooks" && len(parts) == 3 && parts[2] == "deliveries" && r.Method == "GET":
+			handleListWebhookDeliveries(w, r, parts[1])
+		case parts[0] == "webhooks" && len(parts) == 4 && parts[1] == "deliveries" && parts[3] == "redeliver" && r.Method == "POST":
+			handleRedeliverWebhook(w, r, parts[2])
+
+		// Presence
+		case parts[0] == "presence" && len(parts) == 1 && r.Method == "GET":
+			handlePresence(w, r)
+
 		// Undo (legacy)
 		case parts[0] == "undo" && len(parts) == 1 && r.Method == "GET":
 			handleListUndo(w, r)
@@ -708,6 +943,28 @@ func main() {
 			handleCreateBackup(w, r)
 		case parts[0] == "admin" && len(parts) == 2 && parts[1] == "backups" && r.Method == "GET":
 			handleListBackups(w, r)
+		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backups" && parts[2] == "retention" && r.Method == "GET":
+			handleGetBackupRetention(w, r)
+		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backups" && parts[2] == "retention" && r.Method == "PUT":
+			handleUpdateBackupRetention(w, r)
+		case parts[0] == "admin" && len(parts) == 4 && parts[1] == "backups" && parts[3] == "verify" && r.Method == "POST":
+			handleVerifyBackup(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 4 && parts[1] == "backups" && parts[3] == "upload" && r.Method == "POST":
+			handleUploadBackup(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 2 && parts[1] == "backup-targets" && r.Method == "GET":
+			handleListBackupTargets(w, r)
+		case parts[0] == "admin" && len(parts) == 2 && parts[1] == "backup-targets" && r.Method == "POST":
+			handleCreateBackupTarget(w, r)
+		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backup-targets" && r.Method == "PUT":
+			handleUpdateBackupTarget(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backup-targets" && r.Method == "DELETE":
+			handleDeleteBackupTarget(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 4 && parts[1] == "backup-targets" && parts[3] == "test" && r.Method == "POST":
+			handleTestBackupTarget(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 4 && parts[1] == "backup-targets" && parts[3] == "backups" && r.Method == "GET":
+			handleListRemoteBackups(w, r, parts[2])
+		case parts[0] == "admin" && len(parts) == 4 && parts[1] == "backup-targets" && parts[3] == "fetch" && r.Method == "POST":
+			handleFetchRemoteBackup(w, r, parts[2])
 		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backups" && r.Method == "GET":
 			handleDownloadBackup(w, r, parts[2])
 		case parts[0] == "admin" && len(parts) == 3 && parts[1] == "backups" && r.Method == "DELETE":
@@ -720,6 +977,8 @@ func main() {
 			handleListFieldReports(w, r)
 		case parts[0] == "field-reports" && len(parts) == 1 && r.Method == "POST":
 			handleCreateFieldReport(w, r)
+		case parts[0] == "field-reports" && len(parts) == 2 && parts[1] == "inbound" && r.Method == "POST":
+			handleReceiveFieldReportEmail(w, r)
 		case parts[0] == "field-reports" && len(parts) == 2 && r.Method == "GET":
 			handleGetFieldReport(w, r, parts[1])
 		case parts[0] == "field-reports" && len(parts) == 2 && r.Method == "PUT":
@@ -728,6 +987,8 @@ func main() {
 			handleDeleteFieldReport(w, r, parts[1])
 		case parts[0] == "field-reports" && len(parts) == 3 && parts[2] == "create-ncr" && r.Method == "POST":
 			handleFieldReportCreateNCR(w, r, parts[1])
+		case parts[0] == "field-reports" && len(parts) == 3 && parts[2] == "emails" && r.Method == "GET":
+			handleListFieldReportEmails(w, r, parts[1])
 
 		// Sales Orders
 		case parts[0] == "sales-orders" && len(parts) == 1 && r.Method == "GET":
@@ -808,7 +1069,7 @@ func main() {
 		w.Write([]byte(`{"status":"ok"}`))
 	})
 	// Middleware chain: security headers -> rate limit -> gzip -> logging -> auth -> rbac -> routes
-	root.Handle("/", securityHeaders(rateLimitMiddleware(gzipMiddleware(logging(requireAuth(requireRBAC(mux)))))))
+	root.Handle("/", securityHeaders(rateLimitMiddleware(gzipMiddleware(logging(requireAuth(requireRBAC(optimisticConcurrency(mux))))))))
 
 	addr := fmt.Sprintf(":%d", *port)
 	log.Printf("ZRP server starting on http://localhost%s", addr)
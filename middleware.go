@@ -50,6 +50,10 @@ func requireRBAC(next http.Handler) http.Handler {
 	return server.RequireRBAC(permCache)(next)
 }
 
+func optimisticConcurrency(next http.Handler) http.Handler {
+	return server.OptimisticConcurrency(db)(next)
+}
+
 func rateLimitMiddleware(next http.Handler) http.Handler {
 	return server.RateLimitMiddleware(globalRateLimiter)(next)
 }
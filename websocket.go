@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"zrp/internal/auth"
+	"zrp/internal/response"
 	"zrp/internal/websocket"
 )
 
@@ -11,11 +13,47 @@ type WSEvent = websocket.Event
 type Hub = websocket.Hub
 
 // Global hub instance.
-var wsHub = websocket.NewHub()
+var wsHub = newWSHub()
+
+// newWSHub creates the hub and filters events by the receiving user's
+// view permission on the event's module.
+func newWSHub() *websocket.Hub {
+	hub := websocket.NewHub()
+	hub.Authorize = func(role, resource string) bool {
+		module := auth.ResourceModule(resource)
+		if module == "" {
+			return true
+		}
+		return permCache.HasPermission(role, module, auth.PermActionView)
+	}
+	return hub
+}
 
 // handleWebSocket upgrades the HTTP connection to a WebSocket.
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	websocket.HandleWebSocket(wsHub, w, r)
+	userID, _ := r.Context().Value(ctxUserID).(int)
+	role, _ := r.Context().Value(ctxRole).(string)
+	info := websocket.ClientInfo{UserID: userID, Role: role}
+	if userID != 0 {
+		info.Username = getUsername(r)
+	}
+	websocket.HandleWebSocketAs(wsHub, w, r, info)
+}
+
+// handlePresence lists the users currently viewing or editing a record.
+func handlePresence(w http.ResponseWriter, r *http.Request) {
+	resourceType := r.URL.Query().Get("resource_type")
+	resourceID := r.URL.Query().Get("resource_id")
+	if resourceType == "" || resourceID == "" {
+		response.Err(w, "resource_type and resource_id are required", 400)
+		return
+	}
+	role, _ := r.Context().Value(ctxRole).(string)
+	if wsHub.Authorize != nil && !wsHub.Authorize(role, resourceType) {
+		response.Err(w, "Permission denied", 403)
+		return
+	}
+	response.JSON(w, wsHub.Presence(resourceType, resourceID))
 }
 
 // broadcast is a convenience helper used by handlers.
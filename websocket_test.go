@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +14,27 @@ import (
 	internalws "zrp/internal/websocket"
 )
 
+// newAdminWSServer serves handleWebSocket to an admin session. Events are
+// filtered by module view permission, so tests that expect module events
+// must connect with a role.
+func newAdminWSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	oldDB := db
+	db = setupPermissionsTestDB(t)
+	seedDefaultPermissionsForTest(t, db)
+	initPermCache()
+	refreshPermCache()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleWebSocket(w, r.WithContext(context.WithValue(r.Context(), ctxRole, "admin")))
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		db.Close()
+		db = oldDB
+	})
+	return server
+}
+
 func TestWSHub_RegisterUnregister(t *testing.T) {
 	// Start a test server to create real WebSocket connections
 	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
@@ -411,8 +433,7 @@ func TestWebSocket_ConcurrentBroadcasts(t *testing.T) {
 }
 
 func TestBroadcastHelperFunc(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
-	defer server.Close()
+	server := newAdminWSServer(t)
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
@@ -569,8 +590,7 @@ func TestWebSocket_TypeVariations(t *testing.T) {
 		{"test", "create", "test_created"},
 	}
 
-	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
-	defer server.Close()
+	server := newAdminWSServer(t)
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
@@ -436,11 +436,7 @@ func TestLoginRateLimiting(t *testing.T) {
 // --- broadcast helper test ---
 
 func TestBroadcastHelper(t *testing.T) {
-	oldDB := db; db = setupTestDB(t)
-	defer func() { db.Close(); db = oldDB }()
-
-	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
-	defer srv.Close()
+	srv := newAdminWSServer(t)
 
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/"
 	conn, _, _ := websocket.DefaultDialer.Dial(wsURL, nil)